@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"github.com/hotosm/scaleodm/app/auth"
+	"github.com/hotosm/scaleodm/app/config"
+	"github.com/hotosm/scaleodm/app/meta"
+)
+
+// newAuthenticatorFromConfig builds the token authenticator chain: static
+// tokens from SCALEODM_AUTH_TOKENS first (no DB round-trip), then hashed
+// tokens in Postgres.
+func newAuthenticatorFromConfig(metadataStore *meta.Store) (auth.Authenticator, error) {
+	var chain auth.Chain
+	static, err := auth.NewStaticAuthenticator(config.SCALEODM_AUTH_TOKENS)
+	if err != nil {
+		return nil, err
+	}
+	if static.Len() > 0 {
+		chain = append(chain, static)
+	}
+	if config.SCALEODM_AUTH_DB_TOKENS_ENABLED && metadataStore != nil {
+		chain = append(chain, auth.NewStoreAuthenticator(metadataStore))
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no token source configured (set SCALEODM_AUTH_TOKENS or SCALEODM_AUTH_DB_TOKENS_ENABLED)")
+	}
+	return chain, nil
+}
+
+// requiresToken reports whether a path serves task data. /info, /options,
+// health probes, docs and UI static assets stay open, as in NodeODM. The UI
+// pages render tasks server-side, so they need a token to scope the listing.
+// Event subscriptions are scoped to the caller's tenant, and /admin/* is
+// further limited to SCALEODM_AUTH_ADMIN_NAMES (see requireAdmin).
+func requiresToken(path string) bool {
+	return strings.HasPrefix(path, "/task/") ||
+		strings.HasPrefix(path, "/events/") ||
+		strings.HasPrefix(path, "/admin/") ||
+		strings.HasPrefix(path, "/imagery/") ||
+		path == "/ui" ||
+		strings.HasPrefix(path, "/ui/tasks/") ||
+		strings.HasPrefix(path, "/ui/api/")
+}
+
+// withTokenAuth enforces authn on task routes. A missing token gets 401 and a
+// rejected one 403, both with NodeODM's {"error": ...} body so pyodm surfaces
+// the message. The accepted Principal is attached to the request context.
+// Open routes accept an optional token so /info can report the caller's
+// quota; an invalid one is ignored there.
+func withTokenAuth(authn auth.Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := auth.TokenFromRequest(r)
+		if !requiresToken(r.URL.Path) {
+			if token != "" {
+				if principal, err := authn.Authenticate(r.Context(), token); err == nil {
+					r = r.WithContext(auth.WithPrincipal(r.Context(), principal))
+				}
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scaleodm"`)
+			writeJSONError(w, http.StatusUnauthorized, "Authentication token required")
+			return
+		}
+
+		principal, err := authn.Authenticate(r.Context(), token)
+		if errors.Is(err, auth.ErrInvalidToken) {
+			log.Printf("auth: rejected token method=%s path=%q remote=%q", r.Method, r.URL.Path, r.RemoteAddr)
+			writeJSONError(w, http.StatusForbidden, "Invalid authentication token")
+			return
+		}
+		if err != nil {
+			log.Printf("auth: token check failed method=%s path=%q: %v", r.Method, r.URL.Path, err)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to verify authentication token")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// getJobForCaller loads a task's metadata and hides tasks owned by another
+// tenant: they come back nil, so handlers answer 404 exactly as for a task
+// that doesn't exist and never confirm another tenant's UUIDs.
+func (a *API) getJobForCaller(ctx context.Context, uuid string) (*meta.JobMetadata, error) {
+	return a.metadataStore.GetJobForTenant(ctx, uuid, auth.TenantFromContext(ctx))
+}
+
+// callerActor names the caller in task timelines: "user:{token name}", or
+// "user" without a token.
+func callerActor(ctx context.Context) string {
+	if principal := auth.PrincipalFromContext(ctx); principal != nil && principal.Name != "" {
+		return "user:" + principal.Name
+	}
+	return "user"
+}
+
+// checkTaskOwner guards mutating routes that act on Argo directly. Unscoped
+// callers (auth disabled) skip the lookup to keep NodeODM semantics for
+// workflows that have no metadata row.
+func (a *API) checkTaskOwner(ctx context.Context, route, uuid string) error {
+	if auth.TenantFromContext(ctx) == "" {
+		return nil
+	}
+	job, err := a.getJobForCaller(ctx, uuid)
+	if err != nil {
+		log.Printf("%s: failed to retrieve task metadata for %q: %v", route, uuid, err)
+		return huma.NewError(500, "Failed to retrieve task metadata", err)
+	}
+	if job == nil {
+		log.Printf("%s: task %q not found for tenant", route, uuid)
+		return huma.NewError(404, "Task not found")
+	}
+	return nil
+}
+
+// requireAdmin fails admin routes for callers whose token name is not in
+// SCALEODM_AUTH_ADMIN_NAMES. With auth disabled everyone is let through.
+func requireAdmin(ctx context.Context) error {
+	if !config.SCALEODM_AUTH_ENABLED {
+		return nil
+	}
+	principal := auth.PrincipalFromContext(ctx)
+	if principal == nil {
+		return huma.NewError(401, "Authentication token required")
+	}
+	for _, name := range strings.Split(config.SCALEODM_AUTH_ADMIN_NAMES, ",") {
+		if strings.TrimSpace(name) == principal.Name {
+			return nil
+		}
+	}
+	return huma.NewError(403, "Admin access required")
+}
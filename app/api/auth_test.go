@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hotosm/scaleodm/app/auth"
+	"github.com/hotosm/scaleodm/app/config"
+	"github.com/hotosm/scaleodm/app/meta"
+	"github.com/hotosm/scaleodm/app/workflows"
+)
+
+func TestWithTokenAuth(t *testing.T) {
+	authn, err := auth.NewStaticAuthenticator("dronetm:s3cret")
+	require.NoError(t, err)
+
+	var seen *auth.Principal
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = auth.PrincipalFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := withTokenAuth(authn, next)
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+	}{
+		{"open route without token", "/info", http.StatusOK},
+		{"task route without token", "/task/list", http.StatusUnauthorized},
+		{"task route with bad token", "/task/list?token=wrong", http.StatusForbidden},
+		{"task route with token", "/task/list?token=s3cret", http.StatusOK},
+		{"ui api without token", "/ui/api/tasks", http.StatusUnauthorized},
+		{"ui api with token", "/ui/api/tasks?token=s3cret", http.StatusOK},
+		{"ui page without token", "/ui", http.StatusUnauthorized},
+		{"ui task page with token", "/ui/tasks/wf-1?token=s3cret", http.StatusOK},
+		{"ui static asset without token", "/ui/static/ui.js", http.StatusOK},
+		{"event subscriptions without token", "/events/subscriptions", http.StatusUnauthorized},
+		{"admin route without token", "/admin/sizing", http.StatusUnauthorized},
+		{"imagery inspection without token", "/imagery/inspect", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status >= http.StatusBadRequest {
+				assert.Contains(t, w.Body.String(), `"error"`)
+			}
+		})
+	}
+
+	seen = nil
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/task/list?token=s3cret", nil))
+	require.NotNil(t, seen)
+	assert.Equal(t, "dronetm", seen.Name)
+	assert.Equal(t, "dronetm", seen.Tenant)
+
+	seen = nil
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/info?token=s3cret", nil))
+	require.NotNil(t, seen, "open routes still resolve an optional token")
+
+	seen = nil
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/info?token=wrong", nil))
+	assert.Nil(t, seen)
+}
+
+func TestTaskListScopedToTenant(t *testing.T) {
+	origEnabled, origTokens, origDB := config.SCALEODM_AUTH_ENABLED, config.SCALEODM_AUTH_TOKENS, config.SCALEODM_AUTH_DB_TOKENS_ENABLED
+	defer func() {
+		config.SCALEODM_AUTH_ENABLED, config.SCALEODM_AUTH_TOKENS, config.SCALEODM_AUTH_DB_TOKENS_ENABLED = origEnabled, origTokens, origDB
+	}()
+	config.SCALEODM_AUTH_ENABLED = true
+	config.SCALEODM_AUTH_TOKENS = "dronetm:s3cret"
+	config.SCALEODM_AUTH_DB_TOKENS_ENABLED = false
+
+	wfClient := &recordingWorkflowClient{}
+	_, handler := NewAPI(nil, wfClient)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/task/list?token=s3cret", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{workflows.TenantLabel + "=dronetm"}, wfClient.listSelectors)
+}
+
+func TestTaskRoutesHideOtherTenantsTasks(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	origEnabled, origTokens, origDB := config.SCALEODM_AUTH_ENABLED, config.SCALEODM_AUTH_TOKENS, config.SCALEODM_AUTH_DB_TOKENS_ENABLED
+	defer func() {
+		config.SCALEODM_AUTH_ENABLED, config.SCALEODM_AUTH_TOKENS, config.SCALEODM_AUTH_DB_TOKENS_ENABLED = origEnabled, origTokens, origDB
+	}()
+	config.SCALEODM_AUTH_ENABLED = true
+	config.SCALEODM_AUTH_TOKENS = "dronetm:token-a,fair:token-b"
+	config.SCALEODM_AUTH_DB_TOKENS_ENABLED = false
+
+	metadataStore := meta.NewStore(db)
+	_, err := metadataStore.CreateJobForTenant(context.Background(), "dronetm", "wf-tenant-a", "project", "s3://bucket/images/", "s3://bucket/output/", nil, "us-east-1", nil)
+	require.NoError(t, err)
+
+	wfClient := &recordingWorkflowClient{}
+	_, handler := NewAPI(metadataStore, wfClient)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/task/wf-tenant-a/info?token=token-b", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/task/cancel?token=token-b", strings.NewReader(`{"uuid":"wf-tenant-a"}`))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, wfClient.deletedNames)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/task/cancel?token=token-a", strings.NewReader(`{"uuid":"wf-tenant-a"}`))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"wf-tenant-a"}, wfClient.deletedNames)
+}
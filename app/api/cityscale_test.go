@@ -0,0 +1,104 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hotosm/scaleodm/app/config"
+)
+
+func postCityScaleTask(t *testing.T, handler http.Handler, req TaskNewRequest) *httptest.ResponseRecorder {
+	t.Helper()
+	req.ProcessingMode = "city-scale"
+	if req.ReadS3Path == "" {
+		req.ReadS3Path = "s3://test-bucket/city/"
+	}
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+
+	httpReq := httptest.NewRequest(http.MethodPost, "/task/new", bytes.NewReader(body))
+	httpReq.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httpReq)
+	return w
+}
+
+func useWorkspace(t *testing.T, mode, accessMode string) {
+	t.Helper()
+	origMode := config.SCALEODM_WORKFLOW_WORKSPACE_MODE
+	origAccessMode := config.SCALEODM_WORKFLOW_WORKSPACE_ACCESS_MODE
+	config.SCALEODM_WORKFLOW_WORKSPACE_MODE = mode
+	config.SCALEODM_WORKFLOW_WORKSPACE_ACCESS_MODE = accessMode
+	t.Cleanup(func() {
+		config.SCALEODM_WORKFLOW_WORKSPACE_MODE = origMode
+		config.SCALEODM_WORKFLOW_WORKSPACE_ACCESS_MODE = origAccessMode
+	})
+}
+
+func TestTaskNew_CityScaleRequiresSharedWorkspace(t *testing.T) {
+	useWorkspace(t, "pvc", "ReadWriteOnce")
+	wfClient := &recordingWorkflowClient{}
+	_, handler := NewAPI(nil, wfClient)
+
+	w := postCityScaleTask(t, handler, TaskNewRequest{})
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "ReadWriteMany")
+	assert.Empty(t, wfClient.createdNames)
+}
+
+func TestTaskNew_CityScaleRejectsInvalidOptions(t *testing.T) {
+	useWorkspace(t, "pvc", "ReadWriteMany")
+	wfClient := &recordingWorkflowClient{}
+	_, handler := NewAPI(nil, wfClient)
+
+	for name, req := range map[string]TaskNewRequest{
+		"split":            {Options: `[{"name":"split","value":400}]`},
+		"dem not s3":       {ReferenceDEMS3Path: "https://example.com/dem.tif"},
+		"dem is prefix":    {ReferenceDEMS3Path: "s3://bucket/dem/"},
+		"dem shell unsafe": {ReferenceDEMS3Path: "s3://bucket/dem$(id).tif"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := postCityScaleTask(t, handler, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		})
+	}
+	assert.Empty(t, wfClient.createdNames)
+}
+
+func TestTaskNew_ReferenceDEMOnlyInCityScale(t *testing.T) {
+	wfClient := &recordingWorkflowClient{}
+	_, handler := NewAPI(nil, wfClient)
+
+	body, err := json.Marshal(TaskNewRequest{
+		ReadS3Path:         "s3://test-bucket/images/",
+		ReferenceDEMS3Path: "s3://test-bucket/dem.tif",
+	})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/task/new", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "city-scale")
+}
+
+func TestCityScaleTaskStats(t *testing.T) {
+	images, largest, err := cityScaleTaskStats(map[string]int{"task-a": 120, "zone__task-b": 340})
+	require.NoError(t, err)
+	assert.Equal(t, 460, images)
+	assert.Equal(t, 340, largest)
+
+	_, _, err = cityScaleTaskStats(map[string]int{"root": 500})
+	assert.ErrorContains(t, err, "at least 2")
+
+	_, _, err = cityScaleTaskStats(map[string]int{"task-a": 1, "task b": 1})
+	assert.ErrorContains(t, err, "task b")
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/hotosm/scaleodm/app/s3"
+)
+
+// zipManifestSaveTimeout bounds recording CRCs after a download ends, which
+// may be because the client went away.
+const zipManifestSaveTimeout = 10 * time.Second
+
+// serveOutputZip streams writeS3Path as all.zip for a task whose upload stage
+// did not write one. The archive is laid out from the listing up front, so the
+// response has a Content-Length and ETag and honours single Range requests
+// (with If-Range) to resume an interrupted download. Entry CRCs learnt while
+// streaming are kept in the zip manifest so a resume need not re-read the
+// objects it skips.
+func (a *API) serveOutputZip(w http.ResponseWriter, r *http.Request, uuid, writeS3Path string, client *minio.Client) {
+	logPrefix := fmt.Sprintf("GET /task/%s/download/all.zip", uuid)
+	archive, err := s3.NewZipArchive(r.Context(), client, writeS3Path)
+	if errors.Is(err, s3.ErrNoObjectsToZip) {
+		log.Printf("%s: no output objects found for synthetic all.zip", logPrefix)
+		http.Error(w, `{"error":"File not found: all.zip"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("%s: failed to list output objects: %v", logPrefix, err)
+		http.Error(w, `{"error":"Failed to stream task output"}`, http.StatusInternalServerError)
+		return
+	}
+
+	start, end := int64(0), archive.Size()
+	status := http.StatusOK
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && ifRangeMatches(r, archive.ETag()) {
+		rangeStart, rangeEnd, ok, rangeErr := s3.ParseByteRange(rangeHeader, archive.Size())
+		if rangeErr != nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", archive.Size()))
+			http.Error(w, `{"error":"Requested range not satisfiable"}`, http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if ok {
+			start, end, status = rangeStart, rangeEnd, http.StatusPartialContent
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, archive.Size()))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="all.zip"`)
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start, 10))
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("ETag", archive.ETag())
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+
+	// The archive can be far larger than SCALEODM_SERVER_WRITE_TIMEOUT_SECONDS
+	// allows for; the client's own connection limits apply instead.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("%s: failed to clear write deadline: %v", logPrefix, err)
+	}
+
+	if a.metadataStore != nil {
+		crcs, manifestErr := a.metadataStore.GetZipManifest(r.Context(), uuid, archive.ETag())
+		if manifestErr != nil {
+			log.Printf("%s: failed to load zip manifest: %v", logPrefix, manifestErr)
+		}
+		archive.SetCRCs(crcs)
+	}
+	known := len(archive.CRCs())
+
+	w.WriteHeader(status)
+	written, streamErr := archive.WriteRange(r.Context(), w, start, end)
+
+	if crcs := archive.CRCs(); a.metadataStore != nil && len(crcs) > known {
+		saveCtx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), zipManifestSaveTimeout)
+		if err := a.metadataStore.PutZipManifest(saveCtx, uuid, archive.ETag(), crcs); err != nil {
+			log.Printf("%s: failed to save zip manifest: %v", logPrefix, err)
+		}
+		cancel()
+	}
+	if streamErr != nil {
+		// Headers are sent; the short body tells the client to resume.
+		log.Printf("%s: stream ended after %d of %d bytes: %v", logPrefix, written, end-start, streamErr)
+		return
+	}
+	log.Printf("%s: streamed synthetic all.zip bytes %d-%d of %d with %d entries", logPrefix, start, end-1, archive.Size(), archive.Entries())
+}
+
+// ifRangeMatches reports whether a Range request applies: either it has no
+// If-Range, or If-Range names the archive's current ETag.
+func ifRangeMatches(r *http.Request, etag string) bool {
+	ifRange := r.Header.Get("If-Range")
+	return ifRange == "" || ifRange == etag
+}
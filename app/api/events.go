@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"github.com/hotosm/scaleodm/app/auth"
+	"github.com/hotosm/scaleodm/app/config"
+	"github.com/hotosm/scaleodm/app/events"
+	"github.com/hotosm/scaleodm/app/meta"
+)
+
+// EventSubscriptionRequest registers interest in task events.
+type EventSubscriptionRequest struct {
+	Target  string `json:"target" doc:"Where events are published: an http(s) URL, a NATS subject or a Postgres channel, depending on the server's event sink"`
+	Project string `json:"project,omitempty" doc:"Only tasks with this name (the NodeODM name, i.e. project id)"`
+	Tenant  string `json:"tenant,omitempty" doc:"Only this tenant's tasks. Tenant-scoped tokens always subscribe to their own tenant; without a tenant an unscoped caller gets every tenant's"`
+}
+
+// EventSubscription is a stored subscription.
+type EventSubscription struct {
+	ID        int64  `json:"id"`
+	Target    string `json:"target"`
+	Project   string `json:"project,omitempty"`
+	Tenant    string `json:"tenant,omitempty"`
+	CreatedAt int64  `json:"createdAt" doc:"Unix seconds"`
+}
+
+func toEventSubscription(sub meta.EventSubscription) EventSubscription {
+	return EventSubscription{
+		ID:        sub.ID,
+		Target:    sub.Target,
+		Project:   sub.ProjectID,
+		Tenant:    sub.Tenant,
+		CreatedAt: sub.CreatedAt.Unix(),
+	}
+}
+
+// requireEventSink fails the subscription endpoints while no sink is
+// configured, since a subscription would never receive anything.
+func requireEventSink() error {
+	if config.SCALEODM_EVENTS_SINK == "" {
+		return huma.NewError(501, "Task events are disabled (SCALEODM_EVENTS_SINK is not set)")
+	}
+	return nil
+}
+
+func (a *API) registerEventRoutes() {
+	huma.Register(a.api, huma.Operation{
+		OperationID:   "events-subscriptions-post",
+		Method:        http.MethodPost,
+		Path:          "/events/subscriptions",
+		Summary:       "Subscribes to task events",
+		Description:   "Publishes a CloudEvent to target whenever a matching task changes status.",
+		Tags:          []string{"events"},
+		DefaultStatus: http.StatusCreated,
+	}, func(ctx context.Context, input *struct {
+		Token string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
+		Body  EventSubscriptionRequest
+	}) (*struct{ Body EventSubscription }, error) {
+		if err := requireEventSink(); err != nil {
+			return nil, err
+		}
+		target := strings.TrimSpace(input.Body.Target)
+		if err := events.ValidateTarget(config.SCALEODM_EVENTS_SINK, target); err != nil {
+			return nil, huma.NewError(400, err.Error())
+		}
+		tenant := strings.TrimSpace(input.Body.Tenant)
+		if callerTenant := auth.TenantFromContext(ctx); callerTenant != "" {
+			if tenant != "" && tenant != callerTenant {
+				return nil, huma.NewError(403, "Cannot subscribe to another tenant's events")
+			}
+			tenant = callerTenant
+		}
+		project := strings.TrimSpace(input.Body.Project)
+
+		sub, err := a.metadataStore.CreateEventSubscription(ctx, tenant, project, target)
+		if err != nil {
+			log.Printf("POST /events/subscriptions: failed to create subscription: %v", err)
+			return nil, huma.NewError(500, "Failed to create subscription", err)
+		}
+		log.Printf("POST /events/subscriptions: id=%d tenant=%q project=%q target=%q", sub.ID, tenant, project, target)
+		return &struct{ Body EventSubscription }{Body: toEventSubscription(*sub)}, nil
+	})
+
+	huma.Register(a.api, huma.Operation{
+		OperationID: "events-subscriptions-get",
+		Method:      http.MethodGet,
+		Path:        "/events/subscriptions",
+		Summary:     "Lists task event subscriptions",
+		Description: "Lists the caller's tenant's subscriptions, or every subscription for an unscoped caller.",
+		Tags:        []string{"events"},
+	}, func(ctx context.Context, input *struct {
+		Token string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
+	}) (*struct{ Body []EventSubscription }, error) {
+		if err := requireEventSink(); err != nil {
+			return nil, err
+		}
+		subs, err := a.metadataStore.ListEventSubscriptions(ctx, auth.TenantFromContext(ctx))
+		if err != nil {
+			log.Printf("GET /events/subscriptions: failed to list subscriptions: %v", err)
+			return nil, huma.NewError(500, "Failed to list subscriptions", err)
+		}
+		resp := &struct{ Body []EventSubscription }{Body: make([]EventSubscription, 0, len(subs))}
+		for _, sub := range subs {
+			resp.Body = append(resp.Body, toEventSubscription(sub))
+		}
+		return resp, nil
+	})
+
+	huma.Register(a.api, huma.Operation{
+		OperationID:   "events-subscriptions-delete",
+		Method:        http.MethodDelete,
+		Path:          "/events/subscriptions/{id}",
+		Summary:       "Removes a task event subscription",
+		Tags:          []string{"events"},
+		DefaultStatus: http.StatusNoContent,
+	}, func(ctx context.Context, input *struct {
+		ID    int64  `path:"id" doc:"Subscription id"`
+		Token string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
+	}) (*struct{}, error) {
+		if err := requireEventSink(); err != nil {
+			return nil, err
+		}
+		deleted, err := a.metadataStore.DeleteEventSubscription(ctx, input.ID, auth.TenantFromContext(ctx))
+		if err != nil {
+			log.Printf("DELETE /events/subscriptions/%d: failed to delete subscription: %v", input.ID, err)
+			return nil, huma.NewError(500, "Failed to delete subscription", err)
+		}
+		if !deleted {
+			return nil, huma.NewError(404, "Subscription not found")
+		}
+		log.Printf("DELETE /events/subscriptions/%d: removed", input.ID)
+		return &struct{}{}, nil
+	})
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hotosm/scaleodm/app/config"
+	"github.com/hotosm/scaleodm/app/meta"
+)
+
+func setEventsConfig(t *testing.T, sink string) {
+	t.Helper()
+	origSink := config.SCALEODM_EVENTS_SINK
+	origEnabled, origTokens, origDB := config.SCALEODM_AUTH_ENABLED, config.SCALEODM_AUTH_TOKENS, config.SCALEODM_AUTH_DB_TOKENS_ENABLED
+	t.Cleanup(func() {
+		config.SCALEODM_EVENTS_SINK = origSink
+		config.SCALEODM_AUTH_ENABLED, config.SCALEODM_AUTH_TOKENS, config.SCALEODM_AUTH_DB_TOKENS_ENABLED = origEnabled, origTokens, origDB
+	})
+	config.SCALEODM_EVENTS_SINK = sink
+	config.SCALEODM_AUTH_ENABLED = true
+	config.SCALEODM_AUTH_TOKENS = "dronetm:token-a,fair:token-b"
+	config.SCALEODM_AUTH_DB_TOKENS_ENABLED = false
+}
+
+func postSubscription(handler http.Handler, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/events/subscriptions?token="+token, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestEventSubscriptions_DisabledWithoutSink(t *testing.T) {
+	setEventsConfig(t, "")
+	_, handler := NewAPI(nil, &recordingWorkflowClient{})
+
+	w := postSubscription(handler, "token-a", `{"target": "https://example.com/events"}`)
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
+
+func TestEventSubscriptions_ValidatesRequest(t *testing.T) {
+	setEventsConfig(t, "nats")
+	_, handler := NewAPI(nil, &recordingWorkflowClient{})
+
+	w := postSubscription(handler, "token-a", `{"target": "dronetm.>"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "NATS subject")
+
+	w = postSubscription(handler, "token-a", `{"target": "dronetm.tasks", "tenant": "fair"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestEventSubscriptions_ScopedToTenant(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+	setEventsConfig(t, "http")
+
+	metadataStore := meta.NewStore(db)
+	_, handler := NewAPI(metadataStore, &recordingWorkflowClient{})
+
+	w := postSubscription(handler, "token-a", `{"target": "https://dronetm.example/events", "project": "project-1"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created EventSubscription
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "dronetm", created.Tenant)
+	assert.Equal(t, "project-1", created.Project)
+
+	targets, err := metadataStore.EventTargets(context.Background(), "dronetm", "project-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://dronetm.example/events"}, targets)
+	targets, err = metadataStore.EventTargets(context.Background(), "fair", "project-1")
+	require.NoError(t, err)
+	assert.Empty(t, targets)
+
+	// Another tenant neither lists nor removes it.
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events/subscriptions?token=token-b", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+
+	deletePath := fmt.Sprintf("/events/subscriptions/%d", created.ID)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, deletePath+"?token=token-b", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, deletePath+"?token=token-a", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
@@ -29,26 +29,15 @@ func TestWorkflowToStatusCode(t *testing.T) {
 	}
 }
 
-func TestWorkflowToProgress(t *testing.T) {
-	tests := []struct {
-		name     string
-		phase    wfv1.WorkflowPhase
-		expected int
-	}{
-		{"Pending", wfv1.WorkflowPending, 0},
-		{"Running", wfv1.WorkflowRunning, 50},
-		{"Succeeded", wfv1.WorkflowSucceeded, 100},
-		{"Failed", wfv1.WorkflowFailed, 0},
-		{"Error", wfv1.WorkflowError, 0},
-		{"Unknown", wfv1.WorkflowPhase("Unknown"), 0},
-	}
+func TestMetadataProgress(t *testing.T) {
+	progress, stage, ok := metadataProgress([]byte(`{"progress": 42, "stage": "openmvs", "odm_stage": "openmvs"}`))
+	assert.True(t, ok)
+	assert.Equal(t, 42, progress)
+	assert.Equal(t, "openmvs", stage)
+	assert.Equal(t, "openmvs", metadataODMStage([]byte(`{"odm_stage": "openmvs"}`)))
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := workflowToProgress(tt.phase)
-			assert.Equal(t, tt.expected, result)
-		})
-	}
+	_, _, ok = metadataProgress([]byte(`{}`))
+	assert.False(t, ok)
 }
 
 func TestClampTaskAdditionalLimit(t *testing.T) {
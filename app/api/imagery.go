@@ -0,0 +1,232 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/hotosm/scaleodm/app/config"
+	"github.com/hotosm/scaleodm/app/imagery"
+	"github.com/hotosm/scaleodm/app/s3"
+	"github.com/hotosm/scaleodm/app/workflows"
+)
+
+// metadataImageryInspectionKey holds the ImageryReport of a task's imagery.
+const metadataImageryInspectionKey = "imagery_inspection"
+
+// maxReportedImages caps the image keys listed per issue, so a report on a
+// dataset of thousands stays small enough to store with the task.
+const maxReportedImages = 20
+
+// Imagery inspection modes (SCALEODM_IMAGERY_INSPECTION).
+const (
+	imageryInspectionOff    = "off"
+	imageryInspectionReject = "reject"
+)
+
+// ImageryInspectRequest selects the imagery to inspect the way POST
+// /task/new does.
+type ImageryInspectRequest struct {
+	ReadS3Path         string   `json:"readS3Path" doc:"S3 prefix holding the imagery (s3://bucket/prefix/)"`
+	S3Endpoint         string   `json:"s3Endpoint,omitempty" doc:"Custom S3 endpoint, as for POST /task/new"`
+	ExcludePaths       []string `json:"excludePaths,omitempty" doc:"rclone filter patterns of objects to skip"`
+	UseDefaultExcludes *bool    `json:"useDefaultExcludes,omitempty" doc:"Also skip ODM outputs and other non-imagery prefixes (default true)"`
+}
+
+// ImageryCamera is a camera model and the images it took.
+type ImageryCamera struct {
+	Make   string `json:"make,omitempty"`
+	Model  string `json:"model,omitempty"`
+	Images int    `json:"images"`
+}
+
+// ImageryBounds is the bounding box of the images' GPS positions.
+type ImageryBounds struct {
+	MinLatitude  float64 `json:"minLatitude"`
+	MinLongitude float64 `json:"minLongitude"`
+	MaxLatitude  float64 `json:"maxLatitude"`
+	MaxLongitude float64 `json:"maxLongitude"`
+}
+
+// ImageryIssue is a problem inspection found.
+type ImageryIssue struct {
+	Code       string   `json:"code" doc:"no_images, unreadable, truncated, missing_gps, mixed_cameras or duplicates"`
+	Severity   string   `json:"severity" doc:"error or warning; errors reject a task when SCALEODM_IMAGERY_INSPECTION is reject"`
+	Message    string   `json:"message"`
+	ImageCount int      `json:"imageCount,omitempty" doc:"Images the issue concerns"`
+	Images     []string `json:"images,omitempty" doc:"Keys of the first 20 images the issue concerns"`
+}
+
+// ImageryReport summarizes a dataset's image headers.
+type ImageryReport struct {
+	Verdict      string          `json:"verdict" doc:"ok, warn (warnings only) or fail (has errors)"`
+	InspectedAt  string          `json:"inspectedAt" doc:"RFC 3339 timestamp"`
+	Images       int             `json:"images"`
+	TotalBytes   int64           `json:"totalBytes"`
+	Cameras      []ImageryCamera `json:"cameras" doc:"Camera models, most images first"`
+	WithGPS      int             `json:"withGps" doc:"Images with a GPS position"`
+	Bounds       *ImageryBounds  `json:"bounds,omitempty"`
+	MinAltitude  *float64        `json:"minAltitude,omitempty" doc:"Lowest GPS altitude in metres"`
+	MaxAltitude  *float64        `json:"maxAltitude,omitempty" doc:"Highest GPS altitude in metres"`
+	FirstCapture string          `json:"firstCapture,omitempty" doc:"Earliest capture time, RFC 3339 in the camera's clock"`
+	LastCapture  string          `json:"lastCapture,omitempty" doc:"Latest capture time, RFC 3339 in the camera's clock"`
+	Issues       []ImageryIssue  `json:"issues"`
+}
+
+func toImageryReport(r *imagery.Report, inspectedAt time.Time) ImageryReport {
+	resp := ImageryReport{
+		Verdict:     "ok",
+		InspectedAt: inspectedAt.UTC().Format(time.RFC3339),
+		Images:      r.Images,
+		TotalBytes:  r.TotalBytes,
+		Cameras:     make([]ImageryCamera, 0, len(r.Cameras)),
+		WithGPS:     r.WithGPS,
+		MinAltitude: r.MinAltitude,
+		MaxAltitude: r.MaxAltitude,
+		Issues:      make([]ImageryIssue, 0, len(r.Issues)),
+	}
+	for _, c := range r.Cameras {
+		resp.Cameras = append(resp.Cameras, ImageryCamera{Make: c.Make, Model: c.Model, Images: c.Images})
+	}
+	if b := r.Bounds; b != nil {
+		resp.Bounds = &ImageryBounds{MinLatitude: b.MinLatitude, MinLongitude: b.MinLongitude, MaxLatitude: b.MaxLatitude, MaxLongitude: b.MaxLongitude}
+	}
+	if r.FirstCapture != nil {
+		resp.FirstCapture = r.FirstCapture.Format(time.RFC3339)
+		resp.LastCapture = r.LastCapture.Format(time.RFC3339)
+	}
+	for _, issue := range r.Issues {
+		resp.Issues = append(resp.Issues, ImageryIssue{
+			Code:       issue.Code,
+			Severity:   issue.Severity,
+			Message:    issue.Message,
+			ImageCount: len(issue.Images),
+			Images:     issue.Images[:min(len(issue.Images), maxReportedImages)],
+		})
+		switch {
+		case issue.Severity == imagery.SeverityError:
+			resp.Verdict = "fail"
+		case resp.Verdict == "ok":
+			resp.Verdict = "warn"
+		}
+	}
+	return resp
+}
+
+// inspectImagery runs imagery.Inspect with the configured concurrency and
+// thresholds.
+func inspectImagery(ctx context.Context, client *minio.Client, readPath string, excludePatterns []string) (*imagery.Report, error) {
+	return imagery.Inspect(ctx, client, readPath, excludePatterns, imagery.Options{
+		Concurrency: config.SCALEODM_IMAGERY_INSPECTION_CONCURRENCY,
+		Thresholds:  imagery.Thresholds{MaxMissingGPSPercent: config.SCALEODM_IMAGERY_MAX_MISSING_GPS_PERCENT},
+	})
+}
+
+// imageryRejection is the message of a task refused for its imagery's errors.
+func imageryRejection(report *imagery.Report) string {
+	var messages []string
+	for _, issue := range report.Issues {
+		if issue.Severity == imagery.SeverityError {
+			messages = append(messages, issue.Message)
+		}
+	}
+	return fmt.Sprintf("imagery failed inspection: %s (see POST /imagery/inspect for the full report)", strings.Join(messages, "; "))
+}
+
+func (a *API) registerImageryRoutes() {
+	// POST /imagery/inspect - Reads the headers of the imagery under a prefix
+	huma.Register(a.api, huma.Operation{
+		OperationID: "imagery-inspect-post",
+		Method:      http.MethodPost,
+		Path:        "/imagery/inspect",
+		Summary:     "Inspects imagery before a task is created",
+		Description: "Reads the EXIF and XMP headers of the JPEG and TIFF images under readS3Path with ranged GETs and reports the cameras, GPS coverage, altitude range and capture span, and issues ODM would trip over: unreadable or truncated images, images without a GPS position, mixed camera models and duplicates. Nothing is downloaded in full or recorded.",
+		Tags:        []string{"imagery"},
+	}, func(ctx context.Context, input *struct {
+		Token string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
+		Body  ImageryInspectRequest
+	}) (*struct{ Body ImageryReport }, error) {
+		req := input.Body
+		if !strings.HasPrefix(req.ReadS3Path, "s3://") {
+			return nil, huma.NewError(400, "readS3Path must be an s3:// path")
+		}
+		readPath := strings.TrimSuffix(req.ReadS3Path, "/") + "/"
+		for _, p := range req.ExcludePaths {
+			if err := workflows.ValidateExcludePattern(p); err != nil {
+				return nil, huma.NewError(400, fmt.Sprintf("invalid exclude pattern %q: %s", p, err.Error()))
+			}
+		}
+		useDefaultExcludes := true
+		if req.UseDefaultExcludes != nil {
+			useDefaultExcludes = *req.UseDefaultExcludes
+		}
+		s3Endpoint, err := normalizeOptionalS3Endpoint(req.S3Endpoint)
+		if err == nil {
+			err = enforceEndpointAllowlist(s3Endpoint)
+		}
+		if err != nil {
+			return nil, huma.NewError(400, "Invalid s3Endpoint", err)
+		}
+
+		client, err := s3.GetS3ClientForEndpoint(cmp.Or(s3Endpoint, config.AWS_S3_ENDPOINT))
+		if err != nil {
+			log.Printf("POST /imagery/inspect: failed to construct S3 client endpoint=%q: %v", s3Endpoint, err)
+			return nil, huma.NewError(500, "Failed to initialize S3 client", err)
+		}
+		report, err := inspectImagery(ctx, client, readPath, workflows.ComposeExcludePatterns(useDefaultExcludes, req.ExcludePaths))
+		if err != nil {
+			log.Printf("POST /imagery/inspect: failed to inspect readPath=%q endpoint=%q: %v", readPath, s3Endpoint, err)
+			return nil, huma.NewError(400, "Unable to read imagery from readS3Path", err)
+		}
+		resp := toImageryReport(report, time.Now())
+		log.Printf("POST /imagery/inspect: readPath=%q images=%d verdict=%s", readPath, resp.Images, resp.Verdict)
+		return &struct{ Body ImageryReport }{Body: resp}, nil
+	})
+
+	// GET /task/{uuid}/imagery - The inspection report stored with a task
+	huma.Register(a.api, huma.Operation{
+		OperationID: "task-uuid-imagery-get",
+		Method:      http.MethodGet,
+		Path:        "/task/{uuid}/imagery",
+		Summary:     "Gets the inspection report of a task's imagery",
+		Description: "Returns the report of the imagery inspection run when the task was created. Tasks created with SCALEODM_IMAGERY_INSPECTION off, and merge-existing and city-scale tasks, have none.",
+		Tags:        []string{"task"},
+	}, func(ctx context.Context, input *struct {
+		UUID  string `path:"uuid" doc:"UUID of the task"`
+		Token string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
+	}) (*struct{ Body ImageryReport }, error) {
+		job, err := a.getJobForCaller(ctx, input.UUID)
+		if err != nil {
+			log.Printf("GET /task/%s/imagery: failed to retrieve task metadata: %v", input.UUID, err)
+			return nil, huma.NewError(500, "Failed to retrieve task metadata", err)
+		}
+		if job == nil {
+			return nil, huma.NewError(404, "Task not found")
+		}
+
+		var metadata map[string]json.RawMessage
+		if len(job.Metadata) > 0 {
+			if err := json.Unmarshal(job.Metadata, &metadata); err != nil {
+				log.Printf("GET /task/%s/imagery: failed to decode task metadata: %v", input.UUID, err)
+			}
+		}
+		raw, ok := metadata[metadataImageryInspectionKey]
+		if !ok || string(raw) == "null" {
+			return nil, huma.NewError(404, "Task has no imagery inspection report")
+		}
+		resp := &struct{ Body ImageryReport }{}
+		if err := json.Unmarshal(raw, &resp.Body); err != nil {
+			log.Printf("GET /task/%s/imagery: failed to decode imagery report: %v", input.UUID, err)
+			return nil, huma.NewError(500, "Failed to decode imagery report", err)
+		}
+		return resp, nil
+	})
+}
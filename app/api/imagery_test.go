@@ -0,0 +1,124 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hotosm/scaleodm/app/config"
+	"github.com/hotosm/scaleodm/app/imagery"
+	"github.com/hotosm/scaleodm/testutil"
+)
+
+func TestToImageryReport(t *testing.T) {
+	var missing []string
+	for i := range 30 {
+		missing = append(missing, fmt.Sprintf("img-%02d.jpg", i))
+	}
+	captured := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	report := &imagery.Report{
+		Images:       40,
+		Cameras:      []imagery.Camera{{Make: "DJI", Model: "FC6310", Images: 40}},
+		WithGPS:      10,
+		FirstCapture: &captured,
+		LastCapture:  &captured,
+		Issues:       []imagery.Issue{{Code: imagery.IssueMissingGPS, Severity: imagery.SeverityWarning, Message: "30 of 40 images have no GPS position", Images: missing}},
+	}
+
+	resp := toImageryReport(report, captured)
+	assert.Equal(t, "warn", resp.Verdict)
+	assert.Equal(t, "2026-05-01T09:00:00Z", resp.FirstCapture)
+	assert.Nil(t, resp.Bounds)
+	require.Len(t, resp.Issues, 1)
+	assert.Equal(t, 30, resp.Issues[0].ImageCount)
+	assert.Len(t, resp.Issues[0].Images, maxReportedImages)
+
+	report.Issues = append(report.Issues, imagery.Issue{Code: imagery.IssueTruncated, Severity: imagery.SeverityError, Images: missing[:1]})
+	assert.Equal(t, "fail", toImageryReport(report, captured).Verdict)
+	assert.Equal(t, "ok", toImageryReport(&imagery.Report{}, captured).Verdict)
+}
+
+func TestImageryInspect_RejectsInvalidRequests(t *testing.T) {
+	origEnforce, origAllowed := config.SCALEODM_ENFORCE_S3_ENDPOINT_ALLOWLIST, config.SCALEODM_ALLOWED_S3_ENDPOINTS
+	defer func() {
+		config.SCALEODM_ENFORCE_S3_ENDPOINT_ALLOWLIST, config.SCALEODM_ALLOWED_S3_ENDPOINTS = origEnforce, origAllowed
+	}()
+	config.SCALEODM_ENFORCE_S3_ENDPOINT_ALLOWLIST = true
+	config.SCALEODM_ALLOWED_S3_ENDPOINTS = "https://s3.example.com"
+	_, handler := NewAPI(nil, &recordingWorkflowClient{})
+
+	for name, tc := range map[string]struct {
+		req  ImageryInspectRequest
+		want string
+	}{
+		"no read path":  {ImageryInspectRequest{}, "readS3Path must be an s3:// path"},
+		"bad exclude":   {ImageryInspectRequest{ReadS3Path: "s3://test-bucket/images/", ExcludePaths: []string{"../secrets"}}, "invalid exclude pattern"},
+		"not allowed":   {ImageryInspectRequest{ReadS3Path: "s3://test-bucket/images/", S3Endpoint: "https://s3.attacker.test"}, "Invalid s3Endpoint"},
+		"http zip path": {ImageryInspectRequest{ReadS3Path: "https://example.com/images.zip"}, "readS3Path must be an s3:// path"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			body, err := json.Marshal(tc.req)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/imagery/inspect", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tc.want)
+		})
+	}
+}
+
+func TestTaskPlan_RejectsUnreadableImagery(t *testing.T) {
+	ctx := context.Background()
+	require.NoError(t, testutil.SetupTestS3Bucket(ctx, "test-bucket"))
+	ensureTestImageInBucket(ctx, t, "test-bucket", "imagery-reject/input.jpg")
+
+	orig := config.SCALEODM_IMAGERY_INSPECTION
+	defer func() { config.SCALEODM_IMAGERY_INSPECTION = orig }()
+	wfClient := &recordingWorkflowClient{}
+	_, handler := NewAPI(nil, wfClient)
+
+	body, err := json.Marshal(TaskNewRequest{
+		ReadS3Path:  "s3://test-bucket/imagery-reject/",
+		WriteS3Path: "s3://test-bucket/imagery-reject-output/",
+		S3Region:    "us-east-1",
+		S3Endpoint:  "http://" + testutil.TestS3Endpoint(),
+	})
+	require.NoError(t, err)
+	plan := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/task/plan", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// The test image is not a real JPEG.
+	config.SCALEODM_IMAGERY_INSPECTION = "reject"
+	w := plan()
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "imagery failed inspection")
+	assert.Empty(t, wfClient.renderedConfigs)
+
+	config.SCALEODM_IMAGERY_INSPECTION = "warn"
+	w = plan()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp TaskPlan
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.NotNil(t, resp.Imagery)
+	assert.Equal(t, "fail", resp.Imagery.Verdict)
+	assert.Equal(t, 1, resp.Imagery.Images)
+	require.NotEmpty(t, resp.Imagery.Issues)
+	assert.Equal(t, imagery.IssueUnreadable, resp.Imagery.Issues[0].Code)
+}
@@ -4,6 +4,7 @@ package api
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -20,6 +21,7 @@ import (
 	"github.com/hotosm/scaleodm/app/config"
 	"github.com/hotosm/scaleodm/app/meta"
 	"github.com/hotosm/scaleodm/app/observability"
+	"github.com/hotosm/scaleodm/app/odmoptions"
 	"github.com/hotosm/scaleodm/app/s3"
 	"github.com/hotosm/scaleodm/app/ui"
 	"github.com/hotosm/scaleodm/app/version"
@@ -31,6 +33,7 @@ type API struct {
 	api             huma.API
 	workflowClient  workflows.WorkflowClient
 	metadataStore   *meta.Store
+	odmOptions      *odmoptions.Registry
 	downloadHandler http.Handler // raw handler for download redirect
 }
 
@@ -63,6 +66,9 @@ func NewAPI(metadataStore *meta.Store, workflowClient workflows.WorkflowClient)
 		{"tokenAuth": {}},
 		{}, // token is optional for compatibility with existing NodeODM behavior
 	}
+	if config.SCALEODM_AUTH_ENABLED {
+		apiConfig.Security = []map[string][]string{{"tokenAuth": {}}}
+	}
 	if apiConfig.Components.Responses == nil {
 		apiConfig.Components.Responses = map[string]*huma.Response{}
 	}
@@ -91,14 +97,29 @@ func NewAPI(metadataStore *meta.Store, workflowClient workflows.WorkflowClient)
 
 	router := http.NewServeMux()
 	humaAPI := humago.New(router, apiConfig)
+	// ODM option catalogs are read out of the images by the workflow client,
+	// when it can run pods, and kept in the metadata store.
+	var optionStore odmoptions.Store
+	if metadataStore != nil {
+		optionStore = metadataStore
+	}
+	optionExtractor, _ := workflowClient.(odmoptions.Extractor)
+	optionTimeout := time.Duration(config.SCALEODM_ODM_OPTIONS_TIMEOUT_SECONDS) * time.Second
 	apiObj := &API{
 		metadataStore:  metadataStore,
 		workflowClient: workflowClient,
+		odmOptions:     odmoptions.NewRegistry(optionStore, optionExtractor, optionTimeout),
 		api:            humaAPI,
 	}
 
 	apiObj.registerGlobalMRoutes()
 	apiObj.registerNodeODMRoutes()
+	apiObj.registerTaskPlanRoutes()
+	apiObj.registerImageryRoutes()
+	apiObj.registerTaskEventRoutes()
+	apiObj.registerTaskUsageRoutes()
+	apiObj.registerEventRoutes()
+	apiObj.registerAdminRoutes()
 	// apiObj.registerScaleODMRoutes()
 
 	// Register the download handler as a raw HTTP route (outside Huma)
@@ -111,6 +132,17 @@ func NewAPI(metadataStore *meta.Store, workflowClient workflows.WorkflowClient)
 		router.Handle("GET /ui/api/tasks/{uuid}/download/{asset}", apiObj.downloadHandler)
 	}
 
+	// Live console output as Server-Sent Events, mirrored under /ui like the
+	// download. Raw so each line is flushed as it arrives.
+	router.HandleFunc("GET /task/{uuid}/output/stream", apiObj.handleTaskOutputStream)
+	router.HandleFunc("GET /ui/api/tasks/{uuid}/output/stream", apiObj.handleTaskOutputStream)
+
+	// NodeODM chunked upload. Raw handlers because the upload step streams a
+	// multipart body part by part, which Huma would buffer in full.
+	router.HandleFunc("POST /task/new/init", apiObj.handleTaskNewInit)
+	router.HandleFunc("POST /task/new/upload/{uuid}", apiObj.handleTaskNewUpload)
+	router.HandleFunc("POST /task/new/commit/{uuid}", apiObj.handleTaskNewCommit)
+
 	if config.SCALEODM_UI_ENABLED {
 		uiHandler, err := ui.NewHandler(metadataStore, workflowClient, config.SCALEODM_UI_READONLY, version.Version)
 		if err != nil {
@@ -120,11 +152,22 @@ func NewAPI(metadataStore *meta.Store, workflowClient workflows.WorkflowClient)
 		}
 	}
 
+	// Auth wraps the router for the same reason: Huma routes can't be wrapped
+	// individually, so withTokenAuth matches on path prefix instead.
+	var handler http.Handler = router
+	if config.SCALEODM_AUTH_ENABLED {
+		authenticator, err := newAuthenticatorFromConfig(metadataStore)
+		if err != nil {
+			log.Fatalf("invalid auth configuration: %v", err)
+		}
+		handler = withTokenAuth(authenticator, handler)
+	}
+
 	// withTaskNewErrorLogging wraps the whole router rather than a specific handler
 	// because POST /task/new is registered via Huma, which doesn't expose the
 	// underlying http.Handler for per-route wrapping. The middleware short-circuits
 	// immediately for all other routes, so the overhead is a single conditional.
-	return apiObj, withTaskNewErrorLogging(router)
+	return apiObj, withTaskNewErrorLogging(handler)
 }
 
 func has4xxResponse(responses map[string]*huma.Response) bool {
@@ -140,6 +183,20 @@ func has4xxResponse(responses map[string]*huma.Response) bool {
 	return false
 }
 
+// writeJSONError writes the NodeODM-style {"error": ...} body from raw
+// (non-Huma) handlers and middleware.
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		log.Printf("failed to encode response: %v", err)
+	}
+}
+
 func (a *API) registerGlobalMRoutes() {
 	lightweightHandler := func(ctx context.Context, input *struct{}) (*HealthResponse, error) {
 		resp := &HealthResponse{}
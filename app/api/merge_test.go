@@ -0,0 +1,33 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskNew_MergeExistingRejectsOptions(t *testing.T) {
+	wfClient := &recordingWorkflowClient{}
+	_, handler := NewAPI(nil, wfClient)
+
+	body, err := json.Marshal(TaskNewRequest{
+		ReadS3Path:     "s3://test-bucket/project/",
+		ProcessingMode: "merge-existing",
+		Options:        `[{"name":"dsm","value":true}]`,
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/task/new", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "merge-existing")
+	assert.Empty(t, wfClient.createdNames, "nothing should reach Argo")
+}
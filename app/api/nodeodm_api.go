@@ -1,9 +1,10 @@
 package api
 
 import (
-	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -19,9 +20,11 @@ import (
 	"go.opentelemetry.io/otel/trace"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 
+	"github.com/hotosm/scaleodm/app/auth"
 	"github.com/hotosm/scaleodm/app/config"
 	"github.com/hotosm/scaleodm/app/meta"
 	"github.com/hotosm/scaleodm/app/observability"
+	"github.com/hotosm/scaleodm/app/reconciler"
 	"github.com/hotosm/scaleodm/app/s3"
 	"github.com/hotosm/scaleodm/app/version"
 	"github.com/hotosm/scaleodm/app/workflows"
@@ -58,6 +61,17 @@ const (
 	metadataCapacityTypeKey          = "capacity_type"
 	metadataBoundaryGeoJSONKey       = "boundary_geojson"
 	metadataBoundaryS3PathKey        = "boundary_s3_path"
+	metadataMergeInputCountKey       = "merge_input_count"
+	metadataCityScaleTaskCountKey    = "city_scale_task_count"
+	metadataLargestTaskImagesKey     = "largest_task_image_count"
+	metadataReferenceDEMS3PathKey    = "reference_dem_s3_path"
+	metadataSidecarFilesKey          = "sidecar_files"
+	metadataGCPS3PathKey             = "gcp_s3_path"
+	metadataGeoS3PathKey             = "geo_s3_path"
+	metadataODMImageKey              = "odm_image"
+	metadataSkipPostProcessingKey    = "skip_post_processing"
+	metadataKeepIntermediatesKey     = "keep_intermediates"
+	metadataRerunFromKey             = "rerun_from"
 )
 
 const (
@@ -65,6 +79,130 @@ const (
 	taskAssetsMaxAdditionalLimit     = 1000
 )
 
+// minMergeInputs is the fewest task outputs a merge-existing task accepts.
+const minMergeInputs = 2
+
+// validateMergeOptions rejects ODM options for merge-existing tasks: the merge
+// stage never runs ODM, so they would be silently ignored.
+func validateMergeOptions(processingMode string, odmFlags []string, boundary workflows.BoundarySource) error {
+	if processingMode != workflows.ProcessingModeMergeExisting {
+		return nil
+	}
+	if len(odmFlags) > 0 || boundary.IsSet() {
+		return fmt.Errorf("options are not supported in merge-existing mode")
+	}
+	return nil
+}
+
+// validateCityScaleOptions checks the options that only city-scale tasks
+// take, and those city-scale cannot use.
+func validateCityScaleOptions(processingMode string, split int, referenceDEMS3Path string) error {
+	if processingMode != workflows.ProcessingModeCityScale {
+		if referenceDEMS3Path != "" {
+			return fmt.Errorf("referenceDemS3Path is only supported in city-scale mode")
+		}
+		return nil
+	}
+	if split > 0 {
+		return fmt.Errorf("split is not supported in city-scale mode: each task directory is processed as one model")
+	}
+	if referenceDEMS3Path != "" {
+		if !strings.HasPrefix(referenceDEMS3Path, "s3://") || strings.HasSuffix(referenceDEMS3Path, "/") {
+			return fmt.Errorf("referenceDemS3Path must be an s3:// path to a GeoTIFF")
+		}
+		if err := validateShellSafe(referenceDEMS3Path, "referenceDemS3Path"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cityScaleTaskStats validates the tasks found under a city-scale readS3Path
+// and returns their total and largest image counts.
+func cityScaleTaskStats(tasks map[string]int) (imageCount, largest int, err error) {
+	if len(tasks) < workflows.MinCityScaleTasks {
+		return 0, 0, fmt.Errorf("city-scale needs imagery in at least %d task directories under readS3Path (found %d)", workflows.MinCityScaleTasks, len(tasks))
+	}
+	for name, count := range tasks {
+		if err := validateShellSafe(name, "task directory"); err != nil {
+			return 0, 0, fmt.Errorf("%w (%q)", err, name)
+		}
+		imageCount += count
+		largest = max(largest, count)
+	}
+	return imageCount, largest, nil
+}
+
+// validateSidecarOptions checks gcpS3Path and geoS3Path. Only the modes that
+// run ODM once over the whole image set take them.
+func validateSidecarOptions(processingMode, gcpS3Path, geoS3Path string) error {
+	for _, field := range []struct{ name, value string }{
+		{"gcpS3Path", gcpS3Path},
+		{"geoS3Path", geoS3Path},
+	} {
+		if field.value == "" {
+			continue
+		}
+		switch processingMode {
+		case workflows.ProcessingModeMergeExisting, workflows.ProcessingModeCityScale:
+			return fmt.Errorf("%s is not supported in %s mode", field.name, processingMode)
+		}
+		if err := workflows.ValidateSidecarS3Path(field.name, field.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// taskSidecars finds the ODM sidecar files beside the imagery under
+// readS3Path and validates them, or the files gcpS3Path and geoS3Path name in
+// their place, against that imagery. It returns the names of the sidecar
+// files the task's workspace will hold.
+func taskSidecars(ctx context.Context, client *minio.Client, readS3Path string, excludePatterns []string, maxDepth int, gcpS3Path, geoS3Path string) ([]string, error) {
+	found, images, err := s3.FindSidecarFilesInS3Path(ctx, client, readS3Path, excludePatterns, maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	overrides := map[string]string{
+		s3.GCPFileName: gcpS3Path,
+		s3.GeoFileName: geoS3Path,
+	}
+
+	var sidecars []string
+	for _, name := range s3.ODMSidecarFiles {
+		keys := found[name]
+		// The download stage refuses duplicates even when an override
+		// replaces them.
+		if len(keys) > 1 {
+			return nil, fmt.Errorf("found %d copies of %s under readS3Path (%s); keep one or exclude the others", len(keys), name, strings.Join(keys, ", "))
+		}
+
+		var data []byte
+		source := overrides[name]
+		switch {
+		case source != "":
+			split := strings.LastIndex(source, "/")
+			data, err = s3.ReadObjectInS3Path(ctx, client, source[:split], source[split+1:], workflows.MaxSidecarBytes)
+		case len(keys) == 1:
+			source = strings.TrimSuffix(readS3Path, "/") + "/" + keys[0]
+			data, err = s3.ReadObjectInS3Path(ctx, client, readS3Path, keys[0], workflows.MaxSidecarBytes)
+		default:
+			continue
+		}
+		if errors.Is(err, s3.ErrObjectNotFound) {
+			return nil, fmt.Errorf("%s not found", source)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", source, err)
+		}
+		if err := workflows.ValidateSidecarFile(name, data, images); err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		sidecars = append(sidecars, name)
+	}
+	return sidecars, nil
+}
+
 // odmFlagsFromOptions converts NodeODM options to flags and handles boundaries separately.
 func odmFlagsFromOptions(options []TaskOption) ([]string, workflows.BoundarySource, error) {
 	var (
@@ -218,6 +356,26 @@ func taskS3Client(metadataJSON []byte) (*minio.Client, error) {
 	return client, err
 }
 
+// removeSavedProjects deletes the ODM projects saved under a removed task's
+// write path: its checkpoint and the project kept for reruns. Nothing can
+// resume from them once the task is gone. Failures are logged only; the task
+// is removed regardless.
+func removeSavedProjects(ctx context.Context, route string, job *meta.JobMetadata) {
+	if job.WriteS3Path == "" {
+		return
+	}
+	client, err := taskS3Client(job.Metadata)
+	if err != nil {
+		log.Printf("%s: failed to create S3 client to remove saved projects of %q: %v", route, job.WorkflowName, err)
+		return
+	}
+	for _, path := range []string{s3.CheckpointPath(job.WriteS3Path), s3.IntermediatesPath(job.WriteS3Path)} {
+		if err := s3.RemoveAllInS3Path(ctx, client, path); err != nil {
+			log.Printf("%s: failed to remove %s: %v", route, path, err)
+		}
+	}
+}
+
 func metadataImageCount(metadataJSON []byte) int {
 	metaMap := parseMetadataMap(metadataJSON)
 	value, ok := metaMap[metadataImageCountKey]
@@ -233,6 +391,92 @@ func metadataImageCount(metadataJSON []byte) int {
 	return 0
 }
 
+func metadataLargestTaskImages(metadataJSON []byte) int {
+	metaMap := parseMetadataMap(metadataJSON)
+	if n, ok := metaMap[metadataLargestTaskImagesKey].(float64); ok {
+		return int(n)
+	}
+	return 0
+}
+
+func metadataReferenceDEMS3Path(metadataJSON []byte) string {
+	metaMap := parseMetadataMap(metadataJSON)
+	if v, ok := metaMap[metadataReferenceDEMS3PathKey].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// metadataODMImage returns the ODM image a task was created with; tasks
+// from before it was recorded ran the default image.
+func metadataODMImage(metadataJSON []byte) string {
+	metaMap := parseMetadataMap(metadataJSON)
+	if v, ok := metaMap[metadataODMImageKey].(string); ok && v != "" {
+		return v
+	}
+	return config.SCALEODM_ODM_IMAGE
+}
+
+// metadataSkipPostProcessing reports whether a task was created with
+// skipPostProcessing, so a restart builds the same stages.
+func metadataSkipPostProcessing(metadataJSON []byte) bool {
+	skip, _ := parseMetadataMap(metadataJSON)[metadataSkipPostProcessingKey].(bool)
+	return skip
+}
+
+// metadataKeepIntermediates reports whether a task was created with
+// keepIntermediates, so its runs save the ODM project for a rerun.
+func metadataKeepIntermediates(metadataJSON []byte) bool {
+	keep, _ := parseMetadataMap(metadataJSON)[metadataKeepIntermediatesKey].(bool)
+	return keep
+}
+
+// rerunFromOption takes NodeODM's rerun-from option out of a restart's
+// options: ScaleODM runs it as rerunFrom, since a restarted task starts
+// from an empty workspace.
+func rerunFromOption(options []TaskOption) (string, []TaskOption) {
+	var stage string
+	kept := make([]TaskOption, 0, len(options))
+	for _, opt := range options {
+		if opt.Name == "rerun-from" {
+			if opt.Value != nil {
+				stage = strings.TrimSpace(fmt.Sprint(opt.Value))
+			}
+			continue
+		}
+		kept = append(kept, opt)
+	}
+	return stage, kept
+}
+
+// metadataProgress returns the progress and stage the reconciler last
+// recorded for a running job, and whether it recorded any.
+func metadataProgress(metadataJSON []byte) (int, string, bool) {
+	metaMap := parseMetadataMap(metadataJSON)
+	progress, ok := metaMap[meta.MetadataProgressKey].(float64)
+	stage, _ := metaMap[meta.MetadataStageKey].(string)
+	return int(progress), stage, ok
+}
+
+func metadataODMStage(metadataJSON []byte) string {
+	stage, _ := parseMetadataMap(metadataJSON)[meta.MetadataODMStageKey].(string)
+	return stage
+}
+
+func metadataSidecars(metadataJSON []byte) (sidecars []string, gcpS3Path, geoS3Path string) {
+	metaMap := parseMetadataMap(metadataJSON)
+	if list, ok := metaMap[metadataSidecarFilesKey].([]interface{}); ok {
+		for _, item := range list {
+			if name, ok := item.(string); ok {
+				sidecars = append(sidecars, name)
+			}
+		}
+	}
+	gcpS3Path, _ = metaMap[metadataGCPS3PathKey].(string)
+	geoS3Path, _ = metaMap[metadataGeoS3PathKey].(string)
+	return sidecars, gcpS3Path, geoS3Path
+}
+
 func metadataProcessingMode(metadataJSON []byte) string {
 	metaMap := parseMetadataMap(metadataJSON)
 	if mode, ok := metaMap[metadataProcessingModeKey].(string); ok && mode != "" {
@@ -324,6 +568,11 @@ func metadataImageTotalBytes(metadataJSON []byte) int64 {
 	return 0
 }
 
+func metadataWorkspaceGiB(metadataJSON []byte) float64 {
+	value, _ := parseMetadataMap(metadataJSON)[meta.MetadataWorkspaceGiBKey].(float64)
+	return value
+}
+
 func detectWorkflowInfraFailure(wf *wfv1.Workflow) string {
 	infraFailure := func(msg string) bool {
 		lower := strings.ToLower(msg)
@@ -392,7 +641,109 @@ type TaskInfo struct {
 	Options        []TaskOption `json:"options" doc:"Processing options"`
 	ImagesCount    int          `json:"imagesCount" doc:"Number of images"`
 	Progress       int          `json:"progress" doc:"Progress from 0 to 100"`
+	Stage          string       `json:"stage,omitempty" doc:"Stage the task is in while it runs: a pipeline step (download, process, upload, ...) or, while ODM runs in the single-pod pipeline, its current stage (dataset, opensfm, openmvs, ..., report)"`
 	Output         []string     `json:"output,omitempty" doc:"Console output (if requested)"`
+	Stages         []TaskStage  `json:"stages,omitempty" doc:"Per-stage progress of multi-pod pipelines (split-merge, city-scale), in pipeline order"`
+}
+
+// TaskStage is a ScaleODM extension to NodeODM's task info: the progress of
+// one stage of a pipeline that runs a pod per step.
+type TaskStage struct {
+	Name      string `json:"name" doc:"Stage name, e.g. download, central, ring-1, merge"`
+	Status    string `json:"status" doc:"pending, running, succeeded, failed or skipped"`
+	Total     int    `json:"total" doc:"Pods started for this stage (one per task or submodel when fanned out)"`
+	Completed int    `json:"completed" doc:"Pods that succeeded"`
+	Failed    int    `json:"failed" doc:"Pods that failed"`
+}
+
+func taskStages(stages []workflows.WorkflowStage) []TaskStage {
+	if len(stages) == 0 {
+		return nil
+	}
+	out := make([]TaskStage, len(stages))
+	for i, stage := range stages {
+		out[i] = TaskStage{
+			Name:      stage.Name,
+			Status:    stage.Phase,
+			Total:     stage.Total,
+			Completed: stage.Completed,
+			Failed:    stage.Failed,
+		}
+	}
+	return out
+}
+
+// TaskInfoFromJob builds a task's info from its stored job alone: the info
+// GET /task/{uuid}/info returns before it checks the live workflow, and the
+// body of the task's webhook.
+func TaskInfoFromJob(job *meta.JobMetadata) TaskInfo {
+	info := TaskInfo{
+		UUID:        job.WorkflowName,
+		Name:        job.ODMProjectID,
+		DateCreated: job.CreatedAt.Unix(),
+		Status:      TaskStatus{Code: jobStatusToStatusCode(job.JobStatus)},
+		ImagesCount: metadataImageCount(job.Metadata),
+		Progress:    jobStatusToProgress(job.JobStatus),
+	}
+	if job.ErrorMessage != nil {
+		info.Status.ErrorMessage = *job.ErrorMessage
+	}
+	if strings.EqualFold(job.JobStatus, "running") {
+		// Recorded by the reconciler; stands in while the workflow can't be
+		// read.
+		if recorded, recordedStage, ok := metadataProgress(job.Metadata); ok {
+			info.Progress, info.Stage = recorded, recordedStage
+		}
+	}
+
+	// Calculate processing time from metadata timestamps, if present.
+	if job.StartedAt != nil {
+		endTime := time.Now()
+		if job.CompletedAt != nil {
+			endTime = *job.CompletedAt
+		}
+		info.ProcessingTime = endTime.Sub(*job.StartedAt).Milliseconds()
+	}
+
+	// Add options from metadata
+	if len(job.ODMFlags) > 0 {
+		var flags []string
+		if err := json.Unmarshal(job.ODMFlags, &flags); err == nil {
+			info.Options = make([]TaskOption, 0, len(flags))
+			for i := 0; i < len(flags); i++ {
+				flag := flags[i]
+				if !strings.HasPrefix(flag, "--") {
+					// Bare value from old pair-format storage: attach to previous option.
+					if len(info.Options) > 0 {
+						info.Options[len(info.Options)-1].Value = flag
+					}
+					continue
+				}
+				name := strings.TrimPrefix(flag, "--")
+				var value interface{} = true
+				if key, val, ok := strings.Cut(name, "="); ok {
+					name = key
+					value = val
+				}
+				info.Options = append(info.Options, TaskOption{Name: name, Value: value})
+			}
+		} else {
+			log.Printf("task %s: failed to unmarshal stored ODM flags: %v", job.WorkflowName, err)
+		}
+	}
+
+	// Add the saved boundary back to the options returned to clients.
+	if boundary := metadataBoundary(job.Metadata); boundary.IsSet() {
+		value := boundary.GeoJSON
+		if value == "" {
+			value = boundary.S3Path
+		}
+		info.Options = append(info.Options, TaskOption{
+			Name:  workflows.BoundaryOptionName,
+			Value: value,
+		})
+	}
+	return info
 }
 
 type TaskStatus struct {
@@ -423,7 +774,7 @@ type OptionResponse struct {
 	Name   string `json:"name" doc:"Option name"`
 	Type   string `json:"type" doc:"Datatype (int, float, string, bool)"`
 	Value  string `json:"value" doc:"Default value"`
-	Domain string `json:"domain" doc:"Valid range of values"`
+	Domain any    `json:"domain" doc:"Valid range of values, or the list of choices for enum options"`
 	Help   string `json:"help" doc:"Description"`
 }
 
@@ -441,6 +792,11 @@ type TaskNewRequest struct {
 	// Skip point cloud tiles generation. Defaults to false.
 	SkipPostProcessing bool `json:"skipPostProcessing,omitempty" form:"skipPostProcessing" default:"false" doc:"Skip point cloud tiles generation (default: false)"`
 
+	// KeepIntermediates saves the ODM project with the outputs, so the task
+	// can be restarted with rerunFrom. Standard and thermal tasks without
+	// split only.
+	KeepIntermediates bool `json:"keepIntermediates,omitempty" form:"keepIntermediates" default:"false" doc:"Save the ODM project for restarts with rerunFrom (default: false; standard and thermal tasks without split)"`
+
 	// NOTE that NodeODM has an 'outputs' param to override default output directory all.zip creation
 	// NOTE we do not implement this intentionally, to keep things simple
 	// JSON array of output paths to include. Defaults to an empty array.
@@ -474,18 +830,36 @@ type TaskNewRequest struct {
 	//     -> upload). Imagery under readS3Path is gathered into a single ODM
 	//     run; how deep the scan walks beneath readS3Path is controlled by
 	//     s3ScanDepth.
-	//
-	// Reserved (return 501 today):
 	//   - "merge-existing": stitch already-processed per-task outputs (orthos,
-	//     DEMs, point clouds) into a single set of products via the merge
-	//     half of split-merge. Much cheaper than re-running per-task
-	//     processing.
-	//   - "thermal": thermal imagery pipeline with dedicated pre-processing
-	//     before ODM (radiometric handling, alignment).
-	//   - "city-scale": large-area (>40 km²) projects with iterative
-	//     corrective alignment from a central task using prior LAZ point
-	//     clouds, plus a final alignment pass against a global DEM.
-	ProcessingMode string `json:"processingMode,omitempty" form:"processingMode" doc:"Pipeline mode: 'standard' (default). Reserved: 'merge-existing', 'thermal', 'city-scale'."`
+	//     DEMs, point clouds) under readS3Path into a single set of products
+	//     via the merge half of split-merge. Much cheaper than re-running
+	//     per-task processing. Takes no options; s3ScanDepth defaults to 10
+	//     and the default excludes are not applied.
+	//   - "thermal": thermal imagery. Radiometric JPEGs (DJI R-JPEG, FLIR)
+	//     are converted to temperature TIFFs before ODM runs, visible-light
+	//     frames from dual-sensor cameras are dropped, and thermal ODM flags
+	//     are added unless set.
+	//   - "city-scale": large-area (>40 km²) projects. Every directory of
+	//     images under readS3Path is processed as its own task, outwards from
+	//     a central task, each aligned to a neighbour's LAZ point cloud; the
+	//     results are merged and, with referenceDemS3Path, aligned to that
+	//     DEM. Needs at least two task directories and a ReadWriteMany
+	//     workspace; s3ScanDepth defaults to 10. Progress per stage is
+	//     reported in /task/{uuid}/info.
+	ProcessingMode string `json:"processingMode,omitempty" form:"processingMode" doc:"Pipeline mode: 'standard' (default), 'merge-existing', 'thermal' or 'city-scale'."`
+
+	// ReferenceDEMS3Path is a GeoTIFF DEM (e.g. Copernicus GLO-30) that a
+	// city-scale task's merged DSM, DTM and point cloud are vertically
+	// aligned to. City-scale only.
+	ReferenceDEMS3Path string `json:"referenceDemS3Path,omitempty" form:"referenceDemS3Path" doc:"S3 path (s3://bucket/key.tif) of a DEM to align city-scale products to (optional, city-scale only)"`
+
+	// GCPS3Path and GeoS3Path name a gcp_list.txt and a geo.txt to use
+	// instead of any found beside the imagery. Sidecar files under
+	// readS3Path (gcp_list.txt, geo.txt, image_groups.txt, cameras.json)
+	// are picked up without them. Not supported in merge-existing or
+	// city-scale mode.
+	GCPS3Path string `json:"gcpS3Path,omitempty" form:"gcpS3Path" doc:"S3 path (s3://bucket/key) of an ODM gcp_list.txt to use instead of one beside the imagery (optional)"`
+	GeoS3Path string `json:"geoS3Path,omitempty" form:"geoS3Path" doc:"S3 path (s3://bucket/key) of an ODM geo.txt to use instead of one beside the imagery (optional)"`
 
 	// CapacityType selects the Karpenter node pool for workflow pods.
 	// Use "on-demand" for VIP or time-sensitive jobs that cannot tolerate spot
@@ -512,8 +886,19 @@ type TaskNewRequest struct {
 	// Defaults to true; set to false only when you genuinely want to
 	// re-process a previous ODM run's output as input.
 	UseDefaultExcludes *bool `json:"useDefaultExcludes,omitempty" form:"useDefaultExcludes" doc:"Apply the built-in ODM-output exclude list (default: true)"`
+
+	// Priority orders ScaleODM's dispatch queue (SCALEODM_QUEUE_ENABLED):
+	// higher values are submitted to Argo first. Ignored when the queue is
+	// disabled. Range: -100..100.
+	Priority int `json:"priority,omitempty" form:"priority" doc:"Dispatch priority, -100..100 (default 0; higher runs first). Only used when the ScaleODM queue is enabled."`
 }
 
+// Bounds for TaskNewRequest.Priority.
+const (
+	minTaskPriority = -100
+	maxTaskPriority = 100
+)
+
 type Response struct {
 	Success bool   `json:"success" doc:"True if command succeeded"`
 	Error   string `json:"error,omitempty" doc:"Error message if failed"`
@@ -557,6 +942,9 @@ var taskPrimaryAssetDefinitions = []taskPrimaryAssetDefinition{
 	{ID: "dsm", Assets: []string{"odm_dem/dsm.tif", "dsm.tif"}},
 	{ID: "dtm", Assets: []string{"odm_dem/dtm.tif", "dtm.tif"}},
 	{ID: "point_cloud", Assets: []string{"odm_georeferencing/odm_georeferenced_model.laz", "odm_georeferencing/odm_georeferenced_model.las", "odm_georeferencing/odm_georeferenced_model.ply", "georeferenced_model.laz", "georeferenced_model.las", "georeferenced_model.ply", "point_cloud.laz", "point_cloud.ply"}},
+	// Point cloud tiles from the postprocess stage; absent with skipPostProcessing.
+	{ID: "entwine_pointcloud", Assets: []string{workflows.PostProcessEPTFile}},
+	{ID: "copc", Assets: []string{workflows.PostProcessCOPCFile}},
 }
 
 var taskAssetAliasCandidates = map[string][]string{
@@ -573,6 +961,7 @@ var taskAssetAliasCandidates = map[string][]string{
 		"point_cloud.laz",
 		"point_cloud.ply",
 	},
+	"copc": {workflows.PostProcessCOPCFile},
 }
 
 func taskAssetDownloadURL(uuid, asset string) string {
@@ -619,7 +1008,7 @@ func (a *API) registerNodeODMRoutes() {
 		Summary:     "Retrieves information about this node",
 		Tags:        []string{"server"},
 	}, func(ctx context.Context, input *struct {
-		Token string `query:"token" doc:"Authentication token (optional)"`
+		Token string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
 	}) (*InfoResponse, error) {
 		log.Printf("GET /info: token_provided=%t", input.Token != "")
 
@@ -634,10 +1023,29 @@ func (a *API) registerNodeODMRoutes() {
 			}
 		}
 
+		// Tasks still in ScaleODM's own queue have no workflow yet.
+		if config.SCALEODM_QUEUE_ENABLED {
+			if queued, err := a.metadataStore.ListQueuedJobNames(ctx, ""); err == nil {
+				queueCount += len(queued)
+			} else {
+				log.Printf("GET /info: failed to count queued tasks: %v", err)
+			}
+		}
+
 		resp := &InfoResponse{}
 		resp.Body.Version = version.Version // The ScaleODM version (normally the NodeODM version)
 		resp.Body.TaskQueueCount = queueCount
 		resp.Body.MaxImages = nil // Unlimited
+		if config.SCALEODM_QUOTA_ENABLED {
+			limits, err := a.tenantLimits(ctx, auth.TenantFromContext(ctx))
+			if err != nil {
+				log.Printf("GET /info: failed to load quota: %v", err)
+			}
+			if limits.MaxImagesPerTask > 0 {
+				resp.Body.MaxImages = &limits.MaxImagesPerTask
+			}
+			resp.Body.MaxParallelTasks = limits.MaxConcurrentTasks
+		}
 		resp.Body.Engine = "odm"
 		resp.Body.EngineVersion = config.SCALEODM_ODM_IMAGE
 
@@ -650,52 +1058,24 @@ func (a *API) registerNodeODMRoutes() {
 		Method:      http.MethodGet,
 		Path:        "/options",
 		Summary:     "Retrieves command line options for task processing",
+		Description: "Lists every option the ODM image accepts, read from the image itself. Tasks are validated against the same list.",
 		Tags:        []string{"server"},
 	}, func(ctx context.Context, input *struct {
-		Token string `query:"token" doc:"Authentication token (optional)"`
+		Token    string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
+		OdmImage string `query:"odmImage" doc:"List the options of this allowlisted ODM image instead of the default one"`
 	}) (*struct{ Body []OptionResponse }, error) {
-		log.Printf("GET /options: token_provided=%t", input.Token != "")
-
-		// Return common ODM options
-		options := []OptionResponse{
-			{
-				Name:   "fast-orthophoto",
-				Type:   "bool",
-				Value:  "false",
-				Domain: "bool",
-				Help:   "Skips dense reconstruction and 3D model generation",
-			},
-			{
-				Name:   "dsm",
-				Type:   "bool",
-				Value:  "false",
-				Domain: "bool",
-				Help:   "Use this tag to build a Digital Surface Model",
-			},
-			{
-				Name:   "dtm",
-				Type:   "bool",
-				Value:  "false",
-				Domain: "bool",
-				Help:   "Use this tag to build a Digital Terrain Model",
-			},
-			{
-				Name:   "orthophoto-resolution",
-				Type:   "float",
-				Value:  "5",
-				Domain: "float > 0",
-				Help:   "Orthophoto resolution in cm/pixel",
-			},
-			{
-				Name:   "dem-resolution",
-				Type:   "float",
-				Value:  "5",
-				Domain: "float > 0",
-				Help:   "DEM resolution in cm/pixel",
-			},
-		}
-
-		return &struct{ Body []OptionResponse }{Body: options}, nil
+		log.Printf("GET /options: token_provided=%t odm_image=%q", input.Token != "", input.OdmImage)
+
+		odmImage, err := resolveODMImage(input.OdmImage)
+		if err != nil {
+			return nil, huma.NewError(400, err.Error())
+		}
+		catalog := a.odmOptions.Lookup(odmImage)
+		if catalog == nil {
+			log.Printf("GET /options: catalog for %s is not loaded yet, serving the common options", odmImage)
+			return &struct{ Body []OptionResponse }{Body: fallbackODMOptions}, nil
+		}
+		return &struct{ Body []OptionResponse }{Body: optionResponses(catalog)}, nil
 	})
 
 	// POST /task/new - Create new task
@@ -707,9 +1087,10 @@ func (a *API) registerNodeODMRoutes() {
 		Description: "Creates a new task and places it at the end of the processing queue",
 		Tags:        []string{"task"},
 	}, func(ctx context.Context, input *struct {
-		Token   string `query:"token" doc:"Authentication token (optional)"`
-		SetUUID string `header:"set-uuid" doc:"Optional UUID to use for this task"`
-		Body    TaskNewRequest
+		Token          string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
+		SetUUID        string `header:"set-uuid" doc:"Optional UUID to use for this task; it must not name an existing task"`
+		IdempotencyKey string `header:"Idempotency-Key" doc:"Optional client-chosen key; repeating a request with the same key returns the task it created instead of creating another"`
+		Body           TaskNewRequest
 	}) (*TaskNewResponse, error) {
 		start := time.Now()
 		metricResult := "failure"
@@ -728,7 +1109,7 @@ func (a *API) registerNodeODMRoutes() {
 
 		// Log incoming task creation request
 		log.Printf(
-			"POST /task/new: name=%q readS3Path=%q writeS3Path=%q zipurl=%q skipPostProcessing=%t webhook_set=%t s3Region=%q s3Endpoint=%q dateCreated=%d processingMode=%q token_provided=%t setUUID_set=%t",
+			"POST /task/new: name=%q readS3Path=%q writeS3Path=%q zipurl=%q skipPostProcessing=%t webhook_set=%t s3Region=%q s3Endpoint=%q dateCreated=%d processingMode=%q token_provided=%t setUUID=%q idempotencyKey_set=%t",
 			req.Name,
 			req.ReadS3Path,
 			req.WriteS3Path,
@@ -740,321 +1121,24 @@ func (a *API) registerNodeODMRoutes() {
 			req.DateCreated,
 			req.ProcessingMode,
 			input.Token != "",
-			input.SetUUID != "",
+			input.SetUUID,
+			input.IdempotencyKey != "",
 		)
 
-		// Resolve processing mode + compose exclude list before doing any
-		// expensive work. Reserved modes get 501 so clients can probe support.
-		processingMode := req.ProcessingMode
-		if processingMode == "" {
-			processingMode = workflows.ProcessingModeStandard
-		}
-		if workflows.IsReservedProcessingMode(processingMode) {
-			metricResult = "failure"
-			metricReason = "processing_mode_not_implemented"
-			log.Printf("POST /task/new: processingMode=%q is reserved but not yet implemented", processingMode)
-			return nil, huma.NewError(501, fmt.Sprintf("processingMode %q is reserved for a future pipeline and is not yet implemented", processingMode))
-		}
-		if !workflows.IsImplementedProcessingMode(processingMode) {
-			metricResult = "failure"
-			metricReason = "invalid_processing_mode"
-			log.Printf("POST /task/new: invalid processingMode=%q", processingMode)
-			return nil, huma.NewError(400, fmt.Sprintf("invalid processingMode %q (supported: standard)", processingMode))
-		}
-
-		capacityType := req.CapacityType
-		if capacityType == "" {
-			capacityType = config.SCALEODM_WORKFLOW_CAPACITY_TYPE
-		}
-		if !workflows.IsValidCapacityType(capacityType) {
-			metricResult = "failure"
-			metricReason = "invalid_capacity_type"
-			log.Printf("POST /task/new: invalid capacityType=%q", capacityType)
-			return nil, huma.NewError(400, fmt.Sprintf("invalid capacityType %q (supported: spot, on-demand)", capacityType))
-		}
-
-		odmImage, imageErr := resolveODMImage(req.OdmImage)
-		if imageErr != nil {
-			metricResult = "failure"
-			metricReason = "invalid_odm_image"
-			log.Printf("POST /task/new: rejected odmImage=%q", req.OdmImage)
-			return nil, huma.NewError(400, imageErr.Error())
-		}
-
-		s3ScanDepth := 0
-		if req.S3ScanDepth != nil {
-			s3ScanDepth = *req.S3ScanDepth
-		}
-		s3ScanDepth, err := workflows.ValidateS3ScanDepth(s3ScanDepth)
+		identity, err := newTaskIdentity(input.SetUUID, input.IdempotencyKey)
 		if err != nil {
-			metricResult = "failure"
-			metricReason = "invalid_s3_scan_depth"
-			log.Printf("POST /task/new: invalid s3ScanDepth: %v", err)
-			return nil, huma.NewError(400, err.Error())
-		}
-
-		var userExcludes []string
-		if strings.TrimSpace(req.ExcludePaths) != "" {
-			if err := json.Unmarshal([]byte(req.ExcludePaths), &userExcludes); err != nil {
-				metricResult = "failure"
-				metricReason = "invalid_exclude_paths"
-				log.Printf("POST /task/new: invalid excludePaths JSON: %v", err)
-				return nil, huma.NewError(400, "Invalid excludePaths JSON (expected an array of strings)", err)
-			}
-			for _, p := range userExcludes {
-				if err := workflows.ValidateExcludePattern(p); err != nil {
-					metricResult = "failure"
-					metricReason = "invalid_exclude_pattern"
-					log.Printf("POST /task/new: invalid exclude pattern %q: %v", p, err)
-					return nil, huma.NewError(400, fmt.Sprintf("invalid exclude pattern %q: %s", p, err.Error()))
-				}
-			}
-		}
-
-		useDefaultExcludes := true
-		if req.UseDefaultExcludes != nil {
-			useDefaultExcludes = *req.UseDefaultExcludes
-		}
-		excludePatterns := workflows.ComposeExcludePatterns(useDefaultExcludes, userExcludes)
-
-		// Parse options if provided
-		var options []TaskOption
-		var odmFlags []string
-		var boundary workflows.BoundarySource
-		if req.Options != "" {
-			if err := json.Unmarshal([]byte(req.Options), &options); err != nil {
-				metricResult = "failure"
-				metricReason = "invalid_options"
-				span.AddEvent("task.new.rejected", trace.WithAttributes(attribute.String("reason", metricReason)))
-				log.Printf("POST /task/new: invalid options JSON: %v", err)
-				return nil, huma.NewError(400, "Invalid options JSON", err)
-			}
-
-			// Convert options to ODM flags
-			var flagsErr error
-			odmFlags, boundary, flagsErr = odmFlagsFromOptions(options)
-			if flagsErr != nil {
-				metricResult = "failure"
-				metricReason = "invalid_options"
-				span.AddEvent("task.new.rejected", trace.WithAttributes(attribute.String("reason", metricReason)))
-				log.Printf("POST /task/new: invalid options: %v", flagsErr)
-				return nil, huma.NewError(400, flagsErr.Error())
-			}
-		}
-
-		// Determine read and write paths
-		var readPath, writePath string
-
-		// New API: prefer readS3Path/writeS3Path
-		if req.ReadS3Path != "" {
-			readPath = strings.TrimSuffix(req.ReadS3Path, "/") + "/"
-			if req.WriteS3Path != "" {
-				writePath = strings.TrimSuffix(req.WriteS3Path, "/") + "/"
-			} else {
-				// Default: write to output subdirectory in read path
-				writePath = strings.TrimSuffix(req.ReadS3Path, "/") + "/output/"
-			}
-		} else if req.ZipURL != "" {
-			// Legacy support: zipurl parameter
-			isS3Prefix := strings.HasPrefix(req.ZipURL, "s3://")
-			isHTTPZip := strings.HasPrefix(req.ZipURL, "http://") || strings.HasPrefix(req.ZipURL, "https://")
-
-			if !isS3Prefix && !isHTTPZip {
-				metricReason = "invalid_zipurl"
-				log.Printf("POST /task/new: invalid zipurl=%q (must be s3:// or http(s) zip URL)", req.ZipURL)
-				return nil, huma.NewError(400, "zipurl must be an s3://... prefix or a http(s) zip URL")
-			}
-
-			if isS3Prefix {
-				readPath = strings.TrimSuffix(req.ZipURL, "/") + "/"
-				writePath = strings.TrimSuffix(req.ZipURL, "/") + "-output/"
-			} else {
-				// HTTP zip - not supported for S3 read/write workflow
-				metricReason = "http_zip_not_supported"
-				log.Printf("POST /task/new: HTTP zip URLs not supported zipurl=%q", req.ZipURL)
-				return nil, huma.NewError(400, "HTTP zip URLs not supported. Use readS3Path for S3-based processing")
-			}
-		} else {
-			metricReason = "missing_read_path"
-			log.Printf("POST /task/new: missing required readS3Path or zipurl")
-			return nil, huma.NewError(400, "readS3Path is required (or zipurl for legacy support)")
-		}
-
-		// Validate S3 paths
-		if !strings.HasPrefix(readPath, "s3://") {
-			metricReason = "invalid_read_path"
-			log.Printf("POST /task/new: readPath must be s3:// path, got %q", readPath)
-			return nil, huma.NewError(400, "readS3Path must be an s3:// path")
-		}
-		if !strings.HasPrefix(writePath, "s3://") {
-			metricReason = "invalid_write_path"
-			log.Printf("POST /task/new: writePath must be s3:// path, got %q", writePath)
-			return nil, huma.NewError(400, "writeS3Path must be an s3:// path")
-		}
-
-		projectID := req.Name
-		if projectID == "" {
-			projectID = "odm-project"
-		}
-
-		// Validate all values that will be embedded in shell scripts
-		if err := validateShellSafe(projectID, "name"); err != nil {
-			metricReason = "invalid_project_name"
-			return nil, huma.NewError(400, err.Error())
-		}
-		for _, flag := range odmFlags {
-			if err := validateShellSafe(flag, "options flag"); err != nil {
-				metricReason = "invalid_option_flag"
-				return nil, huma.NewError(400, err.Error())
-			}
-		}
-		if err := validateShellSafe(readPath, "readS3Path"); err != nil {
-			metricReason = "invalid_read_path"
-			return nil, huma.NewError(400, err.Error())
-		}
-		if err := validateShellSafe(writePath, "writeS3Path"); err != nil {
-			metricReason = "invalid_write_path"
+			metricReason = "invalid_task_identity"
 			return nil, huma.NewError(400, err.Error())
 		}
-
-		// Determine S3 region & optional endpoint
-		s3Region := req.S3Region
-		s3Endpoint, err := normalizeOptionalS3Endpoint(req.S3Endpoint)
-		if err != nil {
-			metricResult = "failure"
-			metricReason = "invalid_s3_endpoint"
-			return nil, huma.NewError(400, "Invalid s3Endpoint", err)
-		}
-		if err := enforceEndpointAllowlist(s3Endpoint); err != nil {
-			metricResult = "failure"
-			metricReason = "invalid_s3_endpoint"
-			return nil, huma.NewError(400, "Invalid s3Endpoint", err)
-		}
-		if s3Region == "" {
-			if s3Endpoint != "" {
-				s3Region = "garage"
-			} else {
-				s3Region = "us-east-1"
-			}
-		}
-		log.Printf("POST /task/new: endpoint selection endpoint=%q region=%q allowlist_enforced=%t", s3Endpoint, s3Region, config.SCALEODM_ENFORCE_S3_ENDPOINT_ALLOWLIST)
-
-		// Count images before workflow submission so resources can be sized.
-		taskClient, clientErr := s3.GetS3ClientForEndpoint(config.AWS_S3_ENDPOINT)
-		if s3Endpoint != "" {
-			taskClient, clientErr = s3.GetS3ClientForEndpoint(s3Endpoint)
-		}
-		if clientErr != nil {
-			metricResult = "failure"
-			metricReason = "s3_client_init_failed"
-			log.Printf("POST /task/new: failed to construct S3 client for image counting endpoint=%q: %v", s3Endpoint, clientErr)
-			return nil, huma.NewError(500, "Failed to initialize S3 client", clientErr)
-		}
-		imageCount, imageTotalBytes, countErr := s3.CountImageStatsInS3PathWithExcludes(ctx, taskClient, readPath, excludePatterns)
-		if countErr != nil {
-			metricResult = "failure"
-			metricReason = "image_count_failed"
-			log.Printf("POST /task/new: failed to count images for readPath=%q endpoint=%q: %v", readPath, s3Endpoint, countErr)
-			return nil, huma.NewError(400, "Unable to read imagery from readS3Path", countErr)
-		}
-
-		// S3 credentials are configured at the server level and injected into
-		// workflow pods via Kubernetes Secret references (secretKeyRef).
-		// No per-request credential handling needed.
-		wfConfig := workflows.NewDefaultODMConfig(
-			projectID,
-			readPath,
-			writePath,
-			odmFlags,
-		)
-		wfConfig.S3Region = s3Region
-		wfConfig.S3Endpoint = s3Endpoint
-		wfConfig.ImageCount = imageCount
-		wfConfig.ImageTotalBytes = imageTotalBytes
-		wfConfig.ProcessingMode = processingMode
-		wfConfig.CapacityType = capacityType
-		wfConfig.ODMImage = odmImage
-		wfConfig.ExcludePaths = excludePatterns
-		wfConfig.S3ScanDepth = s3ScanDepth
-		wfConfig.Boundary = boundary
-
-		// Submit workflow to Argo
-		wf, err := a.workflowClient.CreateODMWorkflow(ctx, wfConfig)
-		if err != nil {
-			metricResult = "failure"
-			metricReason = "argo_create_failed"
-			log.Printf("workflow creation rejected reason=argo_create_failed project_id=%q error=%v", projectID, err)
-			return nil, huma.NewError(500, "Failed to create workflow", err)
-		}
-		log.Printf("workflow creation accepted workflow=%q project_id=%q", wf.Name, projectID)
-
-		log.Printf(
-			"POST /task/new: created workflow name=%q projectID=%q readPath=%q writePath=%q odmFlags=%v s3Region=%q imageCount=%d imageTotalBytes=%d endpoint=%q",
-			wf.Name,
-			projectID,
-			readPath,
-			writePath,
-			odmFlags,
-			s3Region,
-			imageCount,
-			imageTotalBytes,
-			s3Endpoint,
-		)
-
-		// Record metadata in database. If this fails, the workflow exists in
-		// Argo but won't be visible via the API - treat as a hard error so the
-		// caller knows to retry rather than losing track of the workflow.
-		_, err = a.metadataStore.CreateJob(
-			ctx,
-			wf.Name,
-			projectID,
-			readPath,
-			writePath,
-			odmFlags,
-			s3Region,
-			// Save the boundary with the job so restarts cannot lose it.
-			map[string]any{
-				metadataBoundaryGeoJSONKey: boundary.GeoJSON,
-				metadataBoundaryS3PathKey:  boundary.S3Path,
-			},
-		)
+		uuid, reason, err := a.createTask(ctx, "POST /task/new", req, identity)
+		metricReason = reason
 		if err != nil {
-			metricResult = "failure"
-			metricReason = "metadata_create_failed"
-			log.Printf("workflow created but metadata update failed workflow=%q reason=metadata_create_failed error=%v", wf.Name, err)
-			if rollbackErr := a.workflowClient.DeleteWorkflow(ctx, wf.Name); rollbackErr != nil && !isNotFound(rollbackErr) {
-				log.Printf("POST /task/new: failed cleanup delete of unmanaged workflow %q after metadata create failure: %v", wf.Name, rollbackErr)
-			} else {
-				log.Printf("POST /task/new: compensated orphan workflow %q after metadata create failure", wf.Name)
-			}
-			return nil, huma.NewError(500, "Workflow created but failed to record metadata - retry the request", err)
-		}
-
-		metadataUpdates := map[string]interface{}{
-			metadataImageCountKey:            imageCount,
-			metadataImageTotalBytesKey:       imageTotalBytes,
-			metadataWorkflowMissingFirstSeen: nil,
-			metadataProcessingModeKey:        processingMode,
-			metadataCapacityTypeKey:          capacityType,
-			metadataExcludePathsKey:          userExcludes,
-			metadataUseDefaultExcludesKey:    useDefaultExcludes,
-			metadataS3ScanDepthKey:           s3ScanDepth,
-		}
-		if s3Endpoint != "" {
-			metadataUpdates[metadataS3EndpointKey] = s3Endpoint
-		}
-		// Persist the webhook URL so the reconciler can POST a terminal-status notification
-		if strings.TrimSpace(req.Webhook) != "" {
-			metadataUpdates[meta.MetadataWebhookKey] = req.Webhook
-		}
-		if metaErr := a.metadataStore.MergeJobMetadata(ctx, wf.Name, metadataUpdates); metaErr != nil {
-			log.Printf("workflow created but metadata enrichment failed workflow=%q reason=metadata_enrichment_failed error=%v", wf.Name, metaErr)
+			return nil, err
 		}
 
 		resp := &TaskNewResponse{}
-		resp.Body.UUID = wf.Name
+		resp.Body.UUID = uuid
 		metricResult = "success"
-		metricReason = "none"
 		return resp, nil
 	})
 
@@ -1066,11 +1150,11 @@ func (a *API) registerNodeODMRoutes() {
 		Summary:     "Gets the list of tasks",
 		Tags:        []string{"task"},
 	}, func(ctx context.Context, input *struct {
-		Token string `query:"token" doc:"Authentication token (optional)"`
+		Token string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
 	}) (*TaskListResponse, error) {
 		log.Printf("GET /task/list: token_provided=%t", input.Token != "")
 
-		wfList, err := a.workflowClient.ListWorkflows(ctx, "")
+		wfList, err := a.workflowClient.ListWorkflows(ctx, workflows.TenantSelector(auth.TenantFromContext(ctx)))
 		if err != nil {
 			log.Printf("GET /task/list: failed to list workflows: %v", err)
 			return nil, huma.NewError(500, "Failed to list tasks", err)
@@ -1079,8 +1163,24 @@ func (a *API) registerNodeODMRoutes() {
 		resp := &TaskListResponse{}
 		resp.Body = make([]TaskListItem, 0, len(wfList.Items))
 
+		listed := make(map[string]bool, len(wfList.Items))
 		for _, wf := range wfList.Items {
 			resp.Body = append(resp.Body, TaskListItem{UUID: wf.Name})
+			listed[wf.Name] = true
+		}
+
+		// Include tasks still waiting in ScaleODM's queue.
+		if config.SCALEODM_QUEUE_ENABLED {
+			queued, err := a.metadataStore.ListQueuedJobNames(ctx, auth.TenantFromContext(ctx))
+			if err != nil {
+				log.Printf("GET /task/list: failed to list queued tasks: %v", err)
+				return nil, huma.NewError(500, "Failed to list tasks", err)
+			}
+			for _, name := range queued {
+				if !listed[name] {
+					resp.Body = append(resp.Body, TaskListItem{UUID: name})
+				}
+			}
 		}
 
 		log.Printf("GET /task/list: returned %d tasks", len(resp.Body))
@@ -1097,14 +1197,14 @@ func (a *API) registerNodeODMRoutes() {
 		Tags:        []string{"task"},
 	}, func(ctx context.Context, input *struct {
 		UUID       string `path:"uuid" doc:"UUID of the task"`
-		Token      string `query:"token" doc:"Authentication token (optional)"`
+		Token      string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
 		WithOutput int    `query:"with_output" default:"0" doc:"Line number to start console output from"`
 	}) (*TaskInfoResponse, error) {
 		log.Printf("GET /task/%s/info: token_provided=%t with_output=%d", input.UUID, input.Token != "", input.WithOutput)
 
 		// Look up job metadata first. If we don't have metadata, the task
 		// truly doesn't exist for this ScaleODM instance.
-		job, err := a.metadataStore.GetJob(ctx, input.UUID)
+		job, err := a.getJobForCaller(ctx, input.UUID)
 		if err != nil {
 			log.Printf("GET /task/%s/info: failed to retrieve task metadata: %v", input.UUID, err)
 			return nil, huma.NewError(500, "Failed to retrieve task metadata", err)
@@ -1117,18 +1217,19 @@ func (a *API) registerNodeODMRoutes() {
 
 		// Build task info from metadata, but prefer live workflow phase when
 		// the Argo workflow still exists.
-		statusCode := jobStatusToStatusCode(job.JobStatus)
-		progress := jobStatusToProgress(job.JobStatus)
-		errorMessage := ""
-		if job.ErrorMessage != nil {
-			errorMessage = *job.ErrorMessage
-		}
-
-		imagesCount := metadataImageCount(job.Metadata)
-
-		if wf, wfErr := a.workflowClient.GetWorkflow(ctx, input.UUID); wfErr == nil {
+		info := TaskInfoFromJob(job)
+		statusCode, progress, stage := info.Status.Code, info.Progress, info.Stage
+		errorMessage := info.Status.ErrorMessage
+		var stages []TaskStage
+
+		if job.AwaitingDispatch {
+			// Still in ScaleODM's queue: there is no workflow to inspect yet,
+			// and its absence from Argo is expected.
+			log.Printf("GET /task/%s/info: task awaiting dispatch status=%q priority=%d", input.UUID, job.JobStatus, job.Priority)
+		} else if wf, wfErr := a.workflowClient.GetWorkflow(ctx, input.UUID); wfErr == nil {
 			statusCode = workflowToStatusCode(wf.Status.Phase)
-			progress = workflowToProgress(wf.Status.Phase)
+			progress, stage = workflows.WorkflowProgress(wf, metadataODMStage(job.Metadata))
+			stages = taskStages(workflows.WorkflowStages(wf))
 			if (wf.Status.Phase == wfv1.WorkflowFailed || wf.Status.Phase == wfv1.WorkflowError) && wf.Status.Message != "" {
 				errorMessage = wf.Status.Message
 			}
@@ -1146,11 +1247,11 @@ func (a *API) registerNodeODMRoutes() {
 				failureMsg := detectWorkflowInfraFailure(wf)
 				if failureMsg != "" {
 					statusCode = StatusCodeFailed
-					progress = 0
+					progress, stage = 0, ""
 					errorMessage = failureMsg
 					observability.RecordWorkflowReconciliation("running_to_failed", "infra_failure")
 					log.Printf("reconciliation transition uuid=%s source=argo transition=running_to_failed reason=infra_failure", input.UUID)
-					if err := a.metadataStore.UpdateJobStatus(ctx, input.UUID, "failed", &failureMsg); err != nil {
+					if err := a.metadataStore.UpdateJobStatus(meta.WithActor(ctx, meta.ActorAPI, "infra_failure"), input.UUID, "failed", &failureMsg); err != nil {
 						log.Printf("GET /task/%s/info: failed to persist reconciled failure status: %v", input.UUID, err)
 					}
 					infraFailureReconciled = true
@@ -1167,8 +1268,10 @@ func (a *API) registerNodeODMRoutes() {
 					if errorMessage != "" {
 						errPtr = &errorMessage
 					}
-					if err := a.metadataStore.UpdateJobStatus(ctx, input.UUID, liveStatus, errPtr); err != nil {
+					if err := a.metadataStore.UpdateJobStatus(meta.WithActor(ctx, meta.ActorAPI, "argo_sync"), input.UUID, liveStatus, errPtr); err != nil {
 						log.Printf("GET /task/%s/info: failed to sync status db=%q argo=%q: %v", input.UUID, dbStatus, liveStatus, err)
+					} else if meta.IsTerminalJobStatus(liveStatus) {
+						reconciler.RecordFinishedWorkflow(ctx, a.metadataStore, a.workflowClient, job, wf)
 					}
 				}
 			}
@@ -1198,7 +1301,7 @@ func (a *API) registerNodeODMRoutes() {
 					msg := "Workflow missing in Argo beyond grace window; marking task as failed"
 					observability.RecordWorkflowReconciliation("missing_workflow_to_failed", "missing_workflow_grace_expired")
 					log.Printf("reconciliation transition uuid=%s source=metadata transition=missing_workflow_to_failed reason=missing_workflow_grace_expired", input.UUID)
-					if err := a.metadataStore.UpdateJobStatus(ctx, input.UUID, "failed", &msg); err != nil {
+					if err := a.metadataStore.UpdateJobStatus(meta.WithActor(ctx, meta.ActorAPI, "missing_workflow_grace_expired"), input.UUID, "failed", &msg); err != nil {
 						log.Printf("GET /task/%s/info: failed to reconcile missing workflow to failed status: %v", input.UUID, err)
 					} else {
 						_ = a.metadataStore.MergeJobMetadata(ctx, input.UUID, map[string]interface{}{metadataWorkflowMissingFirstSeen: nil})
@@ -1206,7 +1309,7 @@ func (a *API) registerNodeODMRoutes() {
 						job.ErrorMessage = &msg
 					}
 					statusCode = StatusCodeFailed
-					progress = 0
+					progress, stage = 0, ""
 					errorMessage = msg
 				}
 			}
@@ -1214,70 +1317,11 @@ func (a *API) registerNodeODMRoutes() {
 			log.Printf("GET /task/%s/info: failed to fetch live workflow state: %v", input.UUID, wfErr)
 		}
 
-		status := TaskStatus{Code: statusCode}
-		if errorMessage != "" {
-			status.ErrorMessage = errorMessage
-		}
-
-		info := TaskInfo{
-			UUID:        job.WorkflowName,
-			Name:        job.ODMProjectID,
-			DateCreated: job.CreatedAt.Unix(),
-			Status:      status,
-			ImagesCount: imagesCount,
-			Progress:    progress,
-		}
-
-		// Calculate processing time from metadata timestamps, if present.
-		if job.StartedAt != nil {
-			endTime := time.Now()
-			if job.CompletedAt != nil {
-				endTime = *job.CompletedAt
-			}
-			info.ProcessingTime = endTime.Sub(*job.StartedAt).Milliseconds()
-		}
-
-		// Add options from metadata
-		if len(job.ODMFlags) > 0 {
-			var flags []string
-			if err := json.Unmarshal(job.ODMFlags, &flags); err == nil {
-				info.Options = make([]TaskOption, 0, len(flags))
-				for i := 0; i < len(flags); i++ {
-					flag := flags[i]
-					if !strings.HasPrefix(flag, "--") {
-						// Bare value from old pair-format storage: attach to previous option.
-						if len(info.Options) > 0 {
-							info.Options[len(info.Options)-1].Value = flag
-						}
-						continue
-					}
-					name := strings.TrimPrefix(flag, "--")
-					var value interface{} = true
-					if key, val, ok := strings.Cut(name, "="); ok {
-						name = key
-						value = val
-					}
-					info.Options = append(info.Options, TaskOption{Name: name, Value: value})
-				}
-			} else {
-				log.Printf("GET /task/%s/info: failed to unmarshal stored ODM flags: %v", input.UUID, err)
-			}
-		}
-
-		// Add the saved boundary back to the options returned to clients.
-		if boundary := metadataBoundary(job.Metadata); boundary.IsSet() {
-			value := boundary.GeoJSON
-			if value == "" {
-				value = boundary.S3Path
-			}
-			info.Options = append(info.Options, TaskOption{
-				Name:  workflows.BoundaryOptionName,
-				Value: value,
-			})
-		}
+		info.Status = TaskStatus{Code: statusCode, ErrorMessage: errorMessage}
+		info.Progress, info.Stage, info.Stages = progress, stage, stages
 
 		// Get console output if requested
-		if input.WithOutput > 0 {
+		if input.WithOutput > 0 && !job.AwaitingDispatch {
 			var logBuilder strings.Builder
 			if job.WriteS3Path != "" {
 				if err := a.workflowClient.GetWorkflowLogsWithArchiveFallback(ctx, input.UUID, &logBuilder); err == nil {
@@ -1315,13 +1359,13 @@ func (a *API) registerNodeODMRoutes() {
 		Tags:        []string{"task"},
 	}, func(ctx context.Context, input *struct {
 		UUID  string `path:"uuid" doc:"UUID of the task"`
-		Token string `query:"token" doc:"Authentication token (optional)"`
+		Token string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
 		Line  int    `query:"line" default:"0" doc:"Line number to start from"`
 	}) (*struct{ Body string }, error) {
 		log.Printf("GET /task/%s/output: token_provided=%t line=%d", input.UUID, input.Token != "", input.Line)
 
 		// Get job metadata to retrieve write path for S3 fallback
-		job, err := a.metadataStore.GetJob(ctx, input.UUID)
+		job, err := a.getJobForCaller(ctx, input.UUID)
 		if err != nil {
 			log.Printf("GET /task/%s/output: failed to retrieve job metadata: %v", input.UUID, err)
 			return nil, huma.NewError(500, "Failed to retrieve job metadata", err)
@@ -1331,6 +1375,11 @@ func (a *API) registerNodeODMRoutes() {
 			return nil, huma.NewError(404, "Task not found")
 		}
 
+		if job.AwaitingDispatch {
+			log.Printf("GET /task/%s/output: task awaiting dispatch, no output yet", input.UUID)
+			return &struct{ Body string }{Body: ""}, nil
+		}
+
 		var logBuilder strings.Builder
 		if job.WriteS3Path != "" {
 			err = a.workflowClient.GetWorkflowLogsWithArchiveFallback(ctx, input.UUID, &logBuilder)
@@ -1369,13 +1418,13 @@ func (a *API) registerNodeODMRoutes() {
 		Tags:        []string{"task"},
 	}, func(ctx context.Context, input *struct {
 		UUID              string `path:"uuid" doc:"UUID of the task"`
-		Token             string `query:"token" doc:"Authentication token (optional)"`
+		Token             string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
 		IncludeAdditional bool   `query:"includeAdditional" default:"false" doc:"Include additional discovered files"`
 		AdditionalLimit   int    `query:"additionalLimit" default:"100" doc:"Maximum number of additional files to return (clamped to 1000)"`
 	}) (*TaskAssetsResponse, error) {
 		log.Printf("GET /task/%s/assets: token_provided=%t includeAdditional=%t additionalLimit=%d", input.UUID, input.Token != "", input.IncludeAdditional, input.AdditionalLimit)
 
-		job, err := a.metadataStore.GetJob(ctx, input.UUID)
+		job, err := a.getJobForCaller(ctx, input.UUID)
 		if err != nil {
 			log.Printf("GET /task/%s/assets: failed to retrieve task metadata: %v", input.UUID, err)
 			return nil, huma.NewError(500, "Failed to retrieve task metadata", err)
@@ -1451,14 +1500,31 @@ func (a *API) registerNodeODMRoutes() {
 		Summary:     "Cancels a task",
 		Tags:        []string{"task"},
 	}, func(ctx context.Context, input *struct {
-		Token string `query:"token" doc:"Authentication token (optional)"`
+		Token string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
 		Body  struct {
 			UUID string `json:"uuid" doc:"UUID of the task"`
 		}
 	}) (*Response, error) {
 		log.Printf("POST /task/cancel: uuid=%q token_provided=%t", input.Body.UUID, input.Token != "")
 
-		err := a.workflowClient.DeleteWorkflow(ctx, input.Body.UUID)
+		if err := a.checkTaskOwner(ctx, "POST /task/cancel", input.Body.UUID); err != nil {
+			return nil, err
+		}
+		ctx = meta.WithActor(ctx, callerActor(ctx), "cancel_requested")
+
+		// A task still in ScaleODM's queue is canceled in place; if the
+		// dispatcher is submitting it right now, it deletes the workflow.
+		canceled, err := a.metadataStore.CancelQueuedJob(ctx, input.Body.UUID)
+		if err != nil {
+			log.Printf("POST /task/cancel: failed to cancel queued task %q: %v", input.Body.UUID, err)
+			return nil, huma.NewError(500, "Failed to cancel task", err)
+		}
+		if canceled {
+			log.Printf("POST /task/cancel: queued task %q canceled before dispatch", input.Body.UUID)
+			return &Response{Success: true}, nil
+		}
+
+		err = a.workflowClient.DeleteWorkflow(ctx, input.Body.UUID)
 		if err != nil {
 			if isNotFound(err) {
 				log.Printf("POST /task/cancel: task %q not found", input.Body.UUID)
@@ -1486,19 +1552,30 @@ func (a *API) registerNodeODMRoutes() {
 		Summary:     "Removes a task and deletes all assets",
 		Tags:        []string{"task"},
 	}, func(ctx context.Context, input *struct {
-		Token string `query:"token" doc:"Authentication token (optional)"`
+		Token string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
 		Body  struct {
 			UUID string `json:"uuid" doc:"UUID of the task"`
 		}
 	}) (*Response, error) {
 		log.Printf("POST /task/remove: uuid=%q token_provided=%t", input.Body.UUID, input.Token != "")
 
+		if err := a.checkTaskOwner(ctx, "POST /task/remove", input.Body.UUID); err != nil {
+			return nil, err
+		}
+		job, err := a.getJobForCaller(ctx, input.Body.UUID)
+		if err != nil {
+			log.Printf("POST /task/remove: failed to retrieve task metadata for %q: %v", input.Body.UUID, err)
+		}
+
 		// Delete from Argo
-		err := a.workflowClient.DeleteWorkflow(ctx, input.Body.UUID)
+		err = a.workflowClient.DeleteWorkflow(ctx, input.Body.UUID)
 		if err != nil && !isNotFound(err) {
 			log.Printf("POST /task/remove: failed to delete workflow for %q: %v", input.Body.UUID, err)
 			return nil, huma.NewError(500, "Failed to remove task", err)
 		}
+		if job != nil {
+			removeSavedProjects(ctx, "POST /task/remove", job)
+		}
 
 		// Delete metadata
 		err = a.metadataStore.DeleteJob(ctx, input.Body.UUID)
@@ -1519,16 +1596,17 @@ func (a *API) registerNodeODMRoutes() {
 		Summary:     "Restarts a task",
 		Tags:        []string{"task"},
 	}, func(ctx context.Context, input *struct {
-		Token string `query:"token" doc:"Authentication token (optional)"`
+		Token string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
 		Body  struct {
-			UUID    string `json:"uuid" doc:"UUID of the task"`
-			Options string `json:"options,omitempty" doc:"New options (optional)"`
+			UUID      string `json:"uuid" doc:"UUID of the task"`
+			Options   string `json:"options,omitempty" doc:"New options (optional)"`
+			RerunFrom string `json:"rerunFrom,omitempty" doc:"ODM stage to rerun from, reusing the rest of the task's saved project (optional; the task must have been created with keepIntermediates). A rerun-from option is taken as this."`
 		}
 	}) (*Response, error) {
-		log.Printf("POST /task/restart: uuid=%q token_provided=%t options_set=%t", input.Body.UUID, input.Token != "", input.Body.Options != "")
+		log.Printf("POST /task/restart: uuid=%q token_provided=%t options_set=%t rerunFrom=%q", input.Body.UUID, input.Token != "", input.Body.Options != "", input.Body.RerunFrom)
 
 		// Get existing task metadata
-		metadata, err := a.metadataStore.GetJob(ctx, input.Body.UUID)
+		metadata, err := a.getJobForCaller(ctx, input.Body.UUID)
 		if err != nil {
 			log.Printf("POST /task/restart: failed to retrieve metadata for %q: %v", input.Body.UUID, err)
 			return nil, huma.NewError(500, "Failed to retrieve task metadata", err)
@@ -1537,17 +1615,30 @@ func (a *API) registerNodeODMRoutes() {
 			return nil, huma.NewError(404, "Task not found")
 		}
 
+		// The image may have left the allowlist since the task was created.
+		odmImage, imageErr := resolveODMImage(metadataODMImage(metadata.Metadata))
+		if imageErr != nil {
+			log.Printf("POST /task/restart: rejected odmImage for %q: %v", input.Body.UUID, imageErr)
+			return nil, huma.NewError(400, imageErr.Error())
+		}
+
 		// Parse new options if provided
 		var odmFlags []string
 		var boundary workflows.BoundarySource
+		rerunFrom := strings.TrimSpace(input.Body.RerunFrom)
 		if input.Body.Options != "" {
 			var options []TaskOption
 			if err := json.Unmarshal([]byte(input.Body.Options), &options); err != nil {
 				log.Printf("POST /task/restart: invalid options JSON for %q: %v", input.Body.UUID, err)
 				return nil, huma.NewError(400, "Invalid options JSON", err)
 			}
-			var flagsErr error
-			odmFlags, boundary, flagsErr = odmFlagsFromOptions(options)
+			var optionRerunFrom string
+			optionRerunFrom, options = rerunFromOption(options)
+			rerunFrom = cmp.Or(rerunFrom, optionRerunFrom)
+			flagsErr := a.checkODMOptions("POST /task/restart", odmImage, options)
+			if flagsErr == nil {
+				odmFlags, boundary, flagsErr = odmFlagsFromOptions(options)
+			}
 			if flagsErr != nil {
 				log.Printf("POST /task/restart: invalid options for %q: %v", input.Body.UUID, flagsErr)
 				return nil, huma.NewError(400, flagsErr.Error())
@@ -1571,10 +1662,34 @@ func (a *API) registerNodeODMRoutes() {
 		log.Printf("POST /task/restart: endpoint selection endpoint=%q allowlist_enforced=%t", s3Endpoint, config.SCALEODM_ENFORCE_S3_ENDPOINT_ALLOWLIST)
 
 		processingMode := metadataProcessingMode(metadata.Metadata)
+		if err := validateMergeOptions(processingMode, odmFlags, boundary); err != nil {
+			return nil, huma.NewError(400, err.Error())
+		}
+		workflowFlags, split, splitOverlap, splitErr := workflows.ParseSplitFlags(odmFlags)
+		if splitErr != nil {
+			return nil, huma.NewError(400, splitErr.Error())
+		}
+		referenceDEMS3Path := metadataReferenceDEMS3Path(metadata.Metadata)
+		if err := validateCityScaleOptions(processingMode, split, referenceDEMS3Path); err != nil {
+			return nil, huma.NewError(400, err.Error())
+		}
+		sidecars, gcpS3Path, geoS3Path := metadataSidecars(metadata.Metadata)
+		if err := validateSidecarOptions(processingMode, gcpS3Path, geoS3Path); err != nil {
+			return nil, huma.NewError(400, err.Error())
+		}
+		keepIntermediates := metadataKeepIntermediates(metadata.Metadata)
+		if rerunFrom != "" {
+			if err := workflows.ValidateRerunFrom(rerunFrom); err != nil {
+				return nil, huma.NewError(400, err.Error())
+			}
+			if !keepIntermediates || !workflows.Resumable(processingMode, split) {
+				return nil, huma.NewError(400, "rerunFrom needs a standard or thermal task without split that was created with keepIntermediates")
+			}
+		}
 		capacityType := metadataCapacityType(metadata.Metadata)
 		userExcludes, _ := metadataExcludePaths(metadata.Metadata)
 		useDefaultExcludes := metadataUseDefaultExcludes(metadata.Metadata)
-		excludePatterns := workflows.ComposeExcludePatterns(useDefaultExcludes, userExcludes)
+		excludePatterns := workflows.ComposeExcludePatternsForMode(processingMode, useDefaultExcludes, userExcludes)
 		s3ScanDepth, depthErr := workflows.ValidateS3ScanDepth(metadataS3ScanDepth(metadata.Metadata))
 		if depthErr != nil {
 			s3ScanDepth = workflows.DefaultS3ScanDepth
@@ -1584,11 +1699,45 @@ func (a *API) registerNodeODMRoutes() {
 		if s3Endpoint != "" {
 			taskClient, taskClientErr = s3.GetS3ClientForEndpoint(s3Endpoint)
 		}
+		if rerunFrom != "" {
+			// The project is saved only when a run of the task uploads its
+			// outputs.
+			saved, err := false, taskClientErr
+			if err == nil {
+				saved, err = s3.ObjectExistsInS3Path(ctx, taskClient, s3.IntermediatesPath(metadata.WriteS3Path), s3.IntermediatesMarker)
+			}
+			if err != nil {
+				log.Printf("POST /task/restart: failed to check the saved project of %q: %v", input.Body.UUID, err)
+				return nil, huma.NewError(500, "Failed to check the task's saved project", err)
+			}
+			if !saved {
+				return nil, huma.NewError(400, "the task has no saved ODM project to rerun from; it is saved when a run with keepIntermediates completes")
+			}
+		}
 
 		imageCount := metadataImageCount(metadata.Metadata)
 		imageTotalBytes := metadataImageTotalBytes(metadata.Metadata)
-		if imageCount == 0 || imageTotalBytes == 0 {
+		largestTaskImages := metadataLargestTaskImages(metadata.Metadata)
+		if processingMode == workflows.ProcessingModeCityScale {
+			if !workflows.IsSharedWorkspace(workflows.DefaultWorkspaceConfig()) {
+				return nil, huma.NewError(400, "city-scale needs a ReadWriteMany workspace PVC shared by every pod; this server is not configured with one")
+			}
+			// Recount so the task pods are sized for the imagery as it is now.
 			if taskClientErr == nil {
+				if tasks, totalBytes, countErr := s3.CountCityScaleTasksInS3Path(ctx, taskClient, metadata.ReadS3Path, excludePatterns, s3ScanDepth); countErr == nil {
+					if counted, largest, statsErr := cityScaleTaskStats(tasks); statsErr == nil {
+						imageCount, largestTaskImages, imageTotalBytes = counted, largest, totalBytes
+					}
+				}
+			}
+		} else if processingMode == workflows.ProcessingModeMergeExisting {
+			if imageTotalBytes == 0 && taskClientErr == nil {
+				if _, totalBytes, countErr := s3.CountMergeInputsInS3Path(ctx, taskClient, metadata.ReadS3Path, metadata.WriteS3Path, excludePatterns, s3ScanDepth); countErr == nil {
+					imageTotalBytes = totalBytes
+				}
+			}
+		} else {
+			if (imageCount == 0 || imageTotalBytes == 0) && taskClientErr == nil {
 				if counted, totalBytes, countErr := s3.CountImageStatsInS3PathWithExcludes(ctx, taskClient, metadata.ReadS3Path, excludePatterns); countErr == nil {
 					if imageCount == 0 {
 						imageCount = counted
@@ -1598,13 +1747,22 @@ func (a *API) registerNodeODMRoutes() {
 					}
 				}
 			}
+			// Sidecar files may have been fixed or added since the task ran.
+			if taskClientErr == nil {
+				found, sidecarErr := taskSidecars(ctx, taskClient, metadata.ReadS3Path, excludePatterns, s3ScanDepth, gcpS3Path, geoS3Path)
+				if sidecarErr != nil {
+					log.Printf("POST /task/restart: sidecar files rejected for %q: %v", input.Body.UUID, sidecarErr)
+					return nil, huma.NewError(400, sidecarErr.Error())
+				}
+				sidecars = found
+			}
 		}
 
 		wfConfig := workflows.NewDefaultODMConfig(
 			metadata.ODMProjectID,
 			metadata.ReadS3Path,
 			metadata.WriteS3Path,
-			odmFlags,
+			workflowFlags,
 		)
 		wfConfig.S3Region = metadata.S3Region
 		wfConfig.S3Endpoint = s3Endpoint
@@ -1612,14 +1770,47 @@ func (a *API) registerNodeODMRoutes() {
 		wfConfig.ImageTotalBytes = imageTotalBytes
 		wfConfig.ProcessingMode = processingMode
 		wfConfig.CapacityType = capacityType
+		wfConfig.ODMImage = odmImage
 		wfConfig.ExcludePaths = excludePatterns
 		wfConfig.S3ScanDepth = s3ScanDepth
 		wfConfig.Boundary = boundary
-
-		wf, err := a.workflowClient.CreateODMWorkflow(ctx, wfConfig)
+		wfConfig.Split = split
+		wfConfig.SplitOverlap = splitOverlap
+		wfConfig.LargestTaskImages = largestTaskImages
+		wfConfig.ReferenceDEMS3Path = referenceDEMS3Path
+		wfConfig.Sidecars = sidecars
+		wfConfig.GCPS3Path = gcpS3Path
+		wfConfig.GeoS3Path = geoS3Path
+		wfConfig.SkipPostProcessing = metadataSkipPostProcessing(metadata.Metadata)
+		wfConfig.KeepIntermediates = keepIntermediates
+		wfConfig.RerunFrom = rerunFrom
+		wfConfig.Tenant = metadata.Tenant
+		// Pick up from the last checkpoint, if the task left one and keeps its
+		// options. A rerun starts from its saved project instead.
+		wfConfig.ResumeCheckpoint = rerunFrom == ""
+
+		workspaceGiB := workflows.EstimateWorkspaceGiB(wfConfig)
+		admission, _, err := a.admitTask(ctx, "POST /task/restart", metadata.Tenant, imageCount, workspaceGiB, metadata)
 		if err != nil {
-			log.Printf("POST /task/restart: failed to create new workflow for %q: %v", input.Body.UUID, err)
-			return nil, huma.NewError(500, "Failed to restart task", err)
+			return nil, err
+		}
+
+		var newWorkflowName string
+		var pipelineConfig json.RawMessage
+		if config.SCALEODM_QUEUE_ENABLED {
+			wfConfig.WorkflowName = workflows.NewWorkflowName()
+			newWorkflowName = wfConfig.WorkflowName
+			if pipelineConfig, err = json.Marshal(wfConfig); err != nil {
+				log.Printf("POST /task/restart: failed to encode pipeline config for %q: %v", input.Body.UUID, err)
+				return nil, huma.NewError(500, "Failed to restart task", err)
+			}
+		} else {
+			wf, err := a.workflowClient.CreateODMWorkflow(ctx, wfConfig)
+			if err != nil {
+				log.Printf("POST /task/restart: failed to create new workflow for %q: %v", input.Body.UUID, err)
+				return nil, huma.NewError(500, "Failed to restart task", err)
+			}
+			newWorkflowName = wf.Name
 		}
 
 		metadataPatch := map[string]interface{}{
@@ -1628,38 +1819,52 @@ func (a *API) registerNodeODMRoutes() {
 			metadataWorkflowMissingFirstSeen: nil,
 			metadataBoundaryGeoJSONKey:       boundary.GeoJSON,
 			metadataBoundaryS3PathKey:        boundary.S3Path,
+			metadataSidecarFilesKey:          sidecars,
+			meta.MetadataWorkspaceGiBKey:     workspaceGiB,
+			metadataRerunFromKey:             nil,
+		}
+		if rerunFrom != "" {
+			metadataPatch[metadataRerunFromKey] = rerunFrom
+		}
+		if largestTaskImages > 0 {
+			metadataPatch[metadataLargestTaskImagesKey] = largestTaskImages
 		}
 		if s3Endpoint != "" {
 			metadataPatch[metadataS3EndpointKey] = s3Endpoint
 		}
 		oldWorkflowName := input.Body.UUID
 		if err := a.metadataStore.RestartJobMetadata(
-			ctx,
+			meta.WithActor(ctx, callerActor(ctx), "restart_requested"),
 			oldWorkflowName,
-			wf.Name,
+			newWorkflowName,
 			metadata.ODMProjectID,
 			metadata.ReadS3Path,
 			metadata.WriteS3Path,
 			odmFlags,
 			metadata.S3Region,
 			metadataPatch,
+			pipelineConfig,
+			admission.admitFunc(),
 		); err != nil {
-			log.Printf("POST /task/restart: failed to swap metadata for %q -> %q: %v", oldWorkflowName, wf.Name, err)
-			if wf.Name != oldWorkflowName {
-				if delErr := a.workflowClient.DeleteWorkflow(ctx, wf.Name); delErr != nil && !isNotFound(delErr) {
-					log.Printf("POST /task/restart: failed cleanup delete of unmanaged workflow %q: %v", wf.Name, delErr)
+			log.Printf("POST /task/restart: failed to swap metadata for %q -> %q: %v", oldWorkflowName, newWorkflowName, err)
+			if pipelineConfig == nil && newWorkflowName != oldWorkflowName {
+				if delErr := a.workflowClient.DeleteWorkflow(ctx, newWorkflowName); delErr != nil && !isNotFound(delErr) {
+					log.Printf("POST /task/restart: failed cleanup delete of unmanaged workflow %q: %v", newWorkflowName, delErr)
 				}
 			}
+			if admission.rejected() {
+				return nil, err
+			}
 			return nil, huma.NewError(500, "Failed to persist restarted task metadata", err)
 		}
 
-		if wf.Name != oldWorkflowName {
+		if newWorkflowName != oldWorkflowName {
 			if err := a.workflowClient.DeleteWorkflow(ctx, oldWorkflowName); err != nil && !isNotFound(err) {
 				log.Printf("POST /task/restart: failed post-cutover cleanup delete of old workflow %q: %v", oldWorkflowName, err)
 			}
 		}
 
-		log.Printf("POST /task/restart: task %q restarted as workflow %q imageCount=%d imageTotalBytes=%d endpoint=%q", oldWorkflowName, wf.Name, imageCount, imageTotalBytes, s3Endpoint)
+		log.Printf("POST /task/restart: task %q restarted as workflow %q queued=%t imageCount=%d imageTotalBytes=%d endpoint=%q rerunFrom=%q", oldWorkflowName, newWorkflowName, pipelineConfig != nil, imageCount, imageTotalBytes, s3Endpoint, rerunFrom)
 		return &Response{Success: true}, nil
 	})
 
@@ -1672,7 +1877,7 @@ func (a *API) registerNodeODMRoutes() {
 		asset := r.PathValue("asset")
 		log.Printf("GET /task/%s/download/%s", uuid, asset)
 
-		metadata, err := a.metadataStore.GetJob(r.Context(), uuid)
+		metadata, err := a.getJobForCaller(r.Context(), uuid)
 		if err != nil {
 			log.Printf("GET /task/%s/download/%s: failed to retrieve metadata: %v", uuid, asset, err)
 			http.Error(w, `{"error":"Failed to retrieve task metadata"}`, http.StatusInternalServerError)
@@ -1729,25 +1934,7 @@ func (a *API) registerNodeODMRoutes() {
 		}
 
 		if requestedAsset == "all.zip" {
-			var zipBuffer bytes.Buffer
-			written, streamErr := s3.StreamS3PathAsZip(r.Context(), s3Client, metadata.WriteS3Path, &zipBuffer)
-			if streamErr != nil {
-				if streamErr == s3.ErrNoObjectsToZip {
-					log.Printf("GET /task/%s/download/%s: no output objects found for synthetic all.zip", uuid, requestedAsset)
-					http.Error(w, fmt.Sprintf(`{"error":"File not found: %s"}`, requestedAsset), http.StatusNotFound)
-					return
-				}
-				log.Printf("GET /task/%s/download/%s: failed to stream synthetic all.zip: %v", uuid, requestedAsset, streamErr)
-				http.Error(w, `{"error":"Failed to stream task output"}`, http.StatusInternalServerError)
-				return
-			}
-			w.Header().Set("Content-Type", "application/zip")
-			w.Header().Set("Content-Disposition", `attachment; filename="all.zip"`)
-			if _, writeErr := zipBuffer.WriteTo(w); writeErr != nil {
-				log.Printf("GET /task/%s/download/%s: failed to write synthetic all.zip response: %v", uuid, requestedAsset, writeErr)
-				return
-			}
-			log.Printf("GET /task/%s/download/%s: streamed synthetic all.zip with %d entries", uuid, requestedAsset, written)
+			a.serveOutputZip(w, r, uuid, metadata.WriteS3Path, s3Client)
 			return
 		}
 
@@ -1758,6 +1945,584 @@ func (a *API) registerNodeODMRoutes() {
 
 // Helper functions
 
+// createTask validates a task creation request (see planTask), submits the
+// workflow and records its metadata. It backs both POST /task/new and the chunked upload
+// commit, so the two stay behaviourally identical. reason is the metric label
+// describing the outcome; route prefixes log lines.
+func (a *API) createTask(ctx context.Context, route string, req TaskNewRequest, identity taskIdentity) (string, string, error) {
+	reason := "unknown"
+
+	// A repeat of an earlier request gets the task that request created.
+	fingerprint := identity.fingerprint(req)
+	if existing, err := a.replayTask(ctx, identity, fingerprint); err != nil || existing != "" {
+		if err != nil {
+			reason = "idempotency_key_conflict"
+			log.Printf("%s: rejected Idempotency-Key=%q: %v", route, identity.IdempotencyKey, err)
+			return "", reason, err
+		}
+		log.Printf("%s: Idempotency-Key=%q repeats the request that created task %q", route, identity.IdempotencyKey, existing)
+		return existing, "idempotent_replay", nil
+	}
+	if identity.UUID != "" {
+		if err := a.checkTaskUUIDFree(ctx, identity.UUID); err != nil {
+			reason = "task_uuid_taken"
+			log.Printf("%s: rejected set-uuid=%q: %v", route, identity.UUID, err)
+			return "", reason, err
+		}
+	}
+
+	plan, reason, err := a.planTask(ctx, route, req)
+	if err != nil {
+		return "", reason, err
+	}
+	wfConfig := plan.config
+
+	// Submit workflow to Argo, or queue it for the dispatcher with its name
+	// fixed up front so the caller gets the task UUID straight away.
+	var workflowName string
+	var pipelineConfig json.RawMessage
+	wfConfig.WorkflowName = identity.UUID
+	if config.SCALEODM_QUEUE_ENABLED {
+		if wfConfig.WorkflowName == "" {
+			wfConfig.WorkflowName = workflows.NewWorkflowName()
+		}
+		workflowName = wfConfig.WorkflowName
+		if pipelineConfig, err = json.Marshal(wfConfig); err != nil {
+			reason = "pipeline_config_encode_failed"
+			log.Printf("%s: failed to encode pipeline config: %v", route, err)
+			return "", reason, huma.NewError(500, "Failed to queue task", err)
+		}
+		log.Printf("workflow queued workflow=%q project_id=%q priority=%d", workflowName, wfConfig.ODMProjectID, req.Priority)
+	} else {
+		wf, err := a.workflowClient.CreateODMWorkflow(ctx, wfConfig)
+		if k8serrors.IsAlreadyExists(err) {
+			reason = "task_uuid_taken"
+			log.Printf("%s: workflow %q already exists", route, wfConfig.WorkflowName)
+			return "", reason, huma.NewError(409, fmt.Sprintf("a task with uuid %s already exists", wfConfig.WorkflowName))
+		}
+		if err != nil {
+			reason = "argo_create_failed"
+			log.Printf("workflow creation rejected reason=argo_create_failed project_id=%q error=%v", wfConfig.ODMProjectID, err)
+			return "", reason, huma.NewError(500, "Failed to create workflow", err)
+		}
+		workflowName = wf.Name
+		log.Printf("workflow creation accepted workflow=%q project_id=%q", workflowName, wfConfig.ODMProjectID)
+	}
+
+	log.Printf(
+		"%s: created workflow name=%q projectID=%q readPath=%q writePath=%q odmFlags=%v s3Region=%q imageCount=%d imageTotalBytes=%d endpoint=%q",
+		route,
+		workflowName,
+		wfConfig.ODMProjectID,
+		wfConfig.ReadS3Path,
+		wfConfig.WriteS3Path,
+		plan.odmFlags,
+		wfConfig.S3Region,
+		wfConfig.ImageCount,
+		wfConfig.ImageTotalBytes,
+		wfConfig.S3Endpoint,
+	)
+
+	// Record metadata in database. If this fails, the workflow exists in
+	// Argo but won't be visible via the API - treat as a hard error so the
+	// caller knows to retry rather than losing track of the workflow.
+	_, err = a.metadataStore.InsertJob(meta.WithActor(ctx, callerActor(ctx), ""), meta.NewJob{
+		Tenant:       wfConfig.Tenant,
+		WorkflowName: workflowName,
+		ProjectID:    wfConfig.ODMProjectID,
+		ReadPath:     wfConfig.ReadS3Path,
+		WritePath:    wfConfig.WriteS3Path,
+		ODMFlags:     plan.odmFlags,
+		S3Region:     wfConfig.S3Region,
+		// Save the boundary with the job so restarts cannot lose it, and the
+		// workspace size so quota usage counts it from the start.
+		Metadata: map[string]any{
+			metadataBoundaryGeoJSONKey:        wfConfig.Boundary.GeoJSON,
+			metadataBoundaryS3PathKey:         wfConfig.Boundary.S3Path,
+			metadataReferenceDEMS3PathKey:     wfConfig.ReferenceDEMS3Path,
+			metadataGCPS3PathKey:              wfConfig.GCPS3Path,
+			metadataGeoS3PathKey:              wfConfig.GeoS3Path,
+			metadataODMImageKey:               wfConfig.ODMImage,
+			metadataSkipPostProcessingKey:     req.SkipPostProcessing,
+			metadataKeepIntermediatesKey:      req.KeepIntermediates,
+			meta.MetadataWorkspaceGiBKey:      plan.workspaceGiB,
+			metadataIdempotencyFingerprintKey: fingerprint,
+		},
+		Priority:       req.Priority,
+		JobType:        plan.jobType,
+		PipelineConfig: pipelineConfig,
+		IdempotencyKey: identity.IdempotencyKey,
+		Admit:          plan.admission.admitFunc(),
+	})
+	if err != nil {
+		reason = "metadata_create_failed"
+		if plan.admission.rejected() {
+			reason = plan.admission.reason
+		}
+		if pipelineConfig == nil {
+			log.Printf("workflow created but metadata update failed workflow=%q reason=%s error=%v", workflowName, reason, err)
+			if rollbackErr := a.workflowClient.DeleteWorkflow(ctx, workflowName); rollbackErr != nil && !isNotFound(rollbackErr) {
+				log.Printf("%s: failed cleanup delete of unmanaged workflow %q after metadata create failure: %v", route, workflowName, rollbackErr)
+			} else {
+				log.Printf("%s: compensated orphan workflow %q after metadata create failure", route, workflowName)
+			}
+		}
+		if plan.admission.rejected() {
+			return "", reason, err
+		}
+		if errors.Is(err, meta.ErrDuplicateJob) {
+			// A concurrent request with the same set-uuid or Idempotency-Key
+			// recorded its task first.
+			if existing, replayErr := a.replayTask(ctx, identity, fingerprint); replayErr != nil || existing != "" {
+				if replayErr != nil {
+					return "", "idempotency_key_conflict", replayErr
+				}
+				log.Printf("%s: Idempotency-Key=%q raced the request that created task %q", route, identity.IdempotencyKey, existing)
+				return existing, "idempotent_replay", nil
+			}
+			return "", "task_uuid_taken", huma.NewError(409, fmt.Sprintf("a task with uuid %s already exists", workflowName))
+		}
+		if pipelineConfig != nil {
+			log.Printf("%s: failed to queue task workflow=%q: %v", route, workflowName, err)
+			return "", reason, huma.NewError(500, "Failed to queue task - retry the request", err)
+		}
+		return "", reason, huma.NewError(500, "Workflow created but failed to record metadata - retry the request", err)
+	}
+
+	metadataUpdates := map[string]interface{}{
+		metadataImageCountKey:            wfConfig.ImageCount,
+		metadataImageTotalBytesKey:       wfConfig.ImageTotalBytes,
+		metadataWorkflowMissingFirstSeen: nil,
+		metadataProcessingModeKey:        wfConfig.ProcessingMode,
+		metadataCapacityTypeKey:          plan.capacityType,
+		metadataExcludePathsKey:          plan.userExcludes,
+		metadataUseDefaultExcludesKey:    plan.useDefaultExcludes,
+		metadataS3ScanDepthKey:           wfConfig.S3ScanDepth,
+	}
+	if wfConfig.S3Endpoint != "" {
+		metadataUpdates[metadataS3EndpointKey] = wfConfig.S3Endpoint
+	}
+	if plan.mergeInputCount > 0 {
+		metadataUpdates[metadataMergeInputCountKey] = plan.mergeInputCount
+	}
+	if len(wfConfig.Sidecars) > 0 {
+		metadataUpdates[metadataSidecarFilesKey] = wfConfig.Sidecars
+	}
+	if plan.cityScaleTaskCount > 0 {
+		metadataUpdates[metadataCityScaleTaskCountKey] = plan.cityScaleTaskCount
+		metadataUpdates[metadataLargestTaskImagesKey] = wfConfig.LargestTaskImages
+	}
+	if plan.imagery != nil {
+		metadataUpdates[metadataImageryInspectionKey] = plan.imagery
+	}
+	// Persist the webhook URL; a terminal status update queues its delivery
+	if strings.TrimSpace(req.Webhook) != "" {
+		metadataUpdates[meta.MetadataWebhookKey] = req.Webhook
+	}
+	if metaErr := a.metadataStore.MergeJobMetadata(ctx, workflowName, metadataUpdates); metaErr != nil {
+		log.Printf("workflow created but metadata enrichment failed workflow=%q reason=metadata_enrichment_failed error=%v", workflowName, metaErr)
+	}
+
+	return workflowName, "none", nil
+}
+
+// taskPlan is a validated task creation request, resolved to the pipeline
+// config it runs as.
+type taskPlan struct {
+	config *workflows.ODMPipelineConfig
+	// odmFlags are the requested flags, split options included, as stored
+	// with the job for restarts.
+	odmFlags []string
+	// capacityType is the requested capacity; the on-demand upgrade is
+	// applied to config when the workflow is rendered.
+	capacityType       string
+	jobType            string
+	workspaceGiB       float64
+	userExcludes       []string
+	useDefaultExcludes bool
+	mergeInputCount    int
+	cityScaleTaskCount int
+	// imagery is the inspection report of a standard or thermal task's
+	// imagery; nil when inspection is off.
+	imagery *ImageryReport
+	// admission re-checks the quota as the job is recorded.
+	admission *quotaAdmission
+}
+
+// planTask runs every check of a task creation request, counts its imagery
+// and builds its pipeline config, without submitting or recording anything.
+// It backs POST /task/new and POST /task/plan alike. reason is the metric
+// label describing the outcome.
+func (a *API) planTask(ctx context.Context, route string, req TaskNewRequest) (*taskPlan, string, error) {
+	reason := "unknown"
+	span := trace.SpanFromContext(ctx)
+
+	// Resolve processing mode + compose exclude list before doing any
+	// expensive work. Reserved modes get 501 so clients can probe support.
+	processingMode := req.ProcessingMode
+	if processingMode == "" {
+		processingMode = workflows.ProcessingModeStandard
+	}
+	if workflows.IsReservedProcessingMode(processingMode) {
+		reason = "processing_mode_not_implemented"
+		log.Printf("%s: processingMode=%q is reserved but not yet implemented", route, processingMode)
+		return nil, reason, huma.NewError(501, fmt.Sprintf("processingMode %q is reserved for a future pipeline and is not yet implemented", processingMode))
+	}
+	if !workflows.IsImplementedProcessingMode(processingMode) {
+		reason = "invalid_processing_mode"
+		log.Printf("%s: invalid processingMode=%q", route, processingMode)
+		return nil, reason, huma.NewError(400, fmt.Sprintf("invalid processingMode %q (supported: standard, merge-existing, thermal, city-scale)", processingMode))
+	}
+	if processingMode == workflows.ProcessingModeCityScale && !workflows.IsSharedWorkspace(workflows.DefaultWorkspaceConfig()) {
+		reason = "workspace_not_shared"
+		log.Printf("%s: city-scale requested without a ReadWriteMany workspace", route)
+		return nil, reason, huma.NewError(400, "city-scale needs a ReadWriteMany workspace PVC shared by every pod; this server is not configured with one")
+	}
+
+	capacityType := req.CapacityType
+	if capacityType == "" {
+		capacityType = config.SCALEODM_WORKFLOW_CAPACITY_TYPE
+	}
+	if !workflows.IsValidCapacityType(capacityType) {
+		reason = "invalid_capacity_type"
+		log.Printf("%s: invalid capacityType=%q", route, capacityType)
+		return nil, reason, huma.NewError(400, fmt.Sprintf("invalid capacityType %q (supported: spot, on-demand)", capacityType))
+	}
+
+	if req.Priority < minTaskPriority || req.Priority > maxTaskPriority {
+		reason = "invalid_priority"
+		log.Printf("%s: invalid priority=%d", route, req.Priority)
+		return nil, reason, huma.NewError(400, fmt.Sprintf("priority must be between %d and %d", minTaskPriority, maxTaskPriority))
+	}
+
+	odmImage, imageErr := resolveODMImage(req.OdmImage)
+	if imageErr != nil {
+		reason = "invalid_odm_image"
+		log.Printf("%s: rejected odmImage=%q", route, req.OdmImage)
+		return nil, reason, huma.NewError(400, imageErr.Error())
+	}
+
+	s3ScanDepth := 0
+	if req.S3ScanDepth != nil {
+		s3ScanDepth = *req.S3ScanDepth
+	} else if processingMode == workflows.ProcessingModeMergeExisting || processingMode == workflows.ProcessingModeCityScale {
+		// Task outputs and imagery sit several levels below a project root.
+		s3ScanDepth = workflows.MaxS3ScanDepth
+	}
+	s3ScanDepth, err := workflows.ValidateS3ScanDepth(s3ScanDepth)
+	if err != nil {
+		reason = "invalid_s3_scan_depth"
+		log.Printf("%s: invalid s3ScanDepth: %v", route, err)
+		return nil, reason, huma.NewError(400, err.Error())
+	}
+
+	var userExcludes []string
+	if strings.TrimSpace(req.ExcludePaths) != "" {
+		if err := json.Unmarshal([]byte(req.ExcludePaths), &userExcludes); err != nil {
+			reason = "invalid_exclude_paths"
+			log.Printf("%s: invalid excludePaths JSON: %v", route, err)
+			return nil, reason, huma.NewError(400, "Invalid excludePaths JSON (expected an array of strings)", err)
+		}
+		for _, p := range userExcludes {
+			if err := workflows.ValidateExcludePattern(p); err != nil {
+				reason = "invalid_exclude_pattern"
+				log.Printf("%s: invalid exclude pattern %q: %v", route, p, err)
+				return nil, reason, huma.NewError(400, fmt.Sprintf("invalid exclude pattern %q: %s", p, err.Error()))
+			}
+		}
+	}
+
+	useDefaultExcludes := true
+	if req.UseDefaultExcludes != nil {
+		useDefaultExcludes = *req.UseDefaultExcludes
+	}
+	excludePatterns := workflows.ComposeExcludePatternsForMode(processingMode, useDefaultExcludes, userExcludes)
+
+	// Parse options if provided
+	var options []TaskOption
+	var odmFlags []string
+	var boundary workflows.BoundarySource
+	if req.Options != "" {
+		if err := json.Unmarshal([]byte(req.Options), &options); err != nil {
+			reason = "invalid_options"
+			span.AddEvent("task.new.rejected", trace.WithAttributes(attribute.String("reason", reason)))
+			log.Printf("%s: invalid options JSON: %v", route, err)
+			return nil, reason, huma.NewError(400, "Invalid options JSON", err)
+		}
+
+		// Check options against the image's catalog, then convert them to ODM flags
+		flagsErr := a.checkODMOptions(route, odmImage, options)
+		if flagsErr == nil {
+			odmFlags, boundary, flagsErr = odmFlagsFromOptions(options)
+		}
+		if flagsErr != nil {
+			reason = "invalid_options"
+			span.AddEvent("task.new.rejected", trace.WithAttributes(attribute.String("reason", reason)))
+			log.Printf("%s: invalid options: %v", route, flagsErr)
+			return nil, reason, huma.NewError(400, flagsErr.Error())
+		}
+	}
+	if err := validateMergeOptions(processingMode, odmFlags, boundary); err != nil {
+		reason = "invalid_options"
+		log.Printf("%s: %v", route, err)
+		return nil, reason, huma.NewError(400, err.Error())
+	}
+	// split/split-overlap drive the pipeline shape rather than passing
+	// straight through to ODM; the stored flags keep them for restarts.
+	workflowFlags, split, splitOverlap, splitErr := workflows.ParseSplitFlags(odmFlags)
+	if splitErr != nil {
+		reason = "invalid_options"
+		log.Printf("%s: %v", route, splitErr)
+		return nil, reason, huma.NewError(400, splitErr.Error())
+	}
+	referenceDEMS3Path := strings.TrimSpace(req.ReferenceDEMS3Path)
+	if err := validateCityScaleOptions(processingMode, split, referenceDEMS3Path); err != nil {
+		reason = "invalid_options"
+		log.Printf("%s: %v", route, err)
+		return nil, reason, huma.NewError(400, err.Error())
+	}
+	gcpS3Path := strings.TrimSpace(req.GCPS3Path)
+	geoS3Path := strings.TrimSpace(req.GeoS3Path)
+	if err := validateSidecarOptions(processingMode, gcpS3Path, geoS3Path); err != nil {
+		reason = "invalid_options"
+		log.Printf("%s: %v", route, err)
+		return nil, reason, huma.NewError(400, err.Error())
+	}
+	if req.KeepIntermediates && !workflows.Resumable(processingMode, split) {
+		reason = "invalid_options"
+		return nil, reason, huma.NewError(400, "keepIntermediates is only supported for standard and thermal tasks without split")
+	}
+
+	// Determine read and write paths
+	var readPath, writePath string
+
+	// New API: prefer readS3Path/writeS3Path
+	if req.ReadS3Path != "" {
+		readPath = strings.TrimSuffix(req.ReadS3Path, "/") + "/"
+		if req.WriteS3Path != "" {
+			writePath = strings.TrimSuffix(req.WriteS3Path, "/") + "/"
+		} else {
+			// Default: write to output subdirectory in read path
+			writePath = strings.TrimSuffix(req.ReadS3Path, "/") + "/output/"
+		}
+	} else if req.ZipURL != "" {
+		// Legacy support: zipurl parameter
+		isS3Prefix := strings.HasPrefix(req.ZipURL, "s3://")
+		isHTTPZip := strings.HasPrefix(req.ZipURL, "http://") || strings.HasPrefix(req.ZipURL, "https://")
+
+		if !isS3Prefix && !isHTTPZip {
+			reason = "invalid_zipurl"
+			log.Printf("%s: invalid zipurl=%q (must be s3:// or http(s) zip URL)", route, req.ZipURL)
+			return nil, reason, huma.NewError(400, "zipurl must be an s3://... prefix or a http(s) zip URL")
+		}
+
+		if isS3Prefix {
+			readPath = strings.TrimSuffix(req.ZipURL, "/") + "/"
+			writePath = strings.TrimSuffix(req.ZipURL, "/") + "-output/"
+		} else {
+			// HTTP zip - not supported for S3 read/write workflow
+			reason = "http_zip_not_supported"
+			log.Printf("%s: HTTP zip URLs not supported zipurl=%q", route, req.ZipURL)
+			return nil, reason, huma.NewError(400, "HTTP zip URLs not supported. Use readS3Path for S3-based processing")
+		}
+	} else {
+		reason = "missing_read_path"
+		log.Printf("%s: missing required readS3Path or zipurl", route)
+		return nil, reason, huma.NewError(400, "readS3Path is required (or zipurl for legacy support)")
+	}
+
+	// Validate S3 paths
+	if !strings.HasPrefix(readPath, "s3://") {
+		reason = "invalid_read_path"
+		log.Printf("%s: readPath must be s3:// path, got %q", route, readPath)
+		return nil, reason, huma.NewError(400, "readS3Path must be an s3:// path")
+	}
+	if !strings.HasPrefix(writePath, "s3://") {
+		reason = "invalid_write_path"
+		log.Printf("%s: writePath must be s3:// path, got %q", route, writePath)
+		return nil, reason, huma.NewError(400, "writeS3Path must be an s3:// path")
+	}
+
+	projectID := req.Name
+	if projectID == "" {
+		projectID = meta.DefaultProjectID
+	}
+
+	// Validate all values that will be embedded in shell scripts
+	if err := validateShellSafe(projectID, "name"); err != nil {
+		reason = "invalid_project_name"
+		return nil, reason, huma.NewError(400, err.Error())
+	}
+	for _, flag := range odmFlags {
+		if err := validateShellSafe(flag, "options flag"); err != nil {
+			reason = "invalid_option_flag"
+			return nil, reason, huma.NewError(400, err.Error())
+		}
+	}
+	if err := validateShellSafe(readPath, "readS3Path"); err != nil {
+		reason = "invalid_read_path"
+		return nil, reason, huma.NewError(400, err.Error())
+	}
+	if err := validateShellSafe(writePath, "writeS3Path"); err != nil {
+		reason = "invalid_write_path"
+		return nil, reason, huma.NewError(400, err.Error())
+	}
+
+	// Determine S3 region & optional endpoint
+	s3Region := req.S3Region
+	s3Endpoint, err := normalizeOptionalS3Endpoint(req.S3Endpoint)
+	if err != nil {
+		reason = "invalid_s3_endpoint"
+		return nil, reason, huma.NewError(400, "Invalid s3Endpoint", err)
+	}
+	if err := enforceEndpointAllowlist(s3Endpoint); err != nil {
+		reason = "invalid_s3_endpoint"
+		return nil, reason, huma.NewError(400, "Invalid s3Endpoint", err)
+	}
+	if s3Region == "" {
+		if s3Endpoint != "" {
+			s3Region = "garage"
+		} else {
+			s3Region = "us-east-1"
+		}
+	}
+	log.Printf("%s: endpoint selection endpoint=%q region=%q allowlist_enforced=%t", route, s3Endpoint, s3Region, config.SCALEODM_ENFORCE_S3_ENDPOINT_ALLOWLIST)
+
+	// Count images before workflow submission so resources can be sized.
+	taskClient, clientErr := s3.GetS3ClientForEndpoint(config.AWS_S3_ENDPOINT)
+	if s3Endpoint != "" {
+		taskClient, clientErr = s3.GetS3ClientForEndpoint(s3Endpoint)
+	}
+	if clientErr != nil {
+		reason = "s3_client_init_failed"
+		log.Printf("%s: failed to construct S3 client for image counting endpoint=%q: %v", route, s3Endpoint, clientErr)
+		return nil, reason, huma.NewError(500, "Failed to initialize S3 client", clientErr)
+	}
+	var imageCount, mergeInputCount, cityScaleTaskCount, largestTaskImages int
+	var imageTotalBytes int64
+	var sidecars []string
+	var imageryReport *ImageryReport
+	jobType := meta.JobTypeStandard
+	if processingMode == workflows.ProcessingModeCityScale {
+		jobType = meta.JobTypeCityScale
+		tasks, totalBytes, countErr := s3.CountCityScaleTasksInS3Path(ctx, taskClient, readPath, excludePatterns, s3ScanDepth)
+		if countErr != nil {
+			reason = "image_count_failed"
+			log.Printf("%s: failed to count images for readPath=%q endpoint=%q: %v", route, readPath, s3Endpoint, countErr)
+			return nil, reason, huma.NewError(400, "Unable to read imagery from readS3Path", countErr)
+		}
+		if imageCount, largestTaskImages, countErr = cityScaleTaskStats(tasks); countErr != nil {
+			reason = "invalid_city_scale_tasks"
+			log.Printf("%s: %v readPath=%q", route, countErr, readPath)
+			return nil, reason, huma.NewError(400, countErr.Error())
+		}
+		cityScaleTaskCount = len(tasks)
+		imageTotalBytes = totalBytes
+	} else if processingMode == workflows.ProcessingModeMergeExisting {
+		// Merge tasks are sized by the products they download, not images.
+		jobType = meta.JobTypeMerge
+		if readPath == writePath {
+			reason = "invalid_write_path"
+			return nil, reason, huma.NewError(400, "writeS3Path must differ from readS3Path in merge-existing mode")
+		}
+		var countErr error
+		mergeInputCount, imageTotalBytes, countErr = s3.CountMergeInputsInS3Path(ctx, taskClient, readPath, writePath, excludePatterns, s3ScanDepth)
+		if countErr != nil {
+			reason = "merge_input_count_failed"
+			log.Printf("%s: failed to list task outputs for readPath=%q endpoint=%q: %v", route, readPath, s3Endpoint, countErr)
+			return nil, reason, huma.NewError(400, "Unable to read task outputs from readS3Path", countErr)
+		}
+		if mergeInputCount < minMergeInputs {
+			reason = "insufficient_merge_inputs"
+			log.Printf("%s: found %d task outputs under readPath=%q", route, mergeInputCount, readPath)
+			return nil, reason, huma.NewError(400, fmt.Sprintf("merge-existing needs at least %d completed task outputs under readS3Path (found %d)", minMergeInputs, mergeInputCount))
+		}
+	} else {
+		var countErr error
+		imageCount, imageTotalBytes, countErr = s3.CountImageStatsInS3PathWithExcludes(ctx, taskClient, readPath, excludePatterns)
+		if countErr != nil {
+			reason = "image_count_failed"
+			log.Printf("%s: failed to count images for readPath=%q endpoint=%q: %v", route, readPath, s3Endpoint, countErr)
+			return nil, reason, huma.NewError(400, "Unable to read imagery from readS3Path", countErr)
+		}
+		var sidecarErr error
+		sidecars, sidecarErr = taskSidecars(ctx, taskClient, readPath, excludePatterns, s3ScanDepth, gcpS3Path, geoS3Path)
+		if sidecarErr != nil {
+			reason = "invalid_sidecar"
+			log.Printf("%s: sidecar files rejected readPath=%q endpoint=%q: %v", route, readPath, s3Endpoint, sidecarErr)
+			return nil, reason, huma.NewError(400, sidecarErr.Error())
+		}
+		if config.SCALEODM_IMAGERY_INSPECTION != imageryInspectionOff {
+			report, inspectErr := inspectImagery(ctx, taskClient, readPath, excludePatterns)
+			if inspectErr != nil {
+				reason = "imagery_inspection_failed"
+				log.Printf("%s: failed to inspect imagery readPath=%q endpoint=%q: %v", route, readPath, s3Endpoint, inspectErr)
+				return nil, reason, huma.NewError(400, "Unable to read imagery from readS3Path", inspectErr)
+			}
+			if report.HasErrors() && config.SCALEODM_IMAGERY_INSPECTION == imageryInspectionReject {
+				reason = "imagery_rejected"
+				log.Printf("%s: imagery rejected readPath=%q issues=%d", route, readPath, len(report.Issues))
+				return nil, reason, huma.NewError(400, imageryRejection(report))
+			}
+			resp := toImageryReport(report, time.Now())
+			imageryReport = &resp
+		}
+	}
+
+	// S3 credentials are configured at the server level and injected into
+	// workflow pods via Kubernetes Secret references (secretKeyRef).
+	// No per-request credential handling needed.
+	wfConfig := workflows.NewDefaultODMConfig(
+		projectID,
+		readPath,
+		writePath,
+		workflowFlags,
+	)
+	wfConfig.S3Region = s3Region
+	wfConfig.S3Endpoint = s3Endpoint
+	wfConfig.ImageCount = imageCount
+	wfConfig.ImageTotalBytes = imageTotalBytes
+	wfConfig.ProcessingMode = processingMode
+	wfConfig.CapacityType = capacityType
+	wfConfig.ODMImage = odmImage
+	wfConfig.ExcludePaths = excludePatterns
+	wfConfig.S3ScanDepth = s3ScanDepth
+	wfConfig.Boundary = boundary
+	wfConfig.Split = split
+	wfConfig.SplitOverlap = splitOverlap
+	wfConfig.LargestTaskImages = largestTaskImages
+	wfConfig.ReferenceDEMS3Path = referenceDEMS3Path
+	wfConfig.Sidecars = sidecars
+	wfConfig.GCPS3Path = gcpS3Path
+	wfConfig.GeoS3Path = geoS3Path
+	wfConfig.SkipPostProcessing = req.SkipPostProcessing
+	wfConfig.KeepIntermediates = req.KeepIntermediates
+	wfConfig.Tenant = auth.TenantFromContext(ctx)
+	if wfConfig.IsSplitMerge() {
+		jobType = meta.JobTypeSplitMerge
+	}
+
+	workspaceGiB := workflows.EstimateWorkspaceGiB(wfConfig)
+	admission, quotaReason, err := a.admitTask(ctx, route, wfConfig.Tenant, imageCount, workspaceGiB, nil)
+	if err != nil {
+		return nil, quotaReason, err
+	}
+
+	return &taskPlan{
+		config:             wfConfig,
+		odmFlags:           odmFlags,
+		capacityType:       capacityType,
+		jobType:            jobType,
+		workspaceGiB:       workspaceGiB,
+		userExcludes:       userExcludes,
+		useDefaultExcludes: useDefaultExcludes,
+		mergeInputCount:    mergeInputCount,
+		cityScaleTaskCount: cityScaleTaskCount,
+		imagery:            imageryReport,
+		admission:          admission,
+	}, "none", nil
+}
+
 func workflowToStatusCode(phase wfv1.WorkflowPhase) int {
 	switch phase {
 	case wfv1.WorkflowPending:
@@ -1773,21 +2538,6 @@ func workflowToStatusCode(phase wfv1.WorkflowPhase) int {
 	}
 }
 
-func workflowToProgress(phase wfv1.WorkflowPhase) int {
-	switch phase {
-	case wfv1.WorkflowPending:
-		return 0
-	case wfv1.WorkflowRunning:
-		return 50
-	case wfv1.WorkflowSucceeded:
-		return 100
-	case wfv1.WorkflowFailed, wfv1.WorkflowError:
-		return 0
-	default:
-		return 0
-	}
-}
-
 // jobStatusToProgress provides a coarse progress estimate based solely on the
 // stored job status.
 func jobStatusToProgress(status string) int {
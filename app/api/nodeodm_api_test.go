@@ -10,6 +10,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -17,6 +18,7 @@ import (
 	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
 	"github.com/hotosm/scaleodm/app/config"
 	"github.com/hotosm/scaleodm/app/meta"
+	"github.com/hotosm/scaleodm/app/odmoptions"
 	"github.com/hotosm/scaleodm/app/s3"
 	"github.com/hotosm/scaleodm/app/version"
 	"github.com/hotosm/scaleodm/app/workflows"
@@ -186,19 +188,19 @@ func TestTaskNew_RejectsInvalidS3ScanDepth(t *testing.T) {
 	}
 }
 
-func TestTaskNew_RejectsReservedProcessingMode(t *testing.T) {
-	db, cleanup := testDB(t)
-	defer cleanup()
-
-	metadataStore := meta.NewStore(db)
-	wfClient := testWorkflowClient(t)
-	_, handler := NewAPI(metadataStore, wfClient)
+func TestTaskNew_RejectsInvalidSplitOptions(t *testing.T) {
+	wfClient := &recordingWorkflowClient{}
+	_, handler := NewAPI(nil, wfClient)
 
-	for _, mode := range []string{"merge-existing", "thermal", "city-scale"} {
-		t.Run(mode, func(t *testing.T) {
+	for _, options := range []string{
+		`[{"name":"split","value":1}]`,
+		`[{"name":"split","value":"many"}]`,
+		`[{"name":"split-overlap","value":100}]`,
+	} {
+		t.Run(options, func(t *testing.T) {
 			body, err := json.Marshal(TaskNewRequest{
-				ReadS3Path:     "s3://test-bucket/images/",
-				ProcessingMode: mode,
+				ReadS3Path: "s3://test-bucket/images/",
+				Options:    options,
 			})
 			require.NoError(t, err)
 
@@ -207,10 +209,86 @@ func TestTaskNew_RejectsReservedProcessingMode(t *testing.T) {
 			w := httptest.NewRecorder()
 			handler.ServeHTTP(w, req)
 
-			assert.Equal(t, http.StatusNotImplemented, w.Code)
-			assert.Contains(t, w.Body.String(), "reserved")
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), "split")
+		})
+	}
+	assert.Empty(t, wfClient.createdNames)
+}
+
+func TestTaskNew_RejectsInvalidSidecarPaths(t *testing.T) {
+	wfClient := &recordingWorkflowClient{}
+	_, handler := NewAPI(nil, wfClient)
+
+	for name, tc := range map[string]struct {
+		req  TaskNewRequest
+		want string
+	}{
+		"gcp not s3":    {TaskNewRequest{GCPS3Path: "https://example.com/gcp_list.txt"}, "gcpS3Path must be an s3:// path"},
+		"geo is prefix": {TaskNewRequest{GeoS3Path: "s3://test-bucket/survey/"}, "geoS3Path must name an object"},
+		"gcp in merge": {
+			TaskNewRequest{GCPS3Path: "s3://test-bucket/gcp_list.txt", ProcessingMode: "merge-existing"},
+			"gcpS3Path is not supported in merge-existing mode",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tc.req.ReadS3Path = "s3://test-bucket/images/"
+			body, err := json.Marshal(tc.req)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/task/new", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tc.want)
 		})
 	}
+	assert.Empty(t, wfClient.createdNames)
+}
+
+func TestTaskNew_RejectsInvalidOptions(t *testing.T) {
+	wfClient := &recordingWorkflowClient{}
+	apiObj, handler := NewAPI(nil, wfClient)
+	apiObj.odmOptions.Add(odmoptions.NewCatalog(config.SCALEODM_ODM_IMAGE, []odmoptions.Option{
+		{Name: "dsm", Type: odmoptions.TypeBool, Value: "false", Domain: "bool"},
+		{Name: "orthophoto-resolution", Type: odmoptions.TypeFloat, Value: "5", Domain: "float > 0.0"},
+		{Name: "pc-quality", Type: odmoptions.TypeEnum, Value: "medium", Choices: []string{"high", "medium"}},
+	}))
+
+	for name, tc := range map[string]struct {
+		options string
+		want    string
+	}{
+		"typo":         {`[{"name":"orthophoto-resolutoin","value":2}]`, `unknown option \"orthophoto-resolutoin\" (did you mean \"orthophoto-resolution\"?)`},
+		"out of range": {`[{"name":"orthophoto-resolution","value":0}]`, "expected float \u003e 0.0, got 0"},
+		"bad choice":   {`[{"name":"dsm","value":true},{"name":"pc-quality","value":"best"}]`, `expected one of high, medium`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			body, err := json.Marshal(TaskNewRequest{ReadS3Path: "s3://test-bucket/images/", Options: tc.options})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/task/new", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tc.want)
+		})
+	}
+	assert.Empty(t, wfClient.createdNames)
+
+	req := httptest.NewRequest(http.MethodGet, "/options", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var options []OptionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &options))
+	require.Len(t, options, 3)
+	assert.Equal(t, "pc-quality", options[2].Name)
+	assert.Equal(t, []any{"high", "medium"}, options[2].Domain)
 }
 
 func TestTaskNew_RejectsUnknownProcessingMode(t *testing.T) {
@@ -488,6 +566,50 @@ func TestTaskRemoveEndpoint(t *testing.T) {
 	assert.Nil(t, job)
 }
 
+func TestTaskRemoveEndpoint_RemovesSavedProjects(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	bucket := "test-bucket-remove-saved"
+	require.NoError(t, testutil.SetupTestS3Bucket(ctx, bucket))
+
+	metadataStore := meta.NewStore(db)
+	workflowName := "test-task-remove-saved"
+	_, err := metadataStore.CreateJob(
+		ctx,
+		workflowName,
+		"test-project",
+		"s3://"+bucket+"/images/",
+		"s3://"+bucket+"/output/",
+		[]string{"--fast-orthophoto"},
+		"us-east-1",
+		nil,
+	)
+	require.NoError(t, err)
+	require.NoError(t, metadataStore.MergeJobMetadata(ctx, workflowName, map[string]interface{}{
+		"s3_endpoint": "http://" + testutil.TestS3Endpoint(),
+	}))
+
+	ensureTestObjectInBucket(ctx, t, bucket, "output/odm_orthophoto/odm_orthophoto.tif", "orthophoto")
+	ensureTestObjectInBucket(ctx, t, bucket, "output/checkpoints/checkpoint.txt", "marker")
+	ensureTestObjectInBucket(ctx, t, bucket, "output/intermediates/project/opensfm/reconstruction.json", "{}")
+
+	_, handler := NewAPI(metadataStore, &recordingWorkflowClient{})
+	req := httptest.NewRequest(http.MethodPost, "/task/remove", strings.NewReader(`{"uuid":"`+workflowName+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Contains(t, []int{http.StatusOK, http.StatusNoContent}, w.Code, w.Body.String())
+
+	client, err := s3.GetS3ClientForEndpoint("http://" + testutil.TestS3Endpoint())
+	require.NoError(t, err)
+	objects, err := s3.ListObjectsRecursiveInS3Path(ctx, client, "s3://"+bucket+"/output/")
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, "output/odm_orthophoto/odm_orthophoto.tif", objects[0].Key)
+}
+
 func decodeTaskAssetsResponse(t *testing.T, body []byte) TaskAssets {
 	t.Helper()
 
@@ -777,6 +899,65 @@ func TestDownloadEndpoint_AllZipStreamsWhenMissing(t *testing.T) {
 	assert.Equal(t, "dsm-bytes", entries["odm_dem/dsm.tif"])
 }
 
+func TestDownloadEndpoint_AllZipResumesWithRange(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	bucket := fmt.Sprintf("test-bucket-download-allzip-range-%d", time.Now().UnixNano())
+	require.NoError(t, testutil.SetupTestS3Bucket(ctx, bucket))
+
+	metadataStore := meta.NewStore(db)
+	workflowName := "download-allzip-range"
+	_, err := metadataStore.CreateJob(
+		ctx,
+		workflowName,
+		"test-project",
+		"s3://"+bucket+"/images/",
+		"s3://"+bucket+"/output/",
+		[]string{"--fast-orthophoto"},
+		"us-east-1",
+		nil,
+	)
+	require.NoError(t, err)
+	require.NoError(t, metadataStore.MergeJobMetadata(ctx, workflowName, map[string]interface{}{
+		"s3_endpoint": "http://" + testutil.TestS3Endpoint(),
+	}))
+
+	ensureTestObjectInBucket(ctx, t, bucket, "output/odm_orthophoto/odm_orthophoto.tif", strings.Repeat("ortho", 1000))
+	ensureTestObjectInBucket(ctx, t, bucket, "output/odm_dem/dsm.tif", strings.Repeat("dsm", 1000))
+
+	_, handler := NewAPI(metadataStore, &recordingWorkflowClient{})
+	get := func(header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/task/"+workflowName+"/download/all.zip", nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	whole := get(nil)
+	require.Equal(t, http.StatusOK, whole.Code)
+	etag := whole.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, "bytes", whole.Header().Get("Accept-Ranges"))
+	assert.Equal(t, strconv.Itoa(whole.Body.Len()), whole.Header().Get("Content-Length"))
+
+	resumed := get(map[string]string{"Range": "bytes=100-", "If-Range": etag})
+	require.Equal(t, http.StatusPartialContent, resumed.Code)
+	assert.Equal(t, fmt.Sprintf("bytes 100-%d/%d", whole.Body.Len()-1, whole.Body.Len()), resumed.Header().Get("Content-Range"))
+	assert.Equal(t, whole.Body.Bytes()[100:], resumed.Body.Bytes())
+
+	stale := get(map[string]string{"Range": "bytes=100-", "If-Range": `"zip-stale"`})
+	assert.Equal(t, http.StatusOK, stale.Code)
+	assert.Equal(t, whole.Body.Bytes(), stale.Body.Bytes())
+
+	unsatisfiable := get(map[string]string{"Range": fmt.Sprintf("bytes=%d-", whole.Body.Len())})
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, unsatisfiable.Code)
+}
+
 func TestDownloadEndpoint_AllZipMissingWithoutOutputsReturns404(t *testing.T) {
 	db, cleanup := testDB(t)
 	defer cleanup()
@@ -977,13 +1158,71 @@ func TestMetadataImageTotalBytes(t *testing.T) {
 	assert.Equal(t, int64(123456789), metadataImageTotalBytes(metadataJSON))
 }
 
+func TestMetadataSkipPostProcessing(t *testing.T) {
+	metadataJSON, err := json.Marshal(map[string]interface{}{metadataSkipPostProcessingKey: true})
+	require.NoError(t, err)
+	assert.True(t, metadataSkipPostProcessing(metadataJSON))
+	assert.False(t, metadataSkipPostProcessing([]byte(`{}`)))
+}
+
+func TestMetadataKeepIntermediates(t *testing.T) {
+	metadataJSON, err := json.Marshal(map[string]interface{}{metadataKeepIntermediatesKey: true})
+	require.NoError(t, err)
+	assert.True(t, metadataKeepIntermediates(metadataJSON))
+	assert.False(t, metadataKeepIntermediates([]byte(`{}`)))
+}
+
+func TestRerunFromOption(t *testing.T) {
+	stage, options := rerunFromOption([]TaskOption{
+		{Name: "orthophoto-resolution", Value: 2.0},
+		{Name: "rerun-from", Value: "odm_orthophoto"},
+	})
+	assert.Equal(t, "odm_orthophoto", stage)
+	assert.Equal(t, []TaskOption{{Name: "orthophoto-resolution", Value: 2.0}}, options)
+
+	stage, options = rerunFromOption([]TaskOption{{Name: "dsm", Value: true}})
+	assert.Empty(t, stage)
+	assert.Len(t, options, 1)
+}
+
+func TestTaskNew_RejectsKeepIntermediatesWithoutSingleODMRun(t *testing.T) {
+	wfClient := &recordingWorkflowClient{}
+	_, handler := NewAPI(nil, wfClient)
+
+	for name, tc := range map[string]TaskNewRequest{
+		"split":          {Options: `[{"name":"split","value":100}]`},
+		"merge-existing": {ProcessingMode: "merge-existing"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tc.ReadS3Path = "s3://test-bucket/images/"
+			tc.WriteS3Path = "s3://test-bucket/merged/"
+			tc.KeepIntermediates = true
+			body, err := json.Marshal(tc)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/task/new", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), "keepIntermediates is only supported")
+		})
+	}
+	assert.Empty(t, wfClient.createdNames)
+}
+
 type recordingWorkflowClient struct {
 	createFn func(ctx context.Context, cfg *workflows.ODMPipelineConfig) (*wfv1.Workflow, error)
 	getFn    func(ctx context.Context, name string) (*wfv1.Workflow, error)
 	deleteFn func(ctx context.Context, name string) error
+	followFn func(ctx context.Context, name string, fromLine int, writer io.Writer) error
+	usageFn  func(ctx context.Context, name string) (*workflows.ProcessUsage, error)
 
-	createdNames []string
-	deletedNames []string
+	createdNames    []string
+	deletedNames    []string
+	listSelectors   []string
+	renderedConfigs []*workflows.ODMPipelineConfig
 }
 
 func (c *recordingWorkflowClient) CreateODMWorkflow(ctx context.Context, cfg *workflows.ODMPipelineConfig) (*wfv1.Workflow, error) {
@@ -999,6 +1238,11 @@ func (c *recordingWorkflowClient) CreateODMWorkflow(ctx context.Context, cfg *wo
 	return wf, nil
 }
 
+func (c *recordingWorkflowClient) RenderODMWorkflow(cfg *workflows.ODMPipelineConfig) (*wfv1.Workflow, error) {
+	c.renderedConfigs = append(c.renderedConfigs, cfg)
+	return &wfv1.Workflow{ObjectMeta: metav1.ObjectMeta{GenerateName: "odm-pipeline-"}}, nil
+}
+
 func (c *recordingWorkflowClient) GetWorkflow(ctx context.Context, name string) (*wfv1.Workflow, error) {
 	if c.getFn != nil {
 		return c.getFn(ctx, name)
@@ -1007,6 +1251,7 @@ func (c *recordingWorkflowClient) GetWorkflow(ctx context.Context, name string)
 }
 
 func (c *recordingWorkflowClient) ListWorkflows(ctx context.Context, labelSelector string) (*wfv1.WorkflowList, error) {
+	c.listSelectors = append(c.listSelectors, labelSelector)
 	return &wfv1.WorkflowList{}, nil
 }
 
@@ -1026,6 +1271,24 @@ func (c *recordingWorkflowClient) GetWorkflowLogsWithArchiveFallback(ctx context
 	return errors.New("not implemented")
 }
 
+func (c *recordingWorkflowClient) FollowWorkflowLogs(ctx context.Context, workflowName string, fromLine int, writer io.Writer) error {
+	if c.followFn != nil {
+		return c.followFn(ctx, workflowName, fromLine, writer)
+	}
+	return errors.New("not implemented")
+}
+
+func (c *recordingWorkflowClient) ODMStage(ctx context.Context, workflowName string, since time.Time) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func (c *recordingWorkflowClient) ProcessUsage(ctx context.Context, workflowName string) (*workflows.ProcessUsage, error) {
+	if c.usageFn != nil {
+		return c.usageFn(ctx, workflowName)
+	}
+	return nil, errors.New("not implemented")
+}
+
 func (c *recordingWorkflowClient) WatchWorkflow(ctx context.Context, workflowName string) (*wfv1.Workflow, error) {
 	return nil, errors.New("not implemented")
 }
@@ -1204,3 +1467,33 @@ func TestTaskRestart_SuccessfulCutoverDeletesOldWorkflowAfterSwap(t *testing.T)
 	require.NoError(t, err)
 	require.NotNil(t, newJob)
 }
+
+func TestTaskRestart_KeepsSkipPostProcessing(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	metadataStore := meta.NewStore(db)
+	_, err := metadataStore.CreateJob(ctx, "old-wf", "project", "s3://bucket/images/", "s3://bucket/output/", nil, "us-east-1", map[string]interface{}{
+		metadataSkipPostProcessingKey: true,
+	})
+	require.NoError(t, err)
+
+	var restarted *workflows.ODMPipelineConfig
+	wfClient := &recordingWorkflowClient{
+		createFn: func(ctx context.Context, cfg *workflows.ODMPipelineConfig) (*wfv1.Workflow, error) {
+			restarted = cfg
+			return &wfv1.Workflow{ObjectMeta: metav1.ObjectMeta{Name: "new-wf"}}, nil
+		},
+	}
+	_, handler := NewAPI(metadataStore, wfClient)
+
+	req := httptest.NewRequest(http.MethodPost, "/task/restart", bytes.NewReader([]byte(`{"uuid":"old-wf"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+	require.NotNil(t, restarted)
+	assert.True(t, restarted.SkipPostProcessing)
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/hotosm/scaleodm/app/config"
+	"github.com/hotosm/scaleodm/app/odmoptions"
+)
+
+// fallbackODMOptions is served by GET /options until the default image's
+// catalog has been read.
+var fallbackODMOptions = []OptionResponse{
+	{
+		Name:   "fast-orthophoto",
+		Type:   "bool",
+		Value:  "false",
+		Domain: "bool",
+		Help:   "Skips dense reconstruction and 3D model generation",
+	},
+	{
+		Name:   "dsm",
+		Type:   "bool",
+		Value:  "false",
+		Domain: "bool",
+		Help:   "Use this tag to build a Digital Surface Model",
+	},
+	{
+		Name:   "dtm",
+		Type:   "bool",
+		Value:  "false",
+		Domain: "bool",
+		Help:   "Use this tag to build a Digital Terrain Model",
+	},
+	{
+		Name:   "orthophoto-resolution",
+		Type:   "float",
+		Value:  "5",
+		Domain: "float > 0",
+		Help:   "Orthophoto resolution in cm/pixel",
+	},
+	{
+		Name:   "dem-resolution",
+		Type:   "float",
+		Value:  "5",
+		Domain: "float > 0",
+		Help:   "DEM resolution in cm/pixel",
+	},
+}
+
+func optionResponses(catalog *odmoptions.Catalog) []OptionResponse {
+	options := make([]OptionResponse, 0, len(catalog.Options))
+	for _, opt := range catalog.Options {
+		options = append(options, OptionResponse{
+			Name:   opt.Name,
+			Type:   opt.Type,
+			Value:  opt.Value,
+			Domain: opt.DomainValue(),
+			Help:   opt.Help,
+		})
+	}
+	return options
+}
+
+// checkODMOptions validates task options against the catalog for odmImage.
+// Until that catalog has been read the options pass unchecked, as they did
+// before catalogs existed; the lookup starts reading it.
+func (a *API) checkODMOptions(route, odmImage string, options []TaskOption) error {
+	catalog := a.odmOptions.Lookup(odmImage)
+	if catalog == nil {
+		if len(options) > 0 {
+			log.Printf("%s: options not validated, catalog for %s is not loaded yet", route, odmImage)
+		}
+		return nil
+	}
+	for _, opt := range options {
+		if err := catalog.Check(opt.Name, opt.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WarmODMOptionCatalogs reads the catalogs of the default image and of every
+// allowlisted image pinned to a tag or digest, so the common case is
+// validated from the first task. Untagged allowlist entries are read when a
+// task first uses them.
+func (a *API) WarmODMOptionCatalogs(ctx context.Context) {
+	images := []string{config.SCALEODM_ODM_IMAGE}
+	for _, allowed := range strings.Split(config.SCALEODM_ALLOWED_ODM_IMAGES, ",") {
+		allowed = strings.TrimSpace(allowed)
+		if allowed != "" && allowed != config.SCALEODM_ODM_IMAGE && isPinnedImage(allowed) {
+			images = append(images, allowed)
+		}
+	}
+	for _, image := range images {
+		if _, err := a.odmOptions.Load(ctx, image); err != nil {
+			log.Printf("odm options: catalog for %s unavailable: %v", image, err)
+		}
+	}
+}
+
+// isPinnedImage reports whether image names a tag or digest rather than a
+// whole repo.
+func isPinnedImage(image string) bool {
+	if strings.Contains(image, "@") {
+		return true
+	}
+	return strings.Contains(image[strings.LastIndex(image, "/")+1:], ":")
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hotosm/scaleodm/app/auth"
+	"github.com/hotosm/scaleodm/app/logstream"
+)
+
+// dispatchPollInterval paces the checks for a queued task's workflow while a
+// log stream waits for it.
+const dispatchPollInterval = 5 * time.Second
+
+// handleTaskOutputStream follows a task's console output as Server-Sent
+// Events. Unlike /task/{uuid}/output, which reads the whole log on every poll,
+// each line is sent once and a reconnect resumes with Last-Event-ID. A queued
+// task's stream waits for its workflow to be dispatched.
+func (a *API) handleTaskOutputStream(w http.ResponseWriter, r *http.Request) {
+	uuid := r.PathValue("uuid")
+	logPrefix := fmt.Sprintf("GET /task/%s/output/stream", uuid)
+
+	job, err := a.getJobForCaller(r.Context(), uuid)
+	if err != nil {
+		log.Printf("%s: failed to retrieve job metadata: %v", logPrefix, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve job metadata")
+		return
+	}
+	if job == nil {
+		writeJSONError(w, http.StatusNotFound, "Task not found")
+		return
+	}
+	log.Printf("%s: last_event_id=%q", logPrefix, r.Header.Get("Last-Event-ID"))
+
+	tenant := auth.TenantFromContext(r.Context())
+	logstream.Serve(w, r, logPrefix, func(ctx context.Context, fromLine int, out io.Writer) error {
+		for job.AwaitingDispatch {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(dispatchPollInterval):
+			}
+			if job, err = a.metadataStore.GetJobForTenant(ctx, uuid, tenant); err != nil {
+				return err
+			}
+			if job == nil {
+				// Removed while queued.
+				return nil
+			}
+		}
+		return a.workflowClient.FollowWorkflowLogs(ctx, job.WorkflowName, fromLine, out)
+	})
+}
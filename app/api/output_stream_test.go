@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hotosm/scaleodm/app/meta"
+)
+
+func TestTaskOutputStream_ResumesAfterLastEventID(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	metadataStore := meta.NewStore(db)
+	_, err := metadataStore.CreateJob(ctx, "wf-stream", "project", "s3://bucket/images/", "s3://bucket/output/", nil, "us-east-1", nil)
+	require.NoError(t, err)
+
+	var followed string
+	var from int
+	wfClient := &recordingWorkflowClient{
+		followFn: func(ctx context.Context, name string, fromLine int, writer io.Writer) error {
+			followed, from = name, fromLine
+			_, err := io.WriteString(writer, "line 42\n")
+			return err
+		},
+	}
+	_, handler := NewAPI(metadataStore, wfClient)
+
+	for _, path := range []string{"/task/wf-stream/output/stream", "/ui/api/tasks/wf-stream/output/stream"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Last-Event-ID", "41")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code, path)
+		assert.Equal(t, "wf-stream", followed)
+		assert.Equal(t, 41, from)
+		assert.Contains(t, w.Body.String(), "id: 42\ndata: line 42\n\n", path)
+		assert.Contains(t, w.Body.String(), "event: end\n", path)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/task/missing/output/stream", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/hotosm/scaleodm/app/config"
+	"github.com/hotosm/scaleodm/app/meta"
+)
+
+func TestTaskNew_RejectsOutOfRangePriority(t *testing.T) {
+	_, handler := NewAPI(nil, &recordingWorkflowClient{})
+
+	body, err := json.Marshal(TaskNewRequest{
+		ReadS3Path: "s3://test-bucket/images/",
+		Priority:   maxTaskPriority + 1,
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/task/new", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "priority")
+}
+
+func TestQueuedTaskInfoListAndCancel(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	origEnabled := config.SCALEODM_QUEUE_ENABLED
+	defer func() { config.SCALEODM_QUEUE_ENABLED = origEnabled }()
+	config.SCALEODM_QUEUE_ENABLED = true
+
+	metadataStore := meta.NewStore(db)
+	_, err := metadataStore.InsertJob(ctx, meta.NewJob{
+		WorkflowName:   "odm-pipeline-queued",
+		ProjectID:      "project",
+		ReadPath:       "s3://bucket/images/",
+		WritePath:      "s3://bucket/output/",
+		S3Region:       "us-east-1",
+		PipelineConfig: json.RawMessage(`{}`),
+	})
+	require.NoError(t, err)
+
+	wfClient := &recordingWorkflowClient{
+		getFn: func(ctx context.Context, name string) (*wfv1.Workflow, error) {
+			return nil, k8serrors.NewNotFound(schema.GroupResource{Resource: "workflows"}, name)
+		},
+	}
+	_, handler := NewAPI(metadataStore, wfClient)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/task/odm-pipeline-queued/info", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var info TaskInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, StatusCodeQueued, info.Status.Code)
+
+	job, err := metadataStore.GetJob(ctx, "odm-pipeline-queued")
+	require.NoError(t, err)
+	assert.Equal(t, "queued", job.JobStatus)
+	assert.NotContains(t, string(job.Metadata), metadataWorkflowMissingFirstSeen, "a queued task is not a missing workflow")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/task/list", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "odm-pipeline-queued")
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/task/cancel", bytes.NewReader([]byte(`{"uuid":"odm-pipeline-queued"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, wfClient.deletedNames, "nothing was submitted to Argo")
+
+	job, err = metadataStore.GetJob(ctx, "odm-pipeline-queued")
+	require.NoError(t, err)
+	assert.Equal(t, "canceled", job.JobStatus)
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"github.com/hotosm/scaleodm/app/config"
+	"github.com/hotosm/scaleodm/app/meta"
+	"github.com/hotosm/scaleodm/app/quota"
+)
+
+// tenantLimits resolves the effective quota for a tenant: the configured
+// defaults with any scaleodm_tenant_quotas override applied.
+func (a *API) tenantLimits(ctx context.Context, tenant string) (quota.Limits, error) {
+	limits := quota.DefaultLimits()
+	if tenant == "" || a.metadataStore == nil {
+		return limits, nil
+	}
+	override, err := a.metadataStore.GetTenantQuota(ctx, tenant)
+	if err != nil {
+		return limits, err
+	}
+	return limits.With(override), nil
+}
+
+// quotaAdmission checks one task against its tenant's quota.
+type quotaAdmission struct {
+	route     string
+	tenant    string
+	limits    quota.Limits
+	request   quota.Request
+	replacing *meta.JobMetadata
+	// reason is the metric reason of the last rejection, empty until one.
+	reason string
+}
+
+// admit is the quota check, a meta.AdmitFunc.
+func (q *quotaAdmission) admit(usage quota.Usage) error {
+	if q.replacing != nil && !meta.IsTerminalJobStatus(q.replacing.JobStatus) {
+		usage.ActiveTasks--
+		usage.WorkspaceGiB -= metadataWorkspaceGiB(q.replacing.Metadata)
+	}
+
+	err := q.limits.Check(usage, q.request)
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		log.Printf("%s: quota exceeded tenant=%q reason=%s images=%d workspaceGiB=%.0f activeTasks=%d inFlightGiB=%.0f",
+			q.route, q.tenant, exceeded.Reason, q.request.ImageCount, q.request.WorkspaceGiB, usage.ActiveTasks, usage.WorkspaceGiB)
+		q.reason = "quota_" + exceeded.Reason
+		return huma.NewError(429, exceeded.Message)
+	}
+	return nil
+}
+
+// admitFunc is the check to record the task's job with (meta.NewJob.Admit),
+// nil with quotas disabled.
+func (q *quotaAdmission) admitFunc() meta.AdmitFunc {
+	if q == nil {
+		return nil
+	}
+	return q.admit
+}
+
+// rejected reports whether the last check turned the task away.
+func (q *quotaAdmission) rejected() bool {
+	return q != nil && q.reason != ""
+}
+
+// admitTask enforces the tenant's quota before a workflow is submitted and
+// returns the metric reason alongside any error. replacing is the job a
+// restart supersedes; it no longer counts against the tenant once admitted.
+// Concurrent submissions can all pass this check, so the returned admission
+// checks again as the job is recorded, under the tenant's admission lock.
+// It is nil with quotas disabled.
+func (a *API) admitTask(ctx context.Context, route, tenant string, imageCount int, workspaceGiB float64, replacing *meta.JobMetadata) (*quotaAdmission, string, error) {
+	if !config.SCALEODM_QUOTA_ENABLED {
+		return nil, "none", nil
+	}
+
+	limits, err := a.tenantLimits(ctx, tenant)
+	if err != nil {
+		log.Printf("%s: failed to load quota tenant=%q: %v", route, tenant, err)
+		return nil, "quota_lookup_failed", huma.NewError(500, "Failed to evaluate task quota", err)
+	}
+	usage, err := a.metadataStore.TenantUsage(ctx, tenant)
+	if err != nil {
+		log.Printf("%s: failed to compute quota usage tenant=%q: %v", route, tenant, err)
+		return nil, "quota_lookup_failed", huma.NewError(500, "Failed to evaluate task quota", err)
+	}
+	admission := &quotaAdmission{
+		route:     route,
+		tenant:    tenant,
+		limits:    limits,
+		request:   quota.Request{ImageCount: imageCount, WorkspaceGiB: workspaceGiB},
+		replacing: replacing,
+	}
+	if err := admission.admit(usage); err != nil {
+		return nil, admission.reason, err
+	}
+	return admission, "none", nil
+}
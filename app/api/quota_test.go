@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hotosm/scaleodm/app/config"
+	"github.com/hotosm/scaleodm/app/meta"
+)
+
+func withQuotaConfig(t *testing.T, tasks, images int, gib float64) {
+	t.Helper()
+	origEnabled := config.SCALEODM_QUOTA_ENABLED
+	origTasks := config.SCALEODM_QUOTA_MAX_CONCURRENT_TASKS
+	origImages := config.SCALEODM_QUOTA_MAX_IMAGES_PER_TASK
+	origGiB := config.SCALEODM_QUOTA_MAX_WORKSPACE_GIB
+	t.Cleanup(func() {
+		config.SCALEODM_QUOTA_ENABLED = origEnabled
+		config.SCALEODM_QUOTA_MAX_CONCURRENT_TASKS = origTasks
+		config.SCALEODM_QUOTA_MAX_IMAGES_PER_TASK = origImages
+		config.SCALEODM_QUOTA_MAX_WORKSPACE_GIB = origGiB
+	})
+	config.SCALEODM_QUOTA_ENABLED = true
+	config.SCALEODM_QUOTA_MAX_CONCURRENT_TASKS = tasks
+	config.SCALEODM_QUOTA_MAX_IMAGES_PER_TASK = images
+	config.SCALEODM_QUOTA_MAX_WORKSPACE_GIB = gib
+}
+
+func TestInfoReportsQuotaLimits(t *testing.T) {
+	withQuotaConfig(t, 3, 500, 0)
+
+	_, handler := NewAPI(nil, &recordingWorkflowClient{})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/info", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body struct {
+		MaxImages        *int `json:"maxImages"`
+		MaxParallelTasks int  `json:"maxParallelTasks"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.NotNil(t, body.MaxImages)
+	assert.Equal(t, 500, *body.MaxImages)
+	assert.Equal(t, 3, body.MaxParallelTasks)
+}
+
+func TestAdmitTaskEnforcesConcurrentTasks(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+	withQuotaConfig(t, 1, 0, 0)
+
+	metadataStore := meta.NewStore(db)
+	ctx := context.Background()
+	_, err := metadataStore.CreateJobForTenant(ctx, "dronetm", "wf-quota-1", "project", "s3://bucket/images/", "s3://bucket/output/", nil, "us-east-1", nil)
+	require.NoError(t, err)
+	existing, err := metadataStore.GetJob(ctx, "wf-quota-1")
+	require.NoError(t, err)
+
+	a, _ := NewAPI(metadataStore, &recordingWorkflowClient{})
+
+	_, reason, err := a.admitTask(ctx, "test", "dronetm", 10, 5, nil)
+	var statusErr huma.StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusTooManyRequests, statusErr.GetStatus())
+	assert.Equal(t, "quota_max_concurrent_tasks", reason)
+
+	_, _, err = a.admitTask(ctx, "test", "fair", 10, 5, nil)
+	assert.NoError(t, err, "other tenants have their own quota")
+
+	admission, _, err := a.admitTask(ctx, "test", "dronetm", 10, 5, existing)
+	require.NoError(t, err, "a restart replaces the job it supersedes")
+
+	// Another job recorded since the first check counts when the restart's
+	// job is recorded.
+	_, err = metadataStore.CreateJobForTenant(ctx, "dronetm", "wf-quota-2", "project", "s3://bucket/images/", "s3://bucket/output/", nil, "us-east-1", nil)
+	require.NoError(t, err)
+	err = metadataStore.RestartJobMetadata(ctx, "wf-quota-1", "wf-quota-1b", "project", "s3://bucket/images/", "s3://bucket/output/", nil, "us-east-1", nil, nil, admission.admitFunc())
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusTooManyRequests, statusErr.GetStatus())
+	assert.True(t, admission.rejected())
+}
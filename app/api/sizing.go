@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"github.com/hotosm/scaleodm/app/estimator"
+)
+
+// SizingCurve is the learned correction of one estimate for one workload
+// profile, with how well the prior and the curve fit the observed runs.
+type SizingCurve struct {
+	Target              string  `json:"target" enum:"memory,workspace" doc:"Estimate corrected: the process peak memory or the workspace size"`
+	Profile             string  `json:"profile" doc:"Workload profile: standard, fast-orthophoto or dsm-dtm"`
+	Observations        int     `json:"observations" doc:"Runs the curve was fitted on"`
+	MinImages           int     `json:"minImages" doc:"Smallest image count observed; smaller tasks are corrected as this"`
+	MaxImages           int     `json:"maxImages" doc:"Largest image count observed; larger tasks are corrected as this"`
+	Intercept           float64 `json:"intercept" doc:"ln(observed/prior) at the mean ln(image count)"`
+	Slope               float64 `json:"slope" doc:"Change of ln(observed/prior) per unit of ln(image count)"`
+	MeanLogImages       float64 `json:"meanLogImages"`
+	Sigma               float64 `json:"sigma" doc:"Standard deviation of the residuals, in ln units"`
+	Margin              float64 `json:"margin" doc:"Headroom added to ln(observed/prior), in ln units"`
+	FactorAtMinImages   float64 `json:"factorAtMinImages" doc:"Multiplier applied to the prior at minImages, margin included"`
+	FactorAtMaxImages   float64 `json:"factorAtMaxImages" doc:"Multiplier applied to the prior at maxImages, margin included"`
+	PriorRMSLE          float64 `json:"priorRmsle" doc:"Root mean square of ln(observed/prior) over the runs"`
+	FitRMSLE            float64 `json:"fitRmsle" doc:"Root mean square of ln(observed/curve) over the runs, margin excluded"`
+	MedianRatio         float64 `json:"medianRatio" doc:"Median of observed/prior"`
+	PriorUnderestimates int     `json:"priorUnderestimates" doc:"Runs that used more than the prior estimated"`
+	FitUnderestimates   int     `json:"fitUnderestimates" doc:"Runs that used more than the curve, margin included, estimates"`
+	Applied             bool    `json:"applied" doc:"Whether the curve corrects new tasks' estimates"`
+}
+
+// SizingReport is the estimator's most recent fit.
+type SizingReport struct {
+	FittedAt        string        `json:"fittedAt" doc:"RFC 3339 timestamp"`
+	Enabled         bool          `json:"enabled" doc:"Whether curves are applied (SCALEODM_LEARNED_SIZING_ENABLED)"`
+	MinObservations int           `json:"minObservations" doc:"Runs a curve needs before it is applied"`
+	Observations    int           `json:"observations" doc:"Runs read for the fit"`
+	Curves          []SizingCurve `json:"curves"`
+}
+
+func toSizingReport(report *estimator.Report) SizingReport {
+	resp := SizingReport{
+		FittedAt:        report.FittedAt.UTC().Format(time.RFC3339),
+		Enabled:         report.Apply,
+		MinObservations: report.MinObservations,
+		Observations:    report.Observations,
+		Curves:          make([]SizingCurve, 0, len(report.Curves)),
+	}
+	for _, c := range report.Curves {
+		resp.Curves = append(resp.Curves, SizingCurve{
+			Target:              c.Target,
+			Profile:             c.Profile,
+			Observations:        c.Observations,
+			MinImages:           c.Curve.MinImages,
+			MaxImages:           c.Curve.MaxImages,
+			Intercept:           c.Curve.Intercept,
+			Slope:               c.Curve.Slope,
+			MeanLogImages:       c.Curve.MeanLogImages,
+			Sigma:               c.Sigma,
+			Margin:              c.Curve.Margin,
+			FactorAtMinImages:   c.Curve.Factor(c.Curve.MinImages),
+			FactorAtMaxImages:   c.Curve.Factor(c.Curve.MaxImages),
+			PriorRMSLE:          c.PriorRMSLE,
+			FitRMSLE:            c.FitRMSLE,
+			MedianRatio:         c.MedianRatio,
+			PriorUnderestimates: c.PriorUnderestimates,
+			FitUnderestimates:   c.FitUnderestimates,
+			Applied:             c.Applied,
+		})
+	}
+	return resp
+}
+
+func (a *API) registerAdminRoutes() {
+	huma.Register(a.api, huma.Operation{
+		OperationID: "admin-sizing-get",
+		Method:      http.MethodGet,
+		Path:        "/admin/sizing",
+		Summary:     "Gets the learned process sizing",
+		Description: "Reports the estimator's most recent fit of the process memory and workspace estimates to the peak usage of finished runs, per workload profile, with fit diagnostics against the static estimates. Limited to SCALEODM_AUTH_ADMIN_NAMES when auth is enabled.",
+		Tags:        []string{"admin"},
+	}, func(ctx context.Context, input *struct {
+		Token string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
+	}) (*struct{ Body SizingReport }, error) {
+		if err := requireAdmin(ctx); err != nil {
+			return nil, err
+		}
+		report := estimator.Latest()
+		if report == nil {
+			return nil, huma.NewError(503, "The sizing estimator has not run yet")
+		}
+		return &struct{ Body SizingReport }{Body: toSizingReport(report)}, nil
+	})
+}
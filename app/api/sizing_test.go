@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hotosm/scaleodm/app/config"
+)
+
+func TestAdminSizing_LimitedToAdmins(t *testing.T) {
+	origEnabled, origTokens, origDB, origAdmins := config.SCALEODM_AUTH_ENABLED, config.SCALEODM_AUTH_TOKENS, config.SCALEODM_AUTH_DB_TOKENS_ENABLED, config.SCALEODM_AUTH_ADMIN_NAMES
+	t.Cleanup(func() {
+		config.SCALEODM_AUTH_ENABLED, config.SCALEODM_AUTH_TOKENS, config.SCALEODM_AUTH_DB_TOKENS_ENABLED, config.SCALEODM_AUTH_ADMIN_NAMES = origEnabled, origTokens, origDB, origAdmins
+	})
+	config.SCALEODM_AUTH_ENABLED = true
+	config.SCALEODM_AUTH_TOKENS = "dronetm:token-a,ops:token-ops"
+	config.SCALEODM_AUTH_DB_TOKENS_ENABLED = false
+	config.SCALEODM_AUTH_ADMIN_NAMES = "ops"
+	_, handler := NewAPI(nil, &recordingWorkflowClient{})
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+	}{
+		{"without token", "/admin/sizing", http.StatusUnauthorized},
+		{"with a tenant's token", "/admin/sizing?token=token-a", http.StatusForbidden},
+		// The estimator is not running in tests, so there is no fit yet.
+		{"with an admin token", "/admin/sizing?token=token-ops", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"github.com/hotosm/scaleodm/app/meta"
+)
+
+// TaskEvent is an entry of a task's timeline.
+type TaskEvent struct {
+	ID      int64  `json:"id"`
+	Type    string `json:"type" enum:"created,status,dispatched,dispatch_failed,restarted" doc:"What happened"`
+	From    string `json:"from,omitempty" doc:"Status before a status change"`
+	To      string `json:"to,omitempty" doc:"Status after the event"`
+	Actor   string `json:"actor" doc:"Who acted: user or user:{token name}, api, ui, reconciler, dispatcher or system"`
+	Reason  string `json:"reason,omitempty" doc:"Why, e.g. argo_sync, infra_failure, missing_workflow_grace_expired, cancel_requested"`
+	Message string `json:"message,omitempty" doc:"The error of a failure, or the previous UUID of a restart"`
+	Time    string `json:"time" doc:"RFC 3339 timestamp"`
+}
+
+func toTaskEvent(event meta.JobEvent) TaskEvent {
+	return TaskEvent{
+		ID:      event.ID,
+		Type:    event.Type,
+		From:    event.FromStatus,
+		To:      event.ToStatus,
+		Actor:   event.Actor,
+		Reason:  event.Reason,
+		Message: event.Message,
+		Time:    event.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+func (a *API) registerTaskEventRoutes() {
+	huma.Register(a.api, huma.Operation{
+		OperationID: "task-uuid-events-get",
+		Method:      http.MethodGet,
+		Path:        "/task/{uuid}/events",
+		Summary:     "Gets the timeline of a task",
+		Description: "Lists what happened to the task, oldest first: its creation, status changes with who made them and why, dispatches and restarts.",
+		Tags:        []string{"task"},
+	}, func(ctx context.Context, input *struct {
+		UUID  string `path:"uuid" doc:"UUID of the task"`
+		Token string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
+	}) (*struct{ Body []TaskEvent }, error) {
+		job, err := a.getJobForCaller(ctx, input.UUID)
+		if err != nil {
+			log.Printf("GET /task/%s/events: failed to retrieve task metadata: %v", input.UUID, err)
+			return nil, huma.NewError(500, "Failed to retrieve task metadata", err)
+		}
+		if job == nil {
+			return nil, huma.NewError(404, "Task not found")
+		}
+
+		events, err := a.metadataStore.ListJobEvents(ctx, input.UUID)
+		if err != nil {
+			log.Printf("GET /task/%s/events: failed to list events: %v", input.UUID, err)
+			return nil, huma.NewError(500, "Failed to retrieve task events", err)
+		}
+		resp := &struct{ Body []TaskEvent }{Body: make([]TaskEvent, 0, len(events))}
+		for _, event := range events {
+			resp.Body = append(resp.Body, toTaskEvent(event))
+		}
+		return resp, nil
+	})
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hotosm/scaleodm/app/meta"
+)
+
+func TestTaskEvents_Timeline(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+	setEventsConfig(t, "")
+
+	store := meta.NewStore(db)
+	ctx := context.Background()
+	_, err := store.InsertJob(meta.WithActor(ctx, "user:dronetm", ""), meta.NewJob{
+		Tenant:         "dronetm",
+		WorkflowName:   "wf-api-timeline",
+		ProjectID:      "project",
+		ReadPath:       "s3://bucket/images/",
+		WritePath:      "s3://bucket/output/",
+		S3Region:       "us-east-1",
+		PipelineConfig: json.RawMessage(`{"WorkflowName":"wf-api-timeline"}`),
+	})
+	require.NoError(t, err)
+	_, handler := NewAPI(store, &recordingWorkflowClient{})
+
+	req := httptest.NewRequest(http.MethodPost, "/task/cancel?token=token-a", strings.NewReader(`{"uuid": "wf-api-timeline"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/task/wf-api-timeline/events?token=token-a", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var timeline []TaskEvent
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &timeline))
+	require.Len(t, timeline, 2)
+	assert.Equal(t, "created", timeline[0].Type)
+	assert.Equal(t, "queued", timeline[0].To)
+	assert.Equal(t, "user:dronetm", timeline[0].Actor)
+	assert.Equal(t, "status", timeline[1].Type)
+	assert.Equal(t, "queued", timeline[1].From)
+	assert.Equal(t, "canceled", timeline[1].To)
+	assert.Equal(t, "user:dronetm", timeline[1].Actor)
+	assert.Equal(t, "cancel_requested", timeline[1].Reason)
+	assert.NotEmpty(t, timeline[1].Time)
+
+	// Another tenant's task is not found.
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/task/wf-api-timeline/events?token=token-b", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
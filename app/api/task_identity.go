@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"github.com/hotosm/scaleodm/app/auth"
+)
+
+// metadataIdempotencyFingerprintKey holds a hash of the request that created
+// a task with an Idempotency-Key, to tell a retry from a reused key.
+const metadataIdempotencyFingerprintKey = "idempotency_fingerprint"
+
+// maxIdempotencyKeyLength bounds Idempotency-Key; a UUID is 36 characters.
+const maxIdempotencyKeyLength = 255
+
+// setUUIDPattern matches the UUIDs set-uuid accepts. They become the workflow
+// name, so they are lowercased first to be valid Kubernetes names.
+var setUUIDPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// taskIdentity carries the caller's say in which task a request creates:
+// set-uuid names it, and Idempotency-Key makes repeats of the request return
+// it instead of creating another.
+type taskIdentity struct {
+	UUID           string `json:"setUUID,omitempty"`
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+}
+
+// newTaskIdentity normalises and validates the set-uuid and Idempotency-Key
+// headers.
+func newTaskIdentity(setUUID, idempotencyKey string) (taskIdentity, error) {
+	identity := taskIdentity{
+		UUID:           strings.ToLower(strings.TrimSpace(setUUID)),
+		IdempotencyKey: strings.TrimSpace(idempotencyKey),
+	}
+	if identity.UUID != "" && !setUUIDPattern.MatchString(identity.UUID) {
+		return taskIdentity{}, fmt.Errorf("invalid set-uuid %q: expected a UUID such as 123e4567-e89b-42d3-a456-426614174000", setUUID)
+	}
+	if len(identity.IdempotencyKey) > maxIdempotencyKeyLength {
+		return taskIdentity{}, fmt.Errorf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength)
+	}
+	for _, r := range identity.IdempotencyKey {
+		if r < 0x21 || r > 0x7e {
+			return taskIdentity{}, fmt.Errorf("Idempotency-Key must be printable ASCII without spaces")
+		}
+	}
+	return identity, nil
+}
+
+// fingerprint hashes the request with the identity it asked for, so a
+// retry matches and a different request under the same key does not.
+func (identity taskIdentity) fingerprint(req TaskNewRequest) string {
+	data, _ := json.Marshal(struct {
+		Request TaskNewRequest `json:"request"`
+		UUID    string         `json:"uuid"`
+	}{req, identity.UUID})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// replayTask returns the task an earlier request with the same
+// Idempotency-Key created, or "" when there is none. A key reused for a
+// different request is rejected with a 422.
+func (a *API) replayTask(ctx context.Context, identity taskIdentity, fingerprint string) (string, error) {
+	if identity.IdempotencyKey == "" {
+		return "", nil
+	}
+	job, err := a.metadataStore.GetJobByIdempotencyKey(ctx, auth.TenantFromContext(ctx), identity.IdempotencyKey)
+	if err != nil {
+		return "", huma.NewError(500, "Failed to look up Idempotency-Key", err)
+	}
+	if job == nil {
+		return "", nil
+	}
+	if stored, _ := parseMetadataMap(job.Metadata)[metadataIdempotencyFingerprintKey].(string); stored != fingerprint {
+		return "", huma.NewError(422, fmt.Sprintf("Idempotency-Key was already used for a different request (task %s)", job.WorkflowName))
+	}
+	return job.WorkflowName, nil
+}
+
+// checkTaskUUIDFree rejects a set-uuid that names an existing task or
+// workflow, whichever tenant owns it: workflow names are cluster-wide.
+// Unlike getJobForCaller, it thereby confirms that another tenant's UUID
+// exists; the docs name this exception.
+func (a *API) checkTaskUUIDFree(ctx context.Context, uuid string) error {
+	job, err := a.metadataStore.GetJob(ctx, uuid)
+	if err != nil {
+		return huma.NewError(500, "Failed to check set-uuid", err)
+	}
+	if job != nil {
+		return huma.NewError(409, fmt.Sprintf("a task with uuid %s already exists", uuid))
+	}
+	if _, err := a.workflowClient.GetWorkflow(ctx, uuid); err == nil {
+		return huma.NewError(409, fmt.Sprintf("a task with uuid %s already exists", uuid))
+	} else if !isNotFound(err) {
+		return huma.NewError(500, "Failed to check set-uuid", err)
+	}
+	return nil
+}
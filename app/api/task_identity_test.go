@@ -0,0 +1,148 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/hotosm/scaleodm/app/meta"
+)
+
+func TestNewTaskIdentity(t *testing.T) {
+	identity, err := newTaskIdentity(" 123E4567-E89B-42D3-A456-426614174000 ", " retry-1 ")
+	require.NoError(t, err)
+	assert.Equal(t, "123e4567-e89b-42d3-a456-426614174000", identity.UUID)
+	assert.Equal(t, "retry-1", identity.IdempotencyKey)
+
+	identity, err = newTaskIdentity("", "")
+	require.NoError(t, err)
+	assert.Equal(t, taskIdentity{}, identity)
+
+	_, err = newTaskIdentity("not-a-uuid", "")
+	assert.ErrorContains(t, err, "set-uuid")
+	_, err = newTaskIdentity("", "two words")
+	assert.ErrorContains(t, err, "Idempotency-Key")
+	_, err = newTaskIdentity("", strings.Repeat("k", maxIdempotencyKeyLength+1))
+	assert.ErrorContains(t, err, "Idempotency-Key")
+}
+
+func TestTaskIdentityFingerprint(t *testing.T) {
+	req := TaskNewRequest{Name: "project", ReadS3Path: "s3://bucket/images/"}
+	identity := taskIdentity{IdempotencyKey: "retry-1"}
+
+	assert.Equal(t, identity.fingerprint(req), identity.fingerprint(req))
+	other := req
+	other.Name = "other"
+	assert.NotEqual(t, identity.fingerprint(req), identity.fingerprint(other))
+	named := taskIdentity{UUID: "123e4567-e89b-42d3-a456-426614174000", IdempotencyKey: "retry-1"}
+	assert.NotEqual(t, identity.fingerprint(req), named.fingerprint(req))
+}
+
+func TestTaskNew_RejectsInvalidSetUUID(t *testing.T) {
+	_, handler := NewAPI(nil, &recordingWorkflowClient{})
+
+	body, err := json.Marshal(TaskNewRequest{ReadS3Path: "s3://test-bucket/images/"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/task/new", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("set-uuid", "../../etc")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "set-uuid")
+}
+
+func TestTaskNew_IdempotencyKeyReplaysTask(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	request := TaskNewRequest{Name: "project", ReadS3Path: "s3://bucket/images/", S3Region: "us-east-1"}
+	identity := taskIdentity{IdempotencyKey: "retry-1"}
+	metadataStore := meta.NewStore(db)
+	_, err := metadataStore.InsertJob(ctx, meta.NewJob{
+		WorkflowName:   "odm-pipeline-first",
+		ProjectID:      "project",
+		ReadPath:       "s3://bucket/images/",
+		WritePath:      "s3://bucket/images/output/",
+		S3Region:       "us-east-1",
+		Metadata:       map[string]any{metadataIdempotencyFingerprintKey: identity.fingerprint(request)},
+		IdempotencyKey: identity.IdempotencyKey,
+	})
+	require.NoError(t, err)
+
+	wfClient := &recordingWorkflowClient{}
+	_, handler := NewAPI(metadataStore, wfClient)
+	post := func(req TaskNewRequest) *httptest.ResponseRecorder {
+		body, err := json.Marshal(req)
+		require.NoError(t, err)
+		r := httptest.NewRequest(http.MethodPost, "/task/new", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Idempotency-Key", identity.IdempotencyKey)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := post(request)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		UUID string `json:"uuid"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "odm-pipeline-first", resp.UUID)
+	assert.Empty(t, wfClient.createdNames, "a replay must not submit another workflow")
+
+	changed := request
+	changed.Name = "other-project"
+	w = post(changed)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "odm-pipeline-first")
+}
+
+func TestTaskNew_RejectsTakenSetUUID(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	const taken = "123e4567-e89b-42d3-a456-426614174000"
+	metadataStore := meta.NewStore(db)
+	_, err := metadataStore.InsertJob(ctx, meta.NewJob{
+		WorkflowName: taken,
+		ProjectID:    "project",
+		ReadPath:     "s3://bucket/images/",
+		WritePath:    "s3://bucket/images/output/",
+		S3Region:     "us-east-1",
+	})
+	require.NoError(t, err)
+
+	wfClient := &recordingWorkflowClient{
+		getFn: func(ctx context.Context, name string) (*wfv1.Workflow, error) {
+			return nil, k8serrors.NewNotFound(schema.GroupResource{Resource: "workflows"}, name)
+		},
+	}
+	_, handler := NewAPI(metadataStore, wfClient)
+
+	body, err := json.Marshal(TaskNewRequest{ReadS3Path: "s3://bucket/images/"})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/task/new", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("set-uuid", strings.ToUpper(taken))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Empty(t, wfClient.createdNames)
+}
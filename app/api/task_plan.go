@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"github.com/hotosm/scaleodm/app/config"
+	"github.com/hotosm/scaleodm/app/workflows"
+)
+
+// PlanResources is a container's resolved requests and limits.
+type PlanResources struct {
+	RequestsCPU    string `json:"requestsCpu,omitempty"`
+	RequestsMemory string `json:"requestsMemory,omitempty"`
+	LimitsCPU      string `json:"limitsCpu,omitempty"`
+	LimitsMemory   string `json:"limitsMemory,omitempty"`
+}
+
+// PlanWorkspace is the resolved workspace of a task.
+type PlanWorkspace struct {
+	Mode         string  `json:"mode" doc:"Configured mode: pvc, emptyDir or auto (a PVC when a storage class is set)"`
+	Size         string  `json:"size,omitempty" doc:"PVC size, after dynamic sizing"`
+	StorageClass string  `json:"storageClass,omitempty"`
+	AccessMode   string  `json:"accessMode,omitempty"`
+	EstimatedGiB float64 `json:"estimatedGiB" doc:"Workspace counted against the tenant's quota"`
+}
+
+// TaskPlan is what POST /task/new would do with a request.
+type TaskPlan struct {
+	ProjectID          string         `json:"projectId"`
+	ProcessingMode     string         `json:"processingMode"`
+	JobType            string         `json:"jobType" doc:"standard, splitmerge, merge or cityscale"`
+	ReadS3Path         string         `json:"readS3Path"`
+	WriteS3Path        string         `json:"writeS3Path"`
+	S3Region           string         `json:"s3Region"`
+	S3Endpoint         string         `json:"s3Endpoint,omitempty"`
+	ODMImage           string         `json:"odmImage"`
+	ODMFlags           []string       `json:"odmFlags" doc:"Flags ODM runs with, concurrency included; split options shape the pipeline instead"`
+	ImageCount         int            `json:"imageCount"`
+	ImageTotalBytes    int64          `json:"imageTotalBytes"`
+	MergeInputCount    int            `json:"mergeInputCount,omitempty" doc:"Task outputs a merge-existing task merges"`
+	CityScaleTaskCount int            `json:"cityScaleTaskCount,omitempty"`
+	LargestTaskImages  int            `json:"largestTaskImages,omitempty" doc:"Images in the largest city-scale task, which sizes the task pods"`
+	Split              int            `json:"split,omitempty"`
+	Sidecars           []string       `json:"sidecars,omitempty" doc:"ODM sidecar files found beside the imagery"`
+	ExcludePaths       []string       `json:"excludePaths" doc:"Exclude patterns, defaults included"`
+	S3ScanDepth        int            `json:"s3ScanDepth"`
+	CapacityType       string         `json:"capacityType" doc:"Capacity the task runs on, after the on-demand upgrade"`
+	CapacityUpgraded   bool           `json:"capacityUpgraded" doc:"Whether a spot request was moved to on-demand for its size"`
+	ProcessResources   PlanResources  `json:"processResources"`
+	Workspace          PlanWorkspace  `json:"workspace"`
+	Queued             bool           `json:"queued" doc:"Whether the task would wait in the dispatch queue rather than be submitted straight away"`
+	Imagery            *ImageryReport `json:"imagery,omitempty" doc:"Inspection report of the imagery, when SCALEODM_IMAGERY_INSPECTION is not off"`
+	// Manifest is opaque to the API schema; it is whatever Argo accepts.
+	Manifest json.RawMessage `json:"manifest" doc:"The Argo Workflow that would be submitted"`
+}
+
+func toPlanResources(r workflows.ContainerResources) PlanResources {
+	return PlanResources{
+		RequestsCPU:    r.Requests.CPU,
+		RequestsMemory: r.Requests.Memory,
+		LimitsCPU:      r.Limits.CPU,
+		LimitsMemory:   r.Limits.Memory,
+	}
+}
+
+func (a *API) registerTaskPlanRoutes() {
+	// POST /task/plan - Dry run of POST /task/new
+	huma.Register(a.api, huma.Operation{
+		OperationID: "task-plan-post",
+		Method:      http.MethodPost,
+		Path:        "/task/plan",
+		Summary:     "Plans a new task",
+		Description: "Runs every check of POST /task/new, counts the imagery and resolves the capacity, process resources and workspace size, then returns the resolved plan and the Argo Workflow that would be submitted. Nothing is submitted or recorded.",
+		Tags:        []string{"task"},
+	}, func(ctx context.Context, input *struct {
+		Token string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
+		Body  TaskNewRequest
+	}) (*struct{ Body TaskPlan }, error) {
+		plan, _, err := a.planTask(ctx, "POST /task/plan", input.Body)
+		if err != nil {
+			return nil, err
+		}
+		cfg := plan.config
+		wf, err := a.workflowClient.RenderODMWorkflow(cfg)
+		if err != nil {
+			log.Printf("POST /task/plan: failed to render workflow project_id=%q: %v", cfg.ODMProjectID, err)
+			return nil, huma.NewError(500, "Failed to render workflow", err)
+		}
+		manifest, err := json.Marshal(wf)
+		if err != nil {
+			return nil, huma.NewError(500, "Failed to encode workflow", err)
+		}
+		log.Printf("POST /task/plan: planned project_id=%q images=%d capacity=%s workspace=%s",
+			cfg.ODMProjectID, cfg.ImageCount, cfg.CapacityType, cfg.Workspace.Size)
+
+		return &struct{ Body TaskPlan }{Body: TaskPlan{
+			ProjectID:          cfg.ODMProjectID,
+			ProcessingMode:     cfg.ProcessingMode,
+			JobType:            plan.jobType,
+			ReadS3Path:         cfg.ReadS3Path,
+			WriteS3Path:        cfg.WriteS3Path,
+			S3Region:           cfg.S3Region,
+			S3Endpoint:         cfg.S3Endpoint,
+			ODMImage:           cfg.ODMImage,
+			ODMFlags:           cfg.ODMFlags,
+			ImageCount:         cfg.ImageCount,
+			ImageTotalBytes:    cfg.ImageTotalBytes,
+			MergeInputCount:    plan.mergeInputCount,
+			CityScaleTaskCount: plan.cityScaleTaskCount,
+			LargestTaskImages:  cfg.LargestTaskImages,
+			Split:              cfg.Split,
+			Sidecars:           cfg.Sidecars,
+			ExcludePaths:       cfg.ExcludePaths,
+			S3ScanDepth:        cfg.S3ScanDepth,
+			CapacityType:       cfg.CapacityType,
+			CapacityUpgraded:   cfg.CapacityType != plan.capacityType,
+			ProcessResources:   toPlanResources(cfg.ProcessResources),
+			Workspace: PlanWorkspace{
+				Mode:         cfg.Workspace.Mode,
+				Size:         cfg.Workspace.Size,
+				StorageClass: cfg.Workspace.StorageClass,
+				AccessMode:   cfg.Workspace.AccessMode,
+				EstimatedGiB: plan.workspaceGiB,
+			},
+			Queued:   config.SCALEODM_QUEUE_ENABLED,
+			Imagery:  plan.imagery,
+			Manifest: manifest,
+		}}, nil
+	})
+}
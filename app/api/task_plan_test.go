@@ -0,0 +1,86 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hotosm/scaleodm/testutil"
+)
+
+func TestTaskPlan_RejectsLikeTaskNew(t *testing.T) {
+	wfClient := &recordingWorkflowClient{}
+	_, handler := NewAPI(nil, wfClient)
+
+	for name, tc := range map[string]struct {
+		req  TaskNewRequest
+		want string
+	}{
+		"unknown mode":   {TaskNewRequest{ReadS3Path: "s3://test-bucket/images/", ProcessingMode: "bogus"}, "invalid processingMode"},
+		"no read path":   {TaskNewRequest{}, "readS3Path is required"},
+		"bad excludes":   {TaskNewRequest{ReadS3Path: "s3://test-bucket/images/", ExcludePaths: "{"}, "Invalid excludePaths JSON"},
+		"bad write path": {TaskNewRequest{ReadS3Path: "s3://test-bucket/images/", WriteS3Path: "/tmp/out"}, "writeS3Path must be an s3:// path"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			body, err := json.Marshal(tc.req)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/task/plan", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tc.want)
+		})
+	}
+	assert.Empty(t, wfClient.renderedConfigs)
+	assert.Empty(t, wfClient.createdNames)
+}
+
+func TestTaskPlan_RendersWithoutSubmitting(t *testing.T) {
+	ctx := context.Background()
+	require.NoError(t, testutil.SetupTestS3Bucket(ctx, "test-bucket"))
+	ensureTestImageInBucket(ctx, t, "test-bucket", "images/input.jpg")
+
+	// No metadata store: planning records nothing.
+	wfClient := &recordingWorkflowClient{}
+	_, handler := NewAPI(nil, wfClient)
+
+	body, err := json.Marshal(TaskNewRequest{
+		Name:        "plan-project",
+		ReadS3Path:  "s3://test-bucket/images/",
+		WriteS3Path: "s3://test-bucket/output/",
+		Options:     `[{"name": "fast-orthophoto", "value": true}]`,
+		S3Region:    "us-east-1",
+		S3Endpoint:  "http://" + testutil.TestS3Endpoint(),
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/task/plan", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var plan TaskPlan
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &plan))
+	assert.Equal(t, "plan-project", plan.ProjectID)
+	assert.Equal(t, "standard", plan.JobType)
+	assert.GreaterOrEqual(t, plan.ImageCount, 1)
+	assert.Contains(t, plan.ODMFlags, "--fast-orthophoto")
+	var manifest wfv1.Workflow
+	require.NoError(t, json.Unmarshal(plan.Manifest, &manifest))
+	assert.Equal(t, "odm-pipeline-", manifest.GenerateName)
+
+	require.Len(t, wfClient.renderedConfigs, 1)
+	assert.Equal(t, plan.ImageCount, wfClient.renderedConfigs[0].ImageCount)
+	assert.Empty(t, wfClient.createdNames)
+}
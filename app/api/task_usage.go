@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"github.com/hotosm/scaleodm/app/meta"
+)
+
+// StageRun is the timing and resources of one run of a task's stage.
+type StageRun struct {
+	Stage              string  `json:"stage" doc:"Container of a single-pod pipeline (download, process, upload, ...) or step of a DAG pipeline (e.g. process-0 for a split-merge tier)"`
+	Phase              string  `json:"phase" doc:"Argo node phase: Succeeded, Failed, Error, ..."`
+	StartedAt          string  `json:"startedAt" doc:"RFC 3339 timestamp"`
+	FinishedAt         string  `json:"finishedAt,omitempty" doc:"RFC 3339 timestamp"`
+	DurationSeconds    float64 `json:"durationSeconds"`
+	HostNode           string  `json:"hostNode,omitempty" doc:"Kubernetes node the pod ran on"`
+	CapacityType       string  `json:"capacityType,omitempty" doc:"spot or on-demand, from the workflow's node selector"`
+	CPURequestMillis   int64   `json:"cpuRequestMillis" doc:"Requested CPU in millicores"`
+	MemoryRequestBytes int64   `json:"memoryRequestBytes" doc:"Requested memory in bytes"`
+}
+
+func toStageRun(run meta.StageRun) StageRun {
+	resp := StageRun{
+		Stage:              run.Stage,
+		Phase:              run.Phase,
+		StartedAt:          run.StartedAt.UTC().Format(time.RFC3339),
+		HostNode:           run.HostNode,
+		CapacityType:       run.CapacityType,
+		CPURequestMillis:   run.CPURequestMillis,
+		MemoryRequestBytes: run.MemoryRequestBytes,
+	}
+	if run.FinishedAt != nil {
+		resp.FinishedAt = run.FinishedAt.UTC().Format(time.RFC3339)
+		resp.DurationSeconds = run.FinishedAt.Sub(run.StartedAt).Seconds()
+	}
+	return resp
+}
+
+func (a *API) registerTaskUsageRoutes() {
+	huma.Register(a.api, huma.Operation{
+		OperationID: "task-uuid-usage-get",
+		Method:      http.MethodGet,
+		Path:        "/task/{uuid}/usage",
+		Summary:     "Gets the timing and resources of a task's stages",
+		Description: "Lists each run of the task's stages by start time, with the node it ran on, its capacity type and requested resources. Recorded when the task finishes; empty until then.",
+		Tags:        []string{"task"},
+	}, func(ctx context.Context, input *struct {
+		UUID  string `path:"uuid" doc:"UUID of the task"`
+		Token string `query:"token" doc:"Authentication token; required when SCALEODM_AUTH_ENABLED is set"`
+	}) (*struct{ Body []StageRun }, error) {
+		job, err := a.getJobForCaller(ctx, input.UUID)
+		if err != nil {
+			log.Printf("GET /task/%s/usage: failed to retrieve task metadata: %v", input.UUID, err)
+			return nil, huma.NewError(500, "Failed to retrieve task metadata", err)
+		}
+		if job == nil {
+			return nil, huma.NewError(404, "Task not found")
+		}
+
+		runs, err := a.metadataStore.ListStageRuns(ctx, input.UUID)
+		if err != nil {
+			log.Printf("GET /task/%s/usage: failed to list stage runs: %v", input.UUID, err)
+			return nil, huma.NewError(500, "Failed to retrieve task usage", err)
+		}
+		resp := &struct{ Body []StageRun }{Body: make([]StageRun, 0, len(runs))}
+		for _, run := range runs {
+			resp.Body = append(resp.Body, toStageRun(run))
+		}
+		return resp, nil
+	})
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/hotosm/scaleodm/app/meta"
+)
+
+func TestTaskUsage_RecordedWhenInfoSeesCompletion(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := meta.NewStore(db)
+	ctx := context.Background()
+	_, err := store.CreateJob(ctx, "wf-usage", "project", "s3://bucket/images/", "s3://bucket/output/", nil, "us-east-1", nil)
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateJobStatus(ctx, "wf-usage", "running", nil))
+
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	wf := &wfv1.Workflow{
+		ObjectMeta: metav1.ObjectMeta{Name: "wf-usage"},
+		Spec: wfv1.WorkflowSpec{
+			NodeSelector: map[string]string{"karpenter.sh/capacity-type": "spot"},
+			Templates: []wfv1.Template{{
+				Name: "main",
+				ContainerSet: &wfv1.ContainerSetTemplate{Containers: []wfv1.ContainerNode{
+					{Container: apiv1.Container{Name: "download"}},
+					{Container: apiv1.Container{Name: "process", Resources: apiv1.ResourceRequirements{Requests: apiv1.ResourceList{
+						apiv1.ResourceCPU:    resource.MustParse("4"),
+						apiv1.ResourceMemory: resource.MustParse("16Gi"),
+					}}}},
+				}},
+			}},
+		},
+		Status: wfv1.WorkflowStatus{
+			Phase: wfv1.WorkflowSucceeded,
+			Nodes: wfv1.Nodes{
+				"pod":      {TemplateName: "main", Type: wfv1.NodeTypePod, Phase: wfv1.NodeSucceeded, HostNodeName: "ip-10-0-1-5", StartedAt: metav1.NewTime(start), FinishedAt: metav1.NewTime(start.Add(40 * time.Minute)), Children: []string{"download", "process"}},
+				"download": {DisplayName: "download", Type: wfv1.NodeTypeContainer, Phase: wfv1.NodeSucceeded, StartedAt: metav1.NewTime(start), FinishedAt: metav1.NewTime(start.Add(2 * time.Minute))},
+				"process":  {DisplayName: "process", Type: wfv1.NodeTypeContainer, Phase: wfv1.NodeSucceeded, StartedAt: metav1.NewTime(start.Add(2 * time.Minute)), FinishedAt: metav1.NewTime(start.Add(38 * time.Minute))},
+			},
+		},
+	}
+	_, handler := NewAPI(store, &recordingWorkflowClient{getFn: func(context.Context, string) (*wfv1.Workflow, error) { return wf, nil }})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/task/wf-usage/usage", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `[]`, w.Body.String(), "nothing is recorded while the task runs")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/task/wf-usage/info", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/task/wf-usage/usage", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var runs []StageRun
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &runs))
+	require.Len(t, runs, 2)
+	assert.Equal(t, "download", runs[0].Stage)
+	assert.Equal(t, StageRun{
+		Stage:              "process",
+		Phase:              "Succeeded",
+		StartedAt:          "2026-10-16T09:02:00Z",
+		FinishedAt:         "2026-10-16T09:38:00Z",
+		DurationSeconds:    36 * 60,
+		HostNode:           "ip-10-0-1-5",
+		CapacityType:       "spot",
+		CPURequestMillis:   4000,
+		MemoryRequestBytes: 16 << 30,
+	}, runs[1])
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/task/wf-missing/usage", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
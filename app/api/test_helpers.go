@@ -30,7 +30,7 @@ func testDB(t *testing.T) (*db.DB, func()) {
 	cleanup := func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
-		_, _ = database.Pool.Exec(ctx, "TRUNCATE TABLE scaleodm_job_metadata CASCADE")
+		_, _ = database.Pool.Exec(ctx, "TRUNCATE TABLE scaleodm_job_metadata, scaleodm_job_events CASCADE")
 		database.Close()
 	}
 
@@ -0,0 +1,452 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/hotosm/scaleodm/app/auth"
+	"github.com/hotosm/scaleodm/app/config"
+	"github.com/hotosm/scaleodm/app/observability"
+	"github.com/hotosm/scaleodm/app/s3"
+)
+
+// NodeODM's chunked upload flow, as used by pyodm's Node.create_task() and
+// WebODM: init records the task parameters, upload streams image parts into
+// a per-session staging prefix, and commit creates the task exactly as
+// POST /task/new would, with the staging prefix as readS3Path.
+//
+// Session state lives next to the images in S3 rather than in memory, so the
+// three calls may land on different API replicas.
+
+const (
+	uploadSessionManifest    = "init.json"
+	uploadSessionImagesDir   = "images/"
+	uploadSessionOutputDir   = "output/"
+	uploadSessionManifestMax = 1 << 20
+	uploadInitFormMaxMemory  = 1 << 20
+	uploadImagesFormField    = "images"
+)
+
+var uploadSessionIDPattern = regexp.MustCompile(`^[a-f0-9-]{36}$`)
+
+// uploadSessionPath is the S3 prefix holding one upload session's manifest,
+// staged images and (by default) outputs.
+func uploadSessionPath(sessionID string) string {
+	return strings.TrimSuffix(config.SCALEODM_UPLOAD_STAGING_S3_PATH, "/") + "/" + sessionID + "/"
+}
+
+// sanitizeUploadFileName reduces a client-supplied multipart filename to a
+// single safe path segment. Browsers and pyodm may send full local paths.
+func sanitizeUploadFileName(name string) (string, error) {
+	name = strings.ReplaceAll(strings.TrimSpace(name), "\\", "/")
+	name = path.Base(name)
+	if name == "" || name == "." || name == ".." || name == "/" {
+		return "", errors.New("missing file name")
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f {
+			return "", fmt.Errorf("file name %q contains control characters", name)
+		}
+	}
+	return name, nil
+}
+
+// taskNewRequestFromForm maps NodeODM's form-encoded task fields onto
+// TaskNewRequest. Image source fields are ignored: the staging prefix is the
+// only input for an uploaded task.
+func taskNewRequestFromForm(values url.Values) (TaskNewRequest, error) {
+	req := TaskNewRequest{
+		Name:               values.Get("name"),
+		Options:            values.Get("options"),
+		Webhook:            values.Get("webhook"),
+		WriteS3Path:        values.Get("writeS3Path"),
+		S3Region:           values.Get("s3Region"),
+		ProcessingMode:     values.Get("processingMode"),
+		CapacityType:       values.Get("capacityType"),
+		OdmImage:           values.Get("odmImage"),
+		ExcludePaths:       values.Get("excludePaths"),
+		ReferenceDEMS3Path: values.Get("referenceDemS3Path"),
+		GCPS3Path:          values.Get("gcpS3Path"),
+		GeoS3Path:          values.Get("geoS3Path"),
+	}
+
+	if raw := strings.TrimSpace(values.Get("skipPostProcessing")); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return req, fmt.Errorf("invalid skipPostProcessing %q", raw)
+		}
+		req.SkipPostProcessing = parsed
+	}
+	if raw := strings.TrimSpace(values.Get("keepIntermediates")); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return req, fmt.Errorf("invalid keepIntermediates %q", raw)
+		}
+		req.KeepIntermediates = parsed
+	}
+	if raw := strings.TrimSpace(values.Get("dateCreated")); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return req, fmt.Errorf("invalid dateCreated %q", raw)
+		}
+		req.DateCreated = parsed
+	}
+	if raw := strings.TrimSpace(values.Get("s3ScanDepth")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return req, fmt.Errorf("invalid s3ScanDepth %q", raw)
+		}
+		req.S3ScanDepth = &parsed
+	}
+	if raw := strings.TrimSpace(values.Get("priority")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return req, fmt.Errorf("invalid priority %q", raw)
+		}
+		req.Priority = parsed
+	}
+	if raw := strings.TrimSpace(values.Get("useDefaultExcludes")); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return req, fmt.Errorf("invalid useDefaultExcludes %q", raw)
+		}
+		req.UseDefaultExcludes = &parsed
+	}
+	return req, nil
+}
+
+// parseUploadInitRequest accepts the init fields as JSON (matching
+// POST /task/new) or as a urlencoded/multipart form (what pyodm sends).
+func parseUploadInitRequest(r *http.Request) (TaskNewRequest, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		var req TaskNewRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, uploadSessionManifestMax)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			return req, fmt.Errorf("invalid JSON body: %w", err)
+		}
+		return req, nil
+	}
+
+	if err := r.ParseMultipartForm(uploadInitFormMaxMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return TaskNewRequest{}, fmt.Errorf("invalid form body: %w", err)
+	}
+	return taskNewRequestFromForm(r.Form)
+}
+
+// stagingClient returns the S3 client for the staging prefix, or writes the
+// appropriate error response and returns nil.
+func stagingClient(w http.ResponseWriter, route string) *minio.Client {
+	if config.SCALEODM_UPLOAD_STAGING_S3_PATH == "" {
+		writeJSONError(w, http.StatusNotImplemented, "Chunked upload is not enabled on this node; use POST /task/new with readS3Path")
+		return nil
+	}
+	client, err := s3.GetS3ClientForEndpoint(config.AWS_S3_ENDPOINT)
+	if err != nil {
+		log.Printf("%s: failed to construct S3 client for staging: %v", route, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to initialize S3 client")
+		return nil
+	}
+	return client
+}
+
+// uploadSession is the manifest written by init: the task request plus the
+// tenant that opened the session.
+type uploadSession struct {
+	TaskNewRequest
+	Tenant string `json:"tenant,omitempty"`
+	// Identity holds the set-uuid and Idempotency-Key sent to init; the
+	// task is only created at commit. Without a set-uuid the task takes the
+	// session's UUID, so of two commits racing on one session only the
+	// first can create it.
+	Identity taskIdentity `json:"identity"`
+}
+
+// loadUploadSession reads the manifest written by init. A missing manifest
+// means the session never existed or was already committed; a session opened
+// by another tenant is reported the same way.
+func loadUploadSession(ctx context.Context, client *minio.Client, sessionID, tenant string) (*uploadSession, error) {
+	data, err := s3.ReadObjectInS3Path(ctx, client, uploadSessionPath(sessionID), uploadSessionManifest, uploadSessionManifestMax)
+	if errors.Is(err, s3.ErrObjectNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var session uploadSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("corrupt upload session manifest: %w", err)
+	}
+	if tenant != "" && session.Tenant != tenant {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+// handleTaskNewInit implements POST /task/new/init.
+func (a *API) handleTaskNewInit(w http.ResponseWriter, r *http.Request) {
+	const route = "POST /task/new/init"
+	client := stagingClient(w, route)
+	if client == nil {
+		return
+	}
+
+	req, err := parseUploadInitRequest(r)
+	if err != nil {
+		log.Printf("%s: %v", route, err)
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.ReadS3Path != "" || req.ZipURL != "" || req.S3Endpoint != "" {
+		writeJSONError(w, http.StatusBadRequest, "readS3Path, zipurl and s3Endpoint cannot be combined with chunked upload")
+		return
+	}
+
+	identity, err := newTaskIdentity(r.Header.Get("set-uuid"), r.Header.Get("Idempotency-Key"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sessionID := uuid.NewString()
+	if identity.UUID == "" {
+		identity.UUID = sessionID
+	}
+	manifest, err := json.Marshal(uploadSession{TaskNewRequest: req, Tenant: auth.TenantFromContext(r.Context()), Identity: identity})
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to encode upload session")
+		return
+	}
+	if _, err := s3.PutObjectInS3Path(r.Context(), client, uploadSessionPath(sessionID), uploadSessionManifest, bytes.NewReader(manifest), int64(len(manifest)), "application/json"); err != nil {
+		log.Printf("%s: failed to write session manifest session=%q: %v", route, sessionID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to create upload session")
+		return
+	}
+
+	log.Printf("%s: created upload session=%q name=%q token_provided=%t setUUID=%q idempotencyKey_set=%t", route, sessionID, req.Name, r.URL.Query().Get("token") != "", identity.UUID, identity.IdempotencyKey != "")
+	writeJSON(w, http.StatusOK, map[string]string{"uuid": sessionID})
+}
+
+// handleTaskNewUpload implements POST /task/new/upload/{uuid}. Each "images"
+// part is streamed straight to S3 so the API never buffers a whole image.
+func (a *API) handleTaskNewUpload(w http.ResponseWriter, r *http.Request) {
+	const route = "POST /task/new/upload"
+	sessionID := r.PathValue("uuid")
+	if !uploadSessionIDPattern.MatchString(sessionID) {
+		writeJSONError(w, http.StatusNotFound, "Upload session not found")
+		return
+	}
+	client := stagingClient(w, route)
+	if client == nil {
+		return
+	}
+
+	session, err := loadUploadSession(r.Context(), client, sessionID, auth.TenantFromContext(r.Context()))
+	if err != nil {
+		log.Printf("%s: failed to load session=%q: %v", route, sessionID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load upload session")
+		return
+	}
+	if session == nil {
+		writeJSONError(w, http.StatusNotFound, "Upload session not found")
+		return
+	}
+
+	// Image batches routinely outlast the server-wide read timeout, which is
+	// sized for JSON calls. Lift it for this request only.
+	if err := http.NewResponseController(w).SetReadDeadline(time.Time{}); err != nil {
+		log.Printf("%s: could not clear read deadline session=%q: %v", route, sessionID, err)
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Expected a multipart/form-data body")
+		return
+	}
+
+	imagesPath := uploadSessionPath(sessionID) + uploadSessionImagesDir
+	uploaded := 0
+	var uploadedBytes int64
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			log.Printf("%s: malformed multipart body session=%q: %v", route, sessionID, err)
+			writeJSONError(w, http.StatusBadRequest, "Malformed multipart body")
+			return
+		}
+		if part.FormName() != uploadImagesFormField || part.FileName() == "" {
+			_ = part.Close()
+			continue
+		}
+
+		fileName, err := sanitizeUploadFileName(part.FileName())
+		if err != nil {
+			_ = part.Close()
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		contentType := part.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		size, err := s3.PutObjectInS3Path(r.Context(), client, imagesPath, fileName, part, -1, contentType)
+		_ = part.Close()
+		if err != nil {
+			log.Printf("%s: failed to stage file=%q session=%q: %v", route, fileName, sessionID, err)
+			writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to store %s", fileName))
+			return
+		}
+		uploaded++
+		uploadedBytes += size
+	}
+
+	if uploaded == 0 {
+		writeJSONError(w, http.StatusBadRequest, "No files were uploaded (expected form field \"images\")")
+		return
+	}
+
+	log.Printf("%s: staged files=%d bytes=%d session=%q", route, uploaded, uploadedBytes, sessionID)
+	writeJSON(w, http.StatusOK, Response{Success: true})
+}
+
+// replayCommit is replayTask for a commit of the closed session sessionID.
+// The request went with the session's manifest, so rather than comparing
+// fingerprints it checks that the task under key was created from the
+// session's staged images; one that was not gets the same 422.
+func (a *API) replayCommit(ctx context.Context, sessionID, key string) (string, error) {
+	job, err := a.metadataStore.GetJobByIdempotencyKey(ctx, auth.TenantFromContext(ctx), key)
+	if err != nil {
+		return "", huma.NewError(500, "Failed to look up Idempotency-Key", err)
+	}
+	if job == nil {
+		return "", nil
+	}
+	if job.ReadS3Path != uploadSessionPath(sessionID)+uploadSessionImagesDir {
+		return "", huma.NewError(422, fmt.Sprintf("Idempotency-Key was already used for a different request (task %s)", job.WorkflowName))
+	}
+	return job.WorkflowName, nil
+}
+
+// handleTaskNewCommit implements POST /task/new/commit/{uuid}. It hands the
+// staged prefix to createTask, so validation, sizing and metadata are shared
+// with POST /task/new. The returned uuid is the new task's: the session's own
+// uuid unless init was given a set-uuid.
+func (a *API) handleTaskNewCommit(w http.ResponseWriter, r *http.Request) {
+	const route = "POST /task/new/commit"
+	sessionID := r.PathValue("uuid")
+	if !uploadSessionIDPattern.MatchString(sessionID) {
+		writeJSONError(w, http.StatusNotFound, "Upload session not found")
+		return
+	}
+	client := stagingClient(w, route)
+	if client == nil {
+		return
+	}
+
+	start := time.Now()
+	metricResult := "failure"
+	metricReason := "unknown"
+	ctx, span := observability.Tracer().Start(r.Context(), "task.new.commit")
+	defer func() {
+		span.SetAttributes(
+			attribute.String("task.new.result", metricResult),
+			attribute.String("task.new.reason", metricReason),
+		)
+		span.End()
+		observability.RecordTaskNew(metricResult, metricReason, time.Since(start))
+	}()
+
+	session, err := loadUploadSession(ctx, client, sessionID, auth.TenantFromContext(ctx))
+	if err != nil {
+		metricReason = "upload_session_load_failed"
+		log.Printf("%s: failed to load session=%q: %v", route, sessionID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load upload session")
+		return
+	}
+	if session == nil {
+		// A retried commit finds the session closed; with the same
+		// Idempotency-Key it still gets the task the first commit created.
+		if key := strings.TrimSpace(r.Header.Get("Idempotency-Key")); key != "" && a.metadataStore != nil {
+			existing, err := a.replayCommit(ctx, sessionID, key)
+			if err != nil {
+				metricReason = "idempotency_key_conflict"
+				log.Printf("%s: rejected Idempotency-Key=%q for closed session=%q: %v", route, key, sessionID, err)
+				status := http.StatusInternalServerError
+				var statusErr huma.StatusError
+				if errors.As(err, &statusErr) {
+					status = statusErr.GetStatus()
+				}
+				writeJSONError(w, status, err.Error())
+				return
+			}
+			if existing != "" {
+				metricResult, metricReason = "success", "idempotent_replay"
+				writeJSON(w, http.StatusOK, map[string]string{"uuid": existing})
+				return
+			}
+		}
+		metricReason = "upload_session_not_found"
+		writeJSONError(w, http.StatusNotFound, "Upload session not found")
+		return
+	}
+
+	identity := session.Identity
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		override, err := newTaskIdentity(identity.UUID, key)
+		if err != nil {
+			metricReason = "invalid_task_identity"
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		identity = override
+	}
+
+	req := session.TaskNewRequest
+	sessionPath := uploadSessionPath(sessionID)
+	req.ReadS3Path = sessionPath + uploadSessionImagesDir
+	if req.WriteS3Path == "" {
+		req.WriteS3Path = sessionPath + uploadSessionOutputDir
+	}
+
+	taskUUID, reason, err := a.createTask(ctx, route, req, identity)
+	metricReason = reason
+	if err != nil {
+		status := http.StatusInternalServerError
+		var statusErr huma.StatusError
+		if errors.As(err, &statusErr) {
+			status = statusErr.GetStatus()
+		}
+		writeJSONError(w, status, err.Error())
+		return
+	}
+	metricResult = "success"
+
+	// Drop the manifest so a retried commit gets a 404 rather than a 409.
+	// The staged images stay: the workflow's download stage reads them.
+	if err := s3.RemoveObjectInS3Path(ctx, client, sessionPath, uploadSessionManifest); err != nil {
+		log.Printf("%s: task=%q created but failed to close session=%q: %v", route, taskUUID, sessionID, err)
+	}
+
+	log.Printf("%s: committed session=%q as task=%q", route, sessionID, taskUUID)
+	writeJSON(w, http.StatusOK, map[string]string{"uuid": taskUUID})
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hotosm/scaleodm/app/config"
+	"github.com/hotosm/scaleodm/app/meta"
+	"github.com/hotosm/scaleodm/app/s3"
+	"github.com/hotosm/scaleodm/testutil"
+)
+
+func TestSanitizeUploadFileName(t *testing.T) {
+	for input, expected := range map[string]string{
+		"DJI_0001.JPG":                 "DJI_0001.JPG",
+		"/home/user/flight/DJI_02.jpg": "DJI_02.jpg",
+		`C:\flights\DJI 0003.jpg`:      "DJI 0003.jpg",
+	} {
+		name, err := sanitizeUploadFileName(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, expected, name)
+	}
+
+	for _, input := range []string{"", "..", "/", "bad\nname.jpg"} {
+		_, err := sanitizeUploadFileName(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestTaskNewRequestFromForm(t *testing.T) {
+	values := url.Values{
+		"name":               {"my-project"},
+		"options":            {`[{"name":"dsm","value":true}]`},
+		"skipPostProcessing": {"true"},
+		"keepIntermediates":  {"true"},
+		"s3ScanDepth":        {"2"},
+		"useDefaultExcludes": {"false"},
+		"readS3Path":         {"s3://ignored/"},
+	}
+	req, err := taskNewRequestFromForm(values)
+	require.NoError(t, err)
+	assert.Equal(t, "my-project", req.Name)
+	assert.Equal(t, `[{"name":"dsm","value":true}]`, req.Options)
+	assert.True(t, req.SkipPostProcessing)
+	assert.True(t, req.KeepIntermediates)
+	require.NotNil(t, req.S3ScanDepth)
+	assert.Equal(t, 2, *req.S3ScanDepth)
+	require.NotNil(t, req.UseDefaultExcludes)
+	assert.False(t, *req.UseDefaultExcludes)
+	assert.Empty(t, req.ReadS3Path)
+
+	_, err = taskNewRequestFromForm(url.Values{"s3ScanDepth": {"deep"}})
+	assert.Error(t, err)
+}
+
+func TestTaskNewChunkedUpload_DisabledWithoutStagingPath(t *testing.T) {
+	original := config.SCALEODM_UPLOAD_STAGING_S3_PATH
+	defer func() { config.SCALEODM_UPLOAD_STAGING_S3_PATH = original }()
+	config.SCALEODM_UPLOAD_STAGING_S3_PATH = ""
+
+	_, handler := NewAPI(nil, &recordingWorkflowClient{})
+
+	for _, target := range []string{
+		"/task/new/init",
+		"/task/new/upload/0b9c1f6e-6d0c-4a3e-9a55-1f2d3c4b5a69",
+		"/task/new/commit/0b9c1f6e-6d0c-4a3e-9a55-1f2d3c4b5a69",
+	} {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader("name=test"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotImplemented, w.Code, target)
+		assert.Contains(t, w.Body.String(), `"error"`, target)
+	}
+}
+
+func TestTaskNewInit_PinsTaskUUID(t *testing.T) {
+	ctx := context.Background()
+	bucket := "test-bucket-upload-init"
+	require.NoError(t, testutil.SetupTestS3Bucket(ctx, bucket))
+
+	originalStaging, originalEndpoint := config.SCALEODM_UPLOAD_STAGING_S3_PATH, config.AWS_S3_ENDPOINT
+	defer func() {
+		config.SCALEODM_UPLOAD_STAGING_S3_PATH, config.AWS_S3_ENDPOINT = originalStaging, originalEndpoint
+	}()
+	config.SCALEODM_UPLOAD_STAGING_S3_PATH = "s3://" + bucket + "/uploads/"
+	config.AWS_S3_ENDPOINT = "http://" + testutil.TestS3Endpoint()
+
+	_, handler := NewAPI(nil, &recordingWorkflowClient{})
+	client, err := s3.GetS3ClientForEndpoint(config.AWS_S3_ENDPOINT)
+	require.NoError(t, err)
+
+	initSession := func(setUUID string) (string, *uploadSession) {
+		req := httptest.NewRequest(http.MethodPost, "/task/new/init", strings.NewReader("name=test"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if setUUID != "" {
+			req.Header.Set("set-uuid", setUUID)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var body map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		session, err := loadUploadSession(ctx, client, body["uuid"], "")
+		require.NoError(t, err)
+		require.NotNil(t, session)
+		return body["uuid"], session
+	}
+
+	// Every commit of the session creates the task named after it, so only
+	// the first can succeed.
+	sessionID, session := initSession("")
+	assert.Equal(t, sessionID, session.Identity.UUID)
+
+	_, session = initSession("0B9C1F6E-6D0C-4A3E-9A55-1F2D3C4B5A69")
+	assert.Equal(t, "0b9c1f6e-6d0c-4a3e-9a55-1f2d3c4b5a69", session.Identity.UUID)
+}
+
+func TestTaskNewCommit_ClosedSessionReplaysOnlyItsOwnTask(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	bucket := "test-bucket-upload-replay"
+	require.NoError(t, testutil.SetupTestS3Bucket(ctx, bucket))
+
+	originalStaging, originalEndpoint := config.SCALEODM_UPLOAD_STAGING_S3_PATH, config.AWS_S3_ENDPOINT
+	defer func() {
+		config.SCALEODM_UPLOAD_STAGING_S3_PATH, config.AWS_S3_ENDPOINT = originalStaging, originalEndpoint
+	}()
+	config.SCALEODM_UPLOAD_STAGING_S3_PATH = "s3://" + bucket + "/uploads/"
+	config.AWS_S3_ENDPOINT = "http://" + testutil.TestS3Endpoint()
+
+	metadataStore := meta.NewStore(db)
+	sessionID := "0b9c1f6e-6d0c-4a3e-9a55-1f2d3c4b5a69"
+	_, err := metadataStore.InsertJob(ctx, meta.NewJob{
+		WorkflowName:   sessionID,
+		ProjectID:      "test-project",
+		ReadPath:       uploadSessionPath(sessionID) + uploadSessionImagesDir,
+		WritePath:      uploadSessionPath(sessionID) + uploadSessionOutputDir,
+		IdempotencyKey: "commit-1",
+	})
+	require.NoError(t, err)
+	_, err = metadataStore.InsertJob(ctx, meta.NewJob{
+		WorkflowName:   "wf-other-request",
+		ProjectID:      "test-project",
+		ReadPath:       "s3://bucket/images/",
+		WritePath:      "s3://bucket/output/",
+		IdempotencyKey: "other-1",
+	})
+	require.NoError(t, err)
+
+	_, handler := NewAPI(metadataStore, &recordingWorkflowClient{})
+	commit := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/task/new/commit/"+sessionID, nil)
+		req.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := commit("commit-1")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), sessionID)
+
+	w = commit("other-1")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+
+	w = commit("unused-1")
+	assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+}
@@ -0,0 +1,181 @@
+// Package auth resolves NodeODM API tokens to a Principal.
+//
+// Tokens arrive the NodeODM way (?token=...) or as an Authorization: Bearer
+// header. Authenticators are pluggable: a static list from configuration, API
+// tokens stored hashed in Postgres, or a Chain of both.
+package auth
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrMissingToken means the request carried no token at all (HTTP 401).
+	ErrMissingToken = errors.New("authentication token required")
+	// ErrInvalidToken means a token was supplied but is unknown, revoked or
+	// expired (HTTP 403).
+	ErrInvalidToken = errors.New("invalid authentication token")
+)
+
+// Principal identifies the caller behind a token.
+type Principal struct {
+	// Name is the label the token was issued under, e.g. "dronetm".
+	Name string
+	// Source is the authenticator that accepted the token ("static", "db").
+	Source string
+	// Tenant owns the tasks created with this token and scopes what the
+	// caller can list, read and mutate. Defaults to Name.
+	Tenant string
+}
+
+// Authenticator resolves a raw token to a Principal. Implementations return
+// ErrInvalidToken for unknown tokens; any other error is an internal failure.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Principal, error)
+}
+
+// HashToken returns the hex SHA-256 of a token. Tokens are high-entropy
+// secrets, so a fast unsalted hash is sufficient and keeps lookups indexable.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenFromRequest extracts the token from the NodeODM query parameter or,
+// failing that, a Bearer Authorization header.
+func TokenFromRequest(r *http.Request) string {
+	if token := strings.TrimSpace(r.URL.Query().Get("token")); token != "" {
+		return token
+	}
+	scheme, value, ok := strings.Cut(strings.TrimSpace(r.Header.Get("Authorization")), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(value)
+	}
+	return ""
+}
+
+type staticToken struct {
+	hash []byte
+	name string
+}
+
+// StaticAuthenticator accepts a fixed set of tokens from configuration.
+type StaticAuthenticator struct {
+	tokens []staticToken
+}
+
+// NewStaticAuthenticator parses a comma-separated token list. Each entry is
+// either "name:token" or a bare token, which is named "static-N".
+func NewStaticAuthenticator(raw string) (*StaticAuthenticator, error) {
+	a := &StaticAuthenticator{}
+	for i, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name := fmt.Sprintf("static-%d", i+1)
+		token := entry
+		if key, value, ok := strings.Cut(entry, ":"); ok {
+			name = strings.TrimSpace(key)
+			token = strings.TrimSpace(value)
+		}
+		if name == "" || token == "" {
+			return nil, fmt.Errorf("invalid static token entry %d (expected name:token)", i+1)
+		}
+		sum := sha256.Sum256([]byte(token))
+		a.tokens = append(a.tokens, staticToken{hash: sum[:], name: name})
+	}
+	return a, nil
+}
+
+// Len reports how many tokens are configured.
+func (a *StaticAuthenticator) Len() int {
+	return len(a.tokens)
+}
+
+func (a *StaticAuthenticator) Authenticate(_ context.Context, token string) (*Principal, error) {
+	sum := sha256.Sum256([]byte(token))
+	// Compare against every entry so timing doesn't reveal which one matched.
+	var match *staticToken
+	for i := range a.tokens {
+		if subtle.ConstantTimeCompare(sum[:], a.tokens[i].hash) == 1 {
+			match = &a.tokens[i]
+		}
+	}
+	if match == nil {
+		return nil, ErrInvalidToken
+	}
+	return &Principal{Name: match.name, Source: "static", Tenant: match.name}, nil
+}
+
+// TokenLookup finds a live (unrevoked, unexpired) token by its hash and
+// returns the name it was issued under and its tenant, or "" when there is
+// none. meta.Store implements it.
+type TokenLookup interface {
+	LookupAPIToken(ctx context.Context, tokenHash string) (name, tenant string, err error)
+}
+
+// StoreAuthenticator accepts tokens whose hashes are stored in Postgres.
+type StoreAuthenticator struct {
+	lookup TokenLookup
+}
+
+func NewStoreAuthenticator(lookup TokenLookup) *StoreAuthenticator {
+	return &StoreAuthenticator{lookup: lookup}
+}
+
+func (a *StoreAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	name, tenant, err := a.lookup.LookupAPIToken(ctx, HashToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("token lookup failed: %w", err)
+	}
+	if name == "" {
+		return nil, ErrInvalidToken
+	}
+	return &Principal{Name: name, Source: "db", Tenant: cmp.Or(tenant, name)}, nil
+}
+
+// Chain tries each authenticator in order and accepts the first match.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	for _, a := range c {
+		principal, err := a.Authenticate(ctx, token)
+		if errors.Is(err, ErrInvalidToken) {
+			continue
+		}
+		return principal, err
+	}
+	return nil, ErrInvalidToken
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the authenticated caller.
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the authenticated caller, or nil when auth is
+// disabled or the route is unauthenticated.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// TenantFromContext returns the caller's tenant, or "" when there is no
+// authenticated caller and task visibility is unscoped.
+func TenantFromContext(ctx context.Context) string {
+	if principal := PrincipalFromContext(ctx); principal != nil {
+		return principal.Tenant
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLookup map[string][2]string
+
+func (f fakeLookup) LookupAPIToken(_ context.Context, tokenHash string) (string, string, error) {
+	entry := f[tokenHash]
+	return entry[0], entry[1], nil
+}
+
+func TestStaticAuthenticator(t *testing.T) {
+	a, err := NewStaticAuthenticator("dronetm:s3cret, bare-token ,")
+	require.NoError(t, err)
+	assert.Equal(t, 2, a.Len())
+
+	principal, err := a.Authenticate(context.Background(), "s3cret")
+	require.NoError(t, err)
+	assert.Equal(t, "dronetm", principal.Name)
+	assert.Equal(t, "static", principal.Source)
+	assert.Equal(t, "dronetm", principal.Tenant)
+
+	principal, err = a.Authenticate(context.Background(), "bare-token")
+	require.NoError(t, err)
+	assert.Equal(t, "static-2", principal.Name)
+
+	_, err = a.Authenticate(context.Background(), "wrong")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = NewStaticAuthenticator("name:")
+	assert.Error(t, err)
+}
+
+func TestChainFallsThroughToStore(t *testing.T) {
+	static, err := NewStaticAuthenticator("ops:static-token")
+	require.NoError(t, err)
+	chain := Chain{static, NewStoreAuthenticator(fakeLookup{
+		HashToken("db-token"):     {"webodm", ""},
+		HashToken("tenant-token"): {"fair-ci", "fair"},
+	})}
+
+	principal, err := chain.Authenticate(context.Background(), "db-token")
+	require.NoError(t, err)
+	assert.Equal(t, "webodm", principal.Name)
+	assert.Equal(t, "db", principal.Source)
+	assert.Equal(t, "webodm", principal.Tenant)
+
+	principal, err = chain.Authenticate(context.Background(), "tenant-token")
+	require.NoError(t, err)
+	assert.Equal(t, "fair", principal.Tenant)
+
+	_, err = chain.Authenticate(context.Background(), "nope")
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+}
+
+func TestTokenFromRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/task/list?token=query-token", nil)
+	r.Header.Set("Authorization", "Bearer header-token")
+	assert.Equal(t, "query-token", TokenFromRequest(r))
+
+	r = httptest.NewRequest("GET", "/task/list", nil)
+	r.Header.Set("Authorization", "bearer header-token")
+	assert.Equal(t, "header-token", TokenFromRequest(r))
+
+	r = httptest.NewRequest("GET", "/task/list", nil)
+	r.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	assert.Empty(t, TokenFromRequest(r))
+}
+
+func TestPrincipalContext(t *testing.T) {
+	assert.Nil(t, PrincipalFromContext(context.Background()))
+	assert.Empty(t, TenantFromContext(context.Background()))
+	ctx := WithPrincipal(context.Background(), &Principal{Name: "dronetm", Tenant: "hot"})
+	assert.Equal(t, "dronetm", PrincipalFromContext(ctx).Name)
+	assert.Equal(t, "hot", TenantFromContext(ctx))
+}
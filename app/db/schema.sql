@@ -5,7 +5,7 @@ CREATE TABLE IF NOT EXISTS scaleodm_job_metadata (
     workflow_name TEXT NOT NULL UNIQUE,
     odm_project_id TEXT NOT NULL,
     job_type TEXT DEFAULT 'standard' CONSTRAINT job_type_check
-        CHECK (job_type IN ('standard', 'splitmerge')),
+        CHECK (job_type IN ('standard', 'splitmerge', 'merge', 'cityscale')),
     job_status TEXT DEFAULT 'queued' CONSTRAINT job_queue_status_check
         CHECK (job_status IN ('queued', 'claimed', 'running', 'failed', 'completed', 'canceled')),
     read_s3_path TEXT NOT NULL,
@@ -20,12 +20,194 @@ CREATE TABLE IF NOT EXISTS scaleodm_job_metadata (
     -- finishedAt) captured by the reconciler on terminal failure. Independent
     -- of Argo workflow CR TTL and any log archive state - lives forever.
     failure_details JSONB,
+    -- Owning tenant (from the API token). NULL for tasks created with auth
+    -- disabled; those are only visible to unscoped callers.
+    tenant TEXT,
+    -- Dispatch queue (SCALEODM_QUEUE_ENABLED). pipeline_config holds the
+    -- workflow config for jobs ScaleODM submits itself; it is NULL for jobs
+    -- submitted straight to Argo. Higher priority dispatches first.
+    priority INTEGER NOT NULL DEFAULT 0,
+    pipeline_config JSONB,
+    claimed_at TIMESTAMPTZ,
+    dispatched_at TIMESTAMPTZ,
+    dispatch_attempts INTEGER NOT NULL DEFAULT 0,
+    -- Client-supplied Idempotency-Key of the /task/new request that created
+    -- the job; a repeat of that request returns this job.
+    idempotency_key TEXT,
     metadata JSONB
 );
 
+-- API tokens for the NodeODM API. Only the SHA-256 hex of each token is
+-- stored; issue one with:
+--   INSERT INTO scaleodm_api_tokens (name, tenant, token_hash)
+--   VALUES ('my-client', 'my-project', encode(sha256('<token>'::bytea), 'hex'));
+-- tenant scopes task visibility and defaults to name when NULL.
+CREATE TABLE IF NOT EXISTS scaleodm_api_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    tenant TEXT,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    expires_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+-- Per-tenant quota overrides. NULL columns fall back to the
+-- SCALEODM_QUOTA_* defaults; 0 means unlimited.
+CREATE TABLE IF NOT EXISTS scaleodm_tenant_quotas (
+    tenant TEXT PRIMARY KEY,
+    max_concurrent_tasks INTEGER,
+    max_images_per_task INTEGER,
+    max_workspace_gib DOUBLE PRECISION,
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Option catalogs read from ODM images, keyed by image reference, so each
+-- image is only inspected once.
+CREATE TABLE IF NOT EXISTS scaleodm_odm_option_catalogs (
+    odm_image TEXT PRIMARY KEY,
+    options JSONB NOT NULL,
+    extracted_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- CRC-32s of the entries of a task's synthetic all.zip, recorded as they are
+-- streamed so a later Range request can resume the download. etag identifies
+-- the listing the CRCs belong to.
+CREATE TABLE IF NOT EXISTS scaleodm_zip_manifests (
+    workflow_name TEXT PRIMARY KEY
+        REFERENCES scaleodm_job_metadata(workflow_name) ON DELETE CASCADE,
+    etag TEXT NOT NULL,
+    crcs JSONB NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Per-tenant webhook signing secrets. A tenant without a row, and tasks with
+-- no tenant, are signed with SCALEODM_WEBHOOK_SECRET.
+CREATE TABLE IF NOT EXISTS scaleodm_tenant_webhook_secrets (
+    tenant TEXT PRIMARY KEY,
+    secret TEXT NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Webhook outbox. A row is queued in the same transaction as the terminal
+-- status update of a task with a webhook, and the delivery worker POSTs it
+-- until it is delivered or, after SCALEODM_WEBHOOK_MAX_ATTEMPTS, dead. The
+-- payload is rendered on the first attempt and resent as is. No foreign key:
+-- a delivery outlives the removal of its task.
+CREATE TABLE IF NOT EXISTS scaleodm_webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    workflow_name TEXT NOT NULL,
+    tenant TEXT,
+    url TEXT NOT NULL,
+    job_status TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CONSTRAINT webhook_delivery_status_check
+        CHECK (status IN ('pending', 'delivered', 'dead')),
+    payload JSONB,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    delivered_at TIMESTAMPTZ
+);
+
+-- Task timelines: creation, status changes with who made them and why,
+-- dispatches and restarts. Rows are written in the transaction of the change
+-- they record; a restart moves them to the new workflow name, and removing a
+-- task removes them. No foreign key, since a restart replaces the job row.
+CREATE TABLE IF NOT EXISTS scaleodm_job_events (
+    id BIGSERIAL PRIMARY KEY,
+    workflow_name TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    from_status TEXT,
+    to_status TEXT,
+    actor TEXT NOT NULL,
+    reason TEXT,
+    message TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Timing and resources of each run of a finished task's stages (a container
+-- of a single-pod pipeline, a pod of a DAG pipeline), captured from the Argo
+-- workflow when the task finishes. Keyed by the Argo node, so capturing twice
+-- is harmless.
+CREATE TABLE IF NOT EXISTS scaleodm_job_stage_runs (
+    workflow_name TEXT NOT NULL
+        REFERENCES scaleodm_job_metadata(workflow_name) ON DELETE CASCADE,
+    node_id TEXT NOT NULL,
+    stage TEXT NOT NULL,
+    phase TEXT NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ,
+    host_node TEXT,
+    capacity_type TEXT,
+    cpu_request_millis BIGINT NOT NULL DEFAULT 0,
+    memory_request_bytes BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (workflow_name, node_id)
+);
+
+-- Peak memory and workspace of finished single-pod ODM runs, against the
+-- task's size and flags, for the learned sizing estimator. Not tied to the
+-- job row, so the history outlives removed tasks.
+CREATE TABLE IF NOT EXISTS scaleodm_resource_observations (
+    workflow_name TEXT PRIMARY KEY,
+    profile TEXT NOT NULL,
+    image_count INTEGER NOT NULL,
+    image_total_bytes BIGINT NOT NULL DEFAULT 0,
+    odm_flags JSONB NOT NULL DEFAULT '[]'::jsonb,
+    peak_memory_bytes BIGINT NOT NULL DEFAULT 0,
+    peak_anon_bytes BIGINT NOT NULL DEFAULT 0,
+    peak_swap_bytes BIGINT NOT NULL DEFAULT 0,
+    workspace_peak_bytes BIGINT NOT NULL DEFAULT 0,
+    observed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Task event subscriptions. Each status change of a task is published as a
+-- CloudEvent to the target (an HTTP URL, NATS subject or NOTIFY channel, per
+-- SCALEODM_EVENTS_SINK) of every row whose tenant and project match; NULL
+-- matches any.
+CREATE TABLE IF NOT EXISTS scaleodm_event_subscriptions (
+    id BIGSERIAL PRIMARY KEY,
+    tenant TEXT,
+    odm_project_id TEXT,
+    target TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
 -- Idempotent column migration for existing deployments.
 ALTER TABLE scaleodm_job_metadata
     ADD COLUMN IF NOT EXISTS failure_details JSONB;
+ALTER TABLE scaleodm_job_metadata
+    ADD COLUMN IF NOT EXISTS tenant TEXT;
+ALTER TABLE scaleodm_job_metadata
+    ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE scaleodm_job_metadata
+    ADD COLUMN IF NOT EXISTS pipeline_config JSONB;
+ALTER TABLE scaleodm_job_metadata
+    ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMPTZ;
+ALTER TABLE scaleodm_job_metadata
+    ADD COLUMN IF NOT EXISTS dispatched_at TIMESTAMPTZ;
+ALTER TABLE scaleodm_job_metadata
+    ADD COLUMN IF NOT EXISTS dispatch_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE scaleodm_job_metadata
+    ADD COLUMN IF NOT EXISTS idempotency_key TEXT;
+-- Widen job_type_check for deployments created before the 'merge' and
+-- 'cityscale' types. The constraint is only replaced while it lacks one of
+-- them, so later boots do not re-validate every row.
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint
+        WHERE conrelid = 'scaleodm_job_metadata'::regclass
+          AND conname = 'job_type_check'
+          AND pg_get_constraintdef(oid) LIKE '%''merge''%'
+          AND pg_get_constraintdef(oid) LIKE '%''cityscale''%'
+    ) THEN
+        ALTER TABLE scaleodm_job_metadata
+            DROP CONSTRAINT IF EXISTS job_type_check;
+        ALTER TABLE scaleodm_job_metadata
+            ADD CONSTRAINT job_type_check CHECK (job_type IN ('standard', 'splitmerge', 'merge', 'cityscale'));
+    END IF;
+END $$;
 
 -- Indexes
 
@@ -40,3 +222,30 @@ CREATE INDEX IF NOT EXISTS idx_job_status
 -- Index for project lookups
 CREATE INDEX IF NOT EXISTS idx_project_id
     ON scaleodm_job_metadata(odm_project_id, created_at DESC);
+
+-- Index for tenant-scoped listings
+CREATE INDEX IF NOT EXISTS idx_tenant
+    ON scaleodm_job_metadata(tenant, created_at DESC);
+
+-- One job per Idempotency-Key within a tenant
+CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_key
+    ON scaleodm_job_metadata(COALESCE(tenant, ''), idempotency_key)
+    WHERE idempotency_key IS NOT NULL;
+
+-- Index for the dispatcher's claim query (jobs awaiting dispatch)
+CREATE INDEX IF NOT EXISTS idx_dispatch_queue
+    ON scaleodm_job_metadata(priority DESC, created_at)
+    WHERE job_status = 'queued' AND pipeline_config IS NOT NULL AND dispatched_at IS NULL;
+
+-- Index for a task's timeline
+CREATE INDEX IF NOT EXISTS idx_job_events_workflow
+    ON scaleodm_job_events(workflow_name, id);
+
+-- Index for the estimator's most recent observations
+CREATE INDEX IF NOT EXISTS idx_resource_observations_observed_at
+    ON scaleodm_resource_observations(observed_at DESC);
+
+-- Index for the webhook worker's claim query (deliveries due)
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due
+    ON scaleodm_webhook_deliveries(next_attempt_at)
+    WHERE status = 'pending';
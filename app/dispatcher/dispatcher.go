@@ -0,0 +1,154 @@
+// Package dispatcher submits queued jobs to Argo.
+//
+// With SCALEODM_QUEUE_ENABLED, POST /task/new and /task/restart store the
+// workflow config on the job row instead of creating the workflow. This
+// goroutine, started alongside the reconciler, claims those jobs and
+// submits them in order:
+//
+//  1. priority, highest first;
+//  2. fair-share: the project with the fewest claimed/running workflows first,
+//     so one large job's follow-ups don't starve a burst of small tasks;
+//  3. age, oldest first.
+//
+// SCALEODM_QUEUE_MAX_ACTIVE_WORKFLOWS caps claimed+running jobs cluster-wide.
+// Claims use SELECT ... FOR UPDATE SKIP LOCKED under an advisory lock, so
+// several replicas can run dispatchers safely.
+//
+// Workflow names are chosen when the task is queued, which keeps the task
+// UUID stable and makes submission idempotent: if a replica dies after
+// creating the workflow but before recording it, the stale claim is requeued
+// and the retry sees AlreadyExists and simply records the dispatch.
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/hotosm/scaleodm/app/meta"
+	"github.com/hotosm/scaleodm/app/workflows"
+)
+
+// maxDispatchPerTick bounds the work done in one tick, so a large backlog is
+// drained gradually rather than in one burst against the Argo API.
+const maxDispatchPerTick = 20
+
+// Options tune the dispatcher; see the SCALEODM_QUEUE_* settings.
+type Options struct {
+	Interval            time.Duration
+	MaxActiveWorkflows  int
+	ClaimTimeout        time.Duration
+	MaxDispatchAttempts int
+}
+
+// jobQueue is the subset of meta.Store the dispatcher uses.
+type jobQueue interface {
+	ClaimNextJob(ctx context.Context, maxActive int) (*meta.QueuedJob, error)
+	MarkJobDispatched(ctx context.Context, workflowName string) (bool, error)
+	ReleaseClaim(ctx context.Context, workflowName, errorMsg string, maxAttempts int) (string, error)
+	RequeueStaleClaims(ctx context.Context, timeout time.Duration) (int64, error)
+}
+
+// Start spawns a background goroutine that dispatches queued jobs on the
+// given interval. It is a no-op when wfClient is nil (e.g.
+// SCALEODM_DOCS_ONLY=true). The goroutine exits when ctx is cancelled.
+func Start(ctx context.Context, store *meta.Store, wfClient workflows.WorkflowClient, opts Options) {
+	if wfClient == nil {
+		return
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Second
+	}
+	if opts.ClaimTimeout <= 0 {
+		opts.ClaimTimeout = 5 * time.Minute
+	}
+	go run(ctx, store, wfClient, opts)
+}
+
+func run(ctx context.Context, queue jobQueue, wfClient workflows.WorkflowClient, opts Options) {
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	log.Printf("dispatcher: started (interval=%s, max_active=%d, claim_timeout=%s)", opts.Interval, opts.MaxActiveWorkflows, opts.ClaimTimeout)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("dispatcher: stopped")
+			return
+		case <-ticker.C:
+			dispatchQueuedJobs(ctx, queue, wfClient, opts)
+		}
+	}
+}
+
+// dispatchQueuedJobs runs one tick and returns how many jobs it submitted.
+func dispatchQueuedJobs(ctx context.Context, queue jobQueue, wfClient workflows.WorkflowClient, opts Options) int {
+	ctx = meta.WithActor(ctx, meta.ActorDispatcher, "")
+	if requeued, err := queue.RequeueStaleClaims(ctx, opts.ClaimTimeout); err != nil {
+		log.Printf("dispatcher: failed to requeue stale claims: %v", err)
+	} else if requeued > 0 {
+		log.Printf("dispatcher: requeued %d stale claims", requeued)
+	}
+
+	dispatched := 0
+	for dispatched < maxDispatchPerTick {
+		job, err := queue.ClaimNextJob(ctx, opts.MaxActiveWorkflows)
+		if err != nil {
+			log.Printf("dispatcher: failed to claim job: %v", err)
+			break
+		}
+		if job == nil {
+			break
+		}
+		if err := dispatchJob(ctx, queue, wfClient, job); err != nil {
+			// Stop for this tick: Argo is likely unhealthy and every further
+			// claim would fail the same way.
+			status, releaseErr := queue.ReleaseClaim(ctx, job.WorkflowName, err.Error(), opts.MaxDispatchAttempts)
+			if releaseErr != nil {
+				log.Printf("dispatcher: failed to release claim on %q: %v", job.WorkflowName, releaseErr)
+			}
+			log.Printf("dispatcher: dispatch of %q failed (attempt %d, now %q): %v", job.WorkflowName, job.DispatchAttempts+1, status, err)
+			break
+		}
+		dispatched++
+	}
+
+	if dispatched > 0 {
+		log.Printf("dispatcher: cycle done dispatched=%d", dispatched)
+	}
+	return dispatched
+}
+
+func dispatchJob(ctx context.Context, queue jobQueue, wfClient workflows.WorkflowClient, job *meta.QueuedJob) error {
+	var cfg workflows.ODMPipelineConfig
+	if err := json.Unmarshal(job.PipelineConfig, &cfg); err != nil {
+		return fmt.Errorf("invalid stored pipeline config: %w", err)
+	}
+	// The row is authoritative for the name; never let Argo pick another.
+	cfg.WorkflowName = job.WorkflowName
+
+	if _, err := wfClient.CreateODMWorkflow(ctx, &cfg); err != nil && !k8serrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	marked, err := queue.MarkJobDispatched(ctx, job.WorkflowName)
+	if err != nil {
+		// The workflow exists; the stale-claim sweep retries the bookkeeping.
+		log.Printf("dispatcher: submitted %q but failed to record it: %v", job.WorkflowName, err)
+		return nil
+	}
+	if !marked {
+		// Canceled or removed while we were submitting.
+		log.Printf("dispatcher: %q was canceled during dispatch; deleting its workflow", job.WorkflowName)
+		if err := wfClient.DeleteWorkflow(ctx, job.WorkflowName); err != nil && !k8serrors.IsNotFound(err) {
+			log.Printf("dispatcher: failed to delete workflow of canceled job %q: %v", job.WorkflowName, err)
+		}
+		return nil
+	}
+	log.Printf("dispatcher: dispatched %q project=%q priority=%d", job.WorkflowName, job.ODMProjectID, job.Priority)
+	return nil
+}
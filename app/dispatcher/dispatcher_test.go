@@ -0,0 +1,124 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/hotosm/scaleodm/app/meta"
+	"github.com/hotosm/scaleodm/app/workflows"
+)
+
+type fakeQueue struct {
+	pending    []*meta.QueuedJob
+	canceled   map[string]bool
+	dispatched []string
+	released   map[string]string
+}
+
+func (q *fakeQueue) ClaimNextJob(_ context.Context, _ int) (*meta.QueuedJob, error) {
+	if len(q.pending) == 0 {
+		return nil, nil
+	}
+	job := q.pending[0]
+	q.pending = q.pending[1:]
+	return job, nil
+}
+
+func (q *fakeQueue) MarkJobDispatched(_ context.Context, name string) (bool, error) {
+	if q.canceled[name] {
+		return false, nil
+	}
+	q.dispatched = append(q.dispatched, name)
+	return true, nil
+}
+
+func (q *fakeQueue) ReleaseClaim(_ context.Context, name, errorMsg string, _ int) (string, error) {
+	if q.released == nil {
+		q.released = map[string]string{}
+	}
+	q.released[name] = errorMsg
+	return "queued", nil
+}
+
+func (q *fakeQueue) RequeueStaleClaims(context.Context, time.Duration) (int64, error) {
+	return 0, nil
+}
+
+type fakeWorkflowClient struct {
+	workflows.WorkflowClient
+	createErr map[string]error
+	created   []*workflows.ODMPipelineConfig
+	deleted   []string
+}
+
+func (c *fakeWorkflowClient) CreateODMWorkflow(_ context.Context, cfg *workflows.ODMPipelineConfig) (*wfv1.Workflow, error) {
+	if err := c.createErr[cfg.WorkflowName]; err != nil {
+		return nil, err
+	}
+	c.created = append(c.created, cfg)
+	return &wfv1.Workflow{ObjectMeta: metav1.ObjectMeta{Name: cfg.WorkflowName}}, nil
+}
+
+func (c *fakeWorkflowClient) DeleteWorkflow(_ context.Context, name string) error {
+	c.deleted = append(c.deleted, name)
+	return nil
+}
+
+func queuedJob(t *testing.T, name string) *meta.QueuedJob {
+	t.Helper()
+	raw, err := json.Marshal(workflows.NewDefaultODMConfig("project", "s3://bucket/images/", "s3://bucket/output/", nil))
+	require.NoError(t, err)
+	return &meta.QueuedJob{WorkflowName: name, ODMProjectID: "project", PipelineConfig: raw}
+}
+
+func TestDispatchQueuedJobs_SubmitsWithPinnedNames(t *testing.T) {
+	queue := &fakeQueue{pending: []*meta.QueuedJob{queuedJob(t, "odm-pipeline-aaaaa"), queuedJob(t, "odm-pipeline-bbbbb")}}
+	client := &fakeWorkflowClient{createErr: map[string]error{
+		// Submitted by a replica that died before recording it.
+		"odm-pipeline-bbbbb": k8serrors.NewAlreadyExists(schema.GroupResource{Resource: "workflows"}, "odm-pipeline-bbbbb"),
+	}}
+
+	n := dispatchQueuedJobs(context.Background(), queue, client, Options{})
+
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"odm-pipeline-aaaaa", "odm-pipeline-bbbbb"}, queue.dispatched)
+	require.Len(t, client.created, 1)
+	assert.Equal(t, "odm-pipeline-aaaaa", client.created[0].WorkflowName)
+	assert.Equal(t, "s3://bucket/images/", client.created[0].ReadS3Path)
+}
+
+func TestDispatchQueuedJobs_ReleasesOnFailureAndStops(t *testing.T) {
+	queue := &fakeQueue{pending: []*meta.QueuedJob{queuedJob(t, "odm-pipeline-aaaaa"), queuedJob(t, "odm-pipeline-bbbbb")}}
+	client := &fakeWorkflowClient{createErr: map[string]error{
+		"odm-pipeline-aaaaa": errors.New("argo unavailable"),
+	}}
+
+	n := dispatchQueuedJobs(context.Background(), queue, client, Options{})
+
+	assert.Equal(t, 0, n)
+	assert.Equal(t, "argo unavailable", queue.released["odm-pipeline-aaaaa"])
+	assert.Len(t, queue.pending, 1, "the tick should stop after a failed submission")
+}
+
+func TestDispatchQueuedJobs_DeletesWorkflowOfCanceledJob(t *testing.T) {
+	queue := &fakeQueue{
+		pending:  []*meta.QueuedJob{queuedJob(t, "odm-pipeline-aaaaa")},
+		canceled: map[string]bool{"odm-pipeline-aaaaa": true},
+	}
+	client := &fakeWorkflowClient{}
+
+	dispatchQueuedJobs(context.Background(), queue, client, Options{})
+
+	assert.Empty(t, queue.dispatched)
+	assert.Equal(t, []string{"odm-pipeline-aaaaa"}, client.deleted)
+}
@@ -0,0 +1,225 @@
+// Package estimator learns the process memory and workspace estimates from
+// the peak usage of finished ODM runs.
+//
+// The static estimates - the interpolated odmMemoryEstimationPoints table
+// and the per-profile workspace multipliers - repeat every under- or
+// over-estimate forever. The process container of a single-pod run reports
+// its cgroup's peak memory and its workspace's high-water mark when ODM
+// finishes, and the reconciler stores them in
+// scaleodm_resource_observations against the task's image count, total bytes
+// and flags (see workflows.ProcessUsage).
+//
+// # Fit
+//
+// Per workload profile (see workflows.WorkloadProfile) and target, this
+// goroutine fits the log of observed/prior against the log of the image
+// count, a straight line through the runs' ratios, by ridge regression:
+// the static estimate is the prior and keeps PriorWeight runs' worth of
+// weight, so a handful of runs barely move it. The curve is padded by
+// MarginSigmas standard deviations of its residuals, as an underestimated
+// memory limit is an OOM-killed task, and held flat outside the image counts
+// it was fitted on. Only succeeded runs are observed, so a prior that OOMs
+// its tasks shows no data for the curve to correct; the margin is what
+// keeps a curve from settling just at the edge.
+//
+// # Applying curves
+//
+// Every fit is reported at GET /admin/sizing (see Latest), and when Apply is
+// set a profile's curve is handed to workflows.SetLearnedSizing once it has
+// MinObservations runs, correcting the estimates of new workflows. Each
+// replica fits the same rows, so they agree.
+package estimator
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hotosm/scaleodm/app/meta"
+	"github.com/hotosm/scaleodm/app/workflows"
+)
+
+// Targets of the learned curves.
+const (
+	TargetMemory    = "memory"
+	TargetWorkspace = "workspace"
+)
+
+const gib = float64(1 << 30)
+
+// Options tune the estimator; see the SCALEODM_LEARNED_SIZING_* settings.
+type Options struct {
+	Interval        time.Duration
+	MaxObservations int
+	MinObservations int
+	PriorWeight     float64
+	MarginSigmas    float64
+	// Apply hands the curves with MinObservations runs to the workflow
+	// estimates; without it they are only reported.
+	Apply bool
+}
+
+// observations is the subset of meta.Store the estimator uses.
+type observations interface {
+	ListResourceObservations(ctx context.Context, limit int) ([]meta.ResourceObservation, error)
+}
+
+// Curve is the fit of one target and profile.
+type Curve struct {
+	Target       string
+	Profile      string
+	Observations int
+	Curve        workflows.LearnedCurve
+	// Sigma is the standard deviation of the fit's residuals, in ln units.
+	Sigma float64
+	// PriorRMSLE and FitRMSLE are the root mean square of ln(observed /
+	// estimate) over the runs, for the prior and for the curve without its
+	// margin.
+	PriorRMSLE float64
+	FitRMSLE   float64
+	// MedianRatio is the median of observed / prior.
+	MedianRatio float64
+	// PriorUnderestimates and FitUnderestimates count the runs that used
+	// more than the prior, and than the curve with its margin, estimated.
+	PriorUnderestimates int
+	FitUnderestimates   int
+	// Applied is whether the curve corrects new workflows' estimates.
+	Applied bool
+}
+
+// Report is the outcome of a fit.
+type Report struct {
+	FittedAt        time.Time
+	Apply           bool
+	MinObservations int
+	// Observations counts the runs read; those without a usable measurement
+	// or prior for a target are left out of its fit.
+	Observations int
+	Curves       []Curve
+}
+
+var latest struct {
+	sync.RWMutex
+	report *Report
+}
+
+// Latest returns the report of the most recent fit, or nil before the first.
+func Latest() *Report {
+	latest.RLock()
+	defer latest.RUnlock()
+	return latest.report
+}
+
+// Start spawns a background goroutine that refits the curves on the given
+// interval, starting now. The goroutine exits when ctx is cancelled.
+func Start(ctx context.Context, store *meta.Store, opts Options) {
+	if opts.Interval <= 0 {
+		opts.Interval = 15 * time.Minute
+	}
+	if opts.MinObservations <= 0 {
+		opts.MinObservations = 1
+	}
+	go run(ctx, store, opts)
+}
+
+func run(ctx context.Context, store observations, opts Options) {
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	log.Printf("estimator: started (interval=%s, apply=%t, min_observations=%d)", opts.Interval, opts.Apply, opts.MinObservations)
+
+	refresh(ctx, store, opts)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("estimator: stopped")
+			return
+		case <-ticker.C:
+			refresh(ctx, store, opts)
+		}
+	}
+}
+
+// refresh refits the curves from the most recent runs, applies them and
+// keeps the report.
+func refresh(ctx context.Context, store observations, opts Options) {
+	observed, err := store.ListResourceObservations(ctx, opts.MaxObservations)
+	if err != nil {
+		log.Printf("estimator: failed to list resource observations: %v", err)
+		return
+	}
+	report := Fit(observed, opts)
+	report.FittedAt = time.Now().UTC()
+
+	sizing := workflows.LearnedSizing{
+		Memory:    map[string]workflows.LearnedCurve{},
+		Workspace: map[string]workflows.LearnedCurve{},
+	}
+	for _, curve := range report.Curves {
+		if !curve.Applied {
+			continue
+		}
+		switch curve.Target {
+		case TargetMemory:
+			sizing.Memory[curve.Profile] = curve.Curve
+		case TargetWorkspace:
+			sizing.Workspace[curve.Profile] = curve.Curve
+		}
+	}
+	workflows.SetLearnedSizing(sizing)
+
+	latest.Lock()
+	latest.report = report
+	latest.Unlock()
+}
+
+// Fit fits a curve per target and profile from observed runs against the
+// current priors.
+func Fit(observed []meta.ResourceObservation, opts Options) *Report {
+	type key struct{ target, profile string }
+	points := map[key][]point{}
+	for _, obs := range observed {
+		if obs.ImageCount <= 0 {
+			continue
+		}
+		usage := workflows.ProcessUsage{
+			PeakMemoryBytes: obs.PeakMemoryBytes,
+			PeakAnonBytes:   obs.PeakAnonBytes,
+			PeakSwapBytes:   obs.PeakSwapBytes,
+		}
+		if used, prior := float64(usage.WorkingSetBytes())/gib, workflows.PriorPeakMemoryGiB(obs.ImageCount, obs.ODMFlags); used > 0 && prior > 0 {
+			k := key{TargetMemory, obs.Profile}
+			points[k] = append(points[k], point{images: obs.ImageCount, ratio: used / prior})
+		}
+		if used, prior := float64(obs.WorkspacePeakBytes)/gib, workflows.PriorWorkspaceGiB(obs.ImageTotalBytes, obs.ImageCount, obs.ODMFlags); used > 0 && prior > 0 {
+			k := key{TargetWorkspace, obs.Profile}
+			points[k] = append(points[k], point{images: obs.ImageCount, ratio: used / prior})
+		}
+	}
+
+	report := &Report{Apply: opts.Apply, MinObservations: opts.MinObservations, Observations: len(observed)}
+	for k, pts := range points {
+		f := fitCurve(pts, opts.PriorWeight, opts.MarginSigmas)
+		report.Curves = append(report.Curves, Curve{
+			Target:              k.target,
+			Profile:             k.profile,
+			Observations:        len(pts),
+			Curve:               f.curve,
+			Sigma:               f.sigma,
+			PriorRMSLE:          f.priorRMSLE,
+			FitRMSLE:            f.fitRMSLE,
+			MedianRatio:         f.medianRatio,
+			PriorUnderestimates: f.priorUnder,
+			FitUnderestimates:   f.fitUnder,
+			Applied:             opts.Apply && len(pts) >= opts.MinObservations,
+		})
+	}
+	sort.Slice(report.Curves, func(i, j int) bool {
+		if report.Curves[i].Target != report.Curves[j].Target {
+			return report.Curves[i].Target < report.Curves[j].Target
+		}
+		return report.Curves[i].Profile < report.Curves[j].Profile
+	})
+	return report
+}
@@ -0,0 +1,79 @@
+package estimator
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hotosm/scaleodm/app/meta"
+	"github.com/hotosm/scaleodm/app/workflows"
+)
+
+type fakeObservations []meta.ResourceObservation
+
+func (f fakeObservations) ListResourceObservations(ctx context.Context, limit int) ([]meta.ResourceObservation, error) {
+	return f, nil
+}
+
+// observation is a standard-profile run that used ratio times the priors.
+func observation(name string, images int, ratio float64) meta.ResourceObservation {
+	const gibBytes = 1 << 30
+	return meta.ResourceObservation{
+		WorkflowName:       name,
+		Profile:            workflows.WorkloadProfileStandard,
+		ImageCount:         images,
+		ImageTotalBytes:    int64(images) * 10 << 20,
+		PeakMemoryBytes:    int64(math.Round(workflows.PriorPeakMemoryGiB(images, nil) * ratio * gibBytes)),
+		WorkspacePeakBytes: int64(math.Round(workflows.PriorWorkspaceGiB(int64(images)*10<<20, images, nil) * ratio * gibBytes)),
+	}
+}
+
+func TestFit_PerTargetAndProfile(t *testing.T) {
+	observed := []meta.ResourceObservation{
+		observation("wf-1", 200, 1.2),
+		observation("wf-2", 800, 1.2),
+		observation("wf-3", 1600, 1.2),
+		// Nothing measured: left out of both fits.
+		{WorkflowName: "wf-4", Profile: workflows.WorkloadProfileStandard, ImageCount: 500},
+		{WorkflowName: "wf-5", Profile: workflows.WorkloadProfileDSMDTM, ImageCount: 500, ODMFlags: []string{"--dsm"}, PeakMemoryBytes: 30 << 30},
+	}
+	report := Fit(observed, Options{MinObservations: 3, Apply: true})
+
+	assert.Equal(t, 5, report.Observations)
+	require.Len(t, report.Curves, 3)
+	assert.Equal(t, []string{"memory/dsm-dtm", "memory/standard", "workspace/standard"}, []string{
+		report.Curves[0].Target + "/" + report.Curves[0].Profile,
+		report.Curves[1].Target + "/" + report.Curves[1].Profile,
+		report.Curves[2].Target + "/" + report.Curves[2].Profile,
+	})
+	assert.False(t, report.Curves[0].Applied, "one run is below MinObservations")
+	for _, curve := range report.Curves[1:] {
+		assert.Equal(t, 3, curve.Observations)
+		assert.True(t, curve.Applied)
+		assert.InDelta(t, 1.2, curve.Curve.Factor(800), 1e-6)
+		assert.InDelta(t, math.Log(1.2), curve.PriorRMSLE, 1e-6)
+		assert.Equal(t, 3, curve.PriorUnderestimates)
+		assert.Equal(t, 0, curve.FitUnderestimates)
+	}
+
+	report = Fit(observed, Options{MinObservations: 3})
+	for _, curve := range report.Curves {
+		assert.False(t, curve.Applied, "curves are only reported without Apply")
+	}
+}
+
+func TestRefresh_KeepsReport(t *testing.T) {
+	t.Cleanup(func() { workflows.SetLearnedSizing(workflows.LearnedSizing{}) })
+	store := fakeObservations{observation("wf-1", 400, 0.9), observation("wf-2", 900, 0.9)}
+
+	refresh(context.Background(), store, Options{MinObservations: 2, Apply: true})
+
+	report := Latest()
+	require.NotNil(t, report)
+	assert.False(t, report.FittedAt.IsZero())
+	require.Len(t, report.Curves, 2)
+	assert.True(t, report.Curves[0].Applied)
+}
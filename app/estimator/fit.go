@@ -0,0 +1,127 @@
+package estimator
+
+import (
+	"math"
+	"sort"
+
+	"github.com/hotosm/scaleodm/app/workflows"
+)
+
+// underestimateTolerance is how far, in ln units, a run may exceed an
+// estimate before it counts as underestimated: about 0.1%, which is noise.
+const underestimateTolerance = 1e-3
+
+// point is one run: its image count and the ratio of what it used to what
+// the prior estimated.
+type point struct {
+	images int
+	ratio  float64
+}
+
+// fit is a learned curve with how well the prior and the curve predicted
+// the points it was fitted on.
+type fit struct {
+	curve workflows.LearnedCurve
+	sigma float64
+	// priorRMSLE and fitRMSLE are the root mean square of ln(observed /
+	// estimate) for the prior and the curve without its margin.
+	priorRMSLE float64
+	fitRMSLE   float64
+	// medianRatio is the median of observed / prior.
+	medianRatio float64
+	// priorUnder and fitUnder count the runs that used more than the prior,
+	// and than the curve with its margin, estimated.
+	priorUnder int
+	fitUnder   int
+}
+
+// fitCurve fits ln(observed/prior) = a + b*(ln(images) - mean) by ridge
+// regression, which shrinks a and b towards 0, i.e. towards the prior, as if
+// priorWeight more runs had matched it exactly. With few runs the curve stays
+// close to the prior; with many the data decides. The margin is marginSigmas
+// standard deviations of the residuals.
+func fitCurve(points []point, priorWeight, marginSigmas float64) fit {
+	n := float64(len(points))
+	if n == 0 {
+		return fit{}
+	}
+	if priorWeight < 0 {
+		priorWeight = 0
+	}
+
+	xs := make([]float64, len(points))
+	ys := make([]float64, len(points))
+	ratios := make([]float64, len(points))
+	minImages, maxImages := points[0].images, points[0].images
+	mean := 0.0
+	for i, p := range points {
+		xs[i] = math.Log(float64(p.images))
+		ys[i] = math.Log(p.ratio)
+		ratios[i] = p.ratio
+		mean += xs[i]
+		minImages = min(minImages, p.images)
+		maxImages = max(maxImages, p.images)
+	}
+	mean /= n
+
+	var sumY, sumXY, sumXX float64
+	for i := range points {
+		x := xs[i] - mean
+		sumY += ys[i]
+		sumXY += x * ys[i]
+		sumXX += x * x
+	}
+	intercept := sumY / (n + priorWeight)
+	slope := 0.0
+	if sumXX+priorWeight > 0 {
+		slope = sumXY / (sumXX + priorWeight)
+	}
+
+	var sumPrior, sumResidual float64
+	residuals := make([]float64, len(points))
+	for i := range points {
+		residuals[i] = ys[i] - intercept - slope*(xs[i]-mean)
+		sumPrior += ys[i] * ys[i]
+		sumResidual += residuals[i] * residuals[i]
+	}
+	// Two parameters are fitted; a single run gives no spread at all.
+	sigma := math.Sqrt(sumResidual / math.Max(n-2, 1))
+	margin := math.Max(marginSigmas, 0) * sigma
+
+	result := fit{
+		curve: workflows.LearnedCurve{
+			Intercept:     intercept,
+			Slope:         slope,
+			MeanLogImages: mean,
+			Margin:        margin,
+			MinImages:     minImages,
+			MaxImages:     maxImages,
+		},
+		sigma:       sigma,
+		priorRMSLE:  math.Sqrt(sumPrior / n),
+		fitRMSLE:    math.Sqrt(sumResidual / n),
+		medianRatio: median(ratios),
+	}
+	for i := range points {
+		if ys[i] > underestimateTolerance {
+			result.priorUnder++
+		}
+		if residuals[i] > margin+underestimateTolerance {
+			result.fitUnder++
+		}
+	}
+	return result
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
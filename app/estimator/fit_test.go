@@ -0,0 +1,60 @@
+package estimator
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ratios of runs whose usage is 1.5 * sqrt(images/1000) times the prior.
+func sqrtCurvePoints(imageCounts ...int) []point {
+	var points []point
+	for _, images := range imageCounts {
+		points = append(points, point{images: images, ratio: 1.5 * math.Sqrt(float64(images)/1000)})
+	}
+	return points
+}
+
+func TestFitCurve_RecoversObservedRatios(t *testing.T) {
+	points := sqrtCurvePoints(100, 250, 1000, 4000)
+	f := fitCurve(points, 0, 1)
+
+	assert.InDelta(t, 0.5, f.curve.Slope, 1e-9)
+	assert.InDelta(t, 0, f.sigma, 1e-9)
+	assert.InDelta(t, 0, f.fitRMSLE, 1e-9)
+	assert.Equal(t, 100, f.curve.MinImages)
+	assert.Equal(t, 4000, f.curve.MaxImages)
+	for _, p := range points {
+		assert.InDelta(t, p.ratio, f.curve.Factor(p.images), 1e-9, "images=%d", p.images)
+	}
+	// 0.47 and 0.75 are below 1, 1.5 and 3 above.
+	assert.Equal(t, 2, f.priorUnder)
+	assert.Equal(t, 0, f.fitUnder)
+	assert.InDelta(t, (1.5*math.Sqrt(0.25)+1.5)/2, f.medianRatio, 1e-9)
+}
+
+func TestFitCurve_PriorWeightShrinksTowardsPrior(t *testing.T) {
+	points := []point{{images: 500, ratio: 2}, {images: 600, ratio: 2}}
+
+	loose := fitCurve(points, 0, 0)
+	assert.InDelta(t, 2, loose.curve.Factor(550), 1e-9)
+
+	// Two runs against a prior worth eight: a fifth of the way, in ln.
+	tight := fitCurve(points, 8, 0)
+	assert.InDelta(t, math.Pow(2, 0.2), tight.curve.Factor(550), 1e-9)
+}
+
+func TestFitCurve_MarginCoversSpread(t *testing.T) {
+	points := []point{
+		{images: 1000, ratio: 0.8}, {images: 1000, ratio: 1.25},
+		{images: 1000, ratio: 0.8}, {images: 1000, ratio: 1.25},
+	}
+	f := fitCurve(points, 0, 1)
+	assert.InDelta(t, 0, f.curve.Intercept, 1e-9)
+	// Residuals of +-ln(1.25) over n-2 degrees of freedom.
+	assert.InDelta(t, math.Log(1.25)*math.Sqrt(2), f.sigma, 1e-9)
+	assert.InDelta(t, f.sigma, f.curve.Margin, 1e-9)
+	assert.Equal(t, 0, f.fitUnder)
+	assert.Equal(t, 2, f.priorUnder)
+}
@@ -0,0 +1,82 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hotosm/scaleodm/app/meta"
+)
+
+// DefaultSource is the CloudEvents source used when SCALEODM_EVENTS_SOURCE is
+// not set.
+const DefaultSource = "/scaleodm"
+
+// TaskEventTypePrefix prefixes the event type, which ends with the task's new
+// status: org.hotosm.scaleodm.task.completed and so on.
+const TaskEventTypePrefix = "org.hotosm.scaleodm.task."
+
+// CloudEvent is a CloudEvents 1.0 event in the structured JSON format.
+type CloudEvent struct {
+	SpecVersion     string        `json:"specversion"`
+	ID              string        `json:"id"`
+	Source          string        `json:"source"`
+	Type            string        `json:"type"`
+	Subject         string        `json:"subject"`
+	Time            time.Time     `json:"time"`
+	DataContentType string        `json:"datacontenttype"`
+	Data            TaskEventData `json:"data"`
+}
+
+// TaskEventData is the data of a task event. status and previousStatus carry
+// NodeODM's status codes, as in the task info; jobStatus and
+// previousJobStatus ScaleODM's own statuses, which also tell a queued task
+// from a claimed one.
+type TaskEventData struct {
+	UUID              string          `json:"uuid"`
+	Name              string          `json:"name"`
+	Tenant            string          `json:"tenant,omitempty"`
+	Status            TaskEventStatus `json:"status"`
+	PreviousStatus    TaskEventStatus `json:"previousStatus"`
+	JobStatus         string          `json:"jobStatus"`
+	PreviousJobStatus string          `json:"previousJobStatus"`
+}
+
+// TaskEventStatus mirrors the status object of the task info.
+type TaskEventStatus struct {
+	Code         int    `json:"code"`
+	ErrorMessage string `json:"errorMessage,omitempty"`
+}
+
+// NewTaskEvent builds the event announcing a transition. The subject is the
+// task UUID, so consumers can filter on it without reading the data.
+func NewTaskEvent(source string, transition meta.TaskTransition) CloudEvent {
+	status := TaskEventStatus{Code: meta.NodeODMStatusCode(transition.To)}
+	if status.Code == 30 {
+		status.ErrorMessage = transition.ErrorMessage
+	}
+	return CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              uuid.NewString(),
+		Source:          source,
+		Type:            TaskEventTypePrefix + transition.To,
+		Subject:         transition.WorkflowName,
+		Time:            transition.At.UTC(),
+		DataContentType: "application/json",
+		Data: TaskEventData{
+			UUID:              transition.WorkflowName,
+			Name:              transition.ProjectID,
+			Tenant:            transition.Tenant,
+			Status:            status,
+			PreviousStatus:    TaskEventStatus{Code: meta.NodeODMStatusCode(transition.From)},
+			JobStatus:         transition.To,
+			PreviousJobStatus: transition.From,
+		},
+	}
+}
+
+// Marshal encodes the event as sinks send it.
+func (e CloudEvent) Marshal() ([]byte, error) {
+	return json.Marshal(e)
+}
@@ -0,0 +1,116 @@
+// Package events publishes task lifecycle events to integrations.
+//
+// Every status change the metadata store commits (see
+// meta.Store.SetTransitionHook) becomes a CloudEvent (structured JSON, spec
+// 1.0) sent to the target of each matching row of
+// scaleodm_event_subscriptions: an HTTP URL, a NATS subject or a Postgres
+// NOTIFY channel, depending on SCALEODM_EVENTS_SINK. Subscriptions select
+// events by tenant, project, or both.
+//
+// Publishing is best-effort: transitions are queued in memory and published
+// by one goroutine per replica, in order; an event that fails to publish, or
+// that arrives while the queue is full, is logged and dropped. Consumers
+// that must not miss a terminal status should also set a task webhook,
+// which is delivered from a durable outbox, or re-read /task/{uuid}/info.
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hotosm/scaleodm/app/meta"
+)
+
+// queueSize bounds the transitions waiting to be published.
+const queueSize = 1024
+
+// Options tune the publisher; see the SCALEODM_EVENTS_* settings.
+type Options struct {
+	// Source is the CloudEvents source attribute of every event.
+	Source  string
+	Timeout time.Duration
+}
+
+// subscriptions is the subset of meta.Store the publisher uses.
+type subscriptions interface {
+	EventTargets(ctx context.Context, tenant, projectID string) ([]string, error)
+}
+
+type publisher struct {
+	subs  subscriptions
+	sink  Sink
+	opts  Options
+	queue chan meta.TaskTransition
+}
+
+// Start hooks the publisher into the store's status updates and spawns the
+// goroutine that publishes them. The goroutine exits when ctx is cancelled.
+func Start(ctx context.Context, store *meta.Store, sink Sink, opts Options) {
+	if opts.Source == "" {
+		opts.Source = DefaultSource
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	p := newPublisher(store, sink, opts)
+	store.SetTransitionHook(p.enqueue)
+	go p.run(ctx)
+}
+
+func newPublisher(subs subscriptions, sink Sink, opts Options) *publisher {
+	return &publisher{subs: subs, sink: sink, opts: opts, queue: make(chan meta.TaskTransition, queueSize)}
+}
+
+// enqueue is the store's transition hook. It never blocks a status update.
+func (p *publisher) enqueue(transition meta.TaskTransition) {
+	select {
+	case p.queue <- transition:
+	default:
+		log.Printf("events: queue full, dropping %s -> %s event for %q", transition.From, transition.To, transition.WorkflowName)
+	}
+}
+
+func (p *publisher) run(ctx context.Context) {
+	log.Printf("events: started (source=%q, timeout=%s)", p.opts.Source, p.opts.Timeout)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("events: stopped")
+			return
+		case transition := <-p.queue:
+			p.publish(ctx, transition)
+		}
+	}
+}
+
+// publish sends one transition to every subscribed target and returns how
+// many accepted it.
+func (p *publisher) publish(ctx context.Context, transition meta.TaskTransition) int {
+	targets, err := p.subs.EventTargets(ctx, transition.Tenant, transition.ProjectID)
+	if err != nil {
+		log.Printf("events: failed to match subscriptions for %q: %v", transition.WorkflowName, err)
+		return 0
+	}
+	if len(targets) == 0 {
+		return 0
+	}
+	event, err := NewTaskEvent(p.opts.Source, transition).Marshal()
+	if err != nil {
+		log.Printf("events: failed to encode event for %q: %v", transition.WorkflowName, err)
+		return 0
+	}
+
+	published := 0
+	for _, target := range targets {
+		publishCtx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+		err := p.sink.Publish(publishCtx, target, event)
+		cancel()
+		if err != nil {
+			log.Printf("events: failed to publish %s event for %q to %q: %v", transition.To, transition.WorkflowName, target, err)
+			continue
+		}
+		published++
+	}
+	return published
+}
@@ -0,0 +1,107 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hotosm/scaleodm/app/meta"
+)
+
+type fakeSubscriptions struct {
+	targets map[string][]string // by tenant + "/" + project
+}
+
+func (f *fakeSubscriptions) EventTargets(_ context.Context, tenant, projectID string) ([]string, error) {
+	return f.targets[tenant+"/"+projectID], nil
+}
+
+type recordingSink struct {
+	published map[string][]byte
+	fail      map[string]bool
+}
+
+func (s *recordingSink) Publish(_ context.Context, target string, event []byte) error {
+	if s.fail[target] {
+		return errors.New("unreachable")
+	}
+	s.published[target] = event
+	return nil
+}
+
+func TestNewTaskEvent(t *testing.T) {
+	at := time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)
+	event := NewTaskEvent("/scaleodm/prod", meta.TaskTransition{
+		WorkflowName: "odm-pipeline-abc",
+		ProjectID:    "project-1",
+		Tenant:       "dronetm",
+		From:         "running",
+		To:           "failed",
+		ErrorMessage: "ODM exited with code 1",
+		At:           at,
+	})
+
+	raw, err := event.Marshal()
+	require.NoError(t, err)
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(raw, &decoded))
+	assert.NotEmpty(t, decoded["id"])
+	delete(decoded, "id")
+
+	want := `{
+		"specversion": "1.0",
+		"source": "/scaleodm/prod",
+		"type": "org.hotosm.scaleodm.task.failed",
+		"subject": "odm-pipeline-abc",
+		"time": "2026-10-16T09:30:00Z",
+		"datacontenttype": "application/json",
+		"data": {
+			"uuid": "odm-pipeline-abc",
+			"name": "project-1",
+			"tenant": "dronetm",
+			"status": {"code": 30, "errorMessage": "ODM exited with code 1"},
+			"previousStatus": {"code": 20},
+			"jobStatus": "failed",
+			"previousJobStatus": "running"
+		}
+	}`
+	got, err := json.Marshal(decoded)
+	require.NoError(t, err)
+	assert.JSONEq(t, want, string(got))
+
+	other := NewTaskEvent(DefaultSource, meta.TaskTransition{WorkflowName: "odm-pipeline-abc", From: "queued", To: "running", At: at})
+	assert.NotEqual(t, event.ID, other.ID)
+	assert.Empty(t, other.Data.Status.ErrorMessage)
+}
+
+func TestPublish_SendsToMatchingTargets(t *testing.T) {
+	subs := &fakeSubscriptions{targets: map[string][]string{
+		"dronetm/project-1": {"https://a.example/events", "https://b.example/events", "https://down.example/events"},
+	}}
+	sink := &recordingSink{published: map[string][]byte{}, fail: map[string]bool{"https://down.example/events": true}}
+	p := newPublisher(subs, sink, Options{Source: DefaultSource, Timeout: time.Second})
+
+	n := p.publish(context.Background(), meta.TaskTransition{WorkflowName: "wf-1", ProjectID: "project-1", Tenant: "dronetm", From: "running", To: "completed", At: time.Now()})
+	assert.Equal(t, 2, n)
+	require.Contains(t, sink.published, "https://a.example/events")
+	assert.Equal(t, sink.published["https://a.example/events"], sink.published["https://b.example/events"], "every target gets the same event")
+
+	var event CloudEvent
+	require.NoError(t, json.Unmarshal(sink.published["https://a.example/events"], &event))
+	assert.Equal(t, "org.hotosm.scaleodm.task.completed", event.Type)
+
+	assert.Zero(t, p.publish(context.Background(), meta.TaskTransition{WorkflowName: "wf-2", ProjectID: "project-2", Tenant: "dronetm", To: "running"}))
+}
+
+func TestEnqueue_DropsWhenFull(t *testing.T) {
+	p := newPublisher(&fakeSubscriptions{}, &recordingSink{}, Options{})
+	for i := 0; i < queueSize+10; i++ {
+		p.enqueue(meta.TaskTransition{WorkflowName: "wf", To: "running"})
+	}
+	assert.Len(t, p.queue, queueSize)
+}
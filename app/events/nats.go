@@ -0,0 +1,58 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsSink publishes to a NATS server. The client keeps one connection and
+// re-dials in the background when it drops, so a server that is down at
+// start-up or restarts later only fails the events published meanwhile.
+type natsSink struct {
+	conn *nats.Conn
+}
+
+func newNATSSink(rawURL string) (*natsSink, error) {
+	server, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NATS URL: %w", err)
+	}
+	if server.Scheme != "nats" && server.Scheme != "tls" {
+		return nil, fmt.Errorf("invalid NATS URL %q: scheme must be nats or tls", server.Redacted())
+	}
+	if server.Hostname() == "" {
+		return nil, fmt.Errorf("invalid NATS URL %q: missing host", server.Redacted())
+	}
+	// Credentials in the URL (token@ or user:pass@) are sent by the client.
+	conn, err := nats.Connect(rawURL,
+		nats.Name("scaleodm"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("nats connect to %q: %w", server.Redacted(), err)
+	}
+	return &natsSink{conn: conn}, nil
+}
+
+// Publish returns once the server has acknowledged the message: the flush
+// round-trips a PING, which the server answers after processing the PUB.
+func (s *natsSink) Publish(ctx context.Context, subject string, event []byte) error {
+	if err := s.conn.Publish(subject, event); err != nil {
+		return fmt.Errorf("nats publish: %w", err)
+	}
+	var err error
+	if _, ok := ctx.Deadline(); ok {
+		err = s.conn.FlushWithContext(ctx)
+	} else {
+		err = s.conn.FlushTimeout(10 * time.Second)
+	}
+	if err != nil {
+		return fmt.Errorf("nats publish: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Sink kinds, the values of SCALEODM_EVENTS_SINK.
+const (
+	SinkHTTP     = "http"
+	SinkNATS     = "nats"
+	SinkPostgres = "postgres"
+)
+
+// Sink publishes an encoded event to a subscription's target, whose form
+// depends on the sink (see ValidateTarget).
+type Sink interface {
+	Publish(ctx context.Context, target string, event []byte) error
+}
+
+// execer is the part of a pgx pool the Postgres sink uses.
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// NewSink returns the sink of the given kind. natsURL is only used by the
+// NATS sink and db only by the Postgres one.
+func NewSink(kind, natsURL string, db execer) (Sink, error) {
+	switch kind {
+	case SinkHTTP:
+		return &httpSink{client: http.DefaultClient}, nil
+	case SinkNATS:
+		return newNATSSink(natsURL)
+	case SinkPostgres:
+		return &postgresSink{db: db}, nil
+	default:
+		return nil, fmt.Errorf("unknown event sink %q (want %s, %s or %s)", kind, SinkHTTP, SinkNATS, SinkPostgres)
+	}
+}
+
+// ValidateTarget checks a subscription target for the given sink: an
+// absolute http(s) URL, a NATS subject without wildcards, or a lower-case
+// Postgres channel name.
+func ValidateTarget(kind, target string) error {
+	switch kind {
+	case SinkHTTP:
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("target must be an absolute http or https URL")
+		}
+	case SinkNATS:
+		if !natsSubjectPattern.MatchString(target) {
+			return errors.New("target must be a NATS subject: dot-separated tokens without spaces or wildcards")
+		}
+	case SinkPostgres:
+		if !channelPattern.MatchString(target) {
+			return errors.New("target must be a Postgres channel name: lower-case letters, digits and underscores, at most 63 characters")
+		}
+	default:
+		return fmt.Errorf("unknown event sink %q", kind)
+	}
+	return nil
+}
+
+var (
+	natsSubjectPattern = regexp.MustCompile(`^[^.\s*>]+(\.[^.\s*>]+)*$`)
+	channelPattern     = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+)
+
+// httpSink POSTs events in the structured content mode of the CloudEvents
+// HTTP binding.
+type httpSink struct {
+	client *http.Client
+}
+
+func (s *httpSink) Publish(ctx context.Context, target string, event []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(event))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// maxNotifyPayload is Postgres's limit on a NOTIFY payload, in bytes.
+const maxNotifyPayload = 8000
+
+// postgresSink NOTIFYs the target channel with the event as payload, for
+// consumers that LISTEN on ScaleODM's database.
+type postgresSink struct {
+	db execer
+}
+
+func (s *postgresSink) Publish(ctx context.Context, target string, event []byte) error {
+	if len(event) >= maxNotifyPayload {
+		return fmt.Errorf("event of %d bytes exceeds the NOTIFY payload limit", len(event))
+	}
+	if _, err := s.db.Exec(ctx, `SELECT pg_notify($1, $2)`, target, string(event)); err != nil {
+		return fmt.Errorf("notify %s: %w", target, err)
+	}
+	return nil
+}
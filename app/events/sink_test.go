@@ -0,0 +1,97 @@
+package events
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTarget(t *testing.T) {
+	cases := []struct {
+		kind, target string
+		ok           bool
+	}{
+		{SinkHTTP, "https://catalogue.example/hooks/odm", true},
+		{SinkHTTP, "http://dronetm:8000/events", true},
+		{SinkHTTP, "ftp://example.com/x", false},
+		{SinkHTTP, "/relative", false},
+		{SinkNATS, "dronetm.tasks", true},
+		{SinkNATS, "scaleodm", true},
+		{SinkNATS, "dronetm.*", false},
+		{SinkNATS, "dronetm.>", false},
+		{SinkNATS, "dronetm..tasks", false},
+		{SinkNATS, "drone tm", false},
+		{SinkPostgres, "scaleodm_events", true},
+		{SinkPostgres, "ScaleODM", false},
+		{SinkPostgres, "1events", false},
+		{SinkPostgres, strings.Repeat("a", 64), false},
+		{"kafka", "topic", false},
+	}
+	for _, tc := range cases {
+		err := ValidateTarget(tc.kind, tc.target)
+		if tc.ok {
+			assert.NoError(t, err, "%s %q", tc.kind, tc.target)
+		} else {
+			assert.Error(t, err, "%s %q", tc.kind, tc.target)
+		}
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var contentType string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	sink := &httpSink{client: server.Client()}
+	require.NoError(t, sink.Publish(context.Background(), server.URL+"/events", []byte(`{"specversion":"1.0"}`)))
+	assert.Equal(t, "application/cloudevents+json; charset=utf-8", contentType)
+	assert.Equal(t, `{"specversion":"1.0"}`, string(body))
+
+	err := sink.Publish(context.Background(), server.URL+"/broken", []byte(`{}`))
+	assert.ErrorContains(t, err, "HTTP 503")
+}
+
+type fakeExecer struct {
+	sql  string
+	args []any
+}
+
+func (f *fakeExecer) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	f.sql, f.args = sql, args
+	return pgconn.CommandTag{}, nil
+}
+
+func TestPostgresSink(t *testing.T) {
+	db := &fakeExecer{}
+	sink := &postgresSink{db: db}
+
+	require.NoError(t, sink.Publish(context.Background(), "scaleodm_events", []byte(`{"id":"1"}`)))
+	assert.Contains(t, db.sql, "pg_notify")
+	assert.Equal(t, []any{"scaleodm_events", `{"id":"1"}`}, db.args)
+
+	db.args = nil
+	err := sink.Publish(context.Background(), "scaleodm_events", []byte(strings.Repeat("x", maxNotifyPayload)))
+	assert.ErrorContains(t, err, "NOTIFY payload limit")
+	assert.Nil(t, db.args)
+}
+
+func TestNewNATSSink_RejectsBadURL(t *testing.T) {
+	_, err := newNATSSink("http://nats:4222")
+	assert.Error(t, err)
+	_, err = newNATSSink("nats://")
+	assert.Error(t, err)
+}
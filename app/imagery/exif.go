@@ -0,0 +1,361 @@
+package imagery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Metadata is what inspection reads from an image's headers.
+type Metadata struct {
+	Make  string
+	Model string
+	// CapturedAt is DateTimeOriginal, else DateTime, in the camera's clock;
+	// EXIF carries no zone, so it is read as UTC.
+	CapturedAt *time.Time
+	HasGPS     bool
+	Latitude   float64
+	Longitude  float64
+	// Altitude is the GPS altitude in meters above sea level, or the XMP
+	// AbsoluteAltitude drones write.
+	Altitude *float64
+	// Truncated is set when the file ends before its image data does.
+	Truncated bool
+}
+
+// errNotImage is returned for files that are neither JPEG nor TIFF.
+var errNotImage = errors.New("not a JPEG or TIFF file")
+
+// jpegTailBytes is how much of a JPEG's end is searched for its end-of-image
+// marker; writers pad a little after it at most.
+const jpegTailBytes = 4 << 10
+
+// tiffMaxValueBytes caps a single tag value read, so that a corrupt count
+// cannot allocate gigabytes.
+const tiffMaxValueBytes = 4 << 20
+
+// tiffMaxEntries caps the entries read from one IFD.
+const tiffMaxEntries = 1000
+
+// TIFF/EXIF tags read.
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagStripOffsets     = 0x0111
+	tagStripByteCounts  = 0x0117
+	tagDateTime         = 0x0132
+	tagTileOffsets      = 0x0144
+	tagTileByteCounts   = 0x0145
+	tagXMP              = 0x02BC
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+	tagGPSAltitudeRef  = 0x0005
+	tagGPSAltitude     = 0x0006
+)
+
+// ReadMetadata reads the EXIF and XMP headers of a JPEG or TIFF of the given
+// size, and checks that its image data is all there.
+func ReadMetadata(r io.ReaderAt, size int64) (*Metadata, error) {
+	magic := make([]byte, 4)
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return nil, errNotImage
+	}
+	switch {
+	case magic[0] == 0xFF && magic[1] == 0xD8:
+		return readJPEG(r, size)
+	case bytes.Equal(magic, []byte("II*\x00")) || bytes.Equal(magic, []byte("MM\x00*")):
+		md := &Metadata{}
+		dataEnd, err := readTIFF(r, 0, md)
+		if err != nil {
+			return nil, err
+		}
+		md.Truncated = dataEnd > size
+		return md, nil
+	}
+	return nil, errNotImage
+}
+
+// readJPEG walks a JPEG's marker segments up to the scan data, reading the
+// APP1 Exif and XMP segments.
+func readJPEG(r io.ReaderAt, size int64) (*Metadata, error) {
+	md := &Metadata{}
+	var xmp []byte
+	off := int64(2)
+	header := make([]byte, 4)
+	for off+4 <= size {
+		if _, err := r.ReadAt(header, off); err != nil {
+			return nil, fmt.Errorf("failed to read JPEG marker: %w", err)
+		}
+		if header[0] != 0xFF {
+			return nil, fmt.Errorf("invalid JPEG marker at offset %d", off)
+		}
+		marker := header[1]
+		if marker == 0xFF {
+			// Fill byte before the marker.
+			off++
+			continue
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			off += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			// Start of scan: the headers are done.
+			break
+		}
+		length := int64(binary.BigEndian.Uint16(header[2:]))
+		if length < 2 {
+			return nil, fmt.Errorf("invalid JPEG segment length at offset %d", off)
+		}
+		if marker == 0xE1 {
+			segment := make([]byte, min(length-2, size-off-4))
+			if _, err := r.ReadAt(segment, off+4); err != nil {
+				return nil, fmt.Errorf("failed to read JPEG APP1 segment: %w", err)
+			}
+			switch {
+			case bytes.HasPrefix(segment, []byte("Exif\x00\x00")):
+				// A damaged Exif block leaves the image usable, just without
+				// what it would have said.
+				_, _ = readTIFF(r, off+4+6, md)
+			case bytes.HasPrefix(segment, []byte(xmpNamespace+"\x00")):
+				xmp = segment[len(xmpNamespace)+1:]
+			}
+		}
+		off += 2 + length
+	}
+	if len(xmp) > 0 {
+		applyXMP(md, xmp)
+	}
+
+	tail := make([]byte, min(size, jpegTailBytes))
+	if _, err := r.ReadAt(tail, size-int64(len(tail))); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read JPEG tail: %w", err)
+	}
+	md.Truncated = !bytes.Contains(tail, []byte{0xFF, 0xD9})
+	return md, nil
+}
+
+// tiffReader reads a TIFF structure whose offsets count from base.
+type tiffReader struct {
+	r     io.ReaderAt
+	base  int64
+	order binary.ByteOrder
+}
+
+type tiffEntry struct {
+	tag, typ uint16
+	count    uint32
+	// value holds the entry's raw value bytes.
+	value []byte
+}
+
+// readTIFF reads IFD0 and its Exif and GPS IFDs into md, and returns where
+// the image data of IFD0 ends, relative to the start of the file.
+func readTIFF(r io.ReaderAt, base int64, md *Metadata) (int64, error) {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, base); err != nil {
+		return 0, fmt.Errorf("failed to read TIFF header: %w", err)
+	}
+	t := &tiffReader{r: r, base: base}
+	switch string(header[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return 0, fmt.Errorf("invalid TIFF byte order %q", header[:2])
+	}
+	if t.order.Uint16(header[2:]) != 42 {
+		return 0, errors.New("invalid TIFF header")
+	}
+
+	ifd0, err := t.readIFD(int64(t.order.Uint32(header[4:])))
+	if err != nil {
+		return 0, err
+	}
+	if v, ok := ifd0[tagMake]; ok {
+		md.Make = t.ascii(v)
+	}
+	if v, ok := ifd0[tagModel]; ok {
+		md.Model = t.ascii(v)
+	}
+	if v, ok := ifd0[tagDateTime]; ok {
+		md.CapturedAt = parseEXIFTime(t.ascii(v))
+	}
+	if v, ok := ifd0[tagXMP]; ok {
+		applyXMP(md, v.value)
+	}
+	if v, ok := ifd0[tagExifIFD]; ok {
+		if offsets := t.uints(v); len(offsets) > 0 {
+			exif, err := t.readIFD(int64(offsets[0]))
+			if err != nil {
+				return 0, err
+			}
+			if v, ok := exif[tagDateTimeOriginal]; ok {
+				if captured := parseEXIFTime(t.ascii(v)); captured != nil {
+					md.CapturedAt = captured
+				}
+			}
+		}
+	}
+	if v, ok := ifd0[tagGPSIFD]; ok {
+		if offsets := t.uints(v); len(offsets) > 0 {
+			gps, err := t.readIFD(int64(offsets[0]))
+			if err != nil {
+				return 0, err
+			}
+			t.applyGPS(md, gps)
+		}
+	}
+
+	// Only a TIFF file's own strips or tiles count; those of a JPEG's
+	// thumbnail sit in IFD1.
+	var dataEnd int64
+	for _, tags := range [][2]uint16{{tagStripOffsets, tagStripByteCounts}, {tagTileOffsets, tagTileByteCounts}} {
+		offsets, counts := t.uints(ifd0[tags[0]]), t.uints(ifd0[tags[1]])
+		for i := range min(len(offsets), len(counts)) {
+			dataEnd = max(dataEnd, base+int64(offsets[i])+int64(counts[i]))
+		}
+	}
+	return dataEnd, nil
+}
+
+func (t *tiffReader) readIFD(offset int64) (map[uint16]tiffEntry, error) {
+	countBytes := make([]byte, 2)
+	if _, err := t.r.ReadAt(countBytes, t.base+offset); err != nil {
+		return nil, fmt.Errorf("failed to read TIFF IFD: %w", err)
+	}
+	n := int(t.order.Uint16(countBytes))
+	if n > tiffMaxEntries {
+		return nil, fmt.Errorf("TIFF IFD has %d entries", n)
+	}
+	raw := make([]byte, n*12)
+	if _, err := t.r.ReadAt(raw, t.base+offset+2); err != nil {
+		return nil, fmt.Errorf("failed to read TIFF IFD entries: %w", err)
+	}
+
+	entries := make(map[uint16]tiffEntry, n)
+	for i := range n {
+		e := raw[i*12 : (i+1)*12]
+		entry := tiffEntry{tag: t.order.Uint16(e), typ: t.order.Uint16(e[2:]), count: t.order.Uint32(e[4:])}
+		size := tiffTypeSize(entry.typ) * int64(entry.count)
+		if size == 0 || size > tiffMaxValueBytes {
+			continue
+		}
+		if size <= 4 {
+			entry.value = e[8 : 8+size]
+		} else {
+			entry.value = make([]byte, size)
+			if _, err := t.r.ReadAt(entry.value, t.base+int64(t.order.Uint32(e[8:]))); err != nil {
+				// A value past the end of a truncated file; the rest of the
+				// IFD may still be readable.
+				continue
+			}
+		}
+		entries[entry.tag] = entry
+	}
+	return entries, nil
+}
+
+func tiffTypeSize(typ uint16) int64 {
+	switch typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	}
+	return 0
+}
+
+func (t *tiffReader) ascii(e tiffEntry) string {
+	return strings.TrimSpace(strings.TrimRight(string(e.value), "\x00"))
+}
+
+// uints reads a SHORT or LONG array.
+func (t *tiffReader) uints(e tiffEntry) []uint32 {
+	var out []uint32
+	switch e.typ {
+	case 3:
+		for i := 0; i+2 <= len(e.value); i += 2 {
+			out = append(out, uint32(t.order.Uint16(e.value[i:])))
+		}
+	case 4:
+		for i := 0; i+4 <= len(e.value); i += 4 {
+			out = append(out, t.order.Uint32(e.value[i:]))
+		}
+	}
+	return out
+}
+
+// rationals reads a RATIONAL or SRATIONAL array.
+func (t *tiffReader) rationals(e tiffEntry) []float64 {
+	if e.typ != 5 && e.typ != 10 {
+		return nil
+	}
+	var out []float64
+	for i := 0; i+8 <= len(e.value); i += 8 {
+		num, den := t.order.Uint32(e.value[i:]), t.order.Uint32(e.value[i+4:])
+		if den == 0 {
+			return nil
+		}
+		if e.typ == 10 {
+			out = append(out, float64(int32(num))/float64(int32(den)))
+		} else {
+			out = append(out, float64(num)/float64(den))
+		}
+	}
+	return out
+}
+
+func (t *tiffReader) applyGPS(md *Metadata, gps map[uint16]tiffEntry) {
+	lat := t.degrees(gps[tagGPSLatitude], t.ascii(gps[tagGPSLatitudeRef]), "S")
+	lon := t.degrees(gps[tagGPSLongitude], t.ascii(gps[tagGPSLongitudeRef]), "W")
+	// Cameras without a fix write zeros rather than leave the tags out.
+	if lat != nil && lon != nil && (*lat != 0 || *lon != 0) && math.Abs(*lat) <= 90 && math.Abs(*lon) <= 180 {
+		md.HasGPS, md.Latitude, md.Longitude = true, *lat, *lon
+	}
+	if alt := t.rationals(gps[tagGPSAltitude]); len(alt) == 1 {
+		altitude := alt[0]
+		if ref := gps[tagGPSAltitudeRef].value; len(ref) == 1 && ref[0] == 1 {
+			altitude = -altitude
+		}
+		md.Altitude = &altitude
+	}
+}
+
+// degrees converts a degrees, minutes, seconds triple; negative on the
+// negative hemisphere ref.
+func (t *tiffReader) degrees(e tiffEntry, ref, negative string) *float64 {
+	dms := t.rationals(e)
+	if len(dms) != 3 {
+		return nil
+	}
+	deg := dms[0] + dms[1]/60 + dms[2]/3600
+	if strings.EqualFold(ref, negative) {
+		deg = -deg
+	}
+	return &deg
+}
+
+func parseEXIFTime(value string) *time.Time {
+	parsed, err := time.Parse("2006:01:02 15:04:05", strings.TrimSpace(value))
+	if err != nil || parsed.Year() < 1990 {
+		return nil
+	}
+	return &parsed
+}
@@ -0,0 +1,225 @@
+package imagery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testTag struct {
+	tag  uint16
+	typ  uint16
+	data []byte
+}
+
+func asciiTag(tag uint16, value string) testTag {
+	return testTag{tag: tag, typ: 2, data: append([]byte(value), 0)}
+}
+
+func longTag(tag uint16, values ...uint32) testTag {
+	data := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(data[4*i:], v)
+	}
+	return testTag{tag: tag, typ: 4, data: data}
+}
+
+func rationalTag(tag uint16, values ...[2]uint32) testTag {
+	data := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(data[8*i:], v[0])
+		binary.LittleEndian.PutUint32(data[8*i+4:], v[1])
+	}
+	return testTag{tag: tag, typ: 5, data: data}
+}
+
+func ifdSize(tags []testTag) int {
+	n := 2 + 12*len(tags) + 4
+	for _, t := range tags {
+		if len(t.data) > 4 {
+			n += len(t.data) + len(t.data)%2
+		}
+	}
+	return n
+}
+
+// appendIFD appends an IFD starting at len(buf), with its values after it.
+func appendIFD(buf []byte, tags []testTag) []byte {
+	start := len(buf)
+	valueOff := start + 2 + 12*len(tags) + 4
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(tags)))
+	var values []byte
+	for _, t := range tags {
+		size := tiffTypeSize(t.typ)
+		buf = binary.LittleEndian.AppendUint16(buf, t.tag)
+		buf = binary.LittleEndian.AppendUint16(buf, t.typ)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(int64(len(t.data))/size))
+		if len(t.data) <= 4 {
+			buf = append(buf, append(t.data, make([]byte, 4-len(t.data))...)...)
+			continue
+		}
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(valueOff+len(values)))
+		values = append(values, t.data...)
+		if len(t.data)%2 == 1 {
+			values = append(values, 0)
+		}
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, 0)
+	return append(buf, values...)
+}
+
+// buildTIFF lays out a little-endian TIFF header, IFD0, then the Exif and
+// GPS IFDs IFD0 points to.
+func buildTIFF(ifd0, exif, gps []testTag) []byte {
+	ifd0 = append([]testTag(nil), ifd0...)
+	pointers := 0
+	if len(exif) > 0 {
+		pointers++
+	}
+	if len(gps) > 0 {
+		pointers++
+	}
+	// Pointers are inline LONGs, so placeholders size IFD0 exactly.
+	offset := 8 + ifdSize(append(append([]testTag(nil), ifd0...), make([]testTag, pointers)...))
+	if len(exif) > 0 {
+		ifd0 = append(ifd0, longTag(tagExifIFD, uint32(offset)))
+		offset += ifdSize(exif)
+	}
+	if len(gps) > 0 {
+		ifd0 = append(ifd0, longTag(tagGPSIFD, uint32(offset)))
+	}
+
+	buf := []byte("II*\x00")
+	buf = binary.LittleEndian.AppendUint32(buf, 8)
+	buf = appendIFD(buf, ifd0)
+	if len(exif) > 0 {
+		buf = appendIFD(buf, exif)
+	}
+	if len(gps) > 0 {
+		buf = appendIFD(buf, gps)
+	}
+	return buf
+}
+
+func dronePhotoTIFF() []byte {
+	return buildTIFF(
+		[]testTag{asciiTag(tagMake, "DJI"), asciiTag(tagModel, "FC6310"), asciiTag(tagDateTime, "2026:05:01 10:00:00")},
+		[]testTag{asciiTag(tagDateTimeOriginal, "2026:05:01 09:59:58")},
+		[]testTag{
+			asciiTag(tagGPSLatitudeRef, "S"),
+			rationalTag(tagGPSLatitude, [2]uint32{6, 1}, [2]uint32{30, 1}, [2]uint32{0, 1}),
+			asciiTag(tagGPSLongitudeRef, "E"),
+			rationalTag(tagGPSLongitude, [2]uint32{39, 1}, [2]uint32{15, 1}, [2]uint32{36, 1}),
+			{tag: tagGPSAltitudeRef, typ: 1, data: []byte{0}},
+			rationalTag(tagGPSAltitude, [2]uint32{12345, 100}),
+		},
+	)
+}
+
+func appSegment(marker byte, payload []byte) []byte {
+	seg := []byte{0xFF, marker}
+	seg = binary.BigEndian.AppendUint16(seg, uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+func buildJPEG(segments ...[]byte) []byte {
+	buf := []byte{0xFF, 0xD8}
+	for _, s := range segments {
+		buf = append(buf, s...)
+	}
+	buf = append(buf, appSegment(0xDA, make([]byte, 10))...)
+	buf = append(buf, bytes.Repeat([]byte{0x12, 0x34}, 512)...)
+	return append(buf, 0xFF, 0xD9)
+}
+
+func TestReadMetadata_JPEGExif(t *testing.T) {
+	jpeg := buildJPEG(appSegment(0xE1, append([]byte("Exif\x00\x00"), dronePhotoTIFF()...)))
+
+	md, err := ReadMetadata(bytes.NewReader(jpeg), int64(len(jpeg)))
+	require.NoError(t, err)
+	assert.Equal(t, "DJI", md.Make)
+	assert.Equal(t, "FC6310", md.Model)
+	require.NotNil(t, md.CapturedAt)
+	assert.Equal(t, time.Date(2026, 5, 1, 9, 59, 58, 0, time.UTC), *md.CapturedAt)
+	assert.True(t, md.HasGPS)
+	assert.InDelta(t, -6.5, md.Latitude, 1e-9)
+	assert.InDelta(t, 39.26, md.Longitude, 1e-9)
+	require.NotNil(t, md.Altitude)
+	assert.InDelta(t, 123.45, *md.Altitude, 1e-9)
+	assert.False(t, md.Truncated)
+
+	// Cut short partway through the scan data.
+	cut := jpeg[:len(jpeg)-600]
+	md, err = ReadMetadata(bytes.NewReader(cut), int64(len(cut)))
+	require.NoError(t, err)
+	assert.True(t, md.Truncated)
+	assert.Equal(t, "FC6310", md.Model)
+}
+
+func TestReadMetadata_JPEGXMPFallback(t *testing.T) {
+	xmp := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF><rdf:Description
+		tiff:Make="DJI" tiff:Model="M3E"
+		drone-dji:GpsLatitude="-6.80" drone-dji:GpsLongtitude="39.28"
+		drone-dji:AbsoluteAltitude="+210.5"/></rdf:RDF></x:xmpmeta>`
+	jpeg := buildJPEG(appSegment(0xE1, append([]byte(xmpNamespace+"\x00"), xmp...)))
+
+	md, err := ReadMetadata(bytes.NewReader(jpeg), int64(len(jpeg)))
+	require.NoError(t, err)
+	assert.Equal(t, "DJI", md.Make)
+	assert.Equal(t, "M3E", md.Model)
+	assert.True(t, md.HasGPS)
+	assert.InDelta(t, -6.80, md.Latitude, 1e-9)
+	assert.InDelta(t, 39.28, md.Longitude, 1e-9)
+	require.NotNil(t, md.Altitude)
+	assert.InDelta(t, 210.5, *md.Altitude, 1e-9)
+	assert.Nil(t, md.CapturedAt)
+}
+
+func TestReadMetadata_ZeroGPSIsMissing(t *testing.T) {
+	tiff := buildTIFF(
+		[]testTag{asciiTag(tagModel, "FC6310")},
+		nil,
+		[]testTag{
+			rationalTag(tagGPSLatitude, [2]uint32{0, 1}, [2]uint32{0, 1}, [2]uint32{0, 1}),
+			rationalTag(tagGPSLongitude, [2]uint32{0, 1}, [2]uint32{0, 1}, [2]uint32{0, 1}),
+		},
+	)
+	jpeg := buildJPEG(appSegment(0xE1, append([]byte("Exif\x00\x00"), tiff...)))
+
+	md, err := ReadMetadata(bytes.NewReader(jpeg), int64(len(jpeg)))
+	require.NoError(t, err)
+	assert.False(t, md.HasGPS)
+}
+
+func TestReadMetadata_TIFFStrips(t *testing.T) {
+	strip := func(offset uint32) []byte {
+		return buildTIFF([]testTag{
+			asciiTag(tagModel, "Zenmuse XT2"),
+			longTag(tagStripOffsets, offset),
+			longTag(tagStripByteCounts, 1000),
+		}, nil, nil)
+	}
+	// One strip of 1000 bytes right after the header.
+	tiff := strip(uint32(len(strip(0))))
+	tiff = append(tiff, make([]byte, 1000)...)
+
+	md, err := ReadMetadata(bytes.NewReader(tiff), int64(len(tiff)))
+	require.NoError(t, err)
+	assert.Equal(t, "Zenmuse XT2", md.Model)
+	assert.False(t, md.Truncated)
+
+	cut := tiff[:len(tiff)-100]
+	md, err = ReadMetadata(bytes.NewReader(cut), int64(len(cut)))
+	require.NoError(t, err)
+	assert.True(t, md.Truncated)
+}
+
+func TestReadMetadata_NotAnImage(t *testing.T) {
+	data := []byte("<html>not found</html>")
+	_, err := ReadMetadata(bytes.NewReader(data), int64(len(data)))
+	assert.ErrorIs(t, err, errNotImage)
+}
@@ -0,0 +1,259 @@
+// Package imagery inspects a task's images before it runs: the cameras that
+// took them, where and when, and whether each one is whole.
+//
+// ODM fails hours into a run, or quietly produces a worse model, on imagery
+// that a look at its headers would have flagged: photos without a GPS
+// position, two cameras mixed in one dataset, a JPEG cut short by an
+// interrupted upload. Inspection reads each image's EXIF and XMP headers
+// with ranged GETs - the first HeadBytes, and for a JPEG its last few KiB to
+// find the end-of-image marker - so a dataset is checked without
+// downloading it.
+package imagery
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Severities of an Issue. Errors reject a task when inspection is set to
+// reject; warnings never do.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Issue codes.
+const (
+	IssueNoImages     = "no_images"
+	IssueUnreadable   = "unreadable"
+	IssueTruncated    = "truncated"
+	IssueMissingGPS   = "missing_gps"
+	IssueMixedCameras = "mixed_cameras"
+	IssueDuplicates   = "duplicates"
+)
+
+// Image is one inspected image.
+type Image struct {
+	Key  string
+	Size int64
+	ETag string
+	// Metadata is nil when the file is not a readable JPEG or TIFF; Err
+	// says why.
+	Metadata *Metadata
+	Err      error
+}
+
+// Camera is a camera model and the images it took.
+type Camera struct {
+	Make   string
+	Model  string
+	Images int
+}
+
+// Bounds is the bounding box of the images' GPS positions, in degrees.
+type Bounds struct {
+	MinLatitude  float64
+	MinLongitude float64
+	MaxLatitude  float64
+	MaxLongitude float64
+}
+
+// Issue is a problem inspection found, with the images it concerns.
+type Issue struct {
+	Code     string
+	Severity string
+	Message  string
+	Images   []string
+}
+
+// Report summarizes a dataset's images.
+type Report struct {
+	Images     int
+	TotalBytes int64
+	// Cameras is most images first.
+	Cameras []Camera
+	WithGPS int
+	// Bounds, the altitude range and the capture span are nil when no image
+	// has them.
+	Bounds       *Bounds
+	MinAltitude  *float64
+	MaxAltitude  *float64
+	FirstCapture *time.Time
+	LastCapture  *time.Time
+	MissingGPS   []string
+	Truncated    []string
+	Unreadable   []string
+	// Duplicates groups images with the same content (size and ETag).
+	Duplicates [][]string
+	Issues     []Issue
+}
+
+// HasErrors reports whether any issue is an error.
+func (r *Report) HasErrors() bool {
+	for _, issue := range r.Issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Thresholds decide which findings are errors.
+type Thresholds struct {
+	// MaxMissingGPSPercent is the share of images that may lack a GPS
+	// position before it is an error rather than a warning; ODM needs GCPs
+	// to place the rest.
+	MaxMissingGPSPercent float64
+}
+
+// Summarize builds the report of inspected images.
+func Summarize(images []Image, thresholds Thresholds) *Report {
+	images = append([]Image(nil), images...)
+	sort.Slice(images, func(i, j int) bool { return images[i].Key < images[j].Key })
+
+	report := &Report{Images: len(images)}
+	cameras := map[[2]string]int{}
+	byContent := map[string][]string{}
+	var contentOrder []string
+	for _, img := range images {
+		report.TotalBytes += img.Size
+		if img.ETag != "" {
+			content := fmt.Sprintf("%d/%s", img.Size, img.ETag)
+			if _, ok := byContent[content]; !ok {
+				contentOrder = append(contentOrder, content)
+			}
+			byContent[content] = append(byContent[content], img.Key)
+		}
+
+		md := img.Metadata
+		if md == nil {
+			report.Unreadable = append(report.Unreadable, img.Key)
+			continue
+		}
+		if md.Truncated {
+			report.Truncated = append(report.Truncated, img.Key)
+		}
+		if md.Make != "" || md.Model != "" {
+			cameras[[2]string{md.Make, md.Model}]++
+		}
+		if md.HasGPS {
+			report.WithGPS++
+			report.Bounds = extendBounds(report.Bounds, md.Latitude, md.Longitude)
+		} else {
+			report.MissingGPS = append(report.MissingGPS, img.Key)
+		}
+		if md.Altitude != nil {
+			report.MinAltitude = minPtr(report.MinAltitude, *md.Altitude)
+			report.MaxAltitude = maxPtr(report.MaxAltitude, *md.Altitude)
+		}
+		if md.CapturedAt != nil {
+			if report.FirstCapture == nil || md.CapturedAt.Before(*report.FirstCapture) {
+				report.FirstCapture = md.CapturedAt
+			}
+			if report.LastCapture == nil || md.CapturedAt.After(*report.LastCapture) {
+				report.LastCapture = md.CapturedAt
+			}
+		}
+	}
+
+	for camera, n := range cameras {
+		report.Cameras = append(report.Cameras, Camera{Make: camera[0], Model: camera[1], Images: n})
+	}
+	sort.Slice(report.Cameras, func(i, j int) bool {
+		a, b := report.Cameras[i], report.Cameras[j]
+		if a.Images != b.Images {
+			return a.Images > b.Images
+		}
+		return a.Make+" "+a.Model < b.Make+" "+b.Model
+	})
+	for _, content := range contentOrder {
+		if keys := byContent[content]; len(keys) > 1 {
+			report.Duplicates = append(report.Duplicates, keys)
+		}
+	}
+
+	report.Issues = assess(report, thresholds)
+	return report
+}
+
+func assess(r *Report, thresholds Thresholds) []Issue {
+	var issues []Issue
+	if r.Images == 0 {
+		return append(issues, Issue{Code: IssueNoImages, Severity: SeverityError, Message: "No JPEG or TIFF images found"})
+	}
+	if n := len(r.Unreadable); n > 0 {
+		issues = append(issues, Issue{
+			Code: IssueUnreadable, Severity: SeverityError, Images: r.Unreadable,
+			Message: fmt.Sprintf("%s not a readable JPEG or TIFF", countImages(n, r.Images, "is", "are")),
+		})
+	}
+	if n := len(r.Truncated); n > 0 {
+		issues = append(issues, Issue{
+			Code: IssueTruncated, Severity: SeverityError, Images: r.Truncated,
+			Message: fmt.Sprintf("%s truncated", countImages(n, r.Images, "is", "are")),
+		})
+	}
+	if n := len(r.MissingGPS); n > 0 {
+		severity := SeverityWarning
+		if float64(n)*100 > thresholds.MaxMissingGPSPercent*float64(r.Images) {
+			severity = SeverityError
+		}
+		issues = append(issues, Issue{
+			Code: IssueMissingGPS, Severity: severity, Images: r.MissingGPS,
+			Message: fmt.Sprintf("%s no GPS position", countImages(n, r.Images, "has", "have")),
+		})
+	}
+	if len(r.Cameras) > 1 {
+		names := make([]string, len(r.Cameras))
+		for i, c := range r.Cameras {
+			names[i] = fmt.Sprintf("%s (%d)", strings.TrimSpace(c.Make+" "+c.Model), c.Images)
+		}
+		issues = append(issues, Issue{
+			Code: IssueMixedCameras, Severity: SeverityWarning,
+			Message: fmt.Sprintf("Images come from %d camera models: %s", len(r.Cameras), strings.Join(names, ", ")),
+		})
+	}
+	if len(r.Duplicates) > 0 {
+		var keys []string
+		for _, group := range r.Duplicates {
+			keys = append(keys, group...)
+		}
+		issues = append(issues, Issue{
+			Code: IssueDuplicates, Severity: SeverityWarning, Images: keys,
+			Message: fmt.Sprintf("%d images are copies of others", len(keys)-len(r.Duplicates)),
+		})
+	}
+	return issues
+}
+
+func countImages(n, total int, singular, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 of %d images %s", total, singular)
+	}
+	return fmt.Sprintf("%d of %d images %s", n, total, plural)
+}
+
+func extendBounds(b *Bounds, lat, lon float64) *Bounds {
+	if b == nil {
+		return &Bounds{MinLatitude: lat, MinLongitude: lon, MaxLatitude: lat, MaxLongitude: lon}
+	}
+	b.MinLatitude, b.MaxLatitude = min(b.MinLatitude, lat), max(b.MaxLatitude, lat)
+	b.MinLongitude, b.MaxLongitude = min(b.MinLongitude, lon), max(b.MaxLongitude, lon)
+	return b
+}
+
+func minPtr(cur *float64, v float64) *float64 {
+	if cur == nil || v < *cur {
+		return &v
+	}
+	return cur
+}
+
+func maxPtr(cur *float64, v float64) *float64 {
+	if cur == nil || v > *cur {
+		return &v
+	}
+	return cur
+}
@@ -0,0 +1,102 @@
+package imagery
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func photo(model string, lat, lon, alt float64, captured time.Time) *Metadata {
+	return &Metadata{Make: "DJI", Model: model, HasGPS: true, Latitude: lat, Longitude: lon, Altitude: &alt, CapturedAt: &captured}
+}
+
+func issueCodes(issues []Issue) map[string]string {
+	codes := map[string]string{}
+	for _, issue := range issues {
+		codes[issue.Code] = issue.Severity
+	}
+	return codes
+}
+
+func TestSummarize(t *testing.T) {
+	start := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	images := []Image{
+		{Key: "survey/b.jpg", Size: 100, ETag: "e2", Metadata: photo("FC6310", -6.81, 39.27, 150, start.Add(time.Minute))},
+		{Key: "survey/a.jpg", Size: 100, ETag: "e1", Metadata: photo("FC6310", -6.80, 39.28, 140, start)},
+		{Key: "survey/copy-of-a.jpg", Size: 100, ETag: "e1", Metadata: photo("FC6310", -6.80, 39.28, 140, start)},
+		{Key: "survey/c.jpg", Size: 100, ETag: "e3", Metadata: photo("FC7303", -6.79, 39.29, 160, start.Add(20*time.Minute))},
+		{Key: "survey/nogps.jpg", Size: 100, ETag: "e4", Metadata: &Metadata{Make: "DJI", Model: "FC6310"}},
+		{Key: "survey/cut.jpg", Size: 50, ETag: "e5", Metadata: &Metadata{Make: "DJI", Model: "FC6310", Truncated: true}},
+		{Key: "survey/readme.jpg", Size: 10, ETag: "e6", Err: errNotImage},
+	}
+
+	report := Summarize(images, Thresholds{MaxMissingGPSPercent: 50})
+
+	assert.Equal(t, 7, report.Images)
+	assert.EqualValues(t, 560, report.TotalBytes)
+	assert.Equal(t, []Camera{{"DJI", "FC6310", 5}, {"DJI", "FC7303", 1}}, report.Cameras)
+	assert.Equal(t, 4, report.WithGPS)
+	assert.Equal(t, &Bounds{MinLatitude: -6.81, MinLongitude: 39.27, MaxLatitude: -6.79, MaxLongitude: 39.29}, report.Bounds)
+	assert.Equal(t, 140.0, *report.MinAltitude)
+	assert.Equal(t, 160.0, *report.MaxAltitude)
+	assert.Equal(t, start, *report.FirstCapture)
+	assert.Equal(t, start.Add(20*time.Minute), *report.LastCapture)
+	assert.Equal(t, []string{"survey/cut.jpg", "survey/nogps.jpg"}, report.MissingGPS)
+	assert.Equal(t, []string{"survey/cut.jpg"}, report.Truncated)
+	assert.Equal(t, []string{"survey/readme.jpg"}, report.Unreadable)
+	assert.Equal(t, [][]string{{"survey/a.jpg", "survey/copy-of-a.jpg"}}, report.Duplicates)
+
+	assert.Equal(t, map[string]string{
+		IssueUnreadable:   SeverityError,
+		IssueTruncated:    SeverityError,
+		IssueMissingGPS:   SeverityWarning,
+		IssueMixedCameras: SeverityWarning,
+		IssueDuplicates:   SeverityWarning,
+	}, issueCodes(report.Issues))
+	assert.True(t, report.HasErrors())
+}
+
+func TestSummarize_MissingGPSThreshold(t *testing.T) {
+	var images []Image
+	for i := range 10 {
+		md := &Metadata{Make: "DJI", Model: "FC6310"}
+		if i >= 3 {
+			md = photo("FC6310", -6.8, 39.28, 140, time.Now())
+		}
+		images = append(images, Image{Key: fmt.Sprintf("img-%02d.jpg", i), Size: 100, ETag: fmt.Sprint(i), Metadata: md})
+	}
+
+	// 3 of 10 lack GPS.
+	report := Summarize(images, Thresholds{MaxMissingGPSPercent: 30})
+	assert.Equal(t, map[string]string{IssueMissingGPS: SeverityWarning}, issueCodes(report.Issues))
+	assert.False(t, report.HasErrors())
+
+	report = Summarize(images, Thresholds{MaxMissingGPSPercent: 20})
+	assert.Equal(t, map[string]string{IssueMissingGPS: SeverityError}, issueCodes(report.Issues))
+	require.Len(t, report.Issues, 1)
+	assert.Equal(t, "3 of 10 images have no GPS position", report.Issues[0].Message)
+}
+
+func TestSummarize_NoImages(t *testing.T) {
+	report := Summarize(nil, Thresholds{})
+	assert.Equal(t, map[string]string{IssueNoImages: SeverityError}, issueCodes(report.Issues))
+	assert.Nil(t, report.Bounds)
+	assert.Nil(t, report.FirstCapture)
+}
+
+func TestSummarize_CleanDataset(t *testing.T) {
+	images := []Image{
+		{Key: "a.jpg", Size: 100, ETag: "e1", Metadata: photo("FC6310", -6.80, 39.28, 140, time.Now())},
+		// Objects uploaded in parts have ETags that cannot be compared; an
+		// empty one never matches.
+		{Key: "b.jpg", Size: 100, Metadata: photo("FC6310", -6.81, 39.27, 140, time.Now())},
+		{Key: "c.jpg", Size: 100, Metadata: photo("FC6310", -6.82, 39.26, 140, time.Now())},
+	}
+	report := Summarize(images, Thresholds{MaxMissingGPSPercent: 50})
+	assert.Empty(t, report.Issues)
+	assert.Empty(t, report.Duplicates)
+	assert.False(t, report.HasErrors())
+}
@@ -0,0 +1,158 @@
+package imagery
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/hotosm/scaleodm/app/s3"
+)
+
+// HeadBytes is how much of each image is fetched up front. JPEG headers,
+// Exif thumbnail and XMP packet included, fit in it; anything past it, such
+// as a TIFF's IFDs at the end of the file, is fetched as the parser needs it.
+const HeadBytes = 128 << 10
+
+// Options tune Inspect.
+type Options struct {
+	// Concurrency is how many images are read at once.
+	Concurrency int
+	Thresholds  Thresholds
+}
+
+// Inspect reads the headers of the images under readS3Path that a task's
+// download stage would fetch (see s3.CountImageStatsInS3PathWithExcludes)
+// and summarizes them. It fails only when S3 does; unreadable images are
+// findings of the report.
+func Inspect(ctx context.Context, client *minio.Client, readS3Path string, excludePatterns []string, opts Options) (*Report, error) {
+	bucket, objects, err := s3.ListImagesInS3PathWithExcludes(ctx, client, readS3Path, excludePatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	images := make([]Image, len(objects))
+	sem := make(chan struct{}, max(opts.Concurrency, 1))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	for i, object := range objects {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			img, err := inspectObject(ctx, client, bucket, object)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+				return
+			}
+			images[i] = img
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return Summarize(images, opts.Thresholds), nil
+}
+
+func inspectObject(ctx context.Context, client *minio.Client, bucket string, object minio.ObjectInfo) (Image, error) {
+	img := Image{Key: object.Key, Size: object.Size, ETag: object.ETag}
+	r := &objectReader{ctx: ctx, client: client, bucket: bucket, key: object.Key, size: object.Size}
+	if err := r.prefetch(HeadBytes); err != nil {
+		return img, err
+	}
+	md, err := ReadMetadata(r, object.Size)
+	if r.err != nil {
+		return img, r.err
+	}
+	img.Metadata, img.Err = md, err
+	return img, nil
+}
+
+// objectReader is an io.ReaderAt over an S3 object that serves reads from a
+// prefetched head and fetches anything else with a ranged GET. A failed GET
+// is kept in err, so that it is not mistaken for a malformed image.
+type objectReader struct {
+	ctx    context.Context
+	client *minio.Client
+	bucket string
+	key    string
+	size   int64
+	head   []byte
+	err    error
+}
+
+func (r *objectReader) prefetch(n int64) error {
+	head, err := r.fetch(0, min(n, r.size))
+	if err != nil {
+		return err
+	}
+	r.head = head
+	return nil
+}
+
+func (r *objectReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	n := min(int64(len(p)), r.size-off)
+	if off+n <= int64(len(r.head)) {
+		copy(p, r.head[off:off+n])
+	} else {
+		data, err := r.fetch(off, n)
+		if err != nil {
+			if r.err == nil {
+				r.err = err
+			}
+			return 0, err
+		}
+		copy(p, data)
+	}
+	if n < int64(len(p)) {
+		return int(n), io.EOF
+	}
+	return int(n), nil
+}
+
+// fetch GETs n bytes of the object from off.
+func (r *objectReader) fetch(off, n int64) ([]byte, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(off, off+n-1); err != nil {
+		return nil, err
+	}
+	obj, err := r.client.GetObject(r.ctx, r.bucket, r.key, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", r.key, err)
+	}
+	defer obj.Close()
+	data := make([]byte, n)
+	if _, err := io.ReadFull(obj, data); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", r.key, err)
+	}
+	return data, nil
+}
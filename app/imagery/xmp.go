@@ -0,0 +1,65 @@
+package imagery
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xmpNamespace identifies an XMP packet in a JPEG APP1 segment.
+const xmpNamespace = "http://ns.adobe.com/xap/1.0/"
+
+// XMP properties are written either as attributes of rdf:Description or as
+// child elements; both forms are read.
+var (
+	xmpAttribute = regexp.MustCompile(`([A-Za-z][\w-]*):(\w+)\s*=\s*"([^"]*)"`)
+	xmpElement   = regexp.MustCompile(`<([A-Za-z][\w-]*):(\w+)>([^<]*)</`)
+)
+
+// applyXMP fills what EXIF left out from an XMP packet: the camera, the
+// capture time and, from drones' own namespaces (DJI's drone-dji and the
+// like), the position and absolute altitude.
+func applyXMP(md *Metadata, packet []byte) {
+	props := map[string]string{}
+	for _, re := range []*regexp.Regexp{xmpAttribute, xmpElement} {
+		for _, m := range re.FindAllSubmatch(packet, -1) {
+			name := strings.ToLower(string(m[2]))
+			if _, ok := props[name]; !ok {
+				props[name] = strings.TrimSpace(string(m[3]))
+			}
+		}
+	}
+
+	if md.Make == "" {
+		md.Make = props["make"]
+	}
+	if md.Model == "" {
+		md.Model = props["model"]
+	}
+	if md.CapturedAt == nil {
+		if captured, err := time.Parse(time.RFC3339, props["datetimeoriginal"]); err == nil {
+			captured = captured.UTC()
+			md.CapturedAt = &captured
+		} else if captured, err := time.Parse("2006-01-02T15:04:05", props["datetimeoriginal"]); err == nil {
+			md.CapturedAt = &captured
+		}
+	}
+	if !md.HasGPS {
+		lat, latErr := strconv.ParseFloat(props["gpslatitude"], 64)
+		// DJI has long spelled it GpsLongtitude.
+		lonValue := props["gpslongitude"]
+		if lonValue == "" {
+			lonValue = props["gpslongtitude"]
+		}
+		lon, lonErr := strconv.ParseFloat(lonValue, 64)
+		if latErr == nil && lonErr == nil && (lat != 0 || lon != 0) && lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180 {
+			md.HasGPS, md.Latitude, md.Longitude = true, lat, lon
+		}
+	}
+	if md.Altitude == nil {
+		if altitude, err := strconv.ParseFloat(props["absolutealtitude"], 64); err == nil {
+			md.Altitude = &altitude
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Package logstream serves task logs as Server-Sent Events.
+package logstream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Follower writes a task's log from line fromLine (0-based) on, following it
+// until there will be no more, and returns then. It must write whole lines.
+type Follower func(ctx context.Context, fromLine int, w io.Writer) error
+
+// keepaliveInterval spaces the comments that keep idle streams open through
+// proxies while a stage runs without logging.
+const keepaliveInterval = 15 * time.Second
+
+// Serve streams a log as Server-Sent Events: one "message" event per line,
+// whose id is the line number counting from 1, so a reconnecting EventSource
+// resumes after the last line it got through Last-Event-ID. A first request
+// can start part way with ?line=N, as /task/{uuid}/output does. Once the
+// follower returns, an "end" event tells the client not to reconnect, or a
+// "failed" event carries the error.
+func Serve(w http.ResponseWriter, r *http.Request, logPrefix string, follow Follower) {
+	fromLine, err := startLine(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// Stops nginx-style proxies from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// A followed log outlives SCALEODM_SERVER_WRITE_TIMEOUT_SECONDS.
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("%s: failed to clear write deadline: %v", logPrefix, err)
+	}
+
+	events := &eventWriter{w: w, rc: rc, line: fromLine}
+	w.WriteHeader(http.StatusOK)
+	events.comment("stream from line " + strconv.Itoa(fromLine+1))
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(keepaliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if events.comment("keepalive") != nil {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	followErr := follow(ctx, fromLine, events)
+	cancel()
+	if r.Context().Err() != nil || events.err != nil {
+		log.Printf("%s: client left after line %d", logPrefix, events.sent())
+		return
+	}
+	if followErr != nil {
+		log.Printf("%s: failed to follow logs after line %d: %v", logPrefix, events.sent(), followErr)
+		events.event("failed", "Failed to retrieve logs")
+		return
+	}
+	events.event("end", "")
+}
+
+// startLine reads the 0-based line to start from: the one after
+// Last-Event-ID, else ?line=.
+func startLine(r *http.Request) (int, error) {
+	if raw := strings.TrimSpace(r.Header.Get("Last-Event-ID")); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id < 0 {
+			return 0, fmt.Errorf("invalid Last-Event-ID %q", raw)
+		}
+		return id, nil
+	}
+	if raw := strings.TrimSpace(r.URL.Query().Get("line")); raw != "" {
+		line, err := strconv.Atoi(raw)
+		if err != nil || line < 0 {
+			return 0, fmt.Errorf("invalid line %q", raw)
+		}
+		return line, nil
+	}
+	return 0, nil
+}
+
+// eventWriter turns the lines written to it into events. Writes come from the
+// follower and comments from the keepalive loop, hence the lock.
+type eventWriter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	rc   *http.ResponseController
+	line int
+	buf  bytes.Buffer
+	err  error
+}
+
+func (e *eventWriter) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err != nil {
+		return 0, e.err
+	}
+	e.buf.Reset()
+	for _, line := range strings.SplitAfter(string(p), "\n") {
+		if line == "" {
+			continue
+		}
+		e.line++
+		e.buf.WriteString("id: " + strconv.Itoa(e.line) + "\n")
+		writeData(&e.buf, strings.TrimSuffix(line, "\n"))
+	}
+	if err := e.flush(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (e *eventWriter) comment(text string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err != nil {
+		return e.err
+	}
+	e.buf.Reset()
+	e.buf.WriteString(": " + text + "\n\n")
+	return e.flush()
+}
+
+func (e *eventWriter) event(name, data string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err != nil {
+		return
+	}
+	e.buf.Reset()
+	e.buf.WriteString("event: " + name + "\n")
+	writeData(&e.buf, data)
+	_ = e.flush()
+}
+
+func (e *eventWriter) sent() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.line
+}
+
+func (e *eventWriter) flush() error {
+	if _, err := e.w.Write(e.buf.Bytes()); err != nil {
+		e.err = err
+		return err
+	}
+	if err := e.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		e.err = err
+		return err
+	}
+	return nil
+}
+
+// writeData writes text as the data of an event. A carriage return ends an
+// SSE line, and ODM's progress bars use them, so each part gets its own data
+// field; the client joins them with newlines.
+func writeData(buf *bytes.Buffer, text string) {
+	for _, part := range strings.Split(text, "\r") {
+		buf.WriteString("data: " + part + "\n")
+	}
+	buf.WriteString("\n")
+}
@@ -0,0 +1,72 @@
+package logstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServe_NumbersLinesAndEnds(t *testing.T) {
+	var gotFrom int
+	follow := func(ctx context.Context, fromLine int, w io.Writer) error {
+		gotFrom = fromLine
+		_, err := io.WriteString(w, "first\nsecond\rprogress\n")
+		return err
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/task/abc/output/stream", nil)
+	req.Header.Set("Last-Event-ID", "7")
+	w := httptest.NewRecorder()
+	Serve(w, req, "test", follow)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, 7, gotFrom)
+	assert.Equal(t, ": stream from line 8\n\n"+
+		"id: 8\ndata: first\n\n"+
+		"id: 9\ndata: second\ndata: progress\n\n"+
+		"event: end\ndata: \n\n", w.Body.String())
+}
+
+func TestServe_StartLine(t *testing.T) {
+	var gotFrom int
+	follow := func(ctx context.Context, fromLine int, w io.Writer) error {
+		gotFrom = fromLine
+		return nil
+	}
+
+	w := httptest.NewRecorder()
+	Serve(w, httptest.NewRequest(http.MethodGet, "/stream?line=12", nil), "test", follow)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 12, gotFrom)
+
+	req := httptest.NewRequest(http.MethodGet, "/stream?line=12", nil)
+	req.Header.Set("Last-Event-ID", "3")
+	Serve(httptest.NewRecorder(), req, "test", follow)
+	assert.Equal(t, 3, gotFrom, "Last-Event-ID wins over ?line=")
+
+	for _, target := range []string{"/stream?line=-1", "/stream?line=x"} {
+		w = httptest.NewRecorder()
+		Serve(w, httptest.NewRequest(http.MethodGet, target, nil), "test", follow)
+		assert.Equal(t, http.StatusBadRequest, w.Code, target)
+	}
+}
+
+func TestServe_ReportsFollowerError(t *testing.T) {
+	follow := func(ctx context.Context, fromLine int, w io.Writer) error {
+		_, _ = io.WriteString(w, "partial\n")
+		return errors.New("archive unavailable")
+	}
+
+	w := httptest.NewRecorder()
+	Serve(w, httptest.NewRequest(http.MethodGet, "/stream", nil), "test", follow)
+	assert.Contains(t, w.Body.String(), "id: 1\ndata: partial\n\n")
+	assert.Contains(t, w.Body.String(), "event: failed\ndata: Failed to retrieve logs\n\n")
+	assert.NotContains(t, w.Body.String(), "event: end")
+}
@@ -0,0 +1,117 @@
+package meta
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TaskTransition is a job status change, as the store records it.
+type TaskTransition struct {
+	WorkflowName string
+	ProjectID    string
+	Tenant       string
+	From         string
+	To           string
+	ErrorMessage string
+	At           time.Time
+}
+
+// SetTransitionHook registers fn to be told of every status change the store
+// commits: the updates of UpdateJobStatus and friends, a claim that fails for
+// good and the cancellation of a queued job. Moves within the queue (claimed,
+// requeued) are not reported. fn runs on the caller's goroutine and must not
+// block. Set it before the store is shared.
+func (s *Store) SetTransitionHook(fn func(TaskTransition)) {
+	s.onTransition = fn
+}
+
+func (s *Store) transitioned(transition TaskTransition) {
+	if s.onTransition == nil {
+		return
+	}
+	transition.At = time.Now().UTC()
+	s.onTransition(transition)
+}
+
+// EventSubscription registers a sink target for the task events of a tenant,
+// a project, or both. An empty Tenant or ProjectID matches any.
+type EventSubscription struct {
+	ID        int64
+	Tenant    string
+	ProjectID string
+	Target    string
+	CreatedAt time.Time
+}
+
+// CreateEventSubscription stores a subscription.
+func (s *Store) CreateEventSubscription(ctx context.Context, tenant, projectID, target string) (*EventSubscription, error) {
+	query := `
+		INSERT INTO scaleodm_event_subscriptions (tenant, odm_project_id, target)
+		VALUES (NULLIF($1, ''), NULLIF($2, ''), $3)
+		RETURNING id, created_at
+	`
+	sub := &EventSubscription{Tenant: tenant, ProjectID: projectID, Target: target}
+	if err := s.db.Pool.QueryRow(ctx, query, tenant, projectID, target).Scan(&sub.ID, &sub.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to create event subscription: %w", err)
+	}
+	return sub, nil
+}
+
+// ListEventSubscriptions returns subscriptions, oldest first. A non-empty
+// tenant limits the list to that tenant's.
+func (s *Store) ListEventSubscriptions(ctx context.Context, tenant string) ([]EventSubscription, error) {
+	query := `
+		SELECT id, COALESCE(tenant, ''), COALESCE(odm_project_id, ''), target, created_at
+		FROM scaleodm_event_subscriptions
+		WHERE $1 = '' OR tenant = $1
+		ORDER BY id
+	`
+	rows, err := s.db.Pool.Query(ctx, query, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list event subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subs := []EventSubscription{}
+	for rows.Next() {
+		var sub EventSubscription
+		if err := rows.Scan(&sub.ID, &sub.Tenant, &sub.ProjectID, &sub.Target, &sub.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan event subscription: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// DeleteEventSubscription removes a subscription and reports whether it
+// existed. A non-empty tenant only removes that tenant's.
+func (s *Store) DeleteEventSubscription(ctx context.Context, id int64, tenant string) (bool, error) {
+	result, err := s.db.Pool.Exec(ctx, `DELETE FROM scaleodm_event_subscriptions WHERE id = $1 AND ($2 = '' OR tenant = $2)`, id, tenant)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete event subscription: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// EventTargets returns the distinct targets subscribed to the events of a
+// task of the given tenant and project.
+func (s *Store) EventTargets(ctx context.Context, tenant, projectID string) ([]string, error) {
+	query := `
+		SELECT DISTINCT target FROM scaleodm_event_subscriptions
+		WHERE (tenant IS NULL OR tenant = $1)
+		  AND (odm_project_id IS NULL OR odm_project_id = $2)
+		ORDER BY target
+	`
+	rows, err := s.db.Pool.Query(ctx, query, tenant, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to match event subscriptions: %w", err)
+	}
+	targets, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan event target: %w", err)
+	}
+	return targets, nil
+}
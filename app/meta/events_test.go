@@ -0,0 +1,84 @@
+package meta
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransitionHook(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+	var transitions []TaskTransition
+	store.SetTransitionHook(func(transition TaskTransition) { transitions = append(transitions, transition) })
+
+	_, err := store.CreateJobForTenant(ctx, "dronetm", "wf-events", "project", "s3://bucket/images/", "s3://bucket/output/", nil, "us-east-1", nil)
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateJobStatus(ctx, "wf-events", "running", nil))
+	// A repeated status is not a transition.
+	require.NoError(t, store.UpdateJobStatus(ctx, "wf-events", "running", nil))
+	errorMsg := "ODM exited with code 1"
+	require.NoError(t, store.UpdateJobStatus(ctx, "wf-events", "failed", &errorMsg))
+
+	require.Len(t, transitions, 2)
+	assert.Equal(t, "wf-events", transitions[0].WorkflowName)
+	assert.Equal(t, "project", transitions[0].ProjectID)
+	assert.Equal(t, "dronetm", transitions[0].Tenant)
+	assert.Equal(t, "running", transitions[0].To)
+	assert.False(t, transitions[0].At.IsZero())
+	assert.Equal(t, "running", transitions[1].From)
+	assert.Equal(t, "failed", transitions[1].To)
+	assert.Equal(t, errorMsg, transitions[1].ErrorMessage)
+
+	queueJob(t, store, "wf-events-queued", "project", 0)
+	canceled, err := store.CancelQueuedJob(ctx, "wf-events-queued")
+	require.NoError(t, err)
+	require.True(t, canceled)
+	require.Len(t, transitions, 3)
+	assert.Equal(t, "queued", transitions[2].From)
+	assert.Equal(t, "canceled", transitions[2].To)
+}
+
+func TestEventSubscriptions(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	_, err := store.CreateEventSubscription(ctx, "", "", "https://all.example/events")
+	require.NoError(t, err)
+	tenantSub, err := store.CreateEventSubscription(ctx, "dronetm", "", "https://dronetm.example/events")
+	require.NoError(t, err)
+	_, err = store.CreateEventSubscription(ctx, "dronetm", "project-1", "https://dronetm.example/events")
+	require.NoError(t, err)
+	_, err = store.CreateEventSubscription(ctx, "", "project-2", "https://catalogue.example/events")
+	require.NoError(t, err)
+
+	targets, err := store.EventTargets(ctx, "dronetm", "project-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://all.example/events", "https://dronetm.example/events"}, targets, "targets are listed once")
+
+	targets, err = store.EventTargets(ctx, "", "project-2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://all.example/events", "https://catalogue.example/events"}, targets)
+
+	subs, err := store.ListEventSubscriptions(ctx, "dronetm")
+	require.NoError(t, err)
+	assert.Len(t, subs, 2)
+	all, err := store.ListEventSubscriptions(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, all, 4)
+
+	deleted, err := store.DeleteEventSubscription(ctx, tenantSub.ID, "other")
+	require.NoError(t, err)
+	assert.False(t, deleted)
+	deleted, err = store.DeleteEventSubscription(ctx, tenantSub.ID, "dronetm")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+}
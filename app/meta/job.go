@@ -4,16 +4,28 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 
 	"github.com/hotosm/scaleodm/app/db"
 	"github.com/hotosm/scaleodm/app/observability"
 )
 
+// Job types recorded in scaleodm_job_metadata.job_type.
+const (
+	JobTypeStandard   = "standard"
+	JobTypeSplitMerge = "splitmerge"
+	// JobTypeMerge merges the outputs of previously completed tasks.
+	JobTypeMerge = "merge"
+	// JobTypeCityScale processes many tasks aligned to each other.
+	JobTypeCityScale = "cityscale"
+)
+
 type JobMetadata struct {
 	ID           int64           `json:"id"`
 	WorkflowName string          `json:"workflow_name"`
@@ -32,11 +44,29 @@ type JobMetadata struct {
 	// job transitions to "failed" so the diagnostic context survives Argo
 	// workflow CR GC and log archive expiry.
 	FailureDetails json.RawMessage `json:"failure_details,omitempty"`
-	Metadata       json.RawMessage `json:"metadata,omitempty"`
+	// Tenant owns the job; empty for jobs created with auth disabled.
+	Tenant string `json:"tenant,omitempty"`
+	// Priority orders the dispatch queue; higher dispatches first.
+	Priority int `json:"priority"`
+	// JobType is the pipeline shape: one of the JobType* constants.
+	JobType string `json:"job_type"`
+	// AwaitingDispatch is true while the job sits in ScaleODM's queue and has
+	// no Argo workflow yet.
+	AwaitingDispatch bool            `json:"awaiting_dispatch,omitempty"`
+	Metadata         json.RawMessage `json:"metadata,omitempty"`
+}
+
+// VisibleTo reports whether a caller scoped to tenant may see the job. An
+// empty tenant (auth disabled) sees everything.
+func (j *JobMetadata) VisibleTo(tenant string) bool {
+	return tenant == "" || j.Tenant == tenant
 }
 
 type Store struct {
 	db *db.DB
+	// onTransition, when set, is told of every status change after it
+	// commits; see SetTransitionHook.
+	onTransition func(TaskTransition)
 }
 
 func NewStore(db *db.DB) *Store {
@@ -76,39 +106,134 @@ func retryOnDeadlock(ctx context.Context, maxRetries int, fn func() error) error
 
 // CreateJob records a new job and its initial metadata in one insert.
 func (s *Store) CreateJob(ctx context.Context, workflowName, projectID, readPath, writePath string, odmFlags []string, s3Region string, initialMetadata map[string]any) (*JobMetadata, error) {
-	flagsJSON, err := json.Marshal(odmFlags)
+	return s.CreateJobForTenant(ctx, "", workflowName, projectID, readPath, writePath, odmFlags, s3Region, initialMetadata)
+}
+
+// CreateJobForTenant is CreateJob with the job owned by tenant. An empty
+// tenant leaves the job unowned.
+func (s *Store) CreateJobForTenant(ctx context.Context, tenant, workflowName, projectID, readPath, writePath string, odmFlags []string, s3Region string, initialMetadata map[string]any) (*JobMetadata, error) {
+	return s.InsertJob(ctx, NewJob{
+		Tenant:       tenant,
+		WorkflowName: workflowName,
+		ProjectID:    projectID,
+		ReadPath:     readPath,
+		WritePath:    writePath,
+		ODMFlags:     odmFlags,
+		S3Region:     s3Region,
+		Metadata:     initialMetadata,
+	})
+}
+
+// NewJob describes a job row for InsertJob.
+type NewJob struct {
+	Tenant       string
+	WorkflowName string
+	ProjectID    string
+	ReadPath     string
+	WritePath    string
+	ODMFlags     []string
+	S3Region     string
+	Metadata     map[string]any
+	Priority     int
+	// JobType defaults to JobTypeStandard when empty.
+	JobType string
+	// PipelineConfig, when set, queues the job for the dispatcher, which
+	// submits it to Argo later. Leave nil for an already-submitted workflow.
+	PipelineConfig json.RawMessage
+	// IdempotencyKey, when set, must be unique within the tenant.
+	IdempotencyKey string
+	// Admit, when set, admits the job against its tenant's quota in the
+	// insert's transaction; see admitInTx.
+	Admit AdmitFunc
+}
+
+// ErrDuplicateJob is returned by InsertJob when the workflow name or the
+// tenant's idempotency key is already taken.
+var ErrDuplicateJob = errors.New("job already exists")
+
+// isUniqueViolation checks if an error is a PostgreSQL unique_violation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// InsertJob records a new job and its initial metadata in one insert.
+func (s *Store) InsertJob(ctx context.Context, newJob NewJob) (*JobMetadata, error) {
+	flagsJSON, err := json.Marshal(newJob.ODMFlags)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal odm_flags: %w", err)
 	}
 
 	metadataJSON := []byte("{}")
-	if len(initialMetadata) > 0 {
-		metadataJSON, err = json.Marshal(initialMetadata)
+	if len(newJob.Metadata) > 0 {
+		metadataJSON, err = json.Marshal(newJob.Metadata)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal metadata: %w", err)
 		}
 	}
 
+	var pipelineConfig interface{}
+	if len(newJob.PipelineConfig) > 0 {
+		pipelineConfig = []byte(newJob.PipelineConfig)
+	}
+	jobType := newJob.JobType
+	if jobType == "" {
+		jobType = JobTypeStandard
+	}
+
+	// The creation starts the job's timeline in the same statement.
 	query := `
-		INSERT INTO scaleodm_job_metadata
-		(workflow_name, odm_project_id, read_s3_path, write_s3_path, odm_flags, s3_region, metadata)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id, workflow_name, odm_project_id, read_s3_path, write_s3_path,
-		          odm_flags, s3_region, job_status, created_at
+		WITH job AS (
+			INSERT INTO scaleodm_job_metadata
+			(workflow_name, odm_project_id, read_s3_path, write_s3_path, odm_flags, s3_region, metadata, tenant,
+			 priority, pipeline_config, job_type, idempotency_key)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, $10::jsonb, $11, NULLIF($12, ''))
+			RETURNING id, workflow_name, odm_project_id, read_s3_path, write_s3_path,
+			          odm_flags, s3_region, job_status, created_at, tenant,
+			          priority, job_type, pipeline_config
+		), created AS (
+			INSERT INTO scaleodm_job_events (workflow_name, event_type, to_status, actor, reason)
+			SELECT workflow_name, '` + JobEventCreated + `', job_status, $13, NULLIF($14, '') FROM job
+		)
+		SELECT id, workflow_name, odm_project_id, read_s3_path, write_s3_path,
+		       odm_flags, s3_region, job_status, created_at, COALESCE(tenant, ''),
+		       priority, job_type, pipeline_config IS NOT NULL
+		FROM job
 	`
+	actor, reason := actorFromContext(ctx)
 
 	var job *JobMetadata
 	err = retryOnDeadlock(ctx, 3, func() error {
+		tx, err := s.db.Pool.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		if err := admitInTx(ctx, tx, newJob.Tenant, newJob.Admit); err != nil {
+			return err
+		}
 		job = &JobMetadata{}
-		scanErr := s.db.Pool.QueryRow(ctx, query, workflowName, projectID, readPath, writePath, flagsJSON, s3Region, metadataJSON).Scan(
+		scanErr := tx.QueryRow(ctx, query,
+			newJob.WorkflowName, newJob.ProjectID, newJob.ReadPath, newJob.WritePath, flagsJSON,
+			newJob.S3Region, metadataJSON, newJob.Tenant, newJob.Priority, pipelineConfig, jobType,
+			newJob.IdempotencyKey, actor, reason,
+		).Scan(
 			&job.ID, &job.WorkflowName, &job.ODMProjectID, &job.ReadS3Path,
-			&job.WriteS3Path, &job.ODMFlags, &job.S3Region, &job.JobStatus, &job.CreatedAt,
+			&job.WriteS3Path, &job.ODMFlags, &job.S3Region, &job.JobStatus, &job.CreatedAt, &job.Tenant,
+			&job.Priority, &job.JobType, &job.AwaitingDispatch,
 		)
 		if scanErr != nil {
 			return scanErr
 		}
-		return nil
+		return tx.Commit(ctx)
 	})
+	if rejected := admissionRejection(err); rejected != nil {
+		return nil, rejected
+	}
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("failed to create job metadata: %w", ErrDuplicateJob)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create job metadata: %w", err)
 	}
@@ -116,12 +241,33 @@ func (s *Store) CreateJob(ctx context.Context, workflowName, projectID, readPath
 	return job, nil
 }
 
+// GetJobByIdempotencyKey returns the tenant's job created with key, or nil
+// when there is none.
+func (s *Store) GetJobByIdempotencyKey(ctx context.Context, tenant, key string) (*JobMetadata, error) {
+	query := `
+		SELECT workflow_name
+		FROM scaleodm_job_metadata
+		WHERE COALESCE(tenant, '') = $1 AND idempotency_key = $2
+	`
+
+	var workflowName string
+	err := s.db.Pool.QueryRow(ctx, query, tenant, key).Scan(&workflowName)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job by idempotency key: %w", err)
+	}
+	return s.GetJob(ctx, workflowName)
+}
+
 // GetJob retrieves job metadata by workflow name
 func (s *Store) GetJob(ctx context.Context, workflowName string) (*JobMetadata, error) {
 	query := `
 		SELECT id, workflow_name, odm_project_id, read_s3_path, write_s3_path,
 		       odm_flags, s3_region, job_status, created_at, started_at, completed_at,
-		       error_message, failure_details, metadata
+		       error_message, failure_details, COALESCE(tenant, ''), priority,
+		       COALESCE(job_type, 'standard'), ` + awaitingDispatchExpr + `, metadata
 		FROM scaleodm_job_metadata
 		WHERE workflow_name = $1
 	`
@@ -134,7 +280,8 @@ func (s *Store) GetJob(ctx context.Context, workflowName string) (*JobMetadata,
 	err := s.db.Pool.QueryRow(ctx, query, workflowName).Scan(
 		&job.ID, &job.WorkflowName, &job.ODMProjectID, &job.ReadS3Path,
 		&job.WriteS3Path, &job.ODMFlags, &job.S3Region, &job.JobStatus,
-		&job.CreatedAt, &startedAt, &completedAt, &errorMsg, &failureDetailsJSON, &metadataJSON,
+		&job.CreatedAt, &startedAt, &completedAt, &errorMsg, &failureDetailsJSON, &job.Tenant,
+		&job.Priority, &job.JobType, &job.AwaitingDispatch, &metadataJSON,
 	)
 
 	if err == pgx.ErrNoRows {
@@ -163,6 +310,16 @@ func (s *Store) GetJob(ctx context.Context, workflowName string) (*JobMetadata,
 	return job, nil
 }
 
+// GetJobForTenant is GetJob for a caller scoped to tenant: jobs owned by
+// another tenant come back nil, as if they did not exist.
+func (s *Store) GetJobForTenant(ctx context.Context, workflowName, tenant string) (*JobMetadata, error) {
+	job, err := s.GetJob(ctx, workflowName)
+	if err != nil || job == nil || !job.VisibleTo(tenant) {
+		return nil, err
+	}
+	return job, nil
+}
+
 // UpdateJobStatus updates the job status from workflow phase
 // status should be one of: 'queued', 'claimed', 'running', 'failed', 'completed', 'canceled'
 // Note: 'claimed' is an internal state for job queue management (maps to QUEUED/10 in API)
@@ -222,23 +379,75 @@ func (s *Store) updateJobStatus(ctx context.Context, workflowName, status string
 		failureValue = nil
 	}
 
-	result, err := s.db.Pool.Exec(ctx, query, workflowName, status, errValue, failureValue)
+	tx, err := s.db.Pool.Begin(ctx)
 	if err != nil {
 		observability.RecordJobStatusUpdate("failure", status, "db_exec_failed", time.Since(started))
-		return fmt.Errorf("failed to update job status: %w", err)
+		return fmt.Errorf("failed to begin status update: %w", err)
 	}
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
+	defer tx.Rollback(ctx)
+
+	// The previous status tells a transition, which is announced and, when
+	// terminal, queues the caller's webhook, from a repeated update.
+	var previous, projectID, tenant string
+	err = tx.QueryRow(ctx, `SELECT job_status, odm_project_id, COALESCE(tenant, '') FROM scaleodm_job_metadata WHERE workflow_name = $1 FOR UPDATE`, workflowName).Scan(&previous, &projectID, &tenant)
+	if err == pgx.ErrNoRows {
 		observability.RecordJobStatusUpdate("failure", status, "job_not_found", time.Since(started))
 		return fmt.Errorf("job not found: %s", workflowName)
 	}
+	if err != nil {
+		observability.RecordJobStatusUpdate("failure", status, "db_exec_failed", time.Since(started))
+		return fmt.Errorf("failed to update job status: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, query, workflowName, status, errValue, failureValue); err != nil {
+		observability.RecordJobStatusUpdate("failure", status, "db_exec_failed", time.Since(started))
+		return fmt.Errorf("failed to update job status: %w", err)
+	}
+	if status != previous {
+		event := JobEvent{WorkflowName: workflowName, Type: JobEventStatus, FromStatus: previous, ToStatus: status}
+		if errorMsg != nil {
+			event.Message = *errorMsg
+		}
+		if err := recordJobEventInTx(ctx, tx, event); err != nil {
+			observability.RecordJobStatusUpdate("failure", status, "db_exec_failed", time.Since(started))
+			return err
+		}
+	}
+	if status != previous && IsTerminalJobStatus(status) {
+		if err := enqueueWebhookInTx(ctx, tx, workflowName); err != nil {
+			observability.RecordJobStatusUpdate("failure", status, "db_exec_failed", time.Since(started))
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		observability.RecordJobStatusUpdate("failure", status, "db_exec_failed", time.Since(started))
+		return fmt.Errorf("failed to commit job status: %w", err)
+	}
 	observability.RecordJobStatusUpdate("success", status, reason, time.Since(started))
+	if status != previous {
+		transition := TaskTransition{WorkflowName: workflowName, ProjectID: projectID, Tenant: tenant, From: previous, To: status}
+		if errorMsg != nil {
+			transition.ErrorMessage = *errorMsg
+		}
+		s.transitioned(transition)
+	}
 	return nil
 }
 
 // MetadataWebhookKey is the metadata key for the caller's webhook URL.
 const MetadataWebhookKey = "webhook"
 
+// Metadata keys the reconciler keeps current while a job runs: its stage and
+// progress as GET /task/{uuid}/info reports them, and the last ODM stage read
+// from the process log with the time of that read, which the next read starts
+// from.
+const (
+	MetadataStageKey             = "stage"
+	MetadataProgressKey          = "progress"
+	MetadataODMStageKey          = "odm_stage"
+	MetadataODMStageCheckedAtKey = "odm_stage_checked_at"
+)
+
 // NodeODMStatusCode maps a DB job status to the NodeODM status code
 // (10 queued, 20 running, 30 failed, 40 completed, 50 canceled).
 func NodeODMStatusCode(jobStatus string) int {
@@ -396,7 +605,10 @@ func (s *Store) mergeMetadataInTx(ctx context.Context, tx pgx.Tx, workflowName s
 }
 
 // RestartJobMetadata atomically creates new metadata row, carries forward and patches
-// metadata, and removes the old row in a single transaction.
+// metadata, the owning tenant, priority, job type and timeline, and removes the old row in a
+// single transaction. A non-nil pipelineConfig queues the new job for the dispatcher. A
+// non-nil admit admits the restarted job against its tenant's quota in the same
+// transaction, with the old job still counted; see admitInTx.
 func (s *Store) RestartJobMetadata(
 	ctx context.Context,
 	oldWorkflowName string,
@@ -407,13 +619,19 @@ func (s *Store) RestartJobMetadata(
 	odmFlags []string,
 	s3Region string,
 	metadataPatch map[string]interface{},
+	pipelineConfig json.RawMessage,
+	admit AdmitFunc,
 ) error {
 	flagsJSON, err := json.Marshal(odmFlags)
 	if err != nil {
 		return fmt.Errorf("failed to marshal odm_flags: %w", err)
 	}
+	var pipelineConfigValue interface{}
+	if len(pipelineConfig) > 0 {
+		pipelineConfigValue = []byte(pipelineConfig)
+	}
 
-	return retryOnDeadlock(ctx, 3, func() error {
+	err = retryOnDeadlock(ctx, 3, func() error {
 		tx, err := s.db.Pool.Begin(ctx)
 		if err != nil {
 			return err
@@ -422,14 +640,24 @@ func (s *Store) RestartJobMetadata(
 
 		mergedMetadata := map[string]interface{}{}
 		var oldMetadataJSON []byte
-		selectOldQuery := `SELECT metadata FROM scaleodm_job_metadata WHERE workflow_name = $1 FOR UPDATE`
-		err = tx.QueryRow(ctx, selectOldQuery, oldWorkflowName).Scan(&oldMetadataJSON)
+		var tenant *string
+		var priority int
+		var jobType, idempotencyKey *string
+		selectOldQuery := `SELECT metadata, tenant, priority, job_type, idempotency_key FROM scaleodm_job_metadata WHERE workflow_name = $1 FOR UPDATE`
+		err = tx.QueryRow(ctx, selectOldQuery, oldWorkflowName).Scan(&oldMetadataJSON, &tenant, &priority, &jobType, &idempotencyKey)
 		if err == pgx.ErrNoRows {
 			return fmt.Errorf("job not found: %s", oldWorkflowName)
 		}
 		if err != nil {
 			return fmt.Errorf("failed to fetch old metadata: %w", err)
 		}
+		tenantName := ""
+		if tenant != nil {
+			tenantName = *tenant
+		}
+		if err := admitInTx(ctx, tx, tenantName, admit); err != nil {
+			return err
+		}
 		if len(oldMetadataJSON) > 0 {
 			if err := json.Unmarshal(oldMetadataJSON, &mergedMetadata); err != nil {
 				return fmt.Errorf("failed to decode old metadata: %w", err)
@@ -447,15 +675,8 @@ func (s *Store) RestartJobMetadata(
 			return fmt.Errorf("failed to encode new metadata: %w", err)
 		}
 
-		insertQuery := `
-			INSERT INTO scaleodm_job_metadata
-			(workflow_name, odm_project_id, read_s3_path, write_s3_path, odm_flags, s3_region, metadata)
-			VALUES ($1, $2, $3, $4, $5, $6, $7)
-		`
-		if _, err := tx.Exec(ctx, insertQuery, newWorkflowName, projectID, readPath, writePath, flagsJSON, s3Region, newMetadataJSON); err != nil {
-			return fmt.Errorf("failed to insert restarted job metadata: %w", err)
-		}
-
+		// Delete first: the restarted job takes over the idempotency key, which
+		// must stay unique.
 		deleteQuery := `DELETE FROM scaleodm_job_metadata WHERE workflow_name = $1`
 		deleteResult, err := tx.Exec(ctx, deleteQuery, oldWorkflowName)
 		if err != nil {
@@ -465,26 +686,58 @@ func (s *Store) RestartJobMetadata(
 			return fmt.Errorf("job not found: %s", oldWorkflowName)
 		}
 
+		insertQuery := `
+			INSERT INTO scaleodm_job_metadata
+			(workflow_name, odm_project_id, read_s3_path, write_s3_path, odm_flags, s3_region, metadata, tenant,
+			 priority, pipeline_config, job_type, idempotency_key)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10::jsonb, COALESCE($11, 'standard'), $12)
+			RETURNING job_status
+		`
+		var newStatus string
+		if err := tx.QueryRow(ctx, insertQuery, newWorkflowName, projectID, readPath, writePath, flagsJSON, s3Region, newMetadataJSON, tenant, priority, pipelineConfigValue, jobType, idempotencyKey).Scan(&newStatus); err != nil {
+			return fmt.Errorf("failed to insert restarted job metadata: %w", err)
+		}
+
+		// The timeline follows the task to its new name.
+		if _, err := tx.Exec(ctx, `UPDATE scaleodm_job_events SET workflow_name = $2 WHERE workflow_name = $1`, oldWorkflowName, newWorkflowName); err != nil {
+			return fmt.Errorf("failed to carry over job events: %w", err)
+		}
+		if err := recordJobEventInTx(ctx, tx, JobEvent{WorkflowName: newWorkflowName, Type: JobEventRestarted, ToStatus: newStatus, Message: oldWorkflowName}); err != nil {
+			return err
+		}
+
 		if err := tx.Commit(ctx); err != nil {
 			return fmt.Errorf("failed to commit restart metadata transaction: %w", err)
 		}
 		return nil
 	})
+	if rejected := admissionRejection(err); rejected != nil {
+		return rejected
+	}
+	return err
 }
 
-// ListJobs retrieves jobs with optional filters. A positive offset skips that
-// many rows, enabling paginated listings.
-func (s *Store) ListJobs(ctx context.Context, status, projectID string, limit, offset int) ([]*JobMetadata, error) {
+// ListJobs retrieves jobs with optional filters. A non-empty tenant limits
+// the listing to that tenant's jobs. A positive offset skips that many rows,
+// enabling paginated listings.
+func (s *Store) ListJobs(ctx context.Context, tenant, status, projectID string, limit, offset int) ([]*JobMetadata, error) {
 	query := `
 		SELECT id, workflow_name, odm_project_id, read_s3_path, write_s3_path,
 		       odm_flags, s3_region, job_status, created_at, started_at, completed_at,
-		       error_message, metadata
+		       error_message, COALESCE(tenant, ''), priority,
+		       COALESCE(job_type, 'standard'), ` + awaitingDispatchExpr + `, metadata
 		FROM scaleodm_job_metadata
 		WHERE 1=1
 	`
 	args := []interface{}{}
 	argCount := 0
 
+	if tenant != "" {
+		argCount++
+		query += fmt.Sprintf(" AND tenant = $%d", argCount)
+		args = append(args, tenant)
+	}
+
 	if status != "" {
 		argCount++
 		query += fmt.Sprintf(" AND job_status = $%d", argCount)
@@ -527,7 +780,8 @@ func (s *Store) ListJobs(ctx context.Context, status, projectID string, limit, o
 		err := rows.Scan(
 			&job.ID, &job.WorkflowName, &job.ODMProjectID, &job.ReadS3Path,
 			&job.WriteS3Path, &job.ODMFlags, &job.S3Region, &job.JobStatus,
-			&job.CreatedAt, &startedAt, &completedAt, &errorMsg, &metadataJSON,
+			&job.CreatedAt, &startedAt, &completedAt, &errorMsg, &job.Tenant,
+			&job.Priority, &job.JobType, &job.AwaitingDispatch, &metadataJSON,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan job: %w", err)
@@ -561,7 +815,8 @@ func (s *Store) ListActiveJobs(ctx context.Context, since time.Time) ([]*JobMeta
 	query := `
 		SELECT id, workflow_name, odm_project_id, read_s3_path, write_s3_path,
 		       odm_flags, s3_region, job_status, created_at, started_at, completed_at,
-		       error_message, metadata
+		       error_message, COALESCE(tenant, ''), priority,
+		       COALESCE(job_type, 'standard'), ` + awaitingDispatchExpr + `, metadata
 		FROM scaleodm_job_metadata
 		WHERE job_status NOT IN ('completed', 'failed', 'canceled')
 		  AND created_at >= $1
@@ -583,7 +838,8 @@ func (s *Store) ListActiveJobs(ctx context.Context, since time.Time) ([]*JobMeta
 		err := rows.Scan(
 			&job.ID, &job.WorkflowName, &job.ODMProjectID, &job.ReadS3Path,
 			&job.WriteS3Path, &job.ODMFlags, &job.S3Region, &job.JobStatus,
-			&job.CreatedAt, &startedAt, &completedAt, &errorMsg, &metadataJSON,
+			&job.CreatedAt, &startedAt, &completedAt, &errorMsg, &job.Tenant,
+			&job.Priority, &job.JobType, &job.AwaitingDispatch, &metadataJSON,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan job: %w", err)
@@ -608,10 +864,16 @@ func (s *Store) ListActiveJobs(ctx context.Context, since time.Time) ([]*JobMeta
 	return jobs, nil
 }
 
-// DeleteJob removes job metadata
+// DeleteJob removes job metadata and the job's timeline.
 func (s *Store) DeleteJob(ctx context.Context, workflowName string) error {
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin delete: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
 	query := `DELETE FROM scaleodm_job_metadata WHERE workflow_name = $1`
-	result, err := s.db.Pool.Exec(ctx, query, workflowName)
+	result, err := tx.Exec(ctx, query, workflowName)
 	if err != nil {
 		return fmt.Errorf("failed to delete job: %w", err)
 	}
@@ -620,5 +882,11 @@ func (s *Store) DeleteJob(ctx context.Context, workflowName string) error {
 		return fmt.Errorf("job not found")
 	}
 
+	if _, err := tx.Exec(ctx, `DELETE FROM scaleodm_job_events WHERE workflow_name = $1`, workflowName); err != nil {
+		return fmt.Errorf("failed to delete job events: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit delete: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,112 @@
+package meta
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Job event types recorded in scaleodm_job_events.
+const (
+	JobEventCreated        = "created"
+	JobEventStatus         = "status"
+	JobEventDispatched     = "dispatched"
+	JobEventDispatchFailed = "dispatch_failed"
+	JobEventRestarted      = "restarted"
+)
+
+// Actors of job events other than callers, who are recorded as "user" or
+// "user:{token name}".
+const (
+	ActorSystem     = "system"
+	ActorAPI        = "api"
+	ActorUI         = "ui"
+	ActorReconciler = "reconciler"
+	ActorDispatcher = "dispatcher"
+)
+
+// JobEvent is an entry of a job's timeline. FromStatus and ToStatus are set
+// for status changes and ToStatus for creation; Message carries the error of
+// a failure or the previous UUID of a restart.
+type JobEvent struct {
+	ID           int64
+	WorkflowName string
+	Type         string
+	FromStatus   string
+	ToStatus     string
+	Actor        string
+	Reason       string
+	Message      string
+	CreatedAt    time.Time
+}
+
+type actorContextKey struct{}
+
+type eventActor struct {
+	actor  string
+	reason string
+}
+
+// WithActor returns a context under which the store records job events as
+// done by actor for reason, e.g. the reconciler syncing a status from Argo.
+// Without one, events are recorded as done by ActorSystem.
+func WithActor(ctx context.Context, actor, reason string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, eventActor{actor: actor, reason: reason})
+}
+
+func actorFromContext(ctx context.Context) (actor, reason string) {
+	if value, ok := ctx.Value(actorContextKey{}).(eventActor); ok && value.actor != "" {
+		return value.actor, value.reason
+	}
+	return ActorSystem, ""
+}
+
+// recordJobEventInTx appends an event to a job's timeline in the transaction
+// of the change it records. An event without an actor or reason takes the
+// context's.
+func recordJobEventInTx(ctx context.Context, tx pgx.Tx, event JobEvent) error {
+	actor, reason := actorFromContext(ctx)
+	if event.Actor == "" {
+		event.Actor = actor
+	}
+	if event.Reason == "" {
+		event.Reason = reason
+	}
+	query := `
+		INSERT INTO scaleodm_job_events (workflow_name, event_type, from_status, to_status, actor, reason, message)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, NULLIF($6, ''), NULLIF($7, ''))
+	`
+	if _, err := tx.Exec(ctx, query, event.WorkflowName, event.Type, event.FromStatus, event.ToStatus, event.Actor, event.Reason, event.Message); err != nil {
+		return fmt.Errorf("failed to record job event: %w", err)
+	}
+	return nil
+}
+
+// ListJobEvents returns a job's timeline, oldest first.
+func (s *Store) ListJobEvents(ctx context.Context, workflowName string) ([]JobEvent, error) {
+	query := `
+		SELECT id, workflow_name, event_type, COALESCE(from_status, ''), COALESCE(to_status, ''),
+		       actor, COALESCE(reason, ''), COALESCE(message, ''), created_at
+		FROM scaleodm_job_events
+		WHERE workflow_name = $1
+		ORDER BY id
+	`
+	rows, err := s.db.Pool.Query(ctx, query, workflowName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list job events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []JobEvent{}
+	for rows.Next() {
+		var event JobEvent
+		if err := rows.Scan(&event.ID, &event.WorkflowName, &event.Type, &event.FromStatus, &event.ToStatus,
+			&event.Actor, &event.Reason, &event.Message, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan job event: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
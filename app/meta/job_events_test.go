@@ -0,0 +1,88 @@
+package meta
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobEvents_Timeline(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	queueJob(t, store, "wf-timeline", "project", 0)
+	_, err := store.ClaimNextJob(ctx, 0)
+	require.NoError(t, err)
+	_, err = store.ReleaseClaim(WithActor(ctx, ActorDispatcher, ""), "wf-timeline", "argo unavailable", 3)
+	require.NoError(t, err)
+	_, err = store.ClaimNextJob(ctx, 0)
+	require.NoError(t, err)
+	dispatched, err := store.MarkJobDispatched(WithActor(ctx, ActorDispatcher, ""), "wf-timeline")
+	require.NoError(t, err)
+	require.True(t, dispatched)
+	require.NoError(t, store.UpdateJobStatus(WithActor(ctx, ActorReconciler, "argo_sync"), "wf-timeline", "running", nil))
+	// A repeated status is not recorded.
+	require.NoError(t, store.UpdateJobStatus(WithActor(ctx, ActorReconciler, "argo_sync"), "wf-timeline", "running", nil))
+	errorMsg := "ODM exited with code 1"
+	require.NoError(t, store.UpdateJobStatus(WithActor(ctx, ActorReconciler, "argo_sync"), "wf-timeline", "failed", &errorMsg))
+
+	events, err := store.ListJobEvents(ctx, "wf-timeline")
+	require.NoError(t, err)
+	require.Len(t, events, 5)
+	assert.Equal(t, JobEvent{Type: JobEventCreated, ToStatus: "queued", Actor: ActorSystem}, stripEvent(events[0]))
+	assert.Equal(t, JobEvent{Type: JobEventDispatchFailed, FromStatus: "claimed", ToStatus: "queued", Actor: ActorDispatcher, Message: "argo unavailable"}, stripEvent(events[1]))
+	assert.Equal(t, JobEvent{Type: JobEventDispatched, ToStatus: "claimed", Actor: ActorDispatcher}, stripEvent(events[2]))
+	assert.Equal(t, JobEvent{Type: JobEventStatus, FromStatus: "claimed", ToStatus: "running", Actor: ActorReconciler, Reason: "argo_sync"}, stripEvent(events[3]))
+	assert.Equal(t, JobEvent{Type: JobEventStatus, FromStatus: "running", ToStatus: "failed", Actor: ActorReconciler, Reason: "argo_sync", Message: errorMsg}, stripEvent(events[4]))
+	for i := 1; i < len(events); i++ {
+		assert.Greater(t, events[i].ID, events[i-1].ID)
+		assert.False(t, events[i].CreatedAt.Before(events[i-1].CreatedAt))
+	}
+
+	// A restart carries the timeline over to the new name.
+	restartCtx := WithActor(ctx, "user:dronetm", "restart_requested")
+	require.NoError(t, store.RestartJobMetadata(restartCtx, "wf-timeline", "wf-timeline-2", "project", "s3://bucket/images/", "s3://bucket/output/", nil, "us-east-1", nil, nil, nil))
+	old, err := store.ListJobEvents(ctx, "wf-timeline")
+	require.NoError(t, err)
+	assert.Empty(t, old)
+	events, err = store.ListJobEvents(ctx, "wf-timeline-2")
+	require.NoError(t, err)
+	require.Len(t, events, 6)
+	assert.Equal(t, JobEvent{Type: JobEventRestarted, ToStatus: "queued", Actor: "user:dronetm", Reason: "restart_requested", Message: "wf-timeline"}, stripEvent(events[5]))
+
+	require.NoError(t, store.DeleteJob(ctx, "wf-timeline-2"))
+	events, err = store.ListJobEvents(ctx, "wf-timeline-2")
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestJobEvents_Cancel(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	queueJob(t, store, "wf-timeline-cancel", "project", 0)
+	canceled, err := store.CancelQueuedJob(WithActor(ctx, "user", "cancel_requested"), "wf-timeline-cancel")
+	require.NoError(t, err)
+	require.True(t, canceled)
+
+	events, err := store.ListJobEvents(ctx, "wf-timeline-cancel")
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, JobEvent{Type: JobEventStatus, FromStatus: "queued", ToStatus: "canceled", Actor: "user", Reason: "cancel_requested"}, stripEvent(events[1]))
+}
+
+// stripEvent drops an event's generated fields for comparison.
+func stripEvent(event JobEvent) JobEvent {
+	event.ID, event.WorkflowName = 0, ""
+	event.CreatedAt = time.Time{}
+	return event
+}
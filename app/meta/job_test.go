@@ -256,11 +256,11 @@ func TestListJobs(t *testing.T) {
 		require.NoError(t, createErr)
 	}
 
-	jobs, err := store.ListJobs(ctx, "", "", 0, 0)
+	jobs, err := store.ListJobs(ctx, "", "", "", 0, 0)
 	require.NoError(t, err)
 
 	// A limit caps the result count regardless of how many jobs exist.
-	jobs, err = store.ListJobs(ctx, "", "", 3, 0)
+	jobs, err = store.ListJobs(ctx, "", "", "", 3, 0)
 	require.NoError(t, err)
 	assert.LessOrEqual(t, len(jobs), 3)
 }
@@ -308,7 +308,7 @@ func TestListJobs_ByProjectID(t *testing.T) {
 	)
 	require.NoError(t, err)
 
-	jobs, err := store.ListJobs(ctx, "", "project-1", 0, 0)
+	jobs, err := store.ListJobs(ctx, "", "", "project-1", 0, 0)
 	require.NoError(t, err)
 	assert.Len(t, jobs, 2)
 	for _, job := range jobs {
@@ -316,6 +316,38 @@ func TestListJobs_ByProjectID(t *testing.T) {
 	}
 }
 
+func TestListJobs_ScopesByTenant(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	_, err := store.CreateJobForTenant(ctx, "dronetm", "wf-tenant-a", "project", "s3://bucket/a/", "s3://bucket/a-out/", nil, "us-east-1", nil)
+	require.NoError(t, err)
+	_, err = store.CreateJobForTenant(ctx, "fair", "wf-tenant-b", "project", "s3://bucket/b/", "s3://bucket/b-out/", nil, "us-east-1", nil)
+	require.NoError(t, err)
+	_, err = store.CreateJob(ctx, "wf-unowned", "project", "s3://bucket/c/", "s3://bucket/c-out/", nil, "us-east-1", nil)
+	require.NoError(t, err)
+
+	jobs, err := store.ListJobs(ctx, "dronetm", "", "", 0, 0)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "wf-tenant-a", jobs[0].WorkflowName)
+	assert.Equal(t, "dronetm", jobs[0].Tenant)
+
+	jobs, err = store.ListJobs(ctx, "", "", "", 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, jobs, 3)
+
+	job, err := store.GetJob(ctx, "wf-tenant-b")
+	require.NoError(t, err)
+	require.NotNil(t, job)
+	assert.True(t, job.VisibleTo("fair"))
+	assert.True(t, job.VisibleTo(""))
+	assert.False(t, job.VisibleTo("dronetm"))
+}
+
 func TestDeleteJob(t *testing.T) {
 	db, cleanup := testDB(t)
 	defer cleanup()
@@ -398,8 +430,9 @@ func TestRestartJobMetadata_AtomicSwap(t *testing.T) {
 	store := NewStore(db)
 	ctx := context.Background()
 
-	_, err := store.CreateJob(
+	_, err := store.CreateJobForTenant(
 		ctx,
+		"dronetm",
 		"test-workflow-old",
 		"test-project",
 		"s3://bucket/images/",
@@ -421,6 +454,8 @@ func TestRestartJobMetadata_AtomicSwap(t *testing.T) {
 		[]string{"--dsm"},
 		"us-east-1",
 		map[string]interface{}{"image_count": 12},
+		nil,
+		nil,
 	)
 	require.NoError(t, err)
 
@@ -436,4 +471,44 @@ func TestRestartJobMetadata_AtomicSwap(t *testing.T) {
 	assert.Equal(t, "http://localhost:9000", metaMap["s3_endpoint"])
 	assert.Equal(t, float64(12), metaMap["image_count"])
 	assert.Equal(t, float64(2048), metaMap["image_total_bytes"])
+	assert.Equal(t, "dronetm", newJob.Tenant)
+}
+
+func TestGetJobByIdempotencyKey(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	newJob := func(name, tenant string) NewJob {
+		return NewJob{
+			Tenant:         tenant,
+			WorkflowName:   name,
+			ProjectID:      "test-project",
+			ReadPath:       "s3://bucket/images/",
+			WritePath:      "s3://bucket/output/",
+			S3Region:       "us-east-1",
+			IdempotencyKey: "retry-1",
+		}
+	}
+	_, err := store.InsertJob(ctx, newJob("test-idem-a", "tenant-a"))
+	require.NoError(t, err)
+
+	job, err := store.GetJobByIdempotencyKey(ctx, "tenant-a", "retry-1")
+	require.NoError(t, err)
+	require.NotNil(t, job)
+	assert.Equal(t, "test-idem-a", job.WorkflowName)
+
+	// Keys are scoped by tenant.
+	job, err = store.GetJobByIdempotencyKey(ctx, "tenant-b", "retry-1")
+	require.NoError(t, err)
+	assert.Nil(t, job)
+	_, err = store.InsertJob(ctx, newJob("test-idem-b", "tenant-b"))
+	require.NoError(t, err)
+
+	_, err = store.InsertJob(ctx, newJob("test-idem-c", "tenant-a"))
+	assert.ErrorIs(t, err, ErrDuplicateJob)
+	_, err = store.InsertJob(ctx, NewJob{WorkflowName: "test-idem-a", ProjectID: "p", ReadPath: "s3://b/", WritePath: "s3://b/o/"})
+	assert.ErrorIs(t, err, ErrDuplicateJob)
 }
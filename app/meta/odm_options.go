@@ -0,0 +1,54 @@
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/hotosm/scaleodm/app/odmoptions"
+)
+
+// GetODMOptionCatalog returns the option catalog stored for an ODM image, or
+// nil when it has none.
+func (s *Store) GetODMOptionCatalog(ctx context.Context, image string) ([]odmoptions.Option, error) {
+	query := `
+		SELECT options
+		FROM scaleodm_odm_option_catalogs
+		WHERE odm_image = $1
+	`
+
+	var raw []byte
+	err := s.db.Pool.QueryRow(ctx, query, image).Scan(&raw)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get odm option catalog: %w", err)
+	}
+	var options []odmoptions.Option
+	if err := json.Unmarshal(raw, &options); err != nil {
+		return nil, fmt.Errorf("failed to decode odm option catalog: %w", err)
+	}
+	return options, nil
+}
+
+// PutODMOptionCatalog upserts the option catalog for an ODM image.
+func (s *Store) PutODMOptionCatalog(ctx context.Context, image string, options []odmoptions.Option) error {
+	raw, err := json.Marshal(options)
+	if err != nil {
+		return fmt.Errorf("failed to encode odm option catalog: %w", err)
+	}
+	query := `
+		INSERT INTO scaleodm_odm_option_catalogs (odm_image, options)
+		VALUES ($1, $2)
+		ON CONFLICT (odm_image) DO UPDATE
+		SET options = EXCLUDED.options,
+		    extracted_at = NOW()
+	`
+	if _, err := s.db.Pool.Exec(ctx, query, image, raw); err != nil {
+		return fmt.Errorf("failed to store odm option catalog: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package meta
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hotosm/scaleodm/app/odmoptions"
+)
+
+func TestODMOptionCatalog(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	options, err := store.GetODMOptionCatalog(ctx, "ghcr.io/hotosm/odm:3.6.1")
+	require.NoError(t, err)
+	assert.Nil(t, options)
+
+	want := []odmoptions.Option{
+		{Name: "dsm", Type: odmoptions.TypeBool, Value: "false", Domain: "bool", Help: "Build a DSM"},
+		{Name: "feature-quality", Type: odmoptions.TypeEnum, Value: "high", Choices: []string{"high", "low"}},
+	}
+	require.NoError(t, store.PutODMOptionCatalog(ctx, "ghcr.io/hotosm/odm:3.6.1", want[:1]))
+	require.NoError(t, store.PutODMOptionCatalog(ctx, "ghcr.io/hotosm/odm:3.6.1", want))
+
+	options, err = store.GetODMOptionCatalog(ctx, "ghcr.io/hotosm/odm:3.6.1")
+	require.NoError(t, err)
+	assert.Equal(t, want, options)
+}
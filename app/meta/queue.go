@@ -0,0 +1,260 @@
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// awaitingDispatchExpr is true for jobs in ScaleODM's queue that have no Argo
+// workflow yet: queued or claimed, but not dispatched.
+const awaitingDispatchExpr = `(pipeline_config IS NOT NULL AND dispatched_at IS NULL)`
+
+// activeJobLookback mirrors the reconciler's lookback, so rows whose
+// workflows were GC'd without an observed terminal status stop counting as
+// active eventually.
+const activeJobLookback = `created_at >= NOW() - INTERVAL '7 days'`
+
+// activeWorkflowsWhere matches jobs that hold a dispatch slot.
+const activeWorkflowsWhere = `job_status IN ('claimed', 'running') AND ` + activeJobLookback
+
+// DefaultProjectID names the project of a task created without a name. Such
+// tasks have nothing in common, so fair-share treats each as its own project.
+const DefaultProjectID = "odm-project"
+
+// dispatchLockKey serialises claims across replicas so the cluster-wide
+// concurrency check and the claim happen atomically.
+const dispatchLockKey = 0x5ca1e0d
+
+// QueuedJob is a job the dispatcher has claimed and must submit.
+type QueuedJob struct {
+	WorkflowName     string
+	ODMProjectID     string
+	Priority         int
+	DispatchAttempts int
+	PipelineConfig   json.RawMessage
+}
+
+// ClaimNextJob claims the next job to dispatch, or returns nil when the queue
+// is empty or maxActive (> 0) jobs already hold a slot. Jobs are taken by
+// priority, then fair-share (the project with the fewest active workflows
+// first; a project is a name within a tenant), then age. The claimed job
+// moves to 'claimed' until MarkJobDispatched or ReleaseClaim.
+func (s *Store) ClaimNextJob(ctx context.Context, maxActive int) (*QueuedJob, error) {
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin claim transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, dispatchLockKey); err != nil {
+		return nil, fmt.Errorf("failed to take dispatch lock: %w", err)
+	}
+
+	if maxActive > 0 {
+		var active int
+		if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM scaleodm_job_metadata WHERE `+activeWorkflowsWhere).Scan(&active); err != nil {
+			return nil, fmt.Errorf("failed to count active workflows: %w", err)
+		}
+		if active >= maxActive {
+			return nil, nil
+		}
+	}
+
+	query := `
+		SELECT j.id, j.workflow_name, j.odm_project_id, j.priority, j.dispatch_attempts, j.pipeline_config
+		FROM scaleodm_job_metadata j
+		WHERE j.job_status = 'queued' AND j.pipeline_config IS NOT NULL AND j.dispatched_at IS NULL
+		ORDER BY j.priority DESC,
+		         (SELECT COUNT(*) FROM scaleodm_job_metadata a
+		          WHERE COALESCE(a.tenant, '') = COALESCE(j.tenant, '')
+		            AND a.odm_project_id = j.odm_project_id AND j.odm_project_id <> $1
+		            AND a.` + activeWorkflowsWhere + `) ASC,
+		         j.created_at ASC, j.id ASC
+		LIMIT 1
+		FOR UPDATE OF j SKIP LOCKED
+	`
+	var id int64
+	job := &QueuedJob{}
+	err = tx.QueryRow(ctx, query, DefaultProjectID).Scan(&id, &job.WorkflowName, &job.ODMProjectID, &job.Priority, &job.DispatchAttempts, &job.PipelineConfig)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to select next queued job: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE scaleodm_job_metadata SET job_status = 'claimed', claimed_at = NOW() WHERE id = $1`, id); err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit claim: %w", err)
+	}
+	return job, nil
+}
+
+// MarkJobDispatched records that a claimed job's workflow was submitted, in
+// the job and its timeline. It returns false when the job was canceled or
+// removed while being dispatched, in which case the caller should delete the
+// workflow it just created.
+func (s *Store) MarkJobDispatched(ctx context.Context, workflowName string) (bool, error) {
+	query := `
+		WITH dispatched AS (
+			UPDATE scaleodm_job_metadata
+			SET dispatched_at = NOW()
+			WHERE workflow_name = $1 AND job_status IN ('claimed', 'running') AND dispatched_at IS NULL
+			RETURNING workflow_name, job_status
+		)
+		INSERT INTO scaleodm_job_events (workflow_name, event_type, to_status, actor, reason)
+		SELECT workflow_name, '` + JobEventDispatched + `', job_status, $2, NULLIF($3, '') FROM dispatched
+	`
+	actor, reason := actorFromContext(ctx)
+	result, err := s.db.Pool.Exec(ctx, query, workflowName, actor, reason)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark job dispatched: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// ReleaseClaim hands a job whose submission failed back to the queue, or
+// marks it failed once it has used maxAttempts (> 0) submissions. It returns
+// the job's new status, or "" when the job is no longer claimed.
+func (s *Store) ReleaseClaim(ctx context.Context, workflowName, errorMsg string, maxAttempts int) (string, error) {
+	query := `
+		UPDATE scaleodm_job_metadata
+		SET dispatch_attempts = dispatch_attempts + 1,
+		    job_status = CASE
+		        WHEN $3 > 0 AND dispatch_attempts + 1 >= $3 THEN 'failed'
+		        ELSE 'queued'
+		    END,
+		    completed_at = CASE
+		        WHEN $3 > 0 AND dispatch_attempts + 1 >= $3 THEN NOW()
+		        ELSE completed_at
+		    END,
+		    claimed_at = NULL,
+		    error_message = $2
+		WHERE workflow_name = $1 AND job_status = 'claimed' AND dispatched_at IS NULL
+		RETURNING job_status, odm_project_id, COALESCE(tenant, '')
+	`
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin release: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var status, projectID, tenant string
+	err = tx.QueryRow(ctx, query, workflowName, errorMsg, maxAttempts).Scan(&status, &projectID, &tenant)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to release claim: %w", err)
+	}
+	event := JobEvent{WorkflowName: workflowName, Type: JobEventDispatchFailed, FromStatus: "claimed", ToStatus: status, Message: errorMsg}
+	if status == "failed" {
+		event.Type, event.Reason = JobEventStatus, "max_dispatch_attempts"
+	}
+	if err := recordJobEventInTx(ctx, tx, event); err != nil {
+		return "", err
+	}
+	if status == "failed" {
+		if err := enqueueWebhookInTx(ctx, tx, workflowName); err != nil {
+			return "", err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit release: %w", err)
+	}
+	if status == "failed" {
+		s.transitioned(TaskTransition{WorkflowName: workflowName, ProjectID: projectID, Tenant: tenant, From: "claimed", To: status, ErrorMessage: errorMsg})
+	}
+	return status, nil
+}
+
+// RequeueStaleClaims returns claims older than timeout to the queue, e.g.
+// after a replica died mid-dispatch. Re-dispatching is safe: workflow names
+// are pinned, so a workflow that was in fact submitted is not duplicated.
+func (s *Store) RequeueStaleClaims(ctx context.Context, timeout time.Duration) (int64, error) {
+	query := `
+		UPDATE scaleodm_job_metadata
+		SET job_status = 'queued', claimed_at = NULL
+		WHERE job_status = 'claimed' AND ` + awaitingDispatchExpr + `
+		  AND claimed_at < NOW() - make_interval(secs => $1)
+	`
+	result, err := s.db.Pool.Exec(ctx, query, timeout.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue stale claims: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// CancelQueuedJob cancels a job that has not been dispatched yet. It returns
+// false when the job is unknown or already has a workflow in Argo.
+func (s *Store) CancelQueuedJob(ctx context.Context, workflowName string) (bool, error) {
+	query := `
+		WITH previous AS (
+			SELECT workflow_name, job_status FROM scaleodm_job_metadata
+			WHERE workflow_name = $1 AND job_status IN ('queued', 'claimed') AND ` + awaitingDispatchExpr + `
+			FOR UPDATE
+		)
+		UPDATE scaleodm_job_metadata AS j
+		SET job_status = 'canceled', claimed_at = NULL, completed_at = NOW()
+		FROM previous
+		WHERE j.workflow_name = previous.workflow_name
+		RETURNING previous.job_status, j.odm_project_id, COALESCE(j.tenant, '')
+	`
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin cancel: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var previous, projectID, tenant string
+	err = tx.QueryRow(ctx, query, workflowName).Scan(&previous, &projectID, &tenant)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel queued job: %w", err)
+	}
+	if err := recordJobEventInTx(ctx, tx, JobEvent{WorkflowName: workflowName, Type: JobEventStatus, FromStatus: previous, ToStatus: "canceled"}); err != nil {
+		return false, err
+	}
+	if err := enqueueWebhookInTx(ctx, tx, workflowName); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit cancel: %w", err)
+	}
+	s.transitioned(TaskTransition{WorkflowName: workflowName, ProjectID: projectID, Tenant: tenant, From: previous, To: "canceled"})
+	return true, nil
+}
+
+// ListQueuedJobNames returns the workflow names of jobs awaiting dispatch,
+// oldest first. A non-empty tenant limits the list to that tenant's jobs.
+func (s *Store) ListQueuedJobNames(ctx context.Context, tenant string) ([]string, error) {
+	query := `
+		SELECT workflow_name FROM scaleodm_job_metadata
+		WHERE job_status IN ('queued', 'claimed') AND ` + awaitingDispatchExpr + `
+		  AND ($1 = '' OR tenant = $1)
+		ORDER BY created_at ASC
+	`
+	rows, err := s.db.Pool.Query(ctx, query, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queued jobs: %w", err)
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan queued job: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
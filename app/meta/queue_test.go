@@ -0,0 +1,158 @@
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func queueJob(t *testing.T, store *Store, name, project string, priority int) {
+	t.Helper()
+	_, err := store.InsertJob(context.Background(), NewJob{
+		WorkflowName:   name,
+		ProjectID:      project,
+		ReadPath:       "s3://bucket/images/",
+		WritePath:      "s3://bucket/output/",
+		S3Region:       "us-east-1",
+		Priority:       priority,
+		PipelineConfig: json.RawMessage(`{"WorkflowName":"` + name + `"}`),
+	})
+	require.NoError(t, err)
+}
+
+func TestClaimNextJob_PriorityFairShareAndLimit(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	// "big" already holds a slot, so its queued work yields to "field" at
+	// equal priority; "urgent" outranks both.
+	queueJob(t, store, "wf-big-running", "big", 0)
+	claimed, err := store.ClaimNextJob(ctx, 0)
+	require.NoError(t, err)
+	require.NotNil(t, claimed)
+	dispatched, err := store.MarkJobDispatched(ctx, claimed.WorkflowName)
+	require.NoError(t, err)
+	assert.True(t, dispatched)
+
+	queueJob(t, store, "wf-big-2", "big", 0)
+	queueJob(t, store, "wf-field-1", "field", 0)
+	queueJob(t, store, "wf-urgent", "urgent", 10)
+
+	job, err := store.GetJob(ctx, "wf-field-1")
+	require.NoError(t, err)
+	assert.True(t, job.AwaitingDispatch)
+	names, err := store.ListQueuedJobNames(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"wf-big-2", "wf-field-1", "wf-urgent"}, names)
+
+	order := []string{}
+	for range 3 {
+		claimed, err := store.ClaimNextJob(ctx, 0)
+		require.NoError(t, err)
+		require.NotNil(t, claimed)
+		order = append(order, claimed.WorkflowName)
+	}
+	assert.Equal(t, []string{"wf-urgent", "wf-field-1", "wf-big-2"}, order)
+
+	queueJob(t, store, "wf-limited", "field", 0)
+	claimed, err = store.ClaimNextJob(ctx, 4)
+	require.NoError(t, err)
+	assert.Nil(t, claimed, "four jobs already hold a slot")
+}
+
+func TestClaimNextJob_FairShareKeysOnTenantAndName(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+	queueTenantJob := func(tenant, name, project string) {
+		_, err := store.InsertJob(ctx, NewJob{
+			Tenant:         tenant,
+			WorkflowName:   name,
+			ProjectID:      project,
+			ReadPath:       "s3://bucket/images/",
+			WritePath:      "s3://bucket/output/",
+			PipelineConfig: json.RawMessage(`{"WorkflowName":"` + name + `"}`),
+		})
+		require.NoError(t, err)
+	}
+	dispatchNext := func() {
+		claimed, err := store.ClaimNextJob(ctx, 0)
+		require.NoError(t, err)
+		require.NotNil(t, claimed)
+		_, err = store.MarkJobDispatched(ctx, claimed.WorkflowName)
+		require.NoError(t, err)
+	}
+
+	// "survey" under dronetm and an unnamed task are running.
+	queueTenantJob("dronetm", "wf-dronetm-running", "survey")
+	dispatchNext()
+	queueTenantJob("dronetm", "wf-unnamed-running", DefaultProjectID)
+	dispatchNext()
+
+	// Neither slot counts against another tenant's "survey" or another
+	// unnamed task, so they go before dronetm's second "survey" task.
+	queueTenantJob("dronetm", "wf-dronetm-2", "survey")
+	queueTenantJob("fair", "wf-fair-1", "survey")
+	queueTenantJob("dronetm", "wf-unnamed-2", DefaultProjectID)
+
+	order := []string{}
+	for range 3 {
+		claimed, err := store.ClaimNextJob(ctx, 0)
+		require.NoError(t, err)
+		require.NotNil(t, claimed)
+		order = append(order, claimed.WorkflowName)
+	}
+	assert.Equal(t, []string{"wf-fair-1", "wf-unnamed-2", "wf-dronetm-2"}, order)
+}
+
+func TestReleaseClaimAndCancel(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	queueJob(t, store, "wf-retry", "project", 0)
+	claimed, err := store.ClaimNextJob(ctx, 0)
+	require.NoError(t, err)
+	require.NotNil(t, claimed)
+
+	status, err := store.ReleaseClaim(ctx, "wf-retry", "argo unavailable", 2)
+	require.NoError(t, err)
+	assert.Equal(t, "queued", status)
+
+	claimed, err = store.ClaimNextJob(ctx, 0)
+	require.NoError(t, err)
+	require.NotNil(t, claimed)
+	assert.Equal(t, 1, claimed.DispatchAttempts)
+	status, err = store.ReleaseClaim(ctx, "wf-retry", "argo unavailable", 2)
+	require.NoError(t, err)
+	assert.Equal(t, "failed", status)
+
+	queueJob(t, store, "wf-cancel", "project", 0)
+	claimed, err = store.ClaimNextJob(ctx, 0)
+	require.NoError(t, err)
+	require.NotNil(t, claimed)
+	canceled, err := store.CancelQueuedJob(ctx, "wf-cancel")
+	require.NoError(t, err)
+	assert.True(t, canceled)
+	dispatched, err := store.MarkJobDispatched(ctx, "wf-cancel")
+	require.NoError(t, err)
+	assert.False(t, dispatched, "a canceled job must not be marked dispatched")
+
+	queueJob(t, store, "wf-stale", "project", 0)
+	_, err = store.ClaimNextJob(ctx, 0)
+	require.NoError(t, err)
+	requeued, err := store.RequeueStaleClaims(ctx, -time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), requeued)
+}
@@ -0,0 +1,123 @@
+package meta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/hotosm/scaleodm/app/quota"
+)
+
+// MetadataWorkspaceGiBKey is the metadata key for the workspace size a job
+// was admitted with; TenantUsage sums it over active jobs.
+const MetadataWorkspaceGiBKey = "workspace_gib"
+
+// GetTenantQuota returns a tenant's quota overrides, or nil when it has none.
+func (s *Store) GetTenantQuota(ctx context.Context, tenant string) (*quota.Override, error) {
+	query := `
+		SELECT max_concurrent_tasks, max_images_per_task, max_workspace_gib
+		FROM scaleodm_tenant_quotas
+		WHERE tenant = $1
+	`
+
+	override := &quota.Override{}
+	err := s.db.Pool.QueryRow(ctx, query, tenant).Scan(
+		&override.MaxConcurrentTasks, &override.MaxImagesPerTask, &override.MaxWorkspaceGiB,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenant quota: %w", err)
+	}
+	return override, nil
+}
+
+// SetTenantQuota upserts a tenant's quota overrides. Nil fields fall back to
+// the defaults.
+func (s *Store) SetTenantQuota(ctx context.Context, tenant string, override quota.Override) error {
+	query := `
+		INSERT INTO scaleodm_tenant_quotas
+		(tenant, max_concurrent_tasks, max_images_per_task, max_workspace_gib)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tenant) DO UPDATE
+		SET max_concurrent_tasks = EXCLUDED.max_concurrent_tasks,
+		    max_images_per_task = EXCLUDED.max_images_per_task,
+		    max_workspace_gib = EXCLUDED.max_workspace_gib,
+		    updated_at = NOW()
+	`
+	if _, err := s.db.Pool.Exec(ctx, query, tenant, override.MaxConcurrentTasks, override.MaxImagesPerTask, override.MaxWorkspaceGiB); err != nil {
+		return fmt.Errorf("failed to set tenant quota: %w", err)
+	}
+	return nil
+}
+
+// TenantUsage counts a tenant's non-terminal jobs and the workspace they
+// were admitted with. An empty tenant counts every job. Jobs older than the
+// active-job lookback no longer count, as for dispatch slots.
+func (s *Store) TenantUsage(ctx context.Context, tenant string) (quota.Usage, error) {
+	return tenantUsage(ctx, s.db.Pool, tenant)
+}
+
+func tenantUsage(ctx context.Context, q interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}, tenant string) (quota.Usage, error) {
+	query := `
+		SELECT COUNT(*),
+		       COALESCE(SUM((metadata->>'` + MetadataWorkspaceGiBKey + `')::float8), 0)
+		FROM scaleodm_job_metadata
+		WHERE job_status NOT IN ('completed', 'failed', 'canceled')
+		  AND ` + activeJobLookback + `
+		  AND ($1 = '' OR tenant = $1)
+	`
+
+	var usage quota.Usage
+	if err := q.QueryRow(ctx, query, tenant).Scan(&usage.ActiveTasks, &usage.WorkspaceGiB); err != nil {
+		return quota.Usage{}, fmt.Errorf("failed to compute tenant usage: %w", err)
+	}
+	return usage, nil
+}
+
+// AdmitFunc decides whether a tenant with usage may run one more job. Its
+// error is returned as is by the insert it guards.
+type AdmitFunc func(usage quota.Usage) error
+
+// admitInTx runs admit against the tenant's usage under its admission lock,
+// a transaction-scoped advisory lock. Admissions of one tenant are then
+// serialised up to the commit of the job they admit, so none is checked
+// against usage that misses another's job. It is a no-op for a nil admit.
+func admitInTx(ctx context.Context, tx pgx.Tx, tenant string, admit AdmitFunc) error {
+	if admit == nil {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, tenant); err != nil {
+		return fmt.Errorf("failed to take tenant admission lock: %w", err)
+	}
+	usage, err := tenantUsage(ctx, tx, tenant)
+	if err != nil {
+		return err
+	}
+	if err := admit(usage); err != nil {
+		return &admissionError{err: err}
+	}
+	return nil
+}
+
+// admissionError carries an AdmitFunc's rejection out of the transaction it
+// ran in, to be returned unwrapped.
+type admissionError struct {
+	err error
+}
+
+func (e *admissionError) Error() string { return e.err.Error() }
+
+// admissionRejection returns the AdmitFunc error err carries, or nil.
+func admissionRejection(err error) error {
+	var rejected *admissionError
+	if errors.As(err, &rejected) {
+		return rejected.err
+	}
+	return nil
+}
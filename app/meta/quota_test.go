@@ -0,0 +1,120 @@
+package meta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hotosm/scaleodm/app/quota"
+)
+
+func TestTenantQuotaAndUsage(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	override, err := store.GetTenantQuota(ctx, "dronetm")
+	require.NoError(t, err)
+	assert.Nil(t, override)
+
+	tasks := 3
+	require.NoError(t, store.SetTenantQuota(ctx, "dronetm", quota.Override{MaxConcurrentTasks: &tasks}))
+	override, err = store.GetTenantQuota(ctx, "dronetm")
+	require.NoError(t, err)
+	require.NotNil(t, override)
+	assert.Equal(t, 3, *override.MaxConcurrentTasks)
+	assert.Nil(t, override.MaxImagesPerTask)
+
+	_, err = store.CreateJobForTenant(ctx, "dronetm", "wf-usage-1", "project", "s3://bucket/a/", "s3://bucket/out/", nil, "us-east-1", map[string]any{MetadataWorkspaceGiBKey: 40.5})
+	require.NoError(t, err)
+	_, err = store.CreateJobForTenant(ctx, "dronetm", "wf-usage-2", "project", "s3://bucket/b/", "s3://bucket/out/", nil, "us-east-1", map[string]any{MetadataWorkspaceGiBKey: 10})
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateJobStatus(ctx, "wf-usage-2", "completed", nil))
+	_, err = store.CreateJobForTenant(ctx, "fair", "wf-usage-3", "project", "s3://bucket/c/", "s3://bucket/out/", nil, "us-east-1", nil)
+	require.NoError(t, err)
+
+	usage, err := store.TenantUsage(ctx, "dronetm")
+	require.NoError(t, err)
+	assert.Equal(t, quota.Usage{ActiveTasks: 1, WorkspaceGiB: 40.5}, usage)
+
+	usage, err = store.TenantUsage(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, usage.ActiveTasks)
+}
+
+func TestInsertJob_AdmitSerialisesTenant(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	errQuota := errors.New("quota exceeded")
+	admitOne := func(usage quota.Usage) error {
+		if usage.ActiveTasks >= 1 {
+			return errQuota
+		}
+		return nil
+	}
+
+	const submissions = 8
+	var wg sync.WaitGroup
+	errs := make([]error, submissions)
+	for i := range submissions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = store.InsertJob(ctx, NewJob{
+				Tenant:       "dronetm",
+				WorkflowName: fmt.Sprintf("wf-admit-%d", i),
+				ProjectID:    "project",
+				ReadPath:     "s3://bucket/images/",
+				WritePath:    "s3://bucket/output/",
+				S3Region:     "us-east-1",
+				Admit:        admitOne,
+			})
+		}()
+	}
+	wg.Wait()
+
+	admitted := 0
+	for _, err := range errs {
+		if err == nil {
+			admitted++
+			continue
+		}
+		assert.ErrorIs(t, err, errQuota)
+	}
+	assert.Equal(t, 1, admitted)
+
+	usage, err := store.TenantUsage(ctx, "dronetm")
+	require.NoError(t, err)
+	assert.Equal(t, 1, usage.ActiveTasks)
+
+	_, err = store.InsertJob(ctx, NewJob{Tenant: "fair", WorkflowName: "wf-admit-fair", ProjectID: "project", Admit: admitOne})
+	assert.NoError(t, err, "other tenants have their own quota")
+}
+
+func TestTenantUsage_IgnoresJobsPastLookback(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	_, err := store.CreateJobForTenant(ctx, "dronetm", "wf-stale", "project", "s3://bucket/a/", "s3://bucket/out/", nil, "us-east-1", map[string]any{MetadataWorkspaceGiBKey: 40})
+	require.NoError(t, err)
+	_, err = db.Pool.Exec(ctx, `UPDATE scaleodm_job_metadata SET created_at = NOW() - INTERVAL '8 days' WHERE workflow_name = 'wf-stale'`)
+	require.NoError(t, err)
+
+	usage, err := store.TenantUsage(ctx, "dronetm")
+	require.NoError(t, err)
+	assert.Equal(t, quota.Usage{}, usage)
+}
@@ -0,0 +1,83 @@
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ResourceObservation is the peak usage of a finished ODM run against the
+// size and flags of its task; see workflows.ProcessUsage.
+type ResourceObservation struct {
+	WorkflowName       string
+	Profile            string
+	ImageCount         int
+	ImageTotalBytes    int64
+	ODMFlags           []string
+	PeakMemoryBytes    int64
+	PeakAnonBytes      int64
+	PeakSwapBytes      int64
+	WorkspacePeakBytes int64
+	ObservedAt         time.Time
+}
+
+// RecordResourceObservation stores a run's observation and reports whether
+// it was new; a task captured by two replicas is stored once.
+func (s *Store) RecordResourceObservation(ctx context.Context, obs ResourceObservation) (bool, error) {
+	flags, err := json.Marshal(obs.ODMFlags)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal odm flags: %w", err)
+	}
+	if obs.ODMFlags == nil {
+		flags = []byte("[]")
+	}
+	query := `
+		INSERT INTO scaleodm_resource_observations
+		(workflow_name, profile, image_count, image_total_bytes, odm_flags, peak_memory_bytes, peak_anon_bytes,
+		 peak_swap_bytes, workspace_peak_bytes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (workflow_name) DO NOTHING
+	`
+	result, err := s.db.Pool.Exec(ctx, query, obs.WorkflowName, obs.Profile, obs.ImageCount, obs.ImageTotalBytes, flags,
+		obs.PeakMemoryBytes, obs.PeakAnonBytes, obs.PeakSwapBytes, obs.WorkspacePeakBytes)
+	if err != nil {
+		return false, fmt.Errorf("failed to record resource observation: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// ListResourceObservations returns the most recent observations, newest
+// first, at most limit of them (all when limit <= 0).
+func (s *Store) ListResourceObservations(ctx context.Context, limit int) ([]ResourceObservation, error) {
+	query := `
+		SELECT workflow_name, profile, image_count, image_total_bytes, odm_flags, peak_memory_bytes, peak_anon_bytes,
+		       peak_swap_bytes, workspace_peak_bytes, observed_at
+		FROM scaleodm_resource_observations
+		ORDER BY observed_at DESC, workflow_name
+	`
+	args := []any{}
+	if limit > 0 {
+		query += " LIMIT $1"
+		args = append(args, limit)
+	}
+	rows, err := s.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resource observations: %w", err)
+	}
+	observations, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ResourceObservation, error) {
+		var obs ResourceObservation
+		var flags []byte
+		if err := row.Scan(&obs.WorkflowName, &obs.Profile, &obs.ImageCount, &obs.ImageTotalBytes, &flags,
+			&obs.PeakMemoryBytes, &obs.PeakAnonBytes, &obs.PeakSwapBytes, &obs.WorkspacePeakBytes, &obs.ObservedAt); err != nil {
+			return obs, err
+		}
+		return obs, json.Unmarshal(flags, &obs.ODMFlags)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan resource observations: %w", err)
+	}
+	return observations, nil
+}
@@ -0,0 +1,49 @@
+package meta
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceObservations(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	first := ResourceObservation{WorkflowName: "wf-small", Profile: "standard", ImageCount: 120, ImageTotalBytes: 1 << 30,
+		PeakMemoryBytes: 20 << 30, PeakAnonBytes: 17 << 30, WorkspacePeakBytes: 12 << 30}
+	second := ResourceObservation{WorkflowName: "wf-dsm", Profile: "dsm-dtm", ImageCount: 900, ODMFlags: []string{"--dsm"},
+		PeakMemoryBytes: 70 << 30, PeakSwapBytes: 4 << 30, WorkspacePeakBytes: 150 << 30}
+
+	for _, obs := range []ResourceObservation{first, second} {
+		recorded, err := store.RecordResourceObservation(ctx, obs)
+		require.NoError(t, err)
+		assert.True(t, recorded)
+	}
+	// Capturing the same run again stores nothing.
+	recorded, err := store.RecordResourceObservation(ctx, first)
+	require.NoError(t, err)
+	assert.False(t, recorded)
+
+	observed, err := store.ListResourceObservations(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, observed, 2)
+	byName := map[string]ResourceObservation{}
+	for _, obs := range observed {
+		assert.False(t, obs.ObservedAt.IsZero())
+		obs.ObservedAt = first.ObservedAt
+		byName[obs.WorkflowName] = obs
+	}
+	first.ODMFlags = []string{}
+	assert.Equal(t, first, byName["wf-small"])
+	assert.Equal(t, second, byName["wf-dsm"])
+
+	observed, err = store.ListResourceObservations(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, observed, 1)
+}
@@ -0,0 +1,85 @@
+package meta
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// StageRun is the timing and resources of one run of a task's stage; see
+// workflows.StageRun.
+type StageRun struct {
+	NodeID             string
+	Stage              string
+	Phase              string
+	StartedAt          time.Time
+	FinishedAt         *time.Time
+	HostNode           string
+	CapacityType       string
+	CPURequestMillis   int64
+	MemoryRequestBytes int64
+}
+
+// RecordStageRuns stores the stage runs of a finished task and returns those
+// that were not stored yet, so that a task captured by two replicas is
+// counted once.
+func (s *Store) RecordStageRuns(ctx context.Context, workflowName string, runs []StageRun) ([]StageRun, error) {
+	if len(runs) == 0 {
+		return nil, nil
+	}
+	query := `
+		INSERT INTO scaleodm_job_stage_runs
+		(workflow_name, node_id, stage, phase, started_at, finished_at, host_node, capacity_type,
+		 cpu_request_millis, memory_request_bytes)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9, $10)
+		ON CONFLICT (workflow_name, node_id) DO NOTHING
+	`
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin recording stage runs: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var recorded []StageRun
+	for _, run := range runs {
+		result, err := tx.Exec(ctx, query, workflowName, run.NodeID, run.Stage, run.Phase, run.StartedAt, run.FinishedAt,
+			run.HostNode, run.CapacityType, run.CPURequestMillis, run.MemoryRequestBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record stage run: %w", err)
+		}
+		if result.RowsAffected() > 0 {
+			recorded = append(recorded, run)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit stage runs: %w", err)
+	}
+	return recorded, nil
+}
+
+// ListStageRuns returns a task's stage runs by start time.
+func (s *Store) ListStageRuns(ctx context.Context, workflowName string) ([]StageRun, error) {
+	query := `
+		SELECT node_id, stage, phase, started_at, finished_at, COALESCE(host_node, ''), COALESCE(capacity_type, ''),
+		       cpu_request_millis, memory_request_bytes
+		FROM scaleodm_job_stage_runs
+		WHERE workflow_name = $1
+		ORDER BY started_at, node_id
+	`
+	rows, err := s.db.Pool.Query(ctx, query, workflowName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stage runs: %w", err)
+	}
+	runs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (StageRun, error) {
+		var run StageRun
+		err := row.Scan(&run.NodeID, &run.Stage, &run.Phase, &run.StartedAt, &run.FinishedAt, &run.HostNode,
+			&run.CapacityType, &run.CPURequestMillis, &run.MemoryRequestBytes)
+		return run, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan stage runs: %w", err)
+	}
+	return runs, nil
+}
@@ -0,0 +1,55 @@
+package meta
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStageRuns(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	_, err := store.CreateJob(ctx, "wf-stages", "project", "s3://bucket/images/", "s3://bucket/output/", nil, "us-east-1", nil)
+	require.NoError(t, err)
+
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	finish := start.Add(32 * time.Minute)
+	runs := []StageRun{
+		{NodeID: "wf-0-process", Stage: "process", Phase: "Succeeded", StartedAt: start.Add(3 * time.Minute), FinishedAt: &finish,
+			HostNode: "ip-10-0-1-5", CapacityType: "spot", CPURequestMillis: 4000, MemoryRequestBytes: 16 << 30},
+		{NodeID: "wf-0-download", Stage: "download", Phase: "Succeeded", StartedAt: start},
+	}
+	recorded, err := store.RecordStageRuns(ctx, "wf-stages", runs)
+	require.NoError(t, err)
+	assert.Len(t, recorded, 2)
+
+	// Capturing the same workflow again stores nothing new.
+	recorded, err = store.RecordStageRuns(ctx, "wf-stages", runs)
+	require.NoError(t, err)
+	assert.Empty(t, recorded)
+
+	stored, err := store.ListStageRuns(ctx, "wf-stages")
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+	assert.Equal(t, "download", stored[0].Stage)
+	assert.Nil(t, stored[0].FinishedAt)
+	assert.Empty(t, stored[0].HostNode)
+	assert.Equal(t, "process", stored[1].Stage)
+	require.NotNil(t, stored[1].FinishedAt)
+	assert.True(t, finish.Equal(*stored[1].FinishedAt))
+	assert.Equal(t, "spot", stored[1].CapacityType)
+	assert.Equal(t, int64(16<<30), stored[1].MemoryRequestBytes)
+
+	// Removing the task removes its stage runs.
+	require.NoError(t, store.DeleteJob(ctx, "wf-stages"))
+	stored, err = store.ListStageRuns(ctx, "wf-stages")
+	require.NoError(t, err)
+	assert.Empty(t, stored)
+}
@@ -28,7 +28,7 @@ func testDB(t *testing.T) (*db.DB, func()) {
 	cleanup := func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
-		_, _ = database.Pool.Exec(ctx, "TRUNCATE TABLE scaleodm_job_metadata CASCADE")
+		_, _ = database.Pool.Exec(ctx, "TRUNCATE TABLE scaleodm_job_metadata, scaleodm_api_tokens, scaleodm_tenant_quotas, scaleodm_odm_option_catalogs, scaleodm_zip_manifests, scaleodm_tenant_webhook_secrets, scaleodm_webhook_deliveries, scaleodm_event_subscriptions, scaleodm_job_events, scaleodm_job_stage_runs, scaleodm_resource_observations CASCADE")
 		database.Close()
 	}
 
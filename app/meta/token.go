@@ -0,0 +1,60 @@
+package meta
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateAPIToken stores an API token by its SHA-256 hex hash; the plaintext
+// is never persisted. An empty tenant defaults to name; expiresAt may be nil
+// for a non-expiring token.
+func (s *Store) CreateAPIToken(ctx context.Context, name, tenant, tokenHash string, expiresAt *time.Time) error {
+	query := `
+		INSERT INTO scaleodm_api_tokens (name, tenant, token_hash, expires_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4)
+	`
+	if _, err := s.db.Pool.Exec(ctx, query, name, tenant, tokenHash, expiresAt); err != nil {
+		return fmt.Errorf("failed to create api token: %w", err)
+	}
+	return nil
+}
+
+// LookupAPIToken returns the name and tenant a live token was issued under,
+// or "" if the hash is unknown, revoked or expired.
+func (s *Store) LookupAPIToken(ctx context.Context, tokenHash string) (string, string, error) {
+	query := `
+		SELECT name, COALESCE(tenant, name)
+		FROM scaleodm_api_tokens
+		WHERE token_hash = $1
+		  AND revoked_at IS NULL
+		  AND (expires_at IS NULL OR expires_at > NOW())
+	`
+
+	var name, tenant string
+	err := s.db.Pool.QueryRow(ctx, query, tokenHash).Scan(&name, &tenant)
+	if err == pgx.ErrNoRows {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to look up api token: %w", err)
+	}
+	return name, tenant, nil
+}
+
+// RevokeAPIToken revokes every live token issued under name and reports how
+// many were revoked.
+func (s *Store) RevokeAPIToken(ctx context.Context, name string) (int64, error) {
+	query := `
+		UPDATE scaleodm_api_tokens
+		SET revoked_at = NOW()
+		WHERE name = $1 AND revoked_at IS NULL
+	`
+	tag, err := s.db.Pool.Exec(ctx, query, name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke api token: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,45 @@
+package meta
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPITokenLifecycle(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	require.NoError(t, store.CreateAPIToken(ctx, "dronetm", "", "hash-live", nil))
+	require.NoError(t, store.CreateAPIToken(ctx, "fair-ci", "fair", "hash-tenant", nil))
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, store.CreateAPIToken(ctx, "expired", "", "hash-expired", &past))
+
+	name, tenant, err := store.LookupAPIToken(ctx, "hash-live")
+	require.NoError(t, err)
+	assert.Equal(t, "dronetm", name)
+	assert.Equal(t, "dronetm", tenant)
+
+	name, tenant, err = store.LookupAPIToken(ctx, "hash-tenant")
+	require.NoError(t, err)
+	assert.Equal(t, "fair-ci", name)
+	assert.Equal(t, "fair", tenant)
+
+	name, _, err = store.LookupAPIToken(ctx, "hash-expired")
+	require.NoError(t, err)
+	assert.Empty(t, name)
+
+	revoked, err := store.RevokeAPIToken(ctx, "dronetm")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), revoked)
+
+	name, _, err = store.LookupAPIToken(ctx, "hash-live")
+	require.NoError(t, err)
+	assert.Empty(t, name)
+}
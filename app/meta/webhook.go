@@ -0,0 +1,154 @@
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// WebhookDelivery is a webhook call queued in scaleodm_webhook_deliveries.
+type WebhookDelivery struct {
+	ID           int64
+	WorkflowName string
+	Tenant       string
+	URL          string
+	// JobStatus is the terminal status the delivery announces.
+	JobStatus string
+	// Attempts counts the attempts made so far, including the claimed one.
+	Attempts int
+	// Payload is nil until the first attempt renders it.
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+// enqueueWebhookInTx queues a webhook delivery for a job that has just
+// reached a terminal status, when its caller set a webhook. It runs in the
+// status update's transaction, so the delivery is recorded exactly when the
+// status is.
+func enqueueWebhookInTx(ctx context.Context, tx pgx.Tx, workflowName string) error {
+	query := `
+		INSERT INTO scaleodm_webhook_deliveries (workflow_name, tenant, url, job_status)
+		SELECT workflow_name, tenant, metadata->>'` + MetadataWebhookKey + `', job_status
+		FROM scaleodm_job_metadata
+		WHERE workflow_name = $1 AND COALESCE(metadata->>'` + MetadataWebhookKey + `', '') <> ''
+	`
+	if _, err := tx.Exec(ctx, query, workflowName); err != nil {
+		return fmt.Errorf("failed to queue webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// ClaimWebhookDelivery claims the next due delivery, or returns nil when none
+// is due. The claim counts an attempt and leases the row for lease: a
+// replica that dies mid-delivery leaves it due again once the lease ends,
+// while other replicas skip it until then.
+func (s *Store) ClaimWebhookDelivery(ctx context.Context, lease time.Duration) (*WebhookDelivery, error) {
+	query := `
+		UPDATE scaleodm_webhook_deliveries
+		SET attempts = attempts + 1,
+		    next_attempt_at = NOW() + make_interval(secs => $1)
+		WHERE id = (
+			SELECT id FROM scaleodm_webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, workflow_name, COALESCE(tenant, ''), url, job_status, attempts, payload, created_at
+	`
+	delivery := &WebhookDelivery{}
+	var payload []byte
+	err := s.db.Pool.QueryRow(ctx, query, lease.Seconds()).Scan(
+		&delivery.ID, &delivery.WorkflowName, &delivery.Tenant, &delivery.URL,
+		&delivery.JobStatus, &delivery.Attempts, &payload, &delivery.CreatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook delivery: %w", err)
+	}
+	if len(payload) > 0 {
+		delivery.Payload = payload
+	}
+	return delivery, nil
+}
+
+// CompleteWebhookDelivery records a delivery the receiver accepted.
+func (s *Store) CompleteWebhookDelivery(ctx context.Context, id int64, payload json.RawMessage) error {
+	query := `
+		UPDATE scaleodm_webhook_deliveries
+		SET status = 'delivered', payload = $2, last_error = NULL, delivered_at = NOW()
+		WHERE id = $1
+	`
+	if _, err := s.db.Pool.Exec(ctx, query, id, nullableJSON(payload)); err != nil {
+		return fmt.Errorf("failed to complete webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// RetryWebhookDelivery records a failed attempt and schedules the next one
+// at next.
+func (s *Store) RetryWebhookDelivery(ctx context.Context, id int64, payload json.RawMessage, errorMsg string, next time.Time) error {
+	query := `
+		UPDATE scaleodm_webhook_deliveries
+		SET payload = $2, last_error = $3, next_attempt_at = $4
+		WHERE id = $1
+	`
+	if _, err := s.db.Pool.Exec(ctx, query, id, nullableJSON(payload), errorMsg, next); err != nil {
+		return fmt.Errorf("failed to reschedule webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// DeadLetterWebhookDelivery gives up on a delivery. The row stays for
+// inspection; setting it back to 'pending' redelivers it.
+func (s *Store) DeadLetterWebhookDelivery(ctx context.Context, id int64, payload json.RawMessage, errorMsg string) error {
+	query := `
+		UPDATE scaleodm_webhook_deliveries
+		SET status = 'dead', payload = $2, last_error = $3
+		WHERE id = $1
+	`
+	if _, err := s.db.Pool.Exec(ctx, query, id, nullableJSON(payload), errorMsg); err != nil {
+		return fmt.Errorf("failed to dead-letter webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// GetTenantWebhookSecret returns the secret a tenant's webhooks are signed
+// with, or "" when it has none.
+func (s *Store) GetTenantWebhookSecret(ctx context.Context, tenant string) (string, error) {
+	var secret string
+	err := s.db.Pool.QueryRow(ctx, `SELECT secret FROM scaleodm_tenant_webhook_secrets WHERE tenant = $1`, tenant).Scan(&secret)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get tenant webhook secret: %w", err)
+	}
+	return secret, nil
+}
+
+// SetTenantWebhookSecret upserts a tenant's webhook signing secret.
+func (s *Store) SetTenantWebhookSecret(ctx context.Context, tenant, secret string) error {
+	query := `
+		INSERT INTO scaleodm_tenant_webhook_secrets (tenant, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (tenant) DO UPDATE
+		SET secret = EXCLUDED.secret, updated_at = NOW()
+	`
+	if _, err := s.db.Pool.Exec(ctx, query, tenant, secret); err != nil {
+		return fmt.Errorf("failed to set tenant webhook secret: %w", err)
+	}
+	return nil
+}
+
+func nullableJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return []byte(raw)
+}
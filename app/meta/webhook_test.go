@@ -0,0 +1,100 @@
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateJobStatus_QueuesWebhookOnTerminalTransition(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	_, err := store.CreateJobForTenant(ctx, "dronetm", "wf-hook", "project", "s3://bucket/images/", "s3://bucket/output/", nil, "us-east-1", map[string]any{MetadataWebhookKey: "https://example.com/hook"})
+	require.NoError(t, err)
+	_, err = store.CreateJob(ctx, "wf-no-hook", "project", "s3://bucket/images/", "s3://bucket/output/", nil, "us-east-1", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, store.UpdateJobStatus(ctx, "wf-hook", "running", nil))
+	require.NoError(t, store.UpdateJobStatus(ctx, "wf-no-hook", "completed", nil))
+	delivery, err := store.ClaimWebhookDelivery(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, delivery, "no terminal transition of a task with a webhook yet")
+
+	require.NoError(t, store.UpdateJobStatus(ctx, "wf-hook", "completed", nil))
+	// A repeated terminal update queues nothing more.
+	require.NoError(t, store.UpdateJobStatus(ctx, "wf-hook", "completed", nil))
+
+	delivery, err = store.ClaimWebhookDelivery(ctx, time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, delivery)
+	assert.Equal(t, "wf-hook", delivery.WorkflowName)
+	assert.Equal(t, "dronetm", delivery.Tenant)
+	assert.Equal(t, "https://example.com/hook", delivery.URL)
+	assert.Equal(t, "completed", delivery.JobStatus)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Nil(t, delivery.Payload)
+
+	// Leased: not due again until the retry time.
+	again, err := store.ClaimWebhookDelivery(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, again)
+
+	payload := json.RawMessage(`{"uuid": "wf-hook"}`)
+	require.NoError(t, store.RetryWebhookDelivery(ctx, delivery.ID, payload, "receiver returned HTTP 502", time.Now().Add(-time.Second)))
+	retried, err := store.ClaimWebhookDelivery(ctx, time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, retried)
+	assert.Equal(t, 2, retried.Attempts)
+	assert.JSONEq(t, string(payload), string(retried.Payload))
+
+	require.NoError(t, store.CompleteWebhookDelivery(ctx, retried.ID, retried.Payload))
+	var status string
+	require.NoError(t, db.Pool.QueryRow(ctx, `SELECT status FROM scaleodm_webhook_deliveries WHERE id = $1`, retried.ID).Scan(&status))
+	assert.Equal(t, "delivered", status)
+}
+
+func TestCancelQueuedJob_QueuesWebhook(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	queueJob(t, store, "wf-queued-hook", "project", 0)
+	require.NoError(t, store.MergeJobMetadata(ctx, "wf-queued-hook", map[string]interface{}{MetadataWebhookKey: "https://example.com/hook"}))
+
+	canceled, err := store.CancelQueuedJob(ctx, "wf-queued-hook")
+	require.NoError(t, err)
+	require.True(t, canceled)
+
+	delivery, err := store.ClaimWebhookDelivery(ctx, time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, delivery)
+	assert.Equal(t, "canceled", delivery.JobStatus)
+}
+
+func TestTenantWebhookSecret(t *testing.T) {
+	db, cleanup := testDB(t)
+	defer cleanup()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	secret, err := store.GetTenantWebhookSecret(ctx, "dronetm")
+	require.NoError(t, err)
+	assert.Empty(t, secret)
+
+	require.NoError(t, store.SetTenantWebhookSecret(ctx, "dronetm", "first"))
+	require.NoError(t, store.SetTenantWebhookSecret(ctx, "dronetm", "second"))
+	secret, err = store.GetTenantWebhookSecret(ctx, "dronetm")
+	require.NoError(t, err)
+	assert.Equal(t, "second", secret)
+}
@@ -0,0 +1,58 @@
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetZipManifest returns the entry CRCs recorded for a task's synthetic
+// all.zip, or nil when none are recorded for the archive identified by etag.
+func (s *Store) GetZipManifest(ctx context.Context, workflowName, etag string) (map[string]uint32, error) {
+	query := `
+		SELECT crcs
+		FROM scaleodm_zip_manifests
+		WHERE workflow_name = $1 AND etag = $2
+	`
+
+	var raw []byte
+	err := s.db.Pool.QueryRow(ctx, query, workflowName, etag).Scan(&raw)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get zip manifest: %w", err)
+	}
+	var crcs map[string]uint32
+	if err := json.Unmarshal(raw, &crcs); err != nil {
+		return nil, fmt.Errorf("failed to decode zip manifest: %w", err)
+	}
+	return crcs, nil
+}
+
+// PutZipManifest records entry CRCs for a task's synthetic all.zip. CRCs for
+// the same etag are merged; a new etag (the outputs changed) replaces them.
+func (s *Store) PutZipManifest(ctx context.Context, workflowName, etag string, crcs map[string]uint32) error {
+	raw, err := json.Marshal(crcs)
+	if err != nil {
+		return fmt.Errorf("failed to encode zip manifest: %w", err)
+	}
+	query := `
+		INSERT INTO scaleodm_zip_manifests (workflow_name, etag, crcs)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (workflow_name) DO UPDATE
+		SET crcs = CASE
+		        WHEN scaleodm_zip_manifests.etag = EXCLUDED.etag
+		        THEN scaleodm_zip_manifests.crcs || EXCLUDED.crcs
+		        ELSE EXCLUDED.crcs
+		    END,
+		    etag = EXCLUDED.etag,
+		    updated_at = NOW()
+	`
+	if _, err := s.db.Pool.Exec(ctx, query, workflowName, etag, raw); err != nil {
+		return fmt.Errorf("failed to store zip manifest: %w", err)
+	}
+	return nil
+}
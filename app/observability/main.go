@@ -49,6 +49,10 @@ var (
 
 	jobStatusUpdateTotal metric.Int64Counter
 
+	stageDuration               metric.Float64Histogram
+	stageRequestedCPUSeconds    metric.Float64Histogram
+	stageRequestedMemorySeconds metric.Float64Histogram
+
 	readinessChecksTotal        metric.Int64Counter
 	readinessDependencyFailures metric.Int64Counter
 	readinessDuration           metric.Float64Histogram
@@ -220,6 +224,27 @@ func RecordJobStatusUpdate(result, status, reason string, duration time.Duration
 	_ = duration
 }
 
+// RecordStageRun records a finished run of a task's stage: its duration and
+// the CPU (core-seconds) and memory (GiB-seconds) it had requested for that
+// long, by stage, phase and capacity type.
+func RecordStageRun(stage, phase, capacityType string, duration time.Duration, cpuRequestMillis, memoryRequestBytes int64) {
+	attrs := metric.WithAttributes(
+		attribute.String("stage", normalize(stage, "unknown")),
+		attribute.String("phase", normalize(phase, "unknown")),
+		attribute.String("capacity_type", normalize(capacityType, "unknown")),
+	)
+	ctx := context.Background()
+	if stageDuration != nil {
+		stageDuration.Record(ctx, duration.Seconds(), attrs)
+	}
+	if stageRequestedCPUSeconds != nil {
+		stageRequestedCPUSeconds.Record(ctx, float64(cpuRequestMillis)/1000*duration.Seconds(), attrs)
+	}
+	if stageRequestedMemorySeconds != nil {
+		stageRequestedMemorySeconds.Record(ctx, float64(memoryRequestBytes)/(1<<30)*duration.Seconds(), attrs)
+	}
+}
+
 func RecordReadinessCheck(ready bool, duration time.Duration) {
 	if readinessChecksTotal != nil {
 		result := "success"
@@ -282,6 +307,18 @@ func initInstruments(meter metric.Meter) {
 	if err != nil {
 		log.Printf("observability: failed creating job status update counter: %v", err)
 	}
+	stageDuration, err = meter.Float64Histogram("scaleodm_stage_duration_seconds")
+	if err != nil {
+		log.Printf("observability: failed creating stage duration histogram: %v", err)
+	}
+	stageRequestedCPUSeconds, err = meter.Float64Histogram("scaleodm_stage_requested_cpu_core_seconds")
+	if err != nil {
+		log.Printf("observability: failed creating stage requested cpu histogram: %v", err)
+	}
+	stageRequestedMemorySeconds, err = meter.Float64Histogram("scaleodm_stage_requested_memory_gib_seconds")
+	if err != nil {
+		log.Printf("observability: failed creating stage requested memory histogram: %v", err)
+	}
 	readinessChecksTotal, err = meter.Int64Counter("scaleodm_readiness_checks_total")
 	if err != nil {
 		log.Printf("observability: failed creating readiness checks counter: %v", err)
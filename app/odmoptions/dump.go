@@ -0,0 +1,123 @@
+package odmoptions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Markers around the JSON the dump script prints, so ODM's own log lines
+// on stdout do not get in the way.
+const (
+	dumpBegin = "=== SCALEODM ODM OPTIONS BEGIN ==="
+	dumpEnd   = "=== SCALEODM ODM OPTIONS END ==="
+)
+
+// DumpScript prints the options of the ODM install in the working directory
+// (/code in the ODM images). Like NodeODM it lets opendm.config build its
+// argument parser and records every argument added; only the arguments a
+// task cannot set (help, version, the project path and the dataset name) are
+// left out.
+const DumpScript = `
+import argparse
+import json
+import os
+import sys
+
+sys.path.insert(0, os.getcwd())
+from opendm import config
+
+actions = []
+
+
+class RecordingParser(argparse.ArgumentParser):
+    def add_argument(self, *args, **kwargs):
+        action = super().add_argument(*args, **kwargs)
+        actions.append(action)
+        return action
+
+    def add_mutually_exclusive_group(self, **kwargs):
+        return self
+
+
+try:
+    config.config(["--project-path", "/tmp", "scaleodm"], parser=RecordingParser(add_help=False))
+except SystemExit:
+    pass
+
+
+def kind(action):
+    if action.nargs == 0:
+        return "bool"
+    if action.choices:
+        return "enum"
+    if action.type is int:
+        return "int"
+    if action.type is float:
+        return "float"
+    return "string"
+
+
+def text(value):
+    if isinstance(value, bool):
+        return "true" if value else "false"
+    if value is None:
+        return ""
+    return str(value)
+
+
+options = []
+seen = set(["help", "version", "project-path"])
+for action in actions:
+    names = [s[2:] for s in action.option_strings if s.startswith("--")]
+    if not names or names[0] in seen:
+        continue
+    seen.add(names[0])
+    option_type = kind(action)
+    if option_type == "enum":
+        domain = [text(choice) for choice in action.choices]
+    elif option_type == "bool":
+        domain = "bool"
+    else:
+        domain = (action.metavar or option_type).strip("<>")
+    params = dict(vars(action))
+    if action.choices:
+        params["choices"] = ", ".join(text(choice) for choice in action.choices)
+    help_text = action.help or ""
+    try:
+        help_text = help_text % params
+    except (KeyError, TypeError, ValueError):
+        pass
+    options.append({
+        "name": names[0],
+        "type": option_type,
+        "value": text(action.default),
+        "domain": domain,
+        "help": " ".join(help_text.split()),
+    })
+
+options.sort(key=lambda option: option["name"])
+print("` + dumpBegin + `")
+print(json.dumps(options))
+print("` + dumpEnd + `")
+`
+
+// ParseDump reads the catalog for image out of DumpScript's output.
+func ParseDump(image string, output []byte) (*Catalog, error) {
+	_, rest, ok := bytes.Cut(output, []byte(dumpBegin))
+	if !ok {
+		return nil, fmt.Errorf("no option list in the output of %s", image)
+	}
+	body, _, ok := bytes.Cut(rest, []byte(dumpEnd))
+	if !ok {
+		return nil, fmt.Errorf("truncated option list in the output of %s", image)
+	}
+	var options []Option
+	if err := json.Unmarshal(bytes.TrimSpace(body), &options); err != nil {
+		return nil, fmt.Errorf("invalid option list in the output of %s: %w", image, err)
+	}
+	if len(options) == 0 {
+		return nil, fmt.Errorf("%s reported no options", image)
+	}
+	return NewCatalog(image, options), nil
+}
@@ -0,0 +1,317 @@
+// Package odmoptions describes the command line options an ODM image accepts
+// and checks task options against them.
+//
+// The catalog is read from the image itself (see DumpScript), so it always
+// matches the ODM version a task runs with. Options are described the way
+// NodeODM's GET /options does: name, type, default value, domain and help.
+package odmoptions
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Option types, as NodeODM reports them.
+const (
+	TypeBool   = "bool"
+	TypeInt    = "int"
+	TypeFloat  = "float"
+	TypeString = "string"
+	TypeEnum   = "enum"
+)
+
+// Option is one ODM command line option.
+type Option struct {
+	Name  string
+	Type  string
+	Value string
+	// Domain is ODM's description of the valid values, such as
+	// "positive integer" or "integer: 1 <= x <= 10". Enum options list
+	// Choices instead.
+	Domain  string
+	Choices []string
+	Help    string
+}
+
+// optionJSON is the NodeODM wire form, where an enum's domain is its list of
+// choices.
+type optionJSON struct {
+	Name   string          `json:"name"`
+	Type   string          `json:"type"`
+	Value  string          `json:"value"`
+	Domain json.RawMessage `json:"domain"`
+	Help   string          `json:"help"`
+}
+
+// DomainValue returns the domain as NodeODM serves it: the choices for an
+// enum, the description otherwise.
+func (o Option) DomainValue() any {
+	if o.Type == TypeEnum {
+		return o.Choices
+	}
+	return o.Domain
+}
+
+func (o Option) MarshalJSON() ([]byte, error) {
+	domain, err := json.Marshal(o.DomainValue())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(optionJSON{Name: o.Name, Type: o.Type, Value: o.Value, Domain: domain, Help: o.Help})
+}
+
+func (o *Option) UnmarshalJSON(data []byte) error {
+	var raw optionJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*o = Option{Name: raw.Name, Type: raw.Type, Value: raw.Value, Help: raw.Help}
+	if len(raw.Domain) == 0 || string(raw.Domain) == "null" {
+		return nil
+	}
+	if raw.Domain[0] == '[' {
+		return json.Unmarshal(raw.Domain, &o.Choices)
+	}
+	return json.Unmarshal(raw.Domain, &o.Domain)
+}
+
+// Catalog is the set of options one ODM image accepts.
+type Catalog struct {
+	Image   string
+	Options []Option
+	byName  map[string]Option
+}
+
+// NewCatalog indexes options for image, sorted by name.
+func NewCatalog(image string, options []Option) *Catalog {
+	sorted := append([]Option(nil), options...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	byName := make(map[string]Option, len(sorted))
+	for _, opt := range sorted {
+		byName[opt.Name] = opt
+	}
+	return &Catalog{Image: image, Options: sorted, byName: byName}
+}
+
+// Lookup returns the option called name.
+func (c *Catalog) Lookup(name string) (Option, bool) {
+	opt, ok := c.byName[name]
+	return opt, ok
+}
+
+// Check reports whether value is valid for the option called name. A nil
+// value is accepted: the option is left unset.
+func (c *Catalog) Check(name string, value any) error {
+	opt, ok := c.byName[name]
+	if !ok {
+		if suggestion := c.closest(name); suggestion != "" {
+			return fmt.Errorf("unknown option %q (did you mean %q?)", name, suggestion)
+		}
+		return fmt.Errorf("unknown option %q", name)
+	}
+	if value == nil {
+		return nil
+	}
+	if err := opt.check(value); err != nil {
+		return fmt.Errorf("invalid value for option %q: %w", name, err)
+	}
+	return nil
+}
+
+func (o Option) check(value any) error {
+	switch o.Type {
+	case TypeBool:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("expected true or false, got %s", describe(value))
+		}
+		return nil
+	case TypeInt, TypeFloat:
+		n, ok := number(value)
+		if !ok {
+			return fmt.Errorf("expected a number, got %s", describe(value))
+		}
+		if o.Type == TypeInt && n != math.Trunc(n) {
+			return fmt.Errorf("expected an integer, got %s", describe(value))
+		}
+		return checkDomain(o.Domain, n)
+	case TypeEnum:
+		s, ok := scalar(value)
+		if !ok {
+			return fmt.Errorf("expected one of %s, got %s", strings.Join(o.Choices, ", "), describe(value))
+		}
+		for _, choice := range o.Choices {
+			if s == choice {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected one of %s, got %q", strings.Join(o.Choices, ", "), s)
+	default:
+		// Objects and arrays only make sense where ODM parses JSON,
+		// such as a GeoJSON boundary.
+		if _, ok := scalar(value); !ok && !strings.Contains(strings.ToLower(o.Domain), "json") {
+			return fmt.Errorf("expected a string, got %s", describe(value))
+		}
+		return nil
+	}
+}
+
+// scalar formats a JSON scalar as ODM receives it on the command line.
+func scalar(value any) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case json.Number:
+		return v.String(), true
+	case int:
+		return strconv.Itoa(v), true
+	}
+	return "", false
+}
+
+func number(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case json.Number:
+		n, err := v.Float64()
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil && !math.IsNaN(n)
+	}
+	return 0, false
+}
+
+func describe(value any) string {
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	if _, ok := scalar(value); ok {
+		return fmt.Sprint(value)
+	}
+	return fmt.Sprintf("a JSON %T", value)
+}
+
+var (
+	signedDomain = regexp.MustCompile(`^(positive|negative) (integer|float)$`)
+	rangeDomain  = regexp.MustCompile(`^(?:integer|float)\s*:?\s*(.*)$`)
+)
+
+// checkDomain applies the numeric bounds in an ODM domain description. ODM
+// writes them as "positive integer", "percent", "float: 0 <= x <= 10",
+// "integer: x >= 1" or "float > 0.0"; descriptions it does not recognise
+// only get the type check.
+func checkDomain(domain string, n float64) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if m := signedDomain.FindStringSubmatch(domain); m != nil {
+		if m[1] == "positive" && n < 0 {
+			return fmt.Errorf("expected a %s, got %v", domain, n)
+		}
+		if m[1] == "negative" && n > 0 {
+			return fmt.Errorf("expected a %s, got %v", domain, n)
+		}
+		return nil
+	}
+	if domain == "percent" {
+		if n < 0 || n > 100 {
+			return fmt.Errorf("expected a percent between 0 and 100, got %v", n)
+		}
+		return nil
+	}
+	m := rangeDomain.FindStringSubmatch(domain)
+	if m == nil {
+		return nil
+	}
+	lhs, rhs, ok := strings.Cut(m[1], "x")
+	if !ok {
+		// "float > 0.0" leaves x implicit.
+		lhs, rhs = "", m[1]
+	}
+	// "a <= x" bounds from the left; "x <= b" and "x >= a" from the right.
+	if fields := strings.Fields(lhs); len(fields) == 2 {
+		if !satisfies(fields[0], fields[1], n, true) {
+			return fmt.Errorf("expected %s, got %v", domain, n)
+		}
+	}
+	if fields := strings.Fields(rhs); len(fields) == 2 {
+		if !satisfies(fields[1], fields[0], n, false) {
+			return fmt.Errorf("expected %s, got %v", domain, n)
+		}
+	}
+	return nil
+}
+
+// satisfies evaluates "bound op x" (left) or "x op bound" (right).
+func satisfies(boundText, op string, n float64, left bool) bool {
+	bound, err := strconv.ParseFloat(boundText, 64)
+	if err != nil {
+		return true
+	}
+	if left {
+		// bound op x is x op' bound with the comparison flipped.
+		switch op {
+		case "<":
+			op = ">"
+		case "<=":
+			op = ">="
+		case ">":
+			op = "<"
+		case ">=":
+			op = "<="
+		}
+	}
+	switch op {
+	case "<":
+		return n < bound
+	case "<=":
+		return n <= bound
+	case ">":
+		return n > bound
+	case ">=":
+		return n >= bound
+	}
+	return true
+}
+
+// closest suggests the option name nearest to a misspelt one, if any is
+// close enough to be a likely typo.
+func (c *Catalog) closest(name string) string {
+	best, bestDistance := "", len(name)/3+1
+	for _, opt := range c.Options {
+		if d := editDistance(name, opt.Name); d <= bestDistance && (best == "" || d < bestDistance) {
+			best, bestDistance = opt.Name, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,104 @@
+package odmoptions
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCatalog() *Catalog {
+	return NewCatalog("ghcr.io/hotosm/odm:3.6.1", []Option{
+		{Name: "orthophoto-resolution", Type: TypeFloat, Value: "5", Domain: "float > 0"},
+		{Name: "dsm", Type: TypeBool, Value: "false", Domain: "bool"},
+		{Name: "max-concurrency", Type: TypeInt, Value: "4", Domain: "positive integer"},
+		{Name: "pc-quality", Type: TypeEnum, Value: "medium", Choices: []string{"ultra", "high", "medium", "low", "lowest"}},
+		{Name: "mesh-octree-depth", Type: TypeInt, Value: "11", Domain: "integer: 1 <= x <= 14"},
+		{Name: "crop", Type: TypeFloat, Value: "3", Domain: "positive float"},
+		{Name: "gps-accuracy", Type: TypeFloat, Value: "3", Domain: "float: x > 0"},
+		{Name: "matcher-order", Type: TypeInt, Value: "0", Domain: "percent"},
+		{Name: "boundary", Type: TypeString, Value: "", Domain: "json"},
+		{Name: "name", Type: TypeString, Value: "code", Domain: "string"},
+	})
+}
+
+func TestCatalogCheck(t *testing.T) {
+	catalog := testCatalog()
+	assert.Equal(t, "boundary", catalog.Options[0].Name)
+
+	for _, tc := range []struct {
+		name  string
+		value any
+	}{
+		{"dsm", true},
+		{"dsm", nil},
+		{"orthophoto-resolution", 2.5},
+		{"orthophoto-resolution", "2.5"},
+		{"max-concurrency", float64(8)},
+		{"max-concurrency", json.Number("0")},
+		{"pc-quality", "high"},
+		{"mesh-octree-depth", float64(14)},
+		{"gps-accuracy", 0.5},
+		{"matcher-order", float64(100)},
+		{"boundary", map[string]any{"type": "FeatureCollection"}},
+		{"name", float64(42)},
+	} {
+		assert.NoError(t, catalog.Check(tc.name, tc.value), "%s=%v", tc.name, tc.value)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"orthophoto-resolutoin", 5.0, `unknown option "orthophoto-resolutoin" (did you mean "orthophoto-resolution"?)`},
+		{"project-path", "/tmp", `unknown option "project-path"`},
+		{"dsm", "true", `invalid value for option "dsm": expected true or false, got "true"`},
+		{"orthophoto-resolution", "fine", `expected a number, got "fine"`},
+		{"max-concurrency", 2.5, "expected an integer, got 2.5"},
+		{"max-concurrency", float64(-1), "expected a positive integer, got -1"},
+		{"crop", -0.5, "expected a positive float, got -0.5"},
+		{"pc-quality", "best", `expected one of ultra, high, medium, low, lowest, got "best"`},
+		{"orthophoto-resolution", float64(0), "expected float > 0, got 0"},
+		{"mesh-octree-depth", float64(15), "expected integer: 1 <= x <= 14, got 15"},
+		{"mesh-octree-depth", float64(0), "expected integer: 1 <= x <= 14, got 0"},
+		{"gps-accuracy", float64(0), "expected float: x > 0, got 0"},
+		{"matcher-order", float64(101), "expected a percent between 0 and 100, got 101"},
+		{"name", []any{"a"}, "expected a string, got a JSON []interface {}"},
+	} {
+		err := catalog.Check(tc.name, tc.value)
+		require.Error(t, err, "%s=%v", tc.name, tc.value)
+		assert.Contains(t, err.Error(), tc.want)
+	}
+}
+
+func TestOptionJSON(t *testing.T) {
+	data, err := json.Marshal(testCatalog().Options)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"domain":["ultra","high","medium","low","lowest"]`)
+	assert.Contains(t, string(data), `"domain":"positive integer"`)
+
+	var decoded []Option
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, testCatalog().Options, decoded)
+}
+
+func TestParseDump(t *testing.T) {
+	output := "[INFO]    Initializing ODM\n" + dumpBegin + "\n" +
+		`[{"name": "dsm", "type": "bool", "value": "false", "domain": "bool", "help": "Build a DSM"},` +
+		` {"name": "feature-quality", "type": "enum", "value": "high", "domain": ["high", "low"], "help": ""}]` +
+		"\n" + dumpEnd + "\n"
+
+	catalog, err := ParseDump("odm:test", []byte(output))
+	require.NoError(t, err)
+	assert.Equal(t, "odm:test", catalog.Image)
+	opt, ok := catalog.Lookup("feature-quality")
+	require.True(t, ok)
+	assert.Equal(t, []string{"high", "low"}, opt.Choices)
+
+	_, err = ParseDump("odm:test", []byte("Traceback (most recent call last):\n"))
+	assert.ErrorContains(t, err, "no option list in the output of odm:test")
+	_, err = ParseDump("odm:test", []byte(dumpBegin+"\n[]\n"+dumpEnd))
+	assert.ErrorContains(t, err, "reported no options")
+}
@@ -0,0 +1,160 @@
+package odmoptions
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Extractor runs DumpScript in an ODM image and returns its output.
+type Extractor interface {
+	ExtractODMOptions(ctx context.Context, image string) ([]byte, error)
+}
+
+// Store persists catalogs so each image is only extracted once.
+type Store interface {
+	// GetODMOptionCatalog returns nil when image has no stored catalog.
+	GetODMOptionCatalog(ctx context.Context, image string) ([]Option, error)
+	PutODMOptionCatalog(ctx context.Context, image string, options []Option) error
+}
+
+// retryAfter spaces out extraction attempts for an image that failed, so a
+// missing image or permission does not start a pod per request.
+const retryAfter = 5 * time.Minute
+
+// Registry caches catalogs by image. Either dependency may be nil: without
+// a store catalogs are not persisted, without an extractor only stored or
+// added catalogs are known.
+type Registry struct {
+	store     Store
+	extractor Extractor
+	timeout   time.Duration
+
+	mu       sync.Mutex
+	catalogs map[string]*Catalog
+	inflight map[string]*load
+	failedAt map[string]time.Time
+}
+
+type load struct {
+	done    chan struct{}
+	catalog *Catalog
+	err     error
+}
+
+// NewRegistry returns a registry that gives each extraction timeout to run.
+func NewRegistry(store Store, extractor Extractor, timeout time.Duration) *Registry {
+	return &Registry{
+		store:     store,
+		extractor: extractor,
+		timeout:   timeout,
+		catalogs:  map[string]*Catalog{},
+		inflight:  map[string]*load{},
+		failedAt:  map[string]time.Time{},
+	}
+}
+
+// Add caches catalog under its image.
+func (r *Registry) Add(catalog *Catalog) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.catalogs[catalog.Image] = catalog
+	delete(r.failedAt, catalog.Image)
+}
+
+// Lookup returns the cached catalog for image. When there is none it starts
+// loading one in the background and returns nil, so requests never wait on
+// an image pull.
+func (r *Registry) Lookup(image string) *Catalog {
+	r.mu.Lock()
+	catalog := r.catalogs[image]
+	_, loading := r.inflight[image]
+	failedAt, failed := r.failedAt[image]
+	r.mu.Unlock()
+
+	if catalog == nil && !loading && (!failed || time.Since(failedAt) >= retryAfter) {
+		go func() {
+			if _, err := r.Load(context.Background(), image); err != nil {
+				log.Printf("odm options: catalog for %s unavailable: %v", image, err)
+			}
+		}()
+	}
+	return catalog
+}
+
+// Load returns the catalog for image, reading it from the store or, failing
+// that, extracting it from the image. Concurrent loads of one image share
+// the work.
+func (r *Registry) Load(ctx context.Context, image string) (*Catalog, error) {
+	r.mu.Lock()
+	if catalog := r.catalogs[image]; catalog != nil {
+		r.mu.Unlock()
+		return catalog, nil
+	}
+	if l := r.inflight[image]; l != nil {
+		r.mu.Unlock()
+		select {
+		case <-l.done:
+			return l.catalog, l.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	l := &load{done: make(chan struct{})}
+	r.inflight[image] = l
+	r.mu.Unlock()
+
+	l.catalog, l.err = r.fetch(ctx, image)
+
+	r.mu.Lock()
+	delete(r.inflight, image)
+	if l.err != nil {
+		r.failedAt[image] = time.Now()
+	} else {
+		r.catalogs[image] = l.catalog
+		delete(r.failedAt, image)
+	}
+	r.mu.Unlock()
+	close(l.done)
+	return l.catalog, l.err
+}
+
+func (r *Registry) fetch(ctx context.Context, image string) (*Catalog, error) {
+	if r.store != nil {
+		options, err := r.store.GetODMOptionCatalog(ctx, image)
+		if err != nil {
+			log.Printf("odm options: failed to read stored catalog for %s: %v", image, err)
+		} else if len(options) > 0 {
+			return NewCatalog(image, options), nil
+		}
+	}
+	if r.extractor == nil {
+		return nil, fmt.Errorf("no stored catalog and no extractor configured")
+	}
+
+	start := time.Now()
+	extractCtx := ctx
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		extractCtx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	output, err := r.extractor.ExtractODMOptions(extractCtx, image)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract options: %w", err)
+	}
+	catalog, err := ParseDump(image, output)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("odm options: extracted %d options from %s (took %v)", len(catalog.Options), image, time.Since(start))
+
+	if r.store != nil {
+		if err := r.store.PutODMOptionCatalog(ctx, image, catalog.Options); err != nil {
+			log.Printf("odm options: failed to store catalog for %s: %v", image, err)
+		}
+	}
+	return catalog, nil
+}
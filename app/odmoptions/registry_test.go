@@ -0,0 +1,86 @@
+package odmoptions
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore struct {
+	mu       sync.Mutex
+	catalogs map[string][]Option
+}
+
+func (s *memoryStore) GetODMOptionCatalog(_ context.Context, image string) ([]Option, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.catalogs[image], nil
+}
+
+func (s *memoryStore) PutODMOptionCatalog(_ context.Context, image string, options []Option) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.catalogs[image] = options
+	return nil
+}
+
+type countingExtractor struct {
+	mu     sync.Mutex
+	calls  int
+	output string
+	err    error
+}
+
+func (e *countingExtractor) ExtractODMOptions(context.Context, string) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls++
+	return []byte(e.output), e.err
+}
+
+func (e *countingExtractor) callCount() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calls
+}
+
+const testDump = dumpBegin + "\n" + `[{"name": "dsm", "type": "bool", "value": "false", "domain": "bool", "help": ""}]` + "\n" + dumpEnd
+
+func TestRegistryLoad(t *testing.T) {
+	store := &memoryStore{catalogs: map[string][]Option{}}
+	extractor := &countingExtractor{output: testDump}
+	registry := NewRegistry(store, extractor, time.Minute)
+
+	assert.Nil(t, registry.Lookup("odm:1"))
+	require.Eventually(t, func() bool { return registry.Lookup("odm:1") != nil }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, extractor.callCount())
+	assert.Len(t, store.catalogs["odm:1"], 1)
+
+	// A second replica reads the stored catalog instead of extracting again.
+	catalog, err := NewRegistry(store, extractor, time.Minute).Load(context.Background(), "odm:1")
+	require.NoError(t, err)
+	_, ok := catalog.Lookup("dsm")
+	assert.True(t, ok)
+	assert.Equal(t, 1, extractor.callCount())
+}
+
+func TestRegistryLoadFailure(t *testing.T) {
+	extractor := &countingExtractor{err: errors.New("image pull failed")}
+	registry := NewRegistry(nil, extractor, time.Minute)
+
+	_, err := registry.Load(context.Background(), "odm:missing")
+	assert.ErrorContains(t, err, "image pull failed")
+
+	// Lookups inside the retry window do not start another extraction.
+	assert.Nil(t, registry.Lookup("odm:missing"))
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 1, extractor.callCount())
+
+	_, err = NewRegistry(nil, nil, time.Minute).Load(context.Background(), "odm:1")
+	assert.ErrorContains(t, err, "no extractor configured")
+}
@@ -0,0 +1,103 @@
+// Package quota implements per-tenant admission control for new tasks.
+//
+// Limits are checked in /task/new and /task/restart before a workflow is
+// submitted, and again as its job is recorded, in the same transaction and
+// under the tenant's pg_advisory_xact_lock (see meta.AdmitFunc). Admissions
+// of one tenant are serialised, so two requests racing for the last slot
+// cannot both be admitted.
+package quota
+
+import (
+	"fmt"
+
+	"github.com/hotosm/scaleodm/app/config"
+)
+
+// Limits caps what one tenant may have in flight. Zero means unlimited.
+type Limits struct {
+	MaxConcurrentTasks int
+	MaxImagesPerTask   int
+	MaxWorkspaceGiB    float64
+}
+
+// Override holds per-tenant limits; nil fields keep the default.
+type Override struct {
+	MaxConcurrentTasks *int
+	MaxImagesPerTask   *int
+	MaxWorkspaceGiB    *float64
+}
+
+// Usage is a tenant's current footprint: tasks that are not yet terminal
+// and the workspace GiB they were sized for.
+type Usage struct {
+	ActiveTasks  int
+	WorkspaceGiB float64
+}
+
+// Request describes the task being admitted.
+type Request struct {
+	ImageCount   int
+	WorkspaceGiB float64
+}
+
+// ExceededError reports which limit rejected a task. Reason is a stable,
+// metric-friendly label; Error() is the message returned to the client.
+type ExceededError struct {
+	Reason  string
+	Message string
+}
+
+func (e *ExceededError) Error() string {
+	return e.Message
+}
+
+// DefaultLimits returns the configured per-tenant defaults.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxConcurrentTasks: config.SCALEODM_QUOTA_MAX_CONCURRENT_TASKS,
+		MaxImagesPerTask:   config.SCALEODM_QUOTA_MAX_IMAGES_PER_TASK,
+		MaxWorkspaceGiB:    config.SCALEODM_QUOTA_MAX_WORKSPACE_GIB,
+	}
+}
+
+// With returns l with any non-nil override applied.
+func (l Limits) With(o *Override) Limits {
+	if o == nil {
+		return l
+	}
+	if o.MaxConcurrentTasks != nil {
+		l.MaxConcurrentTasks = *o.MaxConcurrentTasks
+	}
+	if o.MaxImagesPerTask != nil {
+		l.MaxImagesPerTask = *o.MaxImagesPerTask
+	}
+	if o.MaxWorkspaceGiB != nil {
+		l.MaxWorkspaceGiB = *o.MaxWorkspaceGiB
+	}
+	return l
+}
+
+// Check admits req if it fits within l on top of usage, or returns an
+// *ExceededError naming the first limit it breaks.
+func (l Limits) Check(usage Usage, req Request) error {
+	if l.MaxImagesPerTask > 0 && req.ImageCount > l.MaxImagesPerTask {
+		return &ExceededError{
+			Reason:  "max_images_per_task",
+			Message: fmt.Sprintf("Task has %d images; the limit is %d images per task", req.ImageCount, l.MaxImagesPerTask),
+		}
+	}
+	if l.MaxConcurrentTasks > 0 && usage.ActiveTasks >= l.MaxConcurrentTasks {
+		return &ExceededError{
+			Reason:  "max_concurrent_tasks",
+			Message: fmt.Sprintf("%d tasks already queued or running; the limit is %d concurrent tasks", usage.ActiveTasks, l.MaxConcurrentTasks),
+		}
+	}
+	if l.MaxWorkspaceGiB > 0 && usage.WorkspaceGiB+req.WorkspaceGiB > l.MaxWorkspaceGiB {
+		return &ExceededError{
+			Reason: "max_workspace_gib",
+			Message: fmt.Sprintf("Task needs ~%.0f GiB of workspace with %.0f GiB already in flight; the limit is %.0f GiB",
+				req.WorkspaceGiB, usage.WorkspaceGiB, l.MaxWorkspaceGiB),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package quota
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitsCheck(t *testing.T) {
+	limits := Limits{MaxConcurrentTasks: 2, MaxImagesPerTask: 500, MaxWorkspaceGiB: 100}
+
+	assert.NoError(t, limits.Check(Usage{ActiveTasks: 1, WorkspaceGiB: 40}, Request{ImageCount: 500, WorkspaceGiB: 60}))
+
+	tests := []struct {
+		name   string
+		usage  Usage
+		req    Request
+		reason string
+	}{
+		{"too many images", Usage{}, Request{ImageCount: 501}, "max_images_per_task"},
+		{"too many tasks", Usage{ActiveTasks: 2}, Request{ImageCount: 10}, "max_concurrent_tasks"},
+		{"too much workspace", Usage{ActiveTasks: 1, WorkspaceGiB: 80}, Request{WorkspaceGiB: 30}, "max_workspace_gib"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := limits.Check(tt.usage, tt.req)
+			var exceeded *ExceededError
+			require.ErrorAs(t, err, &exceeded)
+			assert.Equal(t, tt.reason, exceeded.Reason)
+			assert.NotEmpty(t, exceeded.Error())
+		})
+	}
+}
+
+func TestLimitsUnlimitedByDefault(t *testing.T) {
+	assert.NoError(t, Limits{}.Check(Usage{ActiveTasks: 1000, WorkspaceGiB: 1e6}, Request{ImageCount: 1e6, WorkspaceGiB: 1e6}))
+}
+
+func TestLimitsWithOverride(t *testing.T) {
+	tasks, gib := 5, 0.0
+	limits := Limits{MaxConcurrentTasks: 2, MaxImagesPerTask: 500, MaxWorkspaceGiB: 100}.With(&Override{
+		MaxConcurrentTasks: &tasks,
+		MaxWorkspaceGiB:    &gib,
+	})
+	assert.Equal(t, Limits{MaxConcurrentTasks: 5, MaxImagesPerTask: 500, MaxWorkspaceGiB: 0}, limits)
+	assert.Equal(t, limits, limits.With(nil))
+}
@@ -20,6 +20,12 @@
 //  2. For each, fetches the live Argo workflow phase from the Kubernetes API.
 //  3. If the live phase is a forward transition from the DB status, writes the
 //     updated status immediately so subsequent polls get the correct answer.
+//  4. For a running workflow, records the stage and progress in the job
+//     metadata, reading the ODM stage from the process log written since the
+//     previous cycle.
+//  5. For a finished workflow, records the timing and resources of each of
+//     its stage runs and the peak usage of its ODM run (see
+//     RecordFinishedWorkflow).
 //
 // # Interval choice (30 s)
 //
@@ -27,9 +33,10 @@
 // ~2 880 reconcile cycles before Argo GC. Even with an aggressive 5-minute TTL
 // there are 10 chances to catch the transition before the workflow is deleted.
 // The per-cycle cost is negligible: one DB query plus one Kubernetes API call
-// per active (non-terminal) job. When the system is idle the DB query returns
-// zero rows and no Argo calls are made at all - the goroutine simply sleeps
-// until the next tick.
+// per active (non-terminal) job, and for a running job a pod listing, a read
+// of the log lines written since the last cycle and a metadata update. When
+// the system is idle the DB query returns zero rows and no Argo calls are
+// made at all - the goroutine simply sleeps until the next tick.
 //
 // # 7-day lookback window
 //
@@ -42,11 +49,9 @@
 package reconciler
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"log"
-	"net/http"
 	"sort"
 	"time"
 
@@ -54,6 +59,7 @@ import (
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 
 	"github.com/hotosm/scaleodm/app/meta"
+	"github.com/hotosm/scaleodm/app/observability"
 	"github.com/hotosm/scaleodm/app/workflows"
 )
 
@@ -124,6 +130,10 @@ func syncActiveJobs(ctx context.Context, store *meta.Store, wfClient workflows.W
 			continue
 		}
 
+		if wf.Status.Phase == wfv1.WorkflowRunning {
+			syncJobProgress(ctx, store, wfClient, job, wf)
+		}
+
 		liveStatus := meta.MapArgoPhaseToJobStatus(string(wf.Status.Phase))
 		if liveStatus == job.JobStatus {
 			skipped++
@@ -153,23 +163,23 @@ func syncActiveJobs(ctx context.Context, store *meta.Store, wfClient workflows.W
 			}
 		}
 		var updateErr error
+		actorCtx := meta.WithActor(ctx, meta.ActorReconciler, "argo_sync")
 		if failureDetails != nil {
-			updateErr = store.UpdateJobStatusWithFailureDetails(ctx, job.WorkflowName, liveStatus, errMsg, failureDetails)
+			updateErr = store.UpdateJobStatusWithFailureDetails(actorCtx, job.WorkflowName, liveStatus, errMsg, failureDetails)
 		} else {
-			updateErr = store.UpdateJobStatus(ctx, job.WorkflowName, liveStatus, errMsg)
+			updateErr = store.UpdateJobStatus(actorCtx, job.WorkflowName, liveStatus, errMsg)
 		}
 		if updateErr != nil {
 			log.Printf("reconciler: failed to update job %q %s->%s: %v", job.WorkflowName, job.JobStatus, liveStatus, updateErr)
 			errors++
 		} else {
 			log.Printf("reconciler: synced job %q %s->%s", job.WorkflowName, job.JobStatus, liveStatus)
-			synced++
-			// Notify the caller's webhook, terminal transitions only.
 			if meta.IsTerminalJobStatus(liveStatus) {
-				if hookURL := webhookURLFromMetadata(job.Metadata); hookURL != "" {
-					notifyWebhook(hookURL, job.WorkflowName, meta.NodeODMStatusCode(liveStatus))
-				}
+				RecordFinishedWorkflow(ctx, store, wfClient, job, wf)
 			}
+			// A terminal status queues the caller's webhook in the same
+			// update; see package webhook.
+			synced++
 		}
 	}
 
@@ -178,73 +188,170 @@ func syncActiveJobs(ctx context.Context, store *meta.Store, wfClient workflows.W
 	}
 }
 
-const (
-	webhookTimeout    = 5 * time.Second
-	webhookMaxRetries = 3
-)
+// syncJobProgress records a running job's stage and progress in its metadata,
+// where GET /task/{uuid}/info and the UI read them while the workflow is
+// unavailable. The ODM stage comes from the process log written since the
+// last cycle, so each cycle reads only the new lines.
+func syncJobProgress(ctx context.Context, store *meta.Store, wfClient workflows.WorkflowClient, job *meta.JobMetadata, wf *wfv1.Workflow) {
+	metadata := map[string]interface{}{}
+	if len(job.Metadata) > 0 {
+		_ = json.Unmarshal(job.Metadata, &metadata)
+	}
+	odmStage, _ := metadata[meta.MetadataODMStageKey].(string)
+	var since time.Time
+	if raw, ok := metadata[meta.MetadataODMStageCheckedAtKey].(string); ok {
+		since, _ = time.Parse(time.RFC3339, raw)
+	}
 
-// webhookURLFromMetadata extracts the caller's webhook URL from job metadata,
-// or "" when none was set.
-func webhookURLFromMetadata(raw json.RawMessage) string {
-	if len(raw) == 0 {
-		return ""
+	patch := map[string]interface{}{}
+	checkedAt := time.Now().UTC()
+	if stage, err := wfClient.ODMStage(ctx, job.WorkflowName, since); err != nil {
+		log.Printf("reconciler: failed to read ODM stage of %q: %v", job.WorkflowName, err)
+	} else {
+		if stage != "" && stage != odmStage {
+			odmStage = stage
+			patch[meta.MetadataODMStageKey] = stage
+		}
+		patch[meta.MetadataODMStageCheckedAtKey] = checkedAt.Format(time.RFC3339)
 	}
-	var m map[string]interface{}
-	if err := json.Unmarshal(raw, &m); err != nil {
-		return ""
+
+	progress, stage := workflows.WorkflowProgress(wf, odmStage)
+	if stored, _ := metadata[meta.MetadataProgressKey].(float64); stored != float64(progress) {
+		patch[meta.MetadataProgressKey] = progress
 	}
-	if v, ok := m[meta.MetadataWebhookKey].(string); ok {
-		return v
+	if stored, _ := metadata[meta.MetadataStageKey].(string); stored != stage {
+		patch[meta.MetadataStageKey] = stage
+	}
+	if err := store.MergeJobMetadata(ctx, job.WorkflowName, patch); err != nil {
+		log.Printf("reconciler: failed to record progress of %q: %v", job.WorkflowName, err)
 	}
-	return ""
 }
 
-// notifyWebhook POSTs {uuid, statusCode} to the caller's webhook, best-effort.
-// Fire-and-forget in a goroutine so a slow or unreachable receiver never stalls
-// the reconcile loop.
-func notifyWebhook(hookURL, uuid string, statusCode int) {
-	payload, err := json.Marshal(map[string]interface{}{
-		"uuid":       uuid,
-		"statusCode": statusCode,
-	})
+// RecordFinishedWorkflow captures what a finished workflow tells about its
+// task: the timing and resources of its stage runs, and the peak usage of
+// its ODM run for learned sizing. Whichever of the reconciler,
+// GET /task/{uuid}/info and the UI syncs a task's terminal status calls it,
+// since the others then no longer see the task as active.
+func RecordFinishedWorkflow(ctx context.Context, store *meta.Store, wfClient workflows.WorkflowClient, job *meta.JobMetadata, wf *wfv1.Workflow) {
+	recordStageRuns(ctx, store, wf)
+	recordResourceObservation(ctx, store, wfClient, job, wf)
+}
+
+// recordStageRuns stores the timing and resources of a finished workflow's
+// stage runs (see workflows.StageRuns) and records the new ones in the stage
+// metrics.
+func recordStageRuns(ctx context.Context, store *meta.Store, wf *wfv1.Workflow) {
+	var runs []meta.StageRun
+	for _, run := range workflows.StageRuns(wf) {
+		stored := meta.StageRun{
+			NodeID:             run.NodeID,
+			Stage:              run.Stage,
+			Phase:              run.Phase,
+			StartedAt:          run.StartedAt,
+			HostNode:           run.HostNode,
+			CapacityType:       run.CapacityType,
+			CPURequestMillis:   run.CPURequestMillis,
+			MemoryRequestBytes: run.MemoryRequestBytes,
+		}
+		if !run.FinishedAt.IsZero() {
+			finishedAt := run.FinishedAt
+			stored.FinishedAt = &finishedAt
+		}
+		runs = append(runs, stored)
+	}
+	recorded, err := store.RecordStageRuns(ctx, wf.Name, runs)
 	if err != nil {
-		log.Printf("reconciler: webhook marshal failed for %q: %v", uuid, err)
+		log.Printf("reconciler: failed to record stage runs of %q: %v", wf.Name, err)
 		return
 	}
+	for _, run := range recorded {
+		if run.FinishedAt == nil {
+			continue
+		}
+		observability.RecordStageRun(run.Stage, run.Phase, run.CapacityType, run.FinishedAt.Sub(run.StartedAt), run.CPURequestMillis, run.MemoryRequestBytes)
+	}
+}
 
-	go func() {
-		for attempt := 1; attempt <= webhookMaxRetries; attempt++ {
-			// Detached from the loop context so a tick or shutdown can't abort
-			// a delivery mid-flight.
-			reqCtx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
-			req, reqErr := http.NewRequestWithContext(reqCtx, http.MethodPost, hookURL, bytes.NewReader(payload))
-			if reqErr != nil {
-				cancel()
-				log.Printf("reconciler: webhook request build failed for %q: %v", uuid, reqErr)
-				return
-			}
-			req.Header.Set("Content-Type", "application/json")
+// recordResourceObservation stores the peak usage the process container of
+// a succeeded single-pod ODM run reported (see workflows.ProcessUsage), for
+// the estimator to learn the memory and workspace curves from.
+func recordResourceObservation(ctx context.Context, store *meta.Store, wfClient workflows.WorkflowClient, job *meta.JobMetadata, wf *wfv1.Workflow) {
+	obs, ok := observedTask(job, wf)
+	if !ok {
+		return
+	}
+	usage, err := wfClient.ProcessUsage(ctx, wf.Name)
+	if err != nil {
+		log.Printf("reconciler: failed to read process usage of %q: %v", wf.Name, err)
+		return
+	}
+	obs, ok = withProcessUsage(obs, usage)
+	if !ok {
+		return
+	}
+	if _, err := store.RecordResourceObservation(ctx, obs); err != nil {
+		log.Printf("reconciler: failed to record resource observation of %q: %v", wf.Name, err)
+	}
+}
 
-			resp, doErr := http.DefaultClient.Do(req)
-			if doErr == nil {
-				_ = resp.Body.Close()
-				cancel()
-				if resp.StatusCode < 400 {
-					log.Printf("reconciler: webhook delivered uuid=%q code=%d http=%d", uuid, statusCode, resp.StatusCode)
-					return
-				}
-				log.Printf("reconciler: webhook attempt %d for %q returned HTTP %d", attempt, uuid, resp.StatusCode)
-			} else {
-				cancel()
-				log.Printf("reconciler: webhook attempt %d for %q failed: %v", attempt, uuid, doErr)
-			}
+// withProcessUsage adds the peaks a run reported to obs. A run that reported
+// none, or that resumed ODM part way through (a checkpoint restored on retry
+// or restart), is not an observation of the whole task.
+func withProcessUsage(obs meta.ResourceObservation, usage *workflows.ProcessUsage) (meta.ResourceObservation, bool) {
+	if usage == nil || usage.Resumed {
+		return obs, false
+	}
+	obs.PeakMemoryBytes = usage.PeakMemoryBytes
+	obs.PeakAnonBytes = usage.PeakAnonBytes
+	obs.PeakSwapBytes = usage.PeakSwapBytes
+	obs.WorkspacePeakBytes = usage.WorkspacePeakBytes
+	return obs, true
+}
 
-			if attempt < webhookMaxRetries {
-				time.Sleep(time.Duration(attempt) * time.Second)
-			}
+// observedTask fills an observation with the size and flags of a task whose
+// run the estimator can learn from: a succeeded standard or thermal task of
+// known image count, whose ODM ran whole in one pod. Split-merge, merge and
+// city-scale tasks are sized differently and are left out, as are reruns
+// (rerun_from), which run only ODM's later stages.
+func observedTask(job *meta.JobMetadata, wf *wfv1.Workflow) (meta.ResourceObservation, bool) {
+	if job == nil || wf.Status.Phase != wfv1.WorkflowSucceeded {
+		return meta.ResourceObservation{}, false
+	}
+	if job.JobType != "" && job.JobType != meta.JobTypeStandard {
+		return meta.ResourceObservation{}, false
+	}
+	var sizing struct {
+		ImageCount      int    `json:"image_count"`
+		ImageTotalBytes int64  `json:"image_total_bytes"`
+		ProcessingMode  string `json:"processing_mode"`
+		RerunFrom       string `json:"rerun_from"`
+	}
+	if len(job.Metadata) > 0 {
+		if err := json.Unmarshal(job.Metadata, &sizing); err != nil {
+			return meta.ResourceObservation{}, false
 		}
-		log.Printf("reconciler: webhook giving up for %q after %d attempts", uuid, webhookMaxRetries)
-	}()
+	}
+	switch sizing.ProcessingMode {
+	case "", workflows.ProcessingModeStandard, workflows.ProcessingModeThermal:
+	default:
+		return meta.ResourceObservation{}, false
+	}
+	if sizing.ImageCount <= 0 || sizing.RerunFrom != "" {
+		return meta.ResourceObservation{}, false
+	}
+	var flags []string
+	if len(job.ODMFlags) > 0 {
+		if err := json.Unmarshal(job.ODMFlags, &flags); err != nil {
+			return meta.ResourceObservation{}, false
+		}
+	}
+	return meta.ResourceObservation{
+		WorkflowName:    job.WorkflowName,
+		Profile:         workflows.WorkloadProfile(flags),
+		ImageCount:      sizing.ImageCount,
+		ImageTotalBytes: sizing.ImageTotalBytes,
+		ODMFlags:        flags,
+	}, true
 }
 
 // failedNode is the slimmed-down representation of an Argo node we persist to
@@ -9,6 +9,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/hotosm/scaleodm/app/meta"
+	"github.com/hotosm/scaleodm/app/workflows"
 )
 
 func TestBuildFailureDetails_ExtractsFailedPodNodes(t *testing.T) {
@@ -92,3 +95,63 @@ func TestBuildFailureDetails_NilWorkflow(t *testing.T) {
 	require.NoError(t, err)
 	assert.Nil(t, raw)
 }
+
+func TestObservedTask(t *testing.T) {
+	succeeded := &wfv1.Workflow{Status: wfv1.WorkflowStatus{Phase: wfv1.WorkflowSucceeded}}
+	job := &meta.JobMetadata{
+		WorkflowName: "wf-1",
+		JobType:      meta.JobTypeStandard,
+		ODMFlags:     json.RawMessage(`["--dsm","--pc-quality=high"]`),
+		Metadata:     json.RawMessage(`{"image_count":640,"image_total_bytes":6710886400,"processing_mode":"standard"}`),
+	}
+
+	obs, ok := observedTask(job, succeeded)
+	require.True(t, ok)
+	assert.Equal(t, meta.ResourceObservation{
+		WorkflowName:    "wf-1",
+		Profile:         "dsm-dtm",
+		ImageCount:      640,
+		ImageTotalBytes: 6710886400,
+		ODMFlags:        []string{"--dsm", "--pc-quality=high"},
+	}, obs)
+
+	failed := &wfv1.Workflow{Status: wfv1.WorkflowStatus{Phase: wfv1.WorkflowFailed}}
+	_, ok = observedTask(job, failed)
+	assert.False(t, ok, "only succeeded runs report usage")
+
+	splitMerge := *job
+	splitMerge.JobType = meta.JobTypeSplitMerge
+	_, ok = observedTask(&splitMerge, succeeded)
+	assert.False(t, ok)
+
+	cityScale := *job
+	cityScale.Metadata = json.RawMessage(`{"image_count":640,"processing_mode":"city-scale"}`)
+	_, ok = observedTask(&cityScale, succeeded)
+	assert.False(t, ok)
+
+	uncounted := *job
+	uncounted.Metadata = json.RawMessage(`{"processing_mode":"thermal"}`)
+	_, ok = observedTask(&uncounted, succeeded)
+	assert.False(t, ok, "image count unknown")
+
+	rerun := *job
+	rerun.Metadata = json.RawMessage(`{"image_count":640,"processing_mode":"standard","rerun_from":"openmvs"}`)
+	_, ok = observedTask(&rerun, succeeded)
+	assert.False(t, ok, "a rerun runs only ODM's later stages")
+}
+
+func TestWithProcessUsage(t *testing.T) {
+	obs := meta.ResourceObservation{WorkflowName: "wf-1", ImageCount: 640}
+
+	got, ok := withProcessUsage(obs, &workflows.ProcessUsage{PeakMemoryBytes: 100, PeakAnonBytes: 80, WorkspacePeakBytes: 1000})
+	require.True(t, ok)
+	assert.Equal(t, int64(100), got.PeakMemoryBytes)
+	assert.Equal(t, int64(80), got.PeakAnonBytes)
+	assert.Equal(t, int64(1000), got.WorkspacePeakBytes)
+
+	_, ok = withProcessUsage(obs, nil)
+	assert.False(t, ok, "no usage reported")
+
+	_, ok = withProcessUsage(obs, &workflows.ProcessUsage{PeakMemoryBytes: 100, Resumed: true})
+	assert.False(t, ok, "a resumed run covers only the stages after its checkpoint")
+}
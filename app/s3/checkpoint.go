@@ -0,0 +1,181 @@
+package s3
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Checkpoint scripts for the single-pod pipeline; see
+// workflows/checkpoint.go. The process stage and the checkpoint stage talk
+// through files in CheckpointStateDir of the task's workspace directory:
+//
+//   - resume-from: the ODM stage a restored checkpoint resumes at, written
+//     by the restore at the end of the download stage.
+//   - stage: "<completed> <next>", rewritten by the process stage each time
+//     ODM starts a stage.
+//   - process-exit: the exit code of the process stage.
+//   - heartbeat: the time, in Unix seconds, the process stage last showed
+//     it was alive. A kill that skips the exit trap (an OOM kill of the
+//     whole container) leaves no process-exit; the heartbeat going stale is
+//     then what tells the checkpoint stage to stop.
+//
+// In S3 a checkpoint is the project directory, without its images, under
+// project/, and checkpoint.txt: the stage to resume at, the fingerprint of
+// the ODM options the project was made with, the stage last completed and
+// the workspace directory the project was in. checkpoint.txt is written only
+// once project/ is in place.
+
+// CheckpointStateDir holds the checkpoint state files inside the task's
+// workspace directory. The upload stage skips it.
+const CheckpointStateDir = ".scaleodm"
+
+// CheckpointHeartbeatSeconds is how often the process stage of a
+// checkpointed task refreshes its heartbeat file.
+const CheckpointHeartbeatSeconds = 10
+
+// checkpointHeartbeatTimeout is how long, in seconds, the checkpoint stage
+// waits on a heartbeat that has stopped before taking the process stage for
+// dead.
+const checkpointHeartbeatTimeout = 120
+
+// checkpointMarker names the checkpoint's marker object.
+const checkpointMarker = "checkpoint.txt"
+
+// checkpointExcludes are not checkpointed: the download stage fetches the
+// imagery again, and the rclone config and state are per attempt.
+var checkpointExcludes = []string{"images/**", ".rclone/**", CheckpointStateDir + "/**"}
+
+// CheckpointPath is where a task's ODM project is checkpointed: the
+// checkpoints/ prefix of its write path, which a restarted task keeps.
+func CheckpointPath(writeS3Path string) string {
+	return strings.TrimSuffix(writeS3Path, "/") + "/checkpoints/"
+}
+
+// rcloneRemote converts an s3:// path to the rclone remote the scripts use.
+func rcloneRemote(path string) string {
+	return `$(echo "` + strings.TrimSuffix(path, "/") + `" | sed 's|^s3://|s3:|')`
+}
+
+// projectScriptPreamble sets up rclone and the paths of the task's project
+// that the checkpoint and rerun scripts share. rebase_project points a
+// restored project made in the workspace directory $1 at this one: ODM
+// keeps absolute paths in a few of its text files (OpenSfM's
+// image_list.txt among them), and a restarted task runs under a new
+// workflow name.
+func projectScriptPreamble() string {
+	return `JOB_ID="{{workflow.name}}"
+SRC_DIR="/workspace/$JOB_ID"
+STATE_DIR="$SRC_DIR/` + CheckpointStateDir + `"
+RCLONE_DIR="$SRC_DIR/.rclone"
+mkdir -p "$RCLONE_DIR" "$STATE_DIR"
+export RCLONE_CONFIG="$RCLONE_DIR/rclone.conf"
+
+` + rcloneS3ConfigSnippet() + `
+
+rebase_project() {
+  [ -n "$1" ] && [ "$1" != "$SRC_DIR" ] || return 0
+  echo "Rewriting project paths from $1..."
+  find "$SRC_DIR" -type f \( -name '*.txt' -o -name '*.json' \) -size -51200k -exec grep -lF "$1" {} + 2>/dev/null |
+    while IFS= read -r f; do sed -i "s|$1|$SRC_DIR|g" "$f"; done || true
+}
+`
+}
+
+// checkpointScriptPreamble is projectScriptPreamble with the checkpoint's
+// remote.
+func checkpointScriptPreamble(checkpointPath string) string {
+	return projectScriptPreamble() + `CHECKPOINT_REMOTE=` + rcloneRemote(checkpointPath) + `
+`
+}
+
+// GenerateCheckpointRestoreScript is appended to the download stage. A
+// retried attempt, or the first attempt of a restarted task when resume is
+// set, restores the checkpoint under checkpointPath if it was made with the
+// same ODM options (fingerprint) and records the stage it resumes at. The
+// first attempt of a new task removes any checkpoint left at the path
+// instead, so it cannot be mistaken for its own.
+func GenerateCheckpointRestoreScript(checkpointPath, fingerprint string, resume bool) string {
+	resumeFlag := "false"
+	if resume {
+		resumeFlag = "true"
+	}
+	return `
+echo "Checking for an ODM checkpoint..."
+` + checkpointScriptPreamble(checkpointPath) + `
+rm -f "$STATE_DIR/resume-from" "$STATE_DIR/stage" "$STATE_DIR/process-exit" "$STATE_DIR/heartbeat"
+if [ "{{retries}}" = "0" ] && [ "` + resumeFlag + `" != "true" ]; then
+  rclone purge "$CHECKPOINT_REMOTE" >/dev/null 2>&1 || true
+  echo "New task: no checkpoint to restore."
+elif MARKER=$(rclone cat "$CHECKPOINT_REMOTE/` + checkpointMarker + `" 2>/dev/null) && [ -n "$MARKER" ]; then
+  RESUME_FROM=$(echo "$MARKER" | sed -n 1p)
+  FINGERPRINT=$(echo "$MARKER" | sed -n 2p)
+  if [ "$FINGERPRINT" != "` + fingerprint + `" ]; then
+    echo "Checkpoint was made with other ODM options; processing from the start."
+  else
+    echo "Restoring checkpoint to resume at $RESUME_FROM..."
+    rclone copy "$CHECKPOINT_REMOTE/project" "$SRC_DIR"
+    rebase_project "$(echo "$MARKER" | sed -n 4p)"
+    echo "$RESUME_FROM" > "$STATE_DIR/resume-from"
+  fi
+else
+  echo "No checkpoint found; processing from the start."
+fi
+`
+}
+
+// GenerateCheckpointScript runs beside the process stage. Each time ODM
+// completes one of stages, it syncs the project to checkpointPath and then
+// rewrites the marker. It exits when the process stage does, or when the
+// process stage's heartbeat stops, and never fails the task: a checkpoint
+// that cannot be written only costs a resume.
+func GenerateCheckpointScript(checkpointPath, fingerprint string, stages []string) string {
+	return `set -u
+echo "=== checkpoint attempt {{retries}} @ $(date -u +%Y-%m-%dT%H:%M:%SZ) ==="
+` + checkpointScriptPreamble(checkpointPath) + `
+CHECKPOINT_STAGES=" ` + strings.Join(stages, " ") + ` "
+echo "Checkpointing after: $CHECKPOINT_STAGES"
+
+checkpoint() {
+  echo "ODM completed $1; checkpointing to resume at $2..."
+  if rclone sync "$SRC_DIR" "$CHECKPOINT_REMOTE/project"` + renderRcloneExcludeFlags(checkpointExcludes) + `; then
+    printf '%s\n%s\n%s\n%s\n' "$2" "` + fingerprint + `" "$1" "$SRC_DIR" | rclone rcat "$CHECKPOINT_REMOTE/` + checkpointMarker + `" &&
+      echo "Checkpoint after $1 saved." && return
+  fi
+  echo "Warning: checkpoint after $1 failed (non-fatal)."
+}
+
+START=$(date +%s)
+LAST=""
+while :; do
+  EXIT_CODE=$(cat "$STATE_DIR/process-exit" 2>/dev/null || true)
+  if [ "$EXIT_CODE" = "0" ]; then
+    break
+  fi
+  BOUNDARY=$(cat "$STATE_DIR/stage" 2>/dev/null || true)
+  if [ -n "$BOUNDARY" ] && [ "$BOUNDARY" != "$LAST" ]; then
+    LAST=$BOUNDARY
+    case "$CHECKPOINT_STAGES" in
+      *" ${BOUNDARY%% *} "*) checkpoint "${BOUNDARY%% *}" "${BOUNDARY#* }" ;;
+    esac
+  fi
+  if [ -n "$EXIT_CODE" ]; then
+    break
+  fi
+  HEARTBEAT=$(cat "$STATE_DIR/heartbeat" 2>/dev/null || true)
+  if [ $(( $(date +%s) - ${HEARTBEAT:-$START} )) -gt ` + strconv.Itoa(checkpointHeartbeatTimeout) + ` ]; then
+    echo "Process stage stopped without finishing (no heartbeat for ` + strconv.Itoa(checkpointHeartbeatTimeout) + `s); checkpointing done."
+    exit 0
+  fi
+  sleep 15
+done
+echo "Process stage finished; checkpointing done."`
+}
+
+// GenerateCheckpointPurgeScript removes the checkpoint once the upload stage
+// has copied the task's outputs.
+func GenerateCheckpointPurgeScript(checkpointPath string) string {
+	return `
+CHECKPOINT_REMOTE=` + rcloneRemote(checkpointPath) + `
+echo "Removing ODM checkpoint..."
+rclone purge "$CHECKPOINT_REMOTE" >/dev/null 2>&1 || true`
+}
@@ -2,6 +2,7 @@ package s3
 
 import (
 	"fmt"
+	"path"
 	"strings"
 )
 
@@ -12,9 +13,17 @@ import (
 // image-count filters, regardless of user settings or useDefaultExcludes.
 // They protect ScaleODM's own output directories from being re-ingested on a
 // rerun, and match the paths the upload script writes into the write S3 path.
-var alwaysExcludePatterns = []string{
+var alwaysExcludePatterns = append([]string{
 	"output/**", "**/output/**",
 	"odm/**", "**/odm/**",
+}, savedProjectExcludePatterns...)
+
+// savedProjectExcludePatterns match the ODM projects kept under a write path
+// for resuming (see CheckpointPath and IntermediatesPath), whose undistorted
+// images and products must not pass for imagery or task outputs.
+var savedProjectExcludePatterns = []string{
+	"checkpoints/**", "**/checkpoints/**",
+	"intermediates/**", "**/intermediates/**",
 }
 
 // imageIncludePatterns is the canonical rclone filter list for input imagery
@@ -37,12 +46,74 @@ var imageIncludePatterns = []string{
 	"*.TAR",
 }
 
+// imageExtensions are the input image types the download stage keeps.
+var imageExtensions = []string{"jpg", "jpeg", "tiff", "tif"}
+
+// thermalImageExtensions adds the radiometric JPEG extension some FLIR tools
+// export. DJI and most FLIR cameras write radiometric JPEGs as plain .jpg.
+var thermalImageExtensions = append(append([]string{}, imageExtensions...), "rjpg", "rjpeg")
+
+// thermalIncludePatterns is imageIncludePatterns for the thermal download.
+var thermalIncludePatterns = append(append([]string{}, imageIncludePatterns...),
+	"*.rjpg", "*.rjpeg", "*.RJPG", "*.RJPEG")
+
+// ThermalManifestName lists, one file name per line, the images the thermal
+// download found to carry radiometric data. It sits in the task's workspace
+// directory, next to images/.
+const ThermalManifestName = "thermal_images.txt"
+
+// Sidecar files ODM reads from the project alongside the imagery: ground
+// control points, image geolocation, split groups and camera calibration.
+const (
+	GCPFileName         = "gcp_list.txt"
+	GeoFileName         = "geo.txt"
+	ImageGroupsFileName = "image_groups.txt"
+	CamerasFileName     = "cameras.json"
+)
+
+// ODMSidecarFiles are the sidecar files the download stage keeps. They may sit
+// at any depth beneath the read path, but each at most once, and are moved to
+// the task's workspace directory, next to images/, where ODM looks for them.
+// cameras.json is the one ODM does not pick up itself; the process stage
+// passes it with --cameras.
+var ODMSidecarFiles = []string{GCPFileName, GeoFileName, ImageGroupsFileName, CamerasFileName}
+
+// cityScaleIncludePatterns is imageIncludePatterns without the archives:
+// extracting an archive would lose the directory that names its task.
+var cityScaleIncludePatterns = []string{
+	"*.jpg",
+	"*.jpeg",
+	"*.JPG",
+	"*.JPEG",
+	"*.tiff",
+	"*.tif",
+	"*.TIFF",
+	"*.TIF",
+}
+
+// CityScaleTasksDir holds one ODM project per city-scale task, each with its
+// own images/ directory, inside the job's workspace directory.
+const CityScaleTasksDir = "tasks"
+
+// MergeProductPaths are the per-task ODM products the merge-existing mode
+// mosaics, relative to a task's output directory.
+var MergeProductPaths = []string{
+	"odm_orthophoto/odm_orthophoto.tif",
+	"odm_dem/dsm.tif",
+	"odm_dem/dtm.tif",
+	"odm_georeferencing/odm_georeferenced_model.laz",
+}
+
 // We don't exclude other OpenSfM intermediates, but the undistorted images are
 // a full-resolution duplicate of every input photo, so we focus on that for now.
+// Split-merge submodels are intermediates too: their products are merged into
+// the top-level outputs.
 var uploadExcludePatterns = []string{
 	".rclone/**",
+	CheckpointStateDir + "/**",
 	"opensfm/undistorted/**",
 	"**/opensfm/undistorted/**",
+	"submodels/**",
 }
 
 func renderRcloneExcludeFlags(excludePatterns []string) string {
@@ -64,13 +135,17 @@ func renderRcloneExcludeFlags(excludePatterns []string) string {
 // below), then includes for image/archive extensions, then a final catch-all
 // that drops everything else.
 func renderRcloneFilterFile(excludePatterns []string) string {
+	return renderRcloneFilterFileWithIncludes(excludePatterns, imageIncludePatterns)
+}
+
+func renderRcloneFilterFileWithIncludes(excludePatterns, includePatterns []string) string {
 	var b strings.Builder
 	for _, p := range excludePatterns {
 		b.WriteString("- ")
 		b.WriteString(p)
 		b.WriteString("\n")
 	}
-	for _, p := range imageIncludePatterns {
+	for _, p := range includePatterns {
 		b.WriteString("+ ")
 		b.WriteString(p)
 		b.WriteString("\n")
@@ -119,10 +194,26 @@ fi`
 // `--max-depth N`; values <= 0 mean "no limit" so callers wanting an
 // unbounded scan can opt in explicitly.
 func GenerateDownloadScript(jobID, srcPath string, excludePatterns []string, maxDepth int) string {
+	return generateImageDownloadScript(jobID, srcPath, excludePatterns, maxDepth, imageIncludePatterns, imageExtensions)
+}
+
+// findNameExpr renders a find(1) test matching any of the extensions,
+// case-insensitively.
+func findNameExpr(extensions []string) string {
+	terms := make([]string, len(extensions))
+	for i, ext := range extensions {
+		terms[i] = fmt.Sprintf(`-iname "*.%s"`, ext)
+	}
+	return strings.Join(terms, " -o ")
+}
+
+func generateImageDownloadScript(jobID, srcPath string, excludePatterns []string, maxDepth int, includePatterns, extensions []string) string {
 	patterns := make([]string, 0, len(alwaysExcludePatterns)+len(excludePatterns))
 	patterns = append(patterns, alwaysExcludePatterns...)
 	patterns = append(patterns, excludePatterns...)
-	filterFileContents := renderRcloneFilterFile(patterns)
+	includes := append(append([]string{}, includePatterns...), ODMSidecarFiles...)
+	filterFileContents := renderRcloneFilterFileWithIncludes(patterns, includes)
+	imageExpr := findNameExpr(extensions)
 
 	maxDepthFlag := ""
 	if maxDepth > 0 {
@@ -237,10 +328,23 @@ EOF
 echo "Extracting archives..."
 extract_and_clean "$DEST_DIR"
 
+echo "Keeping ODM sidecar files..."
+for sidecar in ` + strings.Join(ODMSidecarFiles, " ") + `; do
+  found=$(find "$DEST_DIR" -type f -name "$sidecar" ! -path "*/output/*" ! -path "*/odm/*")
+  [ -z "$found" ] && continue
+  if [ "$(echo "$found" | wc -l)" -gt 1 ]; then
+    echo "ERROR: found more than one $sidecar under $SRC_PATH:" >&2
+    echo "$found" >&2
+    exit 1
+  fi
+  mv "$found" "/workspace/$JOB_ID/$sidecar"
+  echo "Kept $sidecar from ${found#"$DEST_DIR"/}"
+done
+
 echo "Cleaning up non-image files..."
 # Delete non-image files, but skip anything in output/odm directories
 find "$DEST_DIR" -type f ! \( \
-  -iname "*.jpg" -o -iname "*.jpeg" -o -iname "*.tiff" -o -iname "*.tif" \
+  ` + imageExpr + ` \
 \) ! -path "*/output/*" ! -path "*/odm/*" -delete
 
 # Remove empty directories, but skip output/odm directories entirely
@@ -251,7 +355,7 @@ FLAT_DIR="$DEST_DIR"
 TEMP_LIST="$DEST_DIR/.flatten-list.txt"
 
 # Find image files, excluding any in output/odm directories
-find "$DEST_DIR" -type f \( -iname "*.jpg" -o -iname "*.jpeg" -o -iname "*.tiff" -o -iname "*.tif" \) \
+find "$DEST_DIR" -type f \( ` + imageExpr + ` \) \
   ! -path "*/output/*" ! -path "*/odm/*" > "$TEMP_LIST"
 
 while IFS= read -r imgfile; do
@@ -280,7 +384,288 @@ find "$DEST_DIR" -type d -empty -delete
 
 echo "Download and extraction complete. Image files in $DEST_DIR:"
 find "$DEST_DIR" -type f | wc -l | xargs echo "Total image files:"
-find "$DEST_DIR" -type f \( -iname "*.jpg" -o -iname "*.jpeg" -o -iname "*.tiff" -o -iname "*.tif" \) | awk 'NR<=10'`
+find "$DEST_DIR" -type f \( ` + imageExpr + ` \) | awk 'NR<=10'`
+}
+
+// GenerateThermalDownloadScript is GenerateDownloadScript for thermal tasks.
+// It also keeps radiometric .rjpg files, then sorts the images:
+//
+//   - JPEGs with radiometric data - a FLIR record, or DJI's infrared
+//     ImageSource - are listed in ThermalManifestName for the thermal stage
+//     to convert to temperatures;
+//   - TIFFs are assumed to be calibrated already and are kept as they are;
+//   - the remaining JPEGs are visible-light frames from dual-sensor cameras
+//     (e.g. DJI's _W/_V/_Z shots). They would be reconstructed as a
+//     different camera, so they are removed.
+//
+// The task fails when no thermal imagery is left.
+func GenerateThermalDownloadScript(jobID, srcPath string, excludePatterns []string, maxDepth int) string {
+	return generateImageDownloadScript(jobID, srcPath, excludePatterns, maxDepth, thermalIncludePatterns, thermalImageExtensions) + `
+
+echo "Detecting thermal imagery..."
+THERMAL_MANIFEST="/workspace/$JOB_ID/` + ThermalManifestName + `"
+VISIBLE_LIST="/workspace/$JOB_ID/.visible-list.txt"
+: > "$THERMAL_MANIFEST"
+: > "$VISIBLE_LIST"
+RADIOMETRIC=0
+CALIBRATED=0
+VISIBLE=0
+
+for imgfile in "$DEST_DIR"/*; do
+  [ -f "$imgfile" ] || continue
+  case "$imgfile" in
+    *.[rR][jJ][pP][gG]|*.[rR][jJ][pP][eE][gG])
+      # ODM only reads .jpg/.jpeg; these are always radiometric.
+      dest="${imgfile%.*}.jpg"
+      [ -e "$dest" ] && dest="${imgfile%.*}_rjpg.jpg"
+      mv "$imgfile" "$dest"
+      basename "$dest" >> "$THERMAL_MANIFEST"
+      RADIOMETRIC=$((RADIOMETRIC + 1))
+      ;;
+    *.[tT][iI][fF]|*.[tT][iI][fF][fF])
+      CALIBRATED=$((CALIBRATED + 1))
+      ;;
+    *)
+      if grep -q -F 'ImageSource="InfraredCamera"' "$imgfile" || \
+        { grep -q -F "FLIR" "$imgfile" && grep -q -F "FFF" "$imgfile"; }; then
+        basename "$imgfile" >> "$THERMAL_MANIFEST"
+        RADIOMETRIC=$((RADIOMETRIC + 1))
+      else
+        echo "$imgfile" >> "$VISIBLE_LIST"
+        VISIBLE=$((VISIBLE + 1))
+      fi
+      ;;
+  esac
+done
+
+echo "Radiometric JPEGs: $RADIOMETRIC, calibrated TIFFs: $CALIBRATED, visible JPEGs: $VISIBLE"
+if [ "$RADIOMETRIC" -eq 0 ] && [ "$CALIBRATED" -eq 0 ]; then
+  echo "ERROR: no thermal imagery found under $SRC_PATH"
+  exit 1
+fi
+while IFS= read -r imgfile; do
+  [ -z "$imgfile" ] && continue
+  echo "Skipping visible-light image: $(basename "$imgfile")"
+  rm -f "$imgfile"
+done < "$VISIBLE_LIST"
+rm -f "$VISIBLE_LIST"`
+}
+
+// renderMergeFilterFile builds the --filter-from file for the merge-existing
+// download: excludes first, then the product files, then a catch-all drop.
+// Product patterns are unanchored, so they match at any depth beneath the
+// read path.
+func renderMergeFilterFile(excludePatterns []string) string {
+	var b strings.Builder
+	for _, p := range excludePatterns {
+		b.WriteString("- ")
+		b.WriteString(p)
+		b.WriteString("\n")
+	}
+	for _, p := range MergeProductPaths {
+		b.WriteString("+ ")
+		b.WriteString(p)
+		b.WriteString("\n")
+	}
+	b.WriteString("- *\n")
+	return b.String()
+}
+
+// mergeWriteExclude returns an anchored rclone exclude for writeS3Path when it
+// lives beneath readS3Path, so a rerun never merges its own previous output.
+func mergeWriteExclude(readS3Path, writeS3Path string) string {
+	readBucket, readPrefix, err := parseS3Path(readS3Path)
+	if err != nil {
+		return ""
+	}
+	writeBucket, writePrefix, err := parseS3Path(writeS3Path)
+	if err != nil || writeBucket != readBucket {
+		return ""
+	}
+	if writePrefix == readPrefix || !strings.HasPrefix(writePrefix, readPrefix) {
+		return ""
+	}
+	return "/" + strings.TrimPrefix(writePrefix, readPrefix) + "**"
+}
+
+// GenerateMergeInputsDownloadScript downloads the products of previously
+// completed tasks under srcPath for the merge-existing mode. Unlike
+// GenerateDownloadScript it keeps the directory structure - each task's
+// products land in their own subdirectory of /workspace/$JOB_ID/merge_inputs -
+// and skips the built-in output excludes, since task outputs normally live in
+// "output/" dirs. writePath is excluded when it is nested under srcPath.
+func GenerateMergeInputsDownloadScript(jobID, srcPath, writePath string, excludePatterns []string, maxDepth int) string {
+	patterns := make([]string, 0, len(savedProjectExcludePatterns)+len(excludePatterns)+1)
+	patterns = append(patterns, savedProjectExcludePatterns...)
+	patterns = append(patterns, excludePatterns...)
+	if exclude := mergeWriteExclude(srcPath, writePath); exclude != "" {
+		patterns = append(patterns, exclude)
+	}
+	filterFileContents := renderMergeFilterFile(patterns)
+
+	maxDepthFlag := ""
+	if maxDepth > 0 {
+		maxDepthFlag = fmt.Sprintf(" --max-depth %d", maxDepth)
+	}
+
+	return `set -e
+set -o pipefail
+echo "Downloading task outputs to merge from S3..."
+JOB_ID="` + jobID + `"
+SRC_PATH="` + srcPath + `"
+DEST_DIR="/workspace/$JOB_ID/merge_inputs"
+
+echo "Job ID: $JOB_ID"
+echo "Source: $SRC_PATH"
+echo "Destination: $DEST_DIR"
+mkdir -p "$DEST_DIR"
+
+RCLONE_DIR="/workspace/$JOB_ID/.rclone"
+mkdir -p "$RCLONE_DIR"
+export RCLONE_CONFIG="$RCLONE_DIR/rclone.conf"
+
+` + rcloneS3ConfigSnippet() + `
+
+if echo "$SRC_PATH" | grep -q "^s3://"; then
+  S3_REMOTE=$(echo "$SRC_PATH" | sed 's|^s3://|s3:|')
+else
+  S3_REMOTE="$SRC_PATH"
+fi
+
+FILTER_FILE="$RCLONE_DIR/filters.txt"
+cat > "$FILTER_FILE" <<'RCLONE_FILTER_EOF'
+` + filterFileContents + `RCLONE_FILTER_EOF
+
+echo "Filter file contents:"
+cat "$FILTER_FILE"
+rclone copy "$S3_REMOTE" "$DEST_DIR" --filter-from "$FILTER_FILE"` + maxDepthFlag + `
+
+echo "Downloaded task products:"
+find "$DEST_DIR" -type f | sort`
+}
+
+// GenerateCityScaleDownloadScript downloads the imagery of a city-scale task.
+// Unlike GenerateDownloadScript it does not flatten: every directory holding
+// images becomes a task of its own (see CityScaleTaskName), with its images
+// moved to /workspace/$JOB_ID/tasks/<task>/images. Archives are not
+// supported.
+func GenerateCityScaleDownloadScript(jobID, srcPath string, excludePatterns []string, maxDepth int) string {
+	patterns := make([]string, 0, len(alwaysExcludePatterns)+len(excludePatterns))
+	patterns = append(patterns, alwaysExcludePatterns...)
+	patterns = append(patterns, excludePatterns...)
+	filterFileContents := renderRcloneFilterFileWithIncludes(patterns, cityScaleIncludePatterns)
+
+	maxDepthFlag := ""
+	if maxDepth > 0 {
+		maxDepthFlag = fmt.Sprintf(" --max-depth %d", maxDepth)
+	}
+
+	return `set -e
+set -o pipefail
+echo "Downloading city-scale imagery from S3..."
+JOB_ID="` + jobID + `"
+SRC_PATH="` + srcPath + `"
+RAW_DIR="/workspace/$JOB_ID/raw"
+TASKS_DIR="/workspace/$JOB_ID/` + CityScaleTasksDir + `"
+
+echo "Job ID: $JOB_ID"
+echo "Source: $SRC_PATH"
+echo "Destination: $TASKS_DIR"
+mkdir -p "$RAW_DIR" "$TASKS_DIR"
+
+RCLONE_DIR="/workspace/$JOB_ID/.rclone"
+mkdir -p "$RCLONE_DIR"
+export RCLONE_CONFIG="$RCLONE_DIR/rclone.conf"
+
+` + rcloneS3ConfigSnippet() + `
+
+if echo "$SRC_PATH" | grep -q "^s3://"; then
+  S3_REMOTE=$(echo "$SRC_PATH" | sed 's|^s3://|s3:|')
+else
+  S3_REMOTE="$SRC_PATH"
+fi
+
+FILTER_FILE="$RCLONE_DIR/filters.txt"
+cat > "$FILTER_FILE" <<'RCLONE_FILTER_EOF'
+` + filterFileContents + `RCLONE_FILTER_EOF
+
+echo "Filter file contents:"
+cat "$FILTER_FILE"
+rclone copy "$S3_REMOTE" "$RAW_DIR" --filter-from "$FILTER_FILE"` + maxDepthFlag + `
+
+echo "Sorting imagery into tasks..."
+TEMP_LIST="$RCLONE_DIR/tasks-list.txt"
+find "$RAW_DIR" -type f \( ` + findNameExpr(imageExtensions) + ` \) | sort > "$TEMP_LIST"
+while IFS= read -r imgfile; do
+  rel="${imgfile#$RAW_DIR/}"
+  dir=$(dirname "$rel")
+  case "$dir" in
+    .|images) task="root" ;;
+    *) task=$(echo "${dir%/images}" | sed 's|/|__|g') ;;
+  esac
+  mkdir -p "$TASKS_DIR/$task/images"
+  # "a/" and "a/images/" are the same task; keep both copies of a name.
+  filename=$(basename "$imgfile")
+  destfile="$TASKS_DIR/$task/images/$filename"
+  counter=1
+  while [ -f "$destfile" ]; do
+    destfile="$TASKS_DIR/$task/images/${filename%.*}_${counter}.${filename##*.}"
+    counter=$((counter + 1))
+  done
+  mv "$imgfile" "$destfile"
+done < "$TEMP_LIST"
+rm -f "$TEMP_LIST"
+rm -rf "$RAW_DIR"
+
+echo "Download complete. Tasks in $TASKS_DIR:"
+for task_dir in "$TASKS_DIR"/*/; do
+  [ -d "$task_dir" ] || continue
+  echo "$(basename "$task_dir"): $(find "$task_dir" -type f | wc -l) images"
+done`
+}
+
+// GenerateReferenceDEMFetchScript downloads the reference DEM of a city-scale
+// task during the download stage.
+func GenerateReferenceDEMFetchScript(destPath, s3Path string) string {
+	if s3Path == "" {
+		return ""
+	}
+	return `
+echo "Fetching reference DEM from ` + s3Path + `..."
+DEM_REMOTE=$(echo "` + s3Path + `" | sed 's|^s3://|s3:|')
+if ! rclone copyto "$DEM_REMOTE" "` + destPath + `"; then
+  echo "ERROR: could not fetch reference DEM from ` + s3Path + `" >&2
+  exit 1
+fi
+if [ ! -s "` + destPath + `" ]; then
+  echo "ERROR: reference DEM fetched from ` + s3Path + ` is empty" >&2
+  exit 1
+fi
+echo "Reference DEM written to ` + destPath + ` ($(wc -c < "` + destPath + `") bytes)"
+`
+}
+
+// GenerateSidecarFetchScript downloads an ODM sidecar file the task names
+// directly (gcpS3Path, geoS3Path) during the download stage. It runs after the
+// imagery download, so it replaces any copy found beside the imagery.
+func GenerateSidecarFetchScript(destPath, s3Path string) string {
+	if s3Path == "" {
+		return ""
+	}
+	name := path.Base(destPath)
+	return `
+echo "Fetching ` + name + ` from ` + s3Path + `..."
+SIDECAR_REMOTE=$(echo "` + s3Path + `" | sed 's|^s3://|s3:|')
+if ! rclone copyto "$SIDECAR_REMOTE" "` + destPath + `"; then
+  echo "ERROR: could not fetch ` + name + ` from ` + s3Path + `" >&2
+  exit 1
+fi
+if [ ! -s "` + destPath + `" ]; then
+  echo "ERROR: ` + name + ` fetched from ` + s3Path + ` is empty" >&2
+  exit 1
+fi
+echo "` + name + ` written to ` + destPath + ` ($(wc -c < "` + destPath + `") bytes)"
+`
 }
 
 // GenerateUploadScript generates a shell script for uploading ODM results to S3
@@ -0,0 +1,66 @@
+package s3
+
+import (
+	"strings"
+)
+
+// With keepIntermediates the upload stage also saves the task's ODM project,
+// OpenSfM's undistorted images included, under the intermediates/ prefix of
+// its write path, so that /task/restart with rerunFrom can restore it and
+// recompute only the stages from rerunFrom on. The layout follows a
+// checkpoint's: the project under project/, then IntermediatesMarker, which
+// holds the workspace directory the project was in.
+
+// IntermediatesMarker names the object written once a task's intermediates
+// are saved in full.
+const IntermediatesMarker = "rerun.txt"
+
+// intermediatesExcludes are not saved: the download stage fetches the
+// imagery again, and all.zip is rebuilt from the outputs.
+var intermediatesExcludes = append(append([]string{}, checkpointExcludes...), "all.zip")
+
+// IntermediatesPath is where a task's ODM project is saved for reruns: the
+// intermediates/ prefix of its write path.
+func IntermediatesPath(writeS3Path string) string {
+	return strings.TrimSuffix(writeS3Path, "/") + "/intermediates/"
+}
+
+// GenerateIntermediatesUploadScript is appended to the upload stage. It
+// replaces the saved project with this run's, removing the marker first so
+// that an interrupted save is never restored.
+func GenerateIntermediatesUploadScript(intermediatesPath string) string {
+	return `
+INTERMEDIATES_REMOTE=` + rcloneRemote(intermediatesPath) + `
+echo "Saving the ODM project for reruns..."
+rclone deletefile "$INTERMEDIATES_REMOTE/` + IntermediatesMarker + `" >/dev/null 2>&1 || true
+rclone sync "$SRC_DIR" "$INTERMEDIATES_REMOTE/project"` + renderRcloneExcludeFlags(intermediatesExcludes) + `
+echo "$SRC_DIR" | rclone rcat "$INTERMEDIATES_REMOTE/` + IntermediatesMarker + `"
+echo "ODM project saved."`
+}
+
+// GenerateIntermediatesRestoreScript is appended to the download stage of a
+// rerun. It restores the project saved under intermediatesPath and records
+// stage as the one ODM resumes at. With afterCheckpoint it follows
+// GenerateCheckpointRestoreScript, and a checkpoint of the rerun itself,
+// restored by a retried attempt, wins.
+func GenerateIntermediatesRestoreScript(intermediatesPath, stage string, afterCheckpoint bool) string {
+	reset := `rm -f "$STATE_DIR/resume-from"
+`
+	if afterCheckpoint {
+		reset = ""
+	}
+	return `
+echo "Restoring the ODM project to rerun from ` + stage + `..."
+` + projectScriptPreamble() + `INTERMEDIATES_REMOTE=` + rcloneRemote(intermediatesPath) + `
+` + reset + `if [ -s "$STATE_DIR/resume-from" ]; then
+  echo "Resuming from the rerun's checkpoint instead."
+elif PROJECT_DIR=$(rclone cat "$INTERMEDIATES_REMOTE/` + IntermediatesMarker + `" 2>/dev/null) && [ -n "$PROJECT_DIR" ]; then
+  rclone copy "$INTERMEDIATES_REMOTE/project" "$SRC_DIR"
+  rebase_project "$PROJECT_DIR"
+  echo "` + stage + `" > "$STATE_DIR/resume-from"
+else
+  echo "ERROR: no saved ODM project under ` + intermediatesPath + `; cannot rerun from ` + stage + `."
+  exit 1
+fi
+`
+}
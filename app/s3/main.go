@@ -1,7 +1,6 @@
 package s3
 
 import (
-	"archive/zip"
 	"context"
 	"errors"
 	"fmt"
@@ -257,6 +256,108 @@ func ObjectExistsInS3Path(ctx context.Context, client *minio.Client, writeS3Path
 	return false, fmt.Errorf("failed to stat object %q: %w", objectKey, err)
 }
 
+// ErrObjectNotFound is returned by ReadObjectInS3Path when the key is missing.
+var ErrObjectNotFound = errors.New("object not found")
+
+// uploadPartSize bounds the buffer minio-go allocates for streams of unknown
+// length. Left unset it sizes parts for a 5 TiB object (~512 MiB each), which
+// would let a handful of concurrent uploads exhaust the API pod's memory.
+const uploadPartSize = 16 << 20
+
+// PutObjectInS3Path streams reader to fileName under s3Path. Pass size -1 when
+// the length is unknown (e.g. a multipart form part); the body is then sent as
+// a multipart upload in uploadPartSize chunks.
+func PutObjectInS3Path(ctx context.Context, client *minio.Client, s3Path, fileName string, reader io.Reader, size int64, contentType string) (int64, error) {
+	bucket, prefix, err := parseS3Path(s3Path)
+	if err != nil {
+		return 0, err
+	}
+
+	objectKey := prefix + strings.TrimPrefix(fileName, "/")
+	info, err := client.PutObject(ctx, bucket, objectKey, reader, size, minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    uploadPartSize,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to put object %q: %w", objectKey, err)
+	}
+	return info.Size, nil
+}
+
+// ReadObjectInS3Path reads a small object under s3Path into memory, refusing
+// anything larger than maxBytes. Missing keys return ErrObjectNotFound.
+func ReadObjectInS3Path(ctx context.Context, client *minio.Client, s3Path, fileName string, maxBytes int64) ([]byte, error) {
+	bucket, prefix, err := parseS3Path(s3Path)
+	if err != nil {
+		return nil, err
+	}
+
+	objectKey := prefix + strings.TrimPrefix(fileName, "/")
+	object, err := client.GetObject(ctx, bucket, objectKey, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object %q: %w", objectKey, err)
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(io.LimitReader(object, maxBytes+1))
+	if err != nil {
+		errResp := minio.ToErrorResponse(err)
+		if errResp.Code == "NoSuchKey" || errResp.Code == "NoSuchObject" || errResp.StatusCode == 404 {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to read object %q: %w", objectKey, err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("object %q exceeds %d bytes", objectKey, maxBytes)
+	}
+	return data, nil
+}
+
+// RemoveObjectInS3Path deletes fileName under s3Path. Deleting a missing key
+// is not an error, matching S3 semantics.
+func RemoveObjectInS3Path(ctx context.Context, client *minio.Client, s3Path, fileName string) error {
+	bucket, prefix, err := parseS3Path(s3Path)
+	if err != nil {
+		return err
+	}
+
+	objectKey := prefix + strings.TrimPrefix(fileName, "/")
+	if err := client.RemoveObject(ctx, bucket, objectKey, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to remove object %q: %w", objectKey, err)
+	}
+	return nil
+}
+
+// RemoveAllInS3Path deletes every object under s3Path, which must name a
+// prefix below the bucket. Removing an empty prefix is not an error.
+func RemoveAllInS3Path(ctx context.Context, client *minio.Client, s3Path string) error {
+	bucket, prefix, err := parseS3Path(s3Path)
+	if err != nil {
+		return err
+	}
+	if strings.Trim(prefix, "/") == "" {
+		return fmt.Errorf("refusing to remove everything under %q: not a prefix", s3Path)
+	}
+
+	objects, err := ListObjectsRecursiveInS3Path(ctx, client, s3Path)
+	if err != nil {
+		return err
+	}
+	objectCh := make(chan minio.ObjectInfo, len(objects))
+	for _, object := range objects {
+		objectCh <- object
+	}
+	close(objectCh)
+
+	var firstErr error
+	for result := range client.RemoveObjects(ctx, bucket, objectCh, minio.RemoveObjectsOptions{}) {
+		if result.Err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to remove object %q: %w", result.ObjectName, result.Err)
+		}
+	}
+	return firstErr
+}
+
 // ListFilesInS3Path lists files in the S3 path.
 // writeS3Path is the S3 path where files are stored (e.g., s3://bucket/path/)
 // Returns a list of object names (without the prefix).
@@ -280,13 +381,23 @@ func ListFilesInS3PathWithLimit(ctx context.Context, client *minio.Client, write
 		listOpts.MaxKeys = limit
 	}
 
-	objectCh := client.ListObjects(ctx, bucket, listOpts)
+	return collectListedFiles(client.ListObjects(ctx, bucket, listOpts), prefix, limit)
+}
 
+// collectListedFiles returns the names of the top-level, non-hidden files
+// among the objects listed under prefix, up to limit when it is positive.
+// The ODM projects saved under a write path for resuming (see
+// savedProjectExcludePatterns) are not task outputs and are left out.
+func collectListedFiles(objectCh <-chan minio.ObjectInfo, prefix string, limit int) ([]string, error) {
+	saved := compileExcludeMatcher(savedProjectExcludePatterns)
 	var files []string
 	for object := range objectCh {
 		if object.Err != nil {
 			return nil, fmt.Errorf("failed to list objects: %w", object.Err)
 		}
+		if saved.matches(object.Key, prefix) {
+			continue
+		}
 
 		fileName := strings.TrimPrefix(object.Key, prefix)
 		if fileName == "" || strings.HasSuffix(fileName, "/") || strings.Contains(fileName, "/") {
@@ -351,65 +462,17 @@ func sanitizeZipEntryName(prefix, objectKey string) (string, bool) {
 	return clean, true
 }
 
+// StreamS3PathAsZip writes every object under s3Path to writer as one zip
+// archive (see ZipArchive) and returns the number of entries.
 func StreamS3PathAsZip(ctx context.Context, client *minio.Client, s3Path string, writer io.Writer) (int, error) {
-	bucket, prefix, err := parseS3Path(s3Path)
+	archive, err := NewZipArchive(ctx, client, s3Path)
 	if err != nil {
 		return 0, err
 	}
-
-	objects, err := ListObjectsRecursiveInS3Path(ctx, client, s3Path)
-	if err != nil {
-		return 0, err
+	if _, err := archive.WriteTo(ctx, writer); err != nil {
+		return 0, fmt.Errorf("failed to stream zip: %w", err)
 	}
-
-	zipWriter := zip.NewWriter(writer)
-
-	written := 0
-	for _, object := range objects {
-		entryName, ok := sanitizeZipEntryName(prefix, object.Key)
-		if !ok {
-			log.Printf("skipping unsafe zip entry key=%q", object.Key)
-			continue
-		}
-
-		header := &zip.FileHeader{
-			Name:   entryName,
-			Method: zip.Deflate,
-		}
-		if !object.LastModified.IsZero() {
-			header.Modified = object.LastModified
-		}
-
-		entryWriter, createErr := zipWriter.CreateHeader(header)
-		if createErr != nil {
-			return written, fmt.Errorf("failed to create zip entry for %q: %w", object.Key, createErr)
-		}
-
-		objReader, getErr := client.GetObject(ctx, bucket, object.Key, minio.GetObjectOptions{})
-		if getErr != nil {
-			return written, fmt.Errorf("failed to read object %q: %w", object.Key, getErr)
-		}
-
-		if _, copyErr := io.Copy(entryWriter, objReader); copyErr != nil {
-			objReader.Close()
-			return written, fmt.Errorf("failed to stream object %q into zip: %w", object.Key, copyErr)
-		}
-		if closeErr := objReader.Close(); closeErr != nil {
-			return written, fmt.Errorf("failed to close object %q: %w", object.Key, closeErr)
-		}
-
-		written++
-	}
-
-	if written == 0 {
-		return 0, ErrNoObjectsToZip
-	}
-
-	if closeErr := zipWriter.Close(); closeErr != nil {
-		return written, fmt.Errorf("failed to finalize zip stream: %w", closeErr)
-	}
-
-	return written, nil
+	return archive.Entries(), nil
 }
 
 var ErrNoObjectsToZip = errors.New("no objects to zip")
@@ -466,12 +529,36 @@ func CountImageStatsInS3PathWithExcludes(ctx context.Context, client *minio.Clie
 		Prefix:    prefix,
 		Recursive: true,
 	})
+	return accumulateImageStatsFromObjectsWithExcludes(objectCh, prefix, imageExcludeMatcher(excludePatterns))
+}
 
+// ListImagesInS3PathWithExcludes returns the bucket of readS3Path and the
+// image objects CountImageStatsInS3PathWithExcludes counts under it.
+func ListImagesInS3PathWithExcludes(ctx context.Context, client *minio.Client, readS3Path string, excludePatterns []string) (string, []minio.ObjectInfo, error) {
+	bucket, prefix, err := parseS3Path(readS3Path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	matcher := imageExcludeMatcher(excludePatterns)
+	var images []minio.ObjectInfo
+	for object := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return "", nil, fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		if object.Key == "" || strings.HasSuffix(object.Key, "/") || !isSupportedImageKey(object.Key) || matcher.matches(object.Key, prefix) {
+			continue
+		}
+		images = append(images, object)
+	}
+	return bucket, images, nil
+}
+
+func imageExcludeMatcher(excludePatterns []string) excludeMatcher {
 	allExcludes := make([]string, 0, len(alwaysExcludePatterns)+len(excludePatterns))
 	allExcludes = append(allExcludes, alwaysExcludePatterns...)
 	allExcludes = append(allExcludes, excludePatterns...)
-	matcher := compileExcludeMatcher(allExcludes)
-	return accumulateImageStatsFromObjectsWithExcludes(objectCh, prefix, matcher)
+	return compileExcludeMatcher(allExcludes)
 }
 
 // CountImageFilesInS3Path counts image files under an S3 path recursively.
@@ -512,6 +599,63 @@ func accumulateImageStatsFromObjectsWithExcludes(objectCh <-chan minio.ObjectInf
 	return count, totalBytes, nil
 }
 
+// CountMergeInputsInS3Path finds the completed task outputs the merge-existing
+// mode would merge under readS3Path: the distinct directories holding at least
+// one of MergeProductPaths. It returns that count and the products' total
+// size. Like the download filter it skips writeS3Path (when nested under
+// readS3Path), objects deeper than maxDepth (> 0) and excludePatterns, using
+// the same approximate matcher as CountImageStatsInS3PathWithExcludes.
+func CountMergeInputsInS3Path(ctx context.Context, client *minio.Client, readS3Path, writeS3Path string, excludePatterns []string, maxDepth int) (int, int64, error) {
+	bucket, prefix, err := parseS3Path(readS3Path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	skipPrefix := ""
+	if writeBucket, writePrefix, err := parseS3Path(writeS3Path); err == nil && writeBucket == bucket && writePrefix != prefix {
+		skipPrefix = writePrefix
+	}
+
+	objectCh := client.ListObjects(ctx, bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	})
+	patterns := append(append([]string{}, savedProjectExcludePatterns...), excludePatterns...)
+	return accumulateMergeInputsFromObjects(objectCh, prefix, skipPrefix, compileExcludeMatcher(patterns), maxDepth)
+}
+
+func accumulateMergeInputsFromObjects(objectCh <-chan minio.ObjectInfo, prefix, skipPrefix string, matcher excludeMatcher, maxDepth int) (int, int64, error) {
+	taskDirs := map[string]struct{}{}
+	totalBytes := int64(0)
+	for object := range objectCh {
+		if object.Err != nil {
+			return 0, 0, fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		if skipPrefix != "" && strings.HasPrefix(object.Key, skipPrefix) {
+			continue
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(object.Key, prefix), "/")
+		if maxDepth > 0 && strings.Count(rel, "/")+1 > maxDepth {
+			continue
+		}
+		if matcher.matches(object.Key, prefix) {
+			continue
+		}
+		for _, product := range MergeProductPaths {
+			if rel != product && !strings.HasSuffix(rel, "/"+product) {
+				continue
+			}
+			taskDirs[strings.TrimSuffix(rel, product)] = struct{}{}
+			if object.Size > 0 {
+				totalBytes += object.Size
+			}
+			break
+		}
+	}
+
+	return len(taskDirs), totalBytes, nil
+}
+
 // excludeMatcher is a small, exact-match-only pattern matcher used for
 // pre-flight image counting. It is not a full rclone filter implementation;
 // see CountImageStatsInS3PathWithExcludes for the supported subset.
@@ -639,3 +783,111 @@ func GeneratePresignedURL(ctx context.Context, client *minio.Client, writeS3Path
 
 	return presignedURL.String(), nil
 }
+
+// CityScaleTaskName maps an image's directory, relative to readS3Path, to the
+// city-scale task it belongs to: a trailing "images" directory is dropped and
+// the rest of the path joined with "__". Images directly under readS3Path
+// form the "root" task. GenerateCityScaleDownloadScript applies the same rule.
+func CityScaleTaskName(relDir string) string {
+	dir := strings.Trim(relDir, "/")
+	if dir == "images" {
+		dir = ""
+	}
+	dir = strings.TrimSuffix(dir, "/images")
+	if dir == "" || dir == "." {
+		return "root"
+	}
+	return strings.ReplaceAll(dir, "/", "__")
+}
+
+// CountCityScaleTasksInS3Path counts the images in each city-scale task
+// beneath readS3Path (see CityScaleTaskName), applying the same filters as the
+// download stage. Returns the per-task counts and the total image bytes.
+func CountCityScaleTasksInS3Path(ctx context.Context, client *minio.Client, readS3Path string, excludePatterns []string, maxDepth int) (map[string]int, int64, error) {
+	bucket, prefix, err := parseS3Path(readS3Path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	objectCh := client.ListObjects(ctx, bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	})
+	patterns := append(append([]string{}, alwaysExcludePatterns...), excludePatterns...)
+	return accumulateCityScaleTasksFromObjects(objectCh, prefix, compileExcludeMatcher(patterns), maxDepth)
+}
+
+func accumulateCityScaleTasksFromObjects(objectCh <-chan minio.ObjectInfo, prefix string, matcher excludeMatcher, maxDepth int) (map[string]int, int64, error) {
+	tasks := map[string]int{}
+	totalBytes := int64(0)
+	for object := range objectCh {
+		if object.Err != nil {
+			return nil, 0, fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(object.Key, prefix), "/")
+		if maxDepth > 0 && strings.Count(rel, "/")+1 > maxDepth {
+			continue
+		}
+		if !isSupportedImageKey(object.Key) || matcher.matches(object.Key, prefix) {
+			continue
+		}
+		tasks[CityScaleTaskName(path.Dir(rel))]++
+		if object.Size > 0 {
+			totalBytes += object.Size
+		}
+	}
+	return tasks, totalBytes, nil
+}
+
+// FindSidecarFilesInS3Path lists the ODM sidecar files (ODMSidecarFiles)
+// beneath readS3Path that the download stage would keep, keyed by name, with
+// each key relative to readS3Path. It also counts the base names of the
+// images the download stage would keep, so callers can check the images a
+// sidecar file names.
+func FindSidecarFilesInS3Path(ctx context.Context, client *minio.Client, readS3Path string, excludePatterns []string, maxDepth int) (map[string][]string, map[string]int, error) {
+	bucket, prefix, err := parseS3Path(readS3Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	objectCh := client.ListObjects(ctx, bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	})
+	patterns := append(append([]string{}, alwaysExcludePatterns...), excludePatterns...)
+	return accumulateSidecarFilesFromObjects(objectCh, prefix, compileExcludeMatcher(patterns), maxDepth)
+}
+
+func accumulateSidecarFilesFromObjects(objectCh <-chan minio.ObjectInfo, prefix string, matcher excludeMatcher, maxDepth int) (map[string][]string, map[string]int, error) {
+	sidecars := map[string][]string{}
+	images := map[string]int{}
+	for object := range objectCh {
+		if object.Err != nil {
+			return nil, nil, fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(object.Key, prefix), "/")
+		if maxDepth > 0 && strings.Count(rel, "/")+1 > maxDepth {
+			continue
+		}
+		if matcher.matches(object.Key, prefix) {
+			continue
+		}
+		name := path.Base(rel)
+		switch {
+		case isSupportedImageKey(name):
+			images[name]++
+		case isSidecarFileName(name):
+			sidecars[name] = append(sidecars[name], rel)
+		}
+	}
+	return sidecars, images, nil
+}
+
+func isSidecarFileName(name string) bool {
+	for _, sidecar := range ODMSidecarFiles {
+		if name == sidecar {
+			return true
+		}
+	}
+	return false
+}
@@ -402,6 +402,43 @@ func TestListFilesInS3PathWithLimit_FiltersAndLimits(t *testing.T) {
 	}
 }
 
+func TestCollectListedFiles_SkipsSavedProjects(t *testing.T) {
+	prefix := "results/task-3/"
+	objectCh := make(chan minio.ObjectInfo, 5)
+	objectCh <- minio.ObjectInfo{Key: prefix + "orthophoto.tif"}
+	objectCh <- minio.ObjectInfo{Key: prefix + "checkpoints/"}
+	objectCh <- minio.ObjectInfo{Key: prefix + "checkpoints/checkpoint.txt"}
+	objectCh <- minio.ObjectInfo{Key: prefix + "intermediates/rerun.txt"}
+	objectCh <- minio.ObjectInfo{Key: prefix + "report.pdf"}
+	close(objectCh)
+
+	files, err := collectListedFiles(objectCh, prefix, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orthophoto.tif", "report.pdf"}, files)
+}
+
+func TestRemoveAllInS3Path_RemovesOnlyThePrefix(t *testing.T) {
+	require.Error(t, RemoveAllInS3Path(context.Background(), nil, "s3://bucket/"), "a whole bucket is never removed")
+
+	ctx := context.Background()
+	bucket := "test-bucket-remove-all"
+	require.NoError(t, testutil.SetupTestS3Bucket(ctx, bucket))
+
+	client := testS3Client(t)
+	prefix := "results/task-4/"
+	putTestObject(t, client, bucket, prefix+"orthophoto.tif", "tif")
+	putTestObject(t, client, bucket, prefix+"checkpoints/checkpoint.txt", "marker")
+	putTestObject(t, client, bucket, prefix+"checkpoints/project/opensfm/reconstruction.json", "{}")
+
+	require.NoError(t, RemoveAllInS3Path(ctx, client, CheckpointPath("s3://"+bucket+"/"+prefix)))
+	objects, err := ListObjectsRecursiveInS3Path(ctx, client, "s3://"+bucket+"/"+prefix)
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, prefix+"orthophoto.tif", objects[0].Key)
+
+	require.NoError(t, RemoveAllInS3Path(ctx, client, CheckpointPath("s3://"+bucket+"/"+prefix)))
+}
+
 func TestCountImageStatsInS3Path_AccumulatesCountAndBytes(t *testing.T) {
 	objectCh := make(chan minio.ObjectInfo, 4)
 	objectCh <- minio.ObjectInfo{Key: "images/a.jpg", Size: 10}
@@ -513,3 +550,272 @@ func TestSanitizeZipEntryName_RejectsUnsafePaths(t *testing.T) {
 	assert.False(t, ok)
 	assert.Empty(t, name)
 }
+
+func TestGenerateMergeInputsDownloadScript_FiltersProductsAndSkipsWritePath(t *testing.T) {
+	script := GenerateMergeInputsDownloadScript("job-1", "s3://bucket/project/", "s3://bucket/project/merged/", []string{"scratch/**"}, 6)
+
+	assert.Contains(t, script, `DEST_DIR="/workspace/$JOB_ID/merge_inputs"`)
+	assert.Contains(t, script, "- scratch/**\n- /merged/**\n")
+	for _, product := range MergeProductPaths {
+		assert.Contains(t, script, "+ "+product+"\n")
+	}
+	assert.Contains(t, script, "\n- *\n")
+	assert.Contains(t, script, "--max-depth 6")
+	// Task outputs live in output/ dirs, so the image download's built-in
+	// excludes must not apply here.
+	assert.NotContains(t, script, "- output/**")
+	assert.NotContains(t, script, "Flattening")
+}
+
+func TestMergeWriteExclude(t *testing.T) {
+	assert.Equal(t, "/merged/**", mergeWriteExclude("s3://bucket/project/", "s3://bucket/project/merged"))
+	assert.Equal(t, "/project/out/**", mergeWriteExclude("s3://bucket", "s3://bucket/project/out/"))
+	assert.Empty(t, mergeWriteExclude("s3://bucket/project/", "s3://bucket/project/"))
+	assert.Empty(t, mergeWriteExclude("s3://bucket/project/", "s3://bucket/other/"))
+	assert.Empty(t, mergeWriteExclude("s3://bucket/project/", "s3://other/project/merged/"))
+}
+
+func TestAccumulateMergeInputsFromObjects_CountsTaskOutputDirs(t *testing.T) {
+	objectCh := make(chan minio.ObjectInfo, 8)
+	objectCh <- minio.ObjectInfo{Key: "project/task-a/output/odm_orthophoto/odm_orthophoto.tif", Size: 100}
+	objectCh <- minio.ObjectInfo{Key: "project/task-a/output/odm_dem/dsm.tif", Size: 10}
+	objectCh <- minio.ObjectInfo{Key: "project/task-b/output/odm_orthophoto/odm_orthophoto.tif", Size: 200}
+	objectCh <- minio.ObjectInfo{Key: "project/task-b/output/odm_georeferencing/odm_georeferenced_model.laz", Size: 20}
+	objectCh <- minio.ObjectInfo{Key: "project/task-b/images/img1.jpg", Size: 5000}
+	objectCh <- minio.ObjectInfo{Key: "project/merged/odm_orthophoto/odm_orthophoto.tif", Size: 9999}
+	objectCh <- minio.ObjectInfo{Key: "project/scratch/odm_dem/dtm.tif", Size: 9999}
+	objectCh <- minio.ObjectInfo{Key: "project/a/b/c/d/odm_dem/dtm.tif", Size: 9999}
+	close(objectCh)
+
+	matcher := compileExcludeMatcher([]string{"scratch/**"})
+	tasks, totalBytes, err := accumulateMergeInputsFromObjects(objectCh, "project/", "project/merged/", matcher, 5)
+	require.NoError(t, err)
+	assert.Equal(t, 2, tasks)
+	assert.Equal(t, int64(330), totalBytes)
+}
+
+func TestGenerateThermalDownloadScript_KeepsRJPEGAndClassifiesImages(t *testing.T) {
+	script := GenerateThermalDownloadScript("job-1", "s3://bucket/thermal/", nil, 1)
+
+	assert.Contains(t, script, "+ *.rjpg")
+	assert.Contains(t, script, `-iname "*.rjpeg"`)
+	assert.Contains(t, script, `THERMAL_MANIFEST="/workspace/$JOB_ID/`+ThermalManifestName+`"`)
+	assert.Contains(t, script, `ImageSource="InfraredCamera"`)
+	assert.Contains(t, script, "ERROR: no thermal imagery found")
+
+	standard := GenerateDownloadScript("job-1", "s3://bucket/thermal/", nil, 1)
+	assert.NotContains(t, standard, "rjpg")
+	assert.NotContains(t, standard, ThermalManifestName)
+	assert.Contains(t, standard, `-iname "*.jpg" -o -iname "*.jpeg" -o -iname "*.tiff" -o -iname "*.tif"`)
+}
+
+func TestCityScaleTaskName(t *testing.T) {
+	assert.Equal(t, "root", CityScaleTaskName("."))
+	assert.Equal(t, "root", CityScaleTaskName("images"))
+	assert.Equal(t, "task-a", CityScaleTaskName("task-a/images"))
+	assert.Equal(t, "task-a", CityScaleTaskName("task-a"))
+	assert.Equal(t, "zone-1__task-b", CityScaleTaskName("zone-1/task-b/images/"))
+}
+
+func TestAccumulateCityScaleTasksFromObjects_GroupsImagesByDirectory(t *testing.T) {
+	objectCh := make(chan minio.ObjectInfo, 8)
+	objectCh <- minio.ObjectInfo{Key: "city/task-a/images/img1.jpg", Size: 100}
+	objectCh <- minio.ObjectInfo{Key: "city/task-a/images/img2.JPG", Size: 100}
+	objectCh <- minio.ObjectInfo{Key: "city/task-b/img1.tif", Size: 50}
+	objectCh <- minio.ObjectInfo{Key: "city/task-b/notes.txt", Size: 9999}
+	objectCh <- minio.ObjectInfo{Key: "city/task-a/output/odm_orthophoto/odm_orthophoto.tif", Size: 9999}
+	objectCh <- minio.ObjectInfo{Key: "city/scratch/img1.jpg", Size: 9999}
+	objectCh <- minio.ObjectInfo{Key: "city/a/b/c/d/img1.jpg", Size: 9999}
+	close(objectCh)
+
+	matcher := compileExcludeMatcher(append(append([]string{}, alwaysExcludePatterns...), "scratch/**"))
+	tasks, totalBytes, err := accumulateCityScaleTasksFromObjects(objectCh, "city/", matcher, 4)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"task-a": 2, "task-b": 1}, tasks)
+	assert.Equal(t, int64(250), totalBytes)
+}
+
+func TestGenerateCityScaleDownloadScript_KeepsTaskDirectories(t *testing.T) {
+	script := GenerateCityScaleDownloadScript("job-1", "s3://bucket/city/", []string{"scratch/**"}, 10)
+
+	assert.Contains(t, script, `TASKS_DIR="/workspace/$JOB_ID/`+CityScaleTasksDir+`"`)
+	assert.Contains(t, script, "- output/**\n")
+	assert.Contains(t, script, "- scratch/**\n")
+	assert.Contains(t, script, "+ *.jpg\n")
+	assert.NotContains(t, script, "*.zip")
+	assert.Contains(t, script, "--max-depth 10")
+	assert.Contains(t, script, `task=$(echo "${dir%/images}" | sed 's|/|__|g')`)
+	assert.NotContains(t, script, "Flattening")
+
+	assert.Empty(t, GenerateReferenceDEMFetchScript("/workspace/job-1/reference_dem.tif", ""))
+	fetch := GenerateReferenceDEMFetchScript("/workspace/job-1/reference_dem.tif", "s3://bucket/dem.tif")
+	assert.Contains(t, fetch, `rclone copyto "$DEM_REMOTE" "/workspace/job-1/reference_dem.tif"`)
+}
+
+func TestGenerateDownloadScript_KeepsSidecarFiles(t *testing.T) {
+	script := GenerateDownloadScript("job-1", "s3://bucket/imagery/", nil, 2)
+
+	for _, name := range ODMSidecarFiles {
+		assert.Contains(t, script, "+ "+name+"\n")
+	}
+	assert.Contains(t, script, "for sidecar in gcp_list.txt geo.txt image_groups.txt cameras.json; do")
+	assert.Contains(t, script, `mv "$found" "/workspace/$JOB_ID/$sidecar"`)
+	assert.Less(t, strings.Index(script, "Keeping ODM sidecar files"), strings.Index(script, "Cleaning up non-image files"))
+
+	assert.Empty(t, GenerateSidecarFetchScript("/workspace/job-1/gcp_list.txt", ""))
+	fetch := GenerateSidecarFetchScript("/workspace/job-1/gcp_list.txt", "s3://bucket/gcps/survey.txt")
+	assert.Contains(t, fetch, `rclone copyto "$SIDECAR_REMOTE" "/workspace/job-1/gcp_list.txt"`)
+	assert.Contains(t, fetch, "ERROR: could not fetch gcp_list.txt from s3://bucket/gcps/survey.txt")
+}
+
+func TestAccumulateSidecarFilesFromObjects(t *testing.T) {
+	objectCh := make(chan minio.ObjectInfo, 8)
+	objectCh <- minio.ObjectInfo{Key: "project/images/img1.jpg"}
+	objectCh <- minio.ObjectInfo{Key: "project/images/img2.JPG"}
+	objectCh <- minio.ObjectInfo{Key: "project/flight-2/img1.jpg"}
+	objectCh <- minio.ObjectInfo{Key: "project/gcp_list.txt"}
+	objectCh <- minio.ObjectInfo{Key: "project/images/geo.txt"}
+	objectCh <- minio.ObjectInfo{Key: "project/flight-2/geo.txt"}
+	objectCh <- minio.ObjectInfo{Key: "project/output/cameras.json"}
+	objectCh <- minio.ObjectInfo{Key: "project/a/b/c/image_groups.txt"}
+	close(objectCh)
+
+	matcher := compileExcludeMatcher(alwaysExcludePatterns)
+	sidecars, images, err := accumulateSidecarFilesFromObjects(objectCh, "project/", matcher, 3)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"gcp_list.txt": {"gcp_list.txt"},
+		"geo.txt":      {"images/geo.txt", "flight-2/geo.txt"},
+	}, sidecars)
+	assert.Equal(t, map[string]int{"img1.jpg": 2, "img2.JPG": 1}, images)
+}
+
+func TestCheckpointPath(t *testing.T) {
+	assert.Equal(t, "s3://bucket/output/checkpoints/", CheckpointPath("s3://bucket/output/"))
+	assert.Equal(t, "s3://bucket/output/checkpoints/", CheckpointPath("s3://bucket/output"))
+}
+
+func TestGenerateCheckpointRestoreScript(t *testing.T) {
+	script := GenerateCheckpointRestoreScript("s3://bucket/output/checkpoints/", "abc123", false)
+
+	assert.Contains(t, script, `echo "s3://bucket/output/checkpoints" | sed 's|^s3://|s3:|'`)
+	assert.Contains(t, script, `if [ "{{retries}}" = "0" ] && [ "false" != "true" ]; then`)
+	assert.Contains(t, script, `rclone purge "$CHECKPOINT_REMOTE"`)
+	assert.Contains(t, script, `rclone cat "$CHECKPOINT_REMOTE/checkpoint.txt"`)
+	assert.Contains(t, script, `if [ "$FINGERPRINT" != "abc123" ]; then`)
+	assert.Contains(t, script, `rclone copy "$CHECKPOINT_REMOTE/project" "$SRC_DIR"`)
+	assert.Contains(t, script, `echo "$RESUME_FROM" > "$STATE_DIR/resume-from"`)
+
+	resumed := GenerateCheckpointRestoreScript("s3://bucket/output/checkpoints/", "abc123", true)
+	assert.Contains(t, resumed, `[ "true" != "true" ]`)
+}
+
+func TestGenerateCheckpointScript_SyncsProjectThenMarker(t *testing.T) {
+	script := GenerateCheckpointScript("s3://bucket/output/checkpoints/", "abc123", []string{"opensfm", "openmvs"})
+
+	assert.Contains(t, script, `CHECKPOINT_STAGES=" opensfm openmvs "`)
+	assert.Contains(t, script, `rclone sync "$SRC_DIR" "$CHECKPOINT_REMOTE/project"`)
+	for _, exclude := range checkpointExcludes {
+		assert.Contains(t, script, `--exclude "`+exclude+`"`)
+	}
+	assert.Contains(t, script, `"abc123" "$1" "$SRC_DIR" | rclone rcat "$CHECKPOINT_REMOTE/checkpoint.txt"`)
+	assert.Less(t, strings.Index(script, "rclone sync"), strings.Index(script, "rclone rcat"))
+	assert.Contains(t, script, `cat "$STATE_DIR/process-exit"`)
+}
+
+func TestCheckpointsAreNotImagesOrMergeInputs(t *testing.T) {
+	matcher := compileExcludeMatcher(alwaysExcludePatterns)
+	assert.True(t, matcher.matches("project/checkpoints/project/opensfm/img1.jpg", "project/"))
+	assert.True(t, matcher.matches("project/output/checkpoints/project/images/img1.jpg", "project/"))
+	assert.False(t, matcher.matches("project/images/img1.jpg", "project/"))
+
+	assert.Contains(t, GenerateMergeInputsDownloadScript("job-1", "s3://bucket/project/", "s3://bucket/project/merged/", nil, 6), "- checkpoints/**\n")
+	assert.Contains(t, GenerateUploadScript("s3://bucket/output/"), `--exclude ".scaleodm/**"`)
+}
+
+func TestGenerateIntermediatesUploadScript(t *testing.T) {
+	assert.Equal(t, "s3://bucket/output/intermediates/", IntermediatesPath("s3://bucket/output"))
+	script := GenerateIntermediatesUploadScript(IntermediatesPath("s3://bucket/output/"))
+
+	assert.Contains(t, script, `echo "s3://bucket/output/intermediates" | sed 's|^s3://|s3:|'`)
+	assert.Contains(t, script, `rclone sync "$SRC_DIR" "$INTERMEDIATES_REMOTE/project" --exclude "images/**" --exclude ".rclone/**" --exclude ".scaleodm/**" --exclude "all.zip"`)
+	assert.NotContains(t, script, "undistorted")
+	// The marker goes first and comes back last, so a partial save is never
+	// restored.
+	deleteMarker := strings.Index(script, `rclone deletefile "$INTERMEDIATES_REMOTE/rerun.txt"`)
+	sync := strings.Index(script, "rclone sync")
+	writeMarker := strings.Index(script, `rclone rcat "$INTERMEDIATES_REMOTE/rerun.txt"`)
+	assert.True(t, deleteMarker >= 0 && deleteMarker < sync && sync < writeMarker)
+}
+
+func TestGenerateIntermediatesRestoreScript(t *testing.T) {
+	script := GenerateIntermediatesRestoreScript("s3://bucket/output/intermediates/", "odm_orthophoto", false)
+
+	assert.Contains(t, script, `rm -f "$STATE_DIR/resume-from"`)
+	assert.Contains(t, script, `rclone cat "$INTERMEDIATES_REMOTE/rerun.txt"`)
+	assert.Contains(t, script, `rclone copy "$INTERMEDIATES_REMOTE/project" "$SRC_DIR"`)
+	assert.Contains(t, script, `rebase_project "$PROJECT_DIR"`)
+	assert.Contains(t, script, `echo "odm_orthophoto" > "$STATE_DIR/resume-from"`)
+	assert.Contains(t, script, "exit 1")
+
+	// After a checkpoint restore, the resume-from it wrote is kept.
+	afterCheckpoint := GenerateIntermediatesRestoreScript("s3://bucket/output/intermediates/", "odm_orthophoto", true)
+	assert.NotContains(t, afterCheckpoint, `rm -f "$STATE_DIR/resume-from"`)
+	assert.Contains(t, afterCheckpoint, `if [ -s "$STATE_DIR/resume-from" ]; then`)
+}
+
+func TestProjectScriptPreamble_RebasesRestoredProjects(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available")
+	}
+	workspace := t.TempDir()
+	project := filepath.Join(workspace, "new-job")
+	require.NoError(t, os.MkdirAll(filepath.Join(project, "opensfm"), 0o755))
+	imageList := filepath.Join(project, "opensfm", "image_list.txt")
+	require.NoError(t, os.WriteFile(imageList, []byte("/workspace/old-job/images/a.jpg\n/workspace/old-job/images/b.jpg\n"), 0o644))
+
+	// Only the function is under test, not the rclone setup.
+	preamble := projectScriptPreamble()
+	rebase := preamble[strings.Index(preamble, "rebase_project() {"):]
+	cmd := exec.Command(bash, "-c", `set -e
+SRC_DIR="`+project+`"
+`+rebase+`
+rebase_project /workspace/old-job
+rebase_project "$SRC_DIR"
+rebase_project ""`)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	assert.Contains(t, string(out), "Rewriting project paths from /workspace/old-job")
+
+	rebased, err := os.ReadFile(imageList)
+	require.NoError(t, err)
+	assert.Equal(t, project+"/images/a.jpg\n"+project+"/images/b.jpg\n", string(rebased))
+}
+
+func TestGenerateCheckpointScript_StopsWhenProcessDiesWithoutExitCode(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available")
+	}
+	workspace := t.TempDir()
+	stateDir := filepath.Join(workspace, "job", CheckpointStateDir)
+	require.NoError(t, os.MkdirAll(stateDir, 0o755))
+	// An OOM kill: ODM got as far as a stage boundary that is not
+	// checkpointed, and neither the exit trap nor the heartbeat ran since.
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, "stage"), []byte("dataset opensfm\n"), 0o644))
+	stale := time.Now().Add(-time.Duration(checkpointHeartbeatTimeout+60) * time.Second).Unix()
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, "heartbeat"), []byte(fmt.Sprintf("%d\n", stale)), 0o644))
+
+	script := strings.NewReplacer(
+		"{{workflow.name}}", "job",
+		"{{retries}}", "1",
+		"/workspace/", workspace+"/",
+	).Replace(GenerateCheckpointScript("s3://bucket/output/checkpoints/", "abc123", []string{"openmvs"}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, bash, "-c", script).CombinedOutput()
+	require.NoError(t, err, string(out))
+	assert.Contains(t, string(out), "Process stage stopped without finishing")
+	assert.NoFileExists(t, filepath.Join(stateDir, "process-exit"))
+}
@@ -0,0 +1,679 @@
+package s3
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// ZipArchive is an all.zip built on the fly from the objects under an S3
+// path. Entries are stored uncompressed in key order, so the archive's size
+// and every entry's offset follow from the listing alone: it can be served
+// with a Content-Length and resumed with a Range request.
+//
+// Each entry's CRC-32 is only known once its object has been read. CRCs go
+// in data descriptors after each entry and in the central directory, so a
+// range that skips an entry but includes those needs its CRC from an earlier
+// download (see SetCRCs) or reads the object without sending it.
+type ZipArchive struct {
+	client  *minio.Client
+	bucket  string
+	entries []zipEntry
+	size    int64
+	etag    string
+
+	// central directory and end records, without CRCs filled in.
+	directoryOffset int64
+	directorySize   int64
+
+	mu   sync.Mutex
+	crcs map[string]uint32
+}
+
+type zipEntry struct {
+	name   string
+	key    string
+	etag   string
+	size   int64
+	offset int64 // of the local file header
+	header []byte
+	zip64  bool
+	mtime  time.Time
+}
+
+const (
+	zipLocalHeaderLen      = 30
+	zipCentralHeaderLen    = 46
+	zipEndLen              = 22
+	zipEnd64Len            = 56
+	zipEnd64LocatorLen     = 20
+	zipDescriptorLen       = 16
+	zipDescriptor64Len     = 24
+	zipFlagDataDescriptor  = 0x8
+	zipFlagUTF8            = 0x800
+	zipVersion20           = 20
+	zipVersion45           = 45
+	zipUint32Max           = 0xffffffff
+	zipUint16Max           = 0xffff
+	zipPrefetchObjects     = 4
+	zipPrefetchBufferBytes = 8 << 20
+)
+
+// zipEntries are the archive entries of objects listed under prefix, sorted
+// by name. The ODM projects saved under a write path for resuming (see
+// savedProjectExcludePatterns) are not task outputs and are left out.
+func zipEntries(prefix string, objects []minio.ObjectInfo) []zipEntry {
+	saved := compileExcludeMatcher(savedProjectExcludePatterns)
+	var entries []zipEntry
+	seen := map[string]bool{}
+	for _, object := range objects {
+		if saved.matches(object.Key, prefix) {
+			continue
+		}
+		name, ok := sanitizeZipEntryName(prefix, object.Key)
+		if !ok {
+			log.Printf("skipping unsafe zip entry key=%q", object.Key)
+			continue
+		}
+		if seen[name] {
+			log.Printf("skipping duplicate zip entry key=%q", object.Key)
+			continue
+		}
+		seen[name] = true
+		entries = append(entries, zipEntry{
+			name:  name,
+			key:   object.Key,
+			etag:  object.ETag,
+			size:  object.Size,
+			mtime: object.LastModified,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries
+}
+
+// NewZipArchive lists s3Path and lays out its archive of zipEntries. It returns
+// ErrNoObjectsToZip when there is nothing to archive.
+func NewZipArchive(ctx context.Context, client *minio.Client, s3Path string) (*ZipArchive, error) {
+	bucket, prefix, err := parseS3Path(s3Path)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := ListObjectsRecursiveInS3Path(ctx, client, s3Path)
+	if err != nil {
+		return nil, err
+	}
+
+	z := &ZipArchive{client: client, bucket: bucket, crcs: map[string]uint32{}, entries: zipEntries(prefix, objects)}
+	if len(z.entries) == 0 {
+		return nil, ErrNoObjectsToZip
+	}
+
+	sum := sha256.New()
+	var offset int64
+	for i := range z.entries {
+		e := &z.entries[i]
+		e.offset = offset
+		e.zip64 = e.size >= zipUint32Max || offset >= zipUint32Max
+		e.header = e.localHeader()
+		offset += int64(len(e.header)) + e.size + e.descriptorLen()
+		fmt.Fprintf(sum, "%s\x00%d\x00%s\x00%d\n", e.name, e.size, e.etag, e.mtime.Unix())
+	}
+	z.directoryOffset = offset
+	for i := range z.entries {
+		z.directorySize += int64(zipCentralHeaderLen + len(z.entries[i].name) + len(z.entries[i].centralExtra()))
+	}
+	z.size = z.directoryOffset + z.directorySize + z.endLen()
+	z.etag = `"zip-` + hex.EncodeToString(sum.Sum(nil))[:32] + `"`
+	return z, nil
+}
+
+// Size is the archive's length in bytes.
+func (z *ZipArchive) Size() int64 { return z.size }
+
+// Entries is the number of files in the archive.
+func (z *ZipArchive) Entries() int { return len(z.entries) }
+
+// ETag identifies the archive's contents: it changes when any object is
+// added, removed or rewritten.
+func (z *ZipArchive) ETag() string { return z.etag }
+
+// SetCRCs seeds the CRCs of entries read by an earlier download of the same
+// archive (same ETag), keyed by entry name.
+func (z *ZipArchive) SetCRCs(crcs map[string]uint32) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	for name, crc := range crcs {
+		z.crcs[name] = crc
+	}
+}
+
+// CRCs returns the CRCs known so far, keyed by entry name, for SetCRCs on a
+// later download.
+func (z *ZipArchive) CRCs() map[string]uint32 {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	crcs := make(map[string]uint32, len(z.crcs))
+	for name, crc := range z.crcs {
+		crcs[name] = crc
+	}
+	return crcs
+}
+
+func (z *ZipArchive) crc(name string) (uint32, bool) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	crc, ok := z.crcs[name]
+	return crc, ok
+}
+
+func (z *ZipArchive) setCRC(name string, crc uint32) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.crcs[name] = crc
+}
+
+// WriteTo writes the whole archive to w.
+func (z *ZipArchive) WriteTo(ctx context.Context, w io.Writer) (int64, error) {
+	return z.WriteRange(ctx, w, 0, z.size)
+}
+
+// WriteRange writes bytes [start, end) of the archive to w. Objects are read
+// a few at a time ahead of the writer, so small files do not each cost a
+// round trip. An object that changed since the archive was listed fails the
+// write rather than producing a corrupt archive.
+func (z *ZipArchive) WriteRange(ctx context.Context, w io.Writer, start, end int64) (int64, error) {
+	if start < 0 || end > z.size || start > end {
+		return 0, fmt.Errorf("invalid zip range %d-%d of %d", start, end, z.size)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The central directory holds every CRC; a data descriptor holds its
+	// entry's. Any that are unknown come from reading the object.
+	needAll := end > z.directoryOffset
+	var reads []zipRead
+	var skipped []int
+	for i := range z.entries {
+		e := &z.entries[i]
+		dataStart := e.offset + int64(len(e.header))
+		dataEnd := dataStart + e.size
+		descriptorEnd := dataEnd + e.descriptorLen()
+		if e.size == 0 {
+			z.setCRC(e.name, 0)
+			continue
+		}
+		_, known := z.crc(e.name)
+		needCRC := !known && (needAll || (descriptorEnd > start && dataEnd < end))
+		overlaps := dataEnd > start && dataStart < end
+		switch {
+		case overlaps && needCRC:
+			// Read it all for the CRC, send only the part in range.
+			reads = append(reads, zipRead{entry: i, from: 0, to: e.size,
+				emitFrom: max(start-dataStart, 0), emitTo: min(end-dataStart, e.size), hash: true})
+		case overlaps:
+			from, to := max(start-dataStart, 0), min(end-dataStart, e.size)
+			reads = append(reads, zipRead{entry: i, from: from, to: to, emitFrom: from, emitTo: to})
+		case needCRC:
+			skipped = append(skipped, i)
+		}
+	}
+	if err := z.computeCRCs(ctx, skipped); err != nil {
+		return 0, err
+	}
+
+	out := &rangeWriter{w: w, pos: 0, start: start, end: end}
+	prefetch := newZipPrefetcher(ctx, z, reads)
+	defer prefetch.close()
+
+	for i := range z.entries {
+		e := &z.entries[i]
+		descriptorOffset := e.offset + int64(len(e.header)) + e.size
+		if descriptorOffset+e.descriptorLen() <= start {
+			continue
+		}
+		if e.offset >= end {
+			break
+		}
+		out.pos = e.offset
+		if err := out.write(e.header); err != nil {
+			return out.written, err
+		}
+		if e.size > 0 && descriptorOffset > start && descriptorOffset-e.size < end {
+			if err := prefetch.copyNext(out, i); err != nil {
+				return out.written, err
+			}
+		}
+		out.pos = descriptorOffset
+		if descriptorOffset < end {
+			crc, _ := z.crc(e.name)
+			if err := out.write(e.descriptor(crc)); err != nil {
+				return out.written, err
+			}
+		}
+	}
+	if end > z.directoryOffset {
+		out.pos = z.directoryOffset
+		if err := out.write(z.directory()); err != nil {
+			return out.written, err
+		}
+	}
+	return out.written, nil
+}
+
+// computeCRCs reads objects outside the requested range only to learn their
+// CRCs.
+func (z *ZipArchive) computeCRCs(ctx context.Context, entries []int) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	work := make(chan int)
+	errs := make(chan error, zipPrefetchObjects)
+	var wg sync.WaitGroup
+	for range min(zipPrefetchObjects, len(entries)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				e := &z.entries[i]
+				h := crc32.NewIEEE()
+				if err := z.readObject(ctx, e, 0, e.size, h); err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+				z.setCRC(e.name, h.Sum32())
+			}
+		}()
+	}
+	for _, i := range entries {
+		select {
+		case work <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(work)
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// readObject copies bytes [from, to) of e's object to w, failing if the
+// object no longer matches the listing.
+func (z *ZipArchive) readObject(ctx context.Context, e *zipEntry, from, to int64, w io.Writer) error {
+	opts := minio.GetObjectOptions{}
+	if e.etag != "" {
+		if err := opts.SetMatchETag(e.etag); err != nil {
+			return err
+		}
+	}
+	if from > 0 || to < e.size {
+		if err := opts.SetRange(from, to-1); err != nil {
+			return err
+		}
+	}
+	obj, err := z.client.GetObject(ctx, z.bucket, e.key, opts)
+	if err != nil {
+		return fmt.Errorf("failed to read object %q: %w", e.key, err)
+	}
+	defer obj.Close()
+	n, err := io.Copy(w, io.LimitReader(obj, to-from))
+	if err != nil {
+		return fmt.Errorf("failed to read object %q: %w", e.key, err)
+	}
+	if n != to-from {
+		return fmt.Errorf("object %q changed while zipping: read %d of %d bytes", e.key, n, to-from)
+	}
+	return nil
+}
+
+// zipRead is the part of an entry's object WriteRange needs.
+type zipRead struct {
+	entry            int
+	from, to         int64
+	emitFrom, emitTo int64
+	hash             bool
+	reader           *io.PipeReader
+}
+
+// zipPrefetcher opens the next few reads ahead of the one being written.
+// Each is read into a buffered io.Pipe, so read-ahead is bounded by
+// zipPrefetchObjects * zipPrefetchBufferBytes.
+type zipPrefetcher struct {
+	ctx   context.Context
+	z     *ZipArchive
+	reads []zipRead
+	next  int // next read to open
+	cur   int // next read to consume
+}
+
+func newZipPrefetcher(ctx context.Context, z *ZipArchive, reads []zipRead) *zipPrefetcher {
+	p := &zipPrefetcher{ctx: ctx, z: z, reads: reads}
+	p.fill()
+	return p
+}
+
+func (p *zipPrefetcher) fill() {
+	for p.next < len(p.reads) && p.next-p.cur < zipPrefetchObjects {
+		read := &p.reads[p.next]
+		pr, pw := io.Pipe()
+		read.reader = pr
+		e := &p.z.entries[read.entry]
+		go func() {
+			buffered := bufio.NewWriterSize(pw, zipPrefetchBufferBytes)
+			err := p.z.readObject(p.ctx, e, read.from, read.to, buffered)
+			if err == nil {
+				err = buffered.Flush()
+			}
+			pw.CloseWithError(err)
+		}()
+		p.next++
+	}
+}
+
+// copyNext writes the next read, which must be for entry, to out.
+func (p *zipPrefetcher) copyNext(out *rangeWriter, entry int) error {
+	if p.cur >= len(p.reads) || p.reads[p.cur].entry != entry {
+		return fmt.Errorf("zip read for entry %d out of order", entry)
+	}
+	read := p.reads[p.cur]
+	p.cur++
+	p.fill()
+	defer read.reader.Close()
+
+	e := &p.z.entries[read.entry]
+	dataStart := e.offset + int64(len(e.header))
+	var src io.Reader = read.reader
+	var h hash.Hash32
+	if read.hash {
+		h = crc32.NewIEEE()
+		src = io.TeeReader(src, h)
+	}
+	if read.emitFrom > read.from {
+		if _, err := io.CopyN(io.Discard, src, read.emitFrom-read.from); err != nil {
+			return err
+		}
+	}
+	out.pos = dataStart + read.emitFrom
+	if _, err := io.CopyN(out, src, read.emitTo-read.emitFrom); err != nil {
+		return err
+	}
+	if read.hash {
+		if _, err := io.Copy(io.Discard, src); err != nil {
+			return err
+		}
+		p.z.setCRC(e.name, h.Sum32())
+	}
+	return nil
+}
+
+func (p *zipPrefetcher) close() {
+	for i := p.cur; i < p.next; i++ {
+		p.reads[i].reader.Close()
+	}
+}
+
+// rangeWriter passes on the part of the archive in [start, end). pos is the
+// archive offset of the next byte written.
+type rangeWriter struct {
+	w          io.Writer
+	pos        int64
+	start, end int64
+	written    int64
+}
+
+func (r *rangeWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if err := r.write(p); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (r *rangeWriter) write(p []byte) error {
+	pos := r.pos
+	r.pos += int64(len(p))
+	if pos < r.start {
+		skip := min(r.start-pos, int64(len(p)))
+		p, pos = p[skip:], pos+skip
+	}
+	if pos+int64(len(p)) > r.end {
+		p = p[:max(r.end-pos, 0)]
+	}
+	if len(p) == 0 {
+		return nil
+	}
+	n, err := r.w.Write(p)
+	r.written += int64(n)
+	return err
+}
+
+func (e *zipEntry) flags() uint16 {
+	if utf8.ValidString(e.name) && !isASCII(e.name) {
+		return zipFlagDataDescriptor | zipFlagUTF8
+	}
+	return zipFlagDataDescriptor
+}
+
+func (e *zipEntry) version() uint16 {
+	if e.zip64 {
+		return zipVersion45
+	}
+	return zipVersion20
+}
+
+func (e *zipEntry) descriptorLen() int64 {
+	if e.zip64 {
+		return zipDescriptor64Len
+	}
+	return zipDescriptorLen
+}
+
+// localHeader leaves the CRC and sizes to the data descriptor, so it can be
+// written before the object is read.
+func (e *zipEntry) localHeader() []byte {
+	var extra []byte
+	if e.zip64 {
+		extra = make([]byte, 20)
+		binary.LittleEndian.PutUint16(extra[0:], 0x0001)
+		binary.LittleEndian.PutUint16(extra[2:], 16)
+	}
+	b := make([]byte, zipLocalHeaderLen, zipLocalHeaderLen+len(e.name)+len(extra))
+	modTime, modDate := msDosTime(e.mtime)
+	binary.LittleEndian.PutUint32(b[0:], 0x04034b50)
+	binary.LittleEndian.PutUint16(b[4:], e.version())
+	binary.LittleEndian.PutUint16(b[6:], e.flags())
+	binary.LittleEndian.PutUint16(b[8:], 0) // stored
+	binary.LittleEndian.PutUint16(b[10:], modTime)
+	binary.LittleEndian.PutUint16(b[12:], modDate)
+	if e.zip64 {
+		binary.LittleEndian.PutUint32(b[18:], zipUint32Max)
+		binary.LittleEndian.PutUint32(b[22:], zipUint32Max)
+	}
+	binary.LittleEndian.PutUint16(b[26:], uint16(len(e.name)))
+	binary.LittleEndian.PutUint16(b[28:], uint16(len(extra)))
+	return append(append(b, e.name...), extra...)
+}
+
+func (e *zipEntry) descriptor(crc uint32) []byte {
+	b := make([]byte, e.descriptorLen())
+	binary.LittleEndian.PutUint32(b[0:], 0x08074b50)
+	binary.LittleEndian.PutUint32(b[4:], crc)
+	if e.zip64 {
+		binary.LittleEndian.PutUint64(b[8:], uint64(e.size))
+		binary.LittleEndian.PutUint64(b[16:], uint64(e.size))
+	} else {
+		binary.LittleEndian.PutUint32(b[8:], uint32(e.size))
+		binary.LittleEndian.PutUint32(b[12:], uint32(e.size))
+	}
+	return b
+}
+
+// centralExtra is the zip64 extra field of the central directory record,
+// holding the values too large for their 32-bit fields.
+func (e *zipEntry) centralExtra() []byte {
+	var fields []byte
+	if e.size >= zipUint32Max {
+		fields = binary.LittleEndian.AppendUint64(fields, uint64(e.size))
+		fields = binary.LittleEndian.AppendUint64(fields, uint64(e.size))
+	}
+	if e.offset >= zipUint32Max {
+		fields = binary.LittleEndian.AppendUint64(fields, uint64(e.offset))
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	extra := binary.LittleEndian.AppendUint16(nil, 0x0001)
+	extra = binary.LittleEndian.AppendUint16(extra, uint16(len(fields)))
+	return append(extra, fields...)
+}
+
+func (z *ZipArchive) zip64End() bool {
+	return len(z.entries) >= zipUint16Max || z.directoryOffset >= zipUint32Max || z.directorySize >= zipUint32Max
+}
+
+func (z *ZipArchive) endLen() int64 {
+	if z.zip64End() {
+		return zipEnd64Len + zipEnd64LocatorLen + zipEndLen
+	}
+	return zipEndLen
+}
+
+// directory renders the central directory and end records. Every CRC must
+// be known.
+func (z *ZipArchive) directory() []byte {
+	b := make([]byte, 0, z.directorySize+z.endLen())
+	for i := range z.entries {
+		e := &z.entries[i]
+		crc, _ := z.crc(e.name)
+		extra := e.centralExtra()
+		modTime, modDate := msDosTime(e.mtime)
+		size, offset := uint32(min(e.size, zipUint32Max)), uint32(min(e.offset, zipUint32Max))
+		b = binary.LittleEndian.AppendUint32(b, 0x02014b50)
+		b = binary.LittleEndian.AppendUint16(b, zipVersion45)
+		b = binary.LittleEndian.AppendUint16(b, e.version())
+		b = binary.LittleEndian.AppendUint16(b, e.flags())
+		b = binary.LittleEndian.AppendUint16(b, 0) // stored
+		b = binary.LittleEndian.AppendUint16(b, modTime)
+		b = binary.LittleEndian.AppendUint16(b, modDate)
+		b = binary.LittleEndian.AppendUint32(b, crc)
+		b = binary.LittleEndian.AppendUint32(b, size)
+		b = binary.LittleEndian.AppendUint32(b, size)
+		b = binary.LittleEndian.AppendUint16(b, uint16(len(e.name)))
+		b = binary.LittleEndian.AppendUint16(b, uint16(len(extra)))
+		b = binary.LittleEndian.AppendUint16(b, 0) // comment
+		b = binary.LittleEndian.AppendUint16(b, 0) // disk
+		b = binary.LittleEndian.AppendUint16(b, 0) // internal attributes
+		b = binary.LittleEndian.AppendUint32(b, 0) // external attributes
+		b = binary.LittleEndian.AppendUint32(b, offset)
+		b = append(append(b, e.name...), extra...)
+	}
+
+	count := uint64(len(z.entries))
+	if z.zip64End() {
+		end64 := z.directoryOffset + z.directorySize
+		b = binary.LittleEndian.AppendUint32(b, 0x06064b50)
+		b = binary.LittleEndian.AppendUint64(b, zipEnd64Len-12)
+		b = binary.LittleEndian.AppendUint16(b, zipVersion45)
+		b = binary.LittleEndian.AppendUint16(b, zipVersion45)
+		b = binary.LittleEndian.AppendUint32(b, 0)
+		b = binary.LittleEndian.AppendUint32(b, 0)
+		b = binary.LittleEndian.AppendUint64(b, count)
+		b = binary.LittleEndian.AppendUint64(b, count)
+		b = binary.LittleEndian.AppendUint64(b, uint64(z.directorySize))
+		b = binary.LittleEndian.AppendUint64(b, uint64(z.directoryOffset))
+		b = binary.LittleEndian.AppendUint32(b, 0x07064b50)
+		b = binary.LittleEndian.AppendUint32(b, 0)
+		b = binary.LittleEndian.AppendUint64(b, uint64(end64))
+		b = binary.LittleEndian.AppendUint32(b, 1)
+	}
+	b = binary.LittleEndian.AppendUint32(b, 0x06054b50)
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	b = binary.LittleEndian.AppendUint16(b, uint16(min(count, zipUint16Max)))
+	b = binary.LittleEndian.AppendUint16(b, uint16(min(count, zipUint16Max)))
+	b = binary.LittleEndian.AppendUint32(b, uint32(min(z.directorySize, zipUint32Max)))
+	b = binary.LittleEndian.AppendUint32(b, uint32(min(z.directoryOffset, zipUint32Max)))
+	b = binary.LittleEndian.AppendUint16(b, 0) // comment
+	return b
+}
+
+// msDosTime encodes t (UTC) the way zip headers store it. Times before 1980
+// clamp to the format's epoch.
+func msDosTime(t time.Time) (uint16, uint16) {
+	t = t.UTC()
+	if t.Year() < 1980 {
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return uint16(t.Hour()<<11 | t.Minute()<<5 | t.Second()>>1),
+		uint16((t.Year()-1980)<<9 | int(t.Month())<<5 | t.Day())
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// ErrInvalidRange is returned by ParseByteRange for a range the archive
+// cannot satisfy.
+var ErrInvalidRange = errors.New("invalid range")
+
+// ParseByteRange parses a single-range Range header ("bytes=a-b", "bytes=a-"
+// or "bytes=-n") against a body of size bytes, returning [start, end).
+// Multi-range requests are not supported and report ok=false, so the whole
+// body is sent instead.
+func ParseByteRange(header string, size int64) (start, end int64, ok bool, err error) {
+	spec, found := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, ErrInvalidRange
+	}
+	if first == "" {
+		n, parseErr := strconv.ParseInt(last, 10, 64)
+		if parseErr != nil || n <= 0 {
+			return 0, 0, false, ErrInvalidRange
+		}
+		return max(size-n, 0), size, true, nil
+	}
+	start, parseErr := strconv.ParseInt(first, 10, 64)
+	if parseErr != nil || start < 0 || start >= size {
+		return 0, 0, false, ErrInvalidRange
+	}
+	end = size
+	if last != "" {
+		lastByte, parseErr := strconv.ParseInt(last, 10, 64)
+		if parseErr != nil || lastByte < start {
+			return 0, 0, false, ErrInvalidRange
+		}
+		end = min(lastByte+1, size)
+	}
+	return start, end, true, nil
+}
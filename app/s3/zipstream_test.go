@@ -0,0 +1,160 @@
+package s3
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hotosm/scaleodm/testutil"
+)
+
+func TestParseByteRange(t *testing.T) {
+	cases := []struct {
+		header     string
+		start, end int64
+		ok         bool
+		err        bool
+	}{
+		{header: "bytes=0-99", start: 0, end: 100, ok: true},
+		{header: "bytes=500-", start: 500, end: 1000, ok: true},
+		{header: "bytes=-100", start: 900, end: 1000, ok: true},
+		{header: "bytes=900-5000", start: 900, end: 1000, ok: true},
+		{header: "bytes=0-1,5-6"},
+		{header: "items=0-1"},
+		{header: "bytes=1000-", err: true},
+		{header: "bytes=5-1", err: true},
+		{header: "bytes=abc", err: true},
+	}
+	for _, tc := range cases {
+		start, end, ok, err := ParseByteRange(tc.header, 1000)
+		if tc.err {
+			assert.ErrorIs(t, err, ErrInvalidRange, tc.header)
+			continue
+		}
+		require.NoError(t, err, tc.header)
+		assert.Equal(t, tc.ok, ok, tc.header)
+		assert.Equal(t, tc.start, start, tc.header)
+		assert.Equal(t, tc.end, end, tc.header)
+	}
+}
+
+func TestZipEntries_SkipsSavedProjects(t *testing.T) {
+	prefix := "results/task-zip/"
+	entries := zipEntries(prefix, []minio.ObjectInfo{
+		{Key: prefix + "odm_orthophoto/odm_orthophoto.tif"},
+		{Key: prefix + "checkpoints/checkpoint.txt"},
+		{Key: prefix + "checkpoints/project/opensfm/reconstruction.json"},
+		{Key: prefix + "intermediates/project/opensfm/undistorted/images/a.jpg"},
+		{Key: prefix + "intermediates/rerun.txt"},
+		{Key: prefix + "all.zip"},
+	})
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.name
+	}
+	assert.Equal(t, []string{"all.zip", "odm_orthophoto/odm_orthophoto.tif"}, names)
+}
+
+// zipLayoutReader serves an archive laid out like NewZipArchive does with zeroed
+// entry data, so zip64 layouts can be checked without objects that large.
+type zipLayoutReader struct {
+	z         *ZipArchive
+	directory []byte
+}
+
+func (r zipLayoutReader) ReadAt(p []byte, off int64) (int, error) {
+	clear(p)
+	put := func(b []byte, at int64) {
+		for i := range b {
+			if o := at + int64(i) - off; o >= 0 && o < int64(len(p)) {
+				p[o] = b[i]
+			}
+		}
+	}
+	for i := range r.z.entries {
+		e := &r.z.entries[i]
+		put(e.header, e.offset)
+		put(e.descriptor(0), e.offset+int64(len(e.header))+e.size)
+	}
+	put(r.directory, r.z.directoryOffset)
+	if off+int64(len(p)) > r.z.size {
+		return int(r.z.size - off), io.EOF
+	}
+	return len(p), nil
+}
+
+func TestZipArchive_Zip64Layout(t *testing.T) {
+	sizes := []int64{5 << 30, 10, 4<<30 - 5}
+	z := &ZipArchive{crcs: map[string]uint32{}}
+	var offset int64
+	for i, size := range sizes {
+		e := zipEntry{name: fmt.Sprintf("file-%d.tif", i), size: size, offset: offset}
+		e.zip64 = e.size >= zipUint32Max || offset >= zipUint32Max
+		e.header = e.localHeader()
+		offset += int64(len(e.header)) + e.size + e.descriptorLen()
+		z.entries = append(z.entries, e)
+		z.crcs[e.name] = 0
+	}
+	z.directoryOffset = offset
+	for i := range z.entries {
+		z.directorySize += int64(zipCentralHeaderLen + len(z.entries[i].name) + len(z.entries[i].centralExtra()))
+	}
+	z.size = z.directoryOffset + z.directorySize + z.endLen()
+	require.True(t, z.zip64End())
+
+	directory := z.directory()
+	require.Equal(t, z.directorySize+z.endLen(), int64(len(directory)))
+	zr, err := zip.NewReader(zipLayoutReader{z: z, directory: directory}, z.size)
+	require.NoError(t, err)
+	require.Len(t, zr.File, len(sizes))
+	for i, f := range zr.File {
+		dataOffset, err := f.DataOffset()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(sizes[i]), f.UncompressedSize64)
+		assert.Equal(t, z.entries[i].offset+int64(len(z.entries[i].header)), dataOffset)
+	}
+}
+
+func TestZipArchive_WriteRangeMatchesWholeArchive(t *testing.T) {
+	ctx := context.Background()
+	bucket := "test-bucket-zip-range"
+	require.NoError(t, testutil.SetupTestS3Bucket(ctx, bucket))
+
+	client := testS3Client(t)
+	prefix := "results/task-range/"
+	putTestObject(t, client, bucket, prefix+"odm_orthophoto/odm_orthophoto.tif", string(bytes.Repeat([]byte("ortho"), 20000)))
+	putTestObject(t, client, bucket, prefix+"odm_dem/dsm.tif", string(bytes.Repeat([]byte("dsm"), 5000)))
+	putTestObject(t, client, bucket, prefix+"empty.txt", "")
+
+	archive, err := NewZipArchive(ctx, client, "s3://"+bucket+"/"+prefix)
+	require.NoError(t, err)
+	var whole bytes.Buffer
+	n, err := archive.WriteTo(ctx, &whole)
+	require.NoError(t, err)
+	require.Equal(t, archive.Size(), n)
+	_, err = zip.NewReader(bytes.NewReader(whole.Bytes()), int64(whole.Len()))
+	require.NoError(t, err)
+
+	ranges := [][2]int64{{0, 10}, {50, 60000}, {70000, archive.Size()}, {archive.Size() - 30, archive.Size()}}
+	for _, seed := range []bool{false, true} {
+		for _, r := range ranges {
+			resumed, err := NewZipArchive(ctx, client, "s3://"+bucket+"/"+prefix)
+			require.NoError(t, err)
+			require.Equal(t, archive.ETag(), resumed.ETag())
+			if seed {
+				resumed.SetCRCs(archive.CRCs())
+			}
+			var part bytes.Buffer
+			_, err = resumed.WriteRange(ctx, &part, r[0], r[1])
+			require.NoError(t, err)
+			assert.Equal(t, whole.Bytes()[r[0]:r[1]], part.Bytes(), "range %v seeded=%t", r, seed)
+		}
+	}
+}
@@ -14,7 +14,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/hotosm/scaleodm/app/auth"
 	"github.com/hotosm/scaleodm/app/meta"
+	"github.com/hotosm/scaleodm/app/reconciler"
 	"github.com/hotosm/scaleodm/app/workflows"
 )
 
@@ -144,8 +146,10 @@ func (h *Handler) reconcileJobFromArgo(ctx context.Context, job *meta.JobMetadat
 	liveStatus := meta.MapArgoPhaseToJobStatus(string(wf.Status.Phase))
 	dbStatus := strings.ToLower(strings.TrimSpace(job.JobStatus))
 	if dbStatus != liveStatus && meta.IsForwardJobStatusTransition(dbStatus, liveStatus) {
-		if updateErr := h.metadataStore.UpdateJobStatus(ctx, job.WorkflowName, liveStatus, nil); updateErr != nil {
+		if updateErr := h.metadataStore.UpdateJobStatus(meta.WithActor(ctx, meta.ActorUI, "argo_sync"), job.WorkflowName, liveStatus, nil); updateErr != nil {
 			log.Printf("UI reconcile: failed to sync status for %s: %v", job.WorkflowName, updateErr)
+		} else if meta.IsTerminalJobStatus(liveStatus) {
+			reconciler.RecordFinishedWorkflow(ctx, h.metadataStore, h.workflow, job, wf)
 		}
 		job.JobStatus = liveStatus
 	}
@@ -193,7 +197,7 @@ func (h *Handler) handleTaskDetailPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	job, err := h.metadataStore.GetJob(r.Context(), uuid)
+	job, err := h.metadataStore.GetJobForTenant(r.Context(), uuid, auth.TenantFromContext(r.Context()))
 	if err != nil {
 		http.Error(w, "failed to load task", http.StatusInternalServerError)
 		return
@@ -208,7 +212,7 @@ func (h *Handler) handleTaskDetailPage(w http.ResponseWriter, r *http.Request) {
 	data := taskDetailPageData{
 		Title:      "Task " + uuid,
 		ReadOnly:   h.readonly,
-		Task:       toTaskDetail(job, time.Now().UTC()),
+		Task:       h.taskDetail(r.Context(), job),
 		BannerText: "No authentication is enabled. Use this UI only on trusted internal networks.",
 		Version:    h.version,
 	}
@@ -262,7 +266,7 @@ func (h *Handler) handleTaskDetailJSON(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusNotFound, map[string]string{"error": "task not found"})
 		return
 	}
-	job, err := h.metadataStore.GetJob(r.Context(), uuid)
+	job, err := h.metadataStore.GetJobForTenant(r.Context(), uuid, auth.TenantFromContext(r.Context()))
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load task"})
 		return
@@ -274,7 +278,19 @@ func (h *Handler) handleTaskDetailJSON(w http.ResponseWriter, r *http.Request) {
 
 	h.reconcileJobFromArgo(r.Context(), job)
 
-	writeJSON(w, http.StatusOK, toTaskDetail(job, time.Now().UTC()))
+	writeJSON(w, http.StatusOK, h.taskDetail(r.Context(), job))
+}
+
+// taskDetail builds the task page's view with the task's timeline. A timeline
+// that fails to load is left empty rather than failing the page.
+func (h *Handler) taskDetail(ctx context.Context, job *meta.JobMetadata) taskDetail {
+	detail := toTaskDetail(job, time.Now().UTC())
+	events, err := h.metadataStore.ListJobEvents(ctx, job.WorkflowName)
+	if err != nil {
+		log.Printf("UI: failed to load timeline for %s: %v", job.WorkflowName, err)
+	}
+	detail.Timeline = toTaskTimeline(events)
+	return detail
 }
 
 // handleTaskOutput streams the workflow's log directly to the client as
@@ -287,7 +303,7 @@ func (h *Handler) handleTaskOutput(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	job, err := h.metadataStore.GetJob(r.Context(), uuid)
+	job, err := h.metadataStore.GetJobForTenant(r.Context(), uuid, auth.TenantFromContext(r.Context()))
 	if err != nil {
 		http.Error(w, "failed to load task", http.StatusInternalServerError)
 		return
@@ -332,11 +348,12 @@ func parsePage(raw string) (int, error) {
 	return value, nil
 }
 
-// listJobsPage fetches one page of jobs plus a lookahead row so the caller can
-// tell whether a next page exists. It returns the trimmed page and hasNext.
+// listJobsPage fetches one page of the caller's jobs plus a lookahead row so
+// the caller can tell whether a next page exists. It returns the trimmed page
+// and hasNext.
 func (h *Handler) listJobsPage(ctx context.Context, status, projectID string, limit, page int) ([]*meta.JobMetadata, bool, error) {
 	offset := (page - 1) * limit
-	jobs, err := h.metadataStore.ListJobs(ctx, status, projectID, limit+1, offset)
+	jobs, err := h.metadataStore.ListJobs(ctx, auth.TenantFromContext(ctx), status, projectID, limit+1, offset)
 	if err != nil {
 		return nil, false, err
 	}
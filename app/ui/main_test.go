@@ -31,6 +31,10 @@ func (c *testWorkflowClient) CreateODMWorkflow(ctx context.Context, cfg *workflo
 	return nil, errors.New("not implemented")
 }
 
+func (c *testWorkflowClient) RenderODMWorkflow(cfg *workflows.ODMPipelineConfig) (*wfv1.Workflow, error) {
+	return nil, errors.New("not implemented")
+}
+
 func (c *testWorkflowClient) GetWorkflow(ctx context.Context, name string) (*wfv1.Workflow, error) {
 	phase := c.phases[name]
 	return &wfv1.Workflow{
@@ -57,6 +61,19 @@ func (c *testWorkflowClient) GetWorkflowLogsWithArchiveFallback(ctx context.Cont
 	return err
 }
 
+func (c *testWorkflowClient) FollowWorkflowLogs(ctx context.Context, workflowName string, fromLine int, writer io.Writer) error {
+	_, err := io.WriteString(writer, c.logs)
+	return err
+}
+
+func (c *testWorkflowClient) ODMStage(ctx context.Context, workflowName string, since time.Time) (string, error) {
+	return "", nil
+}
+
+func (c *testWorkflowClient) ProcessUsage(ctx context.Context, workflowName string) (*workflows.ProcessUsage, error) {
+	return nil, nil
+}
+
 func (c *testWorkflowClient) WatchWorkflow(ctx context.Context, workflowName string) (*wfv1.Workflow, error) {
 	return nil, errors.New("not implemented")
 }
@@ -82,7 +99,7 @@ func testDB(t *testing.T) (*db.DB, func()) {
 	cleanup := func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
-		_, _ = database.Pool.Exec(ctx, "TRUNCATE TABLE scaleodm_job_metadata CASCADE")
+		_, _ = database.Pool.Exec(ctx, "TRUNCATE TABLE scaleodm_job_metadata, scaleodm_job_events CASCADE")
 		database.Close()
 	}
 
@@ -230,6 +247,9 @@ func TestTaskDetailEndpoints(t *testing.T) {
 	// than a list of links that would 404 on download.
 	assert.Nil(t, detail.Assets)
 	assert.Contains(t, jsonResp.Body.String(), `"assets":null`)
+	require.Len(t, detail.Timeline, 1)
+	assert.Equal(t, "Created", detail.Timeline[0].Label)
+	assert.Contains(t, pageResp.Body.String(), "Timeline")
 }
 
 func TestMissingTaskReturns404(t *testing.T) {
@@ -1,6 +1,11 @@
 package ui
 
-import "testing"
+import (
+	"testing"
+	"time"
+
+	"github.com/hotosm/scaleodm/app/meta"
+)
 
 func TestCompletedAssets(t *testing.T) {
 	// Still processing (or no output path) -> nil, i.e. JSON null.
@@ -93,3 +98,27 @@ func TestBuildTasksQuery(t *testing.T) {
 		}
 	}
 }
+
+func TestToTaskTimeline(t *testing.T) {
+	at := time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)
+	got := toTaskTimeline([]meta.JobEvent{
+		{Type: meta.JobEventCreated, ToStatus: "queued", Actor: "user:dronetm", CreatedAt: at},
+		{Type: meta.JobEventStatus, FromStatus: "running", ToStatus: "failed", Actor: meta.ActorReconciler, Reason: "argo_sync", Message: "ODM exited with code 1", CreatedAt: at},
+		{Type: "unknown", Actor: meta.ActorSystem, CreatedAt: at},
+	})
+	if len(got) != 3 {
+		t.Fatalf("got %d timeline rows, want 3", len(got))
+	}
+	if got[0].Label != "Created" || got[0].To != "queued" || got[0].Time != "2026-10-16T09:30:00Z" {
+		t.Errorf("unexpected created row: %+v", got[0])
+	}
+	if got[1].Label != "Status changed" || got[1].From != "running" || got[1].Reason != "argo_sync" || got[1].Message != "ODM exited with code 1" {
+		t.Errorf("unexpected status row: %+v", got[1])
+	}
+	if got[2].Label != "unknown" {
+		t.Errorf("unknown event types are shown as is, got %q", got[2].Label)
+	}
+	if empty := toTaskTimeline(nil); empty == nil || len(empty) != 0 {
+		t.Errorf("no events must give an empty timeline, got %#v", empty)
+	}
+}
@@ -2,6 +2,16 @@
   const TERMINAL = new Set(["completed", "failed", "canceled"]);
   const pad = (n) => String(n).padStart(2, "0");
 
+  // With API auth enabled, the UI pages and /ui/api need a token. Forward
+  // ?token= from the page URL so an operator can open /ui?token=... directly.
+  const token = new URLSearchParams(window.location.search).get("token");
+  const withToken = (url) => {
+    if (!token) return url;
+    const u = new URL(url, window.location.origin);
+    u.searchParams.set("token", token);
+    return u.pathname + u.search;
+  };
+
   // Load once, then refresh every ms until the task is terminal - a finished
   // task's logs and outputs no longer change, so polling can stop.
   const poll = (el, load, ms) => {
@@ -11,6 +21,21 @@
     }
   };
 
+  // Carry the token through server-rendered links and the filter form.
+  if (token) {
+    document.querySelectorAll('a[href^="/ui"]').forEach((a) => {
+      const href = a.getAttribute("href");
+      if (!href.startsWith("/ui/static/")) a.href = withToken(href);
+    });
+    document.querySelectorAll("form.filters").forEach((form) => {
+      const input = document.createElement("input");
+      input.type = "hidden";
+      input.name = "token";
+      input.value = token;
+      form.appendChild(input);
+    });
+  }
+
   // --- Logs ---------------------------------------------------------------
   const output = document.getElementById("task-output");
   const updated = document.getElementById("log-updated");
@@ -22,33 +47,51 @@
     );
   }
 
-  if (output && output.dataset.outputUrl) {
-    const loadOutput = async () => {
-      // Replacing textContent resets scroll to the top, so keep the reader
-      // where they are and only follow new output when already at the bottom.
+  if (output && output.dataset.streamUrl) {
+    // Each line arrives once as a Server-Sent Event. The browser reconnects
+    // by itself and resumes after the last line it got (Last-Event-ID).
+    const source = new EventSource(withToken(output.dataset.streamUrl));
+    let pending = [];
+    let started = false;
+    const stamp = () => {
+      if (!updated) return;
+      const t = new Date();
+      updated.textContent = `Updated ${pad(t.getHours())}:${pad(t.getMinutes())}:${pad(t.getSeconds())}`;
+    };
+    // Lines are appended once a frame, so catching up on a long log does
+    // not re-layout the page per line. Keep the reader where they are and
+    // only follow new output when already at the bottom.
+    const flush = () => {
       const atBottom =
         output.scrollHeight - output.scrollTop - output.clientHeight < 20;
-      const prevScroll = output.scrollTop;
-      try {
-        const response = await fetch(output.dataset.outputUrl, {
-          headers: { Accept: "text/plain" },
-          cache: "no-store",
-        });
-        if (!response.ok) {
-          output.textContent = "Failed to load logs (" + response.status + ")";
-          return;
-        }
-        output.textContent = await response.text();
-        output.scrollTop = atBottom ? output.scrollHeight : prevScroll;
-        if (updated) {
-          const t = new Date();
-          updated.textContent = `Updated ${pad(t.getHours())}:${pad(t.getMinutes())}:${pad(t.getSeconds())}`;
-        }
-      } catch (error) {
+      if (!started) {
+        output.textContent = "";
+        started = true;
+      }
+      output.appendChild(document.createTextNode(pending.join("")));
+      pending = [];
+      if (atBottom) output.scrollTop = output.scrollHeight;
+      stamp();
+    };
+    source.onmessage = (event) => {
+      if (!pending.length) requestAnimationFrame(flush);
+      pending.push(event.data + "\n");
+    };
+    source.addEventListener("end", () => {
+      source.close();
+      if (!started && !pending.length) output.textContent = "No logs yet.";
+      stamp();
+    });
+    source.addEventListener("failed", (event) => {
+      source.close();
+      output.appendChild(document.createTextNode("\n" + (event.data || "Failed to load logs") + "\n"));
+    });
+    source.onerror = () => {
+      // Non-200 responses close the stream instead of retrying.
+      if (source.readyState === EventSource.CLOSED && !started) {
         output.textContent = "Failed to load logs";
       }
     };
-    poll(output, loadOutput, 5000);
   }
 
   // --- Downloads ----------------------------------------------------------
@@ -66,7 +109,7 @@
 
     const loadAssets = async () => {
       try {
-        const response = await fetch(downloads.dataset.detailUrl, {
+        const response = await fetch(withToken(downloads.dataset.detailUrl), {
           headers: { Accept: "application/json" },
           cache: "no-store",
         });
@@ -83,7 +126,7 @@
         for (const asset of assets) {
           const li = document.createElement("li");
           const link = document.createElement("a");
-          link.href = asset.url;
+          link.href = withToken(asset.url);
           link.textContent = asset.name;
           li.appendChild(link);
           downloads.appendChild(li);
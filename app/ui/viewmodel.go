@@ -27,6 +27,7 @@ type taskSummary struct {
 	StatusLabel  string `json:"statusLabel"`
 	StatusCode   int    `json:"statusCode"`
 	Progress     int    `json:"progress"`
+	Stage        string `json:"stage,omitempty"`
 	CreatedAt    string `json:"createdAt"`
 	StartedAt    string `json:"startedAt,omitempty"`
 	CompletedAt  string `json:"completedAt,omitempty"`
@@ -44,13 +45,25 @@ type taskAsset struct {
 }
 
 type taskDetail struct {
-	Task    taskSummary  `json:"task"`
-	ReadS3  string       `json:"readS3Path"`
-	WriteS3 string       `json:"writeS3Path"`
-	Region  string       `json:"s3Region"`
-	Error   string       `json:"error,omitempty"`
-	Options []taskOption `json:"options"`
-	Assets  []taskAsset  `json:"assets"`
+	Task     taskSummary  `json:"task"`
+	ReadS3   string       `json:"readS3Path"`
+	WriteS3  string       `json:"writeS3Path"`
+	Region   string       `json:"s3Region"`
+	Error    string       `json:"error,omitempty"`
+	Options  []taskOption `json:"options"`
+	Assets   []taskAsset  `json:"assets"`
+	Timeline []taskEvent  `json:"timeline"`
+}
+
+// taskEvent is a row of the task page's timeline.
+type taskEvent struct {
+	Time    string `json:"time"`
+	Label   string `json:"label"`
+	From    string `json:"from,omitempty"`
+	To      string `json:"to,omitempty"`
+	Actor   string `json:"actor"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
 }
 
 type tasksPageData struct {
@@ -110,6 +123,9 @@ func toTaskSummary(job *meta.JobMetadata, now time.Time) taskSummary {
 		CreatedAt:    formatTime(job.CreatedAt),
 		CreatedAtAgo: humanDuration(now.Sub(job.CreatedAt)),
 	}
+	if statusCode == statusCodeRunning {
+		summary.Progress, summary.Stage = recordedProgress(job.Metadata, progress)
+	}
 	if job.StartedAt != nil {
 		summary.StartedAt = formatTime(*job.StartedAt)
 	}
@@ -135,6 +151,39 @@ func toTaskDetail(job *meta.JobMetadata, now time.Time) taskDetail {
 	return detail
 }
 
+func toTaskTimeline(events []meta.JobEvent) []taskEvent {
+	timeline := make([]taskEvent, 0, len(events))
+	for _, event := range events {
+		timeline = append(timeline, taskEvent{
+			Time:    formatTime(event.CreatedAt),
+			Label:   eventLabel(event.Type),
+			From:    event.FromStatus,
+			To:      event.ToStatus,
+			Actor:   event.Actor,
+			Reason:  event.Reason,
+			Message: event.Message,
+		})
+	}
+	return timeline
+}
+
+func eventLabel(eventType string) string {
+	switch eventType {
+	case meta.JobEventCreated:
+		return "Created"
+	case meta.JobEventStatus:
+		return "Status changed"
+	case meta.JobEventDispatched:
+		return "Submitted to Argo"
+	case meta.JobEventDispatchFailed:
+		return "Submission failed"
+	case meta.JobEventRestarted:
+		return "Restarted"
+	default:
+		return eventType
+	}
+}
+
 func mapStatus(status string) (code int, label string, progress int) {
 	switch strings.ToLower(strings.TrimSpace(status)) {
 	case "queued", "claimed":
@@ -152,6 +201,21 @@ func mapStatus(status string) (code int, label string, progress int) {
 	}
 }
 
+// recordedProgress returns the progress and stage the reconciler recorded for
+// a running job, or fallback before it has recorded any.
+func recordedProgress(raw json.RawMessage, fallback int) (int, string) {
+	var metadata map[string]interface{}
+	if len(raw) == 0 || json.Unmarshal(raw, &metadata) != nil {
+		return fallback, ""
+	}
+	progress, ok := metadata[meta.MetadataProgressKey].(float64)
+	if !ok {
+		return fallback, ""
+	}
+	stage, _ := metadata[meta.MetadataStageKey].(string)
+	return int(progress), stage
+}
+
 func formatTime(t time.Time) string {
 	return t.UTC().Format(time.RFC3339)
 }
@@ -218,6 +282,7 @@ var primaryAssetDefs = []primaryAssetDef{
 	{name: "dsm.tif", alias: "dsm"},
 	{name: "dtm.tif", alias: "dtm"},
 	{name: "point cloud", alias: "point_cloud"},
+	{name: "point cloud (COPC)", alias: "copc"},
 }
 
 // taskDownloadURL points at the /ui-scoped download route (an alias for the
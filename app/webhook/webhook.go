@@ -0,0 +1,241 @@
+// Package webhook delivers task webhooks from the outbox.
+//
+// When a task whose caller set a webhook reaches a terminal status, the
+// status update queues a row in scaleodm_webhook_deliveries in the same
+// transaction, so a notification is neither lost when a pod restarts nor
+// sent once per replica. This goroutine, started alongside the reconciler,
+// claims due rows one at a time (FOR UPDATE SKIP LOCKED, leased so a row
+// held by a replica that died becomes due again) and POSTs the task's info,
+// as GET /task/{uuid}/info returns it and as NodeODM posts it. A failed
+// attempt is retried with exponential backoff; after MaxAttempts the row is
+// dead-lettered and kept for inspection.
+//
+// # Signatures
+//
+// Each request carries X-ScaleODM-Delivery (the row id, stable across
+// retries, for de-duplication) and X-ScaleODM-Timestamp (Unix seconds). When
+// the task's tenant has a secret in scaleodm_tenant_webhook_secrets, or else
+// SCALEODM_WEBHOOK_SECRET is set, X-ScaleODM-Signature is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)). Receivers
+// should recompute it and reject stale timestamps.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hotosm/scaleodm/app/meta"
+)
+
+// maxDeliveriesPerTick bounds the work done in one tick, so a backlog left by
+// an unreachable receiver is drained gradually.
+const maxDeliveriesPerTick = 20
+
+// Backoff between attempts: retryBaseDelay doubled per failed attempt, capped
+// at retryMaxDelay. With the default 10 attempts a delivery is retried for
+// about three hours.
+const (
+	retryBaseDelay = 30 * time.Second
+	retryMaxDelay  = time.Hour
+)
+
+// Options tune the delivery worker; see the SCALEODM_WEBHOOK_* settings.
+type Options struct {
+	Interval      time.Duration
+	Timeout       time.Duration
+	MaxAttempts   int
+	DefaultSecret string
+	// Payload renders the body for a task; main wires it to the task info
+	// of the API.
+	Payload func(job *meta.JobMetadata) ([]byte, error)
+}
+
+// outbox is the subset of meta.Store the worker uses.
+type outbox interface {
+	ClaimWebhookDelivery(ctx context.Context, lease time.Duration) (*meta.WebhookDelivery, error)
+	CompleteWebhookDelivery(ctx context.Context, id int64, payload json.RawMessage) error
+	RetryWebhookDelivery(ctx context.Context, id int64, payload json.RawMessage, errorMsg string, next time.Time) error
+	DeadLetterWebhookDelivery(ctx context.Context, id int64, payload json.RawMessage, errorMsg string) error
+	GetJob(ctx context.Context, workflowName string) (*meta.JobMetadata, error)
+	GetTenantWebhookSecret(ctx context.Context, tenant string) (string, error)
+}
+
+// Start spawns a background goroutine that delivers due webhooks on the
+// given interval. The goroutine exits when ctx is cancelled.
+func Start(ctx context.Context, store *meta.Store, opts Options) {
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 10
+	}
+	go run(ctx, store, &http.Client{Timeout: opts.Timeout}, opts)
+}
+
+func run(ctx context.Context, box outbox, client *http.Client, opts Options) {
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	log.Printf("webhook: started (interval=%s, timeout=%s, max_attempts=%d)", opts.Interval, opts.Timeout, opts.MaxAttempts)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("webhook: stopped")
+			return
+		case <-ticker.C:
+			deliverDue(ctx, box, client, opts)
+		}
+	}
+}
+
+// deliverDue runs one tick and returns how many deliveries it attempted.
+func deliverDue(ctx context.Context, box outbox, client *http.Client, opts Options) int {
+	// The lease outlasts the request, so no other replica takes the row
+	// while it is in flight.
+	lease := opts.Timeout + 30*time.Second
+	attempted := 0
+	for attempted < maxDeliveriesPerTick {
+		delivery, err := box.ClaimWebhookDelivery(ctx, lease)
+		if err != nil {
+			log.Printf("webhook: failed to claim delivery: %v", err)
+			break
+		}
+		if delivery == nil {
+			break
+		}
+		attempted++
+		deliver(ctx, box, client, opts, delivery)
+	}
+	return attempted
+}
+
+// deliver makes one attempt at a claimed delivery and records the outcome.
+func deliver(ctx context.Context, box outbox, client *http.Client, opts Options, delivery *meta.WebhookDelivery) {
+	payload := delivery.Payload
+	if payload == nil {
+		rendered, err := renderPayload(ctx, box, opts, delivery.WorkflowName)
+		if err != nil {
+			log.Printf("webhook: dead-lettering delivery %d for %q: %v", delivery.ID, delivery.WorkflowName, err)
+			if err := box.DeadLetterWebhookDelivery(ctx, delivery.ID, nil, err.Error()); err != nil {
+				log.Printf("webhook: failed to dead-letter delivery %d: %v", delivery.ID, err)
+			}
+			return
+		}
+		payload = rendered
+	}
+
+	secret := opts.DefaultSecret
+	if delivery.Tenant != "" {
+		tenantSecret, err := box.GetTenantWebhookSecret(ctx, delivery.Tenant)
+		if err != nil {
+			// Unsigned would be rejected; try again later.
+			log.Printf("webhook: failed to get secret for tenant %q: %v", delivery.Tenant, err)
+			retry(ctx, box, opts, delivery, payload, err)
+			return
+		}
+		if tenantSecret != "" {
+			secret = tenantSecret
+		}
+	}
+
+	if err := post(ctx, client, delivery, payload, secret, time.Now()); err != nil {
+		log.Printf("webhook: delivery %d for %q attempt %d failed: %v", delivery.ID, delivery.WorkflowName, delivery.Attempts, err)
+		retry(ctx, box, opts, delivery, payload, err)
+		return
+	}
+	if err := box.CompleteWebhookDelivery(ctx, delivery.ID, payload); err != nil {
+		log.Printf("webhook: delivered %d for %q but failed to record it: %v", delivery.ID, delivery.WorkflowName, err)
+		return
+	}
+	log.Printf("webhook: delivered %d for %q status=%s attempt=%d", delivery.ID, delivery.WorkflowName, delivery.JobStatus, delivery.Attempts)
+}
+
+func renderPayload(ctx context.Context, box outbox, opts Options, workflowName string) (json.RawMessage, error) {
+	job, err := box.GetJob(ctx, workflowName)
+	if err != nil {
+		return nil, fmt.Errorf("get task: %w", err)
+	}
+	if job == nil {
+		return nil, errors.New("task was removed before its webhook was delivered")
+	}
+	payload, err := opts.Payload(job)
+	if err != nil {
+		return nil, fmt.Errorf("render payload: %w", err)
+	}
+	return payload, nil
+}
+
+// retry schedules the next attempt after a failed one, or dead-letters the
+// delivery once it has used MaxAttempts.
+func retry(ctx context.Context, box outbox, opts Options, delivery *meta.WebhookDelivery, payload json.RawMessage, cause error) {
+	if delivery.Attempts >= opts.MaxAttempts {
+		log.Printf("webhook: giving up on delivery %d for %q after %d attempts", delivery.ID, delivery.WorkflowName, delivery.Attempts)
+		if err := box.DeadLetterWebhookDelivery(ctx, delivery.ID, payload, cause.Error()); err != nil {
+			log.Printf("webhook: failed to dead-letter delivery %d: %v", delivery.ID, err)
+		}
+		return
+	}
+	next := time.Now().Add(retryDelay(delivery.Attempts))
+	if err := box.RetryWebhookDelivery(ctx, delivery.ID, payload, cause.Error(), next); err != nil {
+		log.Printf("webhook: failed to reschedule delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// retryDelay is the wait after the given number of failed attempts.
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, retryMaxDelay)
+}
+
+func post(ctx context.Context, client *http.Client, delivery *meta.WebhookDelivery, payload []byte, secret string, now time.Time) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-ScaleODM-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-ScaleODM-Timestamp", timestamp)
+	if secret != "" {
+		req.Header.Set("X-ScaleODM-Signature", Signature(secret, timestamp, payload))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Drain a little so the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Signature is the X-ScaleODM-Signature value for a body sent at timestamp
+// (Unix seconds), for receivers written in Go to check against.
+func Signature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,160 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hotosm/scaleodm/app/meta"
+)
+
+type fakeOutbox struct {
+	pending       []*meta.WebhookDelivery
+	jobs          map[string]*meta.JobMetadata
+	secrets       map[string]string
+	completed     map[int64]json.RawMessage
+	retried       map[int64]time.Time
+	retryPayloads map[int64]json.RawMessage
+	dead          map[int64]string
+}
+
+func newFakeOutbox(deliveries ...*meta.WebhookDelivery) *fakeOutbox {
+	return &fakeOutbox{
+		pending:       deliveries,
+		jobs:          map[string]*meta.JobMetadata{},
+		secrets:       map[string]string{},
+		completed:     map[int64]json.RawMessage{},
+		retried:       map[int64]time.Time{},
+		retryPayloads: map[int64]json.RawMessage{},
+		dead:          map[int64]string{},
+	}
+}
+
+func (o *fakeOutbox) ClaimWebhookDelivery(context.Context, time.Duration) (*meta.WebhookDelivery, error) {
+	if len(o.pending) == 0 {
+		return nil, nil
+	}
+	delivery := o.pending[0]
+	o.pending = o.pending[1:]
+	delivery.Attempts++
+	return delivery, nil
+}
+
+func (o *fakeOutbox) CompleteWebhookDelivery(_ context.Context, id int64, payload json.RawMessage) error {
+	o.completed[id] = payload
+	return nil
+}
+
+func (o *fakeOutbox) RetryWebhookDelivery(_ context.Context, id int64, payload json.RawMessage, _ string, next time.Time) error {
+	o.retried[id] = next
+	o.retryPayloads[id] = payload
+	return nil
+}
+
+func (o *fakeOutbox) DeadLetterWebhookDelivery(_ context.Context, id int64, _ json.RawMessage, errorMsg string) error {
+	o.dead[id] = errorMsg
+	return nil
+}
+
+func (o *fakeOutbox) GetJob(_ context.Context, name string) (*meta.JobMetadata, error) {
+	return o.jobs[name], nil
+}
+
+func (o *fakeOutbox) GetTenantWebhookSecret(_ context.Context, tenant string) (string, error) {
+	return o.secrets[tenant], nil
+}
+
+func testOptions() Options {
+	return Options{
+		Timeout:       time.Second,
+		MaxAttempts:   3,
+		DefaultSecret: "default-secret",
+		Payload: func(job *meta.JobMetadata) ([]byte, error) {
+			return json.Marshal(map[string]any{"uuid": job.WorkflowName, "status": map[string]int{"code": meta.NodeODMStatusCode(job.JobStatus)}})
+		},
+	}
+}
+
+func TestDeliverDue_SignsWithTenantSecret(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	box := newFakeOutbox(&meta.WebhookDelivery{ID: 7, WorkflowName: "wf-1", Tenant: "dronetm", URL: server.URL, JobStatus: "completed"})
+	box.jobs["wf-1"] = &meta.JobMetadata{WorkflowName: "wf-1", JobStatus: "completed"}
+	box.secrets["dronetm"] = "tenant-secret"
+
+	assert.Equal(t, 1, deliverDue(context.Background(), box, server.Client(), testOptions()))
+
+	require.NotNil(t, got)
+	assert.JSONEq(t, `{"uuid": "wf-1", "status": {"code": 40}}`, string(body))
+	assert.Equal(t, "application/json", got.Header.Get("Content-Type"))
+	assert.Equal(t, "7", got.Header.Get("X-ScaleODM-Delivery"))
+	timestamp := got.Header.Get("X-ScaleODM-Timestamp")
+	assert.Equal(t, Signature("tenant-secret", timestamp, body), got.Header.Get("X-ScaleODM-Signature"))
+	assert.Equal(t, json.RawMessage(body), box.completed[7])
+}
+
+func TestDeliverDue_RetriesThenDeadLetters(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	delivery := &meta.WebhookDelivery{ID: 3, WorkflowName: "wf-2", URL: server.URL, JobStatus: "failed"}
+	box := newFakeOutbox(delivery)
+	box.jobs["wf-2"] = &meta.JobMetadata{WorkflowName: "wf-2", JobStatus: "failed"}
+	opts := testOptions()
+
+	before := time.Now()
+	deliverDue(context.Background(), box, server.Client(), opts)
+	require.Contains(t, box.retried, int64(3))
+	assert.WithinDuration(t, before.Add(retryBaseDelay), box.retried[3], 5*time.Second)
+	require.NotNil(t, box.retryPayloads[3], "the rendered payload is kept for the retries")
+
+	// The remaining attempts resend the stored payload, even after the task
+	// is gone, and the last one dead-letters.
+	delete(box.jobs, "wf-2")
+	delivery.Payload = box.retryPayloads[3]
+	for delivery.Attempts < opts.MaxAttempts {
+		box.pending = append(box.pending, delivery)
+		deliverDue(context.Background(), box, server.Client(), opts)
+	}
+	assert.Equal(t, "receiver returned HTTP 502", box.dead[3])
+	assert.Empty(t, box.completed)
+}
+
+func TestDeliverDue_DeadLettersRemovedTask(t *testing.T) {
+	box := newFakeOutbox(&meta.WebhookDelivery{ID: 9, WorkflowName: "wf-gone", URL: "http://127.0.0.1:1/hook", JobStatus: "canceled"})
+
+	deliverDue(context.Background(), box, http.DefaultClient, testOptions())
+	assert.Contains(t, box.dead[9], "removed")
+	assert.Empty(t, box.retried)
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, 30*time.Second, retryDelay(1))
+	assert.Equal(t, time.Minute, retryDelay(2))
+	assert.Equal(t, 8*time.Minute, retryDelay(5))
+	assert.Equal(t, time.Hour, retryDelay(9))
+	assert.Equal(t, time.Hour, retryDelay(100))
+}
+
+func TestSignature(t *testing.T) {
+	// echo -n '1700000000.{"uuid":"a"}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t,
+		"sha256=fc2027b26a0a79980c9348e96535089aeaf4b823aae80e7e39a3167d6af9e842",
+		Signature("secret", "1700000000", []byte(`{"uuid":"a"}`)))
+	assert.NotEqual(t, Signature("secret", "1700000000", []byte(`{}`)), Signature("other", "1700000000", []byte(`{}`)))
+}
@@ -0,0 +1,75 @@
+package workflows
+
+import (
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// With ODMPipelineConfig.CreateAllZip an "all-zip" stage runs before upload
+// and packs the task's outputs into all.zip, as NodeODM does, so the upload
+// stage copies a real archive to writeS3Path and downloads of all.zip are a
+// redirect to S3 instead of being zipped by the API. The archive costs
+// workspace space equal to the outputs.
+
+// AllZipStage names the stage that writes all.zip.
+const AllZipStage = "all-zip"
+
+// allZipScript runs in the ODM image with the task's workspace directory as
+// its argument. It skips what the upload stage does not copy (the imagery,
+// rclone config, checkpoint state, submodels and undistorted images) and
+// stores entries uncompressed: ODM's rasters and point clouds are already
+// compressed.
+const allZipScript = `import os
+import sys
+import zipfile
+
+root = sys.argv[1]
+target = os.path.join(root, "all.zip")
+partial = target + ".partial"
+skip_top = {"images", ".rclone", ".scaleodm", "submodels"}
+
+count = 0
+with zipfile.ZipFile(partial, "w", zipfile.ZIP_STORED, allowZip64=True) as archive:
+    for dirpath, dirnames, filenames in os.walk(root):
+        rel_dir = os.path.relpath(dirpath, root)
+        if rel_dir == ".":
+            dirnames[:] = [d for d in dirnames if d not in skip_top]
+        dirnames[:] = sorted(
+            d for d in dirnames
+            if not (d == "undistorted" and os.path.basename(dirpath) == "opensfm")
+        )
+        for name in sorted(filenames):
+            path = os.path.join(dirpath, name)
+            arcname = os.path.relpath(path, root)
+            if arcname in ("all.zip", "all.zip.partial") or os.path.islink(path):
+                continue
+            archive.write(path, arcname)
+            count += 1
+os.replace(partial, target)
+print("all.zip: %d files, %d bytes" % (count, os.path.getsize(target)))
+`
+
+func generateAllZipScript() string {
+	return odmScriptPreamble + `echo "=== all-zip attempt {{retries}} @ $(date -u +%Y-%m-%dT%H:%M:%SZ) ==="
+cat > /tmp/scaleodm-all-zip.py <<'ALL_ZIP_EOF'
+` + allZipScript + `ALL_ZIP_EOF
+python3 -u /tmp/scaleodm-all-zip.py "/workspace/$JOB_ID"
+`
+}
+
+// allZipContainer is the all-zip stage of the single-pod pipeline, run after
+// the stage named after.
+func allZipContainer(cfg *ODMPipelineConfig, after string) wfv1.ContainerNode {
+	return wfv1.ContainerNode{
+		Container: apiv1.Container{
+			Name:            AllZipStage,
+			Image:           cfg.ODMImage,
+			Command:         []string{"/bin/bash", "-c"},
+			Args:            []string{generateAllZipScript()},
+			Env:             odmProcessEnvVars(),
+			Resources:       containerRequirements(cfg.UploadResources),
+			SecurityContext: workflowContainerSecurityContext(),
+		},
+		Dependencies: []string{after},
+	}
+}
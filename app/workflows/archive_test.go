@@ -0,0 +1,95 @@
+package workflows
+
+import (
+	"archive/zip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildODMWorkflow_CreateAllZip(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/images/", "s3://bucket/output/", nil)
+	cfg.CreateAllZip = true
+	cfg.SkipPostProcessing = true
+	wf := client.buildODMWorkflow(cfg)
+
+	containers := wf.Spec.Templates[0].ContainerSet.Containers
+	names := make([]string, len(containers))
+	for i, c := range containers {
+		names[i] = c.Name
+	}
+	require.Equal(t, []string{"download", "process", AllZipStage, "upload"}, names)
+	assert.Equal(t, []string{"process"}, containers[2].Dependencies)
+	assert.Equal(t, cfg.ODMImage, containers[2].Image)
+	assert.Contains(t, containers[2].Args[0], "zipfile.ZIP_STORED")
+	assert.Equal(t, []string{AllZipStage}, containers[3].Dependencies)
+
+	cfg.CreateAllZip = false
+	containers = client.buildODMWorkflow(cfg).Spec.Templates[0].ContainerSet.Containers
+	require.Len(t, containers, 3)
+	assert.Equal(t, []string{"process"}, containers[2].Dependencies)
+}
+
+func TestBuildODMWorkflow_SplitMergeCreateAllZip(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+	cfg := splitMergeTestConfig("ReadWriteMany")
+	cfg.CreateAllZip = true
+	cfg.SkipPostProcessing = true
+	wf := client.buildODMWorkflow(cfg)
+
+	tasks := map[string]wfv1.DAGTask{}
+	for _, task := range wf.Spec.Templates[0].DAG.Tasks {
+		tasks[task.Name] = task
+	}
+	assert.Equal(t, []string{"merge"}, tasks[AllZipStage].Dependencies)
+	assert.Equal(t, []string{AllZipStage}, tasks["upload"].Dependencies)
+}
+
+func TestAllZipScript_SkipsWhatUploadSkips(t *testing.T) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 not available")
+	}
+	root := t.TempDir()
+	for _, name := range []string{
+		"odm_orthophoto/odm_orthophoto.tif",
+		"odm_report/report.pdf",
+		"opensfm/reconstruction.json",
+		"opensfm/undistorted/images/a.tif",
+		"images/DJI_0001.JPG",
+		"submodels/submodel_0000/odm_orthophoto.tif",
+		".rclone/rclone.conf",
+		"all.zip",
+	} {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(name), 0o644))
+	}
+
+	script := filepath.Join(t.TempDir(), "all_zip.py")
+	require.NoError(t, os.WriteFile(script, []byte(allZipScript), 0o644))
+	out, err := exec.Command(python, script, root).CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	archive, err := zip.OpenReader(filepath.Join(root, "all.zip"))
+	require.NoError(t, err)
+	defer archive.Close()
+	var names []string
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{
+		"odm_orthophoto/odm_orthophoto.tif",
+		"odm_report/report.pdf",
+		"opensfm/reconstruction.json",
+	}, names)
+}
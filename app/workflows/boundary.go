@@ -66,22 +66,28 @@ func ParseBoundaryValue(raw string) (BoundarySource, string, error) {
 }
 
 func validateBoundaryS3Path(value string) error {
+	return validateObjectS3Path("boundary s3 path", value)
+}
+
+// validateObjectS3Path checks an s3:// URL naming a single object that a
+// download script fetches. field prefixes the error messages.
+func validateObjectS3Path(field, value string) error {
 	rest := strings.TrimPrefix(value, "s3://")
 	if rest == "" || strings.HasPrefix(rest, "/") {
-		return fmt.Errorf("boundary s3 path must be s3://bucket/key")
+		return fmt.Errorf("%s must be s3://bucket/key", field)
 	}
 	if !strings.Contains(rest, "/") {
-		return fmt.Errorf("boundary s3 path must name an object, not just a bucket")
+		return fmt.Errorf("%s must name an object, not just a bucket", field)
 	}
 	if strings.HasSuffix(rest, "/") {
-		return fmt.Errorf("boundary s3 path must name an object, not a prefix")
+		return fmt.Errorf("%s must name an object, not a prefix", field)
 	}
 	if strings.Contains(value, "..") {
-		return fmt.Errorf("boundary s3 path must not contain '..'")
+		return fmt.Errorf("%s must not contain '..'", field)
 	}
 	// The path is embedded in the rclone shell script.
 	if !shellSafeBoundaryPattern.MatchString(value) {
-		return fmt.Errorf("boundary s3 path contains invalid characters")
+		return fmt.Errorf("%s contains invalid characters", field)
 	}
 	return nil
 }
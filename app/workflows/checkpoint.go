@@ -0,0 +1,128 @@
+package workflows
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/hotosm/scaleodm/app/config"
+	"github.com/hotosm/scaleodm/app/s3"
+)
+
+// With ODMPipelineConfig.Checkpoint a "checkpoint" stage runs beside ODM in
+// the single-pod pipeline. Each time ODM finishes one of CheckpointStages,
+// it copies the project directory to s3.CheckpointPath(WriteS3Path). When
+// the pod is lost - a spot node reclaimed mid-openmvs - the retried attempt
+// downloads the imagery, restores the checkpoint and runs ODM with
+// --rerun-from the stage after it, instead of from scratch on what may be a
+// fresh workspace. A task restarted with /task/restart does the same
+// (ResumeCheckpoint). A checkpoint is only restored into a run with the same
+// ODM image and options, and is removed once the task's outputs are
+// uploaded or by /task/remove. Split-merge, merge-existing and city-scale
+// tasks are not checkpointed.
+
+// CheckpointStage names the stage that checkpoints the ODM project.
+const CheckpointStage = "checkpoint"
+
+// parseCheckpointStages parses SCALEODM_CHECKPOINT_STAGES, a comma-separated
+// list of ODM stages, dropping any ODM does not have.
+func parseCheckpointStages(raw string) []string {
+	var stages []string
+	for _, item := range strings.Split(raw, ",") {
+		name := strings.TrimSpace(item)
+		for _, s := range odmStages {
+			if s.marker == name {
+				stages = append(stages, name)
+				break
+			}
+		}
+	}
+	return stages
+}
+
+// DefaultCheckpointStages returns the configured checkpoint stages.
+func DefaultCheckpointStages() []string {
+	return parseCheckpointStages(config.SCALEODM_CHECKPOINT_STAGES)
+}
+
+// checkpointing reports whether cfg's pipeline checkpoints ODM.
+func checkpointing(cfg *ODMPipelineConfig) bool {
+	return cfg.Checkpoint && len(cfg.CheckpointStages) > 0 && Resumable(cfg.ProcessingMode, cfg.Split)
+}
+
+// checkpointFingerprint identifies the ODM image and options a checkpoint
+// was made with. --max-concurrency is left out: it follows the pod's CPU
+// limit, which a restart may size differently.
+func checkpointFingerprint(odmImage string, odmFlags []string) string {
+	h := sha256.New()
+	h.Write([]byte(odmImage))
+	for _, f := range odmFlags {
+		if f == "--max-concurrency" || strings.HasPrefix(f, "--max-concurrency=") {
+			continue
+		}
+		h.Write([]byte("\n" + f))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// checkpointProcessPrelude opens the process script of a checkpointed task.
+// Its exit trap tells the checkpoint stage that the process stage is done,
+// wherever it ended. A SIGKILL, as in an OOM kill of the container, skips
+// the trap, so it also keeps a heartbeat that dies with the container.
+func checkpointProcessPrelude() string {
+	return `STATE_DIR="/workspace/$JOB_ID/` + s3.CheckpointStateDir + `"
+mkdir -p "$STATE_DIR"
+(while :; do
+  date +%s > "$STATE_DIR/heartbeat.tmp" && mv "$STATE_DIR/heartbeat.tmp" "$STATE_DIR/heartbeat"
+  sleep ` + strconv.Itoa(s3.CheckpointHeartbeatSeconds) + `
+done) >/dev/null 2>&1 &
+heartbeat=$!
+trap 'code=$?; kill "$heartbeat" 2>/dev/null; echo $code > "$STATE_DIR/process-exit"' EXIT
+`
+}
+
+// checkpointODMRun runs ODM with $odm_args like the plain process script,
+// but adds --rerun-from when the download stage restored a checkpoint or a
+// rerun's project, and records each stage boundary ODM logs for the
+// checkpoint stage.
+func checkpointODMRun() string {
+	return `resume_from=$(cat "$STATE_DIR/resume-from" 2>/dev/null || true)
+if [[ $resume_from =~ ^[a-z_]+$ ]]; then
+  echo "Resuming from checkpoint at the $resume_from stage"
+  odm_args="--rerun-from $resume_from $odm_args"
+fi
+echo "Executing: python3 -u run.py $odm_args"
+python3 -u run.py $odm_args 2>&1 | {
+  completed=""
+  while IFS= read -r line || [ -n "$line" ]; do
+    printf '%s\n' "$line"
+    if [[ $line =~ Running\ ([a-z_]+)\ stage ]]; then
+      if [ -n "$completed" ]; then
+        echo "$completed ${BASH_REMATCH[1]}" > "$STATE_DIR/stage.tmp" && mv "$STATE_DIR/stage.tmp" "$STATE_DIR/stage"
+      fi
+      completed=${BASH_REMATCH[1]}
+    fi
+  done
+}`
+}
+
+// checkpointContainer is the checkpoint stage, started alongside ODM once
+// the stages in after are done.
+func checkpointContainer(cfg *ODMPipelineConfig, fingerprint string, after []string) wfv1.ContainerNode {
+	return wfv1.ContainerNode{
+		Container: apiv1.Container{
+			Name:            CheckpointStage,
+			Image:           cfg.RcloneImage,
+			Command:         []string{"/bin/sh", "-c"},
+			Args:            []string{s3.GenerateCheckpointScript(s3.CheckpointPath(cfg.WriteS3Path), fingerprint, cfg.CheckpointStages)},
+			Env:             s3SecretEnvVars(cfg),
+			Resources:       containerRequirements(cfg.UploadResources),
+			SecurityContext: workflowContainerSecurityContext(),
+		},
+		Dependencies: after,
+	}
+}
@@ -0,0 +1,135 @@
+package workflows
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCheckpointStages(t *testing.T) {
+	assert.Equal(t, []string{"opensfm", "openmvs"}, parseCheckpointStages(" opensfm, openmvs ,"))
+	assert.Equal(t, []string{"mvs_texturing"}, parseCheckpointStages("meshing,mvs_texturing"))
+	assert.Empty(t, parseCheckpointStages(""))
+}
+
+func TestCheckpointing(t *testing.T) {
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/images/", "s3://bucket/output/", nil)
+	cfg.Checkpoint = true
+	cfg.CheckpointStages = []string{"opensfm"}
+	assert.True(t, checkpointing(cfg))
+
+	cfg.ProcessingMode = ProcessingModeThermal
+	assert.True(t, checkpointing(cfg))
+
+	cfg.ProcessingMode = ProcessingModeMergeExisting
+	assert.False(t, checkpointing(cfg))
+
+	cfg.ProcessingMode = ProcessingModeStandard
+	cfg.Split = 200
+	assert.False(t, checkpointing(cfg))
+
+	cfg.Split = 0
+	cfg.CheckpointStages = nil
+	assert.False(t, checkpointing(cfg))
+}
+
+func TestCheckpointFingerprint_IgnoresMaxConcurrency(t *testing.T) {
+	fp := checkpointFingerprint("opendronemap/odm:3.5.6", []string{"--fast-orthophoto", "--max-concurrency=4"})
+	assert.Len(t, fp, 16)
+	assert.Equal(t, fp, checkpointFingerprint("opendronemap/odm:3.5.6", []string{"--fast-orthophoto", "--max-concurrency=16"}))
+	assert.NotEqual(t, fp, checkpointFingerprint("opendronemap/odm:3.5.6", []string{"--dsm", "--max-concurrency=4"}))
+	assert.NotEqual(t, fp, checkpointFingerprint("opendronemap/odm:3.5.7", []string{"--fast-orthophoto", "--max-concurrency=4"}))
+}
+
+func TestBuildODMWorkflow_Checkpoint(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/images/", "s3://bucket/output/", nil)
+	cfg.Checkpoint = true
+	cfg.CheckpointStages = []string{"opensfm", "openmvs"}
+	cfg.CreateAllZip = true
+	containers := client.buildODMWorkflow(cfg).Spec.Templates[0].ContainerSet.Containers
+	names := make([]string, len(containers))
+	for i, c := range containers {
+		names[i] = c.Name
+	}
+	require.Equal(t, []string{"download", "process", PostProcessStage, AllZipStage, "upload", CheckpointStage}, names)
+
+	assert.Contains(t, containers[0].Args[0], `rclone copy "$CHECKPOINT_REMOTE/project" "$SRC_DIR"`)
+	assert.Contains(t, containers[1].Args[0], "JOB_ID=\"{{workflow.name}}\"\n"+checkpointProcessPrelude())
+	assert.Contains(t, containers[1].Args[0], `odm_args="--rerun-from $resume_from $odm_args"`)
+	assert.Equal(t, []string{AllZipStage, CheckpointStage}, containers[4].Dependencies)
+	assert.Contains(t, containers[4].Args[0], "Removing ODM checkpoint")
+
+	checkpoint := containers[5]
+	assert.Equal(t, containers[1].Dependencies, checkpoint.Dependencies)
+	assert.Equal(t, cfg.RcloneImage, checkpoint.Image)
+	assert.Contains(t, checkpoint.Args[0], `CHECKPOINT_STAGES=" opensfm openmvs "`)
+	assert.Contains(t, checkpoint.Args[0], `echo "s3://bucket/output/checkpoints"`)
+
+	cfg.Checkpoint = false
+	containers = client.buildODMWorkflow(cfg).Spec.Templates[0].ContainerSet.Containers
+	require.Len(t, containers, 5)
+	assert.NotContains(t, containers[1].Args[0], "--rerun-from")
+	assert.NotContains(t, containers[4].Args[0], "checkpoint")
+}
+
+func TestCheckpointODMRun_RecordsStagesAndResumes(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available")
+	}
+	workspace := t.TempDir()
+	bin := t.TempDir()
+	args := filepath.Join(t.TempDir(), "args")
+	// The fake ODM logs its arguments and three stages, the last without a
+	// trailing newline.
+	fake := `#!/bin/sh
+echo "$@" > "` + args + `"
+echo "[INFO]    Running dataset stage"
+echo "[INFO]    Running opensfm stage"
+printf "[INFO]    Running openmvs stage"
+exit ${FAKE_ODM_EXIT:-0}
+`
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "python3"), []byte(fake), 0o755))
+
+	script := strings.NewReplacer("/workspace/", workspace+"/").Replace(
+		"set -e\nset -o pipefail\nJOB_ID=job\n" + checkpointProcessPrelude() +
+			"odm_args=\"--project-path /code $JOB_ID\"\n" + checkpointODMRun())
+	run := func(env ...string) (string, error) {
+		cmd := exec.Command(bash, "-c", script)
+		cmd.Env = append(os.Environ(), append(env, "PATH="+bin+":"+os.Getenv("PATH"))...)
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+	stateDir := filepath.Join(workspace, "job", ".scaleodm")
+	read := func(name string) string {
+		b, err := os.ReadFile(filepath.Join(stateDir, name))
+		require.NoError(t, err)
+		return strings.TrimSpace(string(b))
+	}
+
+	out, err := run()
+	require.NoError(t, err, out)
+	assert.Contains(t, out, "Running openmvs stage")
+	assert.Equal(t, "opensfm openmvs", read("stage"))
+	assert.Equal(t, "0", read("process-exit"))
+	assert.Regexp(t, `^[0-9]+$`, read("heartbeat"))
+	logged, err := os.ReadFile(args)
+	require.NoError(t, err)
+	assert.NotContains(t, string(logged), "--rerun-from")
+
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, "resume-from"), []byte("openmvs\n"), 0o644))
+	out, err = run("FAKE_ODM_EXIT=3")
+	require.Error(t, err, out)
+	assert.Contains(t, out, "Resuming from checkpoint at the openmvs stage")
+	assert.Equal(t, "3", read("process-exit"))
+	logged, err = os.ReadFile(args)
+	require.NoError(t, err)
+	assert.Equal(t, "-u run.py --rerun-from openmvs --project-path /code job", strings.TrimSpace(string(logged)))
+}
@@ -0,0 +1,397 @@
+package workflows
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/hotosm/scaleodm/app/config"
+	"github.com/hotosm/scaleodm/app/s3"
+)
+
+// City-scale processes a large area as many ordinary ODM tasks - one per
+// directory of images under readS3Path (see s3.CityScaleTaskName) - and
+// corrects their drift against each other as it goes:
+//
+//	download -> plan -> central -> ring-1 -> ... -> ring-N -> merge [-> align-dem] -> upload
+//
+// plan reads the images' GPS positions, picks the most central task, and
+// sorts the rest into rings by adjacency: ring 1 touches the central task,
+// ring 2 touches ring 1, and so on, up to
+// SCALEODM_WORKFLOW_CITYSCALE_MAX_RINGS; tasks further out join the last
+// ring. Each task gets an anchor - the nearest task from an earlier ring -
+// and runs ODM with --align pointing at the anchor's georeferenced point
+// cloud, so every task is aligned to one already aligned to the centre.
+// Tasks within a ring run in parallel. merge mosaics the task products (see
+// generateMergeScript) and align-dem, run when the task gives a reference
+// DEM, removes the remaining vertical offset between the merged DSM/DTM/point
+// cloud and that DEM. Every step runs in its own pod, so the workspace must
+// be a ReadWriteMany PVC.
+const (
+	cityScalePlanDir = "/tmp/scaleodm-plan"
+
+	// ReferenceDEMFileName is where the download stage puts the reference
+	// DEM, in the job's workspace directory.
+	ReferenceDEMFileName = "reference_dem.tif"
+
+	// cityScaleAnchorModel is the point cloud a task is aligned to, relative
+	// to its anchor's project directory.
+	cityScaleAnchorModel = "odm_georeferencing/odm_georeferenced_model.laz"
+)
+
+// MinCityScaleTasks is the fewest task directories a city-scale task needs.
+const MinCityScaleTasks = 2
+
+// cityScaleTaskFlagsRemoved are options the pipeline sets per task.
+var cityScaleTaskFlagsRemoved = map[string]bool{
+	"align":           true,
+	"rerun-from":      true,
+	"rerun":           true,
+	"rerun-all":       true,
+	"end-with":        true,
+	"max-concurrency": true,
+}
+
+// cityScaleTaskFlags adapts the task's flags for one city-scale task run.
+func cityScaleTaskFlags(odmFlags []string) []string {
+	flags := make([]string, 0, len(odmFlags))
+	for _, flag := range odmFlags {
+		name, _, _ := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+		if !cityScaleTaskFlagsRemoved[name] {
+			flags = append(flags, flag)
+		}
+	}
+	return flags
+}
+
+// cityScaleRings is the number of ring stages: the configured cap, at least 1.
+func cityScaleRings() int {
+	return max(1, config.SCALEODM_WORKFLOW_CITYSCALE_MAX_RINGS)
+}
+
+// cityScalePlanScript is the Python run in the ODM image to order the tasks.
+// It takes the tasks directory, the plan output directory and the ring cap.
+const cityScalePlanScript = `import json
+import math
+import os
+import sys
+
+sys.path.insert(0, os.getcwd())
+from opendm import log
+from opendm.photo import ODM_Photo
+
+tasks_dir, plan_dir, max_rings = sys.argv[1], sys.argv[2], int(sys.argv[3])
+IMAGE_EXTENSIONS = (".jpg", ".jpeg", ".tif", ".tiff")
+
+tasks = {}
+for name in sorted(os.listdir(tasks_dir)):
+    images_dir = os.path.join(tasks_dir, name, "images")
+    if not os.path.isdir(images_dir):
+        continue
+    points = []
+    for image in sorted(os.listdir(images_dir)):
+        if not image.lower().endswith(IMAGE_EXTENSIONS):
+            continue
+        try:
+            photo = ODM_Photo(os.path.join(images_dir, image))
+        except Exception as e:
+            log.ODM_WARNING("Cannot read %s/%s: %s" % (name, image, e))
+            continue
+        if photo.latitude is not None and photo.longitude is not None:
+            points.append((photo.longitude, photo.latitude))
+    if not points:
+        log.ODM_ERROR("Task %s has no geotagged images" % name)
+        sys.exit(1)
+    xs = [p[0] for p in points]
+    ys = [p[1] for p in points]
+    # Grow each footprint a little so tasks that only just touch count as
+    # neighbours.
+    margin = max(max(xs) - min(xs), max(ys) - min(ys)) * 0.1 + 0.0005
+    tasks[name] = {
+        "images": len(points),
+        "center": (sum(xs) / len(xs), sum(ys) / len(ys)),
+        "bbox": (min(xs) - margin, min(ys) - margin, max(xs) + margin, max(ys) + margin),
+    }
+
+if len(tasks) < 2:
+    log.ODM_ERROR("City-scale needs at least 2 tasks, found %d" % len(tasks))
+    sys.exit(1)
+
+
+def distance(a, b):
+    # Equirectangular approximation, in meters.
+    lat = math.radians((a[1] + b[1]) / 2)
+    return math.hypot((a[0] - b[0]) * math.cos(lat) * 111320, (a[1] - b[1]) * 110540)
+
+
+def touches(a, b):
+    a, b = tasks[a]["bbox"], tasks[b]["bbox"]
+    return a[0] <= b[2] and b[0] <= a[2] and a[1] <= b[3] and b[1] <= a[3]
+
+
+# The task with the least total distance to the others, so an outlying task
+# cannot pull the centre towards it.
+central = min(sorted(tasks), key=lambda t: sum(
+    distance(tasks[t]["center"], tasks[o]["center"]) for o in tasks))
+
+ring = {central: 0}
+frontier = [central]
+remaining = set(tasks) - {central}
+while remaining:
+    placed = {}
+    for t in sorted(remaining):
+        neighbours = [f for f in frontier if touches(t, f)]
+        if neighbours:
+            placed[t] = min(max(ring[f] for f in neighbours) + 1, max_rings)
+    if not placed:
+        # A disconnected task joins next to the nearest placed task.
+        t = min(sorted(remaining), key=lambda t: min(
+            distance(tasks[t]["center"], tasks[p]["center"]) for p in ring))
+        nearest = min(sorted(ring), key=lambda p: distance(tasks[t]["center"], tasks[p]["center"]))
+        placed[t] = min(ring[nearest] + 1, max_rings)
+    ring.update(placed)
+    remaining -= set(placed)
+    frontier = sorted(placed)
+
+rings = [[] for _ in range(max_rings + 1)]
+for t in sorted(ring):
+    if ring[t] == 0:
+        continue
+    earlier = [p for p in ring if ring[p] < ring[t]]
+    anchor = min(sorted(earlier), key=lambda p: distance(tasks[t]["center"], tasks[p]["center"]))
+    rings[ring[t]].append({"task": t, "anchor": anchor})
+
+with open(os.path.join(plan_dir, "central.txt"), "w") as f:
+    f.write(central)
+for k in range(1, max_rings + 1):
+    with open(os.path.join(plan_dir, "ring-%d.json" % k), "w") as f:
+        json.dump(rings[k], f)
+with open(os.path.join(os.path.dirname(tasks_dir), "city_scale_plan.json"), "w") as f:
+    json.dump({"central": central, "rings": rings[1:], "tasks": {
+        t: {"images": tasks[t]["images"], "center": tasks[t]["center"]} for t in sorted(tasks)}}, f, indent=2)
+
+log.ODM_INFO("Central task: %s" % central)
+for k in range(1, max_rings + 1):
+    log.ODM_INFO("Ring %d: %s" % (k, ", ".join("%s (anchor %s)" % (e["task"], e["anchor"]) for e in rings[k]) or "-"))
+`
+
+// cityScaleAlignDEMScript is the Python run in the ODM image to align the
+// merged products to the reference DEM. It takes the job's workspace
+// directory and the reference DEM path. The offset is the median difference
+// between the merged DTM (or DSM) and the reference, sampled on a grid of at
+// most a few thousand pixels a side; DEMs are shifted in blocks so city-size
+// rasters never have to fit in memory.
+const cityScaleAlignDEMScript = `import json
+import os
+import shutil
+import subprocess
+import sys
+
+import numpy as np
+from osgeo import gdal
+
+gdal.UseExceptions()
+work_dir, reference_path = sys.argv[1], sys.argv[2]
+NODATA = -9999
+SAMPLE_PIXELS = 4000
+
+dems = [os.path.join(work_dir, "odm_dem", n) for n in ("dtm.tif", "dsm.tif")]
+dems = [p for p in dems if os.path.isfile(p)]
+if not dems:
+    print("ERROR: no merged DEM to align to the reference")
+    sys.exit(1)
+
+base = gdal.Open(dems[0])
+width, height = base.RasterXSize, base.RasterYSize
+gt = base.GetGeoTransform()
+bounds = (gt[0], gt[3] + gt[5] * height, gt[0] + gt[1] * width, gt[3])
+scale = min(1.0, float(SAMPLE_PIXELS) / max(width, height))
+sample_size = (max(1, int(width * scale)), max(1, int(height * scale)))
+
+
+def sample(path):
+    ds = gdal.Warp("", path, format="MEM", dstSRS=base.GetProjection(), outputBounds=bounds,
+                   width=sample_size[0], height=sample_size[1], resampleAlg="bilinear", dstNodata=NODATA)
+    values = ds.GetRasterBand(1).ReadAsArray().astype("float64")
+    values[values == NODATA] = np.nan
+    return values
+
+
+diff = sample(dems[0]) - sample(reference_path)
+valid = np.isfinite(diff)
+if valid.sum() < 100:
+    print("ERROR: the reference DEM does not cover the merged %s" % os.path.basename(dems[0]))
+    sys.exit(1)
+dz = float(np.median(diff[valid]))
+print("Vertical offset to the reference: %.3f m (%d samples, MAD %.3f m)" % (
+    dz, int(valid.sum()), float(np.median(np.abs(diff[valid] - dz)))))
+
+
+def shift_raster(path):
+    ds = gdal.Open(path, gdal.GA_Update)
+    band = ds.GetRasterBand(1)
+    nodata = band.GetNoDataValue()
+    rows = 512
+    for y in range(0, ds.RasterYSize, rows):
+        n = min(rows, ds.RasterYSize - y)
+        block = band.ReadAsArray(0, y, ds.RasterXSize, n)
+        mask = block != nodata if nodata is not None else np.ones(block.shape, dtype=bool)
+        block[mask] = block[mask] - dz
+        band.WriteArray(block, 0, y)
+    band.FlushCache()
+    ds = None
+    print("Shifted %s" % path)
+
+
+for path in [os.path.join(work_dir, "odm_dem", n) for n in ("dsm.tif", "dtm.tif")]:
+    if os.path.isfile(path):
+        shift_raster(path)
+
+laz = os.path.join(work_dir, "odm_georeferencing", "odm_georeferenced_model.laz")
+if os.path.isfile(laz):
+    pdal = shutil.which("pdal") or "/code/SuperBuild/install/bin/pdal"
+    shifted = laz + ".aligned.laz"
+    subprocess.check_call([pdal, "translate", laz, shifted, "-f", "transformation",
+                           "--filters.transformation.matrix=1 0 0 0 0 1 0 0 0 0 1 %f 0 0 0 1" % -dz])
+    os.replace(shifted, laz)
+    print("Shifted %s" % laz)
+
+with open(os.path.join(work_dir, "odm_dem", "reference_alignment.json"), "w") as f:
+    json.dump({"verticalOffsetMeters": dz, "samples": int(valid.sum()), "comparedTo": os.path.basename(dems[0])}, f, indent=2)
+`
+
+func generateCityScalePlanScript() string {
+	return odmScriptPreamble + `echo "=== plan attempt {{retries}} @ $(date -u +%Y-%m-%dT%H:%M:%SZ) ==="
+PLAN_DIR="` + cityScalePlanDir + `"
+mkdir -p "$PLAN_DIR"
+cat > "$PLAN_DIR/plan.py" <<'CITY_SCALE_PLAN_EOF'
+` + cityScalePlanScript + `CITY_SCALE_PLAN_EOF
+python3 -u "$PLAN_DIR/plan.py" "/workspace/$JOB_ID/` + s3.CityScaleTasksDir + `" "$PLAN_DIR" ` + strconv.Itoa(cityScaleRings()) + `
+`
+}
+
+func generateCityScaleTaskScript(odmFlags []string) string {
+	return odmScriptPreamble + `TASK="{{inputs.parameters.task}}"
+ANCHOR="{{inputs.parameters.anchor}}"
+TASKS_DIR="/workspace/$JOB_ID/` + s3.CityScaleTasksDir + `"
+echo "=== $TASK attempt {{retries}} @ $(date -u +%Y-%m-%dT%H:%M:%SZ) ==="
+align_args=""
+if [ -n "$ANCHOR" ]; then
+  ANCHOR_MODEL="$TASKS_DIR/$ANCHOR/` + cityScaleAnchorModel + `"
+  if [ ! -s "$ANCHOR_MODEL" ]; then
+    echo "ERROR: anchor task $ANCHOR has no point cloud to align $TASK to"
+    exit 1
+  fi
+  echo "Aligning $TASK to $ANCHOR"
+  align_args="--align $ANCHOR_MODEL"
+fi
+odm_args="` + strings.Join(odmFlags, " ") + ` $align_args --project-path $TASKS_DIR $TASK"
+echo "Executing: python3 -u run.py $odm_args"
+python3 -u run.py $odm_args
+echo "$TASK complete"
+`
+}
+
+func generateCityScaleAlignDEMScript() string {
+	return odmScriptPreamble + `echo "=== align-dem attempt {{retries}} @ $(date -u +%Y-%m-%dT%H:%M:%SZ) ==="
+cat > /tmp/scaleodm-align-dem.py <<'ALIGN_DEM_EOF'
+` + cityScaleAlignDEMScript + `ALIGN_DEM_EOF
+python3 -u /tmp/scaleodm-align-dem.py "/workspace/$JOB_ID" "/workspace/$JOB_ID/` + ReferenceDEMFileName + `"
+rm -f "/workspace/$JOB_ID/` + ReferenceDEMFileName + `"
+`
+}
+
+// cityScaleTemplates returns the DAG entrypoint ("main") and its step
+// templates for a city-scale task. download and upload are the standard
+// stage containers; odmFlags are the task's flags including any boundary.
+func cityScaleTemplates(cfg *ODMPipelineConfig, odmFlags []string, download, upload apiv1.Container, volumes []apiv1.Volume) []wfv1.Template {
+	steps := dagSteps{cfg: cfg, volumes: volumes}
+
+	taskFlags := cityScaleTaskFlags(odmFlags)
+	taskResources := estimateProcessResourcesFromImageCount(cfg.LargestTaskImages, taskFlags, cfg.ProcessResources)
+	stepResources := estimateProcessResourcesFromImageCount(0, nil, cfg.ProcessResources)
+
+	rings := cityScaleRings()
+	plan := steps.odm("plan", generateCityScalePlanScript(), stepResources)
+	plan.Outputs.Parameters = []wfv1.Parameter{{
+		Name:      "central",
+		ValueFrom: &wfv1.ValueFrom{Path: cityScalePlanDir + "/central.txt"},
+	}}
+	for k := 1; k <= rings; k++ {
+		plan.Outputs.Parameters = append(plan.Outputs.Parameters, wfv1.Parameter{
+			Name:      fmt.Sprintf("ring-%d", k),
+			ValueFrom: &wfv1.ValueFrom{Path: fmt.Sprintf("%s/ring-%d.json", cityScalePlanDir, k)},
+		})
+	}
+
+	task := steps.odm("task", generateCityScaleTaskScript(withMaxConcurrency(taskFlags, taskResources)), taskResources)
+	task.Inputs.Parameters = []wfv1.Parameter{{Name: "task"}, {Name: "anchor"}}
+
+	templates := []wfv1.Template{
+		steps.rclone("download", download),
+		plan,
+		task,
+		steps.odm("merge", generateMergeScript(s3.CityScaleTasksDir), stepResources),
+		steps.rclone("upload", upload),
+	}
+
+	tasks := []wfv1.DAGTask{
+		{Name: "download", Template: "download"},
+		{Name: "plan", Template: "plan", Dependencies: []string{"download"}},
+		{
+			Name:         "central",
+			Template:     "task",
+			Dependencies: []string{"plan"},
+			Arguments: wfv1.Arguments{Parameters: []wfv1.Parameter{
+				{Name: "task", Value: wfv1.AnyStringPtr("{{tasks.plan.outputs.parameters.central}}")},
+				{Name: "anchor", Value: wfv1.AnyStringPtr("")},
+			}},
+		},
+	}
+	previous := "central"
+	for k := 1; k <= rings; k++ {
+		name := fmt.Sprintf("ring-%d", k)
+		tasks = append(tasks, wfv1.DAGTask{
+			Name:         name,
+			Template:     "task",
+			Dependencies: []string{previous},
+			WithParam:    fmt.Sprintf("{{tasks.plan.outputs.parameters.%s}}", name),
+			Arguments: wfv1.Arguments{Parameters: []wfv1.Parameter{
+				{Name: "task", Value: wfv1.AnyStringPtr("{{item.task}}")},
+				{Name: "anchor", Value: wfv1.AnyStringPtr("{{item.anchor}}")},
+			}},
+		})
+		previous = name
+	}
+	tasks = append(tasks, wfv1.DAGTask{Name: "merge", Template: "merge", Dependencies: []string{previous}})
+	previous = "merge"
+	if cfg.ReferenceDEMS3Path != "" {
+		templates = append(templates, steps.odm("align-dem", generateCityScaleAlignDEMScript(), stepResources))
+		tasks = append(tasks, wfv1.DAGTask{Name: "align-dem", Template: "align-dem", Dependencies: []string{previous}})
+		previous = "align-dem"
+	}
+	if !cfg.SkipPostProcessing {
+		templates = append(templates, steps.odm(PostProcessStage, generatePostProcessScript(), cfg.PostProcessResources))
+		tasks = append(tasks, wfv1.DAGTask{Name: PostProcessStage, Template: PostProcessStage, Dependencies: []string{previous}})
+		previous = PostProcessStage
+	}
+	if cfg.CreateAllZip {
+		templates = append(templates, steps.odm(AllZipStage, generateAllZipScript(), stepResources))
+		tasks = append(tasks, wfv1.DAGTask{Name: AllZipStage, Template: AllZipStage, Dependencies: []string{previous}})
+		previous = AllZipStage
+	}
+	tasks = append(tasks, wfv1.DAGTask{Name: "upload", Template: "upload", Dependencies: []string{previous}})
+
+	main := wfv1.Template{
+		Name: "main",
+		DAG:  &wfv1.DAGTemplate{Tasks: tasks},
+	}
+	if limit := config.SCALEODM_WORKFLOW_CITYSCALE_MAX_PARALLEL_TASKS; limit > 0 {
+		parallelism := int64(limit)
+		main.Parallelism = &parallelism
+	}
+	return append([]wfv1.Template{main}, templates...)
+}
@@ -0,0 +1,99 @@
+package workflows
+
+import (
+	"testing"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hotosm/scaleodm/app/config"
+	"github.com/hotosm/scaleodm/app/s3"
+)
+
+func cityScaleTestConfig() *ODMPipelineConfig {
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/city/", "s3://bucket/output/", []string{"--dsm", "--align=/tmp/x.laz"})
+	cfg.ProcessingMode = ProcessingModeCityScale
+	cfg.Workspace.Mode = "pvc"
+	cfg.Workspace.AccessMode = "ReadWriteMany"
+	cfg.S3ScanDepth = MaxS3ScanDepth
+	cfg.ImageCount = 3000
+	cfg.LargestTaskImages = 600
+	return cfg
+}
+
+func TestCityScaleTaskFlags(t *testing.T) {
+	assert.Equal(t, []string{"--dsm", "--pc-quality=high"},
+		cityScaleTaskFlags([]string{"--dsm", "--align=/tmp/x.laz", "--pc-quality=high", "--max-concurrency=8", "--rerun-from=dataset"}))
+}
+
+func TestBuildODMWorkflow_CityScale(t *testing.T) {
+	orig := config.SCALEODM_WORKFLOW_CITYSCALE_MAX_RINGS
+	config.SCALEODM_WORKFLOW_CITYSCALE_MAX_RINGS = 3
+	t.Cleanup(func() { config.SCALEODM_WORKFLOW_CITYSCALE_MAX_RINGS = orig })
+
+	client := &Client{namespace: "test-namespace"}
+	cfg := cityScaleTestConfig()
+	wf := client.buildODMWorkflow(cfg)
+
+	templates := map[string]wfv1.Template{}
+	for _, tmpl := range wf.Spec.Templates {
+		templates[tmpl.Name] = tmpl
+	}
+	main := templates["main"]
+	require.NotNil(t, main.DAG)
+
+	var order []string
+	tasks := map[string]wfv1.DAGTask{}
+	for _, task := range main.DAG.Tasks {
+		order = append(order, task.Name)
+		tasks[task.Name] = task
+	}
+	assert.Equal(t, []string{"download", "plan", "central", "ring-1", "ring-2", "ring-3", "merge", PostProcessStage, "upload"}, order)
+	assert.Equal(t, []string{"central"}, tasks["ring-1"].Dependencies)
+	assert.Equal(t, []string{"ring-2"}, tasks["ring-3"].Dependencies)
+	assert.Equal(t, "{{tasks.plan.outputs.parameters.ring-2}}", tasks["ring-2"].WithParam)
+	assert.Equal(t, "{{item.anchor}}", tasks["ring-2"].Arguments.Parameters[1].Value.String())
+	assert.Equal(t, "{{tasks.plan.outputs.parameters.central}}", tasks["central"].Arguments.Parameters[0].Value.String())
+	assert.Equal(t, []string{"merge"}, tasks[PostProcessStage].Dependencies)
+	assert.Equal(t, []string{PostProcessStage}, tasks["upload"].Dependencies)
+
+	download := templates["download"].Container.Args[0]
+	assert.Contains(t, download, "Sorting imagery into tasks")
+	assert.NotContains(t, download, "reference DEM")
+
+	require.Len(t, templates["plan"].Outputs.Parameters, 4)
+	assert.Contains(t, templates["plan"].Container.Args[0], `"/workspace/$JOB_ID/`+s3.CityScaleTasksDir+`" "$PLAN_DIR" 3`)
+
+	task := templates["task"].Container.Args[0]
+	assert.Contains(t, task, `align_args="--align $ANCHOR_MODEL"`)
+	assert.Contains(t, task, "--dsm --max-concurrency=")
+	assert.NotContains(t, task, "/tmp/x.laz")
+	assert.Equal(t,
+		containerRequirements(estimateProcessResourcesFromImageCount(600, []string{"--dsm"}, cfg.ProcessResources)),
+		templates["task"].Container.Resources)
+
+	assert.Contains(t, templates["merge"].Container.Args[0], `INPUT_DIR="$WORK_DIR/`+s3.CityScaleTasksDir+`"`)
+	assert.NotContains(t, templates, "align-dem")
+	assert.Equal(t, "cleanup", wf.Spec.OnExit)
+}
+
+func TestBuildODMWorkflow_CityScaleAlignsToReferenceDEM(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+	cfg := cityScaleTestConfig()
+	cfg.ReferenceDEMS3Path = "s3://bucket/dem/glo30.tif"
+	wf := client.buildODMWorkflow(cfg)
+
+	templates := map[string]wfv1.Template{}
+	for _, tmpl := range wf.Spec.Templates {
+		templates[tmpl.Name] = tmpl
+	}
+	tasks := map[string]wfv1.DAGTask{}
+	for _, task := range templates["main"].DAG.Tasks {
+		tasks[task.Name] = task
+	}
+	assert.Equal(t, []string{"merge"}, tasks["align-dem"].Dependencies)
+	assert.Equal(t, []string{"align-dem"}, tasks[PostProcessStage].Dependencies)
+	assert.Contains(t, templates["download"].Container.Args[0], "s3://bucket/dem/glo30.tif")
+	assert.Contains(t, templates["align-dem"].Container.Args[0], "reference_alignment.json")
+}
@@ -17,6 +17,7 @@ import (
 	workflowclient "github.com/argoproj/argo-workflows/v3/pkg/client/clientset/versioned"
 	apiv1 "k8s.io/api/core/v1"
 
+	"github.com/hotosm/scaleodm/app/odmoptions"
 	"github.com/hotosm/scaleodm/app/s3"
 )
 
@@ -24,6 +25,9 @@ import (
 // Ensure Client implements WorkflowClient interface
 var _ WorkflowClient = (*Client)(nil)
 
+// Client also reads option catalogs out of ODM images.
+var _ odmoptions.Extractor = (*Client)(nil)
+
 // Client provides common workflow operations that are shared across all workflow types
 type Client struct {
 	wfClientset *workflowclient.Clientset
@@ -232,6 +236,12 @@ const archivedProcessLogContainer = "process"
 // client comes from s3.GetArgoArchiveLogClient so it can use its own IAM
 // principal.
 func (c *Client) streamArchivedProcessLog(ctx context.Context, workflowName string, writer io.Writer) error {
+	return c.streamArchivedContainerLog(ctx, workflowName, archivedProcessLogContainer, writer)
+}
+
+// streamArchivedContainerLog pulls one container's archived logs for a
+// workflow, one "=== {pod}/{container}.log ===" section per pod.
+func (c *Client) streamArchivedContainerLog(ctx context.Context, workflowName, container string, writer io.Writer) error {
 	archiveClient, bucket, ok, err := s3.GetArgoArchiveLogClient()
 	if err != nil {
 		return fmt.Errorf("archive log client: %w", err)
@@ -241,7 +251,7 @@ func (c *Client) streamArchivedProcessLog(ctx context.Context, workflowName stri
 		return nil
 	}
 
-	if err := s3.GetArgoArchiveContainerLog(ctx, archiveClient, bucket, c.namespace, workflowName, archivedProcessLogContainer, writer); err != nil {
+	if err := s3.GetArgoArchiveContainerLog(ctx, archiveClient, bucket, c.namespace, workflowName, container, writer); err != nil {
 		if errors.Is(err, s3.ErrArgoArchiveLogsNotFound) {
 			fmt.Fprintln(writer, "No archived logs for this workflow.")
 			return nil
@@ -3,6 +3,7 @@ package workflows
 import (
 	"context"
 	"io"
+	"time"
 
 	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
 )
@@ -11,11 +12,15 @@ import (
 // This allows for mocking in tests
 type WorkflowClient interface {
 	CreateODMWorkflow(ctx context.Context, config *ODMPipelineConfig) (*wfv1.Workflow, error)
+	RenderODMWorkflow(config *ODMPipelineConfig) (*wfv1.Workflow, error)
 	GetWorkflow(ctx context.Context, name string) (*wfv1.Workflow, error)
 	ListWorkflows(ctx context.Context, labelSelector string) (*wfv1.WorkflowList, error)
 	DeleteWorkflow(ctx context.Context, name string) error
 	GetWorkflowLogs(ctx context.Context, workflowName string, writer io.Writer) error
 	GetWorkflowLogsWithArchiveFallback(ctx context.Context, workflowName string, writer io.Writer) error
+	FollowWorkflowLogs(ctx context.Context, workflowName string, fromLine int, writer io.Writer) error
+	ODMStage(ctx context.Context, workflowName string, since time.Time) (string, error)
+	ProcessUsage(ctx context.Context, workflowName string) (*ProcessUsage, error)
 	WatchWorkflow(ctx context.Context, workflowName string) (*wfv1.Workflow, error)
 	GetWorkflowStatus(ctx context.Context, workflowName string) (wfv1.WorkflowPhase, string, error)
 	IsWorkflowComplete(ctx context.Context, workflowName string) (bool, error)
@@ -0,0 +1,110 @@
+package workflows
+
+import (
+	"math"
+	"sync"
+)
+
+// Workload profiles, the ODM modes sizing distinguishes. Precedence matches
+// flagMemoryMultiplier and flagWorkspaceProfile.
+const (
+	WorkloadProfileStandard       = "standard"
+	WorkloadProfileFastOrthophoto = "fast-orthophoto"
+	WorkloadProfileDSMDTM         = "dsm-dtm"
+)
+
+// maxLearnedFactor bounds how far a learned curve moves an estimate from its
+// prior, either way, so that a few odd runs cannot size a task absurdly.
+const maxLearnedFactor = 4.0
+
+// WorkloadProfile returns the profile of a task's ODM flags.
+func WorkloadProfile(odmFlags []string) string {
+	for _, f := range odmFlags {
+		if f == "--fast-orthophoto" {
+			return WorkloadProfileFastOrthophoto
+		}
+	}
+	for _, f := range odmFlags {
+		if f == "--dsm" || f == "--dtm" {
+			return WorkloadProfileDSMDTM
+		}
+	}
+	return WorkloadProfileStandard
+}
+
+// LearnedCurve corrects a prior estimate by the ratio observed runs needed:
+// ln(observed/prior) = Intercept + Slope*(ln(images) - MeanLogImages), plus
+// Margin as headroom. Image counts outside [MinImages, MaxImages], the range
+// the curve was fitted on, are corrected as at the nearer end.
+type LearnedCurve struct {
+	Intercept     float64
+	Slope         float64
+	MeanLogImages float64
+	Margin        float64
+	MinImages     int
+	MaxImages     int
+}
+
+// Factor is the multiplier the curve applies to the prior for imageCount.
+func (c LearnedCurve) Factor(imageCount int) float64 {
+	images := imageCount
+	if images < c.MinImages {
+		images = c.MinImages
+	}
+	if images > c.MaxImages {
+		images = c.MaxImages
+	}
+	if images <= 0 {
+		return 1
+	}
+	factor := math.Exp(c.Intercept + c.Slope*(math.Log(float64(images))-c.MeanLogImages) + c.Margin)
+	if math.IsNaN(factor) || math.IsInf(factor, 0) {
+		return 1
+	}
+	return clamp(factor, 1/maxLearnedFactor, maxLearnedFactor)
+}
+
+// LearnedSizing holds the curves applied to the process memory and workspace
+// estimates, by workload profile. A profile without a curve keeps its prior.
+type LearnedSizing struct {
+	Memory    map[string]LearnedCurve
+	Workspace map[string]LearnedCurve
+}
+
+var learnedSizing struct {
+	sync.RWMutex
+	sizing LearnedSizing
+}
+
+// SetLearnedSizing replaces the curves applied to new workflows' estimates;
+// the zero value reverts to the priors. The estimator calls it after each fit.
+func SetLearnedSizing(sizing LearnedSizing) {
+	learnedSizing.Lock()
+	defer learnedSizing.Unlock()
+	learnedSizing.sizing = sizing
+}
+
+func learnedMemoryFactor(imageCount int, odmFlags []string) float64 {
+	learnedSizing.RLock()
+	defer learnedSizing.RUnlock()
+	if curve, ok := learnedSizing.sizing.Memory[WorkloadProfile(odmFlags)]; ok {
+		return curve.Factor(imageCount)
+	}
+	return 1
+}
+
+func learnedWorkspaceFactor(imageCount int, odmFlags []string) float64 {
+	learnedSizing.RLock()
+	defer learnedSizing.RUnlock()
+	if curve, ok := learnedSizing.sizing.Workspace[WorkloadProfile(odmFlags)]; ok {
+		return curve.Factor(imageCount)
+	}
+	return 1
+}
+
+// PriorPeakMemoryGiB is the peak working set (RAM + swap) the interpolated
+// odmMemoryEstimationPoints table and flag multiplier predict for a task,
+// before any learned correction.
+func PriorPeakMemoryGiB(imageCount int, odmFlags []string) float64 {
+	return estimateMemoryGiB(imageCount) * flagMemoryMultiplier(odmFlags)
+}
@@ -0,0 +1,58 @@
+package workflows
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkloadProfile(t *testing.T) {
+	assert.Equal(t, WorkloadProfileStandard, WorkloadProfile(nil))
+	assert.Equal(t, WorkloadProfileStandard, WorkloadProfile([]string{"--orthophoto-resolution=5"}))
+	assert.Equal(t, WorkloadProfileDSMDTM, WorkloadProfile([]string{"--dtm"}))
+	assert.Equal(t, WorkloadProfileFastOrthophoto, WorkloadProfile([]string{"--dsm", "--fast-orthophoto"}))
+}
+
+func TestLearnedCurve_Factor(t *testing.T) {
+	curve := LearnedCurve{
+		Intercept:     math.Log(1.5),
+		Slope:         0.5,
+		MeanLogImages: math.Log(1000),
+		MinImages:     100,
+		MaxImages:     4000,
+	}
+	assert.InDelta(t, 1.5, curve.Factor(1000), 1e-9)
+	// sqrt(4) * 1.5 at four times the mean image count.
+	assert.InDelta(t, 3, curve.Factor(4000), 1e-9)
+	// Held flat beyond the observed range.
+	assert.InDelta(t, 3, curve.Factor(20000), 1e-9)
+	assert.InDelta(t, curve.Factor(100), curve.Factor(10), 1e-9)
+
+	curve.Margin = math.Log(2)
+	assert.InDelta(t, 3, curve.Factor(1000), 1e-9)
+	// Bounded by maxLearnedFactor.
+	assert.InDelta(t, maxLearnedFactor, curve.Factor(4000), 1e-9)
+}
+
+func TestLearnedSizing_CorrectsEstimates(t *testing.T) {
+	withSwapRatio(t, 0)
+	t.Cleanup(func() { SetLearnedSizing(LearnedSizing{}) })
+	double := LearnedCurve{Intercept: math.Log(2), MeanLogImages: math.Log(500), MinImages: 100, MaxImages: 2000}
+
+	// 250 images is a 27 GiB peak and 1000 images of 10 GiB a 100 GiB
+	// workspace until a curve is learned.
+	assert.Equal(t, "27648Mi", estimateProcessResourcesFromImageCount(250, nil, ContainerResources{}).Requests.Memory)
+	assert.InDelta(t, 100, estimateWorkspaceGiB(10<<30, 1000, nil), 1e-9)
+
+	SetLearnedSizing(LearnedSizing{
+		Memory:    map[string]LearnedCurve{WorkloadProfileStandard: double},
+		Workspace: map[string]LearnedCurve{WorkloadProfileStandard: double},
+	})
+	assert.Equal(t, "55296Mi", estimateProcessResourcesFromImageCount(250, nil, ContainerResources{}).Requests.Memory)
+	assert.InDelta(t, 200, estimateWorkspaceGiB(10<<30, 1000, nil), 1e-9)
+	assert.InDelta(t, 100, PriorWorkspaceGiB(10<<30, 1000, nil), 1e-9)
+
+	// Other profiles keep their prior.
+	assert.Equal(t, "13824Mi", estimateProcessResourcesFromImageCount(250, []string{"--fast-orthophoto"}, ContainerResources{}).Requests.Memory)
+}
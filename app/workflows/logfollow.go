@@ -0,0 +1,259 @@
+package workflows
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// logFollowPollInterval paces the checks for pods that have not started, or
+// new pods, while following a running workflow's log.
+const logFollowPollInterval = 2 * time.Second
+
+// FollowWorkflowLogs writes a workflow's log to writer from line fromLine
+// (0-based) on, and keeps following it until the workflow finishes. While it
+// runs, each pod's process container (main, for the DAG pipelines) is read
+// with the Kubernetes follow API in pod creation order; a finished or
+// garbage-collected workflow is read from the log archive instead. Both are
+// laid out as the archive is - a "=== {pod}/{container}.log ===" line, the
+// log, then a blank line - so line numbers carry over from one to the other
+// for the single-pod pipeline. Only whole lines are written.
+func (c *Client) FollowWorkflowLogs(ctx context.Context, workflowName string, fromLine int, writer io.Writer) error {
+	lines := &logLines{w: writer, next: fromLine}
+
+	wf, err := c.GetWorkflow(ctx, workflowName)
+	if err != nil || wf.Status.Phase.Completed() {
+		container := archivedProcessLogContainer
+		if err == nil && isDAGWorkflow(wf) {
+			container = "main"
+		}
+		lines.startPass("")
+		if err := c.streamArchivedContainerLog(ctx, workflowName, container, lines); err != nil {
+			return err
+		}
+		lines.endSource("")
+		return lines.err
+	}
+
+	followed := map[string]bool{}
+	for {
+		// The phase is read before the pods are listed, so once it is
+		// terminal the listing has every pod there will be.
+		finished := wf.Status.Phase.Completed()
+		pods, err := c.workflowPods(ctx, workflowName)
+		if err != nil {
+			return err
+		}
+		waiting := false
+		for i := range pods {
+			pod := &pods[i]
+			if followed[pod.Name] {
+				continue
+			}
+			done, err := c.followPodLog(ctx, pod, lines)
+			if err != nil {
+				return err
+			}
+			if !done {
+				waiting = true
+				break
+			}
+			followed[pod.Name] = true
+		}
+		if finished && !waiting {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(logFollowPollInterval):
+		}
+		if wf, err = c.GetWorkflow(ctx, workflowName); err != nil {
+			if k8serrors.IsNotFound(err) {
+				// Deleted mid-stream; whatever was followed is all there is.
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// workflowPods lists a workflow's pods, oldest first.
+func (c *Client) workflowPods(ctx context.Context, workflowName string) ([]apiv1.Pod, error) {
+	podList, err := c.k8sClient.CoreV1().Pods(c.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("workflows.argoproj.io/workflow=%s", workflowName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list workflow pods: %w", err)
+	}
+	pods := podList.Items
+	sort.SliceStable(pods, func(i, j int) bool {
+		if !pods[i].CreationTimestamp.Equal(&pods[j].CreationTimestamp) {
+			return pods[i].CreationTimestamp.Before(&pods[j].CreationTimestamp)
+		}
+		return pods[i].Name < pods[j].Name
+	})
+	return pods, nil
+}
+
+// followPodLog follows one pod's log container from the start, skipping the
+// lines already written. It reports whether the container is done: it
+// finished, or the pod is gone. Otherwise it has not started or the stream
+// dropped, and the pod is read again on the next pass.
+func (c *Client) followPodLog(ctx context.Context, pod *apiv1.Pod, lines *logLines) (bool, error) {
+	container := followedLogContainer(pod)
+	podClient := c.k8sClient.CoreV1().Pods(c.namespace)
+
+	stream, err := podClient.GetLogs(pod.Name, &apiv1.PodLogOptions{Container: container, Follow: true}).Stream(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		// Not started yet, unless the pod is gone or ended without it.
+		current, getErr := podClient.Get(ctx, pod.Name, metav1.GetOptions{})
+		return k8serrors.IsNotFound(getErr) || (getErr == nil && containerTerminated(current, container)), nil
+	}
+	lines.startPass(fmt.Sprintf("=== %s/%s.log ===", pod.Name, container))
+	_, copyErr := io.Copy(lines, stream)
+	stream.Close()
+	if lines.err != nil {
+		return false, lines.err
+	}
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	current, err := podClient.Get(ctx, pod.Name, metav1.GetOptions{})
+	switch {
+	case k8serrors.IsNotFound(err):
+		// Garbage-collected; its log ended with the stream.
+	case err != nil, copyErr != nil, !containerTerminated(current, container):
+		lines.retrySource()
+		return false, nil
+	}
+	lines.endSource("\n")
+	return true, lines.err
+}
+
+// followedLogContainer is the container whose log is followed: process in
+// the single-pod pipeline, main in the DAG pipelines' step pods.
+func followedLogContainer(pod *apiv1.Pod) string {
+	for _, container := range pod.Spec.Containers {
+		if container.Name == archivedProcessLogContainer {
+			return archivedProcessLogContainer
+		}
+	}
+	return "main"
+}
+
+func containerTerminated(pod *apiv1.Pod, container string) bool {
+	if pod.Status.Phase == apiv1.PodSucceeded || pod.Status.Phase == apiv1.PodFailed {
+		return true
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == container {
+			return status.State.Terminated != nil
+		}
+	}
+	return false
+}
+
+// isDAGWorkflow reports whether a workflow runs one of the DAG pipelines,
+// whose step pods log from their main container.
+func isDAGWorkflow(wf *wfv1.Workflow) bool {
+	for _, tmpl := range wf.Spec.Templates {
+		if tmpl.Name == wf.Spec.Entrypoint {
+			return tmpl.DAG != nil
+		}
+	}
+	return false
+}
+
+// logLines numbers the lines of a log read in passes over its sources - pod
+// logs in turn, or the archive - and writes each line once, from line next
+// on. A source can be read again from its start after a dropped stream: its
+// lines keep their numbers and the ones already written are skipped. A
+// partial last line is held back until its source is known to be complete.
+type logLines struct {
+	w    io.Writer
+	next int // number of the next line to write
+	base int // number of the current source's first line
+	line int // number of the next line in the current pass
+	tail []byte
+	err  error
+}
+
+// startPass begins reading the source that starts at base; a non-empty
+// header is its first line.
+func (l *logLines) startPass(header string) {
+	l.line = l.base
+	l.tail = l.tail[:0]
+	if header != "" {
+		l.emit([]byte(header + "\n"))
+	}
+}
+
+// endSource ends a pass over a complete source: its partial last line and
+// separator are written, and the next source starts after them.
+func (l *logLines) endSource(separator string) {
+	if len(l.tail) > 0 {
+		l.emit(append(l.tail, '\n'))
+		l.tail = l.tail[:0]
+	}
+	if separator != "" {
+		l.emit([]byte(separator))
+	}
+	l.base = l.line
+}
+
+// retrySource ends a pass over an incomplete source, which is read again
+// from its first line.
+func (l *logLines) retrySource() {
+	l.tail = l.tail[:0]
+}
+
+func (l *logLines) Write(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			l.tail = append(l.tail, p...)
+			break
+		}
+		if len(l.tail) > 0 {
+			l.emit(append(l.tail, p[:i+1]...))
+			l.tail = l.tail[:0]
+		} else {
+			l.emit(p[:i+1])
+		}
+		p = p[i+1:]
+	}
+	if l.err != nil {
+		return 0, l.err
+	}
+	return n, nil
+}
+
+// emit writes one newline-terminated line if it has not been written yet.
+func (l *logLines) emit(line []byte) {
+	if l.line >= l.next && l.err == nil {
+		if _, err := l.w.Write(line); err != nil {
+			l.err = err
+			return
+		}
+		l.next = l.line + 1
+	}
+	l.line++
+}
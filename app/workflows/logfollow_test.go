@@ -0,0 +1,60 @@
+package workflows
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestLogLines_RereadSourceSkipsWrittenLines(t *testing.T) {
+	var out bytes.Buffer
+	lines := &logLines{w: &out}
+
+	// A dropped stream: the partial line is held back and the pod is read
+	// again from its first line.
+	lines.startPass("=== pod-a/process.log ===")
+	_, _ = io.WriteString(lines, "one\ntw")
+	lines.retrySource()
+	lines.startPass("=== pod-a/process.log ===")
+	_, _ = io.WriteString(lines, "one\ntwo\nthree")
+	lines.endSource("\n")
+
+	lines.startPass("=== pod-b/process.log ===")
+	_, _ = io.WriteString(lines, "four\n")
+	lines.endSource("\n")
+
+	assert.Equal(t, "=== pod-a/process.log ===\none\ntwo\nthree\n\n=== pod-b/process.log ===\nfour\n\n", out.String())
+	assert.Equal(t, 8, lines.next)
+}
+
+func TestLogLines_StartsFromLine(t *testing.T) {
+	var out bytes.Buffer
+	lines := &logLines{w: &out, next: 3}
+
+	lines.startPass("")
+	_, _ = io.WriteString(lines, strings.Repeat("x\n", 3)+"fourth\nfif")
+	_, _ = io.WriteString(lines, "th\n")
+	lines.endSource("")
+
+	assert.Equal(t, "fourth\nfifth\n", out.String())
+}
+
+func TestFollowedLogContainer(t *testing.T) {
+	containerSet := &apiv1.Pod{Spec: apiv1.PodSpec{Containers: []apiv1.Container{
+		{Name: "wait"}, {Name: "download"}, {Name: "process"}, {Name: "upload"},
+	}}}
+	dagStep := &apiv1.Pod{Spec: apiv1.PodSpec{Containers: []apiv1.Container{{Name: "wait"}, {Name: "main"}}}}
+	assert.Equal(t, "process", followedLogContainer(containerSet))
+	assert.Equal(t, "main", followedLogContainer(dagStep))
+
+	client := &Client{namespace: "test-namespace"}
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/images/", "s3://bucket/output/", nil)
+	assert.False(t, isDAGWorkflow(client.buildODMWorkflow(cfg)))
+	assert.True(t, isDAGWorkflow(client.buildODMWorkflow(splitMergeTestConfig("ReadWriteMany"))))
+	assert.False(t, isDAGWorkflow(&wfv1.Workflow{}))
+}
@@ -0,0 +1,126 @@
+package workflows
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/hotosm/scaleodm/app/odmoptions"
+)
+
+// ODMOptionsComponent labels the short-lived pods that read an ODM image's
+// option catalog. They run outside Argo so they never show up as tasks.
+const ODMOptionsComponent = "odm-options"
+
+const (
+	odmOptionsContainer    = "options"
+	odmOptionsPollInterval = 2 * time.Second
+	// The dump is a few hundred KiB at most; anything past this is noise.
+	maxODMOptionsOutput = 4 << 20
+)
+
+// odmOptionsPod runs odmoptions.DumpScript in image with the same hardening
+// as the pipeline's ODM containers.
+func (c *Client) odmOptionsPod(image string, deadline time.Duration) *apiv1.Pod {
+	deadlineSeconds := int64(deadline.Seconds())
+	if deadlineSeconds <= 0 {
+		deadlineSeconds = 600
+	}
+	return &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "scaleodm-odm-options-",
+			Namespace:    c.namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":      "scaleodm",
+				"app.kubernetes.io/component": ODMOptionsComponent,
+			},
+		},
+		Spec: apiv1.PodSpec{
+			RestartPolicy:         apiv1.RestartPolicyNever,
+			ServiceAccountName:    "argo-odm",
+			ActiveDeadlineSeconds: &deadlineSeconds,
+			SecurityContext:       workflowPodSecurityContext(),
+			Containers: []apiv1.Container{
+				{
+					Name:            odmOptionsContainer,
+					Image:           image,
+					Command:         []string{"python3", "-c", odmoptions.DumpScript},
+					WorkingDir:      "/code",
+					SecurityContext: workflowContainerSecurityContext(),
+					Resources: apiv1.ResourceRequirements{
+						Requests: apiv1.ResourceList{
+							apiv1.ResourceCPU:    resource.MustParse("100m"),
+							apiv1.ResourceMemory: resource.MustParse("256Mi"),
+						},
+						Limits: apiv1.ResourceList{
+							apiv1.ResourceMemory: resource.MustParse("1Gi"),
+						},
+					},
+					VolumeMounts: []apiv1.VolumeMount{{Name: "tmp", MountPath: "/tmp"}},
+				},
+			},
+			Volumes: []apiv1.Volume{
+				{Name: "tmp", VolumeSource: apiv1.VolumeSource{EmptyDir: &apiv1.EmptyDirVolumeSource{}}},
+			},
+		},
+	}
+}
+
+// ExtractODMOptions runs odmoptions.DumpScript in image and returns its
+// output. The pod is deleted afterwards, whatever the outcome.
+func (c *Client) ExtractODMOptions(ctx context.Context, image string) ([]byte, error) {
+	deadline := 10 * time.Minute
+	if d, ok := ctx.Deadline(); ok {
+		deadline = time.Until(d)
+	}
+	podClient := c.k8sClient.CoreV1().Pods(c.namespace)
+	pod, err := podClient.Create(ctx, c.odmOptionsPod(image, deadline), metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create options pod: %w", err)
+	}
+	defer func() {
+		deleteCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := podClient.Delete(deleteCtx, pod.Name, metav1.DeleteOptions{}); err != nil {
+			log.Printf("odm options: failed to delete pod %s: %v", pod.Name, err)
+		}
+	}()
+
+	ticker := time.NewTicker(odmOptionsPollInterval)
+	defer ticker.Stop()
+	for pod.Status.Phase != apiv1.PodSucceeded && pod.Status.Phase != apiv1.PodFailed {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("options pod %s did not finish: %w", pod.Name, ctx.Err())
+		case <-ticker.C:
+		}
+		if pod, err = podClient.Get(ctx, pod.Name, metav1.GetOptions{}); err != nil {
+			return nil, fmt.Errorf("failed to get options pod: %w", err)
+		}
+	}
+
+	stream, err := podClient.GetLogs(pod.Name, &apiv1.PodLogOptions{Container: odmOptionsContainer}).Stream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read options pod logs: %w", err)
+	}
+	defer stream.Close()
+	output, err := io.ReadAll(io.LimitReader(stream, maxODMOptionsOutput))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read options pod logs: %w", err)
+	}
+	if pod.Status.Phase == apiv1.PodFailed {
+		tail := output
+		if len(tail) > 2048 {
+			tail = tail[len(tail)-2048:]
+		}
+		return nil, fmt.Errorf("options pod %s failed: %s", pod.Name, bytes.TrimSpace(tail))
+	}
+	return output, nil
+}
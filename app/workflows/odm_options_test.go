@@ -0,0 +1,30 @@
+package workflows
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/hotosm/scaleodm/app/odmoptions"
+)
+
+func TestODMOptionsPod(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+	pod := client.odmOptionsPod("ghcr.io/hotosm/odm:3.6.1", 15*time.Minute)
+
+	assert.Equal(t, "test-namespace", pod.Namespace)
+	assert.Equal(t, ODMOptionsComponent, pod.Labels["app.kubernetes.io/component"])
+	assert.Equal(t, apiv1.RestartPolicyNever, pod.Spec.RestartPolicy)
+	require.NotNil(t, pod.Spec.ActiveDeadlineSeconds)
+	assert.Equal(t, int64(900), *pod.Spec.ActiveDeadlineSeconds)
+
+	require.Len(t, pod.Spec.Containers, 1)
+	container := pod.Spec.Containers[0]
+	assert.Equal(t, "ghcr.io/hotosm/odm:3.6.1", container.Image)
+	assert.Equal(t, []string{"python3", "-c", odmoptions.DumpScript}, container.Command)
+	assert.Equal(t, "/code", container.WorkingDir)
+	assert.True(t, *container.SecurityContext.ReadOnlyRootFilesystem)
+}
@@ -0,0 +1,78 @@
+package workflows
+
+import (
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// Unless a task sets skipPostProcessing, a "postprocess" stage runs after ODM
+// and builds the point cloud tiles NodeODM serves next to the LAZ: an Entwine
+// Point Tile dataset in entwine_pointcloud/ and a COPC file beside the model.
+// Both come from untwine, which ships in the ODM image. ODM writes the EPT
+// itself with --pc-ept, in which case it is kept.
+
+// PostProcessStage names the stage that builds point cloud tiles.
+const PostProcessStage = "postprocess"
+
+// Point cloud tile outputs, relative to the task's writeS3Path.
+const (
+	PostProcessEPTFile  = "entwine_pointcloud/ept.json"
+	PostProcessCOPCFile = "odm_georeferencing/odm_georeferenced_model.copc.laz"
+)
+
+// generatePostProcessScript builds both tile formats from the georeferenced
+// point cloud, skipping any already there so a retry resumes. A task without
+// a point cloud finishes the stage without tiles.
+func generatePostProcessScript() string {
+	return odmScriptPreamble + `echo "=== postprocess attempt {{retries}} @ $(date -u +%Y-%m-%dT%H:%M:%SZ) ==="
+WORK_DIR="/workspace/$JOB_ID"
+POINT_CLOUD="$WORK_DIR/odm_georeferencing/odm_georeferenced_model.laz"
+if [ ! -s "$POINT_CLOUD" ]; then
+  echo "No georeferenced point cloud; skipping point cloud tiles"
+  exit 0
+fi
+UNTWINE="$(command -v untwine || echo /code/SuperBuild/install/bin/untwine)"
+TILE_TMP="$WORK_DIR/.untwine-tmp"
+COPC_TMP="$WORK_DIR/.untwine-copc"
+trap 'rm -rf "$TILE_TMP" "$COPC_TMP"' EXIT
+
+EPT_DIR="$WORK_DIR/entwine_pointcloud"
+if [ -s "$EPT_DIR/ept.json" ]; then
+  echo "Entwine point cloud already exists"
+else
+  rm -rf "$EPT_DIR" "$TILE_TMP"
+  mkdir -p "$TILE_TMP"
+  echo "Building Entwine point cloud"
+  "$UNTWINE" --temp_dir "$TILE_TMP" --files "$POINT_CLOUD" --output_dir "$EPT_DIR"
+fi
+
+COPC="$WORK_DIR/` + PostProcessCOPCFile + `"
+if [ -s "$COPC" ]; then
+  echo "COPC point cloud already exists"
+else
+  rm -rf "$TILE_TMP" "$COPC_TMP"
+  mkdir -p "$TILE_TMP" "$COPC_TMP"
+  echo "Building COPC point cloud"
+  "$UNTWINE" --single_file --temp_dir "$TILE_TMP" --files "$POINT_CLOUD" -o "$COPC_TMP/model.copc.laz"
+  mv "$COPC_TMP/model.copc.laz" "$COPC"
+fi
+echo "Point cloud tiles ready"
+`
+}
+
+// postProcessContainer is the postprocess stage of the single-pod pipeline,
+// run after the stage named after.
+func postProcessContainer(cfg *ODMPipelineConfig, after string) wfv1.ContainerNode {
+	return wfv1.ContainerNode{
+		Container: apiv1.Container{
+			Name:            PostProcessStage,
+			Image:           cfg.ODMImage,
+			Command:         []string{"/bin/bash", "-c"},
+			Args:            []string{generatePostProcessScript()},
+			Env:             odmProcessEnvVars(),
+			Resources:       containerRequirements(cfg.PostProcessResources),
+			SecurityContext: workflowContainerSecurityContext(),
+		},
+		Dependencies: []string{after},
+	}
+}
@@ -0,0 +1,113 @@
+package workflows
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildODMWorkflow_PostProcess(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/images/", "s3://bucket/output/", nil)
+	cfg.CreateAllZip = true
+	containers := client.buildODMWorkflow(cfg).Spec.Templates[0].ContainerSet.Containers
+	names := make([]string, len(containers))
+	for i, c := range containers {
+		names[i] = c.Name
+	}
+	require.Equal(t, []string{"download", "process", PostProcessStage, AllZipStage, "upload"}, names)
+	assert.Equal(t, []string{"process"}, containers[2].Dependencies)
+	assert.Equal(t, cfg.ODMImage, containers[2].Image)
+	assert.Equal(t, containerRequirements(cfg.PostProcessResources), containers[2].Resources)
+	assert.Contains(t, containers[2].Args[0], "--single_file")
+	assert.Equal(t, []string{PostProcessStage}, containers[3].Dependencies)
+
+	cfg.CreateAllZip = false
+	cfg.SkipPostProcessing = true
+	containers = client.buildODMWorkflow(cfg).Spec.Templates[0].ContainerSet.Containers
+	require.Len(t, containers, 3)
+	assert.Equal(t, []string{"process"}, containers[2].Dependencies)
+}
+
+func TestBuildODMWorkflow_SplitMergeSkipPostProcessing(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+	cfg := splitMergeTestConfig("ReadWriteMany")
+	cfg.SkipPostProcessing = true
+	wf := client.buildODMWorkflow(cfg)
+
+	tasks := map[string]wfv1.DAGTask{}
+	for _, task := range wf.Spec.Templates[0].DAG.Tasks {
+		tasks[task.Name] = task
+	}
+	assert.NotContains(t, tasks, PostProcessStage)
+	assert.Equal(t, []string{"merge"}, tasks["upload"].Dependencies)
+}
+
+func TestPostProcessScript_BuildsTilesOnce(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available")
+	}
+	workspace := t.TempDir()
+	bin := t.TempDir()
+	calls := filepath.Join(t.TempDir(), "calls")
+	// The fake untwine writes ept.json into --output_dir, or the COPC file
+	// named by -o with --single_file, and logs each call.
+	fake := `#!/bin/sh
+echo "$@" >> "` + calls + `"
+single=0; out=""
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --single_file) single=1 ;;
+    --output_dir|-o) out="$2"; shift ;;
+  esac
+  shift
+done
+if [ "$single" = 1 ]; then echo copc > "$out"; else mkdir -p "$out" && echo '{}' > "$out/ept.json"; fi
+`
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "untwine"), []byte(fake), 0o755))
+
+	script := strings.NewReplacer(
+		"{{workflow.name}}", "job",
+		"{{retries}}", "0",
+		"/workspace/", workspace+"/",
+	).Replace(generatePostProcessScript())
+	home := t.TempDir()
+	run := func() string {
+		cmd := exec.Command(bash, "-c", script)
+		cmd.Env = append(os.Environ(),
+			"PATH="+bin+":"+os.Getenv("PATH"),
+			"HOME="+home, "XDG_CACHE_HOME="+home, "XDG_CONFIG_HOME="+home,
+			"XDG_DATA_HOME="+home, "MPLCONFIGDIR="+home,
+		)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return string(out)
+	}
+
+	assert.Contains(t, run(), "No georeferenced point cloud")
+	assert.NoFileExists(t, calls)
+
+	jobDir := filepath.Join(workspace, "job")
+	pointCloud := filepath.Join(jobDir, "odm_georeferencing", "odm_georeferenced_model.laz")
+	require.NoError(t, os.MkdirAll(filepath.Dir(pointCloud), 0o755))
+	require.NoError(t, os.WriteFile(pointCloud, []byte("laz"), 0o644))
+
+	run()
+	assert.FileExists(t, filepath.Join(jobDir, PostProcessEPTFile))
+	assert.FileExists(t, filepath.Join(jobDir, PostProcessCOPCFile))
+	assert.NoDirExists(t, filepath.Join(jobDir, ".untwine-tmp"))
+	assert.NoDirExists(t, filepath.Join(jobDir, ".untwine-copc"))
+
+	assert.Contains(t, run(), "COPC point cloud already exists")
+	logged, err := os.ReadFile(calls)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(logged)), "\n"), 2, "a rerun must not rebuild the tiles")
+}
@@ -14,16 +14,20 @@ import (
 //     all matched imagery is fed into a single ODM run. Use a shallow depth
 //     for one task's imagery dir, or a deeper depth to roll up several task
 //     subdirs (e.g. projectid/taskid/images) into one run.
-//   - "merge-existing" (reserved, 501): given a project root that already
-//     contains per-task ODM outputs, run only the merge half of split-merge
-//     to stitch the existing orthos/DEMs/point-clouds into a single set of
-//     products. Much cheaper than re-running per-task processing from raw
-//     imagery.
-//   - "thermal" (reserved, 501): thermal imagery pipeline with a dedicated
-//     pre-processing stage (radiometric handling, alignment) before ODM.
-//   - "city-scale" (reserved, 501): large-area projects (>40 km²) that
-//     iteratively fan out from a central task with corrective alignment via
-//     prior LAZ point clouds and a final pass against a global DEM.
+//   - "merge-existing": given a project root that already contains per-task
+//     ODM outputs, run only the merge half of split-merge to stitch the
+//     existing orthos/DEMs/point-clouds into a single set of products (see
+//     splitmerge.go). Much cheaper than re-running per-task processing from
+//     raw imagery. s3ScanDepth defaults to MaxS3ScanDepth in this mode.
+//   - "thermal": thermal imagery (DJI R-JPEG, FLIR radiometric JPEG, or
+//     calibrated TIFF). A thermal stage converts radiometric JPEGs to
+//     temperature TIFFs before ODM runs with thermal-friendly flags (see
+//     thermal.go).
+//   - "city-scale": large-area projects (>40 km²) made of many task
+//     directories. Tasks are processed outwards from a central task, each
+//     aligned to a neighbour's LAZ point cloud, then merged and optionally
+//     aligned to a reference DEM (see cityscale.go). Needs a ReadWriteMany
+//     workspace; s3ScanDepth defaults to MaxS3ScanDepth in this mode.
 const (
 	ProcessingModeStandard      = "standard"
 	ProcessingModeMergeExisting = "merge-existing"
@@ -58,7 +62,7 @@ const (
 // IsImplementedProcessingMode reports whether mode has a working pipeline today.
 func IsImplementedProcessingMode(mode string) bool {
 	switch mode {
-	case ProcessingModeStandard:
+	case ProcessingModeStandard, ProcessingModeMergeExisting, ProcessingModeThermal, ProcessingModeCityScale:
 		return true
 	default:
 		return false
@@ -84,14 +88,10 @@ func ValidateS3ScanDepth(depth int) (int, error) {
 
 // IsReservedProcessingMode reports whether mode is a recognised but
 // unimplemented pipeline. Callers should respond with 501 in that case so
-// clients can probe support without ambiguity.
+// clients can probe support without ambiguity. Every recognised mode is
+// implemented today.
 func IsReservedProcessingMode(mode string) bool {
-	switch mode {
-	case ProcessingModeMergeExisting, ProcessingModeThermal, ProcessingModeCityScale:
-		return true
-	default:
-		return false
-	}
+	return false
 }
 
 // DefaultProjectExcludes is the canonical rclone-style exclude list applied
@@ -135,6 +135,16 @@ func ComposeExcludePatterns(useDefaults bool, userPatterns []string) []string {
 	return out
 }
 
+// ComposeExcludePatternsForMode is ComposeExcludePatterns for a processing
+// mode. merge-existing never applies the defaults: they exclude the very ODM
+// outputs it merges.
+func ComposeExcludePatternsForMode(mode string, useDefaults bool, userPatterns []string) []string {
+	if mode == ProcessingModeMergeExisting {
+		useDefaults = false
+	}
+	return ComposeExcludePatterns(useDefaults, userPatterns)
+}
+
 // ValidateExcludePattern checks that a user-supplied rclone filter pattern is
 // safe to embed in a --filter-from file. It rejects path traversal, absolute
 // paths, embedded newlines (which would break the filter file format), and
@@ -9,16 +9,18 @@ import (
 
 func TestIsImplementedProcessingMode(t *testing.T) {
 	assert.True(t, IsImplementedProcessingMode(ProcessingModeStandard))
-	assert.False(t, IsImplementedProcessingMode(ProcessingModeMergeExisting))
+	assert.True(t, IsImplementedProcessingMode(ProcessingModeMergeExisting))
+	assert.True(t, IsImplementedProcessingMode(ProcessingModeThermal))
+	assert.True(t, IsImplementedProcessingMode(ProcessingModeCityScale))
 	assert.False(t, IsImplementedProcessingMode("single-task"))
 	assert.False(t, IsImplementedProcessingMode("multi-task"))
 	assert.False(t, IsImplementedProcessingMode("nonsense"))
 }
 
 func TestIsReservedProcessingMode(t *testing.T) {
-	assert.True(t, IsReservedProcessingMode(ProcessingModeMergeExisting))
-	assert.True(t, IsReservedProcessingMode(ProcessingModeThermal))
-	assert.True(t, IsReservedProcessingMode(ProcessingModeCityScale))
+	assert.False(t, IsReservedProcessingMode(ProcessingModeMergeExisting))
+	assert.False(t, IsReservedProcessingMode(ProcessingModeThermal))
+	assert.False(t, IsReservedProcessingMode(ProcessingModeCityScale))
 	assert.False(t, IsReservedProcessingMode(ProcessingModeStandard))
 	assert.False(t, IsReservedProcessingMode("nonsense"))
 }
@@ -77,6 +79,13 @@ func TestComposeExcludePatterns_DefaultsOffOmitsCanonicalSet(t *testing.T) {
 	assert.NotContains(t, got, "odm_orthophoto/**")
 }
 
+func TestComposeExcludePatternsForMode_MergeExistingSkipsDefaults(t *testing.T) {
+	user := []string{"scratch/**"}
+
+	assert.Equal(t, user, ComposeExcludePatternsForMode(ProcessingModeMergeExisting, true, user))
+	assert.Contains(t, ComposeExcludePatternsForMode(ProcessingModeStandard, true, user), "odm_orthophoto/**")
+}
+
 func TestValidateExcludePattern(t *testing.T) {
 	cases := []struct {
 		name    string
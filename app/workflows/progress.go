@@ -0,0 +1,216 @@
+package workflows
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// odmStages are ODM's pipeline stages in order: the name its log announces
+// each with ("Running <marker> stage"), the name ScaleODM reports, and ODM's
+// own progress (0-100) when the stage starts.
+var odmStages = []struct {
+	marker string
+	name   string
+	start  int
+}{
+	{"dataset", "dataset", 0},
+	{"opensfm", "opensfm", 5},
+	{"openmvs", "openmvs", 25},
+	{"odm_filterpoints", "odm_filterpoints", 50},
+	{"odm_meshing", "meshing", 52},
+	{"mvs_texturing", "texturing", 60},
+	{"odm_georeferencing", "georeferencing", 70},
+	{"odm_dem", "dem", 80},
+	{"odm_orthophoto", "orthophoto", 90},
+	{"odm_report", "report", 98},
+}
+
+var odmStageMarker = regexp.MustCompile(`Running ([a-z_]+) stage`)
+
+// containerProgressWeights are the shares of a single-pod pipeline's
+// progress taken by each of its containers. ODM is most of the run; its
+// share is credited stage by stage.
+var containerProgressWeights = map[string]int{
+	"download":       5,
+	"thermal":        5,
+	"process":        75,
+	PostProcessStage: 5,
+	AllZipStage:      5,
+	"upload":         5,
+	// Checkpoints run beside process and take no time of their own.
+	CheckpointStage: 0,
+}
+
+// WorkflowProgress estimates how far a workflow is, from 0 to 100, and names
+// the stage it is in. The single-pod pipelines count their finished
+// containers, crediting process by odmStage, the last ODM stage its log
+// announced (see ODMStage). The DAG pipelines count their finished stages,
+// a fanned-out stage by its finished pods. Only a succeeded workflow is at
+// 100; a failed one is at 0, as NodeODM reports it.
+func WorkflowProgress(wf *wfv1.Workflow, odmStage string) (int, string) {
+	switch wf.Status.Phase {
+	case wfv1.WorkflowSucceeded:
+		return 100, ""
+	case wfv1.WorkflowFailed, wfv1.WorkflowError:
+		return 0, ""
+	}
+
+	var done float64
+	var stage string
+	for _, tmpl := range wf.Spec.Templates {
+		if tmpl.Name != wf.Spec.Entrypoint {
+			continue
+		}
+		switch {
+		case tmpl.DAG != nil:
+			done, stage = dagProgress(WorkflowStages(wf))
+		case tmpl.ContainerSet != nil:
+			done, stage = containerSetProgress(wf, tmpl.ContainerSet, odmStage)
+		}
+	}
+	return min(int(done*100), 99), stage
+}
+
+func containerSetProgress(wf *wfv1.Workflow, containerSet *wfv1.ContainerSetTemplate, odmStage string) (float64, string) {
+	// A retried pod runs every container again; its latest attempt counts.
+	latest := map[string]wfv1.NodeStatus{}
+	for _, node := range wf.Status.Nodes {
+		if node.Type != wfv1.NodeTypeContainer {
+			continue
+		}
+		if prev, ok := latest[node.DisplayName]; ok && !prev.StartedAt.Before(&node.StartedAt) {
+			continue
+		}
+		latest[node.DisplayName] = node
+	}
+
+	var total, done float64
+	var stage string
+	for _, container := range containerSet.Containers {
+		weight, ok := containerProgressWeights[container.Name]
+		if !ok {
+			weight = 5
+		}
+		total += float64(weight)
+		switch latest[container.Name].Phase {
+		case wfv1.NodeSucceeded:
+			done += float64(weight)
+		case wfv1.NodeRunning:
+			if stage != "" {
+				continue
+			}
+			stage = container.Name
+			if container.Name != archivedProcessLogContainer {
+				continue
+			}
+			for _, s := range odmStages {
+				if s.name == odmStage {
+					stage = s.name
+					done += float64(weight*s.start) / 100
+				}
+			}
+		}
+	}
+	if total == 0 {
+		return 0, ""
+	}
+	return done / total, stage
+}
+
+func dagProgress(stages []WorkflowStage) (float64, string) {
+	var counted, done float64
+	var stage string
+	for _, s := range stages {
+		switch s.Phase {
+		case StageSkipped:
+			continue
+		case StageSucceeded:
+			done++
+		case StageRunning:
+			if s.Total > 0 {
+				done += float64(s.Completed) / float64(s.Total)
+			}
+			if stage == "" {
+				stage = s.Name
+			}
+		}
+		counted++
+	}
+	if counted == 0 {
+		return 0, ""
+	}
+	return done / counted, stage
+}
+
+// ODMStageFromLog returns the last ODM stage a log announces, by the name
+// WorkflowProgress takes, or "" when it announces none.
+func ODMStageFromLog(r io.Reader) (string, error) {
+	var stage string
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if m := odmStageMarker.FindStringSubmatch(line); m != nil {
+			for _, s := range odmStages {
+				if s.marker == m[1] {
+					stage = s.name
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return stage, nil
+		}
+		if err != nil {
+			return stage, err
+		}
+	}
+}
+
+// ODMStage reads the process container log of a running single-pod workflow
+// from since on (all of it when since is zero) and returns the last ODM
+// stage it announces. It returns "" when the log announces none, when
+// process has not started, and for the DAG pipelines, whose ODM runs in many
+// pods.
+func (c *Client) ODMStage(ctx context.Context, workflowName string, since time.Time) (string, error) {
+	pods, err := c.workflowPods(ctx, workflowName)
+	if err != nil {
+		return "", err
+	}
+	if len(pods) == 0 {
+		return "", nil
+	}
+	// A retried pod is the newest.
+	pod := &pods[len(pods)-1]
+	if followedLogContainer(pod) != archivedProcessLogContainer || !containerStarted(pod, archivedProcessLogContainer) {
+		return "", nil
+	}
+
+	opts := &apiv1.PodLogOptions{Container: archivedProcessLogContainer}
+	if !since.IsZero() {
+		sinceTime := metav1.NewTime(since)
+		opts.SinceTime = &sinceTime
+	}
+	stream, err := c.k8sClient.CoreV1().Pods(c.namespace).GetLogs(pod.Name, opts).Stream(ctx)
+	if err != nil {
+		return "", fmt.Errorf("read process log of pod %s: %w", pod.Name, err)
+	}
+	defer stream.Close()
+	return ODMStageFromLog(stream)
+}
+
+func containerStarted(pod *apiv1.Pod, container string) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == container {
+			return status.State.Running != nil || status.State.Terminated != nil
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package workflows
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWorkflowProgress_SinglePodPipeline(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+	wf := client.buildODMWorkflow(NewDefaultODMConfig("test-project", "s3://bucket/images/", "s3://bucket/output/", nil))
+	wf.Status.Phase = wfv1.WorkflowRunning
+	wf.Status.Nodes = wfv1.Nodes{
+		"pod":         {DisplayName: "odm-pipeline-abcde", Type: wfv1.NodeTypePod, Phase: wfv1.NodeRunning},
+		"download":    {DisplayName: "download", Type: wfv1.NodeTypeContainer, Phase: wfv1.NodeSucceeded},
+		"process":     {DisplayName: "process", Type: wfv1.NodeTypeContainer, Phase: wfv1.NodeRunning},
+		"postprocess": {DisplayName: "postprocess", Type: wfv1.NodeTypeContainer, Phase: wfv1.NodePending},
+		"upload":      {DisplayName: "upload", Type: wfv1.NodeTypeContainer, Phase: wfv1.NodePending},
+	}
+
+	// download (5 of 90) is done; process has not logged a stage yet.
+	progress, stage := WorkflowProgress(wf, "")
+	assert.Equal(t, 5, progress)
+	assert.Equal(t, "process", stage)
+
+	// odm_filterpoints starts at ODM's 50%, crediting half of process.
+	progress, stage = WorkflowProgress(wf, "odm_filterpoints")
+	assert.Equal(t, (5*100+75*50)/90, progress)
+	assert.Equal(t, "odm_filterpoints", stage)
+
+	wf.Status.Phase = wfv1.WorkflowSucceeded
+	progress, stage = WorkflowProgress(wf, "report")
+	assert.Equal(t, 100, progress)
+	assert.Empty(t, stage)
+
+	wf.Status.Phase = wfv1.WorkflowFailed
+	progress, _ = WorkflowProgress(wf, "report")
+	assert.Equal(t, 0, progress)
+}
+
+func TestWorkflowProgress_RetriedPodUsesLatestAttempt(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+	wf := client.buildODMWorkflow(NewDefaultODMConfig("test-project", "s3://bucket/images/", "s3://bucket/output/", nil))
+	wf.Status.Phase = wfv1.WorkflowRunning
+	first := metav1.NewTime(time.Date(2026, 5, 20, 10, 0, 0, 0, time.UTC))
+	second := metav1.NewTime(first.Add(time.Hour))
+	wf.Status.Nodes = wfv1.Nodes{
+		"download-0": {DisplayName: "download", Type: wfv1.NodeTypeContainer, Phase: wfv1.NodeSucceeded, StartedAt: first},
+		"process-0":  {DisplayName: "process", Type: wfv1.NodeTypeContainer, Phase: wfv1.NodeFailed, StartedAt: first},
+		"download-1": {DisplayName: "download", Type: wfv1.NodeTypeContainer, Phase: wfv1.NodeRunning, StartedAt: second},
+	}
+
+	progress, stage := WorkflowProgress(wf, "openmvs")
+	assert.Equal(t, 0, progress)
+	assert.Equal(t, "download", stage)
+}
+
+func TestWorkflowProgress_DAGPipeline(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+	wf := client.buildODMWorkflow(cityScaleTestConfig())
+	wf.Status.Phase = wfv1.WorkflowRunning
+	wf.Status.Nodes = wfv1.Nodes{
+		"download": {DisplayName: "download", Type: wfv1.NodeTypePod, Phase: wfv1.NodeSucceeded},
+		"plan":     {DisplayName: "plan", Type: wfv1.NodeTypePod, Phase: wfv1.NodeSucceeded},
+		"central":  {DisplayName: "central", Type: wfv1.NodeTypePod, Phase: wfv1.NodeSucceeded},
+		"ring-1-0": {DisplayName: `ring-1(0:{"anchor":"a","task":"b"})`, Type: wfv1.NodeTypePod, Phase: wfv1.NodeSucceeded},
+		"ring-1-1": {DisplayName: `ring-1(1:{"anchor":"a","task":"c"})`, Type: wfv1.NodeTypePod, Phase: wfv1.NodeRunning},
+	}
+
+	stages := WorkflowStages(wf)
+	require.NotEmpty(t, stages)
+	progress, stage := WorkflowProgress(wf, "")
+	assert.Equal(t, int(3.5*100/float64(len(stages))), progress)
+	assert.Equal(t, "ring-1", stage)
+}
+
+func TestODMStageFromLog(t *testing.T) {
+	log := strings.Join([]string{
+		"[INFO]    Initializing ODM 3.5.4 - Thu Oct 16 10:00:00  2026",
+		"\x1b[39m[INFO]    Running dataset stage\x1b[0m",
+		"[INFO]    Running opensfm stage",
+		"[INFO]    Running split stage",
+		"\x1b[39m[INFO]    Running odm_meshing stage\x1b[0m",
+		"[INFO]    Finished odm_meshing stage",
+	}, "\n")
+
+	stage, err := ODMStageFromLog(strings.NewReader(log))
+	require.NoError(t, err)
+	assert.Equal(t, "meshing", stage)
+
+	stage, err = ODMStageFromLog(strings.NewReader("no markers\n"))
+	require.NoError(t, err)
+	assert.Empty(t, stage)
+}
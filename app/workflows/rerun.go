@@ -0,0 +1,43 @@
+package workflows
+
+import (
+	"fmt"
+	"strings"
+)
+
+// With ODMPipelineConfig.KeepIntermediates the upload stage saves the ODM
+// project to s3.IntermediatesPath(WriteS3Path). A task restarted with
+// RerunFrom restores it after the imagery is downloaded and runs ODM with
+// --rerun-from, so a new orthophoto resolution recomputes the orthophoto
+// rather than the whole reconstruction. The rerun may change the options;
+// ODM reruns the stages they affect only from RerunFrom on.
+
+// Resumable reports whether tasks of processingMode with split can be
+// resumed from a saved ODM project: only single-pod ODM runs keep their
+// project in one workspace.
+func Resumable(processingMode string, split int) bool {
+	switch processingMode {
+	case "", ProcessingModeStandard, ProcessingModeThermal:
+		return split <= 0
+	}
+	return false
+}
+
+// RerunStages lists the ODM stages a rerun can start from, in order.
+func RerunStages() []string {
+	stages := make([]string, 0, len(odmStages))
+	for _, s := range odmStages {
+		stages = append(stages, s.marker)
+	}
+	return stages
+}
+
+// ValidateRerunFrom checks that stage is one of RerunStages.
+func ValidateRerunFrom(stage string) error {
+	for _, s := range odmStages {
+		if s.marker == stage {
+			return nil
+		}
+	}
+	return fmt.Errorf("rerunFrom must be one of %s", strings.Join(RerunStages(), ", "))
+}
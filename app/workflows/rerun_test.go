@@ -0,0 +1,68 @@
+package workflows
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResumable(t *testing.T) {
+	assert.True(t, Resumable(ProcessingModeStandard, 0))
+	assert.True(t, Resumable("", 0))
+	assert.True(t, Resumable(ProcessingModeThermal, 0))
+	assert.False(t, Resumable(ProcessingModeStandard, 200))
+	assert.False(t, Resumable(ProcessingModeMergeExisting, 0))
+	assert.False(t, Resumable(ProcessingModeCityScale, 0))
+}
+
+func TestValidateRerunFrom(t *testing.T) {
+	assert.NoError(t, ValidateRerunFrom("odm_orthophoto"))
+	assert.NoError(t, ValidateRerunFrom("openmvs"))
+	err := ValidateRerunFrom("orthophoto")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "dataset, opensfm, openmvs")
+}
+
+func TestBuildODMWorkflow_KeepIntermediates(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/images/", "s3://bucket/output/", nil)
+	cfg.KeepIntermediates = true
+	containers := client.buildODMWorkflow(cfg).Spec.Templates[0].ContainerSet.Containers
+	upload := containers[len(containers)-1]
+	require.Equal(t, "upload", upload.Name)
+	assert.Contains(t, upload.Args[0], `rclone sync "$SRC_DIR" "$INTERMEDIATES_REMOTE/project"`)
+	assert.Less(t, strings.Index(upload.Args[0], "Running final upload"), strings.Index(upload.Args[0], "Saving the ODM project"))
+
+	cfg.Split = 200
+	containers = client.buildODMWorkflow(cfg).Spec.Templates[0].ContainerSet.Containers
+	assert.NotContains(t, containers[len(containers)-1].Args[0], "INTERMEDIATES_REMOTE")
+}
+
+func TestBuildODMWorkflow_RerunFrom(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/images/", "s3://bucket/output/", []string{"--orthophoto-resolution=2"})
+	cfg.KeepIntermediates = true
+	cfg.RerunFrom = "odm_orthophoto"
+	containers := client.buildODMWorkflow(cfg).Spec.Templates[0].ContainerSet.Containers
+	download, process := containers[0].Args[0], containers[1].Args[0]
+
+	assert.Contains(t, download, `rclone copy "$INTERMEDIATES_REMOTE/project" "$SRC_DIR"`)
+	assert.Contains(t, download, `echo "odm_orthophoto" > "$STATE_DIR/resume-from"`)
+	imagery := strings.Index(download, `rclone copy "$S3_REMOTE" "$DEST_DIR"`)
+	require.GreaterOrEqual(t, imagery, 0)
+	assert.Less(t, imagery, strings.Index(download, "Restoring the ODM project"))
+	assert.Contains(t, process, `odm_args="--rerun-from $resume_from $odm_args"`)
+
+	// A checkpointed rerun restores its own checkpoint first, and keeps it
+	// over the saved project on a retry.
+	cfg.Checkpoint = true
+	cfg.CheckpointStages = []string{"openmvs"}
+	download = client.buildODMWorkflow(cfg).Spec.Templates[0].ContainerSet.Containers[0].Args[0]
+	assert.Less(t, strings.Index(download, "Checking for an ODM checkpoint"), strings.Index(download, "Restoring the ODM project"))
+	assert.Contains(t, download, `if [ "{{retries}}" = "0" ] && [ "false" != "true" ]; then`)
+	assert.NotContains(t, download[strings.Index(download, "Restoring the ODM project"):], `rm -f "$STATE_DIR/resume-from"`)
+}
@@ -0,0 +1,152 @@
+package workflows
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hotosm/scaleodm/app/s3"
+)
+
+// MaxSidecarBytes bounds the ODM sidecar files the API reads to validate.
+const MaxSidecarBytes = 16 << 20
+
+// SidecarFilePath returns a sidecar file's path in the shared workspace,
+// where the download stage leaves it.
+func SidecarFilePath(jobID, name string) string {
+	return fmt.Sprintf("/workspace/%s/%s", jobID, name)
+}
+
+// withSidecarFlags points ODM at the sidecar files it does not find by itself.
+// ODM searches the project for gcp_list.txt and geo.txt and reads
+// image_groups.txt from it, but takes cameras.json only through --cameras,
+// which the task's own options override.
+func withSidecarFlags(odmFlags, sidecars []string, jobID string) []string {
+	if !slices.Contains(sidecars, s3.CamerasFileName) {
+		return odmFlags
+	}
+	for _, flag := range odmFlags {
+		if name, _, _ := strings.Cut(flag, "="); name == "--cameras" {
+			return odmFlags
+		}
+	}
+	return append(append([]string{}, odmFlags...),
+		fmt.Sprintf("--cameras=%s", SidecarFilePath(jobID, s3.CamerasFileName)))
+}
+
+// ValidateSidecarS3Path checks an s3:// URL naming a sidecar file, such as
+// gcpS3Path. field names the request field in errors.
+func ValidateSidecarS3Path(field, value string) error {
+	if !strings.HasPrefix(value, "s3://") {
+		return fmt.Errorf("%s must be an s3:// path", field)
+	}
+	return validateObjectS3Path(field, value)
+}
+
+// sidecarFormat describes a whitespace-separated ODM sidecar file: an
+// optional projection header, then one entry per line naming an image.
+type sidecarFormat struct {
+	header     bool
+	minFields  int
+	imageField int
+	// Fields [numbersFrom, numbersTo) must be numbers; numbersTo < 0 means
+	// every field from numbersFrom on.
+	numbersFrom, numbersTo int
+}
+
+var sidecarFormats = map[string]sidecarFormat{
+	// geo_x geo_y geo_z im_x im_y image_name [gcp_name] ...
+	s3.GCPFileName: {header: true, minFields: 6, imageField: 5, numbersFrom: 0, numbersTo: 5},
+	// image_name geo_x geo_y [geo_z] [yaw pitch roll] [horz_acc vert_acc]
+	s3.GeoFileName: {header: true, minFields: 3, imageField: 0, numbersFrom: 1, numbersTo: -1},
+	// image_name group_name
+	s3.ImageGroupsFileName: {minFields: 2, imageField: 0},
+}
+
+// ValidateSidecarFile checks the contents of an ODM sidecar file before the
+// task is submitted, so a malformed file fails the request rather than the
+// ODM run. name is one of s3.ODMSidecarFiles; images counts the base names of
+// the images the download stage keeps. The text files must name at least one
+// of those images, and never one that appears twice: flattening the imagery
+// renames the second copy.
+func ValidateSidecarFile(name string, data []byte, images map[string]int) error {
+	if name == s3.CamerasFileName {
+		var cameras map[string]any
+		if err := json.Unmarshal(data, &cameras); err != nil {
+			return fmt.Errorf("%s is not a JSON object: %w", name, err)
+		}
+		if len(cameras) == 0 {
+			return fmt.Errorf("%s defines no cameras", name)
+		}
+		return nil
+	}
+	format, ok := sidecarFormats[name]
+	if !ok {
+		return fmt.Errorf("%s is not an ODM sidecar file", name)
+	}
+
+	// Blank lines and "#" comments are skipped, as ODM does.
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), MaxSidecarBytes)
+	needHeader := format.header
+	lineNo, entries, matched := 0, 0, 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if needHeader {
+			if !isSidecarProjection(line) {
+				return fmt.Errorf("%s line %d: expected a projection header such as EPSG:4326, WGS84 UTM 32N or +proj=..., got %q", name, lineNo, line)
+			}
+			needHeader = false
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < format.minFields {
+			return fmt.Errorf("%s line %d: expected at least %d fields, got %d", name, lineNo, format.minFields, len(fields))
+		}
+		numbers := fields[format.numbersFrom:]
+		if format.numbersTo >= 0 {
+			numbers = fields[format.numbersFrom:format.numbersTo]
+		}
+		for _, field := range numbers {
+			if _, err := strconv.ParseFloat(field, 64); err != nil {
+				return fmt.Errorf("%s line %d: %q is not a number", name, lineNo, field)
+			}
+		}
+
+		entries++
+		image := fields[format.imageField]
+		switch images[image] {
+		case 0:
+		case 1:
+			matched++
+		default:
+			return fmt.Errorf("%s line %d: image %q appears %d times under readS3Path; image names must be unique", name, lineNo, image, images[image])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read %s: %w", name, err)
+	}
+	if entries == 0 {
+		return fmt.Errorf("%s has no entries", name)
+	}
+	if matched == 0 {
+		return fmt.Errorf("%s names none of the images under readS3Path", name)
+	}
+	return nil
+}
+
+// isSidecarProjection reports whether line is a projection header ODM reads:
+// an EPSG code, a WGS84 UTM zone or a proj4 string.
+func isSidecarProjection(line string) bool {
+	upper := strings.ToUpper(line)
+	return strings.HasPrefix(upper, "EPSG:") || strings.HasPrefix(upper, "WGS84") || strings.HasPrefix(line, "+proj")
+}
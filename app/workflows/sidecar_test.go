@@ -0,0 +1,79 @@
+package workflows
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hotosm/scaleodm/app/s3"
+)
+
+func TestValidateSidecarFile(t *testing.T) {
+	images := map[string]int{"DJI_0001.JPG": 1, "DJI_0002.JPG": 1, "DJI_0003.JPG": 2}
+
+	valid := map[string]string{
+		s3.GCPFileName: "EPSG:32632\n# surveyed 2026-05-01\n" +
+			"500100.1 5000200.2 120.5 1024 768 DJI_0001.JPG gcp-1\n" +
+			"500110.1 5000210.2 121.5 300 400 DJI_0009.JPG gcp-2\n",
+		s3.GeoFileName:         "EPSG:4326\nDJI_0001.JPG 9.19 45.46 150.0\nDJI_0002.JPG 9.20 45.47\n",
+		s3.ImageGroupsFileName: "DJI_0001.JPG A\nDJI_0002.JPG B\n",
+		s3.CamerasFileName:     `{"v2 dji fc6310 5472 3648 brown 0.6666": {"projection_type": "brown"}}`,
+	}
+	for name, data := range valid {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, ValidateSidecarFile(name, []byte(data), images))
+		})
+	}
+
+	for name, tc := range map[string]struct {
+		file, data, want string
+	}{
+		"gcp without header":   {s3.GCPFileName, "500100 5000200 120 1024 768 DJI_0001.JPG\n", "projection header"},
+		"gcp short line":       {s3.GCPFileName, "WGS84 UTM 32N\n500100 5000200 120 DJI_0001.JPG\n", "at least 6 fields"},
+		"gcp non-numeric":      {s3.GCPFileName, "EPSG:32632\n500100 north 120 1024 768 DJI_0001.JPG\n", `"north" is not a number`},
+		"gcp header only":      {s3.GCPFileName, "EPSG:32632\n", "no entries"},
+		"gcp unknown images":   {s3.GCPFileName, "EPSG:32632\n500100 5000200 120 1024 768 other.jpg\n", "names none of the images"},
+		"geo ambiguous image":  {s3.GeoFileName, "EPSG:4326\nDJI_0003.JPG 9.19 45.46\n", "appears 2 times"},
+		"image groups short":   {s3.ImageGroupsFileName, "DJI_0001.JPG\n", "at least 2 fields"},
+		"cameras not json":     {s3.CamerasFileName, "fc6310: brown", "not a JSON object"},
+		"cameras empty":        {s3.CamerasFileName, "{}", "defines no cameras"},
+		"not a sidecar":        {"notes.txt", "hello", "not an ODM sidecar file"},
+		"proj4 header, no row": {s3.GeoFileName, "+proj=utm +zone=32 +datum=WGS84\n\n", "no entries"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateSidecarFile(tc.file, []byte(tc.data), images)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.want)
+		})
+	}
+}
+
+func TestValidateSidecarS3Path(t *testing.T) {
+	assert.NoError(t, ValidateSidecarS3Path("gcpS3Path", "s3://bucket/survey/gcp_list.txt"))
+	assert.ErrorContains(t, ValidateSidecarS3Path("gcpS3Path", "https://example.com/gcp_list.txt"), "gcpS3Path must be an s3:// path")
+	assert.ErrorContains(t, ValidateSidecarS3Path("geoS3Path", "s3://bucket/survey/"), "geoS3Path must name an object, not a prefix")
+	assert.ErrorContains(t, ValidateSidecarS3Path("geoS3Path", "s3://bucket/$(id).txt"), "invalid characters")
+}
+
+func TestBuildODMWorkflow_Sidecars(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/images/", "s3://bucket/output/", []string{"--dsm"})
+	cfg.Sidecars = []string{s3.GCPFileName, s3.CamerasFileName}
+	cfg.GCPS3Path = "s3://bucket/survey/gcp_list.txt"
+	wf := client.buildODMWorkflow(cfg)
+
+	containers := map[string]string{}
+	for _, node := range wf.Spec.Templates[0].ContainerSet.Containers {
+		containers[node.Name] = node.Args[0]
+	}
+	assert.Contains(t, containers["download"], "Keeping ODM sidecar files")
+	assert.Contains(t, containers["download"], `rclone copyto "$SIDECAR_REMOTE" "/workspace/{{workflow.name}}/gcp_list.txt"`)
+	assert.NotContains(t, containers["download"], "geo.txt from")
+	assert.Contains(t, containers["process"], "--dsm --cameras=/workspace/{{workflow.name}}/cameras.json --project-path")
+
+	// The task's own --cameras wins.
+	assert.Equal(t, []string{"--cameras=/data/cameras.json"},
+		withSidecarFlags([]string{"--cameras=/data/cameras.json"}, cfg.Sidecars, "job-1"))
+	assert.Equal(t, []string{"--dsm"}, withSidecarFlags([]string{"--dsm"}, []string{s3.GCPFileName}, "job-1"))
+}
@@ -1,3 +1,561 @@
 package workflows
 
-// TODO
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/hotosm/scaleodm/app/config"
+	"github.com/hotosm/scaleodm/app/s3"
+)
+
+// The merge stage stitches per-task ODM products into one product set. It is
+// the merge half of split-merge: the merge-existing mode runs it alone over
+// tasks that were processed earlier, downloaded by
+// s3.GenerateMergeInputsDownloadScript into mergeInputsDir.
+//
+// Rasters are mosaicked with gdalwarp in the CRS of the first input; where
+// tasks overlap, later inputs (in path order) win. ODM's own merge blends
+// along cutlines computed during the split, which finished products no
+// longer carry, so overlap seams can be visible. Point clouds are
+// concatenated with pdal merge and must share a CRS.
+const mergeInputsDir = "merge_inputs"
+
+// Merge workspace sizing: the inputs, the merged products (roughly the same
+// size again) and GDAL's temporary files, plus fixed headroom.
+const (
+	mergeWorkspaceInputMultiplier = 3.0
+	mergeWorkspaceMinGiB          = 20.0
+)
+
+// generateMergeScript returns the process-container script for the merge
+// stage, merging the products found under inputDir (relative to the job's
+// workspace directory). It writes the standard ODM layout to
+// /workspace/$JOB_ID and removes the inputs so the upload stage copies only
+// the merged products.
+func generateMergeScript(inputDir string) string {
+	var merges strings.Builder
+	for _, product := range s3.MergeProductPaths {
+		switch {
+		case strings.HasSuffix(product, ".laz"):
+			fmt.Fprintf(&merges, "merge_point_clouds %q\n", product)
+		case strings.HasPrefix(product, "odm_dem/"):
+			fmt.Fprintf(&merges, "merge_rasters %q dem\n", product)
+		default:
+			fmt.Fprintf(&merges, "merge_rasters %q ortho\n", product)
+		}
+	}
+
+	return `set -e
+set -o pipefail
+JOB_ID="{{workflow.name}}"
+WORK_DIR="/workspace/$JOB_ID"
+INPUT_DIR="$WORK_DIR/` + inputDir + `"
+echo "=== merge attempt {{retries}} @ $(date -u +%Y-%m-%dT%H:%M:%SZ) ==="
+mkdir -p "$HOME" "$XDG_CACHE_HOME" "$XDG_CONFIG_HOME" "$XDG_DATA_HOME" "$MPLCONFIGDIR"
+
+PDAL_BIN=$(command -v pdal || echo /code/SuperBuild/install/bin/pdal)
+GTIFF_OPTS="-co TILED=YES -co COMPRESS=DEFLATE -co BIGTIFF=IF_SAFER"
+MERGED=0
+
+# find_inputs prints every copy of a product, one per line, in a
+# stable order.
+find_inputs() {
+  find "$INPUT_DIR" -type f -path "*/$1" | sort
+}
+
+merge_rasters() {
+  local product="$1" kind="$2"
+  local out="$WORK_DIR/$product"
+  local inputs=()
+  mapfile -t inputs < <(find_inputs "$product")
+  if [ "${#inputs[@]}" -eq 0 ]; then
+    echo "No inputs for $product, skipping"
+    return
+  fi
+  mkdir -p "$(dirname "$out")"
+  echo "Merging ${#inputs[@]} x $product"
+  if [ "${#inputs[@]}" -eq 1 ]; then
+    cp "${inputs[0]}" "$out"
+  elif [ "$kind" = "dem" ]; then
+    gdalwarp -overwrite -multi -wo NUM_THREADS=ALL_CPUS -srcnodata -9999 -dstnodata -9999 $GTIFF_OPTS "${inputs[@]}" "$out"
+  else
+    # Orthophotos carry an alpha band; keep it as the mosaic's mask.
+    gdalwarp -overwrite -multi -wo NUM_THREADS=ALL_CPUS -srcalpha -dstalpha $GTIFF_OPTS "${inputs[@]}" "$out"
+    gdaladdo -r average --config COMPRESS_OVERVIEW DEFLATE "$out" 2 4 8 16 32
+  fi
+  MERGED=$((MERGED + 1))
+}
+
+merge_point_clouds() {
+  local product="$1"
+  local out="$WORK_DIR/$product"
+  local inputs=()
+  mapfile -t inputs < <(find_inputs "$product")
+  if [ "${#inputs[@]}" -eq 0 ]; then
+    echo "No inputs for $product, skipping"
+    return
+  fi
+  mkdir -p "$(dirname "$out")"
+  echo "Merging ${#inputs[@]} x $product"
+  if [ "${#inputs[@]}" -eq 1 ]; then
+    cp "${inputs[0]}" "$out"
+  else
+    "$PDAL_BIN" merge "${inputs[@]}" "$out"
+  fi
+  MERGED=$((MERGED + 1))
+}
+
+` + merges.String() + `
+if [ "$MERGED" -eq 0 ]; then
+  echo "ERROR: no task products found under $INPUT_DIR"
+  exit 1
+fi
+
+rm -rf "$INPUT_DIR"
+echo "Merge complete: $MERGED products"
+find "$WORK_DIR" -type f ! -path "*/.rclone/*" | sort`
+}
+
+// estimateMergeWorkspaceGiB sizes the workspace for the merge stage from the
+// total size of the downloaded products. Returns 0 when it can't be
+// estimated.
+func estimateMergeWorkspaceGiB(inputTotalBytes int64) float64 {
+	maxGiB := config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_MAX_GIB
+	if inputTotalBytes <= 0 || maxGiB <= 0 {
+		return 0
+	}
+	gib := float64(inputTotalBytes) / (1 << 30) * mergeWorkspaceInputMultiplier
+	return clamp(gib, math.Min(mergeWorkspaceMinGiB, maxGiB), maxGiB)
+}
+
+// Split-merge breaks a large dataset into overlapping submodels that are
+// processed independently and merged back into one product set. ODM runs it
+// in a single pod when given --split; when the workspace is a ReadWriteMany
+// PVC every pod can share, ScaleODM instead fans the submodels out as an Argo
+// DAG:
+//
+//	download -> plan -> process-<tier> (one pod per submodel) -> merge -> upload
+//
+// plan runs the first half of ODM's split stage as a distributed
+// (--sm-cluster) run would - set up OpenSfM and create_submodels, with no
+// central feature matching - and sorts the submodels into sizing tiers. Each
+// tier has its own process template sized by
+// estimateProcessResourcesFromImageCount for the tier's largest submodel.
+// merge marks the split done and reruns ODM on the project, whose merge stage
+// stitches the submodel outputs together. Submodels are not aligned to each
+// other first, as with ODM's --sm-no-align.
+const (
+	splitFlagName        = "split"
+	splitOverlapFlagName = "split-overlap"
+	splitPlanDir         = "/tmp/scaleodm-plan"
+
+	// splitMergeWorkspaceMultiplier covers the submodel copies of overlapping
+	// images and their intermediates on top of the standard estimate.
+	splitMergeWorkspaceMultiplier = 1.5
+)
+
+// submodelTierFactors are the tier caps as multiples of the split size.
+// Submodels hold about split images plus the overlap, so most land in the
+// 1x or 1.5x tier; the last tier (the whole dataset) catches the rest.
+var submodelTierFactors = []float64{0.5, 1, 1.5, 2}
+
+// submodelFlagsRemoved are options that must not reach a submodel run,
+// following ODM's get_submodel_argv: they either re-trigger the split or
+// produce outputs that are wasted on a submodel.
+var submodelFlagsRemoved = map[string]bool{
+	splitFlagName:        true,
+	splitOverlapFlagName: true,
+	"rerun-from":         true,
+	"rerun":              true,
+	"rerun-all":          true,
+	"end-with":           true,
+	"sm-cluster":         true,
+	"gcp":                true,
+	"pc-csv":             true,
+	"pc-las":             true,
+	"pc-ept":             true,
+	"tiles":              true,
+	"copy-to":            true,
+	"cog":                true,
+	"max-concurrency":    true,
+}
+
+// submodelFlagsAdded are required by ODM's merge stage on every submodel.
+var submodelFlagsAdded = []string{
+	"--orthophoto-cutline",
+	"--dem-euclidean-map",
+	"--skip-3dmodel",
+	"--skip-report",
+}
+
+// ParseSplitFlags removes --split and --split-overlap from odmFlags so they
+// can be carried on ODMPipelineConfig instead. A zero split means the flags
+// were absent; a zero overlap means ODM's default.
+func ParseSplitFlags(odmFlags []string) (rest []string, split int, overlap float64, err error) {
+	rest = make([]string, 0, len(odmFlags))
+	for _, flag := range odmFlags {
+		name, value, _ := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+		switch name {
+		case splitFlagName:
+			split, err = strconv.Atoi(value)
+			if err != nil || split < 2 {
+				return nil, 0, 0, fmt.Errorf("split must be an integer >= 2 (got %q)", value)
+			}
+		case splitOverlapFlagName:
+			overlap, err = strconv.ParseFloat(value, 64)
+			if err != nil || overlap < 0 || math.IsNaN(overlap) || math.IsInf(overlap, 0) {
+				return nil, 0, 0, fmt.Errorf("split-overlap must be a number of meters >= 0 (got %q)", value)
+			}
+		default:
+			rest = append(rest, flag)
+		}
+	}
+	if overlap > 0 && split == 0 {
+		return nil, 0, 0, fmt.Errorf("split-overlap requires split")
+	}
+	return rest, split, overlap, nil
+}
+
+// IsSplitMerge reports whether ODM will split the task into submodels: split
+// is set and the dataset is larger than one submodel.
+func (cfg *ODMPipelineConfig) IsSplitMerge() bool {
+	return cfg.Split > 0 && cfg.ImageCount > cfg.Split
+}
+
+// distributedSplitMerge reports whether a split-merge task fans out across
+// pods. That needs a workspace every pod can mount at once. Only standard
+// tasks fan out; other modes leave the split to ODM in their process stage.
+func distributedSplitMerge(cfg *ODMPipelineConfig) bool {
+	return cfg.IsSplitMerge() &&
+		(cfg.ProcessingMode == "" || cfg.ProcessingMode == ProcessingModeStandard) &&
+		IsSharedWorkspace(cfg.Workspace)
+}
+
+// IsSharedWorkspace reports whether every pod of a workflow can mount the
+// workspace at once: a ReadWriteMany PVC.
+func IsSharedWorkspace(workspace WorkspaceConfig) bool {
+	return shouldUseWorkspacePVC(workspace) &&
+		parseWorkspaceAccessMode(workspace.AccessMode) == apiv1.ReadWriteMany
+}
+
+// runsAsDAG reports whether the task's pipeline runs one pod per step
+// rather than as the single-pod main ContainerSet.
+func runsAsDAG(cfg *ODMPipelineConfig) bool {
+	return distributedSplitMerge(cfg) || cfg.ProcessingMode == ProcessingModeCityScale
+}
+
+// splitFlags renders the config's split options back into ODM flags.
+func splitFlags(cfg *ODMPipelineConfig) []string {
+	if cfg.Split <= 0 {
+		return nil
+	}
+	flags := []string{fmt.Sprintf("--%s=%d", splitFlagName, cfg.Split)}
+	if cfg.SplitOverlap > 0 {
+		flags = append(flags, fmt.Sprintf("--%s=%s", splitOverlapFlagName, strconv.FormatFloat(cfg.SplitOverlap, 'f', -1, 64)))
+	}
+	return flags
+}
+
+// submodelODMFlags adapts the task's flags for one submodel run.
+func submodelODMFlags(odmFlags []string) []string {
+	flags := make([]string, 0, len(odmFlags)+len(submodelFlagsAdded))
+	present := map[string]bool{}
+	for _, flag := range odmFlags {
+		name, value, _ := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+		if submodelFlagsRemoved[name] {
+			continue
+		}
+		// DEM merging assumes cropped submodel DEMs.
+		if name == "crop" && value == "0" {
+			flag = "--crop=0.015625"
+		}
+		present[name] = true
+		flags = append(flags, flag)
+	}
+	for _, flag := range submodelFlagsAdded {
+		if !present[strings.TrimPrefix(flag, "--")] {
+			flags = append(flags, flag)
+		}
+	}
+	return flags
+}
+
+type submodelTier struct {
+	maxImages int
+	resources ContainerResources
+}
+
+// submodelTiers returns the sizing tiers for a distributed split-merge, in
+// ascending order of size.
+func submodelTiers(cfg *ODMPipelineConfig, odmFlags []string) []submodelTier {
+	var tiers []submodelTier
+	for _, factor := range submodelTierFactors {
+		images := int(math.Ceil(float64(cfg.Split) * factor))
+		if images >= cfg.ImageCount {
+			break
+		}
+		if len(tiers) > 0 && images <= tiers[len(tiers)-1].maxImages {
+			continue
+		}
+		tiers = append(tiers, submodelTier{maxImages: images})
+	}
+	tiers = append(tiers, submodelTier{maxImages: cfg.ImageCount})
+	for i := range tiers {
+		tiers[i].resources = estimateProcessResourcesFromImageCount(tiers[i].maxImages, odmFlags, cfg.ProcessResources)
+	}
+	return tiers
+}
+
+// withMaxConcurrency caps ODM workers to the resources' CPU limit unless the
+// flags already set it.
+func withMaxConcurrency(odmFlags []string, resources ContainerResources) []string {
+	for _, f := range odmFlags {
+		if f == "--max-concurrency" || strings.HasPrefix(f, "--max-concurrency=") {
+			return odmFlags
+		}
+	}
+	cores := parseCPUCores(resources.Limits.CPU)
+	if cores < 1 {
+		return odmFlags
+	}
+	return append(append([]string{}, odmFlags...), fmt.Sprintf("--max-concurrency=%d", cores))
+}
+
+// splitPlanScript is the Python run in the ODM image to create submodels.
+// It mirrors the distributed branch of ODM's ODMSplitStage.
+const splitPlanScript = `import json
+import os
+import shutil
+import sys
+
+sys.path.insert(0, os.getcwd())
+from opendm import config, io, log, types
+from opendm.gcp import GCPFile
+from opendm.osfm import OSFMContext
+from opensfm.large import metadataset
+from stages.dataset import load_images_database
+
+TIER_MAX_IMAGES = __TIER_MAX_IMAGES__
+PLAN_DIR = "__PLAN_DIR__"
+
+args = config.config(sys.argv[1:])
+args.project_path = os.path.join(args.project_path, args.name)
+tree = types.ODM_Tree(args.project_path, args.gcp, args.geo, args.align)
+photos = load_images_database(os.path.join(tree.root_path, "images.json"))
+reconstruction = types.ODM_Reconstruction(photos)
+multiplier = (1.0 / len(reconstruction.multi_camera)) if reconstruction.multi_camera else 1.0
+
+octx = OSFMContext(tree.opensfm)
+octx.setup(args, tree.dataset_raw, reconstruction=reconstruction, append_config=[
+    "submodels_relpath: " + os.path.join("..", "submodels", "opensfm"),
+    "submodel_relpath_template: " + os.path.join("..", "submodels", "submodel_%04d", "opensfm"),
+    "submodel_images_relpath_template: " + os.path.join("..", "submodels", "submodel_%04d", "images"),
+    "submodel_size: %s" % max(2, int(float(args.split) * multiplier)),
+    "submodel_overlap: %s" % args.split_overlap,
+], rerun=True)
+octx.photos_to_metadata(photos, args.rolling_shutter, args.rolling_shutter_readout, True)
+# The dataset stage wrote a UTM copy of the task's gcp_list.txt, if any.
+gcp = GCPFile(tree.odm_georeferencing_gcp_utm) if os.path.isfile(tree.odm_georeferencing_gcp_utm) else None
+
+if os.path.isdir(tree.submodels_path):
+    shutil.rmtree(tree.submodels_path)
+octx.run("create_submodels")
+
+tiers = [[] for _ in TIER_MAX_IMAGES]
+for path in sorted(metadataset.MetaDataSet(tree.opensfm).get_submodel_paths()):
+    submodel_dir = os.path.dirname(os.path.abspath(path))
+    name = os.path.basename(submodel_dir)
+    if gcp is not None and gcp.exists():
+        submodel_gcp = os.path.join(submodel_dir, "gcp_list.txt")
+        if gcp.make_filtered_copy(submodel_gcp, os.path.join(submodel_dir, "images")):
+            io.copy(submodel_gcp, os.path.join(submodel_dir, "opensfm", "gcp_list.txt"))
+    if tree.odm_geo_file is not None and os.path.isfile(tree.odm_geo_file):
+        io.copy(tree.odm_geo_file, os.path.join(submodel_dir, "geo.txt"))
+    count = len(os.listdir(os.path.join(submodel_dir, "images")))
+    tier = next((i for i, cap in enumerate(TIER_MAX_IMAGES) if count <= cap), len(TIER_MAX_IMAGES) - 1)
+    tiers[tier].append(name)
+    log.ODM_INFO("%s: %d images, tier %d" % (name, count, tier))
+
+for i, names in enumerate(tiers):
+    with open(os.path.join(PLAN_DIR, "tier-%d.json" % i), "w") as f:
+        json.dump(names, f)
+
+# The merge run skips the split stage once this exists.
+octx.touch(octx.path("split_done.txt"))
+log.ODM_INFO("Created %d submodels" % sum(len(names) for names in tiers))
+`
+
+// odmScriptPreamble is shared by every ODM-image script.
+const odmScriptPreamble = `set -e
+set -o pipefail
+JOB_ID="{{workflow.name}}"
+mkdir -p "$HOME" "$XDG_CACHE_HOME" "$XDG_CONFIG_HOME" "$XDG_DATA_HOME" "$MPLCONFIGDIR"
+`
+
+func generateSplitPlanScript(odmFlags []string, tiers []submodelTier) string {
+	caps := make([]string, len(tiers))
+	for i, tier := range tiers {
+		caps[i] = strconv.Itoa(tier.maxImages)
+	}
+	planScript := strings.NewReplacer(
+		"__TIER_MAX_IMAGES__", "["+strings.Join(caps, ", ")+"]",
+		"__PLAN_DIR__", splitPlanDir,
+	).Replace(splitPlanScript)
+
+	return odmScriptPreamble + `echo "=== plan attempt {{retries}} @ $(date -u +%Y-%m-%dT%H:%M:%SZ) ==="
+PLAN_DIR="` + splitPlanDir + `"
+mkdir -p "$PLAN_DIR"
+odm_args="` + strings.Join(odmFlags, " ") + ` --project-path /workspace $JOB_ID"
+echo "Loading dataset: python3 -u run.py $odm_args --end-with dataset"
+python3 -u run.py $odm_args --end-with dataset
+cat > "$PLAN_DIR/plan.py" <<'SPLIT_PLAN_EOF'
+` + planScript + `SPLIT_PLAN_EOF
+python3 -u "$PLAN_DIR/plan.py" $odm_args
+`
+}
+
+func generateSubmodelScript(odmFlags []string) string {
+	return odmScriptPreamble + `SUBMODEL="{{inputs.parameters.submodel}}"
+echo "=== $SUBMODEL attempt {{retries}} @ $(date -u +%Y-%m-%dT%H:%M:%SZ) ==="
+odm_args="` + strings.Join(odmFlags, " ") + ` --project-path /workspace/$JOB_ID/submodels $SUBMODEL"
+echo "Executing: python3 -u run.py $odm_args"
+python3 -u run.py $odm_args
+echo "$SUBMODEL complete"
+`
+}
+
+func generateSplitMergeScript(odmFlags []string) string {
+	return odmScriptPreamble + `echo "=== merge attempt {{retries}} @ $(date -u +%Y-%m-%dT%H:%M:%SZ) ==="
+touch "/workspace/$JOB_ID/opensfm/split_done.txt"
+odm_args="` + strings.Join(odmFlags, " ") + ` --project-path /workspace $JOB_ID"
+echo "Executing: python3 -u run.py $odm_args"
+python3 -u run.py $odm_args
+echo "Merge complete"
+`
+}
+
+// dagSteps builds the step templates of a pipeline that runs as an Argo DAG,
+// one pod per step. Every step mounts the shared workspace PVC and its own
+// /tmp; ODM steps also get the model cache.
+type dagSteps struct {
+	cfg     *ODMPipelineConfig
+	volumes []apiv1.Volume
+}
+
+func (d dagSteps) template(name string, container apiv1.Container, mounts []apiv1.VolumeMount) wfv1.Template {
+	container.Name = "main"
+	container.VolumeMounts = mounts
+	return wfv1.Template{
+		Name:          name,
+		RetryStrategy: toRetryStrategy(d.cfg.RuntimeGuardrails.Retry),
+		Container:     &container,
+		Volumes:       d.volumes,
+	}
+}
+
+// rclone wraps one of the standard download/upload stage containers.
+func (d dagSteps) rclone(name string, container apiv1.Container) wfv1.Template {
+	return d.template(name, container, []apiv1.VolumeMount{
+		{Name: "workspace", MountPath: "/workspace"},
+		{Name: "tmp", MountPath: "/tmp"},
+	})
+}
+
+// odm runs script with bash in the ODM image.
+func (d dagSteps) odm(name, script string, resources ContainerResources) wfv1.Template {
+	return d.template(name, apiv1.Container{
+		Image:           d.cfg.ODMImage,
+		Command:         []string{"/bin/bash", "-c"},
+		Args:            []string{script},
+		Env:             odmProcessEnvVars(),
+		Resources:       containerRequirements(resources),
+		SecurityContext: workflowContainerSecurityContext(),
+	}, []apiv1.VolumeMount{
+		{Name: "workspace", MountPath: "/workspace"},
+		{Name: "tmp", MountPath: "/tmp"},
+		{Name: "odm-model-cache", MountPath: odmModelCachePath},
+	})
+}
+
+// splitMergeTemplates returns the DAG entrypoint ("main") and its step
+// templates for a distributed split-merge. download and upload are the
+// standard stage containers; odmFlags are the task's flags including any
+// boundary, without the split options.
+func splitMergeTemplates(cfg *ODMPipelineConfig, odmFlags []string, download, upload apiv1.Container, volumes []apiv1.Volume) []wfv1.Template {
+	steps := dagSteps{cfg: cfg, volumes: volumes}
+
+	runFlags := append(append([]string{}, odmFlags...), splitFlags(cfg)...)
+	tiers := submodelTiers(cfg, odmFlags)
+
+	planResources := estimateProcessResourcesFromImageCount(0, nil, cfg.ProcessResources)
+	plan := steps.odm("plan", generateSplitPlanScript(runFlags, tiers), planResources)
+	plan.Outputs.Parameters = make([]wfv1.Parameter, len(tiers))
+	for i := range tiers {
+		plan.Outputs.Parameters[i] = wfv1.Parameter{
+			Name:      fmt.Sprintf("tier-%d", i),
+			ValueFrom: &wfv1.ValueFrom{Path: fmt.Sprintf("%s/tier-%d.json", splitPlanDir, i)},
+		}
+	}
+
+	mergeResources := estimateProcessResourcesFromImageCount(cfg.Split, odmFlags, cfg.ProcessResources)
+	templates := []wfv1.Template{
+		steps.rclone("download", download),
+		plan,
+		steps.odm("merge", generateSplitMergeScript(withMaxConcurrency(runFlags, mergeResources)), mergeResources),
+		steps.rclone("upload", upload),
+	}
+
+	tasks := []wfv1.DAGTask{
+		{Name: "download", Template: "download"},
+		{Name: "plan", Template: "plan", Dependencies: []string{"download"}},
+	}
+	var processTasks []string
+	baseSubmodelFlags := submodelODMFlags(odmFlags)
+	for i, tier := range tiers {
+		name := fmt.Sprintf("process-%d", i)
+		submodel := steps.odm(name, generateSubmodelScript(withMaxConcurrency(baseSubmodelFlags, tier.resources)), tier.resources)
+		submodel.Inputs.Parameters = []wfv1.Parameter{{Name: "submodel"}}
+		templates = append(templates, submodel)
+
+		tasks = append(tasks, wfv1.DAGTask{
+			Name:         name,
+			Template:     name,
+			Dependencies: []string{"plan"},
+			WithParam:    fmt.Sprintf("{{tasks.plan.outputs.parameters.tier-%d}}", i),
+			Arguments: wfv1.Arguments{Parameters: []wfv1.Parameter{
+				{Name: "submodel", Value: wfv1.AnyStringPtr("{{item}}")},
+			}},
+		})
+		processTasks = append(processTasks, name)
+	}
+	tasks = append(tasks,
+		wfv1.DAGTask{Name: "merge", Template: "merge", Dependencies: processTasks},
+	)
+	previous := "merge"
+	if !cfg.SkipPostProcessing {
+		templates = append(templates, steps.odm(PostProcessStage, generatePostProcessScript(), cfg.PostProcessResources))
+		tasks = append(tasks, wfv1.DAGTask{Name: PostProcessStage, Template: PostProcessStage, Dependencies: []string{previous}})
+		previous = PostProcessStage
+	}
+	if cfg.CreateAllZip {
+		templates = append(templates, steps.odm(AllZipStage, generateAllZipScript(), planResources))
+		tasks = append(tasks, wfv1.DAGTask{Name: AllZipStage, Template: AllZipStage, Dependencies: []string{previous}})
+		previous = AllZipStage
+	}
+	tasks = append(tasks, wfv1.DAGTask{Name: "upload", Template: "upload", Dependencies: []string{previous}})
+
+	main := wfv1.Template{
+		Name: "main",
+		DAG:  &wfv1.DAGTemplate{Tasks: tasks},
+	}
+	if limit := config.SCALEODM_WORKFLOW_SPLITMERGE_MAX_PARALLEL_SUBMODELS; limit > 0 {
+		parallelism := int64(limit)
+		main.Parallelism = &parallelism
+	}
+	return append([]wfv1.Template{main}, templates...)
+}
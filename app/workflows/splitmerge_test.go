@@ -0,0 +1,152 @@
+package workflows
+
+import (
+	"testing"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func splitMergeTestConfig(accessMode string) *ODMPipelineConfig {
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/images/", "s3://bucket/output/", []string{"--dsm", "--crop=0"})
+	cfg.Workspace.Mode = "pvc"
+	cfg.Workspace.AccessMode = accessMode
+	cfg.ImageCount = 2000
+	cfg.Split = 400
+	cfg.SplitOverlap = 120
+	return cfg
+}
+
+func TestParseSplitFlags(t *testing.T) {
+	rest, split, overlap, err := ParseSplitFlags([]string{"--dsm", "--split=400", "--split-overlap=75.5"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--dsm"}, rest)
+	assert.Equal(t, 400, split)
+	assert.Equal(t, 75.5, overlap)
+
+	rest, split, _, err = ParseSplitFlags([]string{"--dsm"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--dsm"}, rest)
+	assert.Zero(t, split)
+
+	for _, flags := range [][]string{
+		{"--split=1"},
+		{"--split=many"},
+		{"--split=400", "--split-overlap=-1"},
+		{"--split-overlap=100"},
+	} {
+		_, _, _, err := ParseSplitFlags(flags)
+		assert.Error(t, err, "%v", flags)
+	}
+}
+
+func TestSubmodelODMFlags(t *testing.T) {
+	flags := submodelODMFlags([]string{"--dsm", "--crop=0", "--pc-ept", "--cog", "--max-concurrency=32", "--skip-report", "--rerun-from=dataset"})
+
+	assert.Equal(t, []string{"--dsm", "--crop=0.015625", "--skip-report", "--orthophoto-cutline", "--dem-euclidean-map", "--skip-3dmodel"}, flags)
+}
+
+func TestSubmodelTiers_AscendingAndCappedByImageCount(t *testing.T) {
+	cfg := splitMergeTestConfig("ReadWriteMany")
+	tiers := submodelTiers(cfg, cfg.ODMFlags)
+
+	var caps []int
+	for _, tier := range tiers {
+		caps = append(caps, tier.maxImages)
+	}
+	assert.Equal(t, []int{200, 400, 600, 800, 2000}, caps)
+	assert.NotEqual(t, tiers[0].resources, tiers[len(tiers)-1].resources, "larger tiers get larger pods")
+
+	cfg.ImageCount = 500
+	tiers = submodelTiers(cfg, cfg.ODMFlags)
+	assert.Equal(t, 500, tiers[len(tiers)-1].maxImages)
+	assert.Len(t, tiers, 3)
+}
+
+func TestBuildODMWorkflow_DistributedSplitMerge(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+	cfg := splitMergeTestConfig("ReadWriteMany")
+	wf := client.buildODMWorkflow(cfg)
+
+	templates := map[string]wfv1.Template{}
+	for _, tmpl := range wf.Spec.Templates {
+		templates[tmpl.Name] = tmpl
+	}
+	main := templates["main"]
+	require.NotNil(t, main.DAG)
+	assert.Nil(t, main.ContainerSet)
+
+	tasks := map[string]wfv1.DAGTask{}
+	for _, task := range main.DAG.Tasks {
+		tasks[task.Name] = task
+	}
+	assert.Equal(t, []string{"download"}, tasks["plan"].Dependencies)
+	assert.Equal(t, []string{"merge"}, tasks[PostProcessStage].Dependencies)
+	assert.Equal(t, []string{PostProcessStage}, tasks["upload"].Dependencies)
+	assert.Len(t, tasks["merge"].Dependencies, 5)
+
+	process := tasks["process-1"]
+	assert.Equal(t, []string{"plan"}, process.Dependencies)
+	assert.Equal(t, "{{tasks.plan.outputs.parameters.tier-1}}", process.WithParam)
+	require.Len(t, process.Arguments.Parameters, 1)
+	assert.Equal(t, "{{item}}", process.Arguments.Parameters[0].Value.String())
+
+	plan := templates["plan"].Container.Args[0]
+	assert.Contains(t, plan, "--split=400 --split-overlap=120")
+	assert.Contains(t, plan, "--end-with dataset")
+	assert.Contains(t, plan, "TIER_MAX_IMAGES = [200, 400, 600, 800, 2000]")
+	require.Len(t, templates["plan"].Outputs.Parameters, 5)
+	assert.Equal(t, splitPlanDir+"/tier-4.json", templates["plan"].Outputs.Parameters[4].ValueFrom.Path)
+
+	submodel := templates["process-1"].Container.Args[0]
+	assert.Contains(t, submodel, "--project-path /workspace/$JOB_ID/submodels $SUBMODEL")
+	assert.Contains(t, submodel, "--crop=0.015625")
+	assert.Contains(t, submodel, "--max-concurrency=")
+	assert.NotContains(t, submodel, "--split")
+	assert.Equal(t,
+		containerRequirements(estimateProcessResourcesFromImageCount(400, cfg.ODMFlags, cfg.ProcessResources)),
+		templates["process-1"].Container.Resources)
+
+	merge := templates["merge"].Container.Args[0]
+	assert.Contains(t, merge, "split_done.txt")
+	assert.Contains(t, merge, "--split=400")
+
+	for _, name := range []string{"download", "plan", "process-0", "merge", "upload"} {
+		assert.NotNil(t, templates[name].RetryStrategy, name)
+		assert.NotEmpty(t, templates[name].Volumes, name)
+	}
+	assert.Contains(t, templates, "cleanup")
+	assert.Equal(t, "cleanup", wf.Spec.OnExit)
+}
+
+func TestBuildODMWorkflow_SplitMergeWithoutSharedWorkspaceRunsInOnePod(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+	cfg := splitMergeTestConfig("ReadWriteOnce")
+	wf := client.buildODMWorkflow(cfg)
+
+	require.Len(t, wf.Spec.Templates, 2)
+	require.NotNil(t, wf.Spec.Templates[0].ContainerSet)
+	var process string
+	for _, container := range wf.Spec.Templates[0].ContainerSet.Containers {
+		if container.Name == "process" {
+			process = container.Args[0]
+		}
+	}
+	assert.Contains(t, process, "--dsm --crop=0 --split=400 --split-overlap=120")
+
+	cfg = splitMergeTestConfig("ReadWriteMany")
+	cfg.ImageCount = 300
+	wf = client.buildODMWorkflow(cfg)
+	assert.NotNil(t, wf.Spec.Templates[0].ContainerSet, "a dataset smaller than one submodel is not split")
+}
+
+func TestEstimateWorkspaceGiB_SplitMergeAddsSubmodelRoom(t *testing.T) {
+	cfg := splitMergeTestConfig("ReadWriteMany")
+	cfg.ImageTotalBytes = 20 << 30
+	split := EstimateWorkspaceGiB(cfg)
+
+	cfg.Split = 0
+	standard := EstimateWorkspaceGiB(cfg)
+	assert.Greater(t, split, standard)
+}
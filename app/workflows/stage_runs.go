@@ -0,0 +1,137 @@
+package workflows
+
+import (
+	"sort"
+	"time"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// CapacityTypeLabel is the node label Karpenter pins capacity with, and
+// the workflow's node selector sets (see buildNodeScheduling).
+const CapacityTypeLabel = "karpenter.sh/capacity-type"
+
+// StageRun is one run of a pipeline stage: a container of a single-pod
+// pipeline, or a pod of a DAG pipeline. A retried stage has a run per
+// attempt, and a fanned-out one a run per pod.
+type StageRun struct {
+	// NodeID is the Argo node's ID, unique within the workflow.
+	NodeID string
+	// Stage is the container name of a single-pod pipeline, or the template
+	// of a DAG pipeline's pod (e.g. "process-0" for a split-merge tier).
+	Stage        string
+	Phase        string
+	StartedAt    time.Time
+	FinishedAt   time.Time
+	HostNode     string
+	CapacityType string
+	// CPURequestMillis and MemoryRequestBytes are the container's requests,
+	// 0 when unset.
+	CPURequestMillis   int64
+	MemoryRequestBytes int64
+}
+
+// Duration is how long the run took, 0 while it has not finished.
+func (r StageRun) Duration() time.Duration {
+	if r.StartedAt.IsZero() || r.FinishedAt.IsZero() {
+		return 0
+	}
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// StageRuns lists the runs of a workflow's stages that started, by start
+// time. A container-set pod is reported by its containers; the onExit
+// cleanup pod is reported as stage "cleanup". The host node of a container
+// is its pod's, and the capacity type is the node selector's, as Argo's
+// node status records neither.
+func StageRuns(wf *wfv1.Workflow) []StageRun {
+	templates := map[string]*wfv1.Template{}
+	for i := range wf.Spec.Templates {
+		templates[wf.Spec.Templates[i].Name] = &wf.Spec.Templates[i]
+	}
+	parents := map[string]string{}
+	for id, node := range wf.Status.Nodes {
+		for _, child := range node.Children {
+			parents[child] = id
+		}
+	}
+
+	var runs []StageRun
+	for id, node := range wf.Status.Nodes {
+		if node.StartedAt.IsZero() {
+			continue
+		}
+		var stage string
+		var tmpl *wfv1.Template
+		var container *apiv1.Container
+		hostNode := node.HostNodeName
+		switch node.Type {
+		case wfv1.NodeTypePod:
+			tmpl = templates[node.TemplateName]
+			if tmpl != nil && tmpl.ContainerSet != nil {
+				continue
+			}
+			stage = node.TemplateName
+			if tmpl != nil {
+				container = tmpl.Container
+				if tmpl.Script != nil {
+					container = &tmpl.Script.Container
+				}
+			}
+		case wfv1.NodeTypeContainer:
+			stage = node.DisplayName
+			pod := wf.Status.Nodes[parents[id]]
+			if hostNode == "" {
+				hostNode = pod.HostNodeName
+			}
+			tmpl = templates[pod.TemplateName]
+			if tmpl != nil && tmpl.ContainerSet != nil {
+				for i := range tmpl.ContainerSet.Containers {
+					if tmpl.ContainerSet.Containers[i].Name == stage {
+						container = &tmpl.ContainerSet.Containers[i].Container
+					}
+				}
+			}
+		default:
+			continue
+		}
+
+		run := StageRun{
+			NodeID:       id,
+			Stage:        stage,
+			Phase:        string(node.Phase),
+			StartedAt:    node.StartedAt.UTC(),
+			HostNode:     hostNode,
+			CapacityType: capacityType(wf, tmpl),
+		}
+		if !node.FinishedAt.IsZero() {
+			run.FinishedAt = node.FinishedAt.UTC()
+		}
+		if container != nil {
+			if cpu, ok := container.Resources.Requests[apiv1.ResourceCPU]; ok {
+				run.CPURequestMillis = cpu.MilliValue()
+			}
+			if memory, ok := container.Resources.Requests[apiv1.ResourceMemory]; ok {
+				run.MemoryRequestBytes = memory.Value()
+			}
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].StartedAt.Equal(runs[j].StartedAt) {
+			return runs[i].StartedAt.Before(runs[j].StartedAt)
+		}
+		return runs[i].NodeID < runs[j].NodeID
+	})
+	return runs
+}
+
+func capacityType(wf *wfv1.Workflow, tmpl *wfv1.Template) string {
+	if tmpl != nil {
+		if value, ok := tmpl.NodeSelector[CapacityTypeLabel]; ok {
+			return value
+		}
+	}
+	return wf.Spec.NodeSelector[CapacityTypeLabel]
+}
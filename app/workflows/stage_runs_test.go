@@ -0,0 +1,75 @@
+package workflows
+
+import (
+	"testing"
+	"time"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func nodeTime(minute int) metav1.Time {
+	return metav1.NewTime(time.Date(2026, 10, 16, 9, minute, 0, 0, time.UTC))
+}
+
+func TestStageRuns_SinglePodPipeline(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/images/", "s3://bucket/output/", nil)
+	cfg.CapacityType = CapacityTypeOnDemand
+	cfg.DownloadResources.Requests = ResourceSpec{CPU: "500m", Memory: "1Gi"}
+	cfg.ProcessResources.Requests = ResourceSpec{CPU: "4", Memory: "16Gi"}
+	wf := client.buildODMWorkflow(cfg)
+	wf.Status.Nodes = wfv1.Nodes{
+		"wf":            {DisplayName: "odm-pipeline-abcde", Type: wfv1.NodeTypeRetry, Phase: wfv1.NodeSucceeded, Children: []string{"wf-0"}},
+		"wf-0":          {DisplayName: "odm-pipeline-abcde(0)", TemplateName: "main", Type: wfv1.NodeTypePod, Phase: wfv1.NodeSucceeded, HostNodeName: "ip-10-0-1-5", StartedAt: nodeTime(0), FinishedAt: nodeTime(40), Children: []string{"wf-0-download", "wf-0-process", "wf-0-upload"}},
+		"wf-0-download": {DisplayName: "download", Type: wfv1.NodeTypeContainer, Phase: wfv1.NodeSucceeded, StartedAt: nodeTime(1), FinishedAt: nodeTime(3)},
+		"wf-0-process":  {DisplayName: "process", Type: wfv1.NodeTypeContainer, Phase: wfv1.NodeSucceeded, StartedAt: nodeTime(3), FinishedAt: nodeTime(35)},
+		"wf-0-upload":   {DisplayName: "upload", Type: wfv1.NodeTypeContainer, Phase: wfv1.NodePending},
+		"cleanup":       {DisplayName: "odm-pipeline-abcde.onExit", TemplateName: "cleanup", Type: wfv1.NodeTypePod, Phase: wfv1.NodeSucceeded, HostNodeName: "ip-10-0-1-6", StartedAt: nodeTime(41), FinishedAt: nodeTime(42)},
+	}
+
+	runs := StageRuns(wf)
+	require.Len(t, runs, 3, "the pod is reported by its containers, and a container that never started is left out")
+	assert.Equal(t, StageRun{
+		NodeID:             "wf-0-download",
+		Stage:              "download",
+		Phase:              "Succeeded",
+		StartedAt:          nodeTime(1).Time,
+		FinishedAt:         nodeTime(3).Time,
+		HostNode:           "ip-10-0-1-5",
+		CapacityType:       CapacityTypeOnDemand,
+		CPURequestMillis:   500,
+		MemoryRequestBytes: 1 << 30,
+	}, runs[0])
+	assert.Equal(t, "process", runs[1].Stage)
+	assert.Equal(t, 32*time.Minute, runs[1].Duration())
+	assert.Equal(t, int64(4000), runs[1].CPURequestMillis)
+	assert.Equal(t, int64(16<<30), runs[1].MemoryRequestBytes)
+	assert.Equal(t, "cleanup", runs[2].Stage)
+	assert.Equal(t, "ip-10-0-1-6", runs[2].HostNode)
+}
+
+func TestStageRuns_DAGPipeline(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+	wf := client.buildODMWorkflow(splitMergeTestConfig("ReadWriteMany"))
+	wf.Status.Nodes = wfv1.Nodes{
+		"wf":          {DisplayName: "odm-pipeline-abcde", Type: wfv1.NodeTypeDAG, Phase: wfv1.NodeRunning, StartedAt: nodeTime(0)},
+		"download":    {DisplayName: "download", TemplateName: "download", Type: wfv1.NodeTypeRetry, Phase: wfv1.NodeSucceeded, StartedAt: nodeTime(0), Children: []string{"download-0", "download-1"}},
+		"download-0":  {DisplayName: "download(0)", TemplateName: "download", Type: wfv1.NodeTypePod, Phase: wfv1.NodeFailed, HostNodeName: "node-a", StartedAt: nodeTime(0), FinishedAt: nodeTime(2)},
+		"download-1":  {DisplayName: "download(1)", TemplateName: "download", Type: wfv1.NodeTypePod, Phase: wfv1.NodeSucceeded, HostNodeName: "node-b", StartedAt: nodeTime(2), FinishedAt: nodeTime(5)},
+		"process-0-0": {DisplayName: "process-0(0:submodel_0000)", TemplateName: "process-0", Type: wfv1.NodeTypePod, Phase: wfv1.NodeSucceeded, HostNodeName: "node-c", StartedAt: nodeTime(6), FinishedAt: nodeTime(30)},
+		"process-0-1": {DisplayName: "process-0(1:submodel_0001)", TemplateName: "process-0", Type: wfv1.NodeTypePod, Phase: wfv1.NodeRunning, HostNodeName: "node-d", StartedAt: nodeTime(6)},
+	}
+
+	runs := StageRuns(wf)
+	require.Len(t, runs, 4, "each attempt and each fanned-out pod is a run; DAG and retry nodes are not")
+	assert.Equal(t, []string{"download", "download", "process-0", "process-0"}, []string{runs[0].Stage, runs[1].Stage, runs[2].Stage, runs[3].Stage})
+	assert.Equal(t, "Failed", runs[0].Phase)
+	assert.Equal(t, CapacityTypeSpot, runs[2].CapacityType)
+	assert.Positive(t, runs[2].CPURequestMillis)
+	assert.Equal(t, "process-0-0", runs[2].NodeID)
+	assert.Zero(t, runs[3].Duration(), "a run still going has no duration")
+	assert.True(t, runs[3].FinishedAt.IsZero())
+}
@@ -0,0 +1,125 @@
+package workflows
+
+import (
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+)
+
+// Stage phases reported by WorkflowStages.
+const (
+	StagePending   = "pending"
+	StageRunning   = "running"
+	StageSucceeded = "succeeded"
+	StageFailed    = "failed"
+	StageSkipped   = "skipped"
+)
+
+// WorkflowStage is the progress of one task of a DAG pipeline's main
+// template. A task fanned out with withParam (a split-merge tier, a
+// city-scale ring) counts each of its pods in Total; a retried step counts
+// once.
+type WorkflowStage struct {
+	Name      string
+	Phase     string
+	Total     int
+	Completed int
+	Failed    int
+}
+
+// WorkflowStages reports the stages of a DAG pipeline (distributed
+// split-merge, city-scale) in the order the main DAG declares them. It
+// returns nil for the single-pod pipelines, whose progress is the workflow
+// phase.
+func WorkflowStages(wf *wfv1.Workflow) []WorkflowStage {
+	var dag *wfv1.DAGTemplate
+	for i := range wf.Spec.Templates {
+		if wf.Spec.Templates[i].Name == wf.Spec.Entrypoint {
+			dag = wf.Spec.Templates[i].DAG
+		}
+	}
+	if dag == nil {
+		return nil
+	}
+
+	stages := make([]WorkflowStage, len(dag.Tasks))
+	index := map[string]int{}
+	for i, task := range dag.Tasks {
+		stages[i] = WorkflowStage{Name: task.Name}
+		index[task.Name] = i
+	}
+
+	// A retried step is a Retry node with one Pod child per attempt; count
+	// the Retry node only.
+	attempts := map[string]bool{}
+	for _, node := range wf.Status.Nodes {
+		if node.Type == wfv1.NodeTypeRetry {
+			for _, child := range node.Children {
+				attempts[child] = true
+			}
+		}
+	}
+
+	phases := make([][]wfv1.NodePhase, len(stages))
+	for id, node := range wf.Status.Nodes {
+		switch node.Type {
+		case wfv1.NodeTypeRetry, wfv1.NodeTypePod, wfv1.NodeTypeSkipped:
+		default:
+			continue
+		}
+		if attempts[id] {
+			continue
+		}
+		// Expanded tasks are named "<task>(<index>:<item>)".
+		name, _, _ := strings.Cut(node.DisplayName, "(")
+		i, ok := index[name]
+		if !ok {
+			continue
+		}
+		phases[i] = append(phases[i], node.Phase)
+	}
+
+	for i := range stages {
+		stages[i].Phase = stagePhase(phases[i])
+		for _, phase := range phases[i] {
+			switch phase {
+			case wfv1.NodeSkipped, wfv1.NodeOmitted:
+				continue
+			case wfv1.NodeSucceeded:
+				stages[i].Completed++
+			case wfv1.NodeFailed, wfv1.NodeError:
+				stages[i].Failed++
+			}
+			stages[i].Total++
+		}
+	}
+	return stages
+}
+
+func stagePhase(phases []wfv1.NodePhase) string {
+	if len(phases) == 0 {
+		return StagePending
+	}
+	var running, failed, succeeded bool
+	for _, phase := range phases {
+		switch phase {
+		case wfv1.NodeSucceeded:
+			succeeded = true
+		case wfv1.NodeFailed, wfv1.NodeError:
+			failed = true
+		case wfv1.NodeSkipped, wfv1.NodeOmitted:
+		default:
+			running = true
+		}
+	}
+	switch {
+	case running:
+		return StageRunning
+	case failed:
+		return StageFailed
+	case succeeded:
+		return StageSucceeded
+	default:
+		return StageSkipped
+	}
+}
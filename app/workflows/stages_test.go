@@ -0,0 +1,45 @@
+package workflows
+
+import (
+	"testing"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkflowStages_CityScale(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+	wf := client.buildODMWorkflow(cityScaleTestConfig())
+	wf.Status.Nodes = wfv1.Nodes{
+		"wf":         {DisplayName: "odm-pipeline-abcde", Type: wfv1.NodeTypeDAG, Phase: wfv1.NodeRunning},
+		"download":   {DisplayName: "download", Type: wfv1.NodeTypeRetry, Phase: wfv1.NodeSucceeded, Children: []string{"download-0", "download-1"}},
+		"download-0": {DisplayName: "download(0)", Type: wfv1.NodeTypePod, Phase: wfv1.NodeFailed},
+		"download-1": {DisplayName: "download(1)", Type: wfv1.NodeTypePod, Phase: wfv1.NodeSucceeded},
+		"plan":       {DisplayName: "plan", Type: wfv1.NodeTypePod, Phase: wfv1.NodeSucceeded},
+		"central":    {DisplayName: "central", Type: wfv1.NodeTypePod, Phase: wfv1.NodeSucceeded},
+		"ring-1":     {DisplayName: "ring-1", Type: wfv1.NodeTypeTaskGroup, Phase: wfv1.NodeRunning},
+		"ring-1-0":   {DisplayName: `ring-1(0:{"anchor":"a","task":"b"})`, Type: wfv1.NodeTypePod, Phase: wfv1.NodeSucceeded},
+		"ring-1-1":   {DisplayName: `ring-1(1:{"anchor":"a","task":"c"})`, Type: wfv1.NodeTypePod, Phase: wfv1.NodeRunning},
+		"ring-2":     {DisplayName: "ring-2", Type: wfv1.NodeTypeSkipped, Phase: wfv1.NodeSkipped},
+		"cleanup":    {DisplayName: "odm-pipeline-abcde.onExit", Type: wfv1.NodeTypePod, Phase: wfv1.NodePending},
+	}
+
+	stages := WorkflowStages(wf)
+	byName := map[string]WorkflowStage{}
+	for _, stage := range stages {
+		byName[stage.Name] = stage
+	}
+
+	assert.Equal(t, "download", stages[0].Name)
+	assert.Equal(t, WorkflowStage{Name: "download", Phase: StageSucceeded, Total: 1, Completed: 1}, byName["download"])
+	assert.Equal(t, WorkflowStage{Name: "ring-1", Phase: StageRunning, Total: 2, Completed: 1}, byName["ring-1"])
+	assert.Equal(t, WorkflowStage{Name: "ring-2", Phase: StageSkipped}, byName["ring-2"])
+	assert.Equal(t, WorkflowStage{Name: "merge", Phase: StagePending}, byName["merge"])
+}
+
+func TestWorkflowStages_NilForSinglePodPipeline(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+	wf := client.buildODMWorkflow(NewDefaultODMConfig("test-project", "s3://bucket/images/", "s3://bucket/output/", nil))
+
+	assert.Nil(t, WorkflowStages(wf))
+}
@@ -17,6 +17,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
 )
 
 // ResourceSpec defines CPU, memory, and ephemeral storage values.
@@ -60,6 +61,25 @@ type WorkspaceConfig struct {
 	AccessMode   string
 }
 
+// DefaultWorkspaceConfig returns the configured workspace for new tasks.
+func DefaultWorkspaceConfig() WorkspaceConfig {
+	return WorkspaceConfig{
+		Mode:         config.SCALEODM_WORKFLOW_WORKSPACE_MODE,
+		Size:         config.SCALEODM_WORKFLOW_WORKSPACE_SIZE,
+		StorageClass: config.SCALEODM_WORKFLOW_WORKSPACE_STORAGE_CLASS,
+		AccessMode:   config.SCALEODM_WORKFLOW_WORKSPACE_ACCESS_MODE,
+	}
+}
+
+// workflowNamePrefix is the GenerateName every ODM pipeline workflow uses.
+const workflowNamePrefix = "odm-pipeline-"
+
+// NewWorkflowName returns a workflow name in the same shape Argo generates,
+// for tasks that need their UUID before the workflow is submitted.
+func NewWorkflowName() string {
+	return workflowNamePrefix + utilrand.String(5)
+}
+
 // ODMPipelineConfig holds configuration for ODM pipeline workflow
 type ODMPipelineConfig struct {
 	ODMProjectID   string
@@ -71,6 +91,12 @@ type ODMPipelineConfig struct {
 	ServiceAccount string
 	RcloneImage    string
 	ODMImage       string
+	// Tenant owns the task; stamped as the TenantLabel workflow label.
+	// Empty when auth is disabled.
+	Tenant string
+	// WorkflowName pins the workflow name, so a queued task keeps the UUID
+	// it was given before dispatch. Empty lets Argo generate one.
+	WorkflowName string
 
 	// ProcessingMode selects the pipeline shape; see processing_mode.go.
 	// Empty string is treated as ProcessingModeStandard.
@@ -90,12 +116,54 @@ type ODMPipelineConfig struct {
 	// Boundary is written to the workspace before ODM starts.
 	Boundary BoundarySource
 
-	RuntimeGuardrails WorkflowRuntimeGuardrails
-	Workspace         WorkspaceConfig
-	DownloadResources ContainerResources
-	ProcessResources  ContainerResources
-	UploadResources   ContainerResources
-	CleanupResources  ContainerResources
+	// Sidecars are the ODM sidecar files (s3.ODMSidecarFiles) found beside
+	// the imagery under ReadS3Path. GCPS3Path and GeoS3Path, when set, are
+	// fetched as gcp_list.txt and geo.txt, replacing any found there.
+	Sidecars  []string
+	GCPS3Path string
+	GeoS3Path string
+
+	// Split is ODM's --split: the target images per submodel, 0 to process
+	// the dataset as one model. SplitOverlap is --split-overlap in meters,
+	// 0 for ODM's default. See splitmerge.go.
+	Split        int
+	SplitOverlap float64
+
+	// City-scale inputs; see cityscale.go. LargestTaskImages sizes the task
+	// pods. ReferenceDEMS3Path, when set, is the DEM the merged products are
+	// vertically aligned to.
+	LargestTaskImages  int
+	ReferenceDEMS3Path string
+
+	// CreateAllZip adds the all-zip stage, which writes all.zip to
+	// writeS3Path; see archive.go.
+	CreateAllZip bool
+	// SkipPostProcessing drops the postprocess stage, so the task has no
+	// point cloud tiles; see postprocess.go.
+	SkipPostProcessing bool
+
+	// Checkpoint adds the checkpoint stage, which saves the ODM project after
+	// each of CheckpointStages so a retried attempt resumes there.
+	// ResumeCheckpoint has the first attempt resume too, for a restarted
+	// task. See checkpoint.go.
+	Checkpoint       bool
+	CheckpointStages []string
+	ResumeCheckpoint bool
+
+	// KeepIntermediates has the upload stage save the ODM project for a
+	// later rerun, and RerunFrom restores it and runs ODM from that stage.
+	// See rerun.go.
+	KeepIntermediates bool
+	RerunFrom         string
+
+	RuntimeGuardrails    WorkflowRuntimeGuardrails
+	Workspace            WorkspaceConfig
+	DownloadResources    ContainerResources
+	ProcessResources     ContainerResources
+	ThermalResources     ContainerResources
+	PostProcessResources ContainerResources
+	UploadResources      ContainerResources
+	CleanupResources     ContainerResources
 
 	ImageCount      int
 	ImageTotalBytes int64
@@ -126,18 +194,21 @@ var odmMemoryEstimationPoints = []interpolationPoint{
 func NewDefaultODMConfig(odmProjectID, readS3Path, writeS3Path string, odmFlags []string) *ODMPipelineConfig {
 	podGCDelaySeconds := int64(config.SCALEODM_WORKFLOW_POD_GC_DELETE_DELAY_SECONDS)
 	return &ODMPipelineConfig{
-		ODMProjectID:   odmProjectID,
-		ReadS3Path:     readS3Path,
-		WriteS3Path:    writeS3Path,
-		ODMFlags:       odmFlags,
-		ProcessingMode: ProcessingModeStandard,
-		CapacityType:   config.SCALEODM_WORKFLOW_CAPACITY_TYPE,
-		S3ScanDepth:    DefaultS3ScanDepth,
-		S3Region:       "us-east-1",
-		S3Endpoint:     "",
-		ServiceAccount: "argo-odm",
-		RcloneImage:    "docker.io/rclone/rclone:1.69",
-		ODMImage:       config.SCALEODM_ODM_IMAGE,
+		ODMProjectID:     odmProjectID,
+		ReadS3Path:       readS3Path,
+		WriteS3Path:      writeS3Path,
+		ODMFlags:         odmFlags,
+		ProcessingMode:   ProcessingModeStandard,
+		CapacityType:     config.SCALEODM_WORKFLOW_CAPACITY_TYPE,
+		S3ScanDepth:      DefaultS3ScanDepth,
+		S3Region:         "us-east-1",
+		S3Endpoint:       "",
+		ServiceAccount:   "argo-odm",
+		RcloneImage:      "docker.io/rclone/rclone:1.69",
+		ODMImage:         config.SCALEODM_ODM_IMAGE,
+		CreateAllZip:     config.SCALEODM_WORKFLOW_CREATE_ALL_ZIP,
+		Checkpoint:       config.SCALEODM_CHECKPOINT_ENABLED,
+		CheckpointStages: DefaultCheckpointStages(),
 		RuntimeGuardrails: WorkflowRuntimeGuardrails{
 			ActiveDeadlineSeconds:  int64(config.SCALEODM_WORKFLOW_ACTIVE_DEADLINE_SECONDS),
 			TTLSuccessSeconds:      int32(config.SCALEODM_WORKFLOW_TTL_SUCCESS_SECONDS),
@@ -152,12 +223,7 @@ func NewDefaultODMConfig(odmProjectID, readS3Path, writeS3Path string, odmFlags
 				Policy:             config.SCALEODM_WORKFLOW_RETRY_POLICY,
 			},
 		},
-		Workspace: WorkspaceConfig{
-			Mode:         config.SCALEODM_WORKFLOW_WORKSPACE_MODE,
-			Size:         config.SCALEODM_WORKFLOW_WORKSPACE_SIZE,
-			StorageClass: config.SCALEODM_WORKFLOW_WORKSPACE_STORAGE_CLASS,
-			AccessMode:   config.SCALEODM_WORKFLOW_WORKSPACE_ACCESS_MODE,
-		},
+		Workspace: DefaultWorkspaceConfig(),
 		DownloadResources: ContainerResources{
 			Requests: ResourceSpec{
 				CPU:              config.SCALEODM_WORKFLOW_RESOURCES_DOWNLOAD_REQUEST_CPU,
@@ -182,6 +248,30 @@ func NewDefaultODMConfig(odmProjectID, readS3Path, writeS3Path string, odmFlags
 				EphemeralStorage: config.SCALEODM_WORKFLOW_RESOURCES_PROCESS_LIMIT_EPHEMERAL_STORAGE,
 			},
 		},
+		ThermalResources: ContainerResources{
+			Requests: ResourceSpec{
+				CPU:              config.SCALEODM_WORKFLOW_RESOURCES_THERMAL_REQUEST_CPU,
+				Memory:           config.SCALEODM_WORKFLOW_RESOURCES_THERMAL_REQUEST_MEMORY,
+				EphemeralStorage: config.SCALEODM_WORKFLOW_RESOURCES_THERMAL_REQUEST_EPHEMERAL_STORAGE,
+			},
+			Limits: ResourceSpec{
+				CPU:              config.SCALEODM_WORKFLOW_RESOURCES_THERMAL_LIMIT_CPU,
+				Memory:           config.SCALEODM_WORKFLOW_RESOURCES_THERMAL_LIMIT_MEMORY,
+				EphemeralStorage: config.SCALEODM_WORKFLOW_RESOURCES_THERMAL_LIMIT_EPHEMERAL_STORAGE,
+			},
+		},
+		PostProcessResources: ContainerResources{
+			Requests: ResourceSpec{
+				CPU:              config.SCALEODM_WORKFLOW_RESOURCES_POSTPROCESS_REQUEST_CPU,
+				Memory:           config.SCALEODM_WORKFLOW_RESOURCES_POSTPROCESS_REQUEST_MEMORY,
+				EphemeralStorage: config.SCALEODM_WORKFLOW_RESOURCES_POSTPROCESS_REQUEST_EPHEMERAL_STORAGE,
+			},
+			Limits: ResourceSpec{
+				CPU:              config.SCALEODM_WORKFLOW_RESOURCES_POSTPROCESS_LIMIT_CPU,
+				Memory:           config.SCALEODM_WORKFLOW_RESOURCES_POSTPROCESS_LIMIT_MEMORY,
+				EphemeralStorage: config.SCALEODM_WORKFLOW_RESOURCES_POSTPROCESS_LIMIT_EPHEMERAL_STORAGE,
+			},
+		},
 		UploadResources: ContainerResources{
 			Requests: ResourceSpec{
 				CPU:              config.SCALEODM_WORKFLOW_RESOURCES_UPLOAD_REQUEST_CPU,
@@ -211,24 +301,11 @@ func NewDefaultODMConfig(odmProjectID, readS3Path, writeS3Path string, odmFlags
 
 // CreateODMWorkflow creates and submits an ODM processing workflow
 func (c *Client) CreateODMWorkflow(ctx context.Context, cfg *ODMPipelineConfig) (*wfv1.Workflow, error) {
-	if cfg.S3Endpoint != "" {
-		normalizedEndpoint, err := s3.NormalizeEndpoint(cfg.S3Endpoint)
-		if err != nil {
-			return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
-		}
-		cfg.S3Endpoint = normalizedEndpoint
-	}
-
-	if cfg.ImageCount > 0 {
-		cfg.ProcessResources = estimateProcessResourcesFromImageCount(cfg.ImageCount, cfg.ODMFlags, cfg.ProcessResources)
+	wf, err := c.RenderODMWorkflow(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	applyOnDemandUpgrade(cfg)
-	applyDynamicWorkspaceSize(cfg)
-	applyMaxConcurrencyFromCPULimit(cfg)
-
-	wf := c.buildODMWorkflow(cfg)
-
 	createStart := time.Now()
 	created, err := c.wfClientset.ArgoprojV1alpha1().Workflows(c.namespace).Create(
 		ctx,
@@ -244,19 +321,36 @@ func (c *Client) CreateODMWorkflow(ctx context.Context, cfg *ODMPipelineConfig)
 	return created, nil
 }
 
-// applyMaxConcurrencyFromCPULimit caps ODM workers to the pod limit unless already set.
-func applyMaxConcurrencyFromCPULimit(cfg *ODMPipelineConfig) {
-	for _, f := range cfg.ODMFlags {
-		if f == "--max-concurrency" || strings.HasPrefix(f, "--max-concurrency=") {
-			return
+// RenderODMWorkflow resolves cfg as CreateODMWorkflow does - process
+// resources from the image count, the on-demand upgrade, the workspace size
+// and ODM's concurrency are written back to cfg - and returns the workflow it
+// would submit, without submitting it.
+func (c *Client) RenderODMWorkflow(cfg *ODMPipelineConfig) (*wfv1.Workflow, error) {
+	if cfg.S3Endpoint != "" {
+		normalizedEndpoint, err := s3.NormalizeEndpoint(cfg.S3Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
 		}
+		cfg.S3Endpoint = normalizedEndpoint
 	}
 
-	cores := parseCPUCores(cfg.ProcessResources.Limits.CPU)
-	if cores < 1 {
-		return
+	if cfg.ImageCount > 0 {
+		cfg.ProcessResources = estimateProcessResourcesFromImageCount(cfg.ImageCount, cfg.ODMFlags, cfg.ProcessResources)
+	}
+
+	applyOnDemandUpgrade(cfg)
+	applyDynamicWorkspaceSize(cfg)
+	// DAG pipelines size each step's concurrency separately.
+	if !runsAsDAG(cfg) {
+		applyMaxConcurrencyFromCPULimit(cfg)
 	}
-	cfg.ODMFlags = append(cfg.ODMFlags, fmt.Sprintf("--max-concurrency=%d", cores))
+
+	return c.buildODMWorkflow(cfg), nil
+}
+
+// applyMaxConcurrencyFromCPULimit caps ODM workers to the pod limit unless already set.
+func applyMaxConcurrencyFromCPULimit(cfg *ODMPipelineConfig) {
+	cfg.ODMFlags = withMaxConcurrency(cfg.ODMFlags, cfg.ProcessResources)
 }
 
 // parseCPUCores converts a Kubernetes CPU quantity to whole cores.
@@ -292,15 +386,11 @@ func parseCPUCores(quantity string) int {
 
 // flagMemoryMultiplier adjusts RAM estimates for high/low-cost ODM modes.
 func flagMemoryMultiplier(odmFlags []string) float64 {
-	for _, f := range odmFlags {
-		if f == "--fast-orthophoto" {
-			return config.SCALEODM_PROCESS_FAST_ORTHO_MEMORY_MULTIPLIER
-		}
-	}
-	for _, f := range odmFlags {
-		if f == "--dsm" || f == "--dtm" {
-			return config.SCALEODM_PROCESS_DSM_DTM_MEMORY_MULTIPLIER
-		}
+	switch WorkloadProfile(odmFlags) {
+	case WorkloadProfileFastOrthophoto:
+		return config.SCALEODM_PROCESS_FAST_ORTHO_MEMORY_MULTIPLIER
+	case WorkloadProfileDSMDTM:
+		return config.SCALEODM_PROCESS_DSM_DTM_MEMORY_MULTIPLIER
 	}
 	return 1.0
 }
@@ -308,7 +398,8 @@ func flagMemoryMultiplier(odmFlags []string) float64 {
 func estimateProcessResourcesFromImageCount(imageCount int, odmFlags []string, fallback ContainerResources) ContainerResources {
 	// peakRAMGiB is the brief peak working set (RAM + swap), not the resident
 	// set. It sets the memory limit and the CPU/ephemeral sizing.
-	peakRAMGiB := clamp(estimateMemoryGiB(imageCount)*flagMemoryMultiplier(odmFlags), config.SCALEODM_PROCESS_MEMORY_MIN_GIB, config.SCALEODM_PROCESS_MEMORY_MAX_GIB)
+	// A learned curve, when the estimator has one, corrects the prior table.
+	peakRAMGiB := clamp(PriorPeakMemoryGiB(imageCount, odmFlags)*learnedMemoryFactor(imageCount, odmFlags), config.SCALEODM_PROCESS_MEMORY_MIN_GIB, config.SCALEODM_PROCESS_MEMORY_MAX_GIB)
 
 	// requestGiB is the real RAM to schedule; swap absorbs the peak. See
 	// SCALEODM_PROCESS_SWAP_RATIO.
@@ -434,7 +525,7 @@ func buildNodeScheduling(capacityType string) (map[string]string, []apiv1.Tolera
 	if !IsValidCapacityType(capacityType) {
 		capacityType = CapacityTypeSpot
 	}
-	nodeSelector["karpenter.sh/capacity-type"] = capacityType
+	nodeSelector[CapacityTypeLabel] = capacityType
 	if capacityType == CapacityTypeSpot {
 		tolerations = append(tolerations, apiv1.Toleration{
 			Key:      "spot",
@@ -544,6 +635,18 @@ func applyDynamicWorkspaceSize(cfg *ODMPipelineConfig) {
 	if !config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_ENABLED || !shouldUseWorkspacePVC(cfg.Workspace) {
 		return
 	}
+	if cfg.ProcessingMode == ProcessingModeMergeExisting {
+		if gib := estimateMergeWorkspaceGiB(cfg.ImageTotalBytes); gib > 0 {
+			cfg.Workspace.Size = fmt.Sprintf("%dGi", int64(math.Ceil(gib)))
+		}
+		return
+	}
+	if cfg.IsSplitMerge() {
+		if gib := estimatePipelineWorkspaceGiB(cfg); gib > 0 {
+			cfg.Workspace.Size = fmt.Sprintf("%dGi", int64(math.Ceil(gib)))
+		}
+		return
+	}
 	if estimatedSize, ok := estimateWorkspacePVCSize(cfg.ImageTotalBytes, cfg.ImageCount, cfg.ODMFlags); ok {
 		cfg.Workspace.Size = estimatedSize
 	}
@@ -558,28 +661,66 @@ func estimateWorkspacePVCSize(imageTotalBytes int64, imageCount int, odmFlags []
 }
 
 // flagWorkspaceProfile returns the bytes multiplier, GiB-per-image floor,
-// and min size for the ODM profile. Precedence matches flagMemoryMultiplier.
+// and min size for the ODM profile (see WorkloadProfile).
 func flagWorkspaceProfile(odmFlags []string) (multiplier, gibPerImage, minGiB float64) {
-	for _, f := range odmFlags {
-		if f == "--fast-orthophoto" {
-			return config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_FAST_ORTHO_MULTIPLIER,
-				config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_FAST_ORTHO_GIB_PER_IMAGE,
-				config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_FAST_ORTHO_MIN_GIB
-		}
-	}
-	for _, f := range odmFlags {
-		if f == "--dsm" || f == "--dtm" {
-			return config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_DSM_DTM_MULTIPLIER,
-				config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_DSM_DTM_GIB_PER_IMAGE,
-				config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_DSM_DTM_MIN_GIB
-		}
+	switch WorkloadProfile(odmFlags) {
+	case WorkloadProfileFastOrthophoto:
+		return config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_FAST_ORTHO_MULTIPLIER,
+			config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_FAST_ORTHO_GIB_PER_IMAGE,
+			config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_FAST_ORTHO_MIN_GIB
+	case WorkloadProfileDSMDTM:
+		return config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_DSM_DTM_MULTIPLIER,
+			config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_DSM_DTM_GIB_PER_IMAGE,
+			config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_DSM_DTM_MIN_GIB
 	}
 	return config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_STANDARD_MULTIPLIER,
 		config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_STANDARD_GIB_PER_IMAGE,
 		config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_STANDARD_MIN_GIB
 }
 
+// EstimateWorkspaceGiB returns the workspace a task is expected to need:
+// the dynamic estimate when it can be computed, otherwise the configured
+// static workspace size. Used for quota accounting.
+func EstimateWorkspaceGiB(cfg *ODMPipelineConfig) float64 {
+	gib := estimatePipelineWorkspaceGiB(cfg)
+	if cfg.ProcessingMode == ProcessingModeMergeExisting {
+		gib = estimateMergeWorkspaceGiB(cfg.ImageTotalBytes)
+	}
+	if gib > 0 {
+		return math.Ceil(gib)
+	}
+	size, err := resource.ParseQuantity(cfg.Workspace.Size)
+	if err != nil {
+		return 0
+	}
+	return math.Ceil(float64(size.Value()) / (1 << 30))
+}
+
+// estimatePipelineWorkspaceGiB is estimateWorkspaceGiB for a task, with room
+// for the submodels when it runs split-merge.
+func estimatePipelineWorkspaceGiB(cfg *ODMPipelineConfig) float64 {
+	gib := estimateWorkspaceGiB(cfg.ImageTotalBytes, cfg.ImageCount, cfg.ODMFlags)
+	if gib > 0 && cfg.IsSplitMerge() {
+		gib = math.Min(gib*splitMergeWorkspaceMultiplier, config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_MAX_GIB)
+	}
+	return gib
+}
+
+// estimateWorkspaceGiB is PriorWorkspaceGiB corrected by the learned curve
+// of the flags' profile, if any.
 func estimateWorkspaceGiB(imageTotalBytes int64, imageCount int, odmFlags []string) float64 {
+	gib := PriorWorkspaceGiB(imageTotalBytes, imageCount, odmFlags)
+	if gib <= 0 {
+		return 0
+	}
+	_, _, minGiB := flagWorkspaceProfile(odmFlags)
+	return clamp(gib*learnedWorkspaceFactor(imageCount, odmFlags), minGiB, config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_MAX_GIB)
+}
+
+// PriorWorkspaceGiB is the workspace the static per-profile multipliers
+// predict for a task, before any learned correction; 0 when it cannot be
+// estimated.
+func PriorWorkspaceGiB(imageTotalBytes int64, imageCount int, odmFlags []string) float64 {
 	multiplier, gibPerImage, minGiB := flagWorkspaceProfile(odmFlags)
 	maxGiB := config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_MAX_GIB
 	if multiplier <= 0 || maxGiB <= 0 || maxGiB < minGiB {
@@ -852,6 +993,63 @@ func (c *Client) buildODMWorkflow(cfg *ODMPipelineConfig) *wfv1.Workflow {
 	// Generate unique job ID for this workflow instance
 	jobID := "{{workflow.name}}"
 
+	// merge-existing swaps the imagery download and ODM run for the merge
+	// stage; see splitmerge.go. thermal sorts the imagery as it downloads and
+	// converts it before ODM runs; see thermal.go. city-scale keeps each
+	// task's imagery apart and runs as a DAG; see cityscale.go. Upload and
+	// cleanup are shared.
+	boundaryScript := s3.GenerateBoundaryFetchScript(BoundaryFilePath(jobID), cfg.Boundary.S3Path, cfg.Boundary.GeoJSON)
+	sidecarScript := s3.GenerateSidecarFetchScript(SidecarFilePath(jobID, s3.GCPFileName), cfg.GCPS3Path) +
+		s3.GenerateSidecarFetchScript(SidecarFilePath(jobID, s3.GeoFileName), cfg.GeoS3Path)
+	var downloadScript string
+	switch cfg.ProcessingMode {
+	case ProcessingModeMergeExisting:
+		downloadScript = s3.GenerateMergeInputsDownloadScript(jobID, cfg.ReadS3Path, cfg.WriteS3Path, cfg.ExcludePaths, cfg.S3ScanDepth)
+	case ProcessingModeThermal:
+		downloadScript = s3.GenerateThermalDownloadScript(jobID, cfg.ReadS3Path, cfg.ExcludePaths, cfg.S3ScanDepth) + boundaryScript + sidecarScript
+	case ProcessingModeCityScale:
+		downloadScript = s3.GenerateCityScaleDownloadScript(jobID, cfg.ReadS3Path, cfg.ExcludePaths, cfg.S3ScanDepth) + boundaryScript +
+			s3.GenerateReferenceDEMFetchScript("/workspace/"+jobID+"/"+ReferenceDEMFileName, cfg.ReferenceDEMS3Path)
+	default:
+		downloadScript = s3.GenerateDownloadScript(jobID, cfg.ReadS3Path, cfg.ExcludePaths, cfg.S3ScanDepth) + boundaryScript + sidecarScript
+	}
+
+	processFlags := cfg.ODMFlags
+	if cfg.ProcessingMode == ProcessingModeThermal {
+		processFlags = withThermalFlags(processFlags)
+	}
+	if cfg.Boundary.IsSet() {
+		processFlags = append(append([]string{}, processFlags...),
+			fmt.Sprintf("--boundary=%s", BoundaryFilePath(jobID)))
+	}
+	processFlags = withSidecarFlags(processFlags, cfg.Sidecars, jobID)
+
+	// A checkpointed task restores its checkpoint once the imagery is in
+	// place, and runs ODM so that it resumes there; see checkpoint.go. A
+	// rerun does the same with the project its last run saved; see rerun.go.
+	checkpointed := checkpointing(cfg)
+	checkpointFP := checkpointFingerprint(cfg.ODMImage, processFlags)
+	processPrelude := ""
+	odmRun := `echo "Executing: python3 -u run.py $odm_args"
+python3 -u run.py $odm_args`
+	uploadScript := s3.GenerateUploadScript(cfg.WriteS3Path)
+	if checkpointed {
+		checkpointPath := s3.CheckpointPath(cfg.WriteS3Path)
+		downloadScript += s3.GenerateCheckpointRestoreScript(checkpointPath, checkpointFP, cfg.ResumeCheckpoint)
+		processPrelude = checkpointProcessPrelude()
+		odmRun = checkpointODMRun()
+		uploadScript += s3.GenerateCheckpointPurgeScript(checkpointPath)
+	}
+	resumable := Resumable(cfg.ProcessingMode, cfg.Split)
+	if resumable && cfg.RerunFrom != "" {
+		downloadScript += s3.GenerateIntermediatesRestoreScript(s3.IntermediatesPath(cfg.WriteS3Path), cfg.RerunFrom, checkpointed)
+		processPrelude = checkpointProcessPrelude()
+		odmRun = checkpointODMRun()
+	}
+	if resumable && cfg.KeepIntermediates {
+		uploadScript += s3.GenerateIntermediatesUploadScript(s3.IntermediatesPath(cfg.WriteS3Path))
+	}
+
 	// Download input files. Argo captures stdout when log archival is enabled.
 	downloadContainer := wfv1.ContainerNode{
 		Container: apiv1.Container{
@@ -861,23 +1059,41 @@ func (c *Client) buildODMWorkflow(cfg *ODMPipelineConfig) *wfv1.Workflow {
 			Args: []string{fmt.Sprintf(`set -e
 set -o pipefail
 echo "=== download attempt {{retries}} @ $(date -u +%%Y-%%m-%%dT%%H:%%M:%%SZ) ==="
-%s%s`,
-				s3.GenerateDownloadScript(jobID, cfg.ReadS3Path, cfg.ExcludePaths, cfg.S3ScanDepth),
-				s3.GenerateBoundaryFetchScript(BoundaryFilePath(jobID), cfg.Boundary.S3Path, cfg.Boundary.GeoJSON),
-			)},
+%s`, downloadScript)},
 			Env:             awsEnv,
 			Resources:       containerRequirements(cfg.DownloadResources),
 			SecurityContext: workflowContainerSecurityContext(),
 		},
 	}
 
+	distributed := distributedSplitMerge(cfg)
 	// Run ODM with unbuffered Python so partial logs are flushed promptly.
-	processFlags := cfg.ODMFlags
-	if cfg.Boundary.IsSet() {
-		processFlags = append(append([]string{}, processFlags...),
-			fmt.Sprintf("--boundary=%s", BoundaryFilePath(jobID)))
-	}
+	// Without a shared workspace ODM runs the split-merge itself, in this pod.
 	odmFlagsStr := strings.Join(processFlags, " ")
+	if !distributed {
+		odmFlagsStr = strings.Join(append(append([]string{}, processFlags...), splitFlags(cfg)...), " ")
+	}
+	// The usage line at the end records the run's peak memory and workspace
+	// for learned sizing; see ProcessUsage.
+	usageStart, usageReport := processUsageScripts()
+	processScript := fmt.Sprintf(`
+set -e
+set -o pipefail
+JOB_ID="{{workflow.name}}"
+%secho "=== process attempt {{retries}} @ $(date -u +%%Y-%%m-%%dT%%H:%%M:%%SZ) ==="
+mkdir -p "$HOME" "$XDG_CACHE_HOME" "$XDG_CONFIG_HOME" "$XDG_DATA_HOME" "$MPLCONFIGDIR"
+echo "Running ODM processing..."
+echo "Processing job: $JOB_ID"
+echo "ODM Project ID: %s"
+odm_args="%s --project-path /workspace $JOB_ID"
+%s
+%s
+echo "ODM processing complete"
+%s
+				`, processPrelude, cfg.ODMProjectID, odmFlagsStr, usageStart, odmRun, usageReport)
+	if cfg.ProcessingMode == ProcessingModeMergeExisting {
+		processScript = generateMergeScript(mergeInputsDir)
+	}
 	odmContainer := wfv1.ContainerNode{
 		Container: apiv1.Container{
 			Name:            "process",
@@ -892,22 +1108,7 @@ echo "=== download attempt {{retries}} @ $(date -u +%%Y-%%m-%%dT%%H:%%M:%%SZ) ==
 					MountPath: odmModelCachePath,
 				},
 			},
-			Args: []string{
-				fmt.Sprintf(`
-set -e
-set -o pipefail
-JOB_ID="{{workflow.name}}"
-echo "=== process attempt {{retries}} @ $(date -u +%%Y-%%m-%%dT%%H:%%M:%%SZ) ==="
-mkdir -p "$HOME" "$XDG_CACHE_HOME" "$XDG_CONFIG_HOME" "$XDG_DATA_HOME" "$MPLCONFIGDIR"
-echo "Running ODM processing..."
-echo "Processing job: $JOB_ID"
-echo "ODM Project ID: %s"
-odm_args="%s --project-path /workspace $JOB_ID"
-echo "Executing: python3 -u run.py $odm_args"
-python3 -u run.py $odm_args
-echo "ODM processing complete"
-				`, cfg.ODMProjectID, odmFlagsStr),
-			},
+			Args: []string{processScript},
 		},
 		Dependencies: []string{"download"},
 	}
@@ -921,7 +1122,7 @@ echo "ODM processing complete"
 			Args: []string{fmt.Sprintf(`set -e
 set -o pipefail
 echo "=== upload attempt {{retries}} @ $(date -u +%%Y-%%m-%%dT%%H:%%M:%%SZ) ==="
-%s`, s3.GenerateUploadScript(cfg.WriteS3Path))},
+%s`, uploadScript)},
 			Env:             awsEnv,
 			Resources:       containerRequirements(cfg.UploadResources),
 			SecurityContext: workflowContainerSecurityContext(),
@@ -1011,6 +1212,38 @@ echo "=== upload attempt {{retries}} @ $(date -u +%%Y-%%m-%%dT%%H:%%M:%%SZ) ==="
 			},
 		},
 	}
+	if cfg.ProcessingMode == ProcessingModeThermal {
+		odmContainer.Dependencies = []string{"thermal"}
+		mainTemplate.ContainerSet.Containers = []wfv1.ContainerNode{
+			downloadContainer,
+			thermalContainer(cfg),
+			odmContainer,
+			uploadContainer,
+		}
+	}
+	if !cfg.SkipPostProcessing {
+		containers := mainTemplate.ContainerSet.Containers
+		last := len(containers) - 1 // upload
+		uploadContainer.Dependencies = []string{PostProcessStage}
+		mainTemplate.ContainerSet.Containers = append(containers[:last:last],
+			postProcessContainer(cfg, containers[last-1].Name), uploadContainer)
+	}
+	if cfg.CreateAllZip {
+		containers := mainTemplate.ContainerSet.Containers
+		last := len(containers) - 1 // upload
+		uploadContainer.Dependencies = []string{AllZipStage}
+		mainTemplate.ContainerSet.Containers = append(containers[:last:last],
+			allZipContainer(cfg, containers[last-1].Name), uploadContainer)
+	}
+	if checkpointed {
+		// Checkpoints run beside ODM; upload waits for the last one, since it
+		// removes the checkpoint.
+		containers := mainTemplate.ContainerSet.Containers
+		last := len(containers) - 1 // upload
+		uploadContainer.Dependencies = append(append([]string{}, uploadContainer.Dependencies...), CheckpointStage)
+		mainTemplate.ContainerSet.Containers = append(containers[:last:last],
+			uploadContainer, checkpointContainer(cfg, checkpointFP, odmContainer.Dependencies))
+	}
 
 	workspaceSize := strings.TrimSpace(cfg.Workspace.Size)
 	if workspaceSize == "" {
@@ -1056,6 +1289,16 @@ echo "=== upload attempt {{retries}} @ $(date -u +%%Y-%%m-%%dT%%H:%%M:%%SZ) ==="
 		cleanupTemplate.Volumes = append(cleanupTemplate.Volumes, emptyDirWorkspace)
 	}
 
+	templates := []wfv1.Template{mainTemplate, cleanupTemplate}
+	switch {
+	case cfg.ProcessingMode == ProcessingModeCityScale:
+		templates = append(cityScaleTemplates(cfg, processFlags, downloadContainer.Container, uploadContainer.Container,
+			[]apiv1.Volume{tmpVolume, modelCacheVolume}), cleanupTemplate)
+	case distributed:
+		templates = append(splitMergeTemplates(cfg, processFlags, downloadContainer.Container, uploadContainer.Container,
+			[]apiv1.Volume{tmpVolume, modelCacheVolume}), cleanupTemplate)
+	}
+
 	nodeSelector, tolerations := buildNodeScheduling(cfg.CapacityType)
 
 	// Advertise limit - request as a rough guide (not the real LimitedSwap grant,
@@ -1067,11 +1310,17 @@ echo "=== upload attempt {{retries}} @ $(date -u +%%Y-%%m-%%dT%%H:%%M:%%SZ) ==="
 	if len(annotations) == 0 {
 		annotations = nil
 	}
+	var labels map[string]string
+	if cfg.Tenant != "" {
+		labels = map[string]string{TenantLabel: TenantLabelValue(cfg.Tenant)}
+	}
 
 	wf := &wfv1.Workflow{
 		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: "odm-pipeline-",
+			Name:         cfg.WorkflowName,
+			GenerateName: workflowNamePrefix,
 			Namespace:    c.namespace,
+			Labels:       labels,
 			Annotations:  annotations,
 		},
 		Spec: wfv1.WorkflowSpec{
@@ -1085,7 +1334,7 @@ echo "=== upload attempt {{retries}} @ $(date -u +%%Y-%%m-%%dT%%H:%%M:%%SZ) ==="
 				SecondsAfterFailure: &ttlFailure,
 			},
 			PodGC:        toPodGC(cfg.RuntimeGuardrails.PodGCStrategy, cfg.RuntimeGuardrails.PodGCDeleteDelaySecond),
-			Templates:    []wfv1.Template{mainTemplate, cleanupTemplate},
+			Templates:    templates,
 			NodeSelector: nodeSelector,
 			Tolerations:  tolerations,
 		},
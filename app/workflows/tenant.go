@@ -0,0 +1,32 @@
+package workflows
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// TenantLabel is stamped on every workflow created for a tenant, so
+// /task/list can scope Argo listings with a label selector.
+const TenantLabel = "scaleodm.hotosm.org/tenant"
+
+// TenantLabelValue maps a tenant name to a valid label value. Names that are
+// already valid (<=63 chars of [A-Za-z0-9_.-]) are used as-is; anything else
+// is replaced by a stable hash so arbitrary token names still select cleanly.
+func TenantLabelValue(tenant string) string {
+	if len(validation.IsValidLabelValue(tenant)) == 0 {
+		return tenant
+	}
+	sum := sha256.Sum256([]byte(tenant))
+	return "t-" + hex.EncodeToString(sum[:])[:32]
+}
+
+// TenantSelector returns the label selector matching one tenant's workflows,
+// or "" (every workflow) when tenant is empty.
+func TenantSelector(tenant string) string {
+	if tenant == "" {
+		return ""
+	}
+	return TenantLabel + "=" + TenantLabelValue(tenant)
+}
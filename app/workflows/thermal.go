@@ -0,0 +1,155 @@
+package workflows
+
+import (
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/hotosm/scaleodm/app/s3"
+)
+
+// The thermal mode adds a "thermal" stage between download and process. The
+// download stage (s3.GenerateThermalDownloadScript) lists the radiometric
+// JPEGs it found; this stage converts each one to a single-band float32 TIFF
+// of temperatures in °C, using ODM's own FLIR/DJI decoders, and aligns the
+// temperature band to the frame the image's EXIF describes (some cameras
+// embed the raw sensor data at another size). EXIF and XMP are carried over,
+// with the band tagged LWIR, so ODM still sees the camera and its position.
+// Already-calibrated TIFFs pass through untouched.
+
+// thermalODMFlags are added to every thermal run unless the task sets them.
+// Seam leveling would shift absolute temperatures between images, and
+// thermal frames are small enough that full-resolution features are cheap.
+var thermalODMFlags = []string{
+	"--texturing-skip-global-seam-leveling",
+	"--feature-quality=ultra",
+}
+
+// withThermalFlags returns odmFlags plus any thermalODMFlags not already set.
+func withThermalFlags(odmFlags []string) []string {
+	set := map[string]bool{}
+	for _, flag := range odmFlags {
+		name, _, _ := strings.Cut(flag, "=")
+		set[name] = true
+	}
+	flags := append([]string{}, odmFlags...)
+	for _, flag := range thermalODMFlags {
+		name, _, _ := strings.Cut(flag, "=")
+		if !set[name] {
+			flags = append(flags, flag)
+		}
+	}
+	return flags
+}
+
+// thermalConvertScript runs in the ODM image with the task's workspace
+// directory as its argument.
+const thermalConvertScript = `import os
+import re
+import sys
+
+sys.path.insert(0, os.getcwd())
+import cv2
+import numpy as np
+from PIL import Image
+from opendm import log, thermal
+from opendm.photo import ODM_Photo
+
+PIX4D_CAMERA_NS = "http://pix4d.com/camera/1.0/"
+
+project_path = sys.argv[1]
+images_path = os.path.join(project_path, "images")
+with open(os.path.join(project_path, "__MANIFEST__")) as f:
+    names = [line.strip() for line in f if line.strip()]
+renamed = {}
+
+
+def lwir_xmp(xmp):
+    # ODM tells thermal bands apart by Camera:BandName.
+    if not xmp:
+        return None
+    if isinstance(xmp, bytes):
+        xmp = xmp.decode("utf-8", "ignore")
+    if "Camera:BandName" not in xmp:
+        attrs = 'Camera:BandName="LWIR"'
+        if "xmlns:Camera=" not in xmp:
+            attrs = 'xmlns:Camera="%s" %s' % (PIX4D_CAMERA_NS, attrs)
+        xmp = re.sub(r"<rdf:Description\b", "<rdf:Description " + attrs, xmp, count=1)
+    return xmp.encode("utf-8")
+
+
+for name in names:
+    src = os.path.join(images_path, name)
+    photo = ODM_Photo(src)
+    # The download stage found radiometric data, whatever the tags say.
+    photo.band_name = "LWIR"
+    image = cv2.imread(src, cv2.IMREAD_ANYCOLOR | cv2.IMREAD_ANYDEPTH)
+    temperatures = thermal.dn_to_temperature(photo, image, images_path)
+    if temperatures is None or temperatures.ndim != 2:
+        log.ODM_ERROR("Cannot read temperatures from %s" % name)
+        sys.exit(1)
+    temperatures = thermal.resize_to_match(temperatures, photo)
+
+    with Image.open(src) as jpeg:
+        exif = jpeg.getexif()
+        xmp = lwir_xmp(jpeg.info.get("xmp"))
+    dst = os.path.splitext(src)[0] + ".tif"
+    if os.path.exists(dst):
+        dst = os.path.splitext(src)[0] + "_thermal.tif"
+    Image.fromarray(temperatures.astype(np.float32), mode="F").save(
+        dst, format="TIFF", exif=exif, tiffinfo={700: xmp} if xmp else {})
+    os.remove(src)
+    renamed[name] = os.path.basename(dst)
+    log.ODM_INFO("%s -> %s (%.1f to %.1f C)" % (
+        name, os.path.basename(dst), float(np.nanmin(temperatures)), float(np.nanmax(temperatures))))
+
+log.ODM_INFO("Converted %d radiometric images" % len(names))
+
+# Sidecar files name images by file name; follow the conversion.
+for sidecar in __SIDECARS__:
+    sidecar_path = os.path.join(project_path, sidecar)
+    if not renamed or not os.path.isfile(sidecar_path):
+        continue
+    with open(sidecar_path) as f:
+        text = f.read()
+    with open(sidecar_path, "w") as f:
+        f.write(re.sub(r"\S+", lambda m: renamed.get(m.group(0), m.group(0)), text))
+    log.ODM_INFO("Updated image names in %s" % sidecar)
+`
+
+func generateThermalScript() string {
+	return `set -e
+set -o pipefail
+JOB_ID="{{workflow.name}}"
+WORK_DIR="/workspace/$JOB_ID"
+echo "=== thermal attempt {{retries}} @ $(date -u +%Y-%m-%dT%H:%M:%SZ) ==="
+mkdir -p "$HOME" "$XDG_CACHE_HOME" "$XDG_CONFIG_HOME" "$XDG_DATA_HOME" "$MPLCONFIGDIR"
+if [ ! -s "$WORK_DIR/` + s3.ThermalManifestName + `" ]; then
+  echo "No radiometric JPEGs to convert"
+  exit 0
+fi
+cat > /tmp/scaleodm-thermal.py <<'THERMAL_EOF'
+` + strings.NewReplacer(
+		"__MANIFEST__", s3.ThermalManifestName,
+		"__SIDECARS__", `["`+strings.Join([]string{s3.GCPFileName, s3.GeoFileName, s3.ImageGroupsFileName}, `", "`)+`"]`,
+	).Replace(thermalConvertScript) + `THERMAL_EOF
+python3 -u /tmp/scaleodm-thermal.py "$WORK_DIR"
+`
+}
+
+// thermalContainer is the thermal stage of the main ContainerSet.
+func thermalContainer(cfg *ODMPipelineConfig) wfv1.ContainerNode {
+	return wfv1.ContainerNode{
+		Container: apiv1.Container{
+			Name:            "thermal",
+			Image:           cfg.ODMImage,
+			Command:         []string{"/bin/bash", "-c"},
+			Args:            []string{generateThermalScript()},
+			Env:             odmProcessEnvVars(),
+			Resources:       containerRequirements(cfg.ThermalResources),
+			SecurityContext: workflowContainerSecurityContext(),
+		},
+		Dependencies: []string{"download"},
+	}
+}
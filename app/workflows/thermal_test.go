@@ -0,0 +1,43 @@
+package workflows
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hotosm/scaleodm/app/s3"
+)
+
+func TestWithThermalFlags_KeepsUserValues(t *testing.T) {
+	assert.Equal(t,
+		[]string{"--dsm", "--feature-quality=high", "--texturing-skip-global-seam-leveling"},
+		withThermalFlags([]string{"--dsm", "--feature-quality=high"}))
+}
+
+func TestBuildODMWorkflow_ThermalMode(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/thermal/", "s3://bucket/output/", []string{"--dsm"})
+	cfg.ProcessingMode = ProcessingModeThermal
+	wf := client.buildODMWorkflow(cfg)
+
+	containers := wf.Spec.Templates[0].ContainerSet.Containers
+	require.Len(t, containers, 5)
+	names := make([]string, len(containers))
+	for i, c := range containers {
+		names[i] = c.Name
+	}
+	assert.Equal(t, []string{"download", "thermal", "process", PostProcessStage, "upload"}, names)
+
+	download, thermal, process := containers[0], containers[1], containers[2]
+	assert.Contains(t, download.Args[0], s3.ThermalManifestName)
+	assert.Equal(t, []string{"download"}, thermal.Dependencies)
+	assert.Equal(t, cfg.ODMImage, thermal.Image)
+	assert.Contains(t, thermal.Args[0], "dn_to_temperature")
+	assert.Contains(t, thermal.Args[0], `open(os.path.join(project_path, "`+s3.ThermalManifestName+`"))`)
+	assert.Equal(t, containerRequirements(cfg.ThermalResources), thermal.Resources)
+
+	assert.Equal(t, []string{"thermal"}, process.Dependencies)
+	assert.Contains(t, process.Args[0], "--dsm --texturing-skip-global-seam-leveling --feature-quality=ultra")
+}
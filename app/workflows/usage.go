@@ -0,0 +1,179 @@
+package workflows
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// processUsageMarker starts the line the process container prints when ODM
+// finishes, with its peak resource usage as key=value pairs.
+const processUsageMarker = "scaleodm-usage"
+
+// processUsageSampleSeconds paces the sampler of the process container's
+// anonymous memory and workspace size. du walks the whole workspace, so it
+// is not run more often.
+const processUsageSampleSeconds = 30
+
+// processUsageTailLines is how much of the end of a live process log is read
+// for the usage line, which follows ODM's last lines.
+const processUsageTailLines = int64(50)
+
+// ProcessUsage is the peak resource usage of a finished ODM run, as its
+// process container measured it.
+type ProcessUsage struct {
+	// PeakMemoryBytes is the cgroup's memory high-water mark. It counts page
+	// cache, so a run that reads more imagery than fits in its limit peaks
+	// near the limit.
+	PeakMemoryBytes int64
+	// PeakAnonBytes is the sampled maximum of the cgroup's anonymous memory,
+	// ODM's working set without page cache; 0 when it was not sampled.
+	PeakAnonBytes int64
+	// PeakSwapBytes is the cgroup's swap high-water mark, 0 without swap or
+	// on kernels that do not track it.
+	PeakSwapBytes int64
+	// WorkspacePeakBytes is the sampled maximum size of the task's workspace
+	// directory.
+	WorkspacePeakBytes int64
+	// Resumed is set when ODM ran with --rerun-from, resuming a checkpoint
+	// or a rerun's saved project. The peaks then cover only the stages it
+	// ran, not the whole task.
+	Resumed bool
+}
+
+// WorkingSetBytes is the memory the run needed at its peak: anonymous memory
+// when it was sampled, else the cgroup peak, plus swap. It is what the
+// peak RAM estimate of estimateProcessResourcesFromImageCount predicts.
+func (u ProcessUsage) WorkingSetBytes() int64 {
+	memory := u.PeakAnonBytes
+	if memory <= 0 {
+		memory = u.PeakMemoryBytes
+	}
+	return memory + u.PeakSwapBytes
+}
+
+// processUsageScripts return the shell the process script runs around ODM:
+// start launches a background sampler of the anonymous memory (cgroup v2
+// "anon", v1 "rss") and workspace size, keeping their maxima; report stops
+// it, samples once more and prints the usage line ProcessUsageFromLog reads.
+// Both expect $JOB_ID to be set; report also reads the $resume_from of
+// checkpointODMRun.
+func processUsageScripts() (start, report string) {
+	start = fmt.Sprintf(`usage_peaks=$(mktemp)
+cgroup_dir=/sys/fs/cgroup
+[ -f "$cgroup_dir/memory.stat" ] || cgroup_dir=/sys/fs/cgroup/memory
+anon_peak=0
+workspace_peak=0
+sample_usage() {
+  anon=$(awk '$1 == "anon" || $1 == "rss" { print $2; exit }' "$cgroup_dir/memory.stat" 2>/dev/null) || true
+  workspace=$(du -sxb "/workspace/$JOB_ID" 2>/dev/null | cut -f1) || true
+  [ "${anon:-0}" -gt "$anon_peak" ] 2>/dev/null && anon_peak=$anon
+  [ "${workspace:-0}" -gt "$workspace_peak" ] 2>/dev/null && workspace_peak=$workspace
+  echo "$anon_peak $workspace_peak" > "$usage_peaks"
+}
+(while true; do sample_usage; sleep %d; done) &
+usage_sampler=$!
+`, processUsageSampleSeconds)
+	report = fmt.Sprintf(`kill "$usage_sampler" 2>/dev/null || true
+read -r anon_peak workspace_peak < "$usage_peaks" || true
+sample_usage
+peak_memory=$(cat "$cgroup_dir/memory.peak" 2>/dev/null || cat "$cgroup_dir/memory.max_usage_in_bytes" 2>/dev/null || echo 0)
+peak_swap=$(cat "$cgroup_dir/memory.swap.peak" 2>/dev/null || echo 0)
+resumed=0
+[[ ${resume_from:-} =~ ^[a-z_]+$ ]] && resumed=1
+echo "%s peak_memory_bytes=$peak_memory peak_anon_bytes=$anon_peak peak_swap_bytes=$peak_swap workspace_peak_bytes=$workspace_peak resumed=$resumed"
+`, processUsageMarker)
+	return start, report
+}
+
+// ProcessUsageFromLog returns the usage the last usage line of a process log
+// reports (a retried run prints one per attempt), or nil when it has none.
+func ProcessUsageFromLog(r io.Reader) (*ProcessUsage, error) {
+	var usage *ProcessUsage
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if parsed, ok := parseProcessUsage(line); ok {
+			usage = parsed
+		}
+		if errors.Is(err, io.EOF) {
+			return usage, nil
+		}
+		if err != nil {
+			return usage, err
+		}
+	}
+}
+
+func parseProcessUsage(line string) (*ProcessUsage, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != processUsageMarker {
+		return nil, false
+	}
+	usage := &ProcessUsage{}
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			continue
+		}
+		switch key {
+		case "peak_memory_bytes":
+			usage.PeakMemoryBytes = n
+		case "peak_anon_bytes":
+			usage.PeakAnonBytes = n
+		case "peak_swap_bytes":
+			usage.PeakSwapBytes = n
+		case "workspace_peak_bytes":
+			usage.WorkspacePeakBytes = n
+		case "resumed":
+			usage.Resumed = n != 0
+		}
+	}
+	return usage, true
+}
+
+// ProcessUsage returns the usage a finished single-pod workflow's process
+// container reported, from the end of the newest pod's log while the pods
+// remain and from the log archive once they are gone. It returns nil when no
+// usage was reported: ODM failed, the workflow ran a DAG pipeline or merged
+// existing outputs, or it predates the usage line.
+func (c *Client) ProcessUsage(ctx context.Context, workflowName string) (*ProcessUsage, error) {
+	pods, err := c.workflowPods(ctx, workflowName)
+	if err != nil {
+		return nil, err
+	}
+	if len(pods) == 0 {
+		reader, writer := io.Pipe()
+		go func() {
+			writer.CloseWithError(c.streamArchivedProcessLog(ctx, workflowName, writer))
+		}()
+		defer reader.Close()
+		return ProcessUsageFromLog(reader)
+	}
+
+	// A retried pod is the newest.
+	pod := &pods[len(pods)-1]
+	if followedLogContainer(pod) != archivedProcessLogContainer || !containerStarted(pod, archivedProcessLogContainer) {
+		return nil, nil
+	}
+	tailLines := processUsageTailLines
+	stream, err := c.k8sClient.CoreV1().Pods(c.namespace).GetLogs(pod.Name, &apiv1.PodLogOptions{
+		Container: archivedProcessLogContainer,
+		TailLines: &tailLines,
+	}).Stream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read process log of pod %s: %w", pod.Name, err)
+	}
+	defer stream.Close()
+	return ProcessUsageFromLog(stream)
+}
@@ -0,0 +1,61 @@
+package workflows
+
+import (
+	"strings"
+	"testing"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessUsageFromLog(t *testing.T) {
+	log := strings.Join([]string{
+		"=== process attempt 0 @ 2026-10-01T10:00:00Z ===",
+		"scaleodm-usage peak_memory_bytes=100 peak_anon_bytes=80 peak_swap_bytes=0 workspace_peak_bytes=1000",
+		"=== process attempt 1 @ 2026-10-01T11:00:00Z ===",
+		"[INFO]    Running odm_report stage",
+		"ODM processing complete",
+		"scaleodm-usage peak_memory_bytes=34359738368 peak_anon_bytes=30064771072 peak_swap_bytes=2147483648 workspace_peak_bytes=unknown",
+	}, "\n")
+
+	usage, err := ProcessUsageFromLog(strings.NewReader(log))
+	require.NoError(t, err)
+	require.NotNil(t, usage)
+	assert.Equal(t, ProcessUsage{PeakMemoryBytes: 34359738368, PeakAnonBytes: 30064771072, PeakSwapBytes: 2147483648}, *usage)
+	assert.Equal(t, int64(32212254720), usage.WorkingSetBytes())
+
+	usage, err = ProcessUsageFromLog(strings.NewReader("scaleodm-usage peak_memory_bytes=100 peak_anon_bytes=80 peak_swap_bytes=0 workspace_peak_bytes=1000 resumed=1\n"))
+	require.NoError(t, err)
+	require.NotNil(t, usage)
+	assert.True(t, usage.Resumed)
+
+	usage, err = ProcessUsageFromLog(strings.NewReader("ODM processing complete\n"))
+	require.NoError(t, err)
+	assert.Nil(t, usage)
+}
+
+func TestProcessUsage_WorkingSetFallsBackToCgroupPeak(t *testing.T) {
+	usage := ProcessUsage{PeakMemoryBytes: 100, PeakSwapBytes: 20}
+	assert.Equal(t, int64(120), usage.WorkingSetBytes())
+}
+
+func TestBuildODMWorkflow_ProcessReportsUsage(t *testing.T) {
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/images/", "s3://bucket/output/", nil)
+	wf := (&Client{namespace: "test-namespace"}).buildODMWorkflow(cfg)
+
+	require.NotNil(t, wf.Spec.Templates[0].ContainerSet)
+	var process *wfv1.ContainerNode
+	for i := range wf.Spec.Templates[0].ContainerSet.Containers {
+		if wf.Spec.Templates[0].ContainerSet.Containers[i].Name == "process" {
+			process = &wf.Spec.Templates[0].ContainerSet.Containers[i]
+		}
+	}
+	require.NotNil(t, process)
+	script := process.Args[0]
+	assert.Contains(t, script, "memory.peak")
+	assert.Contains(t, script, `du -sxb "/workspace/$JOB_ID"`)
+	assert.Contains(t, script, "resumed=$resumed")
+	// The usage line follows ODM, so only a finished run reports one.
+	assert.Greater(t, strings.Index(script, processUsageMarker+" peak_memory_bytes="), strings.Index(script, "python3 -u run.py $odm_args"))
+}
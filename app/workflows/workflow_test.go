@@ -1,6 +1,8 @@
 package workflows
 
 import (
+	"fmt"
+	"math"
 	"strings"
 	"testing"
 
@@ -494,7 +496,7 @@ func TestBuildODMWorkflow_AppliesGuardrailsAndResources(t *testing.T) {
 	assert.Contains(t, wf.Spec.PodSpecPatch, `"seccompProfile":{"type":"RuntimeDefault"}`)
 
 	containers := wf.Spec.Templates[0].ContainerSet.Containers
-	require.Len(t, containers, 3)
+	require.Len(t, containers, 4)
 	for _, container := range containers {
 		assert.NotEmpty(t, container.Resources.Requests)
 		assert.NotEmpty(t, container.Resources.Limits)
@@ -1094,3 +1096,124 @@ func volumeNames(volumes []apiv1.Volume) []string {
 	}
 	return names
 }
+
+func TestBuildODMWorkflow_StampsTenantLabel(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/images/", "s3://bucket/output/", nil)
+	wf := client.buildODMWorkflow(cfg)
+	assert.Empty(t, wf.Labels)
+
+	cfg.Tenant = "dronetm"
+	wf = client.buildODMWorkflow(cfg)
+	assert.Equal(t, "dronetm", wf.Labels[TenantLabel])
+}
+
+func TestTenantLabelValue(t *testing.T) {
+	assert.Equal(t, "dronetm", TenantLabelValue("dronetm"))
+	assert.Equal(t, "", TenantSelector(""))
+	assert.Equal(t, TenantLabel+"=fair", TenantSelector("fair"))
+
+	hashed := TenantLabelValue("hot team/ops")
+	assert.NotEqual(t, "hot team/ops", hashed)
+	assert.Equal(t, hashed, TenantLabelValue("hot team/ops"))
+	assert.LessOrEqual(t, len(hashed), 63)
+}
+
+func TestEstimateWorkspaceGiB_FallsBackToStaticSize(t *testing.T) {
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/images/", "s3://bucket/output/", nil)
+	cfg.Workspace.Size = "50Gi"
+	assert.Equal(t, 50.0, EstimateWorkspaceGiB(cfg))
+
+	cfg.ImageCount = 400
+	cfg.ImageTotalBytes = 400 * 10 * 1024 * 1024
+	assert.Equal(t, math.Ceil(estimateWorkspaceGiB(cfg.ImageTotalBytes, cfg.ImageCount, cfg.ODMFlags)), EstimateWorkspaceGiB(cfg))
+}
+
+func TestBuildODMWorkflow_PinnedName(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/images/", "s3://bucket/output/", nil)
+	wf := client.buildODMWorkflow(cfg)
+	assert.Empty(t, wf.Name)
+	assert.Equal(t, "odm-pipeline-", wf.GenerateName)
+
+	cfg.WorkflowName = NewWorkflowName()
+	wf = client.buildODMWorkflow(cfg)
+	assert.Equal(t, cfg.WorkflowName, wf.Name)
+	assert.Regexp(t, `^odm-pipeline-[a-z0-9]{5}$`, wf.Name)
+}
+
+func TestBuildODMWorkflow_MergeExistingMode(t *testing.T) {
+	client := &Client{namespace: "test-namespace"}
+
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/project/", "s3://bucket/project/merged/", nil)
+	cfg.ProcessingMode = ProcessingModeMergeExisting
+	cfg.S3ScanDepth = MaxS3ScanDepth
+	wf := client.buildODMWorkflow(cfg)
+
+	scripts := map[string]string{}
+	for _, container := range wf.Spec.Templates[0].ContainerSet.Containers {
+		require.Len(t, container.Args, 1)
+		scripts[container.Name] = container.Args[0]
+	}
+	require.Len(t, scripts, 4)
+
+	assert.Contains(t, scripts["download"], "merge_inputs")
+	assert.Contains(t, scripts["download"], "- /merged/**")
+	assert.NotContains(t, scripts["download"], "Flattening")
+
+	assert.NotContains(t, scripts["process"], "run.py")
+	assert.Contains(t, scripts["process"], `merge_rasters "odm_orthophoto/odm_orthophoto.tif" ortho`)
+	assert.Contains(t, scripts["process"], `merge_rasters "odm_dem/dsm.tif" dem`)
+	assert.Contains(t, scripts["process"], `merge_point_clouds "odm_georeferencing/odm_georeferenced_model.laz"`)
+	assert.Contains(t, scripts["process"], `rm -rf "$INPUT_DIR"`)
+
+	assert.Contains(t, scripts["upload"], "s3://bucket/project/merged/")
+}
+
+func TestEstimateWorkspaceGiB_MergeExistingUsesInputBytes(t *testing.T) {
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/project/", "s3://bucket/output/", nil)
+	cfg.ProcessingMode = ProcessingModeMergeExisting
+	cfg.ImageTotalBytes = 40 << 30
+
+	assert.Equal(t, math.Ceil(math.Min(120, config.SCALEODM_WORKFLOW_WORKSPACE_DYNAMIC_SIZE_MAX_GIB)), EstimateWorkspaceGiB(cfg))
+
+	cfg.ImageTotalBytes = 1 << 20
+	assert.Equal(t, mergeWorkspaceMinGiB, EstimateWorkspaceGiB(cfg))
+}
+
+func TestRenderODMWorkflow_ResolvesConfigWithoutSubmitting(t *testing.T) {
+	prevT := config.SCALEODM_WORKFLOW_ONDEMAND_IMAGE_THRESHOLD
+	prevM := config.SCALEODM_WORKFLOW_SCHEDULING_MODE
+	config.SCALEODM_WORKFLOW_ONDEMAND_IMAGE_THRESHOLD = 3000
+	config.SCALEODM_WORKFLOW_SCHEDULING_MODE = "karpenter"
+	t.Cleanup(func() {
+		config.SCALEODM_WORKFLOW_ONDEMAND_IMAGE_THRESHOLD = prevT
+		config.SCALEODM_WORKFLOW_SCHEDULING_MODE = prevM
+	})
+
+	// No clientset: rendering must not reach Argo.
+	client := &Client{namespace: "test-namespace"}
+	cfg := NewDefaultODMConfig("test-project", "s3://bucket/images/", "s3://bucket/output/", nil)
+	defaults := cfg.ProcessResources
+	cfg.ImageCount = 4000
+	cfg.CapacityType = CapacityTypeSpot
+
+	wf, err := client.RenderODMWorkflow(cfg)
+	require.NoError(t, err)
+
+	assert.Equal(t, CapacityTypeOnDemand, cfg.CapacityType)
+	assert.Equal(t, estimateProcessResourcesFromImageCount(4000, nil, defaults), cfg.ProcessResources)
+	assert.Contains(t, cfg.ODMFlags, fmt.Sprintf("--max-concurrency=%d", parseCPUCores(cfg.ProcessResources.Limits.CPU)))
+
+	assert.Equal(t, "test-namespace", wf.Namespace)
+	assert.Equal(t, "odm-pipeline-", wf.GenerateName)
+	var process apiv1.Container
+	for _, c := range wf.Spec.Templates[0].ContainerSet.Containers {
+		if c.Name == "process" {
+			process = c.Container
+		}
+	}
+	assert.Equal(t, containerRequirements(cfg.ProcessResources), process.Resources)
+}
@@ -9,6 +9,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -23,9 +24,13 @@ import (
 	"github.com/hotosm/scaleodm/app/api"
 	"github.com/hotosm/scaleodm/app/config"
 	"github.com/hotosm/scaleodm/app/db"
+	"github.com/hotosm/scaleodm/app/dispatcher"
+	"github.com/hotosm/scaleodm/app/estimator"
+	"github.com/hotosm/scaleodm/app/events"
 	"github.com/hotosm/scaleodm/app/meta"
 	"github.com/hotosm/scaleodm/app/observability"
 	"github.com/hotosm/scaleodm/app/reconciler"
+	"github.com/hotosm/scaleodm/app/webhook"
 	"github.com/hotosm/scaleodm/app/workflows"
 )
 
@@ -110,9 +115,57 @@ func main() {
 		log.Printf("Argo Workflows client initialized (availability checked by readiness probe, took %v)", time.Since(k8sStart))
 	}
 
+	// Publish task status changes to event subscribers. The hook is set
+	// before the workers below start updating statuses.
+	if config.SCALEODM_EVENTS_SINK != "" && !docsOnly {
+		sink, err := events.NewSink(config.SCALEODM_EVENTS_SINK, config.SCALEODM_EVENTS_NATS_URL, database.Pool)
+		if err != nil {
+			log.Fatalf("Invalid event sink configuration: %v", err)
+		}
+		events.Start(ctx, metadataStore, sink, events.Options{
+			Source:  config.SCALEODM_EVENTS_SOURCE,
+			Timeout: time.Duration(config.SCALEODM_EVENTS_TIMEOUT_SECONDS) * time.Second,
+		})
+	}
+
 	// Start background reconciler. Does not run when wfClient is nil (docs-only mode).
 	reconciler.Start(ctx, metadataStore, wfClient, config.SCALEODM_RECONCILER_INTERVAL_SECONDS)
 
+	// Deliver task webhooks from the outbox. Docs-only mode runs no tasks.
+	if !docsOnly {
+		webhook.Start(ctx, metadataStore, webhook.Options{
+			Interval:      time.Duration(config.SCALEODM_WEBHOOK_INTERVAL_SECONDS) * time.Second,
+			Timeout:       time.Duration(config.SCALEODM_WEBHOOK_TIMEOUT_SECONDS) * time.Second,
+			MaxAttempts:   config.SCALEODM_WEBHOOK_MAX_ATTEMPTS,
+			DefaultSecret: config.SCALEODM_WEBHOOK_SECRET,
+			Payload: func(job *meta.JobMetadata) ([]byte, error) {
+				return json.Marshal(api.TaskInfoFromJob(job))
+			},
+		})
+	}
+
+	// Learn the process sizing from finished runs. Docs-only mode runs no tasks.
+	if !docsOnly {
+		estimator.Start(ctx, metadataStore, estimator.Options{
+			Interval:        time.Duration(config.SCALEODM_LEARNED_SIZING_REFIT_INTERVAL_SECONDS) * time.Second,
+			MaxObservations: config.SCALEODM_LEARNED_SIZING_MAX_OBSERVATIONS,
+			MinObservations: config.SCALEODM_LEARNED_SIZING_MIN_OBSERVATIONS,
+			PriorWeight:     config.SCALEODM_LEARNED_SIZING_PRIOR_WEIGHT,
+			MarginSigmas:    config.SCALEODM_LEARNED_SIZING_MARGIN_SIGMAS,
+			Apply:           config.SCALEODM_LEARNED_SIZING_ENABLED,
+		})
+	}
+
+	// Start the queue dispatcher when ScaleODM owns the queue in front of Argo.
+	if config.SCALEODM_QUEUE_ENABLED {
+		dispatcher.Start(ctx, metadataStore, wfClient, dispatcher.Options{
+			Interval:            time.Duration(config.SCALEODM_QUEUE_DISPATCH_INTERVAL_SECONDS) * time.Second,
+			MaxActiveWorkflows:  config.SCALEODM_QUEUE_MAX_ACTIVE_WORKFLOWS,
+			ClaimTimeout:        time.Duration(config.SCALEODM_QUEUE_CLAIM_TIMEOUT_SECONDS) * time.Second,
+			MaxDispatchAttempts: config.SCALEODM_QUEUE_MAX_DISPATCH_ATTEMPTS,
+		})
+	}
+
 	// === HUMA CLI ===
 	// Channel to communicate the *http.Server back from the OnStart hook so
 	// we can shut it down gracefully when we receive a signal.
@@ -120,7 +173,9 @@ func main() {
 
 	cli := humacli.New(func(hooks humacli.Hooks, options *Options) {
 		apiObj, handler := api.NewAPI(metadataStore, wfClient)
-		_ = apiObj
+		if wfClient != nil {
+			go apiObj.WarmODMOptionCatalogs(ctx)
+		}
 		handler = observability.WrapHTTPHandler(handler)
 
 		readHeaderTimeout := time.Duration(config.SCALEODM_SERVER_READ_HEADER_TIMEOUT_SECONDS) * time.Second
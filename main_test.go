@@ -84,7 +84,7 @@ func TestE2E_CreateAndListJobs(t *testing.T) {
 		require.NoError(t, createErr)
 	}
 
-	jobs, err := store.ListJobs(ctx, "", "", 0, 0)
+	jobs, err := store.ListJobs(ctx, "", "", "", 0, 0)
 	require.NoError(t, err)
 	assert.GreaterOrEqual(t, len(jobs), 3)
 }